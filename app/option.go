@@ -54,6 +54,7 @@ func WithAdminAuth() AppContainerOption {
 func WithRBAC() AppContainerOption {
 	return func(c *AppContainer) {
 		c.RBACService = auth.NewRBACService(c.erpContext)
+		c.erpContext.RBACService = c.RBACService
 		log.Println("RBACService initialized")
 	}
 }
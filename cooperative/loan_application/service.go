@@ -15,6 +15,7 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -559,75 +560,82 @@ func (c *LoanApplicationService) ApprovalLoan(id, userID, status, remarks string
 // It returns an array of models.InstallmentDetail and error.
 // The installment detail contains installment number, principal amount, interest amount, admin fee, total paid, and remaining loan.
 // The function will calculate the installment table based on the loan application model and return the result.
+// Amounts are computed with exact decimal arithmetic and rounded with the rounding configuration of the company;
+// the last installment settles the remaining principal so that the principals add up to the loan amount.
 func (c *LoanApplicationService) GenerateInstallmentTable(loan *models.LoanApplicationModel) ([]models.InstallmentDetail, error) {
 	table := []models.InstallmentDetail{}
-	remainingLoan := loan.LoanAmount
-	fixedAdminFee := loan.AdminFee
+	if loan.RepaymentTerm <= 0 {
+		return table, nil
+	}
+	rounding := models.GetCompanyRounding(c.db, loan.CompanyID)
+	term := float64(loan.RepaymentTerm)
+	loanAmount := money.FromFloat(loan.LoanAmount)
+	remainingLoan := loanAmount
+	fixedAdminFee := rounding.Document(money.FromFloat(loan.AdminFee))
+	evenPrincipal := rounding.Document(loanAmount.Div(term))
 
 	// calculate annuity
-	interestRateMonthly := loan.InterestRate / 100 / float64(loan.RepaymentTerm)
-	annuityFactor := (math.Pow(1+interestRateMonthly, float64(loan.RepaymentTerm)) * interestRateMonthly) / (math.Pow(1+interestRateMonthly, float64(loan.RepaymentTerm)) - 1)
-	annuity := loan.LoanAmount * annuityFactor
-
-	totalProfit := loan.ProjectedProfit * loan.ExpectedProfitRate / 100
-	// totalDebt := loan.LoanAmount + totalProfit
-	// monthlyPayment := totalDebt / float64(loan.RepaymentTerm)
+	interestRateMonthly := loan.InterestRate / 100 / term
+	annuityFactor := (math.Pow(1+interestRateMonthly, term) * interestRateMonthly) / (math.Pow(1+interestRateMonthly, term) - 1)
+	annuity := rounding.Document(loanAmount.Mul(annuityFactor))
 
-	// remainingDebt := totalDebt
+	// Flat profit and interest are spread evenly; the last installment takes
+	// what is left so the table adds up to the exact total.
+	totalProfit := money.FromFloat(loan.ProjectedProfit).Percent(loan.ExpectedProfitRate)
+	totalFixedInterest := loanAmount.Percent(loan.InterestRate)
+	var paidInterest money.Amount
 
 	for i := 1; i <= loan.RepaymentTerm; i++ {
-		var interestAmount, totalPaid, principalAmount float64
+		var interestAmount, principalAmount money.Amount
+		last := i == loan.RepaymentTerm
 
 		switch loan.LoanType {
 		case "MUDHARABAH":
-			// interestAmount = remainingLoan * loan.ExpectedProfitRate / 100 / float64(loan.RepaymentTerm)
-			// principalAmount = loan.LoanAmount / float64(loan.RepaymentTerm)
-			// totalPaid = principalAmount + interestAmount + fixedAdminFee
-			interestAmount = totalProfit / float64(loan.RepaymentTerm)
-			principalAmount = loan.LoanAmount / float64(loan.RepaymentTerm)
-			totalPaid = principalAmount + interestAmount + fixedAdminFee
+			interestAmount = rounding.Document(totalProfit.Div(term))
+			if last {
+				interestAmount = rounding.Document(totalProfit).Sub(paidInterest)
+			}
+			principalAmount = evenPrincipal
 
 		case "QARDH_HASAN":
-			principalAmount = loan.LoanAmount / float64(loan.RepaymentTerm)
-			totalPaid = principalAmount + fixedAdminFee
+			principalAmount = evenPrincipal
 		default:
 			switch loan.ProfitType {
 			case "ANUITY":
 				if loan.InterestRate > 0 {
-					interestAmount = remainingLoan * interestRateMonthly
-					principalAmount = annuity - interestAmount
-					totalPaid = principalAmount + interestAmount + fixedAdminFee
+					interestAmount = rounding.Document(remainingLoan.Mul(interestRateMonthly))
+					principalAmount = annuity.Sub(interestAmount)
 				} else {
-					principalAmount = loan.LoanAmount / float64(loan.RepaymentTerm)
-					totalPaid = principalAmount + fixedAdminFee
+					principalAmount = evenPrincipal
 				}
 
 			case "FIXED":
-				interestAmount = loan.LoanAmount * loan.InterestRate / 100 / float64(loan.RepaymentTerm)
-				principalAmount = loan.LoanAmount / float64(loan.RepaymentTerm)
-				totalPaid = principalAmount + interestAmount + fixedAdminFee
+				interestAmount = rounding.Document(totalFixedInterest.Div(term))
+				if last {
+					interestAmount = rounding.Document(totalFixedInterest).Sub(paidInterest)
+				}
+				principalAmount = evenPrincipal
 			case "DECLINING":
-				interestAmount = remainingLoan * loan.InterestRate / 100 / float64(loan.RepaymentTerm)
-				principalAmount = loan.LoanAmount / float64(loan.RepaymentTerm)
-				totalPaid = principalAmount + interestAmount + fixedAdminFee
+				interestAmount = rounding.Document(remainingLoan.Percent(loan.InterestRate).Div(term))
+				principalAmount = evenPrincipal
 			default:
 				return nil, fmt.Errorf("unsupported profit type: %s", loan.ProfitType)
 			}
 		}
 
-		if i == loan.RepaymentTerm {
-			remainingLoan = 0
-		} else {
-			remainingLoan -= principalAmount
+		if last {
+			principalAmount = remainingLoan
 		}
+		remainingLoan = remainingLoan.Sub(principalAmount)
+		paidInterest = paidInterest.Add(interestAmount)
 
 		table = append(table, models.InstallmentDetail{
 			InstallmentNumber: i,
-			PrincipalAmount:   utils.AmountRound(principalAmount, 2),
-			InterestAmount:    utils.AmountRound(interestAmount, 2),
-			AdminFee:          utils.AmountRound(fixedAdminFee, 2),
-			TotalPaid:         utils.AmountRound(totalPaid, 2),
-			RemainingLoan:     utils.AmountRound(remainingLoan, 2),
+			PrincipalAmount:   principalAmount.Float64(),
+			InterestAmount:    interestAmount.Float64(),
+			AdminFee:          fixedAdminFee.Float64(),
+			TotalPaid:         money.Sum(principalAmount, interestAmount, fixedAdminFee).Float64(),
+			RemainingLoan:     remainingLoan.Float64(),
 		})
 
 	}
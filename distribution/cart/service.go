@@ -3,9 +3,11 @@ package cart
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/inventory"
+	"github.com/AMETORY/ametory-erp-modules/inventory/reservation"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"gorm.io/gorm"
 )
@@ -234,8 +236,10 @@ func (s *CartService) parseItem(v *models.CartItemModel, originalPrice, adjustme
 
 // AddItemToCart adds a new item to the active cart of the given user ID.
 // If the item is already in the cart, it updates the quantity.
+// The quantity of the item is soft reserved in the default warehouse of the merchant
+// for CartReservationTTL, so another cart cannot claim the same stock.
 // The function returns an error if there is a database error.
-// It also returns an error if the product is not active.
+// It also returns an error if the product is not active or its stock cannot cover the item.
 func (s *CartService) AddItemToCart(userID string, productID string, variantID *string, quantity float64) error {
 	// Dapatkan cart active
 	cart, err := s.GetOrCreateActiveCart(userID)
@@ -316,9 +320,12 @@ func (s *CartService) AddItemToCart(userID string, productID string, variantID *
 				CategoryID:      product.CategoryID,
 				BrandID:         product.BrandID,
 			}
-			if err := s.db.Create(&item).Error; err != nil {
-				return err
-			}
+			return s.db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&item).Error; err != nil {
+					return err
+				}
+				return s.reserveItem(tx, cart, item.ID, productID, variantID, item.Quantity)
+			})
 		} else {
 			return err
 		}
@@ -327,12 +334,13 @@ func (s *CartService) AddItemToCart(userID string, productID string, variantID *
 		// Update quantity jika item sudah ada
 		existingItem.Quantity += quantity
 		existingItem.Price = price
-		if err := s.db.Save(&existingItem).Error; err != nil {
-			return err
-		}
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&existingItem).Error; err != nil {
+				return err
+			}
+			return s.reserveItem(tx, cart, existingItem.ID, productID, variantID, existingItem.Quantity)
+		})
 	}
-
-	return nil
 }
 
 // DeleteItemCart deletes an item from the active cart of the given user ID.
@@ -346,11 +354,12 @@ func (s *CartService) DeleteItemCart(userID string, itemID string) error {
 	}
 
 	// Hapus item dari cart
-	if err := s.db.Where("cart_id = ? AND id = ?", cart.ID, itemID).Unscoped().Delete(&models.CartItemModel{}).Error; err != nil {
-		return err
-	}
-
-	return nil
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cart_id = ? AND id = ?", cart.ID, itemID).Unscoped().Delete(&models.CartItemModel{}).Error; err != nil {
+			return err
+		}
+		return s.reserveItem(tx, cart, itemID, "", nil, 0)
+	})
 }
 
 // UpdateItemCart updates the quantity of an item in the active cart of the given user ID.
@@ -371,11 +380,12 @@ func (s *CartService) UpdateItemCart(userID string, itemID string, quantity floa
 		return err
 	}
 	existingItem.Quantity = quantity
-	if err := s.db.Save(&existingItem).Error; err != nil {
-		return err
-	}
-
-	return nil
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingItem).Error; err != nil {
+			return err
+		}
+		return s.reserveItem(tx, cart, existingItem.ID, existingItem.ProductID, existingItem.VariantID, existingItem.Quantity)
+	})
 }
 
 // FinishCart changes the status of the active cart for the given user to "FINISHED".
@@ -397,7 +407,55 @@ func (s *CartService) FinishCart(userID string) error {
 		return err
 	}
 
-	return nil
+	if s.inventoryService == nil {
+		return nil
+	}
+	return s.inventoryService.ReservationService.Release("cart", cart.ID)
+}
+
+// reserveItem sets the soft reservation of a cart item to its quantity in the
+// default warehouse of the merchant, or releases it when the quantity is zero.
+// Nothing is reserved when the cart has no merchant or the merchant has no
+// default warehouse.
+func (s *CartService) reserveItem(tx *gorm.DB, cart *models.CartModel, itemID, productID string, variantID *string, quantity float64) error {
+	if s.inventoryService == nil {
+		return nil
+	}
+	// The reservations are written through a service of the transaction, not the
+	// shared one, so concurrent requests never use each other's transaction.
+	reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+	if quantity <= 0 {
+		return reservationService.ReleaseItem("cart", cart.ID, itemID)
+	}
+
+	merchantID := cart.MerchantID
+	if merchantID == nil {
+		merchantID = s.merchantID
+	}
+	if merchantID == nil {
+		return nil
+	}
+	var merchant models.MerchantModel
+	if err := tx.Select("id", "company_id", "default_warehouse_id").Where("id = ?", *merchantID).First(&merchant).Error; err != nil {
+		return err
+	}
+	if merchant.DefaultWarehouseID == nil {
+		return nil
+	}
+	expiresAt := time.Now().Add(reservation.CartReservationTTL)
+	return reservationService.SetReservation(&models.StockReservationModel{
+		CompanyID:      merchant.CompanyID,
+		MerchantID:     merchantID,
+		ProductID:      productID,
+		VariantID:      variantID,
+		WarehouseID:    *merchant.DefaultWarehouseID,
+		Quantity:       quantity,
+		Type:           models.RESERVATION_SOFT,
+		ReferenceID:    cart.ID,
+		ReferenceType:  "cart",
+		SecondaryRefID: &itemID,
+		ExpiresAt:      &expiresAt,
+	})
 }
 
 // CountSubTotalByCartID returns the total price of all items in the cart with the given cart ID.
@@ -404,7 +404,7 @@ func (s *LogisticService) StartShipmentLegDelivery(shipmentLegID string, date ti
 	}
 
 	for _, v := range shipmentLeg.Shipment.Items {
-		if _, err := s.inventoryService.StockMovementService.AddMovement(
+		if _, err := s.inventoryService.StockMovementService.AddMovements(
 			date,
 			*v.ProductID,
 			*shipmentLeg.FromLocation.WarehouseID,
@@ -435,6 +435,35 @@ func (s *LogisticService) StartShipmentLegDelivery(shipmentLegID string, date ti
 	return s.UpdateIsDelayedForShipment(*shipmentLeg.ShipmentID)
 }
 
+// GetPickingList returns the picking list of the items of a shipment leg from the
+// warehouse of its origin, sorted by the picking route of the warehouse bins. The
+// ReferenceID of a line is the ID of its shipment item.
+func (s *LogisticService) GetPickingList(shipmentLegID string) ([]models.PickingLine, error) {
+	shipmentLeg := models.ShipmentLegModel{}
+	if err := s.db.
+		Preload("Shipment.Items").
+		Preload("FromLocation").
+		First(&shipmentLeg, "id = ?", shipmentLegID).Error; err != nil {
+		return nil, err
+	}
+	if shipmentLeg.FromLocation == nil || shipmentLeg.FromLocation.WarehouseID == nil {
+		return nil, errors.New("from location has no warehouse")
+	}
+
+	requests := []models.PickingRequest{}
+	for _, v := range shipmentLeg.Shipment.Items {
+		if v.ProductID == nil {
+			continue
+		}
+		requests = append(requests, models.PickingRequest{
+			ReferenceID: v.ID,
+			ProductID:   *v.ProductID,
+			Quantity:    v.Quantity,
+		})
+	}
+	return s.inventoryService.StockMovementService.BuildPickingList(*shipmentLeg.FromLocation.WarehouseID, requests)
+}
+
 // ArrivedShipmentLegDelivery marks a shipment leg as ARRIVED. It takes a shipment
 // leg ID, a date, and an optional notes string as input. It first checks if the
 // shipment leg status is IN_DELIVERY. If not, it returns an error. If the notes string is
@@ -466,7 +495,7 @@ func (s *LogisticService) ArrivedShipmentLegDelivery(shipmentLegID string, date
 	if shipmentLeg.ToLocation.WarehouseID != nil {
 
 		for _, v := range shipmentLeg.Shipment.Items {
-			if _, err := s.inventoryService.StockMovementService.AddMovement(
+			if _, err := s.inventoryService.StockMovementService.AddMovements(
 				date,
 				*v.ProductID,
 				*shipmentLeg.ToLocation.WarehouseID,
@@ -656,7 +685,7 @@ func (s *LogisticService) ReportLostOrDamage(shipmentID string,
 
 	for _, v := range data.Items {
 		if v.ProductID != nil {
-			if _, err := s.inventoryService.StockMovementService.AddMovement(
+			if _, err := s.inventoryService.StockMovementService.AddMovements(
 				date,
 				*v.ProductID,
 				*shipmentLeg.ToLocationID,
@@ -681,7 +710,7 @@ func (s *LogisticService) ReportLostOrDamage(shipmentID string,
 		}
 		for _, v := range data.Items {
 			if v.ProductID != nil {
-				if _, err := s.inventoryService.StockMovementService.AddMovement(
+				if _, err := s.inventoryService.StockMovementService.AddMovements(
 					date,
 					*v.ProductID,
 					*wasteWarehouseID,
@@ -3,8 +3,11 @@ package offering
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/inventory"
+	"github.com/AMETORY/ametory-erp-modules/inventory/reservation"
 	"github.com/AMETORY/ametory-erp-modules/shared/audit_trail"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"gorm.io/gorm"
@@ -198,7 +201,9 @@ func (s *OfferingService) CreateOffers(orderRequest models.OrderRequestModel, av
 // is not in the pending status.
 //
 // If the offer is taken successfully, the method also updates the order request status
-// to Accepted and sets the merchant ID.
+// to Accepted and sets the merchant ID, and hard reserves the items of the offer in the
+// default warehouse of the merchant for OrderReservationTTL. Taking the offer fails when
+// the stock cannot cover them.
 //
 // Params:
 // - offerID (string): The ID of the offer to be taken.
@@ -245,6 +250,10 @@ func (s *OfferingService) TakeOffer(offerID string, totalPrice, shippingFee, dis
 			return err
 		}
 
+		if err := s.reserveOffer(tx, offer); err != nil {
+			return err
+		}
+
 		orderRequest.Status = "Accepted"
 		orderRequest.MerchantID = &offer.MerchantID
 		err = tx.Save(&orderRequest).Error
@@ -256,6 +265,47 @@ func (s *OfferingService) TakeOffer(offerID string, totalPrice, shippingFee, dis
 	})
 }
 
+// reserveOffer hard reserves the items of a taken offer in the default warehouse
+// of its merchant. Nothing is reserved when there is no inventory service or the
+// merchant has no default warehouse.
+func (s *OfferingService) reserveOffer(tx *gorm.DB, offer models.OfferModel) error {
+	invSrv, ok := s.ctx.InventoryService.(*inventory.InventoryService)
+	if !ok || invSrv.ReservationService == nil {
+		return nil
+	}
+	var merchant models.MerchantModel
+	if err := tx.Select("id", "company_id", "default_warehouse_id").Where("id = ?", offer.MerchantID).First(&merchant).Error; err != nil {
+		return err
+	}
+	if merchant.DefaultWarehouseID == nil {
+		return nil
+	}
+
+	reservationService := reservation.NewReservationService(tx, s.ctx, invSrv.StockMovementService)
+	expiresAt := time.Now().Add(reservation.OrderReservationTTL)
+	for _, v := range offer.MerchantAvailableProduct.Items {
+		if v.Quantity <= 0 {
+			continue
+		}
+		err := reservationService.Reserve(&models.StockReservationModel{
+			CompanyID:     merchant.CompanyID,
+			MerchantID:    &merchant.ID,
+			ProductID:     v.ProductID,
+			VariantID:     v.VariantID,
+			WarehouseID:   *merchant.DefaultWarehouseID,
+			Quantity:      v.Quantity,
+			Type:          models.RESERVATION_HARD,
+			ReferenceID:   offer.ID,
+			ReferenceType: "offer",
+			ExpiresAt:     &expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // func (s *OfferingService) TakeOrder(orderRequestID string, merchantID string) error {
 // 	return s.db.Transaction(func(tx *gorm.DB) error {
 // 		orderRequest := models.OrderRequestModel{}
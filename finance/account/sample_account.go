@@ -165,6 +165,16 @@ var GenericChartOfAccount = []models.AccountModel{
 		Category:         constants.CATEGORY_REVENUE,
 		IsReturn:         true,
 	},
+	{
+		Code:                  "71001",
+		Name:                  "Laba (Rugi) Selisih Kurs",
+		Type:                  models.INCOME,
+		CashflowSubGroup:      constants.OTHER_INCOME,
+		CashflowGroup:         constants.CASHFLOW_GROUP_OPERATING,
+		Category:              constants.CATEGORY_OTHER_INCOME,
+		IsRealizedFxAccount:   true,
+		IsUnrealizedFxAccount: true,
+	},
 	// {
 	// 	Name:             "Biaya Depresiasi",
 	// 	Code:             "51003",
@@ -0,0 +1,480 @@
+package asset
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"gorm.io/gorm"
+)
+
+// RecordUnits records the units an asset depreciated with the units of production
+// method (UOP) produced in the period of a depreciation cost, and prices the cost as
+// the share of those units in the production units that are left.
+//
+// The cost must not be applied yet. It returns an error if the units are more than
+// the production units that are left.
+func (s *AssetService) RecordUnits(asset *models.AssetModel, itemID string, units float64) error {
+	if asset.DepreciationMethod != "UOP" {
+		return errors.New("asset is not depreciated by units of production")
+	}
+	if units <= 0 {
+		return errors.New("units must be greater than zero")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		depreciation := models.DepreciationCostModel{}
+		if err := tx.Where("asset_id = ? AND id = ? AND status IN ?", asset.ID, itemID, []string{"PENDING", "ACTIVE"}).First(&depreciation).Error; err != nil {
+			return err
+		}
+		recorded := []models.DepreciationCostModel{}
+		if err := tx.Where("asset_id = ? AND id <> ? AND units > 0 AND status <> ?", asset.ID, itemID, "CANCELLED").Find(&recorded).Error; err != nil {
+			return err
+		}
+		remainingUnits := asset.ProductionUnits
+		base := asset.BookValue - asset.SalvageValue
+		for _, v := range recorded {
+			remainingUnits -= v.Units
+			if v.Status != "DONE" {
+				base -= v.Amount
+			}
+		}
+		if units > remainingUnits {
+			return fmt.Errorf("only %v production units are left", remainingUnits)
+		}
+		amount := 0.0
+		if base > 0 {
+			amount = utils.AmountRound(base*units/remainingUnits, 2)
+		}
+		return tx.Model(&depreciation).Where("id = ?", depreciation.ID).Updates(map[string]any{
+			"units":  units,
+			"amount": amount,
+		}).Error
+	})
+}
+
+// RevalueAsset revalues an active asset to its fair value. An increase is debited to
+// the fixed asset account and credited to the given account, usually a revaluation
+// surplus in equity; a decrease is posted the other way round. The remaining
+// depreciation schedule is recalculated from the new book value.
+func (s *AssetService) RevalueAsset(asset *models.AssetModel, date time.Time, fairValue float64, accountID string, notes string, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if asset.Status != "ACTIVE" {
+			return errors.New("asset is not active")
+		}
+		if err := period.Check(tx, asset.CompanyID, "asset", date); err != nil {
+			return err
+		}
+		fairValue = utils.AmountRound(fairValue, 2)
+		diff := utils.AmountRound(fairValue-asset.BookValue, 2)
+		if diff == 0 {
+			return errors.New("fair value is equal to the book value")
+		}
+
+		code := utils.RandString(10, false)
+		description := "Revaluasi " + asset.Name + " - " + asset.AssetNumber
+		lines := []models.TransactionModel{}
+		if diff > 0 {
+			lines = append(lines,
+				assetTransaction(asset, code, asset.AccountFixedAssetID, diff, 0, description, date, userID),
+				assetTransaction(asset, code, &accountID, 0, diff, description, date, userID),
+			)
+		} else {
+			lines = append(lines,
+				assetTransaction(asset, code, &accountID, -diff, 0, description, date, userID),
+				assetTransaction(asset, code, asset.AccountFixedAssetID, 0, -diff, description, date, userID),
+			)
+		}
+		if err := tx.Create(&lines).Error; err != nil {
+			return err
+		}
+
+		event := models.AssetEventModel{
+			CompanyID:       asset.CompanyID,
+			UserID:          &userID,
+			AssetID:         &asset.ID,
+			Type:            models.ASSET_EVENT_REVALUATION,
+			Date:            date,
+			Code:            code,
+			Amount:          diff,
+			BookValueBefore: asset.BookValue,
+			BookValueAfter:  fairValue,
+			AccountID:       &accountID,
+			Notes:           notes,
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		asset.RevaluationAmount = utils.AmountRound(asset.RevaluationAmount+diff, 2)
+		asset.BookValue = fairValue
+		if err := tx.Save(asset).Error; err != nil {
+			return err
+		}
+		return rescheduleDepreciations(tx, asset)
+	})
+}
+
+// ImpairAsset writes an active asset down to its recoverable amount. The impairment
+// loss is debited to the given expense account and credited to the accumulated
+// depreciation account. The remaining depreciation schedule is recalculated from
+// the new book value.
+func (s *AssetService) ImpairAsset(asset *models.AssetModel, date time.Time, recoverableAmount float64, accountID string, notes string, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if asset.Status != "ACTIVE" {
+			return errors.New("asset is not active")
+		}
+		if err := period.Check(tx, asset.CompanyID, "asset", date); err != nil {
+			return err
+		}
+		recoverableAmount = utils.AmountRound(recoverableAmount, 2)
+		loss := utils.AmountRound(asset.BookValue-recoverableAmount, 2)
+		if loss <= 0 {
+			return errors.New("recoverable amount is not below the book value")
+		}
+
+		code := utils.RandString(10, false)
+		description := "Penurunan Nilai " + asset.Name + " - " + asset.AssetNumber
+		lines := []models.TransactionModel{
+			assetTransaction(asset, code, &accountID, loss, 0, description, date, userID),
+			assetTransaction(asset, code, asset.AccountAccumulatedDepreciationID, 0, loss, description, date, userID),
+		}
+		if err := tx.Create(&lines).Error; err != nil {
+			return err
+		}
+
+		event := models.AssetEventModel{
+			CompanyID:       asset.CompanyID,
+			UserID:          &userID,
+			AssetID:         &asset.ID,
+			Type:            models.ASSET_EVENT_IMPAIRMENT,
+			Date:            date,
+			Code:            code,
+			Amount:          -loss,
+			BookValueBefore: asset.BookValue,
+			BookValueAfter:  recoverableAmount,
+			AccountID:       &accountID,
+			Notes:           notes,
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		asset.ImpairmentAmount = utils.AmountRound(asset.ImpairmentAmount+loss, 2)
+		asset.BookValue = recoverableAmount
+		if err := tx.Save(asset).Error; err != nil {
+			return err
+		}
+		return rescheduleDepreciations(tx, asset)
+	})
+}
+
+// TransferAsset moves an asset to another branch, project or department. For an
+// active asset the cost and accumulated depreciation are moved to the new analytic
+// dimensions with a journal on the transfer date, so reports filtered by dimension
+// follow the asset. The depreciation applied after the transfer is charged to the
+// new dimensions, which must be active dimensions of the company.
+func (s *AssetService) TransferAsset(asset *models.AssetModel, date time.Time, to models.AnalyticDimensions, notes string, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if asset.Status == "DISPOSED" {
+			return errors.New("asset is disposed")
+		}
+		for _, v := range models.AnalyticDimensionTypes {
+			if value := to.Get(v.Name); value != nil && *value == "" {
+				to.Set(v.Name, nil)
+			}
+		}
+		if sameDimensions(asset.AnalyticDimensions, to) {
+			return errors.New("asset is already in the given branch and cost center")
+		}
+		if err := models.CheckAnalyticDimensions(tx, asset.CompanyID, to); err != nil {
+			return err
+		}
+
+		code := utils.RandString(10, false)
+		if asset.Status == "ACTIVE" {
+			if err := period.Check(tx, asset.CompanyID, "asset", date); err != nil {
+				return err
+			}
+			gross := utils.AmountRound(grossCost(asset), 2)
+			accumulated := utils.AmountRound(gross-asset.BookValue, 2)
+			description := "Mutasi " + asset.Name + " - " + asset.AssetNumber
+
+			lines := []models.TransactionModel{
+				assetTransaction(asset, code, asset.AccountFixedAssetID, 0, gross, description, date, userID),
+				assetTransaction(asset, code, asset.AccountFixedAssetID, gross, 0, description, date, userID),
+			}
+			lines[1].AnalyticDimensions = to
+			if accumulated > 0 {
+				lines = append(lines,
+					assetTransaction(asset, code, asset.AccountAccumulatedDepreciationID, accumulated, 0, "Akumulasi "+description, date, userID),
+					assetTransaction(asset, code, asset.AccountAccumulatedDepreciationID, 0, accumulated, "Akumulasi "+description, date, userID),
+				)
+				lines[3].AnalyticDimensions = to
+			}
+			if err := tx.Create(&lines).Error; err != nil {
+				return err
+			}
+		}
+
+		event := models.AssetEventModel{
+			CompanyID:       asset.CompanyID,
+			UserID:          &userID,
+			AssetID:         &asset.ID,
+			Type:            models.ASSET_EVENT_TRANSFER,
+			Date:            date,
+			Code:            code,
+			BookValueBefore: asset.BookValue,
+			BookValueAfter:  asset.BookValue,
+			From:            asset.AnalyticDimensions,
+			To:              to,
+			Notes:           notes,
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		asset.AnalyticDimensions = to
+		asset.Branch = nil
+		asset.Project = nil
+		asset.Department = nil
+		return tx.Model(&models.AssetModel{}).Where("id = ?", asset.ID).Updates(map[string]any{
+			"branch_id":     to.BranchID,
+			"project_id":    to.ProjectID,
+			"department_id": to.DepartmentID,
+		}).Error
+	})
+}
+
+// DisposeAsset sells or scraps an active asset.
+//
+// For a monthly schedule the depreciation of the months before the disposal must be
+// applied first; the depreciation of the disposal month is pro-rated to the days the
+// asset is held and applied with the disposal. The rest of the schedule is cancelled.
+//
+// The journal takes the cost and accumulated depreciation off the books, debits the
+// proceeds to the given account (cash or receivable) and posts the difference between
+// the proceeds and the book value as a gain or loss to the gain/loss account.
+func (s *AssetService) DisposeAsset(asset *models.AssetModel, date time.Time, disposalType string, proceeds float64, proceedsAccountID, gainLossAccountID *string, notes string, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if asset.Status != "ACTIVE" {
+			return errors.New("asset is not active")
+		}
+		switch disposalType {
+		case models.ASSET_DISPOSAL_SALE, models.ASSET_DISPOSAL_SCRAP:
+		default:
+			return errors.New("invalid disposal type")
+		}
+		proceeds = utils.AmountRound(proceeds, 2)
+		if proceeds < 0 {
+			return errors.New("proceeds must not be negative")
+		}
+		if proceeds > 0 && proceedsAccountID == nil {
+			return errors.New("please set the account of the proceeds")
+		}
+		if err := period.Check(tx, asset.CompanyID, "asset", date); err != nil {
+			return err
+		}
+
+		code := utils.RandString(10, false)
+		rows := []models.DepreciationCostModel{}
+		if err := tx.Where("asset_id = ? AND status IN ?", asset.ID, []string{"PENDING", "ACTIVE"}).Order("seq_number").Find(&rows).Error; err != nil {
+			return err
+		}
+		var charged *models.DepreciationCostModel
+		if asset.IsMonthly {
+			disposalMonth := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+			for i, v := range rows {
+				start := depreciationDate(asset, v)
+				month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, date.Location())
+				if month.Before(disposalMonth) {
+					return fmt.Errorf("depreciation of %s has not been applied", depreciationLabel(asset, v))
+				}
+				if month.Equal(disposalMonth) && asset.DepreciationMethod != "UOP" {
+					charged = &rows[i]
+				}
+			}
+		}
+		if charged != nil {
+			daysInMonth := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location()).Day()
+			held, days := date.Day(), daysInMonth
+			if charged.SeqNumber == 1 && asset.ProRata {
+				held = date.Day() - asset.Date.Day() + 1
+				days = daysInMonth - asset.Date.Day() + 1
+			}
+			amount := utils.AmountRound(charged.Amount*math.Min(1, float64(held)/float64(days)), 2)
+			if amount > 0 {
+				label := depreciationLabel(asset, *charged)
+				lines := []models.TransactionModel{
+					assetTransaction(asset, code, asset.AccountDepreciationID, amount, 0, fmt.Sprintf("Biaya Penyusutan %s %s - %s", asset.Name, label, asset.AssetNumber), date, userID),
+					assetTransaction(asset, code, asset.AccountAccumulatedDepreciationID, 0, amount, fmt.Sprintf("Akumulasi Penyusutan %s %s - %s", asset.Name, label, asset.AssetNumber), date, userID),
+				}
+				if err := tx.Create(&lines).Error; err != nil {
+					return err
+				}
+				asset.BookValue = utils.AmountRound(asset.BookValue-amount, 2)
+			}
+			if err := tx.Model(&models.DepreciationCostModel{}).Where("id = ?", charged.ID).Updates(map[string]any{
+				"amount":      amount,
+				"status":      "DONE",
+				"executed_at": date,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		for _, v := range rows {
+			if charged != nil && v.ID == charged.ID {
+				continue
+			}
+			if err := tx.Model(&models.DepreciationCostModel{}).Where("id = ?", v.ID).Update("status", "CANCELLED").Error; err != nil {
+				return err
+			}
+		}
+
+		gross := utils.AmountRound(grossCost(asset), 2)
+		bookValue := utils.AmountRound(asset.BookValue, 2)
+		accumulated := utils.AmountRound(gross-bookValue, 2)
+		gainLoss := utils.AmountRound(proceeds-bookValue, 2)
+		if gainLoss != 0 && gainLossAccountID == nil {
+			return errors.New("please set the gain/loss account of the disposal")
+		}
+
+		description := "Penjualan " + asset.Name + " - " + asset.AssetNumber
+		if disposalType == models.ASSET_DISPOSAL_SCRAP {
+			description = "Penghapusan " + asset.Name + " - " + asset.AssetNumber
+		}
+		lines := []models.TransactionModel{}
+		if accumulated > 0 {
+			lines = append(lines, assetTransaction(asset, code, asset.AccountAccumulatedDepreciationID, accumulated, 0, "Akumulasi "+description, date, userID))
+		}
+		if proceeds > 0 {
+			lines = append(lines, assetTransaction(asset, code, proceedsAccountID, proceeds, 0, description, date, userID))
+		}
+		lines = append(lines, assetTransaction(asset, code, asset.AccountFixedAssetID, 0, gross, description, date, userID))
+		if gainLoss > 0 {
+			lines = append(lines, assetTransaction(asset, code, gainLossAccountID, 0, gainLoss, "Laba Pelepasan "+asset.Name+" - "+asset.AssetNumber, date, userID))
+		}
+		if gainLoss < 0 {
+			lines = append(lines, assetTransaction(asset, code, gainLossAccountID, -gainLoss, 0, "Rugi Pelepasan "+asset.Name+" - "+asset.AssetNumber, date, userID))
+		}
+		if err := tx.Create(&lines).Error; err != nil {
+			return err
+		}
+
+		event := models.AssetEventModel{
+			CompanyID:       asset.CompanyID,
+			UserID:          &userID,
+			AssetID:         &asset.ID,
+			Type:            models.ASSET_EVENT_DISPOSAL,
+			Date:            date,
+			Code:            code,
+			Amount:          -bookValue,
+			BookValueBefore: bookValue,
+			Proceeds:        proceeds,
+			GainLoss:        gainLoss,
+			AccountID:       gainLossAccountID,
+			Notes:           notes,
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		asset.Status = "DISPOSED"
+		asset.DisposalType = disposalType
+		asset.DisposalDate = &date
+		asset.DisposalAmount = proceeds
+		asset.BookValue = 0
+		return tx.Save(asset).Error
+	})
+}
+
+// rescheduleDepreciations spreads the depreciable amount left after a revaluation or
+// an impairment over the depreciation costs that are not applied yet, in proportion
+// to their current amounts so the schedule keeps the shape of its method.
+func rescheduleDepreciations(tx *gorm.DB, asset *models.AssetModel) error {
+	rows := []models.DepreciationCostModel{}
+	if err := tx.Where("asset_id = ? AND status IN ?", asset.ID, []string{"PENDING", "ACTIVE"}).Order("seq_number").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	depreciable := math.Max(asset.BookValue-asset.SalvageValue, 0)
+	weights := make([]money.Amount, len(rows))
+	allZero := true
+	for i, v := range rows {
+		weights[i] = money.FromFloat(v.Amount)
+		if !weights[i].IsZero() {
+			allZero = false
+		}
+	}
+	if allZero {
+		for i := range weights {
+			weights[i] = money.FromFloat(1)
+		}
+	}
+	parts := money.FromFloat(depreciable).Allocate(weights, 2)
+	for i, v := range rows {
+		if err := tx.Model(&models.DepreciationCostModel{}).Where("id = ?", v.ID).Update("amount", parts[i].Float64()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assetTransaction returns a ledger line of a journal of the asset.
+func assetTransaction(asset *models.AssetModel, code string, accountID *string, debit, credit float64, description string, date time.Time, userID string) models.TransactionModel {
+	return models.TransactionModel{
+		Code:                        code,
+		CompanyID:                   asset.CompanyID,
+		UserID:                      &userID,
+		Debit:                       debit,
+		Credit:                      credit,
+		Amount:                      debit + credit,
+		AccountID:                   accountID,
+		Description:                 description,
+		Date:                        date,
+		TransactionSecondaryRefID:   &asset.ID,
+		TransactionSecondaryRefType: "asset",
+		AnalyticDimensions:          asset.AnalyticDimensions,
+	}
+}
+
+// grossCost returns the cost of the asset on the fixed asset account: the
+// acquisition cost and the revaluations.
+func grossCost(asset *models.AssetModel) float64 {
+	return asset.AcquisitionCost + asset.RevaluationAmount
+}
+
+// depreciationDate returns the start of the month or year a depreciation cost is
+// charged for.
+func depreciationDate(asset *models.AssetModel, depreciation models.DepreciationCostModel) time.Time {
+	if asset.IsMonthly {
+		return asset.Date.AddDate(depreciation.Period-1, depreciation.Month-1, 0)
+	}
+	return asset.Date.AddDate(depreciation.Period-1, 0, 0)
+}
+
+func depreciationLabel(asset *models.AssetModel, depreciation models.DepreciationCostModel) string {
+	if asset.IsMonthly {
+		return depreciationDate(asset, depreciation).Format("Jan-2006")
+	}
+	return depreciationDate(asset, depreciation).Format("2006")
+}
+
+func sameDimensions(a, b models.AnalyticDimensions) bool {
+	for _, v := range models.AnalyticDimensionTypes {
+		x, y := a.Get(v.Name), b.Get(v.Name)
+		if (x == nil || *x == "") != (y == nil || *y == "") {
+			return false
+		}
+		if x != nil && y != nil && *x != *y {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package asset
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+)
+
+// GetAssetRegister returns the fixed asset register of a company as of a date: the
+// assets activated on or before the date and not disposed by then.
+//
+// The cost and accumulated depreciation of an asset are summed from its ledger lines
+// on the fixed asset and accumulated depreciation accounts up to the date, so the
+// register agrees with the balance sheet of that date. Impairments are taken out of
+// the accumulated depreciation and shown on their own. An asset is placed in the
+// branch, project and department it was in on the date, and the dimensions filter
+// the assets the same way they filter the ledger lines of a report.
+func (s *AssetService) GetAssetRegister(companyID string, date time.Time, dimensions models.AnalyticDimensions) (*models.AssetRegister, error) {
+	register := models.AssetRegister{
+		Date:       date,
+		Dimensions: dimensions,
+		Items:      []models.AssetRegisterItem{},
+	}
+
+	assets := []models.AssetModel{}
+	err := s.db.Where("company_id = ? AND status IN ? AND date <= ?", companyID, []string{"ACTIVE", "DISPOSED"}, date).
+		Where("disposal_date IS NULL OR disposal_date > ?", date).
+		Order("asset_number").
+		Find(&assets).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return &register, nil
+	}
+	ids := []string{}
+	for _, v := range assets {
+		ids = append(ids, v.ID)
+	}
+
+	var balances []struct {
+		AssetID   string
+		AccountID string
+		Debit     float64
+		Credit    float64
+	}
+	err = s.db.Model(&models.TransactionModel{}).
+		Select("transaction_secondary_ref_id AS asset_id, account_id, SUM(debit) AS debit, SUM(credit) AS credit").
+		Where("transaction_secondary_ref_type = ? AND transaction_secondary_ref_id IN ? AND date <= ?", "asset", ids, date).
+		Group("transaction_secondary_ref_id, account_id").
+		Scan(&balances).Error
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AssetEventModel{}
+	err = s.db.Where("asset_id IN ? AND type IN ?", ids, []string{models.ASSET_EVENT_IMPAIRMENT, models.ASSET_EVENT_TRANSFER}).
+		Order("date, created_at").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, asset := range assets {
+		item := models.AssetRegisterItem{
+			AnalyticDimensions: dimensionsAt(asset, events, date),
+			AssetID:            asset.ID,
+			AssetNumber:        asset.AssetNumber,
+			Name:               asset.Name,
+			Date:               asset.Date,
+			DepreciationMethod: asset.DepreciationMethod,
+			LifeTime:           asset.LifeTime,
+		}
+		if !matchDimensions(dimensions, item.AnalyticDimensions) {
+			continue
+		}
+		for _, v := range balances {
+			if v.AssetID != asset.ID {
+				continue
+			}
+			if asset.AccountFixedAssetID != nil && v.AccountID == *asset.AccountFixedAssetID {
+				item.Cost += v.Debit - v.Credit
+			}
+			if asset.AccountAccumulatedDepreciationID != nil && v.AccountID == *asset.AccountAccumulatedDepreciationID {
+				item.AccumulatedDepreciation += v.Credit - v.Debit
+			}
+		}
+		for _, v := range events {
+			if v.AssetID != nil && *v.AssetID == asset.ID && v.Type == models.ASSET_EVENT_IMPAIRMENT && !v.Date.After(date) {
+				item.Impairment -= v.Amount
+			}
+		}
+		item.Cost = utils.AmountRound(item.Cost, 2)
+		item.Impairment = utils.AmountRound(item.Impairment, 2)
+		item.AccumulatedDepreciation = utils.AmountRound(item.AccumulatedDepreciation-item.Impairment, 2)
+		item.BookValue = utils.AmountRound(item.Cost-item.AccumulatedDepreciation-item.Impairment, 2)
+
+		register.Items = append(register.Items, item)
+		register.Cost += item.Cost
+		register.AccumulatedDepreciation += item.AccumulatedDepreciation
+		register.Impairment += item.Impairment
+		register.BookValue += item.BookValue
+	}
+	register.Cost = utils.AmountRound(register.Cost, 2)
+	register.AccumulatedDepreciation = utils.AmountRound(register.AccumulatedDepreciation, 2)
+	register.Impairment = utils.AmountRound(register.Impairment, 2)
+	register.BookValue = utils.AmountRound(register.BookValue, 2)
+	return &register, nil
+}
+
+// dimensionsAt returns the dimensions the asset was in on the date: those it was
+// transferred to by the last transfer on or before the date, or those it was
+// transferred from by the first transfer after it.
+func dimensionsAt(asset models.AssetModel, events []models.AssetEventModel, date time.Time) models.AnalyticDimensions {
+	var before, after *models.AssetEventModel
+	for i, v := range events {
+		if v.AssetID == nil || *v.AssetID != asset.ID || v.Type != models.ASSET_EVENT_TRANSFER {
+			continue
+		}
+		if !v.Date.After(date) {
+			before = &events[i]
+		} else if after == nil {
+			after = &events[i]
+		}
+	}
+	switch {
+	case before != nil:
+		return before.To
+	case after != nil:
+		return after.From
+	}
+	return asset.AnalyticDimensions
+}
+
+// matchDimensions reports whether the dimensions pass the filter. A nil filter value
+// is not filtered and an empty one only matches a missing dimension.
+func matchDimensions(filter, dimensions models.AnalyticDimensions) bool {
+	for _, v := range models.AnalyticDimensionTypes {
+		want, got := filter.Get(v.Name), dimensions.Get(v.Name)
+		switch {
+		case want == nil:
+		case *want == "":
+			if got != nil && *got != "" {
+				return false
+			}
+		default:
+			if got == nil || *got != *want {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
@@ -30,16 +31,20 @@ func NewAssetService(db *gorm.DB, ctx *context.ERPContext) *AssetService {
 	return &AssetService{ctx: ctx, db: db}
 }
 
-// Migrate migrates the asset model. It will create the tables if they do not exist
-// and migrate the schema if there are any changes.
+// Migrate migrates the asset, depreciation cost and asset event models. It will
+// create the tables if they do not exist and migrate the schema if there are any changes.
 func Migrate(db *gorm.DB) error {
 	fmt.Println("Migrating account model...")
-	return db.AutoMigrate(&models.AssetModel{}, &models.DepreciationCostModel{})
+	return db.AutoMigrate(&models.AssetModel{}, &models.DepreciationCostModel{}, &models.AssetEventModel{})
 }
 
-// CreateAsset creates a new asset. It will return an error if the asset already exists
-// or if the database operation fails.
+// CreateAsset creates a new asset. It will return an error if the asset already exists,
+// if its analytic dimensions are not active dimensions of the company or if the
+// database operation fails.
 func (s *AssetService) CreateAsset(data *models.AssetModel) error {
+	if err := models.CheckAnalyticDimensions(s.db, data.CompanyID, data.AnalyticDimensions); err != nil {
+		return err
+	}
 	return s.db.Create(data).Error
 }
 
@@ -49,13 +54,17 @@ func (s *AssetService) UpdateAsset(id string, data *models.AssetModel) error {
 	return s.db.Where("id = ?", id).Updates(data).Error
 }
 
-// DeleteAsset deletes an asset and its associated transactions and depreciation costs.
+// DeleteAsset deletes an asset and its associated transactions, depreciation costs and events.
 // It will return an error if the asset does not exist or if the database operation fails.
 func (s *AssetService) DeleteAsset(id string) error {
 	err := s.db.Where("transaction_secondary_ref_id = ?", id).Unscoped().Delete(&models.TransactionModel{}).Error
 	if err != nil {
 		return err
 	}
+	err = s.db.Where("asset_id = ?", id).Unscoped().Delete(&models.AssetEventModel{}).Error
+	if err != nil {
+		return err
+	}
 	err = s.db.Where("asset_id = ?", id).Unscoped().Delete(&models.DepreciationCostModel{}).Error
 	if err != nil {
 		return err
@@ -64,7 +73,8 @@ func (s *AssetService) DeleteAsset(id string) error {
 }
 
 // GetAssetByID returns an asset by its ID. It will return an error if the asset does not exist.
-// It will preload the associated accounts.
+// It will preload the associated accounts, branch, project and department, and load the
+// events of the asset.
 func (s *AssetService) GetAssetByID(id string) (*models.AssetModel, error) {
 	var invoice models.AssetModel
 	err := s.db.
@@ -72,7 +82,14 @@ func (s *AssetService) GetAssetByID(id string) (*models.AssetModel, error) {
 		Preload("AccountCurrentAsset").
 		Preload("AccountDepreciation").
 		Preload("AccountAccumulatedDepreciation").
+		Preload("Branch").
+		Preload("Project").
+		Preload("Department").
 		Where("id = ?", id).First(&invoice).Error
+	if err != nil {
+		return &invoice, err
+	}
+	err = s.db.Preload("Account").Where("asset_id = ?", id).Order("date, created_at").Find(&invoice.Events).Error
 	return &invoice, err
 }
 
@@ -116,6 +133,8 @@ func (s *AssetService) GetAssets(request http.Request, search string) (paginate.
 // - SLN: Straight Line Method
 // - DB: Declining Balance Method
 // - SYD: Sum of the Years' Digits Method
+// - UOP: Units of Production Method, planned evenly over the life time until the
+// units produced in a period are recorded with RecordUnits
 // Any other method will return an error.
 func (s *AssetService) CountDepreciation(asset *models.AssetModel) ([]float64, error) {
 
@@ -139,6 +158,14 @@ func (s *AssetService) CountDepreciation(asset *models.AssetModel) ([]float64, e
 			dep := fin.DepreciationSYD(asset.AcquisitionCost, asset.SalvageValue, int(asset.LifeTime), i)
 			costs = append(costs, dep)
 		}
+	case "UOP":
+		if asset.ProductionUnits <= 0 {
+			return []float64{}, errors.New("please set the production units of the asset")
+		}
+		dep, _ := fin.DepreciationStraightLine(asset.AcquisitionCost, asset.SalvageValue, int(asset.LifeTime))
+		for i := 0; i < int(asset.LifeTime); i++ {
+			costs = append(costs, dep)
+		}
 	default:
 		return []float64{}, errors.New(asset.DepreciationMethod + "not implemented")
 	}
@@ -149,6 +176,9 @@ func (s *AssetService) CountDepreciation(asset *models.AssetModel) ([]float64, e
 // PreviewCosts takes an AssetModel and returns a slice of DepreciationCostModel and an error.
 // It uses the CountDepreciation function to get the costs of the asset and then create a slice of DepreciationCostModel.
 // The costs are divided into either 12 months or 1 year, depending on the asset's period.
+// A monthly schedule of a pro-rated asset bought after the first day of a month only charges
+// the days the asset is held in the first month; the rest of that month's cost is charged in
+// an extra month at the end of the life time.
 // The function returns an error if the CountDepreciation function returns an error.
 func (s *AssetService) PreviewCosts(asset *models.AssetModel) ([]models.DepreciationCostModel, error) {
 	costs, err := s.CountDepreciation(asset)
@@ -180,6 +210,18 @@ func (s *AssetService) PreviewCosts(asset *models.AssetModel) ([]models.Deprecia
 		}
 
 	}
+	if asset.IsMonthly && asset.ProRata && asset.Date.Day() > 1 && len(depreciationCosts) > 0 {
+		daysInMonth := time.Date(asset.Date.Year(), asset.Date.Month()+1, 0, 0, 0, 0, 0, asset.Date.Location()).Day()
+		held := float64(daysInMonth-asset.Date.Day()+1) / float64(daysInMonth)
+		first := depreciationCosts[0].Amount
+		depreciationCosts[0].Amount = utils.AmountRound(first*held, 2)
+		depreciationCosts = append(depreciationCosts, models.DepreciationCostModel{
+			SeqNumber: seqNo,
+			Month:     1,
+			Amount:    first - depreciationCosts[0].Amount,
+			Period:    len(costs) + 1,
+		})
+	}
 	return depreciationCosts, nil
 }
 
@@ -188,6 +230,9 @@ func (s *AssetService) ActivateAsset(asset *models.AssetModel, date time.Time, u
 		if asset.Status != "DRAFT" {
 			return errors.New("asset is not in draft status")
 		}
+		if err := period.Check(tx, asset.CompanyID, "asset", date); err != nil {
+			return err
+		}
 
 		// now := time.Now()
 
@@ -210,6 +255,7 @@ func (s *AssetService) ActivateAsset(asset *models.AssetModel, date time.Time, u
 			TransactionRefType:          "transaction",
 			TransactionSecondaryRefID:   &asset.ID,
 			TransactionSecondaryRefType: "asset",
+			AnalyticDimensions:          asset.AnalyticDimensions,
 		}
 		if err := tx.Create(&costTrans).Error; err != nil {
 			return err
@@ -248,6 +294,7 @@ func (s *AssetService) ActivateAsset(asset *models.AssetModel, date time.Time, u
 			TransactionRefType:          "transaction",
 			TransactionSecondaryRefID:   &asset.ID,
 			TransactionSecondaryRefType: "asset",
+			AnalyticDimensions:          asset.AnalyticDimensions,
 		}
 		if err := tx.Create(&depreciationTrans).Error; err != nil {
 			return err
@@ -269,6 +316,7 @@ func (s *AssetService) ActivateAsset(asset *models.AssetModel, date time.Time, u
 				TransactionRefType:          "transaction",
 				TransactionSecondaryRefID:   &asset.ID,
 				TransactionSecondaryRefType: "asset",
+				AnalyticDimensions:          asset.AnalyticDimensions,
 			}
 			if err := tx.Create(&depreciationTrans).Error; err != nil {
 				return err
@@ -284,25 +332,26 @@ func (s *AssetService) ActivateAsset(asset *models.AssetModel, date time.Time, u
 
 func (s *AssetService) DepreciationApply(asset *models.AssetModel, itemID string, date time.Time, userID string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
+		if asset.Status == "DISPOSED" {
+			return errors.New("asset is disposed")
+		}
+		if err := period.Check(tx, asset.CompanyID, "asset", date); err != nil {
+			return err
+		}
 		depreciation := models.DepreciationCostModel{}
 		if err := tx.Find(&depreciation, "asset_id = ? and id = ? AND status = ?", asset.ID, itemID, "ACTIVE").Error; err != nil {
 			return err
 		}
+		if asset.DepreciationMethod == "UOP" && depreciation.Units == 0 {
+			return errors.New("please record the units produced in the period")
+		}
 		asset.BookValue -= utils.AmountRound(depreciation.Amount, 2) //depreciation.Amount
 
 		// CREATE COST TRANSACTION
 		code := utils.RandString(10, false)
 		costTransID := uuid.New().String()
 		depreciationTransID := uuid.New().String()
-		var depPeriod time.Time
-		var label string
-		if asset.IsMonthly {
-			depPeriod = asset.Date.AddDate(depreciation.Period-1, depreciation.Month-1, 0)
-			label = depPeriod.Format("Jan-2006")
-		} else {
-			depPeriod = asset.Date.AddDate(depreciation.Period-1, 0, 0)
-			label = depPeriod.Format("2006")
-		}
+		label := depreciationLabel(asset, depreciation)
 
 		costTrans := models.TransactionModel{
 			BaseModel:                   shared.BaseModel{ID: costTransID},
@@ -318,6 +367,7 @@ func (s *AssetService) DepreciationApply(asset *models.AssetModel, itemID string
 			TransactionRefType:          "transaction",
 			TransactionSecondaryRefID:   &asset.ID,
 			TransactionSecondaryRefType: "asset",
+			AnalyticDimensions:          asset.AnalyticDimensions,
 		}
 		if err := tx.Create(&costTrans).Error; err != nil {
 			return err
@@ -339,6 +389,7 @@ func (s *AssetService) DepreciationApply(asset *models.AssetModel, itemID string
 			TransactionRefType:          "transaction",
 			TransactionSecondaryRefID:   &asset.ID,
 			TransactionSecondaryRefType: "asset",
+			AnalyticDimensions:          asset.AnalyticDimensions,
 		}
 		if err := tx.Create(&depreciationTrans).Error; err != nil {
 			return err
@@ -0,0 +1,404 @@
+// Package balance keeps per-account, per-period snapshots of the ledger so
+// reports do not have to sum the whole transactions table.
+//
+// The snapshots are maintained by GORM callbacks on the transactions table, so
+// every create, update and delete made through GORM is counted, whether it comes
+// from TransactionService or from the module that posts the lines. The lines an
+// update or delete touches are read before and after the statement and the
+// difference is added to the snapshots in the same database transaction. Raw SQL
+// writes to the transactions table are not seen; run RebuildBalances after them.
+package balance
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const affectedKey = "balance:affected"
+
+type BalanceService struct {
+	db         *gorm.DB
+	ctx        *context.ERPContext
+	periodType string
+}
+
+// NewBalanceService creates a new BalanceService keeping monthly snapshots and
+// registers the callbacks that maintain them on the database.
+func NewBalanceService(db *gorm.DB, ctx *context.ERPContext) *BalanceService {
+	s := &BalanceService{db: db, ctx: ctx, periodType: models.BALANCE_PERIOD_MONTHLY}
+	s.register()
+	return s
+}
+
+// Migrate migrates the account balance and account balance state models.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.AccountBalanceModel{}, &models.AccountBalanceStateModel{})
+}
+
+// SetPeriodType sets the period of the snapshots, models.BALANCE_PERIOD_MONTHLY
+// or models.BALANCE_PERIOD_DAILY. Daily snapshots leave less to sum at the edges
+// of a report range and take more rows. The snapshots of the new period type are
+// only read after RebuildBalances.
+//
+// The callbacks only maintain the snapshots of the current period type, so when
+// it changes the snapshots and ready states of the old type are dropped; going
+// back to it needs RebuildBalances again.
+func (s *BalanceService) SetPeriodType(periodType string) error {
+	switch periodType {
+	case models.BALANCE_PERIOD_MONTHLY, models.BALANCE_PERIOD_DAILY:
+	default:
+		return errors.New("invalid balance period type: " + periodType)
+	}
+	if periodType == s.periodType {
+		return nil
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("period_type = ?", s.periodType).Delete(&models.AccountBalanceStateModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("period_type = ?", s.periodType).Delete(&models.AccountBalanceModel{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.periodType = periodType
+	return nil
+}
+
+// RebuildBalances recomputes the snapshots of a company from its ledger lines and
+// marks them ready to be read by reports.
+func (s *BalanceService) RebuildBalances(companyID string) error {
+	unit := "month"
+	if s.periodType == models.BALANCE_PERIOD_DAILY {
+		unit = "day"
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("company_id = ? AND period_type = ?", companyID, s.periodType).Delete(&models.AccountBalanceModel{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec(fmt.Sprintf(`INSERT INTO account_balances (company_id, account_id, period_type, period, debit, credit, count)
+			SELECT company_id, account_id, '%s', date_trunc('%s', date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', SUM(debit), SUM(credit), COUNT(*)
+			FROM transactions
+			WHERE company_id = ? AND account_id IS NOT NULL AND is_draft = false AND deleted_at IS NULL
+			GROUP BY 1, 2, 3, 4`, s.periodType, unit), companyID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&models.AccountBalanceStateModel{
+			CompanyID:  companyID,
+			PeriodType: s.periodType,
+			RebuiltAt:  time.Now(),
+		}).Error
+	})
+}
+
+// IsReady reports whether the snapshots of a company have been rebuilt and can be
+// read.
+func (s *BalanceService) IsReady(companyID string) bool {
+	var count int64
+	s.db.Model(&models.AccountBalanceStateModel{}).Where("company_id = ? AND period_type = ?", companyID, s.periodType).Count(&count)
+	return count > 0
+}
+
+// Sum returns the debit and credit of the posted ledger lines of the accounts of a
+// company dated from start and before end, or up to and including end when
+// endInclusive is set. A nil start or end leaves that side open.
+//
+// The whole periods in the range are read from the snapshots and the lines at the
+// edges of the range from the transactions table. Until the snapshots of the
+// company are rebuilt, all lines are read from the transactions table.
+func (s *BalanceService) Sum(companyID string, accountIDs []string, start, end *time.Time, endInclusive bool) (float64, float64, error) {
+	totals := struct {
+		Debit  float64
+		Credit float64
+	}{}
+	ledger := func(from, to *time.Time, toInclusive bool) error {
+		var sum struct {
+			Debit  float64
+			Credit float64
+		}
+		stmt := s.db.Model(&models.TransactionModel{}).
+			Select("COALESCE(SUM(debit), 0) AS debit, COALESCE(SUM(credit), 0) AS credit").
+			Where("is_draft = ? AND company_id = ? AND account_id IN ?", false, companyID, accountIDs)
+		if from != nil {
+			stmt = stmt.Where("date >= ?", *from)
+		}
+		if to != nil {
+			if toInclusive {
+				stmt = stmt.Where("date <= ?", *to)
+			} else {
+				stmt = stmt.Where("date < ?", *to)
+			}
+		}
+		if err := stmt.Scan(&sum).Error; err != nil {
+			return err
+		}
+		totals.Debit += sum.Debit
+		totals.Credit += sum.Credit
+		return nil
+	}
+
+	if len(accountIDs) == 0 {
+		return 0, 0, nil
+	}
+	if !s.IsReady(companyID) {
+		err := ledger(start, end, endInclusive)
+		return totals.Debit, totals.Credit, err
+	}
+
+	var first, last *time.Time
+	if start != nil {
+		p := s.periodStart(*start)
+		if p.Before(*start) {
+			p = s.nextPeriod(p)
+		}
+		first = &p
+	}
+	if end != nil {
+		p := s.periodStart(*end)
+		last = &p
+	}
+	if first != nil && last != nil && !first.Before(*last) {
+		err := ledger(start, end, endInclusive)
+		return totals.Debit, totals.Credit, err
+	}
+
+	var sum struct {
+		Debit  float64
+		Credit float64
+	}
+	stmt := s.db.Model(&models.AccountBalanceModel{}).
+		Select("COALESCE(SUM(debit), 0) AS debit, COALESCE(SUM(credit), 0) AS credit").
+		Where("company_id = ? AND period_type = ? AND account_id IN ?", companyID, s.periodType, accountIDs)
+	if first != nil {
+		stmt = stmt.Where("period >= ?", *first)
+	}
+	if last != nil {
+		stmt = stmt.Where("period < ?", *last)
+	}
+	if err := stmt.Scan(&sum).Error; err != nil {
+		return 0, 0, err
+	}
+	totals.Debit += sum.Debit
+	totals.Credit += sum.Credit
+
+	if start != nil && start.Before(*first) {
+		if err := ledger(start, first, false); err != nil {
+			return 0, 0, err
+		}
+	}
+	if end != nil {
+		if err := ledger(last, end, endInclusive); err != nil {
+			return 0, 0, err
+		}
+	}
+	return totals.Debit, totals.Credit, nil
+}
+
+func (s *BalanceService) periodStart(t time.Time) time.Time {
+	u := t.UTC()
+	if s.periodType == models.BALANCE_PERIOD_DAILY {
+		return time.Date(u.Year(), u.Month(), u.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(u.Year(), u.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *BalanceService) nextPeriod(t time.Time) time.Time {
+	if s.periodType == models.BALANCE_PERIOD_DAILY {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// ledgerLine holds the columns of a transaction that make up a snapshot.
+type ledgerLine struct {
+	ID        string
+	CompanyID *string
+	AccountID *string
+	Date      time.Time
+	Debit     float64
+	Credit    float64
+	IsDraft   bool
+	DeletedAt gorm.DeletedAt
+}
+
+func (l ledgerLine) posted() bool {
+	return l.AccountID != nil && !l.IsDraft && !l.DeletedAt.Valid
+}
+
+// register adds the callbacks maintaining the snapshots to the database, once.
+func (s *BalanceService) register() {
+	callback := s.db.Callback()
+	if callback.Create().Get("balance:after_create") != nil {
+		return
+	}
+	callback.Create().After("gorm:create").Register("balance:after_create", s.afterCreate)
+	callback.Update().Before("gorm:update").Register("balance:before_update", s.beforeChange)
+	callback.Update().After("gorm:update").Register("balance:after_update", s.afterChange)
+	callback.Delete().Before("gorm:delete").Register("balance:before_delete", s.beforeChange)
+	callback.Delete().After("gorm:delete").Register("balance:after_delete", s.afterChange)
+}
+
+func isLedger(db *gorm.DB) bool {
+	return db.Statement.Schema != nil && db.Statement.Schema.Table == "transactions"
+}
+
+func (s *BalanceService) afterCreate(db *gorm.DB) {
+	if db.Error != nil || !isLedger(db) {
+		return
+	}
+	lines := []ledgerLine{}
+	add := func(v reflect.Value) {
+		v = reflect.Indirect(v)
+		if !v.CanAddr() {
+			return
+		}
+		if t, ok := v.Addr().Interface().(*models.TransactionModel); ok {
+			lines = append(lines, ledgerLine{
+				ID:        t.ID,
+				CompanyID: t.CompanyID,
+				AccountID: t.AccountID,
+				Date:      t.Date,
+				Debit:     t.Debit,
+				Credit:    t.Credit,
+				IsDraft:   t.IsDraft,
+				DeletedAt: t.DeletedAt,
+			})
+		}
+	}
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			add(db.Statement.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		add(db.Statement.ReflectValue)
+	}
+	if err := s.apply(db, nil, lines); err != nil {
+		db.AddError(err)
+	}
+}
+
+// beforeChange reads the lines an update or delete is about to touch.
+func (s *BalanceService) beforeChange(db *gorm.DB) {
+	if db.Error != nil || !isLedger(db) {
+		return
+	}
+	query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table("transactions")
+	conditions := false
+	if where, ok := db.Statement.Clauses["WHERE"]; ok && where.Expression != nil {
+		query = query.Clauses(where.Expression)
+		conditions = true
+	}
+	if field := db.Statement.Schema.PrioritizedPrimaryField; field != nil && db.Statement.ReflectValue.Kind() == reflect.Struct {
+		if id, zero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue); !zero {
+			query = query.Where("id = ?", id)
+			conditions = true
+		}
+	}
+	if !conditions {
+		return
+	}
+	lines := []ledgerLine{}
+	if err := query.Select("id, company_id, account_id, date, debit, credit, is_draft, deleted_at").Find(&lines).Error; err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(affectedKey, lines)
+}
+
+// afterChange reads the touched lines again and applies the difference.
+func (s *BalanceService) afterChange(db *gorm.DB) {
+	if db.Error != nil || !isLedger(db) {
+		return
+	}
+	value, ok := db.InstanceGet(affectedKey)
+	if !ok {
+		return
+	}
+	before := value.([]ledgerLine)
+	if len(before) == 0 {
+		return
+	}
+	ids := []string{}
+	for _, v := range before {
+		ids = append(ids, v.ID)
+	}
+	after := []ledgerLine{}
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table("transactions").
+		Select("id, company_id, account_id, date, debit, credit, is_draft, deleted_at").
+		Where("id IN ?", ids).
+		Find(&after).Error
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	if err := s.apply(db, before, after); err != nil {
+		db.AddError(err)
+	}
+}
+
+// apply takes the removed lines off the snapshots and adds the added ones.
+func (s *BalanceService) apply(db *gorm.DB, removed, added []ledgerLine) error {
+	deltas := map[string]*models.AccountBalanceModel{}
+	keys := []string{}
+	change := func(l ledgerLine, sign float64) {
+		if !l.posted() {
+			return
+		}
+		companyID := ""
+		if l.CompanyID != nil {
+			companyID = *l.CompanyID
+		}
+		period := s.periodStart(l.Date)
+		key := companyID + "|" + *l.AccountID + "|" + period.Format(time.RFC3339)
+		delta, ok := deltas[key]
+		if !ok {
+			delta = &models.AccountBalanceModel{
+				CompanyID:  companyID,
+				AccountID:  *l.AccountID,
+				PeriodType: s.periodType,
+				Period:     period,
+			}
+			deltas[key] = delta
+			keys = append(keys, key)
+		}
+		delta.Debit += sign * l.Debit
+		delta.Credit += sign * l.Credit
+		delta.Count += int64(sign)
+	}
+	for _, v := range removed {
+		change(v, -1)
+	}
+	for _, v := range added {
+		change(v, 1)
+	}
+
+	rows := []models.AccountBalanceModel{}
+	for _, key := range keys {
+		if v := deltas[key]; v.Count != 0 || v.Debit != 0 || v.Credit != 0 {
+			rows = append(rows, *v)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "company_id"}, {Name: "account_id"}, {Name: "period_type"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"debit":  gorm.Expr("account_balances.debit + excluded.debit"),
+				"credit": gorm.Expr("account_balances.credit + excluded.credit"),
+				"count":  gorm.Expr("account_balances.count + excluded.count"),
+			}),
+		}).
+		Create(&rows).Error
+}
@@ -0,0 +1,711 @@
+package bank
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance/currency"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/AMETORY/ametory-erp-modules/utils/statement"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// MatchRule tells AutoMatch how close a ledger transaction must be to a
+// statement line. The amount must always be equal within AmountTolerance.
+type MatchRule struct {
+	DateTolerance   int
+	AmountTolerance float64
+}
+
+// DefaultMatchRule matches transactions dated up to three days from the line.
+var DefaultMatchRule = MatchRule{DateTolerance: 3, AmountTolerance: 0.005}
+
+type BankReconciliationService struct {
+	db              *gorm.DB
+	ctx             *context.ERPContext
+	rule            MatchRule
+	currencyService *currency.CurrencyService
+}
+
+// NewBankReconciliationService returns a new instance of BankReconciliationService.
+//
+// The service is created by providing a GORM database instance and an ERP context.
+// It imports bank statements of cash/bank accounts and reconciles their lines with
+// the ledger transactions of the account.
+func NewBankReconciliationService(db *gorm.DB, ctx *context.ERPContext) *BankReconciliationService {
+	return &BankReconciliationService{db: db, ctx: ctx, rule: DefaultMatchRule}
+}
+
+// Migrate runs the database migration for the BankStatementModel and BankStatementLineModel.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.BankStatementModel{}, &models.BankStatementLineModel{})
+}
+
+// SetMatchRule replaces the rule used by AutoMatch.
+func (s *BankReconciliationService) SetMatchRule(rule MatchRule) {
+	s.rule = rule
+}
+
+// SetCurrencyService sets the currency service for the BankReconciliationService.
+//
+// The CurrencyService tells which accounts are kept in a foreign currency and
+// converts their statement lines into the functional currency. It must be set
+// before reconciling an account in a foreign currency.
+func (s *BankReconciliationService) SetCurrencyService(currencyService *currency.CurrencyService) {
+	s.currencyService = currencyService
+}
+
+// ImportStatement parses a bank statement and stores it for the given cash/bank account.
+//
+// The format is statement.FORMAT_CSV, FORMAT_MT940 or FORMAT_CAMT053. Lines that were
+// already imported for the account are skipped, so overlapping statements can be
+// imported safely. The new lines are matched with AutoMatch right away.
+func (s *BankReconciliationService) ImportStatement(companyID, accountID, format string, r io.Reader, fileName string, userID *string) (*models.BankStatementModel, error) {
+	account, err := s.getBankAccount(companyID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := statement.Parse(format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	data := models.BankStatementModel{
+		BaseModel:      shared.BaseModel{ID: utils.Uuid()},
+		CompanyID:      &companyID,
+		AccountID:      &account.ID,
+		Format:         strings.ToUpper(format),
+		FileName:       fileName,
+		Reference:      parsed.Reference,
+		AccountNumber:  parsed.AccountNumber,
+		CurrencyCode:   parsed.CurrencyCode,
+		StartDate:      parsed.StartDate,
+		EndDate:        parsed.EndDate,
+		OpeningBalance: parsed.OpeningBalance,
+		ClosingBalance: parsed.ClosingBalance,
+		UserID:         userID,
+	}
+
+	occurrences := map[string]int{}
+	for _, v := range parsed.Lines {
+		key := fmt.Sprintf("%s|%s|%s|%s|%s", account.ID, v.Date.Format("2006-01-02"), money.FromFloat(v.Amount), v.Reference, v.Description)
+		occurrences[key]++
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, occurrences[key])))
+		hash := hex.EncodeToString(sum[:])
+
+		var count int64
+		if err := s.db.Model(&models.BankStatementLineModel{}).Where("account_id = ? AND hash = ?", account.ID, hash).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			continue
+		}
+		data.Lines = append(data.Lines, models.BankStatementLineModel{
+			StatementID: &data.ID,
+			CompanyID:   &companyID,
+			AccountID:   &account.ID,
+			Date:        v.Date,
+			ValueDate:   v.ValueDate,
+			Description: v.Description,
+			Reference:   v.Reference,
+			Amount:      v.Amount,
+			Balance:     v.Balance,
+			Hash:        hash,
+			Status:      models.STATEMENT_LINE_UNMATCHED,
+		})
+	}
+
+	if err := s.db.Create(&data).Error; err != nil {
+		return nil, err
+	}
+	if _, err := s.AutoMatch(data.ID); err != nil {
+		return nil, err
+	}
+	return s.GetStatementByID(data.ID)
+}
+
+// AutoMatch matches the unmatched lines of a statement with the ledger
+// transactions of its account and returns the number of matched lines.
+//
+// A transaction is a candidate when its amount (debit - credit) equals the line
+// amount and it is dated within the date tolerance of the rule; on an account in a
+// foreign currency the foreign amount of the transaction is compared instead. A
+// candidate whose code, description or notes agree with the line reference wins;
+// otherwise a single candidate on the same date, or the only candidate, is taken.
+// Ambiguous lines are left for manual matching.
+func (s *BankReconciliationService) AutoMatch(statementID string) (int, error) {
+	var lines []models.BankStatementLineModel
+	err := s.db.Where("statement_id = ? AND status = ?", statementID, models.STATEMENT_LINE_UNMATCHED).
+		Order("date asc").
+		Find(&lines).Error
+	if err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	used := map[string]bool{}
+	now := time.Now()
+	for _, line := range lines {
+		candidates, err := s.candidates(line, s.rule.DateTolerance)
+		if err != nil {
+			return matched, err
+		}
+		available := []models.TransactionModel{}
+		for _, c := range candidates {
+			if !used[c.ID] {
+				available = append(available, c)
+			}
+		}
+		transaction := pickCandidate(line, available)
+		if transaction == nil {
+			continue
+		}
+		err = s.db.Model(&models.BankStatementLineModel{}).Where("id = ?", line.ID).Updates(map[string]any{
+			"status":         models.STATEMENT_LINE_MATCHED,
+			"match_type":     models.STATEMENT_MATCH_AUTO,
+			"transaction_id": transaction.ID,
+			"matched_at":     now,
+		}).Error
+		if err != nil {
+			return matched, err
+		}
+		used[transaction.ID] = true
+		matched++
+	}
+	return matched, nil
+}
+
+// GetMatchCandidates returns the unmatched ledger transactions of the line's account
+// with the same amount as the line, closest date first, for manual matching.
+func (s *BankReconciliationService) GetMatchCandidates(lineID string) ([]models.TransactionModel, error) {
+	line, err := s.getLine(lineID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.candidates(*line, -1)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && dayDistance(line.Date, candidates[j].Date) < dayDistance(line.Date, candidates[j-1].Date); j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+	return candidates, nil
+}
+
+// MatchLine manually matches a statement line with a ledger transaction of the
+// same account. The amounts must agree and the transaction must not be matched
+// to another line.
+func (s *BankReconciliationService) MatchLine(lineID, transactionID, userID string) error {
+	line, err := s.getLine(lineID)
+	if err != nil {
+		return err
+	}
+	if line.Status != models.STATEMENT_LINE_UNMATCHED {
+		return errors.New("statement line is already reconciled")
+	}
+	var transaction models.TransactionModel
+	err = s.db.Where("id = ? AND account_id = ? AND company_id = ? AND is_draft = ?", transactionID, line.AccountID, line.CompanyID, false).
+		First(&transaction).Error
+	if err != nil {
+		return errors.New("transaction not found in the bank account")
+	}
+	currencyCode, err := s.foreignCurrency(line.CompanyID, line.AccountID)
+	if err != nil {
+		return err
+	}
+	if math.Abs(transactionAmount(transaction, currencyCode != "")-line.Amount) > s.rule.AmountTolerance {
+		return errors.New("transaction amount does not match the statement line")
+	}
+	var count int64
+	if err := s.db.Model(&models.BankStatementLineModel{}).Where("transaction_id = ?", transactionID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("transaction is already matched")
+	}
+	now := time.Now()
+	return s.db.Model(&models.BankStatementLineModel{}).Where("id = ?", line.ID).Updates(map[string]any{
+		"status":         models.STATEMENT_LINE_MATCHED,
+		"match_type":     models.STATEMENT_MATCH_MANUAL,
+		"transaction_id": transactionID,
+		"matched_at":     now,
+		"matched_by_id":  userID,
+	}).Error
+}
+
+// UnmatchLine removes the match of a statement line. Lines whose transaction was
+// created from the statement can not be unmatched; delete the transaction instead.
+func (s *BankReconciliationService) UnmatchLine(lineID string) error {
+	line, err := s.getLine(lineID)
+	if err != nil {
+		return err
+	}
+	if line.Status != models.STATEMENT_LINE_MATCHED {
+		return errors.New("statement line is not matched")
+	}
+	return s.db.Model(&models.BankStatementLineModel{}).Where("id = ?", line.ID).Updates(map[string]any{
+		"status":         models.STATEMENT_LINE_UNMATCHED,
+		"match_type":     "",
+		"transaction_id": nil,
+		"matched_at":     nil,
+		"matched_by_id":  nil,
+	}).Error
+}
+
+// CreateTransactionFromLine books an unmatched statement line, such as a bank charge
+// or interest, as a new transaction between the bank account and the given counter
+// account, and marks the line as CREATED.
+//
+// Money received debits the bank account and credits the counter account; money paid
+// out does the opposite. On an account in a foreign currency the line is converted
+// at the rate of its date and both transactions keep the currency, the rate and
+// the line amount as their foreign amount. The posting is refused when the period
+// is locked.
+func (s *BankReconciliationService) CreateTransactionFromLine(lineID, counterAccountID, description, userID string) (*models.TransactionModel, error) {
+	line, err := s.getLine(lineID)
+	if err != nil {
+		return nil, err
+	}
+	if line.Status != models.STATEMENT_LINE_UNMATCHED {
+		return nil, errors.New("statement line is already reconciled")
+	}
+	var counterAccount models.AccountModel
+	if err := s.db.Where("id = ? AND company_id = ?", counterAccountID, line.CompanyID).First(&counterAccount).Error; err != nil {
+		return nil, errors.New("counter account not found")
+	}
+	if description == "" {
+		description = line.Description
+	}
+	currencyCode, err := s.foreignCurrency(line.CompanyID, line.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	foreignAmount := math.Abs(line.Amount)
+	amount := foreignAmount
+	rate := 1.0
+	if currencyCode != "" {
+		amount, rate, err = s.currencyService.Convert(*line.CompanyID, currencyCode, line.Date, foreignAmount)
+		if err != nil {
+			return nil, err
+		}
+		amount = models.GetCompanyRounding(s.db, line.CompanyID).Document(money.FromFloat(amount)).Float64()
+	}
+	code := utils.RandString(10, false)
+	bankID := utils.Uuid()
+	counterID := utils.Uuid()
+
+	bankData := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: bankID},
+		Code:                        code,
+		Date:                        line.Date,
+		AccountID:                   line.AccountID,
+		Description:                 description,
+		Notes:                       line.Reference,
+		Amount:                      amount,
+		TransactionRefID:            &counterID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &line.ID,
+		TransactionSecondaryRefType: "bank_statement",
+		CompanyID:                   line.CompanyID,
+		UserID:                      &userID,
+	}
+	counterData := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: counterID},
+		Code:                        code,
+		Date:                        line.Date,
+		AccountID:                   &counterAccount.ID,
+		Description:                 description,
+		Notes:                       line.Reference,
+		Amount:                      amount,
+		TransactionRefID:            &bankID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &line.ID,
+		TransactionSecondaryRefType: "bank_statement",
+		CompanyID:                   line.CompanyID,
+		UserID:                      &userID,
+	}
+	if currencyCode != "" {
+		for _, v := range []*models.TransactionModel{&bankData, &counterData} {
+			v.CurrencyCode = currencyCode
+			v.ExchangeRate = rate
+			v.ForeignAmount = foreignAmount
+		}
+	}
+	if line.Amount > 0 {
+		bankData.Debit = amount
+		counterData.Credit = amount
+	} else {
+		bankData.Credit = amount
+		counterData.Debit = amount
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := period.Check(tx, line.CompanyID, "bank", line.Date); err != nil {
+			return err
+		}
+		if err := tx.Create(&bankData).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&counterData).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.BankStatementLineModel{}).Where("id = ?", line.ID).Updates(map[string]any{
+			"status":         models.STATEMENT_LINE_CREATED,
+			"match_type":     "",
+			"transaction_id": bankID,
+			"matched_at":     time.Now(),
+			"matched_by_id":  userID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bankData, nil
+}
+
+// GetStatements retrieves a paginated list of bank statements.
+//
+// The result is filtered by the company ID in the request header and by the
+// account_id query parameter when given.
+func (s *BankReconciliationService) GetStatements(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Account").Model(&models.BankStatementModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if search != "" {
+		stmt = stmt.Where("reference ILIKE ? OR file_name ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+	if request.URL.Query().Get("account_id") != "" {
+		stmt = stmt.Where("account_id = ?", request.URL.Query().Get("account_id"))
+	}
+	stmt = stmt.Order("start_date desc")
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.BankStatementModel{})
+	page.Page = page.Page + 1
+	items := page.Items.(*[]models.BankStatementModel)
+	newItems := make([]models.BankStatementModel, 0)
+	for _, v := range *items {
+		s.countLines(&v)
+		newItems = append(newItems, v)
+	}
+	page.Items = &newItems
+	return page, nil
+}
+
+// GetStatementByID retrieves a bank statement with its lines and their matched transactions.
+func (s *BankReconciliationService) GetStatementByID(id string) (*models.BankStatementModel, error) {
+	var data models.BankStatementModel
+	err := s.db.Preload("Account").
+		Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Preload("Transaction").Order("date asc")
+		}).
+		Where("id = ?", id).First(&data).Error
+	if err != nil {
+		return nil, err
+	}
+	s.countLines(&data)
+	return &data, nil
+}
+
+// GetLines retrieves a paginated list of statement lines.
+//
+// The result is filtered by the company ID in the request header and by the
+// statement_id, account_id and status query parameters when given.
+func (s *BankReconciliationService) GetLines(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Transaction").Model(&models.BankStatementLineModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if search != "" {
+		stmt = stmt.Where("description ILIKE ? OR reference ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+	if request.URL.Query().Get("statement_id") != "" {
+		stmt = stmt.Where("statement_id = ?", request.URL.Query().Get("statement_id"))
+	}
+	if request.URL.Query().Get("account_id") != "" {
+		stmt = stmt.Where("account_id = ?", request.URL.Query().Get("account_id"))
+	}
+	if request.URL.Query().Get("status") != "" {
+		stmt = stmt.Where("status = ?", request.URL.Query().Get("status"))
+	}
+	stmt = stmt.Order("date asc")
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.BankStatementLineModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// DeleteStatement deletes a bank statement and its lines. Transactions created
+// from the lines stay in the ledger.
+func (s *BankReconciliationService) DeleteStatement(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("statement_id = ?", id).Unscoped().Delete(&models.BankStatementLineModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.BankStatementModel{}).Error
+	})
+}
+
+// GetReconciliationReport compares the book balance of a cash/bank account with
+// its statement balance at the end date, which is inclusive.
+//
+// The statement balance is the opening balance of the latest statement started on
+// or before the end date plus its lines up to the end date. Outstanding transactions
+// and unmatched lines are listed from the start date. On an account in a foreign
+// currency all balances are in that currency; the book side is summed from the
+// foreign amount of the transactions.
+func (s *BankReconciliationService) GetReconciliationReport(companyID, accountID string, startDate, endDate time.Time) (*models.BankReconciliationReport, error) {
+	account, err := s.getBankAccount(companyID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	y, m, d := endDate.Date()
+	until := time.Date(y, m, d+1, 0, 0, 0, 0, endDate.Location())
+	rounding := models.GetCompanyRounding(s.db, &companyID)
+	currencyCode, err := s.foreignCurrency(&companyID, &account.ID)
+	if err != nil {
+		return nil, err
+	}
+	foreign := currencyCode != ""
+	amount := "debit - credit"
+	if foreign {
+		amount = "CASE WHEN debit > 0 THEN ABS(foreign_amount) ELSE -ABS(foreign_amount) END"
+	}
+
+	report := models.BankReconciliationReport{
+		AccountID: account.ID,
+		Account:   account,
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	var book struct {
+		Sum float64 `sql:"sum"`
+	}
+	err = s.db.Model(&models.TransactionModel{}).
+		Select("sum("+amount+") as sum").
+		Where("account_id = ? AND company_id = ? AND is_draft = ? AND date < ?", account.ID, companyID, false, until).
+		Scan(&book).Error
+	if err != nil {
+		return nil, err
+	}
+	bookBalance := rounding.Document(money.FromFloat(book.Sum))
+
+	var statementBalance money.Amount
+	var latest models.BankStatementModel
+	err = s.db.Where("account_id = ? AND company_id = ? AND start_date < ?", account.ID, companyID, until).
+		Order("start_date desc").
+		First(&latest).Error
+	if err == nil {
+		var lines struct {
+			Sum float64 `sql:"sum"`
+		}
+		err = s.db.Model(&models.BankStatementLineModel{}).
+			Select("sum(amount) as sum").
+			Where("statement_id = ? AND date < ?", latest.ID, until).
+			Scan(&lines).Error
+		if err != nil {
+			return nil, err
+		}
+		statementBalance = rounding.Document(money.FromFloat(latest.OpeningBalance).Add(money.FromFloat(lines.Sum)))
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = s.db.Where("account_id = ? AND company_id = ? AND is_draft = ?", account.ID, companyID, false).
+		Where("date >= ? AND date < ?", startDate, until).
+		Where("id NOT IN (?)", s.db.Model(&models.BankStatementLineModel{}).Select("transaction_id").Where("transaction_id IS NOT NULL")).
+		Order("date asc").
+		Find(&report.OutstandingTransactions).Error
+	if err != nil {
+		return nil, err
+	}
+	var outstanding money.Amount
+	for _, v := range report.OutstandingTransactions {
+		outstanding = outstanding.Add(money.FromFloat(transactionAmount(v, foreign)))
+	}
+
+	err = s.db.Where("account_id = ? AND company_id = ? AND status = ?", account.ID, companyID, models.STATEMENT_LINE_UNMATCHED).
+		Where("date >= ? AND date < ?", startDate, until).
+		Order("date asc").
+		Find(&report.UnmatchedLines).Error
+	if err != nil {
+		return nil, err
+	}
+	var unmatched money.Amount
+	for _, v := range report.UnmatchedLines {
+		unmatched = unmatched.Add(money.FromFloat(v.Amount))
+	}
+
+	s.db.Model(&models.BankStatementLineModel{}).
+		Where("account_id = ? AND company_id = ? AND status <> ?", account.ID, companyID, models.STATEMENT_LINE_UNMATCHED).
+		Where("date >= ? AND date < ?", startDate, until).
+		Count(&report.MatchedLines)
+
+	adjustedBook := bookBalance.Add(unmatched)
+	adjustedStatement := statementBalance.Add(outstanding)
+	report.BookBalance = bookBalance.Float64()
+	report.StatementBalance = statementBalance.Float64()
+	report.TotalOutstanding = outstanding.Float64()
+	report.TotalUnmatched = unmatched.Float64()
+	report.AdjustedBookBalance = adjustedBook.Float64()
+	report.AdjustedStatementBalance = adjustedStatement.Float64()
+	report.Difference = adjustedStatement.Sub(adjustedBook).Float64()
+	return &report, nil
+}
+
+// getBankAccount returns the account of the company if it can hold a bank balance.
+func (s *BankReconciliationService) getBankAccount(companyID, accountID string) (*models.AccountModel, error) {
+	var account models.AccountModel
+	if err := s.db.Where("id = ? AND company_id = ?", accountID, companyID).First(&account).Error; err != nil {
+		return nil, errors.New("account not found")
+	}
+	if account.Type != models.ASSET {
+		return nil, errors.New("account must be a cash/bank account")
+	}
+	return &account, nil
+}
+
+func (s *BankReconciliationService) getLine(id string) (*models.BankStatementLineModel, error) {
+	var line models.BankStatementLineModel
+	if err := s.db.Where("id = ?", id).First(&line).Error; err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// candidates returns the unmatched ledger transactions of the line's account with
+// the line amount. A negative tolerance disables the date window.
+func (s *BankReconciliationService) candidates(line models.BankStatementLineModel, dateTolerance int) ([]models.TransactionModel, error) {
+	currencyCode, err := s.foreignCurrency(line.CompanyID, line.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	amount := "debit - credit"
+	if currencyCode != "" {
+		amount = "CASE WHEN debit > 0 THEN ABS(foreign_amount) ELSE -ABS(foreign_amount) END"
+	}
+	var transactions []models.TransactionModel
+	stmt := s.db.Where("account_id = ? AND company_id = ? AND is_draft = ?", line.AccountID, line.CompanyID, false).
+		Where(amount+" BETWEEN ? AND ?", line.Amount-s.rule.AmountTolerance, line.Amount+s.rule.AmountTolerance).
+		Where("id NOT IN (?)", s.db.Model(&models.BankStatementLineModel{}).Select("transaction_id").Where("transaction_id IS NOT NULL"))
+	if dateTolerance >= 0 {
+		y, m, d := line.Date.Date()
+		from := time.Date(y, m, d-dateTolerance, 0, 0, 0, 0, line.Date.Location())
+		until := time.Date(y, m, d+dateTolerance+1, 0, 0, 0, 0, line.Date.Location())
+		stmt = stmt.Where("date >= ? AND date < ?", from, until)
+	}
+	err = stmt.Order("date asc").Find(&transactions).Error
+	return transactions, err
+}
+
+// foreignCurrency returns the currency of an account kept in a currency other
+// than the functional currency of the company, or an empty string. The statement
+// lines of such an account are in the account currency, not in the debit and
+// credit of the ledger.
+func (s *BankReconciliationService) foreignCurrency(companyID, accountID *string) (string, error) {
+	var account models.AccountModel
+	if err := s.db.Select("id", "currency_code").Where("id = ?", accountID).First(&account).Error; err != nil {
+		return "", err
+	}
+	if account.CurrencyCode == "" || companyID == nil {
+		return "", nil
+	}
+	if s.currencyService == nil {
+		return "", errors.New("currency service is not initialized")
+	}
+	if !s.currencyService.IsForeign(*companyID, account.CurrencyCode) {
+		return "", nil
+	}
+	return account.CurrencyCode, nil
+}
+
+// transactionAmount returns the amount of a transaction as it appears on the bank
+// statement: debit - credit, or the signed foreign amount on a foreign account.
+func transactionAmount(transaction models.TransactionModel, foreign bool) float64 {
+	if !foreign {
+		return transaction.Debit - transaction.Credit
+	}
+	if transaction.Debit > 0 {
+		return math.Abs(transaction.ForeignAmount)
+	}
+	return -math.Abs(transaction.ForeignAmount)
+}
+
+func (s *BankReconciliationService) countLines(data *models.BankStatementModel) {
+	s.db.Model(&models.BankStatementLineModel{}).Where("statement_id = ?", data.ID).Count(&data.TotalLines)
+	s.db.Model(&models.BankStatementLineModel{}).Where("statement_id = ? AND status <> ?", data.ID, models.STATEMENT_LINE_UNMATCHED).Count(&data.MatchedLines)
+}
+
+// pickCandidate applies the reference, same-date and single-candidate rules in
+// that order. It returns nil when the match is ambiguous.
+func pickCandidate(line models.BankStatementLineModel, candidates []models.TransactionModel) *models.TransactionModel {
+	if len(candidates) == 0 {
+		return nil
+	}
+	byReference := []models.TransactionModel{}
+	sameDate := []models.TransactionModel{}
+	for _, c := range candidates {
+		if referenceMatches(line, c) {
+			byReference = append(byReference, c)
+		}
+		if dayDistance(line.Date, c.Date) == 0 {
+			sameDate = append(sameDate, c)
+		}
+	}
+	switch {
+	case len(byReference) == 1:
+		return &byReference[0]
+	case len(byReference) > 1:
+		return nil
+	case len(sameDate) == 1:
+		return &sameDate[0]
+	case len(candidates) == 1:
+		return &candidates[0]
+	}
+	return nil
+}
+
+// referenceMatches reports whether the line reference appears in the transaction
+// description, notes or code, or the transaction code appears on the line.
+func referenceMatches(line models.BankStatementLineModel, transaction models.TransactionModel) bool {
+	reference := strings.ToUpper(strings.TrimSpace(line.Reference))
+	if len(reference) >= 4 {
+		text := strings.ToUpper(transaction.Description + " " + transaction.Notes + " " + transaction.Code)
+		if strings.Contains(text, reference) {
+			return true
+		}
+	}
+	code := strings.ToUpper(strings.TrimSpace(transaction.Code))
+	if len(code) >= 4 {
+		text := strings.ToUpper(line.Description + " " + line.Reference)
+		if strings.Contains(text, code) {
+			return true
+		}
+	}
+	return false
+}
+
+func dayDistance(a, b time.Time) int {
+	ya, ma, da := a.Date()
+	yb, mb, db := b.Date()
+	days := time.Date(ya, ma, da, 0, 0, 0, 0, time.UTC).Sub(time.Date(yb, mb, db, 0, 0, 0, 0, time.UTC)).Hours() / 24
+	return int(math.Abs(days))
+}
@@ -0,0 +1,919 @@
+package consolidation
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance/report"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// intercompanyAccountTypes are the account types whose lines are tagged as
+// intercompany: receivables and payables, and sales and expenses between the
+// group companies.
+var intercompanyAccountTypes = []models.AccountType{
+	models.RECEIVABLE,
+	models.LIABILITY,
+	models.REVENUE,
+	models.INCOME,
+	models.CONTRA_REVENUE,
+	models.EXPENSE,
+}
+
+type ConsolidationService struct {
+	db            *gorm.DB
+	ctx           *context.ERPContext
+	reportService *report.FinanceReportService
+}
+
+// NewConsolidationService returns a new instance of ConsolidationService.
+//
+// The service is created by providing a GORM database instance, an ERP context and
+// the FinanceReportService used to build the reports of the group companies, which
+// are then combined into the consolidated reports of a company group.
+func NewConsolidationService(db *gorm.DB, ctx *context.ERPContext, reportService *report.FinanceReportService) *ConsolidationService {
+	return &ConsolidationService{db: db, ctx: ctx, reportService: reportService}
+}
+
+// Migrate runs the database migration for the CompanyGroupModel, CompanyGroupMemberModel
+// and ConsolidationAccountMapModel.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.CompanyGroupModel{}, &models.CompanyGroupMemberModel{}, &models.ConsolidationAccountMapModel{})
+}
+
+// CreateGroup creates a new company group. The parent company is added as a
+// member with full ownership when it is not listed in the members.
+func (s *ConsolidationService) CreateGroup(data *models.CompanyGroupModel) error {
+	if data.ParentCompanyID == nil {
+		return errors.New("parent company is required")
+	}
+	hasParent := false
+	for i, v := range data.Members {
+		if err := validateOwnership(v.OwnershipPercent); err != nil {
+			return err
+		}
+		if v.CompanyID != nil && *v.CompanyID == *data.ParentCompanyID {
+			hasParent = true
+			data.Members[i].OwnershipPercent = 100
+		}
+	}
+	if !hasParent {
+		data.Members = append(data.Members, models.CompanyGroupMemberModel{
+			CompanyID:        data.ParentCompanyID,
+			OwnershipPercent: 100,
+		})
+	}
+	return s.db.Create(data).Error
+}
+
+// UpdateGroup updates the name and description of a company group.
+func (s *ConsolidationService) UpdateGroup(id string, data *models.CompanyGroupModel) error {
+	return s.db.Model(&models.CompanyGroupModel{}).Where("id = ?", id).Updates(map[string]any{
+		"name":        data.Name,
+		"description": data.Description,
+	}).Error
+}
+
+// DeleteGroup deletes a company group with its members and account mapping.
+func (s *ConsolidationService) DeleteGroup(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&models.ConsolidationAccountMapModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&models.CompanyGroupMemberModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.CompanyGroupModel{}).Error
+	})
+}
+
+// GetGroupByID retrieves a company group with its parent company and members.
+func (s *ConsolidationService) GetGroupByID(id string) (*models.CompanyGroupModel, error) {
+	var group models.CompanyGroupModel
+	err := s.db.Preload("ParentCompany").Preload("Members.Company").Where("id = ?", id).First(&group).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroups retrieves a paginated list of company groups.
+//
+// The result is filtered by the parent company ID in the request header and by
+// the search string on the group name.
+func (s *ConsolidationService) GetGroups(request *http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("ParentCompany").Preload("Members.Company").Model(&models.CompanyGroupModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("parent_company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if search != "" {
+		stmt = stmt.Where("name ILIKE ?", "%"+search+"%")
+	}
+	utils.FixRequest(request)
+	page := pg.With(stmt).Request(request).Response(&[]models.CompanyGroupModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// AddMember adds a company to a group, or updates its ownership percentage when
+// it is already a member. The parent company always keeps full ownership.
+func (s *ConsolidationService) AddMember(groupID, companyID string, ownershipPercent float64) error {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return err
+	}
+	if err := validateOwnership(ownershipPercent); err != nil {
+		return err
+	}
+	if group.ParentCompanyID != nil && *group.ParentCompanyID == companyID {
+		ownershipPercent = 100
+	}
+	var member models.CompanyGroupMemberModel
+	err = s.db.Where("group_id = ? AND company_id = ?", groupID, companyID).First(&member).Error
+	if err == nil {
+		return s.db.Model(&member).Update("ownership_percent", ownershipPercent).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return s.db.Create(&models.CompanyGroupMemberModel{
+		GroupID:          &groupID,
+		CompanyID:        &companyID,
+		OwnershipPercent: ownershipPercent,
+	}).Error
+}
+
+// RemoveMember removes a company and its account mapping from a group. The
+// parent company can not be removed.
+func (s *ConsolidationService) RemoveMember(groupID, companyID string) error {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return err
+	}
+	if group.ParentCompanyID != nil && *group.ParentCompanyID == companyID {
+		return errors.New("parent company can not be removed from the group")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND company_id = ?", groupID, companyID).Delete(&models.ConsolidationAccountMapModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("group_id = ? AND company_id = ?", groupID, companyID).Delete(&models.CompanyGroupMemberModel{}).Error
+	})
+}
+
+// SetAccountMap maps an account of a group company to an account of the parent
+// company's chart of accounts, replacing the existing mapping of the account.
+//
+// Accounts without a mapping are reported under the parent account with the
+// same code, or under their own name when the parent chart has no such code.
+func (s *ConsolidationService) SetAccountMap(groupID, accountID, groupAccountID string) (*models.ConsolidationAccountMapModel, error) {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+	var account models.AccountModel
+	if err := s.db.Where("id = ?", accountID).First(&account).Error; err != nil {
+		return nil, errors.New("account not found")
+	}
+	if account.CompanyID == nil || !isMember(group, *account.CompanyID) {
+		return nil, errors.New("account does not belong to a group company")
+	}
+	var groupAccount models.AccountModel
+	if err := s.db.Where("id = ? AND company_id = ?", groupAccountID, group.ParentCompanyID).First(&groupAccount).Error; err != nil {
+		return nil, errors.New("group account not found in the parent company")
+	}
+
+	data := models.ConsolidationAccountMapModel{}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND account_id = ?", groupID, accountID).Unscoped().Delete(&models.ConsolidationAccountMapModel{}).Error; err != nil {
+			return err
+		}
+		data = models.ConsolidationAccountMapModel{
+			GroupID:        &groupID,
+			CompanyID:      account.CompanyID,
+			AccountID:      &account.ID,
+			GroupAccountID: &groupAccount.ID,
+		}
+		return tx.Create(&data).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// DeleteAccountMap deletes an account mapping.
+func (s *ConsolidationService) DeleteAccountMap(id string) error {
+	return s.db.Where("id = ?", id).Unscoped().Delete(&models.ConsolidationAccountMapModel{}).Error
+}
+
+// GetAccountMaps returns the account mapping of a group, optionally for one company.
+func (s *ConsolidationService) GetAccountMaps(groupID string, companyID string) ([]models.ConsolidationAccountMapModel, error) {
+	var maps []models.ConsolidationAccountMapModel
+	stmt := s.db.Preload("Account").Preload("GroupAccount").Where("group_id = ?", groupID)
+	if companyID != "" {
+		stmt = stmt.Where("company_id = ?", companyID)
+	}
+	err := stmt.Find(&maps).Error
+	return maps, err
+}
+
+// TagIntercompany tags the ledger lines of the sales, purchases and returns
+// between the companies of a group and returns the number of tagged lines.
+//
+// A document is intercompany when its contact represents another company of the
+// group (ContactModel.IntercompanyID). Its receivable, payable, revenue and expense
+// lines get the other company as IntercompanyID; tax and exchange difference lines
+// are left out. Documents are tagged when they are posted, see TagDocument; this
+// method re-tags the documents of the group after the group membership or the
+// contacts change, or for documents posted before the group was set up.
+func (s *ConsolidationService) TagIntercompany(groupID string) (int64, error) {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return 0, err
+	}
+	return s.tagIntercompany(group)
+}
+
+func (s *ConsolidationService) tagIntercompany(group *models.CompanyGroupModel) (int64, error) {
+	memberIDs := companyIDs(group)
+	type document struct {
+		ID             string
+		CompanyID      string
+		IntercompanyID string
+	}
+	documents := []document{}
+	for _, table := range []string{"sales", "purchase_orders"} {
+		rows := []document{}
+		err := s.db.Table(table).
+			Select(table+".id, "+table+".company_id, contacts.intercompany_id").
+			Joins("JOIN contacts ON contacts.id = "+table+".contact_id").
+			Where(table+".company_id IN (?) AND contacts.intercompany_id IN (?)", memberIDs, memberIDs).
+			Where("contacts.intercompany_id <> " + table + ".company_id").
+			Where(table + ".deleted_at IS NULL").
+			Scan(&rows).Error
+		if err != nil {
+			return 0, err
+		}
+		documents = append(documents, rows...)
+	}
+
+	refs := map[string]document{}
+	refIDs := []string{}
+	for _, v := range documents {
+		refs[v.ID] = v
+		refIDs = append(refIDs, v.ID)
+	}
+	if len(refIDs) > 0 {
+		returns := []struct {
+			ID    string
+			RefID string
+		}{}
+		err := s.db.Model(&models.ReturnModel{}).Select("id, ref_id").Where("ref_id IN (?) AND status = ?", refIDs, "RELEASED").Scan(&returns).Error
+		if err != nil {
+			return 0, err
+		}
+		for _, v := range returns {
+			documents = append(documents, document{ID: v.ID, CompanyID: refs[v.RefID].CompanyID, IntercompanyID: refs[v.RefID].IntercompanyID})
+		}
+	}
+
+	// Documents of the same company and counterparty are tagged at once.
+	batches := map[[2]string][]string{}
+	for _, v := range documents {
+		key := [2]string{v.CompanyID, v.IntercompanyID}
+		batches[key] = append(batches[key], v.ID)
+	}
+	var tagged int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for key, ids := range batches {
+			affected, err := tagLines(tx, key[0], key[1], ids)
+			if err != nil {
+				return err
+			}
+			tagged += affected
+		}
+		return nil
+	})
+	return tagged, err
+}
+
+// TagDocument tags the ledger lines of a posted document as intercompany when
+// its contact represents another company of a group the company belongs to.
+// It is called by the sales, purchase, return and payment posting paths with
+// their transaction, after the lines of the document are created, so the
+// consolidated reports see intercompany documents as soon as they are posted.
+//
+// The document IDs are matched against the reference and secondary reference of
+// the lines, like TagIntercompany does. Documents of other contacts are left
+// untouched.
+func (s *ConsolidationService) TagDocument(tx *gorm.DB, companyID, contactID *string, documentIDs ...string) error {
+	if companyID == nil || contactID == nil || len(documentIDs) == 0 {
+		return nil
+	}
+	var contact models.ContactModel
+	if err := tx.Select("id, intercompany_id").Where("id = ?", *contactID).First(&contact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if contact.IntercompanyID == nil || *contact.IntercompanyID == *companyID {
+		return nil
+	}
+	var count int64
+	err := tx.Model(&models.CompanyGroupMemberModel{}).
+		Joins("JOIN company_group_members other ON other.group_id = company_group_members.group_id AND other.deleted_at IS NULL").
+		Where("company_group_members.company_id = ? AND other.company_id = ?", *companyID, *contact.IntercompanyID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	_, err = tagLines(tx, *companyID, *contact.IntercompanyID, documentIDs)
+	return err
+}
+
+// tagLines sets the intercompany company of the receivable, payable, revenue and
+// expense lines of the documents. Tax and exchange difference lines are left out.
+func tagLines(tx *gorm.DB, companyID, intercompanyID string, documentIDs []string) (int64, error) {
+	result := tx.Model(&models.TransactionModel{}).
+		Where("company_id = ?", companyID).
+		Where("transaction_ref_id IN (?) OR transaction_secondary_ref_id IN (?)", documentIDs, documentIDs).
+		Where("is_tax = ? AND is_fx_difference = ?", false, false).
+		Where("account_id IN (?)", tx.Model(&models.AccountModel{}).Select("id").Where("type IN (?)", intercompanyAccountTypes)).
+		Update("intercompany_id", intercompanyID)
+	return result.RowsAffected, result.Error
+}
+
+// ConsolidatedTrialBalance generates the trial balance of a company group up to
+// the end date.
+//
+// The balances of the group companies are combined per account of the parent
+// company's chart. The intercompany lines tagged by TagIntercompany are reversed
+// as eliminations; what remains of them after the receivables, payables, sales
+// and expenses cancel out is the cost of the intercompany goods, which is
+// eliminated against the cost of goods sold account of the parent company.
+func (s *ConsolidationService) ConsolidatedTrialBalance(groupID string, endDate time.Time) (*models.ConsolidatedTrialBalance, error) {
+	group, mapper, err := s.prepare(groupID)
+	if err != nil {
+		return nil, err
+	}
+	result := models.ConsolidatedTrialBalance{
+		GroupID:      group.ID,
+		EndDate:      endDate,
+		Rows:         []models.ConsolidatedTrialBalanceRow{},
+		Eliminations: []models.ConsolidationElimination{},
+	}
+	type row struct {
+		account                                            models.AccountModel
+		debit, credit, eliminationDebit, eliminationCredit money.Amount
+	}
+	rows := map[string]*row{}
+	order := []string{}
+	getRow := func(accountID string) *row {
+		account := mapper.resolve(accountID)
+		if _, ok := rows[account.ID]; !ok {
+			rows[account.ID] = &row{account: account}
+			order = append(order, account.ID)
+		}
+		return rows[account.ID]
+	}
+
+	var residual money.Amount
+	for _, member := range group.Members {
+		balances, err := s.accountBalances(*member.CompanyID, nil, nil, &endDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range balances {
+			r := getRow(v.AccountID)
+			r.debit = r.debit.Add(money.FromFloat(v.Debit))
+			r.credit = r.credit.Add(money.FromFloat(v.Credit))
+		}
+
+		tagged, err := s.accountBalances(*member.CompanyID, companyIDs(group), nil, &endDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range tagged {
+			r := getRow(v.AccountID)
+			r.eliminationDebit = r.eliminationDebit.Add(money.FromFloat(v.Credit))
+			r.eliminationCredit = r.eliminationCredit.Add(money.FromFloat(v.Debit))
+			residual = residual.Add(money.FromFloat(v.Credit)).Sub(money.FromFloat(v.Debit))
+			result.Eliminations = append(result.Eliminations, elimination(*member.CompanyID, r.account, "Eliminasi saldo antar perusahaan", v.Credit, v.Debit))
+		}
+	}
+
+	if !residual.IsZero() {
+		cogsAccount, err := s.parentCogsAccount(group)
+		if err != nil {
+			return nil, err
+		}
+		r := getRow(cogsAccount.ID)
+		debit, credit := money.Amount(0), residual
+		if residual.Sign() < 0 {
+			debit, credit = residual.Neg(), 0
+		}
+		r.eliminationDebit = r.eliminationDebit.Add(debit)
+		r.eliminationCredit = r.eliminationCredit.Add(credit)
+		result.Eliminations = append(result.Eliminations, elimination(*group.ParentCompanyID, r.account, "Eliminasi HPP antar perusahaan", debit.Float64(), credit.Float64()))
+	}
+
+	var totalDebit, totalCredit money.Amount
+	for _, id := range order {
+		r := rows[id]
+		// The consolidated balance is shown on one side, like the balance of an account.
+		net := r.debit.Add(r.eliminationDebit).Sub(r.credit).Sub(r.eliminationCredit)
+		var consolidatedDebit, consolidatedCredit money.Amount
+		if net.Sign() > 0 {
+			consolidatedDebit = net
+		} else {
+			consolidatedCredit = net.Neg()
+		}
+		totalDebit = totalDebit.Add(consolidatedDebit)
+		totalCredit = totalCredit.Add(consolidatedCredit)
+		result.Rows = append(result.Rows, models.ConsolidatedTrialBalanceRow{
+			ID:                 r.account.ID,
+			Code:               r.account.Code,
+			Name:               r.account.Name,
+			Debit:              r.debit.Float64(),
+			Credit:             r.credit.Float64(),
+			EliminationDebit:   r.eliminationDebit.Float64(),
+			EliminationCredit:  r.eliminationCredit.Float64(),
+			ConsolidatedDebit:  consolidatedDebit.Float64(),
+			ConsolidatedCredit: consolidatedCredit.Float64(),
+		})
+	}
+	result.TotalDebit = totalDebit.Float64()
+	result.TotalCredit = totalCredit.Float64()
+	return &result, nil
+}
+
+// ConsolidatedProfitLoss generates the profit and loss report of a company group
+// for a period.
+//
+// The profit and loss reports of the group companies are combined per account of
+// the parent company's chart. Intercompany sales and expenses are eliminated, and
+// the cost of goods sold is reduced by the intercompany sales not matched by an
+// intercompany expense, assuming the goods were sold on outside the group within
+// the period. The net profit of companies not fully owned is split into the share
+// of the minority shareholders and the share of the parent.
+func (s *ConsolidationService) ConsolidatedProfitLoss(groupID string, startDate, endDate time.Time) (*models.ConsolidatedProfitLoss, error) {
+	group, mapper, err := s.prepare(groupID)
+	if err != nil {
+		return nil, err
+	}
+	result := models.ConsolidatedProfitLoss{
+		GroupID:           group.ID,
+		StartDate:         startDate,
+		EndDate:           endDate,
+		Eliminations:      []models.ConsolidationElimination{},
+		MinorityInterests: []models.ConsolidationMinorityInterest{},
+	}
+	profit := newLineSet(mapper)
+	loss := newLineSet(mapper)
+	var cogs, minorityProfit money.Amount
+	hasCogs := false
+
+	for _, member := range group.Members {
+		memberReport, err := s.reportService.GenerateProfitLossReport(models.GeneralReport{
+			CompanyID: *member.CompanyID,
+			StartDate: startDate,
+			EndDate:   endDate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range memberReport.Profit {
+			if v.IsCogs {
+				cogs = cogs.Add(money.FromFloat(v.Sum))
+				hasCogs = true
+				continue
+			}
+			profit.add(v.ID, v.Name, money.FromFloat(v.Sum))
+		}
+		for _, v := range memberReport.Loss {
+			loss.add(v.ID, v.Name, money.FromFloat(v.Sum))
+		}
+
+		tagged, err := s.taggedBalances(group, *member.CompanyID, &startDate, &endDate, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range tagged {
+			account := mapper.resolve(v.AccountID)
+			switch v.Type {
+			case models.REVENUE, models.INCOME, models.CONTRA_REVENUE:
+				amount := money.FromFloat(v.Credit).Sub(money.FromFloat(v.Debit))
+				profit.add(v.AccountID, account.Name, amount.Neg())
+				// Sales without a matching expense were goods bought into stock.
+				cogs = cogs.Add(amount)
+				result.Eliminations = append(result.Eliminations, elimination(*member.CompanyID, account, "Eliminasi penjualan antar perusahaan", v.Credit, v.Debit))
+			case models.EXPENSE:
+				amount := money.FromFloat(v.Debit).Sub(money.FromFloat(v.Credit))
+				loss.add(v.AccountID, account.Name, amount.Neg())
+				cogs = cogs.Sub(amount)
+				result.Eliminations = append(result.Eliminations, elimination(*member.CompanyID, account, "Eliminasi beban antar perusahaan", v.Credit, v.Debit))
+			}
+		}
+
+		if member.OwnershipPercent < 100 {
+			minority := money.FromFloat(memberReport.NetProfit).Percent(100 - member.OwnershipPercent)
+			minorityProfit = minorityProfit.Add(minority)
+			result.MinorityInterests = append(result.MinorityInterests, models.ConsolidationMinorityInterest{
+				CompanyID:        *member.CompanyID,
+				CompanyName:      companyName(member),
+				OwnershipPercent: member.OwnershipPercent,
+				NetProfit:        memberReport.NetProfit,
+				MinorityProfit:   minority.Float64(),
+			})
+		}
+	}
+
+	pl := models.ProfitLossReport{}
+	pl.CompanyID = *group.ParentCompanyID
+	pl.StartDate = startDate
+	pl.EndDate = endDate
+	pl.Profit = profit.profitLossAccounts()
+	if hasCogs || !cogs.IsZero() {
+		pl.Profit = append(pl.Profit, models.ProfitLossAccount{
+			Name:   "Harga Pokok Penjualan",
+			Sum:    cogs.Float64(),
+			Link:   "/cogs",
+			IsCogs: true,
+		})
+	}
+	pl.Loss = loss.profitLossAccounts()
+	grossProfit := profit.total().Add(cogs)
+	totalExpense := loss.total()
+	netProfit := grossProfit.Sub(totalExpense)
+	pl.GrossProfit = grossProfit.Float64()
+	pl.TotalExpense = totalExpense.Float64()
+	pl.NetProfit = netProfit.Float64()
+
+	result.ProfitLoss = pl
+	result.MinorityInterest = minorityProfit.Float64()
+	result.NetProfitAttributableToParent = netProfit.Sub(minorityProfit).Float64()
+	return &result, nil
+}
+
+// ConsolidatedBalanceSheet generates the balance sheet of a company group at the
+// end date.
+//
+// The balance sheets of the group companies are combined per account of the parent
+// company's chart, and the intercompany receivables and payables are eliminated.
+// When they do not cancel out, the difference is shown as a separate liability. The
+// share of minority shareholders in the equity of companies not fully owned is
+// reclassified to a minority interest line in the equity.
+func (s *ConsolidationService) ConsolidatedBalanceSheet(groupID string, startDate, endDate time.Time) (*models.ConsolidatedBalanceSheet, error) {
+	group, mapper, err := s.prepare(groupID)
+	if err != nil {
+		return nil, err
+	}
+	result := models.ConsolidatedBalanceSheet{
+		GroupID:           group.ID,
+		Eliminations:      []models.ConsolidationElimination{},
+		MinorityInterests: []models.ConsolidationMinorityInterest{},
+	}
+	fixed := newLineSet(mapper)
+	current := newLineSet(mapper)
+	liabilities := newLineSet(mapper)
+	equity := newLineSet(mapper)
+	var receivables, payables, minorityEquity money.Amount
+
+	for _, member := range group.Members {
+		bs, err := s.reportService.GenerateBalanceSheet(models.GeneralReport{
+			CompanyID: *member.CompanyID,
+			StartDate: startDate,
+			EndDate:   endDate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fixed.addBalanceSheet(bs.FixedAssets)
+		current.addBalanceSheet(bs.CurrentAssets)
+		liabilities.addBalanceSheet(bs.LiableAssets)
+		equity.addBalanceSheet(bs.Equity)
+
+		tagged, err := s.taggedBalances(group, *member.CompanyID, nil, &endDate, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range tagged {
+			account := mapper.resolve(v.AccountID)
+			switch v.Type {
+			case models.RECEIVABLE:
+				amount := money.FromFloat(v.Debit).Sub(money.FromFloat(v.Credit))
+				if amount.IsZero() {
+					continue
+				}
+				current.add(v.AccountID, account.Name, amount.Neg())
+				receivables = receivables.Add(amount)
+				result.Eliminations = append(result.Eliminations, balanceElimination(*member.CompanyID, account, "Eliminasi piutang antar perusahaan", amount.Neg()))
+			case models.LIABILITY:
+				amount := money.FromFloat(v.Credit).Sub(money.FromFloat(v.Debit))
+				if amount.IsZero() {
+					continue
+				}
+				liabilities.add(v.AccountID, account.Name, amount.Neg())
+				payables = payables.Add(amount)
+				result.Eliminations = append(result.Eliminations, balanceElimination(*member.CompanyID, account, "Eliminasi utang antar perusahaan", amount))
+			}
+		}
+
+		if member.OwnershipPercent < 100 {
+			minority := money.FromFloat(bs.TotalEquity).Percent(100 - member.OwnershipPercent)
+			minorityEquity = minorityEquity.Add(minority)
+			result.MinorityInterests = append(result.MinorityInterests, models.ConsolidationMinorityInterest{
+				CompanyID:        *member.CompanyID,
+				CompanyName:      companyName(member),
+				OwnershipPercent: member.OwnershipPercent,
+				Equity:           bs.TotalEquity,
+				MinorityEquity:   minority.Float64(),
+			})
+		}
+	}
+
+	difference := receivables.Sub(payables)
+	if !difference.IsZero() {
+		liabilities.addNamed("Selisih Eliminasi Antar Perusahaan", difference.Neg())
+	}
+	if !minorityEquity.IsZero() {
+		equity.addNamed("Reklasifikasi Kepentingan Non-Pengendali", minorityEquity.Neg())
+		equity.addNamed("Kepentingan Non-Pengendali", minorityEquity)
+	}
+
+	bs := models.BalanceSheet{}
+	bs.CompanyID = *group.ParentCompanyID
+	bs.StartDate = startDate
+	bs.EndDate = endDate
+	bs.FixedAssets = fixed.balanceSheetAccounts()
+	bs.CurrentAssets = current.balanceSheetAccounts()
+	bs.LiableAssets = liabilities.balanceSheetAccounts()
+	bs.Equity = equity.balanceSheetAccounts()
+	bs.TotalFixed = fixed.total().Float64()
+	bs.TotalCurrent = current.total().Float64()
+	bs.TotalAssets = fixed.total().Add(current.total()).Float64()
+	bs.TotalLiability = liabilities.total().Float64()
+	bs.TotalEquity = equity.total().Float64()
+	bs.TotalLiabilitiesAndEquity = liabilities.total().Add(equity.total()).Float64()
+
+	result.BalanceSheet = bs
+	result.EliminationDifference = difference.Float64()
+	result.MinorityInterest = minorityEquity.Float64()
+	return &result, nil
+}
+
+// prepare loads the group and builds the account mapper. The intercompany lines
+// are tagged when they are posted; see TagDocument and TagIntercompany.
+func (s *ConsolidationService) prepare(groupID string) (*models.CompanyGroupModel, *accountMapper, error) {
+	group, err := s.GetGroupByID(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group.ParentCompanyID == nil {
+		return nil, nil, errors.New("group has no parent company")
+	}
+	mapper, err := s.newAccountMapper(group)
+	if err != nil {
+		return nil, nil, err
+	}
+	return group, mapper, nil
+}
+
+type accountAmount struct {
+	AccountID string
+	Type      models.AccountType
+	Debit     float64
+	Credit    float64
+}
+
+// accountBalances sums the posted lines of a company per account before the end
+// date. With intercompanyIDs, only the lines tagged with one of them are summed.
+func (s *ConsolidationService) accountBalances(companyID string, intercompanyIDs []string, startDate, endDate *time.Time) ([]accountAmount, error) {
+	rows := []accountAmount{}
+	db := s.db.Model(&models.TransactionModel{}).
+		Select("transactions.account_id, accounts.type, sum(transactions.debit) as debit, sum(transactions.credit) as credit").
+		Joins("JOIN accounts ON accounts.id = transactions.account_id").
+		Where("transactions.company_id = ? AND transactions.is_draft = ?", companyID, false)
+	if intercompanyIDs != nil {
+		db = db.Where("transactions.intercompany_id IN (?)", intercompanyIDs)
+	}
+	if startDate != nil {
+		db = db.Where("transactions.date >= ?", startDate)
+	}
+	if endDate != nil {
+		db = db.Where("transactions.date < ?", endDate)
+	}
+	err := db.Group("transactions.account_id, accounts.type").Scan(&rows).Error
+	return rows, err
+}
+
+// taggedBalances sums the intercompany lines of a company per account. The
+// period is inclusive like the profit and loss report when inclusive is set.
+func (s *ConsolidationService) taggedBalances(group *models.CompanyGroupModel, companyID string, startDate, endDate *time.Time, inclusive bool) ([]accountAmount, error) {
+	if inclusive && endDate != nil {
+		end := endDate.Add(time.Nanosecond)
+		endDate = &end
+	}
+	return s.accountBalances(companyID, companyIDs(group), startDate, endDate)
+}
+
+func (s *ConsolidationService) parentCogsAccount(group *models.CompanyGroupModel) (*models.AccountModel, error) {
+	var account models.AccountModel
+	err := s.db.Where("is_cogs_account = ? AND company_id = ?", true, group.ParentCompanyID).First(&account).Error
+	if err != nil {
+		return nil, errors.New("cogs account of the parent company not found")
+	}
+	return &account, nil
+}
+
+// accountMapper resolves the accounts of the group companies to the accounts
+// of the consolidated reports.
+type accountMapper struct {
+	accounts map[string]models.AccountModel
+	mapped   map[string]models.AccountModel
+	byCode   map[string]models.AccountModel
+}
+
+func (s *ConsolidationService) newAccountMapper(group *models.CompanyGroupModel) (*accountMapper, error) {
+	mapper := accountMapper{
+		accounts: map[string]models.AccountModel{},
+		mapped:   map[string]models.AccountModel{},
+		byCode:   map[string]models.AccountModel{},
+	}
+	var accounts []models.AccountModel
+	if err := s.db.Where("company_id IN (?)", companyIDs(group)).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range accounts {
+		mapper.accounts[v.ID] = v
+		if v.CompanyID != nil && *v.CompanyID == *group.ParentCompanyID && v.Code != "" {
+			mapper.byCode[v.Code] = v
+		}
+	}
+	var maps []models.ConsolidationAccountMapModel
+	if err := s.db.Where("group_id = ?", group.ID).Find(&maps).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range maps {
+		if v.AccountID == nil || v.GroupAccountID == nil {
+			continue
+		}
+		if account, ok := mapper.accounts[*v.GroupAccountID]; ok {
+			mapper.mapped[*v.AccountID] = account
+		}
+	}
+	return &mapper, nil
+}
+
+func (m *accountMapper) resolve(accountID string) models.AccountModel {
+	if account, ok := m.mapped[accountID]; ok {
+		return account
+	}
+	account, ok := m.accounts[accountID]
+	if !ok {
+		account.ID = accountID
+		return account
+	}
+	if parent, ok := m.byCode[account.Code]; ok && account.Code != "" {
+		return parent
+	}
+	return account
+}
+
+// lineSet combines report lines of the group companies per consolidated account.
+// Lines without an account, such as retained earnings, are combined by name.
+type lineSet struct {
+	mapper *accountMapper
+	lines  map[string]*consolidatedLine
+	order  []string
+}
+
+type consolidatedLine struct {
+	id, code, name string
+	sum            money.Amount
+}
+
+func newLineSet(mapper *accountMapper) *lineSet {
+	return &lineSet{mapper: mapper, lines: map[string]*consolidatedLine{}}
+}
+
+func (l *lineSet) add(accountID, name string, amount money.Amount) {
+	if accountID == "" {
+		l.addNamed(name, amount)
+		return
+	}
+	account := l.mapper.resolve(accountID)
+	l.addLine(account.ID, account.ID, account.Code, account.Name, amount)
+}
+
+func (l *lineSet) addNamed(name string, amount money.Amount) {
+	l.addLine("name:"+name, "", "", name, amount)
+}
+
+func (l *lineSet) addLine(key, id, code, name string, amount money.Amount) {
+	line, ok := l.lines[key]
+	if !ok {
+		line = &consolidatedLine{id: id, code: code, name: name}
+		l.lines[key] = line
+		l.order = append(l.order, key)
+	}
+	line.sum = line.sum.Add(amount)
+}
+
+func (l *lineSet) addBalanceSheet(lines []models.BalanceSheetAccount) {
+	for _, v := range lines {
+		l.add(v.ID, v.Name, money.FromFloat(v.Sum))
+	}
+}
+
+func (l *lineSet) total() money.Amount {
+	var total money.Amount
+	for _, v := range l.lines {
+		total = total.Add(v.sum)
+	}
+	return total
+}
+
+func (l *lineSet) profitLossAccounts() []models.ProfitLossAccount {
+	result := []models.ProfitLossAccount{}
+	for _, key := range l.order {
+		v := l.lines[key]
+		result = append(result, models.ProfitLossAccount{ID: v.id, Code: v.code, Name: v.name, Sum: v.sum.Float64()})
+	}
+	return result
+}
+
+func (l *lineSet) balanceSheetAccounts() []models.BalanceSheetAccount {
+	result := []models.BalanceSheetAccount{}
+	for _, key := range l.order {
+		v := l.lines[key]
+		result = append(result, models.BalanceSheetAccount{ID: v.id, Code: v.code, Name: v.name, Sum: v.sum.Float64()})
+	}
+	return result
+}
+
+func elimination(companyID string, account models.AccountModel, description string, debit, credit float64) models.ConsolidationElimination {
+	return models.ConsolidationElimination{
+		CompanyID:   companyID,
+		AccountID:   account.ID,
+		Code:        account.Code,
+		Name:        account.Name,
+		Description: description,
+		Debit:       debit,
+		Credit:      credit,
+	}
+}
+
+// balanceElimination records a change of a balance as a debit when positive
+// and a credit when negative.
+func balanceElimination(companyID string, account models.AccountModel, description string, amount money.Amount) models.ConsolidationElimination {
+	if amount.Sign() >= 0 {
+		return elimination(companyID, account, description, amount.Float64(), 0)
+	}
+	return elimination(companyID, account, description, 0, amount.Neg().Float64())
+}
+
+func companyIDs(group *models.CompanyGroupModel) []string {
+	ids := []string{}
+	for _, v := range group.Members {
+		if v.CompanyID != nil {
+			ids = append(ids, *v.CompanyID)
+		}
+	}
+	return ids
+}
+
+func isMember(group *models.CompanyGroupModel, companyID string) bool {
+	for _, v := range companyIDs(group) {
+		if v == companyID {
+			return true
+		}
+	}
+	return false
+}
+
+func companyName(member models.CompanyGroupMemberModel) string {
+	if member.Company != nil {
+		return member.Company.Name
+	}
+	return ""
+}
+
+func validateOwnership(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return errors.New("ownership percent must be between 0 and 100")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package currency
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+type CurrencyService struct {
+	db  *gorm.DB
+	ctx *context.ERPContext
+}
+
+// NewCurrencyService returns a new instance of CurrencyService.
+//
+// The service is created by providing a GORM database instance and an ERP context.
+// It manages the exchange-rate table and converts foreign currency amounts into
+// the functional currency of a company.
+func NewCurrencyService(db *gorm.DB, ctx *context.ERPContext) *CurrencyService {
+	return &CurrencyService{db: db, ctx: ctx}
+}
+
+// Migrate runs the database migration for the ExchangeRateModel.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.ExchangeRateModel{})
+}
+
+// GetFunctionalCurrency returns the functional currency of the given company.
+//
+// If the company does not exist or has no currency set, DEFAULT_CURRENCY is returned.
+func (s *CurrencyService) GetFunctionalCurrency(companyID string) string {
+	var company models.CompanyModel
+	if err := s.db.Select("id, currency_code").Where("id = ?", companyID).First(&company).Error; err != nil {
+		return models.DEFAULT_CURRENCY
+	}
+	if company.CurrencyCode == "" {
+		return models.DEFAULT_CURRENCY
+	}
+	return company.CurrencyCode
+}
+
+// IsForeign reports whether the given currency code differs from the functional
+// currency of the company. An empty code is treated as the functional currency.
+func (s *CurrencyService) IsForeign(companyID, currencyCode string) bool {
+	if currencyCode == "" {
+		return false
+	}
+	return !strings.EqualFold(currencyCode, s.GetFunctionalCurrency(companyID))
+}
+
+// GetRate returns the exchange rate of the currency on the given date.
+//
+// The latest rate dated on or before the given date is used. The functional
+// currency always has a rate of 1. An error is returned if no rate is found.
+func (s *CurrencyService) GetRate(companyID, currencyCode string, date time.Time) (float64, error) {
+	if !s.IsForeign(companyID, currencyCode) {
+		return 1, nil
+	}
+	var rate models.ExchangeRateModel
+	err := s.db.Where("company_id = ? AND currency_code = ? AND date <= ?", companyID, strings.ToUpper(currencyCode), date).
+		Order("date desc").
+		First(&rate).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errors.New("exchange rate not found for " + currencyCode)
+		}
+		return 0, err
+	}
+	if rate.Rate <= 0 {
+		return 0, errors.New("invalid exchange rate for " + currencyCode)
+	}
+	return rate.Rate, nil
+}
+
+// ResolveRate returns the rate to use for a document in the given currency.
+//
+// Documents in the functional currency always use 1. A foreign document keeps
+// any positive rate it was entered with, 1 included; when none was entered (0),
+// the rate is looked up on the given date. The exchange rate of sales and
+// purchase documents and their payments has no column default, so a document
+// saved without a rate keeps 0 until it is posted.
+func (s *CurrencyService) ResolveRate(companyID, currencyCode string, rate float64, date time.Time) (float64, error) {
+	if !s.IsForeign(companyID, currencyCode) {
+		return 1, nil
+	}
+	if rate > 0 {
+		return rate, nil
+	}
+	return s.GetRate(companyID, currencyCode, date)
+}
+
+// Convert converts an amount in the given currency to the functional currency
+// of the company using the rate on the given date. It returns the converted
+// amount and the rate used.
+func (s *CurrencyService) Convert(companyID, currencyCode string, date time.Time, amount float64) (float64, float64, error) {
+	rate, err := s.GetRate(companyID, currencyCode, date)
+	if err != nil {
+		return 0, 0, err
+	}
+	return amount * rate, rate, nil
+}
+
+// CreateExchangeRate creates a new exchange rate record in the database.
+func (s *CurrencyService) CreateExchangeRate(data *models.ExchangeRateModel) error {
+	if data.Rate <= 0 {
+		return errors.New("rate must be greater than zero")
+	}
+	data.CurrencyCode = strings.ToUpper(data.CurrencyCode)
+	return s.db.Create(data).Error
+}
+
+// UpdateExchangeRate updates an existing exchange rate record in the database.
+func (s *CurrencyService) UpdateExchangeRate(id string, data *models.ExchangeRateModel) error {
+	if data.Rate <= 0 {
+		return errors.New("rate must be greater than zero")
+	}
+	data.CurrencyCode = strings.ToUpper(data.CurrencyCode)
+	return s.db.Where("id = ?", id).Updates(data).Error
+}
+
+// DeleteExchangeRate deletes an exchange rate record from the database.
+func (s *CurrencyService) DeleteExchangeRate(id string) error {
+	return s.db.Where("id = ?", id).Delete(&models.ExchangeRateModel{}).Error
+}
+
+// GetExchangeRateByID retrieves an exchange rate record by its ID.
+func (s *CurrencyService) GetExchangeRateByID(id string) (*models.ExchangeRateModel, error) {
+	var rate models.ExchangeRateModel
+	err := s.db.Where("id = ?", id).First(&rate).Error
+	return &rate, err
+}
+
+// GetExchangeRates retrieves a paginated list of exchange rates.
+//
+// The result is filtered by the company ID in the request header and by the
+// currency_code, start_date and end_date query parameters when given.
+func (s *CurrencyService) GetExchangeRates(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Model(&models.ExchangeRateModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if search != "" {
+		stmt = stmt.Where("currency_code ILIKE ? OR source ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+	if request.URL.Query().Get("currency_code") != "" {
+		stmt = stmt.Where("currency_code = ?", strings.ToUpper(request.URL.Query().Get("currency_code")))
+	}
+	if request.URL.Query().Get("start_date") != "" {
+		stmt = stmt.Where("date >= ?", request.URL.Query().Get("start_date"))
+	}
+	if request.URL.Query().Get("end_date") != "" {
+		stmt = stmt.Where("date <= ?", request.URL.Query().Get("end_date"))
+	}
+	stmt = stmt.Order("date desc")
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.ExchangeRateModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
@@ -7,8 +7,12 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance/account"
 	"github.com/AMETORY/ametory-erp-modules/finance/asset"
+	"github.com/AMETORY/ametory-erp-modules/finance/balance"
 	"github.com/AMETORY/ametory-erp-modules/finance/bank"
+	"github.com/AMETORY/ametory-erp-modules/finance/consolidation"
+	"github.com/AMETORY/ametory-erp-modules/finance/currency"
 	"github.com/AMETORY/ametory-erp-modules/finance/journal"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	"github.com/AMETORY/ametory-erp-modules/finance/report"
 	"github.com/AMETORY/ametory-erp-modules/finance/tax"
 	"github.com/AMETORY/ametory-erp-modules/finance/transaction"
@@ -16,14 +20,19 @@ import (
 )
 
 type FinanceService struct {
-	ctx                *context.ERPContext
-	AccountService     *account.AccountService
-	TransactionService *transaction.TransactionService
-	BankService        *bank.BankService
-	JournalService     *journal.JournalService
-	ReportService      *report.FinanceReportService
-	TaxService         *tax.TaxService
-	AssetService       *asset.AssetService
+	ctx                       *context.ERPContext
+	AccountService            *account.AccountService
+	TransactionService        *transaction.TransactionService
+	BankService               *bank.BankService
+	BankReconciliationService *bank.BankReconciliationService
+	JournalService            *journal.JournalService
+	ReportService             *report.FinanceReportService
+	TaxService                *tax.TaxService
+	AssetService              *asset.AssetService
+	CurrencyService           *currency.CurrencyService
+	PeriodLockService         *period.PeriodLockService
+	ConsolidationService      *consolidation.ConsolidationService
+	BalanceService            *balance.BalanceService
 }
 
 // NewFinanceService creates a new instance of FinanceService.
@@ -42,10 +51,18 @@ func NewFinanceService(ctx *context.ERPContext) *FinanceService {
 	service.AccountService = account.NewAccountService(ctx.DB, ctx)
 	service.TransactionService = transaction.NewTransactionService(ctx.DB, ctx, service.AccountService)
 	service.BankService = bank.NewBankService(ctx.DB, ctx)
+	service.BankReconciliationService = bank.NewBankReconciliationService(ctx.DB, ctx)
 	service.JournalService = journal.NewJournalService(ctx.DB, ctx, service.AccountService, service.TransactionService)
 	service.ReportService = report.NewFinanceReportService(ctx.DB, ctx, service.AccountService, service.TransactionService)
 	service.TaxService = tax.NewTaxService(ctx.DB, ctx, service.AccountService)
 	service.AssetService = asset.NewAssetService(ctx.DB, ctx)
+	service.CurrencyService = currency.NewCurrencyService(ctx.DB, ctx)
+	service.ReportService.SetCurrencyService(service.CurrencyService)
+	service.BankReconciliationService.SetCurrencyService(service.CurrencyService)
+	service.BalanceService = balance.NewBalanceService(ctx.DB, ctx)
+	service.ReportService.SetBalanceService(service.BalanceService)
+	service.PeriodLockService = period.NewPeriodLockService(ctx.DB, ctx)
+	service.ConsolidationService = consolidation.NewConsolidationService(ctx.DB, ctx, service.ReportService)
 	err := service.Migrate()
 	if err != nil {
 		panic(err)
@@ -58,7 +75,11 @@ func NewFinanceService(ctx *context.ERPContext) *FinanceService {
 // If the SkipMigration flag is true in the context, this method
 // will not perform any migration and will return nil. Otherwise, it will
 // attempt to auto-migrate the database to include the
-// AccountModel, TransactionModel, JournalModel, TaxModel, and AssetModel schemas.
+// AccountModel, TransactionModel, AnalyticDimensionTypeModel, JournalModel, TaxModel, TaxInvoiceSerialRangeModel,
+// TaxInvoiceModel, WithholdingSlipModel, WithholdingSlipCounterModel, AssetModel, AssetEventModel, ExchangeRateModel, PeriodLockModel,
+// BankStatementModel, BankStatementLineModel, CompanyGroupModel,
+// CompanyGroupMemberModel, ConsolidationAccountMapModel, AccountBalanceModel and
+// AccountBalanceStateModel schemas.
 // If the migration process encounters an error, it will return that error.
 // Otherwise, it will return nil upon successful migration.
 func (s *FinanceService) Migrate() error {
@@ -89,6 +110,26 @@ func (s *FinanceService) Migrate() error {
 		log.Println("ERROR ASSET MIGRATE", err)
 		return err
 	}
+	if err := currency.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR CURRENCY MIGRATE", err)
+		return err
+	}
+	if err := period.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR PERIOD MIGRATE", err)
+		return err
+	}
+	if err := bank.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR BANK MIGRATE", err)
+		return err
+	}
+	if err := consolidation.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR CONSOLIDATION MIGRATE", err)
+		return err
+	}
+	if err := balance.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR BALANCE MIGRATE", err)
+		return err
+	}
 	// if err := transaction.Migrate(s.TransactionService.DB()); err != nil {
 	// 	return err
 	// }
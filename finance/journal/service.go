@@ -1,15 +1,22 @@
 package journal
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance/account"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	"github.com/AMETORY/ametory-erp-modules/finance/transaction"
+	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type JournalService struct {
@@ -37,13 +44,25 @@ func NewJournalService(db *gorm.DB,
 }
 
 // Migrate creates the database tables required for the journal service, if they do
-// not already exist.
+// not already exist. Journals created before the posting lifecycle are already part
+// of the ledger, so they are marked as POSTED.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.JournalModel{})
+	if err := db.AutoMigrate(&models.JournalModel{}); err != nil {
+		return err
+	}
+	return db.Model(&models.JournalModel{}).Where("status IS NULL OR status = ''").Update("status", models.JOURNAL_POSTED).Error
 }
 
 // CreateJournal creates a new journal entry based on the provided data.
+//
+// New journals start as DRAFT. Their lines are kept out of the ledger until the
+// journal is posted with PostJournal.
 func (js *JournalService) CreateJournal(data *models.JournalModel) error {
+	data.Status = models.JOURNAL_DRAFT
+	data.PostedAt = nil
+	data.PostedByID = nil
+	data.ReversalOfID = nil
+	data.ReversedByID = nil
 	return js.db.Create(data).Error
 }
 
@@ -71,33 +90,204 @@ func (js *JournalService) GetJournal(id string) (*models.JournalModel, error) {
 	}
 
 	// fmt.Println("BALANCE", credit, debit, credit != debit)
-	journal.Unbalanced = credit != debit
+	journal.Unbalanced = isUnbalanced(debit, credit)
 	return &journal, err
 }
 
+// isUnbalanced reports whether debit and credit differ by more than the rounding tolerance.
+func isUnbalanced(debit, credit float64) bool {
+	return math.Abs(debit-credit) > models.JOURNAL_BALANCE_TOLERANCE
+}
+
 // UpdateJournal updates an existing journal entry based on the provided data.
 //
 // It takes an ID of the journal entry to be updated and a pointer to a JournalModel
-// containing the updated journal information. The function returns an error if the
-// update operation fails.
+// containing the updated journal information. Only DRAFT journals can be updated,
+// and the status fields are left to PostJournal and ReverseJournal. The function
+// returns an error if the update operation fails.
 func (js *JournalService) UpdateJournal(id string, data *models.JournalModel) error {
-	return js.db.Where("id = ?", id).Updates(data).Error
+	var journal models.JournalModel
+	if err := js.db.Where("id = ?", id).First(&journal).Error; err != nil {
+		return err
+	}
+	if journal.Status != models.JOURNAL_DRAFT {
+		return errors.New("only draft journal can be updated")
+	}
+	return js.db.Where("id = ?", id).
+		Omit("status", "posted_at", "posted_by_id", "reversal_of_id", "reversed_by_id", "reversed_at").
+		Updates(data).Error
 }
 
 // DeleteJournal deletes a journal entry and its associated transactions.
 //
 // This function takes the ID of the journal entry to be deleted. It first
 // removes all transactions linked to the journal entry by their reference ID
-// and type. Then, it deletes the journal entry itself.
+// and type. Then, it deletes the journal entry itself. Only DRAFT journals can
+// be deleted; a posted journal must be reversed with ReverseJournal.
 //
 // Returns an error if any of the delete operations fail; otherwise, nil.
 func (js *JournalService) DeleteJournal(id string) error {
-	var transaction models.TransactionModel
-	err := js.db.Where("transaction_ref_id = ? and transaction_ref_type = ?", id, "journal").Delete(&transaction).Error
-	if err != nil {
+	var journal models.JournalModel
+	if err := js.db.Where("id = ?", id).First(&journal).Error; err != nil {
 		return err
 	}
-	return js.db.Where("id = ?", id).Delete(&models.JournalModel{}).Error
+	if journal.Status != models.JOURNAL_DRAFT {
+		return errors.New("posted journal can not be deleted, reverse it instead")
+	}
+	return js.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("(transaction_ref_id = ? and transaction_ref_type = ?) or (transaction_secondary_ref_id = ? and transaction_secondary_ref_type = ?)", id, "journal", id, "journal").
+			Delete(&models.TransactionModel{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.JournalModel{}).Error
+	})
+}
+
+// PostJournal posts a DRAFT journal into the ledger.
+//
+// The journal is locked for the duration of the posting. Posting is refused when the
+// journal has no lines, when its debits and credits differ by more than
+// JOURNAL_BALANCE_TOLERANCE, or when a line falls in a locked period. On success all
+// lines leave the draft state at once and the journal becomes POSTED.
+func (js *JournalService) PostJournal(id string, userID string) error {
+	return js.db.Transaction(func(tx *gorm.DB) error {
+		var journal models.JournalModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&journal).Error; err != nil {
+			return err
+		}
+		if journal.Status != models.JOURNAL_DRAFT {
+			return errors.New("journal is not in draft status")
+		}
+
+		var lines []models.TransactionModel
+		err := tx.Where("transaction_secondary_ref_id = ? and transaction_secondary_ref_type = ?", id, "journal").Find(&lines).Error
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return errors.New("journal has no transactions")
+		}
+		var debit, credit float64
+		for _, line := range lines {
+			debit += line.Debit
+			credit += line.Credit
+			if err := period.Check(tx, line.CompanyID, "journal", line.Date); err != nil {
+				return err
+			}
+		}
+		if isUnbalanced(debit, credit) {
+			return fmt.Errorf("journal is unbalanced: debit %.2f, credit %.2f", debit, credit)
+		}
+
+		err = tx.Model(&models.TransactionModel{}).
+			Where("transaction_secondary_ref_id = ? and transaction_secondary_ref_type = ?", id, "journal").
+			Update("is_draft", false).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&models.JournalModel{}).Where("id = ?", id).Updates(map[string]any{
+			"status":       models.JOURNAL_POSTED,
+			"posted_at":    now,
+			"posted_by_id": userID,
+		}).Error
+	})
+}
+
+// ReverseJournal reverses a POSTED journal.
+//
+// Instead of deleting rows, it creates a new posted journal dated on the given date
+// whose lines mirror the original lines with debit and credit swapped. The new
+// journal is linked through ReversalOfID and the original one becomes REVERSED with
+// ReversedByID pointing to it. The reversal date must be in an open period.
+//
+// Returns the reversal journal, or an error if any of the operations fail.
+func (js *JournalService) ReverseJournal(id string, userID string, date time.Time, description string) (*models.JournalModel, error) {
+	var reversal models.JournalModel
+	err := js.db.Transaction(func(tx *gorm.DB) error {
+		var journal models.JournalModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&journal).Error; err != nil {
+			return err
+		}
+		if journal.Status != models.JOURNAL_POSTED {
+			return errors.New("only posted journal can be reversed")
+		}
+		if journal.ReversalOfID != nil {
+			return errors.New("reversal journal can not be reversed")
+		}
+		if err := period.Check(tx, journal.CompanyID, "journal", date); err != nil {
+			return err
+		}
+
+		var lines []models.TransactionModel
+		err := tx.Where("transaction_secondary_ref_id = ? and transaction_secondary_ref_type = ?", id, "journal").Find(&lines).Error
+		if err != nil {
+			return err
+		}
+
+		if description == "" {
+			description = "Pembalikan " + journal.Description
+		}
+		now := time.Now()
+		reversal = models.JournalModel{
+			BaseModel:    shared.BaseModel{ID: utils.Uuid()},
+			UserID:       &userID,
+			CompanyID:    journal.CompanyID,
+			Description:  description,
+			Date:         &date,
+			EmployeeID:   journal.EmployeeID,
+			Status:       models.JOURNAL_POSTED,
+			PostedAt:     &now,
+			PostedByID:   &userID,
+			ReversalOfID: &journal.ID,
+		}
+		if err := tx.Create(&reversal).Error; err != nil {
+			return err
+		}
+
+		// Keep the pairing of the original lines: same code and cross references.
+		ids := map[string]string{}
+		codes := map[string]string{}
+		for _, line := range lines {
+			ids[line.ID] = utils.Uuid()
+			if _, ok := codes[line.Code]; !ok {
+				codes[line.Code] = utils.RandString(10, false)
+			}
+		}
+		for _, line := range lines {
+			mirror := line
+			mirror.BaseModel = shared.BaseModel{ID: ids[line.ID]}
+			mirror.Account = models.AccountModel{}
+			mirror.Code = codes[line.Code]
+			mirror.Date = date
+			mirror.Description = description
+			mirror.Debit = line.Credit
+			mirror.Credit = line.Debit
+			mirror.UserID = &userID
+			mirror.IsDraft = false
+			mirror.TransactionSecondaryRefID = &reversal.ID
+			if line.TransactionRefID != nil {
+				if refID, ok := ids[*line.TransactionRefID]; ok {
+					mirror.TransactionRefID = &refID
+				}
+			}
+			if err := tx.Omit(clause.Associations).Create(&mirror).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.JournalModel{}).Where("id = ?", id).Updates(map[string]any{
+			"status":         models.JOURNAL_REVERSED,
+			"reversed_by_id": reversal.ID,
+			"reversed_at":    now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reversal, nil
 }
 
 // GetJournals retrieves a paginated list of journals from the database.
@@ -128,8 +318,10 @@ func (js *JournalService) GetJournals(request http.Request, search string) (pagi
 			Credit float64 `sql:"credit"`
 			Debit  float64 `sql:"debit"`
 		}{}
-		js.db.Model(&models.TransactionModel{}).Select("sum(credit) as credit, sum(debit) as debit").Where("transaction_ref_id = ?", item.ID).Scan(&amount)
-		item.Unbalanced = amount.Credit != amount.Debit
+		js.db.Model(&models.TransactionModel{}).Select("sum(credit) as credit, sum(debit) as debit").
+			Where("(transaction_ref_id = ? AND transaction_ref_type = ?) OR (transaction_secondary_ref_id = ? AND transaction_secondary_ref_type = ?)", item.ID, "journal", item.ID, "journal").
+			Scan(&amount)
+		item.Unbalanced = isUnbalanced(amount.Debit, amount.Credit)
 		newItems = append(newItems, item)
 	}
 	page.Items = &newItems
@@ -144,10 +336,20 @@ func (js *JournalService) GetJournals(request http.Request, search string) (pagi
 // fields of the transaction to the provided journal ID and "journal" respectively,
 // and then calls the CreateTransaction method of the TransactionService to
 // persist the transaction to the database.
+// Transactions can only be added to a DRAFT journal and stay in draft until the
+// journal is posted.
 // The function returns an error if the transaction creation fails.
 func (js *JournalService) AddTransaction(journalID string, transaction *models.TransactionModel, amount float64) error {
+	var journal models.JournalModel
+	if err := js.db.Where("id = ?", journalID).First(&journal).Error; err != nil {
+		return err
+	}
+	if journal.Status != models.JOURNAL_DRAFT {
+		return errors.New("transactions can only be added to a draft journal")
+	}
 	transaction.TransactionSecondaryRefID = &journalID
 	transaction.TransactionSecondaryRefType = "journal"
+	transaction.IsDraft = true
 
 	return js.transactionService.CreateTransaction(transaction, amount)
 }
@@ -155,6 +357,7 @@ func (js *JournalService) AddTransaction(journalID string, transaction *models.T
 // DeleteTransaction deletes a transaction by its ID.
 //
 // The function takes the ID of the transaction as its argument.
+// Lines of a posted journal can not be deleted.
 // It returns an error if the deletion operation fails.
 func (js *JournalService) DeleteTransaction(id string) error {
 	return js.transactionService.DeleteTransaction(id)
@@ -0,0 +1,227 @@
+package period
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/auth"
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// PERMISSION_REOPEN is the permission required to reopen a locked period.
+const PERMISSION_REOPEN = "finance:period_lock:reopen"
+
+// ErrPeriodLocked is matched by every PeriodLockedError, so callers can use
+// errors.Is(err, period.ErrPeriodLocked).
+var ErrPeriodLocked = errors.New("period is locked")
+
+// PeriodLockedError is returned when a posting falls on or before the lock date
+// of the company or of the module.
+type PeriodLockedError struct {
+	CompanyID string
+	Module    string
+	LockDate  time.Time
+	Date      time.Time
+}
+
+func (e *PeriodLockedError) Error() string {
+	if e.Module != "" {
+		return fmt.Sprintf("period is locked for %s until %s, cannot post on %s", e.Module, e.LockDate.Format("2006-01-02"), e.Date.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("period is locked until %s, cannot post on %s", e.LockDate.Format("2006-01-02"), e.Date.Format("2006-01-02"))
+}
+
+func (e *PeriodLockedError) Is(target error) bool {
+	return target == ErrPeriodLocked
+}
+
+type PeriodLockService struct {
+	db  *gorm.DB
+	ctx *context.ERPContext
+}
+
+// NewPeriodLockService returns a new instance of PeriodLockService.
+//
+// The service is created by providing a GORM database instance and an ERP context.
+// The RBAC service in the context is used to authorize reopening a locked period.
+func NewPeriodLockService(db *gorm.DB, ctx *context.ERPContext) *PeriodLockService {
+	return &PeriodLockService{db: db, ctx: ctx}
+}
+
+// Migrate runs the database migration for the PeriodLockModel and PeriodReopenLogModel.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.PeriodLockModel{}, &models.PeriodReopenLogModel{})
+}
+
+// Check returns a *PeriodLockedError if the date falls on or before the lock
+// date of the company, or of the given module. The lock date is inclusive:
+// the whole lock day is closed.
+//
+// A nil company ID is never locked. Check is used by every posting path and
+// accepts the database handle of the running transaction.
+func Check(db *gorm.DB, companyID *string, module string, date time.Time) error {
+	if companyID == nil {
+		return nil
+	}
+	var locks []models.PeriodLockModel
+	stmt := db.Where("company_id = ?", *companyID)
+	if module != "" {
+		stmt = stmt.Where("module = '' OR module = ?", module)
+	} else {
+		stmt = stmt.Where("module = ''")
+	}
+	if err := stmt.Find(&locks).Error; err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		y, m, d := lock.LockDate.Date()
+		openFrom := time.Date(y, m, d+1, 0, 0, 0, 0, lock.LockDate.Location())
+		if date.Before(openFrom) {
+			return &PeriodLockedError{
+				CompanyID: *companyID,
+				Module:    lock.Module,
+				LockDate:  lock.LockDate,
+				Date:      date,
+			}
+		}
+	}
+	return nil
+}
+
+// CheckLock reports whether the date is open for posting in the given module.
+// See Check.
+func (s *PeriodLockService) CheckLock(companyID *string, module string, date time.Time) error {
+	return Check(s.db, companyID, module, date)
+}
+
+// GetLock returns the lock of a company for the given module. An empty module
+// returns the company-wide lock.
+func (s *PeriodLockService) GetLock(companyID, module string) (*models.PeriodLockModel, error) {
+	var lock models.PeriodLockModel
+	err := s.db.Where("company_id = ? AND module = ?", companyID, module).First(&lock).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// GetLocks returns every lock of a company.
+func (s *PeriodLockService) GetLocks(companyID string) ([]models.PeriodLockModel, error) {
+	var locks []models.PeriodLockModel
+	err := s.db.Where("company_id = ?", companyID).Order("module asc").Find(&locks).Error
+	return locks, err
+}
+
+// LockPeriod sets the lock date of a company or module.
+//
+// The lock date can only move forward; moving it backwards must go through
+// ReopenPeriod so that the reopening is authorized and logged.
+func (s *PeriodLockService) LockPeriod(companyID, module string, lockDate time.Time, userID *string, notes string) (*models.PeriodLockModel, error) {
+	lock, err := s.GetLock(companyID, module)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		lock = &models.PeriodLockModel{
+			CompanyID: &companyID,
+			Module:    module,
+			LockDate:  lockDate,
+			Notes:     notes,
+			UserID:    userID,
+		}
+		if err := s.db.Create(lock).Error; err != nil {
+			return nil, err
+		}
+		return lock, nil
+	}
+	if lockDate.Before(lock.LockDate) {
+		return nil, errors.New("lock date can not be moved backwards, reopen the period instead")
+	}
+	lock.LockDate = lockDate
+	lock.Notes = notes
+	lock.UserID = userID
+	if err := s.db.Save(lock).Error; err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// ReopenPeriod moves the lock date of a company or module backwards.
+//
+// The user must hold the finance:period_lock:reopen permission in the company
+// and must give a reason. A nil newLockDate removes the lock entirely. Every
+// reopening is recorded in PeriodReopenLogModel.
+func (s *PeriodLockService) ReopenPeriod(companyID, module string, newLockDate *time.Time, userID, reason string) error {
+	if reason == "" {
+		return errors.New("reason is required")
+	}
+	rbacService, ok := s.ctx.RBACService.(*auth.RBACService)
+	if !ok {
+		return errors.New("rbac service is not initialized")
+	}
+	allowed, err := rbacService.CheckPermissionWithCompanyID(userID, companyID, []string{PERMISSION_REOPEN})
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errors.New("user is not allowed to reopen the period")
+	}
+
+	lock, err := s.GetLock(companyID, module)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("period is not locked")
+		}
+		return err
+	}
+	if newLockDate != nil && !newLockDate.Before(lock.LockDate) {
+		return errors.New("new lock date must be before the current lock date")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&models.PeriodReopenLogModel{
+			CompanyID:        &companyID,
+			Module:           module,
+			PreviousLockDate: lock.LockDate,
+			NewLockDate:      newLockDate,
+			Reason:           reason,
+			UserID:           &userID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if newLockDate == nil {
+			return tx.Where("id = ?", lock.ID).Unscoped().Delete(&models.PeriodLockModel{}).Error
+		}
+		return tx.Model(&models.PeriodLockModel{}).Where("id = ?", lock.ID).Updates(map[string]any{
+			"lock_date": *newLockDate,
+			"user_id":   userID,
+		}).Error
+	})
+}
+
+// GetReopenLogs retrieves a paginated list of period reopen logs.
+//
+// The result is filtered by the company ID in the request header and by the
+// module query parameter when given.
+func (s *PeriodLockService) GetReopenLogs(request http.Request) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("User").Model(&models.PeriodReopenLogModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if request.URL.Query().Get("module") != "" {
+		stmt = stmt.Where("module = ?", request.URL.Query().Get("module"))
+	}
+	stmt = stmt.Order("created_at desc")
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.PeriodReopenLogModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
@@ -0,0 +1,290 @@
+package report
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+)
+
+// agingSource describes where the documents of an aged report come from.
+type agingSource struct {
+	table        string
+	numberColumn string
+	dateColumn   string
+	documentType string
+	paymentTable string
+	paymentRefID string
+	returnType   string
+}
+
+var agingSources = map[string]agingSource{
+	models.AGED_RECEIVABLE: {
+		table:        "sales",
+		numberColumn: "sales_number",
+		dateColumn:   "sales_date",
+		documentType: string(models.INVOICE),
+		paymentTable: "sales_payments",
+		paymentRefID: "sales_id",
+		returnType:   "SALES_RETURN",
+	},
+	models.AGED_PAYABLE: {
+		table:        "purchase_orders",
+		numberColumn: "purchase_number",
+		dateColumn:   "purchase_date",
+		documentType: string(models.BILL),
+		paymentTable: "purchase_payments",
+		paymentRefID: "purchase_id",
+		returnType:   "PURCHASE_RETURN",
+	},
+}
+
+// GetAgedReceivables generates an aged receivables report of the posted sales
+// invoices of a company at the asOf date.
+//
+// The open balance of an invoice is its total less the payments made and the
+// returns released up to the asOf date. Invoices posted against a cash/bank
+// payment account are paid in full at posting and are left out. Balances are bucketed into current,
+// 1-30, 31-60, 61-90 and over 90 days by due date (models.AGING_BY_DUE_DATE,
+// falling back to the invoice date when the invoice has no due date) or by
+// invoice date (models.AGING_BY_INVOICE_DATE), and summed per customer and in
+// total in the functional currency. Each customer lists its open invoices.
+//
+// An empty contactID reports every customer.
+func (s *FinanceReportService) GetAgedReceivables(companyID string, asOf time.Time, agingBy string, contactID string) (*models.AgedReport, error) {
+	return s.agedReport(models.AGED_RECEIVABLE, companyID, asOf, agingBy, contactID)
+}
+
+// GetAgedPayables generates an aged payables report of the posted bills of a
+// company at the asOf date. It works like GetAgedReceivables, with purchase
+// payments and purchase returns reducing the open balances.
+func (s *FinanceReportService) GetAgedPayables(companyID string, asOf time.Time, agingBy string, contactID string) (*models.AgedReport, error) {
+	return s.agedReport(models.AGED_PAYABLE, companyID, asOf, agingBy, contactID)
+}
+
+func (s *FinanceReportService) agedReport(reportType, companyID string, asOf time.Time, agingBy string, contactID string) (*models.AgedReport, error) {
+	source := agingSources[reportType]
+	if agingBy == "" {
+		agingBy = models.AGING_BY_DUE_DATE
+	}
+	if agingBy != models.AGING_BY_DUE_DATE && agingBy != models.AGING_BY_INVOICE_DATE {
+		return nil, errors.New("aging must be by DUE_DATE or INVOICE_DATE")
+	}
+	y, m, d := asOf.Date()
+	asOfDate := time.Date(y, m, d, 0, 0, 0, 0, asOf.Location())
+	until := asOfDate.AddDate(0, 0, 1)
+
+	documents := []struct {
+		ID           string
+		Number       string
+		Date         time.Time
+		DueDate      *time.Time
+		ContactID    *string
+		ContactName  string
+		CurrencyCode string
+		ExchangeRate float64
+		Total        float64
+		AccountType  models.AccountType
+	}{}
+	db := s.db.Table(source.table).
+		Select(source.table+".id, "+source.table+"."+source.numberColumn+" as number, "+source.table+"."+source.dateColumn+" as date, "+
+			source.table+".due_date, "+source.table+".contact_id, contacts.name as contact_name, "+
+			source.table+".currency_code, "+source.table+".exchange_rate, "+source.table+".total, payment_accounts.type as account_type").
+		Joins("LEFT JOIN contacts ON contacts.id = "+source.table+".contact_id").
+		Joins("LEFT JOIN accounts payment_accounts ON payment_accounts.id = "+source.table+".payment_account_id").
+		Where(source.table+".company_id = ?", companyID).
+		Where(source.table+".document_type = ?", source.documentType).
+		Where(source.table+".published_at IS NOT NULL").
+		Where(source.table+"."+source.dateColumn+" < ?", until).
+		Where(source.table + ".deleted_at IS NULL")
+	if contactID != "" {
+		db = db.Where(source.table+".contact_id = ?", contactID)
+	}
+	if err := db.Order(source.table + "." + source.dateColumn + " asc").Scan(&documents).Error; err != nil {
+		return nil, err
+	}
+
+	payments := []struct {
+		RefID  string
+		Amount float64
+	}{}
+	err := s.db.Table(source.paymentTable).
+		Select(source.paymentRefID+" as ref_id, sum(amount) as amount").
+		Where("company_id = ? AND payment_date < ? AND deleted_at IS NULL", companyID, until).
+		Group(source.paymentRefID).
+		Scan(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+	paid := map[string]float64{}
+	for _, v := range payments {
+		paid[v.RefID] = v.Amount
+	}
+
+	// Released returns are booked on the document as negative lines, so its
+	// total already excludes them; returns after the asOf date are added back.
+	returns := []struct {
+		RefID    string
+		Total    float64
+		Returned float64
+	}{}
+	err = s.db.Table("returns").
+		Select("returns.ref_id, sum(return_items.total) as total, sum(CASE WHEN returns.date < ? THEN return_items.total ELSE 0 END) as returned", until).
+		Joins("JOIN return_items ON return_items.return_id = returns.id AND return_items.deleted_at IS NULL").
+		Where("returns.company_id = ? AND returns.return_type = ? AND returns.status = ? AND returns.deleted_at IS NULL", companyID, source.returnType, "RELEASED").
+		Group("returns.ref_id").
+		Scan(&returns).Error
+	if err != nil {
+		return nil, err
+	}
+	returnTotals := map[string]money.Amount{}
+	returned := map[string]money.Amount{}
+	for _, v := range returns {
+		returnTotals[v.RefID] = money.FromFloat(v.Total)
+		returned[v.RefID] = money.FromFloat(v.Returned)
+	}
+
+	rounding := models.GetCompanyRounding(s.db, &companyID)
+	report := models.AgedReport{
+		Type:     reportType,
+		AgingBy:  agingBy,
+		AsOf:     asOfDate,
+		Contacts: []models.AgedContact{},
+	}
+	summary := agingTotals{}
+	contacts := map[string]*models.AgedContact{}
+	contactTotals := map[string]*agingTotals{}
+	for _, v := range documents {
+		total := money.FromFloat(v.Total).Add(returnTotals[v.ID])
+		balance := openBalance(v.AccountType, total, returned[v.ID], money.FromFloat(paid[v.ID]))
+		if balance.IsZero() {
+			continue
+		}
+		rate := v.ExchangeRate
+		if rate <= 0 {
+			rate = 1
+		}
+		functional := rounding.Document(balance.Mul(rate))
+
+		agingDate := v.Date
+		if agingBy == models.AGING_BY_DUE_DATE && v.DueDate != nil {
+			agingDate = *v.DueDate
+		}
+		days := agingDays(asOfDate, agingDate)
+		bucket := agingBucket(days)
+
+		key := ""
+		if v.ContactID != nil {
+			key = *v.ContactID
+		}
+		contact, ok := contacts[key]
+		if !ok {
+			contact = &models.AgedContact{
+				ContactID:   v.ContactID,
+				ContactName: v.ContactName,
+				Documents:   []models.AgedDocument{},
+			}
+			contacts[key] = contact
+			contactTotals[key] = &agingTotals{}
+		}
+		contact.Documents = append(contact.Documents, models.AgedDocument{
+			ID:                v.ID,
+			Number:            v.Number,
+			Date:              v.Date,
+			DueDate:           v.DueDate,
+			CurrencyCode:      v.CurrencyCode,
+			ExchangeRate:      rate,
+			Total:             total.Float64(),
+			Paid:              paid[v.ID],
+			Returned:          returned[v.ID].Float64(),
+			Balance:           balance.Float64(),
+			FunctionalBalance: functional.Float64(),
+			DaysOutstanding:   days,
+			Bucket:            bucket,
+		})
+		contactTotals[key].add(bucket, functional)
+		summary.add(bucket, functional)
+	}
+
+	for key, contact := range contacts {
+		contact.Buckets = contactTotals[key].buckets()
+		sort.SliceStable(contact.Documents, func(i, j int) bool {
+			return contact.Documents[i].DaysOutstanding > contact.Documents[j].DaysOutstanding
+		})
+		report.Contacts = append(report.Contacts, *contact)
+	}
+	sort.Slice(report.Contacts, func(i, j int) bool {
+		a, b := report.Contacts[i], report.Contacts[j]
+		if a.ContactName != b.ContactName {
+			return a.ContactName < b.ContactName
+		}
+		return a.ContactID != nil && (b.ContactID == nil || *a.ContactID < *b.ContactID)
+	})
+	report.Summary = summary.buckets()
+	return &report, nil
+}
+
+// openBalance returns the part of a document total that is neither returned nor
+// paid. A document posted against a cash/bank (ASSET) payment account is settled
+// at posting without a payment record, so nothing of it is open.
+func openBalance(paymentAccountType models.AccountType, total, returned, paid money.Amount) money.Amount {
+	if paymentAccountType == models.ASSET {
+		return 0
+	}
+	return total.Sub(returned).Sub(paid)
+}
+
+// agingTotals accumulates the buckets of an aged report exactly.
+type agingTotals struct {
+	current, days1To30, days31To60, days61To90, over90 money.Amount
+}
+
+func (t *agingTotals) add(bucket string, amount money.Amount) {
+	switch bucket {
+	case models.AGING_CURRENT:
+		t.current = t.current.Add(amount)
+	case models.AGING_1_30:
+		t.days1To30 = t.days1To30.Add(amount)
+	case models.AGING_31_60:
+		t.days31To60 = t.days31To60.Add(amount)
+	case models.AGING_61_90:
+		t.days61To90 = t.days61To90.Add(amount)
+	default:
+		t.over90 = t.over90.Add(amount)
+	}
+}
+
+func (t agingTotals) buckets() models.AgingBuckets {
+	return models.AgingBuckets{
+		Current:    t.current.Float64(),
+		Days1To30:  t.days1To30.Float64(),
+		Days31To60: t.days31To60.Float64(),
+		Days61To90: t.days61To90.Float64(),
+		Over90:     t.over90.Float64(),
+		Total:      money.Sum(t.current, t.days1To30, t.days31To60, t.days61To90, t.over90).Float64(),
+	}
+}
+
+// agingDays returns the number of whole days from date to asOf.
+func agingDays(asOf, date time.Time) int {
+	y, m, d := date.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, asOf.Location())
+	return int(math.Round(asOf.Sub(day).Hours() / 24))
+}
+
+func agingBucket(days int) string {
+	switch {
+	case days <= 0:
+		return models.AGING_CURRENT
+	case days <= 30:
+		return models.AGING_1_30
+	case days <= 60:
+		return models.AGING_31_60
+	case days <= 90:
+		return models.AGING_61_90
+	}
+	return models.AGING_OVER_90
+}
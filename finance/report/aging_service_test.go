@@ -0,0 +1,54 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+)
+
+func TestOpenBalance(t *testing.T) {
+	var tests = []struct {
+		name        string
+		accountType models.AccountType
+		total       float64
+		returned    float64
+		paid        float64
+		want        float64
+	}{
+		{"credit invoice", models.RECEIVABLE, 1000, 0, 0, 1000},
+		{"partly paid invoice", models.RECEIVABLE, 1000, 0, 400, 600},
+		{"returned invoice", models.RECEIVABLE, 1000, 250, 400, 350},
+		{"credit bill", models.LIABILITY, 500, 0, 200, 300},
+		{"cash invoice", models.ASSET, 1000, 0, 0, 0},
+		{"returned cash invoice", models.ASSET, 1000, 250, 0, 0},
+	}
+
+	for _, test := range tests {
+		got := openBalance(test.accountType, money.FromFloat(test.total), money.FromFloat(test.returned), money.FromFloat(test.paid))
+		if got != money.FromFloat(test.want) {
+			t.Errorf("%s: openBalance = %s, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAgingBucket(t *testing.T) {
+	var tests = []struct {
+		days int
+		want string
+	}{
+		{-5, models.AGING_CURRENT},
+		{0, models.AGING_CURRENT},
+		{1, models.AGING_1_30},
+		{30, models.AGING_1_30},
+		{31, models.AGING_31_60},
+		{61, models.AGING_61_90},
+		{91, models.AGING_OVER_90},
+	}
+
+	for _, test := range tests {
+		if got := agingBucket(test.days); got != test.want {
+			t.Errorf("agingBucket(%d) = %s, want %s", test.days, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package report
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+)
+
+// ComparativeColumns returns the columns of a comparative report for the report
+// range: a column per month (models.COMPARE_MONTHLY), or the range and the range it
+// is compared with (models.COMPARE_PRIOR_PERIOD, models.COMPARE_PRIOR_YEAR and
+// models.COMPARE_YEAR_TO_DATE). The compared column is marked IsComparison.
+//
+// A range from the first to the last day of months is compared with the same number
+// of whole months; any other range with the same number of days.
+func ComparativeColumns(mode string, startDate, endDate time.Time) ([]models.ComparativeColumn, error) {
+	if endDate.Before(startDate) {
+		return nil, errors.New("end date is before start date")
+	}
+	switch mode {
+	case models.COMPARE_MONTHLY:
+		columns := []models.ComparativeColumn{}
+		month := time.Date(startDate.Year(), startDate.Month(), 1, 0, 0, 0, 0, startDate.Location())
+		for !month.After(endDate) {
+			column := models.ComparativeColumn{
+				StartDate: month,
+				EndDate:   endOfMonth(month, endDate),
+			}
+			if column.StartDate.Before(startDate) {
+				column.StartDate = startDate
+			}
+			if column.EndDate.After(endDate) {
+				column.EndDate = endDate
+			}
+			column.Label = columnLabel(column.StartDate, column.EndDate)
+			columns = append(columns, column)
+			month = month.AddDate(0, 1, 0)
+		}
+		return columns, nil
+	case models.COMPARE_PRIOR_PERIOD:
+		var priorStart, priorEnd time.Time
+		if startDate.Day() == 1 && isMonthEnd(endDate) {
+			months := (endDate.Year()-startDate.Year())*12 + int(endDate.Month()-startDate.Month()) + 1
+			priorStart = startDate.AddDate(0, -months, 0)
+			priorEnd = endOfMonth(startDate.AddDate(0, -1, 0), endDate)
+		} else {
+			days := int(dateOnly(endDate).Sub(dateOnly(startDate)).Hours()/24) + 1
+			priorStart = startDate.AddDate(0, 0, -days)
+			priorEnd = endDate.AddDate(0, 0, -days)
+		}
+		return comparedColumns(startDate, endDate, priorStart, priorEnd), nil
+	case models.COMPARE_PRIOR_YEAR:
+		return comparedColumns(startDate, endDate, previousYear(startDate), previousYear(endDate)), nil
+	case models.COMPARE_YEAR_TO_DATE:
+		yearStart := time.Date(endDate.Year(), 1, 1, 0, 0, 0, 0, endDate.Location())
+		return comparedColumns(yearStart, endDate, yearStart.AddDate(-1, 0, 0), previousYear(endDate)), nil
+	}
+	return nil, errors.New("unknown comparison: " + mode)
+}
+
+// GenerateComparativeProfitLoss generates the profit and loss report for every
+// column and puts the accounts and totals of GenerateProfitLossReport side by
+// side. The dimensions of the report filter every column; GroupBy is ignored.
+func (s *FinanceReportService) GenerateComparativeProfitLoss(report models.GeneralReport, columns []models.ComparativeColumn) (*models.ComparativeReport, error) {
+	builder := newComparativeBuilder(report, models.COMPARATIVE_PROFIT_LOSS, columns)
+	for i, column := range columns {
+		sub := report
+		sub.StartDate = column.StartDate
+		sub.EndDate = column.EndDate
+		sub.GroupBy = ""
+		profitLoss, err := s.GenerateProfitLossReport(sub)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range profitLoss.Profit {
+			builder.add(i, models.ComparativeRow{Section: "profit", ID: v.ID, Code: v.Code, Name: v.Name, Link: v.Link}, v.Sum)
+		}
+		builder.add(i, models.ComparativeRow{Section: "gross_profit", Name: "Laba Kotor", IsTotal: true}, profitLoss.GrossProfit)
+		for _, v := range profitLoss.Loss {
+			builder.add(i, models.ComparativeRow{Section: "loss", ID: v.ID, Code: v.Code, Name: v.Name, Link: v.Link}, v.Sum)
+		}
+		builder.add(i, models.ComparativeRow{Section: "total_expense", Name: "Total Beban", IsTotal: true}, profitLoss.TotalExpense)
+		builder.add(i, models.ComparativeRow{Section: "net_profit", Name: "Laba Bersih", IsTotal: true}, profitLoss.NetProfit)
+	}
+	return builder.build(), nil
+}
+
+// GenerateComparativeBalanceSheet generates the balance sheet at the end date of
+// every column and puts the accounts and totals of GenerateBalanceSheet side by
+// side.
+func (s *FinanceReportService) GenerateComparativeBalanceSheet(report models.GeneralReport, columns []models.ComparativeColumn) (*models.ComparativeReport, error) {
+	builder := newComparativeBuilder(report, models.COMPARATIVE_BALANCE_SHEET, columns)
+	for i, column := range columns {
+		sub := report
+		sub.StartDate = column.StartDate
+		sub.EndDate = column.EndDate
+		sub.GroupBy = ""
+		balanceSheet, err := s.GenerateBalanceSheet(sub)
+		if err != nil {
+			return nil, err
+		}
+		sections := []struct {
+			section  string
+			accounts []models.BalanceSheetAccount
+			total    string
+			sum      float64
+		}{
+			{"fixed_assets", balanceSheet.FixedAssets, "Total Aset Tetap", balanceSheet.TotalFixed},
+			{"current_assets", balanceSheet.CurrentAssets, "Total Aset Lancar", balanceSheet.TotalCurrent},
+			{"total_assets", nil, "Total Aset", balanceSheet.TotalAssets},
+			{"liabilities", balanceSheet.LiableAssets, "Total Liabilitas", balanceSheet.TotalLiability},
+			{"equity", balanceSheet.Equity, "Total Ekuitas", balanceSheet.TotalEquity},
+			{"total_liabilities_and_equity", nil, "Total Liabilitas dan Ekuitas", balanceSheet.TotalLiabilitiesAndEquity},
+		}
+		for _, section := range sections {
+			for _, v := range section.accounts {
+				builder.add(i, models.ComparativeRow{Section: section.section, ID: v.ID, Code: v.Code, Name: v.Name, Link: v.Link}, v.Sum)
+			}
+			builder.add(i, models.ComparativeRow{Section: section.section, Name: section.total, IsTotal: true}, section.sum)
+		}
+	}
+	return builder.build(), nil
+}
+
+// GenerateComparativeCashFlow generates the cash flow report for every column
+// with the groups of the given report and puts the groups and the totals of
+// GenerateCashFlowReport side by side.
+func (s *FinanceReportService) GenerateComparativeCashFlow(cashFlow models.CashFlowReport, columns []models.ComparativeColumn) (*models.ComparativeReport, error) {
+	builder := newComparativeBuilder(cashFlow.GeneralReport, models.COMPARATIVE_CASH_FLOW, columns)
+	for i, column := range columns {
+		sub := cashFlow
+		sub.StartDate = column.StartDate
+		sub.EndDate = column.EndDate
+		sub.Operating = append([]models.CashflowSubGroup{}, cashFlow.Operating...)
+		sub.Investing = append([]models.CashflowSubGroup{}, cashFlow.Investing...)
+		sub.Financing = append([]models.CashflowSubGroup{}, cashFlow.Financing...)
+		result, err := s.GenerateCashFlowReport(sub)
+		if err != nil {
+			return nil, err
+		}
+		sections := []struct {
+			section string
+			groups  []models.CashflowSubGroup
+			total   string
+			sum     float64
+		}{
+			{"operating", result.Operating, "Arus Kas dari Aktivitas Operasi", result.TotalOperating},
+			{"investing", result.Investing, "Arus Kas dari Aktivitas Investasi", result.TotalInvesting},
+			{"financing", result.Financing, "Arus Kas dari Aktivitas Pendanaan", result.TotalFinancing},
+		}
+		for _, section := range sections {
+			for _, v := range section.groups {
+				builder.add(i, models.ComparativeRow{Section: section.section, ID: v.Name, Name: v.Description}, v.Amount)
+			}
+			builder.add(i, models.ComparativeRow{Section: section.section, Name: section.total, IsTotal: true}, section.sum)
+		}
+		net := money.Sum(money.FromFloat(result.TotalOperating), money.FromFloat(result.TotalInvesting), money.FromFloat(result.TotalFinancing))
+		builder.add(i, models.ComparativeRow{Section: "net_cash_flow", Name: "Kenaikan (Penurunan) Kas Bersih", IsTotal: true}, net.Float64())
+	}
+	return builder.build(), nil
+}
+
+// comparativeBuilder collects the rows of the single period reports into the
+// rows of a comparative report, in the order they first appear.
+type comparativeBuilder struct {
+	report models.ComparativeReport
+	index  map[string]int
+}
+
+func newComparativeBuilder(report models.GeneralReport, name string, columns []models.ComparativeColumn) *comparativeBuilder {
+	return &comparativeBuilder{
+		report: models.ComparativeReport{
+			GeneralReport: report,
+			Report:        name,
+			Columns:       columns,
+			Rows:          []models.ComparativeRow{},
+		},
+		index: map[string]int{},
+	}
+}
+
+func (b *comparativeBuilder) add(column int, row models.ComparativeRow, value float64) {
+	key := row.Section + "|" + row.ID
+	if row.ID == "" {
+		key += "|" + row.Name
+	}
+	i, ok := b.index[key]
+	if !ok {
+		row.Values = make([]float64, len(b.report.Columns))
+		b.report.Rows = append(b.report.Rows, row)
+		i = len(b.report.Rows) - 1
+		b.index[key] = i
+	}
+	b.report.Rows[i].Values[column] = value
+}
+
+func (b *comparativeBuilder) build() *models.ComparativeReport {
+	compared := -1
+	for i, v := range b.report.Columns {
+		if v.IsComparison {
+			compared = i
+			break
+		}
+	}
+	if compared > 0 {
+		for i, row := range b.report.Rows {
+			base := row.Values[compared]
+			variance := money.FromFloat(row.Values[0]).Sub(money.FromFloat(base)).Float64()
+			b.report.Rows[i].Variance = &variance
+			if base != 0 {
+				percent := utils.AmountRound(variance/math.Abs(base)*100, 2)
+				b.report.Rows[i].VariancePercent = &percent
+			}
+		}
+	}
+	return &b.report
+}
+
+func comparedColumns(startDate, endDate, priorStart, priorEnd time.Time) []models.ComparativeColumn {
+	return []models.ComparativeColumn{
+		{Label: columnLabel(startDate, endDate), StartDate: startDate, EndDate: endDate},
+		{Label: columnLabel(priorStart, priorEnd), StartDate: priorStart, EndDate: priorEnd, IsComparison: true},
+	}
+}
+
+// columnLabel names a column after its month or year when it covers one whole,
+// and after its dates otherwise.
+func columnLabel(startDate, endDate time.Time) string {
+	if startDate.Day() == 1 && isMonthEnd(endDate) {
+		if startDate.Year() == endDate.Year() && startDate.Month() == endDate.Month() {
+			return startDate.Format("Jan 2006")
+		}
+		if startDate.Month() == time.January && endDate.Month() == time.December && startDate.Year() == endDate.Year() {
+			return startDate.Format("2006")
+		}
+	}
+	return startDate.Format("02/01/2006") + " - " + endDate.Format("02/01/2006")
+}
+
+// endOfMonth returns the last day of the month of t at the clock time of clock,
+// so month columns end at the same time of day as the report range.
+func endOfMonth(t time.Time, clock time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 0, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), t.Location())
+}
+
+func isMonthEnd(t time.Time) bool {
+	return t.AddDate(0, 0, 1).Day() == 1
+}
+
+// previousYear returns the same day a year earlier, keeping the end of February
+// at the end of February.
+func previousYear(t time.Time) time.Time {
+	if isMonthEnd(t) {
+		return endOfMonth(time.Date(t.Year()-1, t.Month(), 1, 0, 0, 0, 0, t.Location()), t)
+	}
+	return t.AddDate(-1, 0, 0)
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
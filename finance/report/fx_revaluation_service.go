@@ -0,0 +1,395 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// RevaluateForeignCurrency revalues the open foreign currency balances of a company at the given date.
+//
+// It covers open receivables from posted sales invoices, open payables from posted bills, and
+// asset accounts held in a foreign currency. Each balance is converted with the rate on the given
+// date and the difference against its booked functional amount is posted as unrealized FX gain or
+// loss to the account flagged with is_unrealized_fx_account. Every posting is reversed on the next
+// day, so the following period starts again from the booked amounts.
+//
+// Only one revaluation can be made per company and date. The function returns the saved
+// revaluation with its details, or an error if any of the operations fail.
+func (s *FinanceReportService) RevaluateForeignCurrency(companyID string, date time.Time, userID *string, notes string) (*models.FxRevaluationModel, error) {
+	if s.currencyService == nil {
+		return nil, errors.New("currency service is not initialized")
+	}
+
+	if err := period.Check(s.db, &companyID, "fx-revaluation", date); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	s.db.Model(&models.FxRevaluationModel{}).Where("company_id = ? AND date = ?", companyID, date).Count(&count)
+	if count > 0 {
+		return nil, errors.New("revaluation already exists for this date")
+	}
+
+	var fxAccount models.AccountModel
+	err := s.db.Where("is_unrealized_fx_account = ? and company_id = ?", true, companyID).First(&fxAccount).Error
+	if err != nil {
+		return nil, errors.New("unrealized fx account not found")
+	}
+
+	functional := s.currencyService.GetFunctionalCurrency(companyID)
+	lines := []models.FxRevaluationLine{}
+
+	receivables, err := s.getReceivableRevaluation(companyID, functional, date)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, receivables...)
+
+	payables, err := s.getPayableRevaluation(companyID, functional, date)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, payables...)
+
+	banks, err := s.getBankRevaluation(companyID, functional, date)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, banks...)
+
+	revaluation := models.FxRevaluationModel{
+		BaseModel:    shared.BaseModel{ID: utils.Uuid()},
+		CompanyID:    &companyID,
+		UserID:       userID,
+		Date:         date,
+		ReversalDate: date.AddDate(0, 0, 1),
+		Notes:        notes,
+		Status:       "POSTED",
+		Details:      lines,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var totalGain, totalLoss money.Amount
+		for _, line := range lines {
+			if line.Difference > 0 {
+				totalGain = totalGain.Add(money.FromFloat(line.Difference))
+			} else {
+				totalLoss = totalLoss.Sub(money.FromFloat(line.Difference))
+			}
+			err := s.createFxRevaluationPair(tx, &revaluation, line, fxAccount.ID, revaluation.Date, false)
+			if err != nil {
+				return err
+			}
+			err = s.createFxRevaluationPair(tx, &revaluation, line, fxAccount.ID, revaluation.ReversalDate, true)
+			if err != nil {
+				return err
+			}
+		}
+
+		b, err := json.Marshal(lines)
+		if err != nil {
+			return err
+		}
+		detailData := string(b)
+		revaluation.DetailData = &detailData
+		revaluation.TotalGain = totalGain.Float64()
+		revaluation.TotalLoss = totalLoss.Float64()
+		return tx.Create(&revaluation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &revaluation, nil
+}
+
+// getReceivableRevaluation returns the revaluation lines of open foreign currency sales invoices.
+func (s *FinanceReportService) getReceivableRevaluation(companyID, functional string, date time.Time) ([]models.FxRevaluationLine, error) {
+	var sales []models.SalesModel
+	err := s.db.Preload("PaymentAccount").
+		Where("company_id = ? AND document_type = ? AND published_at IS NOT NULL AND sales_date <= ?", companyID, models.INVOICE, date).
+		Where("currency_code <> '' AND currency_code <> ?", functional).
+		Find(&sales).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []models.FxRevaluationLine{}
+	for _, v := range sales {
+		if v.PaymentAccountID == nil || v.PaymentAccount == nil || v.PaymentAccount.Type != models.RECEIVABLE {
+			continue
+		}
+		amount := struct {
+			Sum float64 `sql:"sum"`
+		}{}
+		err := s.db.Model(&models.SalesPaymentModel{}).
+			Where("sales_id = ? AND payment_date <= ?", v.ID, date).
+			Select("sum(amount)").Scan(&amount).Error
+		if err != nil {
+			return nil, err
+		}
+		line, err := s.revaluationLine(companyID, v.CurrencyCode, v.ExchangeRate, v.Total-amount.Sum, date)
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			continue
+		}
+		line.RefID = v.ID
+		line.RefType = "sales"
+		line.RefNumber = v.SalesNumber
+		line.AccountID = *v.PaymentAccountID
+		lines = append(lines, *line)
+	}
+	return lines, nil
+}
+
+// getPayableRevaluation returns the revaluation lines of open foreign currency bills.
+//
+// A higher rate increases the payable, so the difference is negated to keep a gain positive.
+func (s *FinanceReportService) getPayableRevaluation(companyID, functional string, date time.Time) ([]models.FxRevaluationLine, error) {
+	var purchases []models.PurchaseOrderModel
+	err := s.db.Preload("PaymentAccount").
+		Where("company_id = ? AND document_type = ? AND published_at IS NOT NULL AND purchase_date <= ?", companyID, models.BILL, date).
+		Where("currency_code <> '' AND currency_code <> ?", functional).
+		Find(&purchases).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []models.FxRevaluationLine{}
+	for _, v := range purchases {
+		if v.PaymentAccountID == nil || v.PaymentAccount == nil || v.PaymentAccount.Type != models.LIABILITY {
+			continue
+		}
+		amount := struct {
+			Sum float64 `sql:"sum"`
+		}{}
+		err := s.db.Model(&models.PurchasePaymentModel{}).
+			Where("purchase_id = ? AND payment_date <= ?", v.ID, date).
+			Select("sum(amount)").Scan(&amount).Error
+		if err != nil {
+			return nil, err
+		}
+		line, err := s.revaluationLine(companyID, v.CurrencyCode, v.ExchangeRate, v.Total-amount.Sum, date)
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			continue
+		}
+		line.RefID = v.ID
+		line.RefType = "purchase"
+		line.RefNumber = v.PurchaseNumber
+		line.AccountID = *v.PaymentAccountID
+		line.Difference = -line.Difference
+		lines = append(lines, *line)
+	}
+	return lines, nil
+}
+
+// getBankRevaluation returns the revaluation lines of asset accounts held in a foreign currency.
+//
+// The foreign balance is the sum of the foreign amounts posted to the account, while the booked
+// amount is the functional balance including earlier revaluations and their reversals.
+func (s *FinanceReportService) getBankRevaluation(companyID, functional string, date time.Time) ([]models.FxRevaluationLine, error) {
+	var accounts []models.AccountModel
+	err := s.db.Where("company_id = ? AND type = ?", companyID, models.ASSET).
+		Where("currency_code <> '' AND currency_code <> ?", functional).
+		Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+	rounding := models.GetCompanyRounding(s.db, &companyID)
+
+	lines := []models.FxRevaluationLine{}
+	for _, v := range accounts {
+		balance := struct {
+			ForeignBalance float64 `sql:"foreign_balance"`
+			BookedBalance  float64 `sql:"booked_balance"`
+		}{}
+		err := s.ledger().
+			Select("sum(case when debit > 0 then abs(foreign_amount) else -abs(foreign_amount) end) as foreign_balance, sum(debit - credit) as booked_balance").
+			Where("account_id = ? AND company_id = ? AND date <= ?", v.ID, companyID, date).
+			Scan(&balance).Error
+		if err != nil {
+			return nil, err
+		}
+		if balance.ForeignBalance == 0 {
+			continue
+		}
+		rate, err := s.currencyService.GetRate(companyID, v.CurrencyCode, date)
+		if err != nil {
+			return nil, err
+		}
+		revalued := exact(rounding, money.FromFloat(balance.ForeignBalance).Mul(rate).Float64())
+		difference := revalued.Sub(exact(rounding, balance.BookedBalance))
+		if difference.IsZero() {
+			continue
+		}
+		lines = append(lines, models.FxRevaluationLine{
+			RefID:          v.ID,
+			RefType:        "account",
+			RefNumber:      v.Code,
+			AccountID:      v.ID,
+			CurrencyCode:   v.CurrencyCode,
+			ForeignBalance: balance.ForeignBalance,
+			BookedRate:     balance.BookedBalance / balance.ForeignBalance,
+			BookedAmount:   balance.BookedBalance,
+			Rate:           rate,
+			RevaluedAmount: revalued.Float64(),
+			Difference:     difference.Float64(),
+		})
+	}
+	return lines, nil
+}
+
+// revaluationLine converts an open foreign balance at the booked rate and at the rate on the
+// given date. It returns nil when there is nothing to revalue.
+func (s *FinanceReportService) revaluationLine(companyID, currencyCode string, bookedRate, openAmount float64, date time.Time) (*models.FxRevaluationLine, error) {
+	if openAmount <= 0 {
+		return nil, nil
+	}
+	if bookedRate <= 0 {
+		bookedRate = 1
+	}
+	rate, err := s.currencyService.GetRate(companyID, currencyCode, date)
+	if err != nil {
+		return nil, err
+	}
+	rounding := models.GetCompanyRounding(s.db, &companyID)
+	booked := rounding.Document(money.FromFloat(openAmount).Mul(bookedRate))
+	revalued := rounding.Document(money.FromFloat(openAmount).Mul(rate))
+	difference := revalued.Sub(booked)
+	if difference.IsZero() {
+		return nil, nil
+	}
+	return &models.FxRevaluationLine{
+		CurrencyCode:   currencyCode,
+		ForeignBalance: openAmount,
+		BookedRate:     bookedRate,
+		BookedAmount:   booked.Float64(),
+		Rate:           rate,
+		RevaluedAmount: revalued.Float64(),
+		Difference:     difference.Float64(),
+	}, nil
+}
+
+// createFxRevaluationPair posts a revaluation line as a pair of transactions on the revalued
+// account and the unrealized FX account. A gain credits the FX account and a loss debits it;
+// the reversal swaps both sides.
+func (s *FinanceReportService) createFxRevaluationPair(tx *gorm.DB, revaluation *models.FxRevaluationModel, line models.FxRevaluationLine, fxAccountID string, date time.Time, isReversal bool) error {
+	amount := math.Abs(line.Difference)
+	fxCredit := line.Difference > 0
+	if isReversal {
+		fxCredit = !fxCredit
+	}
+	description := "Revaluasi Selisih Kurs " + line.RefNumber
+	if isReversal {
+		description = "Pembalikan Revaluasi Selisih Kurs " + line.RefNumber
+	}
+
+	code := utils.RandString(10, false)
+	accountTransID := utils.Uuid()
+	fxTransID := utils.Uuid()
+
+	accountTrans := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: accountTransID},
+		Code:                        code,
+		Date:                        date,
+		AccountID:                   &line.AccountID,
+		Description:                 description,
+		Notes:                       revaluation.Notes,
+		TransactionRefID:            &fxTransID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &revaluation.ID,
+		TransactionSecondaryRefType: "fx-revaluation",
+		CompanyID:                   revaluation.CompanyID,
+		UserID:                      revaluation.UserID,
+		Amount:                      amount,
+		CurrencyCode:                line.CurrencyCode,
+		ExchangeRate:                line.Rate,
+		IsFxDifference:              true,
+	}
+	fxTrans := accountTrans
+	fxTrans.ID = fxTransID
+	fxTrans.AccountID = &fxAccountID
+	fxTrans.TransactionRefID = &accountTransID
+
+	if fxCredit {
+		accountTrans.Debit = amount
+		fxTrans.Credit = amount
+	} else {
+		accountTrans.Credit = amount
+		fxTrans.Debit = amount
+	}
+
+	if err := tx.Create(&accountTrans).Error; err != nil {
+		return err
+	}
+	return tx.Create(&fxTrans).Error
+}
+
+// GetFxRevaluations retrieves a paginated list of foreign currency revaluations.
+//
+// The result is filtered by the company ID in the request header.
+func (s *FinanceReportService) GetFxRevaluations(request http.Request) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Model(&models.FxRevaluationModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	stmt = stmt.Order("date desc")
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.FxRevaluationModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// GetFxRevaluationByID retrieves a foreign currency revaluation by its ID, including the
+// transactions it posted.
+func (s *FinanceReportService) GetFxRevaluationByID(id string) (*models.FxRevaluationModel, error) {
+	var revaluation models.FxRevaluationModel
+	if err := s.db.Where("id = ?", id).First(&revaluation).Error; err != nil {
+		return nil, err
+	}
+	err := s.db.Preload("Account").
+		Where("transaction_secondary_ref_id = ? AND transaction_secondary_ref_type = ?", id, "fx-revaluation").
+		Order("date asc").
+		Find(&revaluation.Transactions).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revaluation, nil
+}
+
+// DeleteFxRevaluation deletes a foreign currency revaluation together with its postings and
+// their reversals.
+func (s *FinanceReportService) DeleteFxRevaluation(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var revaluation models.FxRevaluationModel
+		if err := tx.Where("id = ?", id).First(&revaluation).Error; err != nil {
+			return err
+		}
+		if err := period.Check(tx, revaluation.CompanyID, "fx-revaluation", revaluation.Date); err != nil {
+			return err
+		}
+		err := tx.Where("transaction_secondary_ref_id = ? AND transaction_secondary_ref_type = ?", id, "fx-revaluation").
+			Delete(&models.TransactionModel{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.FxRevaluationModel{}).Error
+	})
+}
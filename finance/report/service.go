@@ -12,11 +12,15 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/contact"
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance/account"
+	"github.com/AMETORY/ametory-erp-modules/finance/balance"
+	"github.com/AMETORY/ametory-erp-modules/finance/currency"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	"github.com/AMETORY/ametory-erp-modules/finance/transaction"
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/constants"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
 )
@@ -27,6 +31,8 @@ type FinanceReportService struct {
 	accountService     *account.AccountService
 	transactionService *transaction.TransactionService
 	contactService     *contact.ContactService
+	currencyService    *currency.CurrencyService
+	balanceService     *balance.BalanceService
 }
 
 // NewFinanceReportService returns a new instance of FinanceReportService.
@@ -55,7 +61,7 @@ func NewFinanceReportService(db *gorm.DB, ctx *context.ERPContext, accountServic
 //
 // The function returns an error if the migration fails.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.ClosingBook{})
+	return db.AutoMigrate(&models.ClosingBook{}, &models.FxRevaluationModel{})
 }
 
 // SetContactService sets the contact service for the FinanceReportService.
@@ -69,6 +75,126 @@ func (s *FinanceReportService) SetContactService(contactService *contact.Contact
 	s.contactService = contactService
 }
 
+// ledger returns a query on the transactions that make up the ledger.
+//
+// Lines of draft journals are excluded, so every report only sees posted entries.
+func (s *FinanceReportService) ledger() *gorm.DB {
+	return s.db.Model(&models.TransactionModel{}).Where("transactions.is_draft = ?", false)
+}
+
+// dimensionLedger returns the ledger filtered by the given analytic dimensions.
+func (s *FinanceReportService) dimensionLedger(dimensions models.AnalyticDimensions) *gorm.DB {
+	return s.ledger().Scopes(dimensions.ScopeTransactions)
+}
+
+// dimensionGroups returns the values of the groupBy dimension found on the
+// ledger lines of the company up to the end date, and from the start date when
+// given. Lines without the dimension make up a group with a nil ID. Scopes
+// narrow the ledger lines further down. The groupBy dimension must be an active
+// dimension of the company.
+func (s *FinanceReportService) dimensionGroups(companyID string, groupBy string, dimensions models.AnalyticDimensions, startDate *time.Time, endDate time.Time, scopes ...func(*gorm.DB) *gorm.DB) ([]models.DimensionGroup, error) {
+	dimension, err := models.GetCompanyAnalyticDimensionType(s.db, companyID, groupBy)
+	if err != nil {
+		return nil, err
+	}
+	var ids []*string
+	db := s.dimensionLedger(dimensions).
+		Where("transactions.company_id = ?", companyID).
+		Where("transactions.date <= ?", endDate)
+	if startDate != nil {
+		db = db.Where("transactions.date >= ?", startDate)
+	}
+	if err := db.Scopes(scopes...).Distinct("transactions."+dimension.Column).Pluck(dimension.Column, &ids).Error; err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		ID   string
+		Name string
+	}{}
+	err = s.db.Table(dimension.Table).Select("id, name").Where("id IN (?)", ids).Order("name asc").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	groups := []models.DimensionGroup{}
+	named := map[string]bool{}
+	for _, v := range rows {
+		id := v.ID
+		groups = append(groups, models.DimensionGroup{Dimension: dimension.Name, ID: &id, Name: v.Name})
+		named[id] = true
+	}
+	hasUnassigned := false
+	for _, id := range ids {
+		if id == nil {
+			hasUnassigned = true
+		} else if !named[*id] {
+			groups = append(groups, models.DimensionGroup{Dimension: dimension.Name, ID: id})
+		}
+	}
+	if hasUnassigned {
+		groups = append(groups, models.DimensionGroup{Dimension: dimension.Name})
+	}
+	return groups, nil
+}
+
+// groupDimensions narrows the dimension filter down to a single group.
+func groupDimensions(dimensions models.AnalyticDimensions, group models.DimensionGroup) models.AnalyticDimensions {
+	value := ""
+	if group.ID != nil {
+		value = *group.ID
+	}
+	dimensions.Set(group.Dimension, &value)
+	return dimensions
+}
+
+// SetCurrencyService sets the currency service for the FinanceReportService.
+//
+// The CurrencyService provides the exchange rates used by the foreign currency
+// revaluation. It must be set before calling RevaluateForeignCurrency.
+func (s *FinanceReportService) SetCurrencyService(currencyService *currency.CurrencyService) {
+	s.currencyService = currencyService
+}
+
+// SetBalanceService sets the balance service for the FinanceReportService.
+//
+// With a BalanceService set, account balances without a dimension filter are
+// read from the balance snapshots and the lines at the edges of the date range.
+func (s *FinanceReportService) SetBalanceService(balanceService *balance.BalanceService) {
+	s.balanceService = balanceService
+}
+
+// accountSum returns the debit and credit of the posted ledger lines of the
+// accounts of a company dated from start and before end, or up to and including
+// end when endInclusive is set. A nil start or end leaves that side open.
+func (s *FinanceReportService) accountSum(companyID string, accountIDs []string, dimensions models.AnalyticDimensions, start, end *time.Time, endInclusive bool) (float64, float64, error) {
+	if s.balanceService != nil && dimensions.IsEmpty() {
+		return s.balanceService.Sum(companyID, accountIDs, start, end, endInclusive)
+	}
+	amount := struct {
+		Credit float64 `sql:"credit"`
+		Debit  float64 `sql:"debit"`
+	}{}
+	if len(accountIDs) == 0 {
+		return 0, 0, nil
+	}
+	db := s.dimensionLedger(dimensions).
+		Select("sum(credit) as credit, sum(debit) as debit").
+		Where("transactions.account_id IN ?", accountIDs).
+		Where("transactions.company_id = ?", companyID)
+	if start != nil {
+		db = db.Where("transactions.date >= ?", *start)
+	}
+	if end != nil {
+		if endInclusive {
+			db = db.Where("transactions.date <= ?", *end)
+		} else {
+			db = db.Where("transactions.date < ?", *end)
+		}
+	}
+	err := db.Scan(&amount).Error
+	return amount.Debit, amount.Credit, err
+}
+
 // GenerateProfitLoss generates a profit loss report for a given period.
 //
 // The function takes a `models.ProfitLoss` struct as an argument, which contains
@@ -90,6 +216,9 @@ func (s *FinanceReportService) GenerateProfitLoss(report *models.ProfitLoss) err
 // balance calculations. The function returns a populated AccountReport and an error
 // if the operation fails.
 //
+// The branch_id, project_id and department_id query parameters filter the transactions
+// by analytic dimension, and group_by breaks the report down per value of a dimension.
+//
 // Parameters:
 //   - accountID: the ID of the account for which the report is generated.
 //   - companyID: a pointer to the company ID associated with the account.
@@ -130,9 +259,43 @@ func (s *FinanceReportService) GenerateAccountReport(accountID string, companyID
 	startDate = &startDateParsed
 	endDate = &endDateParsed
 
+	dimensions := models.AnalyticDimensionsFromQuery(request.URL.Query())
+	if err := models.CheckAnalyticDimensions(s.db, companyID, dimensions); err != nil {
+		return nil, err
+	}
+	report, err := s.accountReport(account, companyID, startDate, endDate, dimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupBy := request.URL.Query().Get("group_by"); groupBy != "" {
+		if companyID == nil {
+			return nil, fmt.Errorf("company ID is required to group by dimension")
+		}
+		groups, err := s.dimensionGroups(*companyID, groupBy, dimensions, nil, *endDate, func(db *gorm.DB) *gorm.DB {
+			return db.Where("transactions.account_id = ?", account.ID)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			groupReport, err := s.accountReport(account, companyID, startDate, endDate, groupDimensions(dimensions, group))
+			if err != nil {
+				return nil, err
+			}
+			groupReport.Group = &group
+			report.Groups = append(report.Groups, *groupReport)
+		}
+	}
+	return report, nil
+}
+
+// accountReport builds the account report of the transactions matching the
+// analytic dimension filter.
+func (s *FinanceReportService) accountReport(account *models.AccountModel, companyID *string, startDate, endDate *time.Time, dimensions models.AnalyticDimensions) (*models.AccountReport, error) {
 	var balanceCurrent, balanceBefore float64
 	// BEFORE
-	debit, credit, _ := s.GetAccountBalance(accountID, companyID, nil, startDate)
+	debit, credit, _ := s.GetAccountBalanceByDimensions(account.ID, companyID, nil, startDate, dimensions)
 	switch account.Type {
 	case models.EXPENSE, models.COST, models.CONTRA_LIABILITY, models.CONTRA_EQUITY, models.CONTRA_REVENUE, models.RECEIVABLE:
 		balanceCurrent = debit - credit
@@ -144,7 +307,7 @@ func (s *FinanceReportService) GenerateAccountReport(accountID string, companyID
 	balanceBefore = balanceCurrent
 
 	// CURRENT
-	pageCurrent, err := s.GetAccountTransactions(accountID, companyID, startDate, endDate)
+	pageCurrent, err := s.GetAccountTransactionsByDimensions(account.ID, companyID, startDate, endDate, dimensions)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +315,7 @@ func (s *FinanceReportService) GenerateAccountReport(accountID string, companyID
 
 	var balanceAfter float64
 	// AFTER
-	debit, credit, _ = s.GetAccountBalance(accountID, companyID, endDate, nil)
+	debit, credit, _ = s.GetAccountBalanceByDimensions(account.ID, companyID, endDate, nil, dimensions)
 	switch account.Type {
 	case models.EXPENSE, models.COST, models.CONTRA_LIABILITY, models.CONTRA_EQUITY, models.CONTRA_REVENUE, models.RECEIVABLE:
 		balanceAfter = debit - credit
@@ -167,7 +330,7 @@ func (s *FinanceReportService) GenerateAccountReport(accountID string, companyID
 		EndDate:        endDate,
 		Account:        *account,
 		BalanceBefore:  balanceBefore,
-		TotalBalance:   balanceBefore + balance + balanceAfter,
+		TotalBalance:   money.SumFloat(balanceBefore, balance, balanceAfter).Float64(),
 		CurrentBalance: balance,
 		Transactions:   pageCurrent,
 	}, nil
@@ -179,7 +342,7 @@ func (s *FinanceReportService) GenerateAccountReport(accountID string, companyID
 func (s *FinanceReportService) getBalance(page *[]models.TransactionModel, currentBalance *float64, companyID *string) (float64, float64, float64) {
 
 	newItems := make([]models.TransactionModel, 0)
-	var balance, credit, debit float64
+	var balance, credit, debit money.Amount
 	for _, item := range *page {
 		if item.TransactionRefID != nil {
 			if item.TransactionRefType == "journal" {
@@ -232,20 +395,20 @@ func (s *FinanceReportService) getBalance(page *[]models.TransactionModel, curre
 				}
 			}
 		}
-		curBalance := s.getBalanceAmount(item)
-		balance += curBalance
+		curBalance := money.FromFloat(s.getBalanceAmount(item))
+		balance = balance.Add(curBalance)
 		// fmt.Printf("balance %f, currentBalance %f\n", balance, *currentBalance)
-		*currentBalance += curBalance
+		*currentBalance = money.FromFloat(*currentBalance).Add(curBalance).Float64()
 		item.Balance = *currentBalance
-		credit += item.Credit
-		debit += item.Debit
+		credit = credit.Add(money.FromFloat(item.Credit))
+		debit = debit.Add(money.FromFloat(item.Debit))
 
 		newItems = append(newItems, item)
 	}
 
 	*page = newItems
 
-	return balance, credit, debit
+	return balance.Float64(), credit.Float64(), debit.Float64()
 }
 
 // GetAccountBalance retrieves the total debit and credit amounts for a given account,
@@ -255,11 +418,25 @@ func (s *FinanceReportService) getBalance(page *[]models.TransactionModel, curre
 // The company ID is also an optional parameter, and if it is not provided, the
 // function will return the total debit and credit amounts for all companies.
 func (s *FinanceReportService) GetAccountBalance(accountID string, companyID *string, startDate *time.Time, endDate *time.Time) (float64, float64, error) {
+	return s.GetAccountBalanceByDimensions(accountID, companyID, startDate, endDate, models.AnalyticDimensions{})
+}
+
+// GetAccountBalanceByDimensions works like GetAccountBalance, counting only the
+// transactions that match the analytic dimension filter.
+func (s *FinanceReportService) GetAccountBalanceByDimensions(accountID string, companyID *string, startDate *time.Time, endDate *time.Time, dimensions models.AnalyticDimensions) (float64, float64, error) {
+	if companyID != nil {
+		debit, credit, err := s.accountSum(*companyID, []string{accountID}, dimensions, startDate, endDate, false)
+		if err != nil {
+			return 0, 0, err
+		}
+		rounding := models.GetCompanyRounding(s.db, companyID)
+		return exact(rounding, debit).Float64(), exact(rounding, credit).Float64(), nil
+	}
 	amount := struct {
 		Credit float64 `sql:"credit"`
 		Debit  float64 `sql:"debit"`
 	}{}
-	db := s.db.Model(&models.TransactionModel{}).Select("sum(credit) as credit, sum(debit) as debit").Where("account_id = ?", accountID)
+	db := s.dimensionLedger(dimensions).Select("sum(credit) as credit, sum(debit) as debit").Where("account_id = ?", accountID)
 	if startDate != nil {
 		db = db.Where("date >= ?", startDate)
 	}
@@ -274,7 +451,8 @@ func (s *FinanceReportService) GetAccountBalance(accountID string, companyID *st
 		return 0, 0, err
 	}
 
-	return amount.Debit, amount.Credit, nil
+	rounding := models.GetCompanyRounding(s.db, companyID)
+	return exact(rounding, amount.Debit).Float64(), exact(rounding, amount.Credit).Float64(), nil
 }
 
 // GetAccountTransactions retrieves a list of transactions for a given account,
@@ -289,8 +467,14 @@ func (s *FinanceReportService) GetAccountBalance(accountID string, companyID *st
 // The function returns a list of TransactionModel and an error if the
 // operation fails. Otherwise, the error is nil.
 func (s *FinanceReportService) GetAccountTransactions(accountID string, companyID *string, startDate *time.Time, endDate *time.Time) ([]models.TransactionModel, error) {
+	return s.GetAccountTransactionsByDimensions(accountID, companyID, startDate, endDate, models.AnalyticDimensions{})
+}
+
+// GetAccountTransactionsByDimensions works like GetAccountTransactions, returning
+// only the transactions that match the analytic dimension filter.
+func (s *FinanceReportService) GetAccountTransactionsByDimensions(accountID string, companyID *string, startDate *time.Time, endDate *time.Time, dimensions models.AnalyticDimensions) ([]models.TransactionModel, error) {
 	var transactions []models.TransactionModel
-	db := s.db.Preload("Account").Select("transactions.*, accounts.name as account_name").Joins("LEFT JOIN accounts ON accounts.id = transactions.account_id")
+	db := s.dimensionLedger(dimensions).Preload("Account").Select("transactions.*, accounts.name as account_name").Joins("LEFT JOIN accounts ON accounts.id = transactions.account_id")
 
 	if startDate != nil {
 		db = db.Where("transactions.date >= ?", *startDate)
@@ -349,6 +533,9 @@ func (s *FinanceReportService) getBalanceAmount(transaction models.TransactionMo
 // - Inventory Account: the inventory account used in the report
 // - Stock Opname: the difference between the beginning inventory and ending inventory, which is the stock opname amount
 func (s *FinanceReportService) GenerateCogsReport(report models.GeneralReport) (*models.COGSReport, error) {
+	if err := models.CheckAnalyticDimensions(s.db, &report.CompanyID, report.Dimensions); err != nil {
+		return nil, err
+	}
 	var inventoryAccount models.AccountModel
 	err := s.db.Where("is_inventory_account = ? and company_id = ?", true, report.CompanyID).First(&inventoryAccount).Error
 	if err != nil {
@@ -366,22 +553,18 @@ func (s *FinanceReportService) GenerateCogsReport(report models.GeneralReport) (
 		stockOpnameAccountIDs = append(stockOpnameAccountIDs, v.ID)
 	}
 
-	var beginningInventory, purchases, freightInAndOtherCost, totalPurchases, purchaseReturns, purchaseDiscounts, totalPurchaseDiscounts, netPurchases, goodsAvailable, endingInventory, cogs, stockOpname float64
+	rounding := models.GetCompanyRounding(s.db, &report.CompanyID)
+	var beginningInventory, purchases, freightInAndOtherCost, totalPurchases, purchaseReturns, purchaseDiscounts, totalPurchaseDiscounts, netPurchases, goodsAvailable, endingInventory, cogs, stockOpname money.Amount
 	amount := struct {
 		Sum float64 `sql:"sum"`
 	}{}
-	err = s.db.Model(&models.TransactionModel{}).
-		Where("date < ?", report.StartDate).
-		Select("sum(debit-credit) as sum").
-		Where("account_id = ?", inventoryAccount.ID).
-		Where("company_id = ?", report.CompanyID).
-		Scan(&amount).Error
+	debit, credit, err := s.accountSum(report.CompanyID, []string{inventoryAccount.ID}, report.Dimensions, nil, &report.StartDate, false)
 	if err != nil {
 		return nil, err
 	}
-	beginningInventory = amount.Sum
+	beginningInventory = exact(rounding, debit-credit)
 
-	err = s.db.Model(&models.TransactionModel{}).
+	err = s.dimensionLedger(report.Dimensions).
 		Where("is_purchase_cost = ?", false).
 		Where("is_purchase = ?", true).
 		Where("debit > ?", 0).
@@ -393,9 +576,9 @@ func (s *FinanceReportService) GenerateCogsReport(report models.GeneralReport) (
 	if err != nil {
 		return nil, err
 	}
-	purchases = amount.Sum
+	purchases = exact(rounding, amount.Sum)
 
-	err = s.db.Model(&models.TransactionModel{}).
+	err = s.dimensionLedger(report.Dimensions).
 		Where("is_purchase_cost = ?", true).
 		Where("debit > ?", 0).
 		Where("date between ? and ?", report.StartDate, report.EndDate).
@@ -406,10 +589,10 @@ func (s *FinanceReportService) GenerateCogsReport(report models.GeneralReport) (
 	if err != nil {
 		return nil, err
 	}
-	freightInAndOtherCost = amount.Sum
-	totalPurchases = purchases + freightInAndOtherCost
+	freightInAndOtherCost = exact(rounding, amount.Sum)
+	totalPurchases = purchases.Add(freightInAndOtherCost)
 
-	err = s.db.Model(&models.TransactionModel{}).
+	err = s.dimensionLedger(report.Dimensions).
 		Where("is_return = ?", true).
 		Where("date between ? and ?", report.StartDate, report.EndDate).
 		Select("sum(credit-debit) as sum").
@@ -419,8 +602,8 @@ func (s *FinanceReportService) GenerateCogsReport(report models.GeneralReport) (
 	if err != nil {
 		return nil, err
 	}
-	purchaseReturns = amount.Sum
-	err = s.db.Model(&models.TransactionModel{}).
+	purchaseReturns = exact(rounding, amount.Sum)
+	err = s.dimensionLedger(report.Dimensions).
 		Where("is_discount = ?", true).
 		Where("date between ? and ?", report.StartDate, report.EndDate).
 		Select("sum(credit-debit) as sum").
@@ -430,53 +613,43 @@ func (s *FinanceReportService) GenerateCogsReport(report models.GeneralReport) (
 	if err != nil {
 		return nil, err
 	}
-	purchaseDiscounts = amount.Sum
+	purchaseDiscounts = exact(rounding, amount.Sum)
 
-	totalPurchaseDiscounts = purchaseReturns + purchaseDiscounts
+	totalPurchaseDiscounts = purchaseReturns.Add(purchaseDiscounts)
 
-	err = s.db.Model(&models.TransactionModel{}).
-		Where("date < ?", report.EndDate).
-		Select("sum(debit-credit) as sum").
-		Where("account_id = ?", inventoryAccount.ID).
-		Where("company_id = ?", report.CompanyID).
-		Scan(&amount).Error
+	debit, credit, err = s.accountSum(report.CompanyID, []string{inventoryAccount.ID}, report.Dimensions, nil, &report.EndDate, false)
 	if err != nil {
 		return nil, err
 	}
-	endingInventory = amount.Sum
+	endingInventory = exact(rounding, debit-credit)
 
 	// STOCK OPNAME
 
 	fmt.Println("GET STOCK OPNAME")
-	err = s.db.Model(&models.TransactionModel{}).
-		Where("date < ?", report.EndDate).
-		Select("sum(debit-credit) as sum").
-		Where("account_id IN (?)", stockOpnameAccountIDs).
-		Where("company_id = ?", report.CompanyID).
-		Scan(&amount).Error
+	debit, credit, err = s.accountSum(report.CompanyID, stockOpnameAccountIDs, report.Dimensions, nil, &report.EndDate, false)
 	if err != nil {
 		return nil, err
 	}
-	stockOpname = amount.Sum
+	stockOpname = exact(rounding, debit-credit)
 
-	netPurchases = totalPurchases - totalPurchaseDiscounts
-	goodsAvailable = beginningInventory + netPurchases
-	cogs = goodsAvailable - endingInventory - stockOpname
+	netPurchases = totalPurchases.Sub(totalPurchaseDiscounts)
+	goodsAvailable = beginningInventory.Add(netPurchases)
+	cogs = goodsAvailable.Sub(endingInventory).Sub(stockOpname)
 
 	cogsData := models.COGSReport{
-		BeginningInventory:     beginningInventory,
-		Purchases:              purchases,
-		FreightInAndOtherCost:  freightInAndOtherCost,
-		TotalPurchases:         totalPurchases,
-		PurchaseReturns:        purchaseReturns,
-		PurchaseDiscounts:      purchaseDiscounts,
-		TotalPurchaseDiscounts: totalPurchaseDiscounts,
-		NetPurchases:           netPurchases,
-		GoodsAvailable:         goodsAvailable,
-		EndingInventory:        endingInventory,
-		COGS:                   cogs,
+		BeginningInventory:     beginningInventory.Float64(),
+		Purchases:              purchases.Float64(),
+		FreightInAndOtherCost:  freightInAndOtherCost.Float64(),
+		TotalPurchases:         totalPurchases.Float64(),
+		PurchaseReturns:        purchaseReturns.Float64(),
+		PurchaseDiscounts:      purchaseDiscounts.Float64(),
+		TotalPurchaseDiscounts: totalPurchaseDiscounts.Float64(),
+		NetPurchases:           netPurchases.Float64(),
+		GoodsAvailable:         goodsAvailable.Float64(),
+		EndingInventory:        endingInventory.Float64(),
+		COGS:                   cogs.Float64(),
 		InventoryAccount:       inventoryAccount,
-		StockOpname:            stockOpname,
+		StockOpname:            stockOpname.Float64(),
 	}
 	cogsData.StartDate = report.StartDate
 	cogsData.EndDate = report.EndDate
@@ -586,6 +759,9 @@ func (s *FinanceReportService) GenerateClosingBook(
 	if cashflowGroupSetting == nil {
 		return errors.New("cashflow group setting is required")
 	}
+	if err := period.Check(s.db, closingBook.CompanyID, "closing-book", closingBook.EndDate); err != nil {
+		return err
+	}
 
 	var transactions []models.TransactionModel
 	// 🧾 Langkah 1: Menutup Akun Pendapatan
@@ -1082,7 +1258,12 @@ func (s *FinanceReportService) GenerateClosingBook(
 // It calculates the trial balance, adjustments, and balance sheet for various account types,
 // including ASSET, LIABILITY, EQUITY, REVENUE, EXPENSE, COST, RECEIVABLE, and CONTRA_REVENUE.
 // The function returns a populated TrialBalanceReport and any error encountered during the process.
+// Report.Dimensions filters the ledger lines by the active analytic dimensions of the
+// company; with report.GroupBy set, Groups holds one trial balance per value of that dimension.
 func (s *FinanceReportService) TrialBalanceReport(report models.GeneralReport) (*models.TrialBalanceReport, error) {
+	if err := models.CheckAnalyticDimensions(s.db, &report.CompanyID, report.Dimensions); err != nil {
+		return nil, err
+	}
 	var trialBalanceReport models.TrialBalanceReport = models.TrialBalanceReport{
 		CompanyID: &report.CompanyID,
 		StartDate: report.StartDate,
@@ -1109,7 +1290,7 @@ func (s *FinanceReportService) TrialBalanceReport(report models.GeneralReport) (
 				continue
 			}
 			// TRIAL BALANCE
-			trialBalanceDebit, trialBalanceCredit, err := s.GetAccountBalance(account.ID, &report.CompanyID, &report.EndDate, nil)
+			trialBalanceDebit, trialBalanceCredit, err := s.GetAccountBalanceByDimensions(account.ID, &report.CompanyID, &report.EndDate, nil, report.Dimensions)
 			if err != nil {
 				return nil, err
 			}
@@ -1123,7 +1304,7 @@ func (s *FinanceReportService) TrialBalanceReport(report models.GeneralReport) (
 			})
 
 			// ADJUSTMENT
-			adjustmentDebit, adjustmentCredit, err := s.GetAccountBalance(account.ID, &report.CompanyID, &report.StartDate, &report.EndDate)
+			adjustmentDebit, adjustmentCredit, err := s.GetAccountBalanceByDimensions(account.ID, &report.CompanyID, &report.StartDate, &report.EndDate, report.Dimensions)
 			if err != nil {
 				return nil, err
 			}
@@ -1138,7 +1319,7 @@ func (s *FinanceReportService) TrialBalanceReport(report models.GeneralReport) (
 			})
 
 			// BALANCE SHEET
-			balanceSheetDebit, balanceSheetCredit, err := s.GetAccountBalance(account.ID, &report.CompanyID, nil, &report.EndDate)
+			balanceSheetDebit, balanceSheetCredit, err := s.GetAccountBalanceByDimensions(account.ID, &report.CompanyID, nil, &report.EndDate, report.Dimensions)
 			if err != nil {
 				return nil, err
 			}
@@ -1155,6 +1336,24 @@ func (s *FinanceReportService) TrialBalanceReport(report models.GeneralReport) (
 		}
 
 	}
+
+	if report.GroupBy != "" {
+		groups, err := s.dimensionGroups(report.CompanyID, report.GroupBy, report.Dimensions, nil, report.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			sub := report
+			sub.GroupBy = ""
+			sub.Dimensions = groupDimensions(report.Dimensions, group)
+			groupReport, err := s.TrialBalanceReport(sub)
+			if err != nil {
+				return nil, err
+			}
+			groupReport.Group = &group
+			trialBalanceReport.Groups = append(trialBalanceReport.Groups, *groupReport)
+		}
+	}
 	return &trialBalanceReport, nil
 }
 
@@ -1162,6 +1361,9 @@ func (s *FinanceReportService) TrialBalanceReport(report models.GeneralReport) (
 // within a specified date range. It calculates the revenue, cost of goods sold (COGS),
 // gross profit, expenses, and net profit. The function returns a populated ProfitLossReport
 // and any error encountered during the process.
+// Report.Dimensions filters the ledger lines by the active analytic dimensions of the
+// company, COGS included; with report.GroupBy set, Groups holds one profit and loss
+// per value of that dimension.
 func (s *FinanceReportService) GenerateProfitLossReport(report models.GeneralReport) (*models.ProfitLossReport, error) {
 	profitLoss := models.ProfitLossReport{}
 	cogsReport, err := s.GenerateCogsReport(report)
@@ -1176,28 +1378,21 @@ func (s *FinanceReportService) GenerateProfitLossReport(report models.GeneralRep
 	if err != nil {
 		return nil, err
 	}
-	revenueSum := 0.0
+	rounding := models.GetCompanyRounding(s.db, &report.CompanyID)
+	var revenueSum money.Amount
 	for _, revenue := range revenueAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date between ? and ?", report.StartDate, report.EndDate).
-			Select("sum(credit-debit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", revenue.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{revenue.ID}, report.Dimensions, &report.StartDate, &report.EndDate, true)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, credit-debit)
 		profitLoss.Profit = append(profitLoss.Profit, models.ProfitLossAccount{
 			ID:   revenue.ID,
 			Name: revenue.Name,
 			Code: revenue.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		revenueSum += amount.Sum
+		revenueSum = revenueSum.Add(sum)
 	}
 
 	profitLoss.Profit = append(profitLoss.Profit, models.ProfitLossAccount{
@@ -1207,38 +1402,32 @@ func (s *FinanceReportService) GenerateProfitLossReport(report models.GeneralRep
 		IsCogs: true,
 	})
 
-	profitLoss.GrossProfit = revenueSum - cogsReport.COGS
+	grossProfit := revenueSum.Sub(money.FromFloat(cogsReport.COGS))
+	profitLoss.GrossProfit = grossProfit.Float64()
 
 	expenseAccounts := []models.AccountModel{}
 	err = s.db.Where("type IN (?)", []models.AccountType{models.EXPENSE}).Where("company_id = ?", report.CompanyID).Find(&expenseAccounts).Error
 	if err != nil {
 		return nil, err
 	}
-	expenseSum := 0.0
+	var expenseSum money.Amount
 	for _, expense := range expenseAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date between ? and ?", report.StartDate, report.EndDate).
-			Select("sum(debit-credit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", expense.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{expense.ID}, report.Dimensions, &report.StartDate, &report.EndDate, true)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, debit-credit)
 		profitLoss.Loss = append(profitLoss.Loss, models.ProfitLossAccount{
 			ID:   expense.ID,
 			Name: expense.Name,
 			Code: expense.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		expenseSum += amount.Sum
+		expenseSum = expenseSum.Add(sum)
 	}
 
-	profitLoss.TotalExpense += expenseSum
+	totalExpense := money.FromFloat(profitLoss.TotalExpense).Add(expenseSum)
+	profitLoss.TotalExpense = totalExpense.Float64()
 
 	// NET SURPLUS
 	// equityAccounts := []models.AccountModel{}
@@ -1251,7 +1440,7 @@ func (s *FinanceReportService) GenerateProfitLossReport(report models.GeneralRep
 	// 	amount := struct {
 	// 		Sum float64 `sql:"sum"`
 	// 	}{}
-	// 	err = s.db.Model(&models.TransactionModel{}).
+	// 	err = s.dimensionLedger(report.Dimensions).
 	// 		Where("date between ? and ?", report.StartDate, report.EndDate).
 	// 		Select("sum(debit-credit) as sum").
 	// 		Joins("JOIN accounts ON accounts.id = transactions.account_id").
@@ -1272,7 +1461,25 @@ func (s *FinanceReportService) GenerateProfitLossReport(report models.GeneralRep
 
 	// profitLoss.TotalNetSurplus = netSurplus
 
-	profitLoss.NetProfit = profitLoss.GrossProfit - profitLoss.TotalExpense
+	profitLoss.NetProfit = grossProfit.Sub(totalExpense).Float64()
+
+	if report.GroupBy != "" {
+		groups, err := s.dimensionGroups(report.CompanyID, report.GroupBy, report.Dimensions, &report.StartDate, report.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			sub := report
+			sub.GroupBy = ""
+			sub.Dimensions = groupDimensions(report.Dimensions, group)
+			groupReport, err := s.GenerateProfitLossReport(sub)
+			if err != nil {
+				return nil, err
+			}
+			groupReport.Group = &group
+			profitLoss.Groups = append(profitLoss.Groups, *groupReport)
+		}
+	}
 	return &profitLoss, nil
 }
 
@@ -1287,6 +1494,7 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 	balanceSheet := models.BalanceSheet{}
 	balanceSheet.StartDate = report.StartDate
 	balanceSheet.EndDate = report.EndDate
+	rounding := models.GetCompanyRounding(s.db, &report.CompanyID)
 
 	// ASSETS
 	// FIXED ACCOUNT
@@ -1295,30 +1503,22 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 	if err != nil {
 		return nil, errors.New("fixedAccounts account not found")
 	}
-	fixedAmount := 0.0
+	var fixedAmount money.Amount
 	for _, expense := range fixedAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date <  ?", report.EndDate).
-			Select("sum(debit-credit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", expense.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{expense.ID}, models.AnalyticDimensions{}, nil, &report.EndDate, false)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, debit-credit)
 		balanceSheet.FixedAssets = append(balanceSheet.FixedAssets, models.BalanceSheetAccount{
 			ID:   expense.ID,
 			Name: expense.Name,
 			Code: expense.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		fixedAmount += amount.Sum
+		fixedAmount = fixedAmount.Add(sum)
 	}
-	balanceSheet.TotalFixed = fixedAmount
+	balanceSheet.TotalFixed = fixedAmount.Float64()
 
 	// CURRENT ACCOUNT
 	currentAccounts := []models.AccountModel{}
@@ -1326,28 +1526,20 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 	if err != nil {
 
 	}
-	currentAmount := 0.0
+	var currentAmount money.Amount
 	for _, expense := range currentAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date <  ?", report.EndDate).
-			Select("sum(debit-credit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", expense.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{expense.ID}, models.AnalyticDimensions{}, nil, &report.EndDate, false)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, debit-credit)
 		balanceSheet.CurrentAssets = append(balanceSheet.CurrentAssets, models.BalanceSheetAccount{
 			ID:   expense.ID,
 			Name: expense.Name,
 			Code: expense.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		currentAmount += amount.Sum
+		currentAmount = currentAmount.Add(sum)
 	}
 
 	// RECEIVABLE ACCOUNT
@@ -1358,26 +1550,18 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 	}
 
 	for _, expense := range receivableAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date <  ?", report.EndDate).
-			Select("sum(debit-credit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", expense.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{expense.ID}, models.AnalyticDimensions{}, nil, &report.EndDate, false)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, debit-credit)
 		balanceSheet.CurrentAssets = append(balanceSheet.CurrentAssets, models.BalanceSheetAccount{
 			ID:   expense.ID,
 			Name: expense.Name,
 			Code: expense.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		currentAmount += amount.Sum
+		currentAmount = currentAmount.Add(sum)
 	}
 
 	// INVENTORY
@@ -1393,10 +1577,10 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 		Sum:  cogsReport.EndingInventory,
 	})
 
-	currentAmount += cogsReport.EndingInventory
-	balanceSheet.TotalCurrent = currentAmount
+	currentAmount = currentAmount.Add(money.FromFloat(cogsReport.EndingInventory))
+	balanceSheet.TotalCurrent = currentAmount.Float64()
 
-	balanceSheet.TotalAssets = balanceSheet.TotalFixed + balanceSheet.TotalCurrent
+	balanceSheet.TotalAssets = fixedAmount.Add(currentAmount).Float64()
 	// LIABILITY AND EQUITY
 
 	// LIABILITY ACCOUNT
@@ -1405,31 +1589,23 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 	if err != nil {
 		return nil, errors.New("liabilityAccounts account not found")
 	}
-	liabilityAmount := 0.0
+	var liabilityAmount money.Amount
 	for _, expense := range liabilityAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date <  ?", report.EndDate).
-			Select("sum(credit-debit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", expense.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{expense.ID}, models.AnalyticDimensions{}, nil, &report.EndDate, false)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, credit-debit)
 		balanceSheet.LiableAssets = append(balanceSheet.LiableAssets, models.BalanceSheetAccount{
 			ID:   expense.ID,
 			Name: expense.Name,
 			Code: expense.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		liabilityAmount += amount.Sum
+		liabilityAmount = liabilityAmount.Add(sum)
 	}
 
-	balanceSheet.TotalLiability = liabilityAmount
+	balanceSheet.TotalLiability = liabilityAmount.Float64()
 
 	// EQUITY ACCOUNT
 	equityAccounts := []models.AccountModel{}
@@ -1437,28 +1613,20 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 	if err != nil {
 		return nil, errors.New("equityAccounts account not found")
 	}
-	equityAmount := 0.0
+	var equityAmount money.Amount
 	for _, expense := range equityAccounts {
-		amount := struct {
-			Sum float64 `sql:"sum"`
-		}{}
-		err = s.db.Model(&models.TransactionModel{}).
-			Where("date <  ?", report.EndDate).
-			Select("sum(credit-debit) as sum").
-			Joins("JOIN accounts ON accounts.id = transactions.account_id").
-			Where("transactions.account_id = ?", expense.ID).
-			Where("transactions.company_id = ?", report.CompanyID).
-			Scan(&amount).Error
+		debit, credit, err := s.accountSum(report.CompanyID, []string{expense.ID}, models.AnalyticDimensions{}, nil, &report.EndDate, false)
 		if err != nil {
 			return nil, err
 		}
+		sum := exact(rounding, credit-debit)
 		balanceSheet.Equity = append(balanceSheet.Equity, models.BalanceSheetAccount{
 			ID:   expense.ID,
 			Name: expense.Name,
 			Code: expense.Code,
-			Sum:  amount.Sum,
+			Sum:  sum.Float64(),
 		})
-		equityAmount += amount.Sum
+		equityAmount = equityAmount.Add(sum)
 	}
 
 	profitLoss, err := s.GenerateProfitLossReport(report)
@@ -1479,9 +1647,9 @@ func (s *FinanceReportService) GenerateBalanceSheet(report models.GeneralReport)
 			ID:   profitLoss.NetSurplus[len(profitLoss.NetSurplus)-1].ID,
 		})
 	}
-	equityAmount += profitLoss.NetProfit - profitLoss.TotalNetSurplus
-	balanceSheet.TotalEquity = equityAmount
-	balanceSheet.TotalLiabilitiesAndEquity = balanceSheet.TotalLiability + balanceSheet.TotalEquity
+	equityAmount = equityAmount.Add(money.FromFloat(profitLoss.NetProfit)).Sub(money.FromFloat(profitLoss.TotalNetSurplus))
+	balanceSheet.TotalEquity = equityAmount.Float64()
+	balanceSheet.TotalLiabilitiesAndEquity = liabilityAmount.Add(equityAmount).Float64()
 
 	return &balanceSheet, nil
 }
@@ -1503,13 +1671,14 @@ func (s *FinanceReportService) GenerateCapitalChangeReport(report models.General
 	if err != nil {
 		return nil, errors.New("equityAccounts account not found")
 	}
+	rounding := models.GetCompanyRounding(s.db, &report.CompanyID)
 	// Opening Balance
-	openingBalance := 0.0
+	var openingBalance money.Amount
 	for _, v := range equityAccounts {
 		amount := struct {
 			Sum float64 `sql:"sum"`
 		}{}
-		err := s.db.Model(&models.TransactionModel{}).
+		err := s.ledger().
 			Where("date <  ?", report.EndDate).
 			Select("sum(credit) as sum").
 			Joins("JOIN accounts ON accounts.id = transactions.account_id").
@@ -1521,21 +1690,21 @@ func (s *FinanceReportService) GenerateCapitalChangeReport(report models.General
 			return nil, err
 		}
 
-		openingBalance += amount.Sum
+		openingBalance = openingBalance.Add(exact(rounding, amount.Sum))
 	}
 	profitLoss, err := s.GenerateProfitLossReport(report)
 	if err != nil {
 		return nil, err
 	}
 
-	profitLossBalance := profitLoss.NetProfit
+	profitLossBalance := money.FromFloat(profitLoss.NetProfit)
 
-	privedBalance := 0.0
+	var privedBalance money.Amount
 	for _, v := range equityAccounts {
 		amount := struct {
 			Sum float64 `sql:"sum"`
 		}{}
-		err := s.db.Model(&models.TransactionModel{}).
+		err := s.ledger().
 			Where("date <  ?", report.EndDate).
 			Select("sum(debit) as sum").
 			Joins("JOIN accounts ON accounts.id = transactions.account_id").
@@ -1547,15 +1716,15 @@ func (s *FinanceReportService) GenerateCapitalChangeReport(report models.General
 			return nil, err
 		}
 
-		privedBalance += amount.Sum
+		privedBalance = privedBalance.Add(exact(rounding, amount.Sum))
 	}
 
-	capitalChangeBalance := 0.0
+	var capitalChangeBalance money.Amount
 	for _, v := range equityAccounts {
 		amount := struct {
 			Sum float64 `sql:"sum"`
 		}{}
-		err := s.db.Model(&models.TransactionModel{}).
+		err := s.ledger().
 			Where("date <  ?", report.EndDate).
 			Select("sum(credit) as sum").
 			Joins("JOIN accounts ON accounts.id = transactions.account_id").
@@ -1567,13 +1736,13 @@ func (s *FinanceReportService) GenerateCapitalChangeReport(report models.General
 			return nil, err
 		}
 
-		capitalChangeBalance += amount.Sum
+		capitalChangeBalance = capitalChangeBalance.Add(exact(rounding, amount.Sum))
 	}
 
 	// amount := struct {
 	// 	Sum float64 `sql:"sum"`
 	// }{}
-	// err := s.db.Model(&models.TransactionModel{}).
+	// err := s.ledger().
 	// 	Where("date <  ?", report.StartDate).
 	// 	Select("sum(credit-debit) as sum").
 	// 	Joins("JOIN accounts ON accounts.id = transactions.account_id").
@@ -1583,11 +1752,11 @@ func (s *FinanceReportService) GenerateCapitalChangeReport(report models.General
 	// 	return nil, err
 	// }
 
-	capitalChange.OpeningBalance = openingBalance
-	capitalChange.ProfitLoss = profitLossBalance
-	capitalChange.PrivedBalance = -privedBalance
-	capitalChange.CapitalChangeBalance = capitalChangeBalance
-	capitalChange.EndingBalance = openingBalance + profitLossBalance + capitalChangeBalance - privedBalance
+	capitalChange.OpeningBalance = openingBalance.Float64()
+	capitalChange.ProfitLoss = profitLossBalance.Float64()
+	capitalChange.PrivedBalance = privedBalance.Neg().Float64()
+	capitalChange.CapitalChangeBalance = capitalChangeBalance.Float64()
+	capitalChange.EndingBalance = money.Sum(openingBalance, profitLossBalance, capitalChangeBalance).Sub(privedBalance).Float64()
 	return &capitalChange, nil
 }
 
@@ -1601,21 +1770,21 @@ func (s *FinanceReportService) GenerateCashFlowReport(cashFlow models.CashFlowRe
 	fmt.Println("======================================")
 	fmt.Println("OPERATING")
 	fmt.Println("======================================")
-	operating, totalOperating := s.getCashFlowAmount(cashFlow.Operating, &cashFlow.CompanyID)
+	operating, totalOperating := s.getCashFlowAmount(cashFlow.Operating, &cashFlow.CompanyID, cashFlow.StartDate, cashFlow.EndDate)
 	cashFlow.Operating = operating
 	cashFlow.TotalOperating = totalOperating
 
 	fmt.Println("======================================")
 	fmt.Println("INVESTING")
 	fmt.Println("======================================")
-	investing, totalInvesting := s.getCashFlowAmount(cashFlow.Investing, &cashFlow.CompanyID)
+	investing, totalInvesting := s.getCashFlowAmount(cashFlow.Investing, &cashFlow.CompanyID, cashFlow.StartDate, cashFlow.EndDate)
 	cashFlow.Investing = investing
 	cashFlow.TotalInvesting = totalInvesting
 
 	fmt.Println("======================================")
 	fmt.Println("FINANCING")
 	fmt.Println("======================================")
-	financing, totalInvesting := s.getCashFlowAmount(cashFlow.Financing, &cashFlow.CompanyID)
+	financing, totalInvesting := s.getCashFlowAmount(cashFlow.Financing, &cashFlow.CompanyID, cashFlow.StartDate, cashFlow.EndDate)
 	cashFlow.Financing = financing
 	cashFlow.TotalFinancing = totalInvesting
 
@@ -1628,13 +1797,23 @@ func (s *FinanceReportService) GenerateCashFlowReport(cashFlow models.CashFlowRe
 // and transaction references to filter by cash flow subgroup and company ID.
 // Each transaction's amount is calculated as the difference between debit and credit,
 // and the total for each subgroup is accumulated and assigned to the subgroup.
+// A zero start or end date leaves that side of the range open.
 
-func (s *FinanceReportService) getCashFlowAmount(groups []models.CashflowSubGroup, companyID *string) ([]models.CashflowSubGroup, float64) {
+func (s *FinanceReportService) getCashFlowAmount(groups []models.CashflowSubGroup, companyID *string, startDate, endDate time.Time) ([]models.CashflowSubGroup, float64) {
 
-	total := 0.0
+	rounding := models.GetCompanyRounding(s.db, companyID)
+	var total money.Amount
 	for i, v := range groups {
 		var transactions []models.TransactionModel
-		s.db.Model(&transactions).
+		stmt := s.db.Model(&transactions)
+		if !startDate.IsZero() {
+			stmt = stmt.Where("transRef.date >= ?", startDate)
+		}
+		if !endDate.IsZero() {
+			stmt = stmt.Where("transRef.date <= ?", endDate)
+		}
+		stmt.
+			Where("transactions.is_draft = ?", false).
 			Distinct("transRef.id refid, (transRef.debit - transRef.credit) amount, accountRef.name description").
 			Joins("JOIN accounts ON accounts.id = transactions.account_id").
 			Joins("JOIN transactions transRef ON transRef.id = transactions.transaction_ref_id").
@@ -1645,16 +1824,16 @@ func (s *FinanceReportService) getCashFlowAmount(groups []models.CashflowSubGrou
 			Group("refid, transactions.id, accountRef.name").
 			Find(&transactions)
 
-		amount := 0.0
+		var amount money.Amount
 		for _, t := range transactions {
 			fmt.Printf("[%s] %s %f\n", v.Name, t.Description, t.Amount)
-			amount += t.Amount
+			amount = amount.Add(exact(rounding, t.Amount))
 		}
-		v.Amount = amount
+		v.Amount = amount.Float64()
 		groups[i] = v
-		total += amount
+		total = total.Add(amount)
 	}
-	return groups, total
+	return groups, total.Float64()
 }
 
 // getTransBalance calculates the balance of a transaction for a given account
@@ -1665,15 +1844,22 @@ func (s *FinanceReportService) getCashFlowAmount(groups []models.CashflowSubGrou
 func (s *FinanceReportService) getTransBalance(account *models.AccountModel, debit, credit float64) float64 {
 	switch account.Type {
 	case models.EXPENSE, models.COST, models.CONTRA_LIABILITY, models.CONTRA_EQUITY, models.CONTRA_REVENUE, models.RECEIVABLE:
-		return debit - credit
+		return money.FromFloat(debit).Sub(money.FromFloat(credit)).Float64()
 	case models.LIABILITY, models.EQUITY, models.REVENUE, models.INCOME, models.CONTRA_ASSET, models.CONTRA_EXPENSE:
-		return credit - debit
+		return money.FromFloat(credit).Sub(money.FromFloat(debit)).Float64()
 	case models.ASSET:
-		return debit - credit
+		return money.FromFloat(debit).Sub(money.FromFloat(credit)).Float64()
 	}
 	return 0
 }
 
+// exact converts an aggregated ledger amount into an exact money.Amount rounded
+// to the precision of the company. Reports add these rounded amounts, so the
+// trial balance, the profit and loss and the balance sheet agree to the unit.
+func exact(rounding money.Rounding, value float64) money.Amount {
+	return rounding.Document(money.FromFloat(value))
+}
+
 // GetMonthlySalesReport retrieves a list of monthly sales reports from the database,
 // filtered by the given year and company ID.
 //
@@ -2087,6 +2273,7 @@ func (s *FinanceReportService) GetSumCashBank(companyID string) (float64, error)
 			accounts.type = ? AND cashflow_sub_group = ?
 			AND accounts.company_id = ? 
 			AND transactions.deleted_at is null
+			AND transactions.is_draft = false
 	`, models.ASSET, constants.CASH_BANK, companyID).Scan(&total).Error
 	if err != nil {
 		return 0, err
@@ -2256,7 +2443,7 @@ func (s *FinanceReportService) GetAccountReceivableLedger(companyID string, cont
 		return nil, errors.New("contact service is not initialized")
 	}
 	reports := []models.AccountReceivableLedger{}
-	err := s.db.Table("transactions").
+	err := s.ledger().
 		Select("distinct transactions.id, transactions.description, transactions.\"date\", transactions.debit, transactions.credit, "+
 			"case when s.id is not null then s.sales_number when ss.id is not null then ss.sales_number when sss.id is not null then sss.sales_number else null end ref, "+
 			"case when transactions.transaction_secondary_ref_type != '' then transactions.transaction_secondary_ref_type else transactions.transaction_ref_type end ref_type, "+
@@ -2288,7 +2475,7 @@ func (s *FinanceReportService) GetAccountReceivableLedger(companyID string, cont
 		Balance     float64
 	}
 
-	err = s.db.Table("transactions").
+	err = s.ledger().
 		Select("sum(debit) as total_debit, sum(credit) as total_credit, sum(debit - credit) as balance").
 		Joins("join accounts a on a.id = transactions.account_id").
 		Joins("left join sales s on s.id = transactions.transaction_ref_id").
@@ -2315,7 +2502,7 @@ func (s *FinanceReportService) GetAccountReceivableLedger(companyID string, cont
 		Balance     float64
 	}
 
-	err = s.db.Table("transactions").
+	err = s.ledger().
 		Select("sum(debit) as total_debit, sum(credit) as total_credit, sum(debit - credit) as balance").
 		Joins("join accounts a on a.id = transactions.account_id").
 		Joins("left join sales s on s.id = transactions.transaction_ref_id").
@@ -2336,15 +2523,16 @@ func (s *FinanceReportService) GetAccountReceivableLedger(companyID string, cont
 		return nil, err
 	}
 
-	balance := totalBefore.Balance
-	var totalDebit, totalCredit, totalBalance float64
+	balance := money.FromFloat(totalBefore.Balance)
+	var totalDebit, totalCredit, totalBalance money.Amount
 	for i, v := range reports {
-		balance += v.Debit - v.Credit
-		v.Balance = balance
+		debit, credit := money.FromFloat(v.Debit), money.FromFloat(v.Credit)
+		balance = balance.Add(debit).Sub(credit)
+		v.Balance = balance.Float64()
 		reports[i] = v
-		totalDebit += v.Debit
-		totalCredit += v.Credit
-		totalBalance += v.Debit - v.Credit
+		totalDebit = totalDebit.Add(debit)
+		totalCredit = totalCredit.Add(credit)
+		totalBalance = totalBalance.Add(debit).Sub(credit)
 	}
 
 	var contact models.ContactModel
@@ -2359,18 +2547,18 @@ func (s *FinanceReportService) GetAccountReceivableLedger(companyID string, cont
 
 	return &models.AccountReceivableLedgerReport{
 		Ledgers:            reports,
-		TotalDebit:         totalDebit,
-		TotalCredit:        totalCredit,
-		TotalBalance:       totalBalance,
+		TotalDebit:         totalDebit.Float64(),
+		TotalCredit:        totalCredit.Float64(),
+		TotalBalance:       totalBalance.Float64(),
 		TotalDebitBefore:   totalBefore.TotalDebit,
 		TotalCreditBefore:  totalBefore.TotalCredit,
 		TotalBalanceBefore: totalBefore.Balance,
 		TotalDebitAfter:    totalAfter.TotalDebit,
 		TotalCreditAfter:   totalAfter.TotalCredit,
 		TotalBalanceAfter:  totalAfter.Balance,
-		GrandTotalDebit:    totalDebit + totalBefore.TotalDebit + totalAfter.TotalDebit,
-		GrandTotalCredit:   totalCredit + totalBefore.TotalCredit + totalAfter.TotalCredit,
-		GrandTotalBalance:  totalBalance + totalBefore.Balance + totalAfter.Balance,
+		GrandTotalDebit:    money.SumFloat(totalBefore.TotalDebit, totalAfter.TotalDebit).Add(totalDebit).Float64(),
+		GrandTotalCredit:   money.SumFloat(totalBefore.TotalCredit, totalAfter.TotalCredit).Add(totalCredit).Float64(),
+		GrandTotalBalance:  money.SumFloat(totalBefore.Balance, totalAfter.Balance).Add(totalBalance).Float64(),
 		Contact:            contact,
 	}, nil
 }
@@ -2380,7 +2568,7 @@ func (s *FinanceReportService) GetAccountPayableLedger(companyID string, contact
 		return nil, errors.New("contact service is not initialized")
 	}
 	reports := []models.AccountReceivableLedger{}
-	err := s.db.Table("transactions").
+	err := s.ledger().
 		Select("distinct transactions.id, transactions.description, transactions.\"date\", transactions.debit, transactions.credit, "+
 			"case when s.id is not null then s.purchase_number when ss.id is not null then ss.purchase_number when sss.id is not null then sss.purchase_number else null end ref, "+
 			"case when transactions.transaction_secondary_ref_type != '' then transactions.transaction_secondary_ref_type else transactions.transaction_ref_type end ref_type, "+
@@ -2412,7 +2600,7 @@ func (s *FinanceReportService) GetAccountPayableLedger(companyID string, contact
 		Balance     float64
 	}
 
-	err = s.db.Table("transactions").
+	err = s.ledger().
 		Select("sum(debit) as total_debit, sum(credit) as total_credit, sum(debit - credit) as balance").
 		Joins("join accounts a on a.id = transactions.account_id").
 		Joins("left join purchase_orders s on s.id = transactions.transaction_ref_id").
@@ -2439,7 +2627,7 @@ func (s *FinanceReportService) GetAccountPayableLedger(companyID string, contact
 		Balance     float64
 	}
 
-	err = s.db.Table("transactions").
+	err = s.ledger().
 		Select("sum(debit) as total_debit, sum(credit) as total_credit, sum(debit - credit) as balance").
 		Joins("join accounts a on a.id = transactions.account_id").
 		Joins("left join purchase_orders s on s.id = transactions.transaction_ref_id").
@@ -2460,15 +2648,16 @@ func (s *FinanceReportService) GetAccountPayableLedger(companyID string, contact
 		return nil, err
 	}
 
-	balance := totalBefore.Balance
-	var totalDebit, totalCredit, totalBalance float64
+	balance := money.FromFloat(totalBefore.Balance)
+	var totalDebit, totalCredit, totalBalance money.Amount
 	for i, v := range reports {
-		balance += v.Credit - v.Debit
-		v.Balance = balance
+		debit, credit := money.FromFloat(v.Debit), money.FromFloat(v.Credit)
+		balance = balance.Add(credit).Sub(debit)
+		v.Balance = balance.Float64()
 		reports[i] = v
-		totalDebit += v.Debit
-		totalCredit += v.Credit
-		totalBalance += v.Credit - v.Debit
+		totalDebit = totalDebit.Add(debit)
+		totalCredit = totalCredit.Add(credit)
+		totalBalance = totalBalance.Add(credit).Sub(debit)
 	}
 
 	var contact models.ContactModel
@@ -2483,18 +2672,18 @@ func (s *FinanceReportService) GetAccountPayableLedger(companyID string, contact
 
 	return &models.AccountReceivableLedgerReport{
 		Ledgers:            reports,
-		TotalDebit:         totalDebit,
-		TotalCredit:        totalCredit,
-		TotalBalance:       totalBalance,
+		TotalDebit:         totalDebit.Float64(),
+		TotalCredit:        totalCredit.Float64(),
+		TotalBalance:       totalBalance.Float64(),
 		TotalDebitBefore:   totalBefore.TotalDebit,
 		TotalCreditBefore:  totalBefore.TotalCredit,
 		TotalBalanceBefore: totalBefore.Balance,
 		TotalDebitAfter:    totalAfter.TotalDebit,
 		TotalCreditAfter:   totalAfter.TotalCredit,
 		TotalBalanceAfter:  totalAfter.Balance,
-		GrandTotalDebit:    totalDebit + totalBefore.TotalDebit + totalAfter.TotalDebit,
-		GrandTotalCredit:   totalCredit + totalBefore.TotalCredit + totalAfter.TotalCredit,
-		GrandTotalBalance:  totalBalance + totalBefore.Balance + totalAfter.Balance,
+		GrandTotalDebit:    money.SumFloat(totalBefore.TotalDebit, totalAfter.TotalDebit).Add(totalDebit).Float64(),
+		GrandTotalCredit:   money.SumFloat(totalBefore.TotalCredit, totalAfter.TotalCredit).Add(totalCredit).Float64(),
+		GrandTotalBalance:  money.SumFloat(totalBefore.Balance, totalAfter.Balance).Add(totalBalance).Float64(),
 		Contact:            contact,
 	}, nil
 }
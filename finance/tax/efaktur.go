@@ -0,0 +1,634 @@
+package tax
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/efaktur"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateSerialRange registers a range of tax invoice serial numbers (NSFP) of a
+// company. The start and end serial may be written with separators and must be
+// of the same branch code and year, and must not overlap another range.
+func (ts *TaxService) CreateSerialRange(companyID string, startSerial, endSerial string, notes string) (*models.TaxInvoiceSerialRangeModel, error) {
+	start, err := efaktur.ParseSerial(startSerial)
+	if err != nil {
+		return nil, err
+	}
+	end, err := efaktur.ParseSerial(endSerial)
+	if err != nil {
+		return nil, err
+	}
+	if start[:5] != end[:5] {
+		return nil, errors.New("start and end serial must be of the same branch code and year")
+	}
+	if start > end {
+		return nil, errors.New("start serial must not be after end serial")
+	}
+	var count int64
+	err = ts.db.Model(&models.TaxInvoiceSerialRangeModel{}).
+		Where("company_id = ? AND start_serial <= ? AND end_serial >= ?", companyID, end, start).
+		Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("serial range overlaps an existing range")
+	}
+	data := models.TaxInvoiceSerialRangeModel{
+		CompanyID:   &companyID,
+		Year:        2000 + efaktur.SerialYear(start),
+		StartSerial: start,
+		EndSerial:   end,
+		Notes:       notes,
+	}
+	if err := ts.db.Create(&data).Error; err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetSerialRanges returns the serial ranges of a company, optionally of one year.
+func (ts *TaxService) GetSerialRanges(companyID string, year int) ([]models.TaxInvoiceSerialRangeModel, error) {
+	var ranges []models.TaxInvoiceSerialRangeModel
+	stmt := ts.db.Where("company_id = ?", companyID)
+	if year > 0 {
+		stmt = stmt.Where("year = ?", year)
+	}
+	err := stmt.Order("start_serial asc").Find(&ranges).Error
+	return ranges, err
+}
+
+// DeleteSerialRange deletes a serial range that has not been used.
+func (ts *TaxService) DeleteSerialRange(id string) error {
+	var data models.TaxInvoiceSerialRangeModel
+	if err := ts.db.Where("id = ?", id).First(&data).Error; err != nil {
+		return err
+	}
+	if data.LastSerial != "" {
+		return errors.New("serial range has been used")
+	}
+	return ts.db.Delete(&data).Error
+}
+
+// IssueOutputTaxInvoice issues the output tax invoice of a posted sales invoice
+// with the next free serial number of the company for the year of the invoice.
+//
+// The tax base and PPN are taken from the items with a PPN tax (TaxModel.TaxType
+// is models.TAX_TYPE_PPN) and from the PPN taxes of the invoice itself, and
+// converted to rupiah at the exchange rate of the invoice. The transaction code
+// is the 2 digit KD_JENIS_TRANSAKSI, e.g. "01".
+//
+// The sales invoice is locked while the tax invoice is issued, so it gets at most
+// one issued tax invoice.
+func (ts *TaxService) IssueOutputTaxInvoice(salesID string, transactionCode string) (*models.TaxInvoiceModel, error) {
+	if err := validateTransactionCode(transactionCode); err != nil {
+		return nil, err
+	}
+	var data *models.TaxInvoiceModel
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		var sales models.SalesModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Contact").Preload("Taxes").Preload("Items.Tax").Preload("Items.Product").
+			Where("id = ?", salesID).
+			First(&sales).Error
+		if err != nil {
+			return err
+		}
+		if sales.DocumentType != models.INVOICE || sales.PublishedAt == nil {
+			return errors.New("tax invoices can only be issued for posted sales invoices")
+		}
+		var count int64
+		err = tx.Model(&models.TaxInvoiceModel{}).Where("sales_id = ? AND status = ?", salesID, models.TAX_INVOICE_ISSUED).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("sales invoice already has a tax invoice")
+		}
+		data, err = salesTaxInvoice(&sales, transactionCode, models.GetCompanyRounding(tx, sales.CompanyID))
+		if err != nil {
+			return err
+		}
+		serial, err := ts.nextSerial(tx, *sales.CompanyID, sales.SalesDate.Year())
+		if err != nil {
+			return err
+		}
+		data.SerialNumber = serial
+		return tx.Create(data).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReplaceTaxInvoice issues a replacement (FG_PENGGANTI) of an output tax invoice
+// with the current data of its sales invoice. The replacement keeps the serial
+// number of the replaced tax invoice, which gets the REPLACED status.
+func (ts *TaxService) ReplaceTaxInvoice(id string, transactionCode string) (*models.TaxInvoiceModel, error) {
+	original, err := ts.GetTaxInvoiceByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if original.Direction != models.TAX_INVOICE_OUTPUT || original.SalesID == nil {
+		return nil, errors.New("only output tax invoices can be replaced, input tax invoices are replaced by registering the supplier's replacement")
+	}
+	if original.Status != models.TAX_INVOICE_ISSUED {
+		return nil, errors.New("tax invoice is already " + original.Status)
+	}
+	if transactionCode == "" {
+		transactionCode = original.TransactionCode
+	}
+	if err := validateTransactionCode(transactionCode); err != nil {
+		return nil, err
+	}
+	var sales models.SalesModel
+	if err := ts.db.Preload("Contact").Preload("Taxes").Preload("Items.Tax").Preload("Items.Product").Where("id = ?", *original.SalesID).First(&sales).Error; err != nil {
+		return nil, err
+	}
+	data, err := salesTaxInvoice(&sales, transactionCode, models.GetCompanyRounding(ts.db, sales.CompanyID))
+	if err != nil {
+		return nil, err
+	}
+	data.SerialNumber = original.SerialNumber
+	data.IsReplacement = true
+	data.ReplacedInvoiceID = &original.ID
+	err = ts.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(original).Update("status", models.TAX_INVOICE_REPLACED).Error; err != nil {
+			return err
+		}
+		return tx.Create(data).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CancelTaxInvoice cancels an issued tax invoice. Cancelled tax invoices are left
+// out of the export and the recap, and their serial number is not issued again.
+func (ts *TaxService) CancelTaxInvoice(id string) error {
+	data, err := ts.GetTaxInvoiceByID(id)
+	if err != nil {
+		return err
+	}
+	if data.Status != models.TAX_INVOICE_ISSUED {
+		return errors.New("tax invoice is already " + data.Status)
+	}
+	now := time.Now()
+	return ts.db.Model(data).Updates(map[string]any{
+		"status":       models.TAX_INVOICE_CANCELLED,
+		"cancelled_at": &now,
+	}).Error
+}
+
+// RegisterInputTaxInvoice records the tax invoice a supplier issued for a posted
+// bill. The serial number and date are those of the supplier's tax invoice. When
+// an issued input tax invoice with the same serial number exists, the new one is
+// registered as its replacement.
+func (ts *TaxService) RegisterInputTaxInvoice(purchaseID string, serialNumber string, date time.Time, transactionCode string, creditable bool) (*models.TaxInvoiceModel, error) {
+	if err := validateTransactionCode(transactionCode); err != nil {
+		return nil, err
+	}
+	serial, err := efaktur.ParseSerial(serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	var purchase models.PurchaseOrderModel
+	if err := ts.db.Preload("Contact").Preload("Items.Tax").Where("id = ?", purchaseID).First(&purchase).Error; err != nil {
+		return nil, err
+	}
+	if purchase.DocumentType != models.BILL || purchase.PublishedAt == nil {
+		return nil, errors.New("input tax invoices can only be registered for posted bills")
+	}
+	data := models.TaxInvoiceModel{
+		CompanyID:       purchase.CompanyID,
+		Direction:       models.TAX_INVOICE_INPUT,
+		PurchaseID:      &purchase.ID,
+		ContactID:       purchase.ContactID,
+		TransactionCode: transactionCode,
+		SerialNumber:    serial,
+		Date:            date,
+		Month:           int(date.Month()),
+		Year:            date.Year(),
+		Reference:       purchase.PurchaseNumber,
+		Creditable:      creditable,
+		Status:          models.TAX_INVOICE_ISSUED,
+	}
+	setCounterparty(&data, purchase.Contact)
+	var taxBase, vat money.Amount
+	for _, v := range purchase.Items {
+		if !isVAT(v.Tax) {
+			continue
+		}
+		taxBase = taxBase.Add(money.FromFloat(v.SubTotal))
+		vat = vat.Add(money.FromFloat(v.TotalTax))
+	}
+	if taxBase.IsZero() {
+		return nil, errors.New("bill has no PPN items")
+	}
+	rate := exchangeRate(purchase.ExchangeRate)
+	data.TaxBase = wholeRupiah(taxBase.Mul(rate))
+	data.VAT = wholeRupiah(vat.Mul(rate))
+
+	var original models.TaxInvoiceModel
+	err = ts.db.Where("company_id = ? AND direction = ? AND serial_number = ? AND status = ?", purchase.CompanyID, models.TAX_INVOICE_INPUT, serial, models.TAX_INVOICE_ISSUED).First(&original).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	err = ts.db.Transaction(func(tx *gorm.DB) error {
+		if original.ID != "" {
+			data.IsReplacement = true
+			data.ReplacedInvoiceID = &original.ID
+			if err := tx.Model(&original).Update("status", models.TAX_INVOICE_REPLACED).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&data).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetTaxInvoiceByID returns a tax invoice by ID.
+func (ts *TaxService) GetTaxInvoiceByID(id string) (*models.TaxInvoiceModel, error) {
+	var data models.TaxInvoiceModel
+	if err := ts.db.Where("id = ?", id).First(&data).Error; err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetTaxInvoices returns a paginated page of TaxInvoiceModel of the company in the
+// request header. The search string is matched against the serial number, the
+// name of the customer or supplier and the document reference. The direction,
+// status, month and year query parameters filter the result.
+func (ts *TaxService) GetTaxInvoices(request *http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := ts.db.Model(&models.TaxInvoiceModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if search != "" {
+		stmt = stmt.Where("serial_number ILIKE ? OR name ILIKE ? OR reference ILIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+	for _, column := range []string{"direction", "status", "month", "year"} {
+		if request.URL.Query().Get(column) != "" {
+			stmt = stmt.Where(column+" = ?", request.URL.Query().Get(column))
+		}
+	}
+	stmt = stmt.Order("date desc, serial_number desc")
+	utils.FixRequest(request)
+	page := pg.With(stmt).Request(request).Response(&[]models.TaxInvoiceModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// ExportOutputTaxInvoices writes the output tax invoices of a company for a tax
+// period in the e-Faktur CSV import format and marks them as exported. Replaced
+// tax invoices are written before their replacement; cancelled ones are left out.
+func (ts *TaxService) ExportOutputTaxInvoices(companyID string, month, year int, w io.Writer) error {
+	return ts.export(companyID, models.TAX_INVOICE_OUTPUT, month, year, w)
+}
+
+// ExportInputTaxInvoices writes the input tax invoices of a company for a tax
+// period in the e-Faktur CSV import format and marks them as exported.
+func (ts *TaxService) ExportInputTaxInvoices(companyID string, month, year int, w io.Writer) error {
+	return ts.export(companyID, models.TAX_INVOICE_INPUT, month, year, w)
+}
+
+func (ts *TaxService) export(companyID, direction string, month, year int, w io.Writer) error {
+	var invoices []models.TaxInvoiceModel
+	err := ts.db.Where("company_id = ? AND direction = ? AND month = ? AND year = ? AND status <> ?", companyID, direction, month, year, models.TAX_INVOICE_CANCELLED).
+		Order("serial_number asc, is_replacement asc, created_at asc").
+		Find(&invoices).Error
+	if err != nil {
+		return err
+	}
+	rows := []efaktur.Invoice{}
+	ids := []string{}
+	for _, v := range invoices {
+		row := efaktur.Invoice{
+			TransactionCode: v.TransactionCode,
+			Replacement:     v.IsReplacement,
+			SerialNumber:    v.SerialNumber,
+			Date:            v.Date,
+			TaxPayerNumber:  v.TaxPayerNumber,
+			Name:            v.Name,
+			Address:         v.Address,
+			TaxBase:         v.TaxBase,
+			VAT:             v.VAT,
+			Reference:       v.Reference,
+			Creditable:      v.Creditable,
+		}
+		if v.Objects != "" {
+			objects := []models.TaxInvoiceObject{}
+			if err := json.Unmarshal([]byte(v.Objects), &objects); err != nil {
+				return err
+			}
+			for _, o := range objects {
+				row.Objects = append(row.Objects, efaktur.Object(o))
+			}
+		}
+		rows = append(rows, row)
+		ids = append(ids, v.ID)
+	}
+	if direction == models.TAX_INVOICE_OUTPUT {
+		err = efaktur.WriteOutput(w, rows)
+	} else {
+		err = efaktur.WriteInput(w, rows)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ts.db.Model(&models.TaxInvoiceModel{}).Where("id IN (?)", ids).Update("exported_at", time.Now()).Error
+}
+
+// GetVATRecap returns the PPN recap of a company for a tax period.
+//
+// The recap sums the issued output tax invoices and the creditable input tax
+// invoices of the period, and compares them with the movements of the month on
+// the accounts of the PPN taxes: the payable account for output tax and the
+// receivable account for input tax. Posted sales invoices and bills of the month
+// with tax but without a tax invoice are listed by number. The month runs in UTC,
+// like the other monthly reports.
+func (ts *TaxService) GetVATRecap(companyID string, month, year int) (*models.VATRecap, error) {
+	if month < 1 || month > 12 {
+		return nil, errors.New("invalid month")
+	}
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	recap := models.VATRecap{
+		Month:               month,
+		Year:                year,
+		Accounts:            []models.VATRecapAccount{},
+		UninvoicedSales:     []string{},
+		UninvoicedPurchases: []string{},
+	}
+
+	var invoices []models.TaxInvoiceModel
+	err := ts.db.Where("company_id = ? AND month = ? AND year = ? AND status = ?", companyID, month, year, models.TAX_INVOICE_ISSUED).Find(&invoices).Error
+	if err != nil {
+		return nil, err
+	}
+	var outputBase, outputVAT, inputBase, inputVAT money.Amount
+	for _, v := range invoices {
+		if v.Direction == models.TAX_INVOICE_OUTPUT {
+			recap.OutputInvoices++
+			outputBase = outputBase.Add(money.FromFloat(v.TaxBase))
+			outputVAT = outputVAT.Add(money.FromFloat(v.VAT))
+		} else if v.Creditable {
+			recap.InputInvoices++
+			inputBase = inputBase.Add(money.FromFloat(v.TaxBase))
+			inputVAT = inputVAT.Add(money.FromFloat(v.VAT))
+		}
+	}
+
+	var taxes []models.TaxModel
+	if err := ts.db.Where("company_id = ? AND tax_type = ?", companyID, models.TAX_TYPE_PPN).Find(&taxes).Error; err != nil {
+		return nil, err
+	}
+	payables := map[string]bool{}
+	receivables := map[string]bool{}
+	accountIDs := []string{}
+	for _, v := range taxes {
+		if v.AccountPayableID != nil && !payables[*v.AccountPayableID] {
+			payables[*v.AccountPayableID] = true
+			accountIDs = append(accountIDs, *v.AccountPayableID)
+		}
+		if v.AccountReceivableID != nil && !receivables[*v.AccountReceivableID] {
+			receivables[*v.AccountReceivableID] = true
+			accountIDs = append(accountIDs, *v.AccountReceivableID)
+		}
+	}
+	var ledgerOutput, ledgerInput money.Amount
+	if len(accountIDs) > 0 {
+		err := ts.db.Model(&models.TransactionModel{}).
+			Select("accounts.id, accounts.code, accounts.name, sum(transactions.debit) as debit, sum(transactions.credit) as credit").
+			Joins("JOIN accounts ON accounts.id = transactions.account_id").
+			Where("transactions.company_id = ? AND transactions.is_draft = ?", companyID, false).
+			Where("transactions.account_id IN (?)", accountIDs).
+			Where("transactions.date >= ? AND transactions.date < ?", start, end).
+			Group("accounts.id, accounts.code, accounts.name").
+			Order("accounts.code asc").
+			Scan(&recap.Accounts).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range recap.Accounts {
+			if payables[v.ID] {
+				ledgerOutput = ledgerOutput.Add(money.FromFloat(v.Credit)).Sub(money.FromFloat(v.Debit))
+			}
+			if receivables[v.ID] {
+				ledgerInput = ledgerInput.Add(money.FromFloat(v.Debit)).Sub(money.FromFloat(v.Credit))
+			}
+		}
+	}
+
+	sources := []struct {
+		table, number, date, documentType, refColumn string
+		result                                       *[]string
+	}{
+		{"sales", "sales_number", "sales_date", string(models.INVOICE), "sales_id", &recap.UninvoicedSales},
+		{"purchase_orders", "purchase_number", "purchase_date", string(models.BILL), "purchase_id", &recap.UninvoicedPurchases},
+	}
+	for _, v := range sources {
+		err := ts.db.Table(v.table).
+			Where(v.table+".company_id = ? AND "+v.table+".document_type = ? AND "+v.table+".published_at IS NOT NULL", companyID, v.documentType).
+			Where(v.table+"."+v.date+" >= ? AND "+v.table+"."+v.date+" < ?", start, end).
+			Where(v.table+".total_tax <> 0 AND "+v.table+".deleted_at IS NULL").
+			Where("NOT EXISTS (SELECT 1 FROM tax_invoices WHERE tax_invoices."+v.refColumn+" = "+v.table+".id AND tax_invoices.status = ? AND tax_invoices.deleted_at IS NULL)", models.TAX_INVOICE_ISSUED).
+			Order(v.table+"."+v.number+" asc").
+			Pluck(v.table+"."+v.number, v.result).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	recap.OutputTaxBase = outputBase.Float64()
+	recap.OutputVAT = outputVAT.Float64()
+	recap.InputTaxBase = inputBase.Float64()
+	recap.InputVAT = inputVAT.Float64()
+	recap.NetVAT = outputVAT.Sub(inputVAT).Float64()
+	recap.LedgerOutputVAT = ledgerOutput.Float64()
+	recap.LedgerInputVAT = ledgerInput.Float64()
+	recap.OutputDifference = ledgerOutput.Sub(outputVAT).Float64()
+	recap.InputDifference = ledgerInput.Sub(inputVAT).Float64()
+	return &recap, nil
+}
+
+// nextSerial issues the next serial number from the ranges of a company for a
+// year. The ranges are locked until the transaction ends.
+func (ts *TaxService) nextSerial(tx *gorm.DB, companyID string, year int) (string, error) {
+	var ranges []models.TaxInvoiceSerialRangeModel
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("company_id = ? AND year = ? AND (last_serial = '' OR last_serial IS NULL OR last_serial < end_serial)", companyID, year).
+		Order("start_serial asc").
+		Find(&ranges).Error
+	if err != nil {
+		return "", err
+	}
+	if len(ranges) == 0 {
+		return "", fmt.Errorf("no tax invoice serial numbers left for %d", year)
+	}
+	r := ranges[0]
+	serial := r.StartSerial
+	if r.LastSerial != "" {
+		last, err := strconv.ParseInt(r.LastSerial, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		serial = efaktur.FormatSerial(last + 1)
+	}
+	if err := tx.Model(&r).Update("last_serial", serial).Error; err != nil {
+		return "", err
+	}
+	return serial, nil
+}
+
+// salesTaxInvoice builds the output tax invoice of a sales invoice without its
+// serial number. The PPN of the invoice itself is split over all items in
+// proportion to their subtotals.
+func salesTaxInvoice(sales *models.SalesModel, transactionCode string, rounding money.Rounding) (*models.TaxInvoiceModel, error) {
+	rate := exchangeRate(sales.ExchangeRate)
+	weights := make([]money.Amount, len(sales.Items))
+	var subtotal money.Amount
+	for i, v := range sales.Items {
+		weights[i] = money.FromFloat(v.SubTotal)
+		subtotal = subtotal.Add(weights[i])
+	}
+	documentVAT := make([]money.Amount, len(sales.Items))
+	if total := documentVATAmount(sales, rounding.Document(subtotal), rounding); !total.IsZero() {
+		documentVAT = total.Allocate(weights, rounding.Precision)
+	}
+	objects := []models.TaxInvoiceObject{}
+	var taxBase, vat money.Amount
+	for i, v := range sales.Items {
+		itemVAT := documentVAT[i]
+		if isVAT(v.Tax) {
+			itemVAT = itemVAT.Add(money.FromFloat(v.TotalTax))
+		} else if itemVAT.IsZero() {
+			continue
+		}
+		code := ""
+		name := v.Description
+		if v.Product != nil {
+			if v.Product.SKU != nil {
+				code = *v.Product.SKU
+			}
+			if name == "" {
+				name = v.Product.Name
+			}
+		}
+		base := money.FromFloat(v.SubTotal).Mul(rate)
+		tax := itemVAT.Mul(rate)
+		objects = append(objects, models.TaxInvoiceObject{
+			Code:      code,
+			Name:      name,
+			UnitPrice: money.FromFloat(v.UnitPrice).Mul(rate).Float64(),
+			Quantity:  v.Quantity,
+			Total:     money.FromFloat(v.SubtotalBeforeDisc).Mul(rate).Float64(),
+			Discount:  money.FromFloat(v.DiscountAmount).Mul(rate).Float64(),
+			TaxBase:   base.Float64(),
+			VAT:       tax.Float64(),
+		})
+		taxBase = taxBase.Add(base)
+		vat = vat.Add(tax)
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("sales invoice has no PPN items")
+	}
+	b, err := json.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+	data := models.TaxInvoiceModel{
+		CompanyID:       sales.CompanyID,
+		Direction:       models.TAX_INVOICE_OUTPUT,
+		SalesID:         &sales.ID,
+		ContactID:       sales.ContactID,
+		TransactionCode: transactionCode,
+		Date:            sales.SalesDate,
+		Month:           int(sales.SalesDate.Month()),
+		Year:            sales.SalesDate.Year(),
+		Reference:       sales.SalesNumber,
+		TaxBase:         wholeRupiah(taxBase),
+		VAT:             wholeRupiah(vat),
+		Objects:         string(b),
+		Creditable:      true,
+		Status:          models.TAX_INVOICE_ISSUED,
+	}
+	setCounterparty(&data, sales.Contact)
+	return &data, nil
+}
+
+// documentVATAmount returns the PPN of the taxes of a sales invoice itself on the
+// subtotal of its items, computed as the sales module computes the taxes of the
+// invoice: compound taxes are charged on the subtotal plus the taxes before them.
+func documentVATAmount(sales *models.SalesModel, subtotal money.Amount, rounding money.Rounding) money.Amount {
+	base := subtotal
+	var vat money.Amount
+	for _, tax := range sales.Taxes {
+		if tax == nil || tax.IsWithholding() {
+			continue
+		}
+		amount := rounding.Line(base.Percent(tax.Amount))
+		if isVAT(tax) {
+			vat = vat.Add(amount)
+		}
+		if sales.IsCompound {
+			base = base.Add(amount)
+		}
+	}
+	return rounding.Document(vat)
+}
+
+func setCounterparty(data *models.TaxInvoiceModel, contact *models.ContactModel) {
+	if contact == nil {
+		return
+	}
+	data.TaxPayerNumber = efaktur.TaxPayerNumber(contact.TaxPayerNumber)
+	data.Name = contact.Name
+	data.Address = contact.Address
+}
+
+func isVAT(tax *models.TaxModel) bool {
+	return tax != nil && tax.TaxType == models.TAX_TYPE_PPN
+}
+
+func exchangeRate(rate float64) float64 {
+	if rate <= 0 {
+		return 1
+	}
+	return rate
+}
+
+// wholeRupiah truncates an amount to whole rupiah, as e-Faktur requires.
+func wholeRupiah(amount money.Amount) float64 {
+	return float64(int64(amount.Float64()))
+}
+
+func validateTransactionCode(code string) error {
+	n, err := strconv.Atoi(code)
+	if err != nil || len(code) != 2 || n < 1 || n > 10 {
+		return fmt.Errorf("invalid tax invoice transaction code %q", code)
+	}
+	return nil
+}
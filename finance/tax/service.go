@@ -31,12 +31,13 @@ func NewTaxService(db *gorm.DB, ctx *context.ERPContext, accountService *account
 	}
 }
 
-// Migrate runs the database migration for the TaxModel.
+// Migrate runs the database migration for the TaxModel, TaxInvoiceSerialRangeModel,
+// TaxInvoiceModel and WithholdingSlipModel.
 //
 // The method takes a GORM database instance and returns an error if the migration
-// fails. The migration is required to create the tax table in the database.
+// fails. The migration is required to create the tax tables in the database.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.TaxModel{})
+	return db.AutoMigrate(&models.TaxModel{}, &models.TaxInvoiceSerialRangeModel{}, &models.TaxInvoiceModel{}, &models.WithholdingSlipModel{}, &models.WithholdingSlipCounterModel{})
 }
 
 // GetTaxes returns a paginated page of TaxModel, with optional search query.
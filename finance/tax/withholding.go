@@ -0,0 +1,178 @@
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/ebupot"
+	"github.com/AMETORY/ametory-erp-modules/utils/efaktur"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateWithholdingSlip creates a withholding slip in the given transaction,
+// which is the transaction of the payment the tax is withheld on.
+//
+// The vendor or customer data is copied from the slip's contact. Slips issued by
+// the company (models.WITHHOLDING_SLIP_ISSUED) are numbered per company and tax
+// period as BP/<year>/<month>/<sequence>; slips received from customers keep the
+// number the customer gave them.
+func (ts *TaxService) CreateWithholdingSlip(tx *gorm.DB, slip *models.WithholdingSlipModel) error {
+	if slip.CompanyID == nil {
+		return errors.New("company is required")
+	}
+	slip.Month = int(slip.Date.Month())
+	slip.Year = slip.Date.Year()
+	slip.Status = models.WITHHOLDING_SLIP_ACTIVE
+	if slip.ContactID != nil {
+		var contact models.ContactModel
+		if err := tx.Where("id = ?", *slip.ContactID).First(&contact).Error; err == nil {
+			slip.TaxPayerNumber = efaktur.TaxPayerNumber(contact.TaxPayerNumber)
+			slip.Name = contact.Name
+			slip.Address = contact.Address
+		}
+	}
+	switch slip.Direction {
+	case models.WITHHOLDING_SLIP_ISSUED:
+		sequence, err := ts.nextSlipSequence(tx, *slip.CompanyID, slip.Year, slip.Month)
+		if err != nil {
+			return err
+		}
+		slip.Number = fmt.Sprintf("BP/%04d/%02d/%05d", slip.Year, slip.Month, sequence)
+	case models.WITHHOLDING_SLIP_RECEIVED:
+		if slip.Number == "" {
+			return errors.New("withholding slip number from the customer is required")
+		}
+	default:
+		return errors.New("invalid withholding slip direction")
+	}
+	return tx.Create(slip).Error
+}
+
+// nextSlipSequence issues the next sequence of the withholding slips a company
+// issues in a tax period. The counter of the period is locked until the
+// transaction ends; it starts from the slips already issued in the period.
+func (ts *TaxService) nextSlipSequence(tx *gorm.DB, companyID string, year, month int) (int64, error) {
+	var count int64
+	err := tx.Unscoped().Model(&models.WithholdingSlipModel{}).
+		Where("company_id = ? AND direction = ? AND month = ? AND year = ?", companyID, models.WITHHOLDING_SLIP_ISSUED, month, year).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.WithholdingSlipCounterModel{
+		CompanyID:    companyID,
+		Year:         year,
+		Month:        month,
+		LastSequence: count,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+	var counter models.WithholdingSlipCounterModel
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("company_id = ? AND year = ? AND month = ?", companyID, year, month).
+		First(&counter).Error
+	if err != nil {
+		return 0, err
+	}
+	counter.LastSequence++
+	err = tx.Model(&models.WithholdingSlipCounterModel{}).
+		Where("company_id = ? AND year = ? AND month = ?", companyID, year, month).
+		Update("last_sequence", counter.LastSequence).Error
+	return counter.LastSequence, err
+}
+
+// GetWithholdingSlipByID returns a withholding slip by ID.
+func (ts *TaxService) GetWithholdingSlipByID(id string) (*models.WithholdingSlipModel, error) {
+	var data models.WithholdingSlipModel
+	if err := ts.db.Preload("Tax").Where("id = ?", id).First(&data).Error; err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetWithholdingSlips returns a paginated page of WithholdingSlipModel of the
+// company in the request header. The search string is matched against the slip
+// number, the name of the vendor or customer and the document reference. The
+// direction, contact_id, tax_type, status, month and year query parameters
+// filter the result, e.g. to list the slips of a vendor for a tax period.
+func (ts *TaxService) GetWithholdingSlips(request *http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := ts.db.Preload("Tax").Model(&models.WithholdingSlipModel{})
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if search != "" {
+		stmt = stmt.Where("number ILIKE ? OR name ILIKE ? OR reference ILIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+	for _, column := range []string{"direction", "contact_id", "tax_type", "status", "month", "year"} {
+		if request.URL.Query().Get(column) != "" {
+			stmt = stmt.Where(column+" = ?", request.URL.Query().Get(column))
+		}
+	}
+	stmt = stmt.Order("date desc, number desc")
+	utils.FixRequest(request)
+	page := pg.With(stmt).Request(request).Response(&[]models.WithholdingSlipModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// CancelWithholdingSlip cancels a withholding slip. The journal of the payment
+// is not changed; the slip is only left out of the export. Its number is not
+// issued again.
+func (ts *TaxService) CancelWithholdingSlip(id string) error {
+	data, err := ts.GetWithholdingSlipByID(id)
+	if err != nil {
+		return err
+	}
+	if data.Status == models.WITHHOLDING_SLIP_CANCELLED {
+		return errors.New("withholding slip is already cancelled")
+	}
+	return ts.db.Model(data).Update("status", models.WITHHOLDING_SLIP_CANCELLED).Error
+}
+
+// ExportWithholdingSlips writes the active slips the company issued for a tax
+// period in the e-Bupot import layout and marks them as exported.
+func (ts *TaxService) ExportWithholdingSlips(companyID string, month, year int, w io.Writer) error {
+	var slips []models.WithholdingSlipModel
+	err := ts.db.Preload("Contact").
+		Where("company_id = ? AND direction = ? AND month = ? AND year = ? AND status = ?", companyID, models.WITHHOLDING_SLIP_ISSUED, month, year, models.WITHHOLDING_SLIP_ACTIVE).
+		Order("number asc").
+		Find(&slips).Error
+	if err != nil {
+		return err
+	}
+	rows := []ebupot.Slip{}
+	ids := []string{}
+	for _, v := range slips {
+		row := ebupot.Slip{
+			Number:         v.Number,
+			Date:           v.Date,
+			TaxPayerNumber: v.TaxPayerNumber,
+			TaxObjectCode:  v.TaxObjectCode,
+			TaxBase:        v.TaxBase,
+			Rate:           v.Rate,
+			Amount:         v.Amount,
+			Reference:      v.Reference,
+		}
+		if v.Contact != nil && v.Contact.Phone != nil {
+			row.Phone = *v.Contact.Phone
+		}
+		rows = append(rows, row)
+		ids = append(ids, v.ID)
+	}
+	if err := ebupot.WriteSlips(w, rows); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ts.db.Model(&models.WithholdingSlipModel{}).Where("id IN (?)", ids).Update("exported_at", time.Now()).Error
+}
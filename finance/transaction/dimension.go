@@ -0,0 +1,60 @@
+package transaction
+
+import (
+	"errors"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"gorm.io/gorm"
+)
+
+// GetAnalyticDimensionTypes returns the active analytic dimensions of a company.
+// A company that has not set up its dimension types uses all of
+// models.AnalyticDimensionTypes.
+func (s *TransactionService) GetAnalyticDimensionTypes(companyID string) ([]models.AnalyticDimensionType, error) {
+	return models.GetCompanyAnalyticDimensionTypes(s.db, companyID)
+}
+
+// GetAnalyticDimensionTypeSettings returns the analytic dimension types the
+// company has set up, active or not.
+func (s *TransactionService) GetAnalyticDimensionTypeSettings(companyID string) ([]models.AnalyticDimensionTypeModel, error) {
+	var types []models.AnalyticDimensionTypeModel
+	err := s.db.Where("company_id = ?", companyID).Order("name asc").Find(&types).Error
+	return types, err
+}
+
+// SetAnalyticDimensionType sets up an analytic dimension of a company, replacing
+// the label and active flag of an existing setting of the same name.
+//
+// The name must be one of models.AnalyticDimensionTypes. Once a company has set
+// up any dimension type, only its active ones can be put on ledger lines and
+// used as report filters.
+func (s *TransactionService) SetAnalyticDimensionType(companyID string, data *models.AnalyticDimensionTypeModel) error {
+	dimension, err := models.GetAnalyticDimensionType(data.Name)
+	if err != nil {
+		return err
+	}
+	if data.Label == "" {
+		data.Label = dimension.Label
+	}
+	data.CompanyID = &companyID
+
+	var existing models.AnalyticDimensionTypeModel
+	err = s.db.Where("company_id = ? AND name = ?", companyID, data.Name).First(&existing).Error
+	if err == nil {
+		data.ID = existing.ID
+		return s.db.Model(&existing).Updates(map[string]any{
+			"label":     data.Label,
+			"is_active": data.IsActive,
+		}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return s.db.Create(data).Error
+}
+
+// DeleteAnalyticDimensionType removes the setting of an analytic dimension of a
+// company. Ledger lines already holding the dimension keep it.
+func (s *TransactionService) DeleteAnalyticDimensionType(companyID, name string) error {
+	return s.db.Where("company_id = ? AND name = ?", companyID, name).Delete(&models.AnalyticDimensionTypeModel{}).Error
+}
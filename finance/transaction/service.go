@@ -1,12 +1,15 @@
 package transaction
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance/account"
+	"github.com/AMETORY/ametory-erp-modules/finance/currency"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
 	"github.com/google/uuid"
@@ -14,6 +17,10 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrPostedJournalLine is returned when a line of a posted journal is changed.
+// Posted journals are corrected by reversing them.
+var ErrPostedJournalLine = errors.New("transaction belongs to a posted journal, reverse the journal instead")
+
 type TransactionService struct {
 	db             *gorm.DB
 	ctx            *context.ERPContext
@@ -33,9 +40,10 @@ func NewTransactionService(db *gorm.DB, ctx *context.ERPContext, accountService
 }
 
 // Migrate runs the database migration for the transaction module. It creates the
-// transactions table with the required columns and indexes.
+// transactions and analytic dimension types tables with the required columns and
+// indexes.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.TransactionModel{})
+	return db.AutoMigrate(&models.TransactionModel{}, &models.AnalyticDimensionTypeModel{})
 }
 func (s *TransactionService) SetDB(db *gorm.DB) {
 	s.db = db
@@ -45,8 +53,25 @@ func (s *TransactionService) SetDB(db *gorm.DB) {
 // transaction's AccountID is set, the transaction is associated with the
 // specified account. If the transaction's SourceID is set, a transfer
 // transaction is created.
+//
+// The amount is always in the functional currency of the company. When the
+// transaction carries a foreign CurrencyCode and ExchangeRate, the document
+// currency amount is kept in ForeignAmount. A realized or unrealized exchange
+// difference (IsFxDifference) has no foreign amount and keeps the debit or credit
+// set by the caller, as one FX account holds both gains and losses.
+//
+// A *period.PeriodLockedError is returned if the transaction date is in a locked period.
+// The analytic dimensions of the transaction must be active dimensions of the
+// company, see models.CheckAnalyticDimensions.
 func (s *TransactionService) CreateTransaction(transaction *models.TransactionModel, amount float64) error {
+	if err := period.Check(s.db, transaction.CompanyID, postingModule(transaction), transaction.Date); err != nil {
+		return err
+	}
+	if err := models.CheckAnalyticDimensions(s.db, transaction.CompanyID, transaction.AnalyticDimensions); err != nil {
+		return err
+	}
 	code := utils.RandString(10, false)
+	s.applyCurrency(transaction, amount)
 	if transaction.AccountID != nil {
 		if transaction.ID == "" {
 			transaction.ID = uuid.New().String()
@@ -57,7 +82,9 @@ func (s *TransactionService) CreateTransaction(transaction *models.TransactionMo
 		if err != nil {
 			return err
 		}
-		s.UpdateCreditDebit(transaction, account.Type)
+		if !transaction.IsFxDifference {
+			s.UpdateCreditDebit(transaction, account.Type)
+		}
 
 		if err := s.db.Create(transaction).Error; err != nil {
 			return err
@@ -132,6 +159,41 @@ func (s *TransactionService) CreateTransaction(transaction *models.TransactionMo
 	return nil
 }
 
+// applyCurrency fills the exchange rate and foreign amount of a transaction.
+//
+// A missing or invalid rate defaults to 1. The foreign amount is derived from the
+// functional amount only when the transaction is in a foreign currency and the
+// caller did not set it, so lines in the functional currency posted to a foreign
+// bank account do not count as foreign units in the revaluation.
+func (s *TransactionService) applyCurrency(transaction *models.TransactionModel, amount float64) {
+	if transaction.ExchangeRate <= 0 {
+		transaction.ExchangeRate = 1
+	}
+	if transaction.ForeignAmount != 0 || transaction.IsFxDifference || transaction.CompanyID == nil {
+		return
+	}
+	if currency.NewCurrencyService(s.db, s.ctx).IsForeign(*transaction.CompanyID, transaction.CurrencyCode) {
+		transaction.ForeignAmount = amount / transaction.ExchangeRate
+	}
+}
+
+// postingModule returns the module a transaction is posted from, which is
+// matched against module period locks.
+func postingModule(transaction *models.TransactionModel) string {
+	if transaction.TransactionSecondaryRefType != "" {
+		return transaction.TransactionSecondaryRefType
+	}
+	if transaction.TransactionRefType != "transaction" {
+		return transaction.TransactionRefType
+	}
+	return ""
+}
+
+// isPostedJournalLine reports whether a transaction is a line of a posted journal.
+func isPostedJournalLine(transaction *models.TransactionModel) bool {
+	return transaction.TransactionSecondaryRefType == "journal" && !transaction.IsDraft
+}
+
 // UpdateTransaction updates a transaction by its ID. It takes a string ID and a pointer
 // to a TransactionModel as its arguments. The TransactionModel instance contains the
 // updated values for the transaction.
@@ -141,9 +203,30 @@ func (s *TransactionService) CreateTransaction(transaction *models.TransactionMo
 //
 // The method is run inside a transaction. If the transaction has a counter-part
 // transaction with the same code, the counter-part transaction is updated as well.
+// Neither the current nor the new date may be in a locked period, the analytic
+// dimensions must be active dimensions of the company, and lines of a posted
+// journal can not be updated.
 func (s *TransactionService) UpdateTransaction(id string, transaction *models.TransactionModel) error {
 	// return s.db.Where("id = ?", id).Updates(transaction).Error
 	return s.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.TransactionModel
+		if err := tx.Where("id = ?", id).First(&existing).Error; err != nil {
+			return err
+		}
+		if isPostedJournalLine(&existing) {
+			return ErrPostedJournalLine
+		}
+		if err := period.Check(tx, existing.CompanyID, postingModule(&existing), existing.Date); err != nil {
+			return err
+		}
+		if !transaction.Date.IsZero() {
+			if err := period.Check(tx, existing.CompanyID, postingModule(&existing), transaction.Date); err != nil {
+				return err
+			}
+		}
+		if err := models.CheckAnalyticDimensions(tx, existing.CompanyID, transaction.AnalyticDimensions); err != nil {
+			return err
+		}
 		if transaction.Debit > 0 {
 			transaction.Debit = transaction.Amount
 		}
@@ -185,7 +268,8 @@ func (s *TransactionService) UpdateTransaction(id string, transaction *models.Tr
 // It returns an error if the deletion operation fails. Before deleting the
 // transaction, it retrieves the transaction data to get the transaction code.
 // After deleting the transaction, it deletes the counter-part transaction with
-// the same code.
+// the same code. Transactions in a locked period and lines of a posted journal
+// can not be deleted.
 func (s *TransactionService) DeleteTransaction(id string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		var data models.TransactionModel
@@ -193,6 +277,12 @@ func (s *TransactionService) DeleteTransaction(id string) error {
 		if err != nil {
 			return err
 		}
+		if isPostedJournalLine(&data) {
+			return ErrPostedJournalLine
+		}
+		if err := period.Check(tx, data.CompanyID, postingModule(&data), data.Date); err != nil {
+			return err
+		}
 		err = tx.Where("id = ?", id).Delete(&models.TransactionModel{}).Error
 		if err != nil {
 			return err
@@ -238,7 +328,7 @@ func (s *TransactionService) GetTransactionByCode(code string) ([]models.Transac
 
 func (s *TransactionService) GetTransactionByDate(from, to time.Time, request http.Request) (paginate.Page, error) {
 	pg := paginate.New()
-	stmt := s.db.Where("date BETWEEN ? AND ?", from, to)
+	stmt := s.db.Where("date BETWEEN ? AND ? AND is_draft = ?", from, to, false)
 	if request.Header.Get("ID-Company") != "" {
 		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
 	}
@@ -255,7 +345,7 @@ func (s *TransactionService) GetTransactionByDate(from, to time.Time, request ht
 // pagination to manage the result set.
 func (s *TransactionService) GetByDateAndCompanyId(from, to time.Time, companyId string, page, limit int) ([]models.TransactionModel, error) {
 	var transactions []models.TransactionModel
-	err := s.db.Where("date BETWEEN ? AND ? AND company_id = ?", from, to, companyId).
+	err := s.db.Where("date BETWEEN ? AND ? AND company_id = ? AND is_draft = ?", from, to, companyId, false).
 		Offset((page - 1) * limit).Limit(limit).Find(&transactions).Error
 	return transactions, err
 }
@@ -280,6 +370,7 @@ func (s *TransactionService) GetTransactionsByAccountID(accountID string, startD
 		stmt = stmt.Where("transactions.date < ?", *endDate)
 	}
 	stmt = stmt.Where("transactions.account_id = ?", accountID)
+	stmt = stmt.Where("transactions.is_draft = ?", false)
 	stmt = stmt.Model(&models.TransactionModel{})
 	utils.FixRequest(&request)
 	page := pg.With(stmt).Request(request).Response(&[]models.TransactionModel{})
@@ -344,6 +435,7 @@ func (s *TransactionService) GetTransactions(request http.Request, search string
 	if request.URL.Query().Get("account_id") != "" {
 		stmt = stmt.Where("transactions.account_id = ?", request.URL.Query().Get("account_id"))
 	}
+	stmt = stmt.Where("transactions.is_draft = ?", false)
 
 	if request.URL.Query().Get("start_date") != "" && request.URL.Query().Get("end_date") != "" {
 		stmt = stmt.Where("transactions.date between ? and ?", request.URL.Query().Get("start_date"), request.URL.Query().Get("end_date"))
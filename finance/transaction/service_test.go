@@ -0,0 +1,33 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+)
+
+func TestUpdateCreditDebit(t *testing.T) {
+	var tests = []struct {
+		name        string
+		accountType models.AccountType
+		isExpense   bool
+		debit       float64
+		credit      float64
+	}{
+		{"cash receipt", models.ASSET, false, 100, 0},
+		{"cash payout", models.ASSET, true, 0, 100},
+		{"expense", models.EXPENSE, true, 100, 0},
+		{"payable", models.LIABILITY, false, 0, 100},
+	}
+
+	s := &TransactionService{}
+	for _, test := range tests {
+		transaction := &models.TransactionModel{Amount: 100, IsExpense: test.isExpense}
+		if _, err := s.UpdateCreditDebit(transaction, test.accountType); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if transaction.Debit != test.debit || transaction.Credit != test.credit {
+			t.Errorf("%s: debit %v, credit %v, want debit %v, credit %v", test.name, transaction.Debit, transaction.Credit, test.debit, test.credit)
+		}
+	}
+}
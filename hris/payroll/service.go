@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance"
 	"github.com/AMETORY/ametory-erp-modules/hris/employee"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
@@ -162,30 +163,88 @@ func (s *PayrollService) GetPayRollCostFromPayroll(payRollID string) ([]*models.
 //
 // The function takes a payroll ID and a TransactionModel as input. It sets the
 // TransactionRefID and TransactionRefType fields of the transaction to the
-// provided payroll ID and "payroll" respectively, then attempts to create a new
-// transaction record in the database. It returns an error if the creation fails.
+// provided payroll ID and "payroll" respectively, then posts the transaction
+// through the TransactionService of the finance module, which refuses payments in
+// a locked period or with inactive analytic dimensions. It returns an error if
+// the posting fails. Analytic dimensions not set on the payment default to the
+// employee's branch and organization, as far as the company uses them. The
+// payment keeps its debit or credit side; a payout from a cash/bank account is
+// posted as an expense so it is credited.
 func (s *PayrollService) AddPayment(payRollID string, payment *models.TransactionModel) error {
+	var payRoll models.PayRollModel
+	if err := s.db.Preload("Employee").First(&payRoll, "id = ?", payRollID).Error; err != nil {
+		return err
+	}
+	if payRoll.Employee != nil {
+		dimensions, err := models.ActiveAnalyticDimensions(s.db, payment.CompanyID, payRoll.Employee.Dimensions())
+		if err != nil {
+			return err
+		}
+		payment.InheritFrom(dimensions)
+	}
 	payment.TransactionRefID = &payRollID
 	payment.TransactionRefType = "payroll"
-	return s.db.Create(payment).Error
+	// A payout credits the cash/bank account, which UpdateCreditDebit only
+	// keeps on the credit side for expenses.
+	if payment.Credit > 0 {
+		payment.IsExpense = true
+	}
+	amount := payment.Amount
+	if amount == 0 {
+		amount = payment.Debit + payment.Credit
+	}
+	financeService, err := s.financeService()
+	if err != nil {
+		return err
+	}
+	return financeService.TransactionService.CreateTransaction(payment, amount)
 }
 
 // DeletePayment deletes a payment transaction associated with a payroll record.
 //
 // The function takes the ID of the transaction to be deleted as input and
-// attempts to delete the corresponding record in the database. It returns an
-// error if the deletion fails.
+// deletes it through the TransactionService of the finance module, together with
+// its counter-part, unless it is in a locked period. It returns an error if the
+// deletion fails.
 func (s *PayrollService) DeletePayment(paymentID string) error {
-	return s.db.Delete(&models.TransactionModel{}, "id = ? and transaction_ref_type = ?", paymentID, "payroll").Error
+	financeService, err := s.financeService()
+	if err != nil {
+		return err
+	}
+	var payment models.TransactionModel
+	if err := s.db.Where("id = ? and transaction_ref_type = ?", paymentID, "payroll").First(&payment).Error; err != nil {
+		return err
+	}
+	return financeService.TransactionService.DeleteTransaction(payment.ID)
 }
 
 // UpdatePayment updates a payment transaction associated with a payroll record.
 //
-// The function takes a TransactionModel as input and attempts to update the
-// corresponding record in the database. It returns an error if the update
-// fails.
+// The function takes a TransactionModel as input and updates it through the
+// TransactionService of the finance module, which refuses changes in a locked
+// period. It returns an error if the update fails.
 func (s *PayrollService) UpdatePayment(payment *models.TransactionModel) error {
-	return s.db.Save(payment).Error
+	financeService, err := s.financeService()
+	if err != nil {
+		return err
+	}
+	var count int64
+	if err := s.db.Model(&models.TransactionModel{}).Where("id = ? and transaction_ref_type = ?", payment.ID, "payroll").Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("payroll payment not found")
+	}
+	return financeService.TransactionService.UpdateTransaction(payment.ID, payment)
+}
+
+// financeService returns the finance module the payments are posted with.
+func (s *PayrollService) financeService() (*finance.FinanceService, error) {
+	financeService, ok := s.ctx.FinanceService.(*finance.FinanceService)
+	if !ok {
+		return nil, errors.New("finance service not found")
+	}
+	return financeService, nil
 }
 
 // ResetBPJS resets the BPJS configuration for a given payroll record to the default
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance"
 	"github.com/AMETORY/ametory-erp-modules/hris/employee"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
@@ -162,6 +163,48 @@ func (s *ReimbursementService) Delete(id string) error {
 	return s.db.Where("id = ?", id).Delete(&models.ReimbursementModel{}).Error
 }
 
+// AddPayment creates a payment transaction associated with a reimbursement.
+//
+// The function sets the TransactionRefID and TransactionRefType fields of the
+// transaction to the reimbursement ID and "reimbursement" and marks it as a
+// reimbursement payment. The payment is posted through the TransactionService of
+// the finance module, which refuses payments in a locked period or with inactive
+// analytic dimensions. Analytic dimensions not set on the payment default to
+// those of the reimbursement, then to the employee's branch and organization as
+// far as the company uses them. The payment keeps its debit or credit side; a
+// payout from a cash/bank account is posted as an expense so it is credited.
+func (s *ReimbursementService) AddPayment(reimbursementID string, payment *models.TransactionModel) error {
+	var reimbursement models.ReimbursementModel
+	if err := s.db.Preload("Employee").First(&reimbursement, "id = ?", reimbursementID).Error; err != nil {
+		return err
+	}
+	payment.InheritFrom(reimbursement.AnalyticDimensions)
+	if reimbursement.Employee != nil {
+		dimensions, err := models.ActiveAnalyticDimensions(s.db, payment.CompanyID, reimbursement.Employee.Dimensions())
+		if err != nil {
+			return err
+		}
+		payment.InheritFrom(dimensions)
+	}
+	payment.TransactionRefID = &reimbursementID
+	payment.TransactionRefType = "reimbursement"
+	payment.IsReimbursementPayment = true
+	// A payout credits the cash/bank account, which UpdateCreditDebit only
+	// keeps on the credit side for expenses.
+	if payment.Credit > 0 {
+		payment.IsExpense = true
+	}
+	amount := payment.Amount
+	if amount == 0 {
+		amount = payment.Debit + payment.Credit
+	}
+	financeService, ok := s.ctx.FinanceService.(*finance.FinanceService)
+	if !ok {
+		return errors.New("finance service not found")
+	}
+	return financeService.TransactionService.CreateTransaction(payment, amount)
+}
+
 // CreateReimbursementItem creates a new reimbursement item record in the database.
 //
 // The function takes a pointer to a ReimbursementItemModel as input and attempts to
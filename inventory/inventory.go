@@ -8,11 +8,15 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/file"
 	"github.com/AMETORY/ametory-erp-modules/finance"
 	"github.com/AMETORY/ametory-erp-modules/inventory/brand"
+	"github.com/AMETORY/ametory-erp-modules/inventory/landed_cost"
 	"github.com/AMETORY/ametory-erp-modules/inventory/product"
 	"github.com/AMETORY/ametory-erp-modules/inventory/purchase"
 	"github.com/AMETORY/ametory-erp-modules/inventory/purchase_return"
+	"github.com/AMETORY/ametory-erp-modules/inventory/replenishment"
+	"github.com/AMETORY/ametory-erp-modules/inventory/reservation"
 	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
 	"github.com/AMETORY/ametory-erp-modules/inventory/stock_opname"
+	"github.com/AMETORY/ametory-erp-modules/inventory/stock_transfer"
 	"github.com/AMETORY/ametory-erp-modules/inventory/unit"
 	"github.com/AMETORY/ametory-erp-modules/inventory/warehouse"
 	"gorm.io/gorm"
@@ -33,6 +37,10 @@ type InventoryService struct {
 	StockOpnameService      *stock_opname.StockOpnameService
 	TagService              *product.TagService
 	UnitService             *unit.UnitService
+	ReplenishmentService    *replenishment.ReplenishmentService
+	ReservationService      *reservation.ReservationService
+	StockTransferService    *stock_transfer.StockTransferService
+	LandedCostService       *landed_cost.LandedCostService
 }
 
 func NewInventoryService(ctx *context.ERPContext) *InventoryService {
@@ -52,6 +60,7 @@ func NewInventoryService(ctx *context.ERPContext) *InventoryService {
 	unitService := unit.NewUnitService(ctx.DB, ctx)
 	productSrv := product.NewProductService(ctx.DB, ctx, fileService, tagService)
 	purchaseSrv := purchase.NewPurchaseService(ctx.DB, ctx, financeService, stockmovementSrv)
+	reservationSrv := reservation.NewReservationService(ctx.DB, ctx, stockmovementSrv)
 
 	var service = InventoryService{
 		ctx:                     ctx,
@@ -68,6 +77,10 @@ func NewInventoryService(ctx *context.ERPContext) *InventoryService {
 		TagService:              tagService,
 		StockOpnameService:      stock_opname.NewStockOpnameService(ctx.DB, ctx, productSrv, stockmovementSrv),
 		UnitService:             unitService,
+		ReplenishmentService:    replenishment.NewReplenishmentService(ctx.DB, ctx, purchaseSrv, stockmovementSrv, reservationSrv),
+		ReservationService:      reservationSrv,
+		StockTransferService:    stock_transfer.NewStockTransferService(ctx.DB, ctx, stockmovementSrv),
+		LandedCostService:       landed_cost.NewLandedCostService(ctx.DB, ctx, financeService, stockmovementSrv),
 	}
 	err := service.Migrate()
 	if err != nil {
@@ -111,6 +124,22 @@ func (s *InventoryService) Migrate() error {
 		log.Println("ERROR MIGRATING PURCHASE RETURN", err)
 		return err
 	}
+	if err := replenishment.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR MIGRATING REPLENISHMENT", err)
+		return err
+	}
+	if err := reservation.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR MIGRATING RESERVATION", err)
+		return err
+	}
+	if err := stock_transfer.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR MIGRATING STOCK TRANSFER", err)
+		return err
+	}
+	if err := landed_cost.Migrate(s.ctx.DB); err != nil {
+		log.Println("ERROR MIGRATING LANDED COST", err)
+		return err
+	}
 
 	return nil
 }
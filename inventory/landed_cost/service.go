@@ -0,0 +1,588 @@
+package landed_cost
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
+	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	refType    = "landed_cost"
+	secRefType = "landed_cost_item"
+)
+
+type LandedCostService struct {
+	db                   *gorm.DB
+	ctx                  *context.ERPContext
+	financeService       *finance.FinanceService
+	stockMovementService *stockmovement.StockMovementService
+}
+
+// NewLandedCostService creates a new instance of LandedCostService with the given database connection,
+// context, finance service and stock movement service.
+func NewLandedCostService(db *gorm.DB, ctx *context.ERPContext, financeService *finance.FinanceService, stockMovementService *stockmovement.StockMovementService) *LandedCostService {
+	return &LandedCostService{
+		db:                   db,
+		ctx:                  ctx,
+		financeService:       financeService,
+		stockMovementService: stockMovementService,
+	}
+}
+
+// Migrate migrates the database schema for the landed cost models.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.LandedCostModel{},
+		&models.LandedCostItemModel{},
+		&models.LandedCostAllocationModel{},
+	)
+}
+
+// CreateLandedCost creates a draft landed cost with its cost lines and the
+// purchases it is allocated to.
+func (s *LandedCostService) CreateLandedCost(data *models.LandedCostModel) error {
+	data.Status = models.LANDED_COST_DRAFT
+	if data.Date.IsZero() {
+		data.Date = time.Now()
+	}
+	if err := s.checkPurchases(data.CompanyID, data.Purchases); err != nil {
+		return err
+	}
+	var total money.Amount
+	for i := range data.Items {
+		if err := checkItem(&data.Items[i]); err != nil {
+			return err
+		}
+		total = total.Add(money.FromFloat(data.Items[i].Amount))
+	}
+	data.Total = total.Float64()
+	return s.db.Omit("Purchases.*", "Allocations").Create(data).Error
+}
+
+// UpdateLandedCost updates the header of a draft landed cost.
+func (s *LandedCostService) UpdateLandedCost(id string, data *models.LandedCostModel) error {
+	if _, err := s.getDraft(id); err != nil {
+		return err
+	}
+	return s.db.Model(&models.LandedCostModel{}).
+		Where("id = ?", id).
+		Omit("Purchases", "Items", "Allocations", "status", "total", "company_id", "posted_at", "posted_by_id").
+		Updates(data).Error
+}
+
+// DeleteLandedCost deletes a draft or cancelled landed cost.
+func (s *LandedCostService) DeleteLandedCost(id string) error {
+	var landedCost models.LandedCostModel
+	if err := s.db.Select("id", "status").First(&landedCost, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if landedCost.Status != models.LANDED_COST_DRAFT && landedCost.Status != models.LANDED_COST_CANCELLED {
+		return errors.New("only draft or cancelled landed costs can be deleted")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&landedCost).Association("Purchases").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("landed_cost_id = ?", id).Delete(&models.LandedCostItemModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.LandedCostModel{}).Error
+	})
+}
+
+// CancelLandedCost cancels a draft landed cost.
+func (s *LandedCostService) CancelLandedCost(id string) error {
+	if _, err := s.getDraft(id); err != nil {
+		return err
+	}
+	return s.db.Model(&models.LandedCostModel{}).Where("id = ?", id).Update("status", models.LANDED_COST_CANCELLED).Error
+}
+
+// GetLandedCostByID retrieves a landed cost with its purchases, cost lines and
+// allocations.
+func (s *LandedCostService) GetLandedCostByID(id string) (*models.LandedCostModel, error) {
+	var landedCost models.LandedCostModel
+	err := s.db.
+		Preload("Contact").
+		Preload("CreditAccount").
+		Preload("Purchases").
+		Preload("Items.CreditAccount").
+		Preload("Allocations.Product").
+		Preload("Allocations.Variant").
+		Preload("CreatedBy").
+		Preload("PostedBy").
+		First(&landedCost, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &landedCost, nil
+}
+
+// GetLandedCosts retrieves a paginated list of landed costs.
+//
+// The search query is applied to the landed cost number and notes. If the
+// request contains a company ID header, the result is filtered by the company ID;
+// the status and contact_id query parameters filter it further.
+func (s *LandedCostService) GetLandedCosts(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Contact").Preload("Purchases")
+	if search != "" {
+		stmt = stmt.Where("(landed_costs.landed_cost_number ILIKE ? OR landed_costs.notes ILIKE ?)",
+			"%"+search+"%",
+			"%"+search+"%",
+		)
+	}
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("landed_costs.company_id = ?", request.Header.Get("ID-Company"))
+	}
+	for _, param := range []string{"status", "contact_id"} {
+		if request.URL.Query().Get(param) != "" {
+			stmt = stmt.Where("landed_costs."+param+" = ?", request.URL.Query().Get(param))
+		}
+	}
+	stmt = stmt.Model(&models.LandedCostModel{})
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.LandedCostModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// SetPurchases replaces the purchases a draft landed cost is allocated to.
+func (s *LandedCostService) SetPurchases(id string, purchaseIDs []string) error {
+	landedCost, err := s.getDraft(id)
+	if err != nil {
+		return err
+	}
+	purchases := []models.PurchaseOrderModel{}
+	for _, purchaseID := range purchaseIDs {
+		purchases = append(purchases, models.PurchaseOrderModel{BaseModel: shared.BaseModel{ID: purchaseID}})
+	}
+	if err := s.checkPurchases(landedCost.CompanyID, purchases); err != nil {
+		return err
+	}
+	return s.db.Omit("Purchases.*").Model(landedCost).Association("Purchases").Replace(purchases)
+}
+
+// AddItem adds a cost line to a draft landed cost.
+func (s *LandedCostService) AddItem(landedCostID string, data *models.LandedCostItemModel) error {
+	if _, err := s.getDraft(landedCostID); err != nil {
+		return err
+	}
+	if err := checkItem(data); err != nil {
+		return err
+	}
+	data.LandedCostID = landedCostID
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(data).Error; err != nil {
+			return err
+		}
+		return updateTotal(tx, landedCostID)
+	})
+}
+
+// UpdateItem updates a cost line of a draft landed cost.
+func (s *LandedCostService) UpdateItem(itemID string, data *models.LandedCostItemModel) error {
+	var item models.LandedCostItemModel
+	if err := s.db.First(&item, "id = ?", itemID).Error; err != nil {
+		return err
+	}
+	if _, err := s.getDraft(item.LandedCostID); err != nil {
+		return err
+	}
+	if err := checkItem(data); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.LandedCostItemModel{}).Where("id = ?", itemID).Updates(map[string]interface{}{
+			"description":       data.Description,
+			"amount":            data.Amount,
+			"allocation_method": data.AllocationMethod,
+			"credit_account_id": data.CreditAccountID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return updateTotal(tx, item.LandedCostID)
+	})
+}
+
+// DeleteItem deletes a cost line of a draft landed cost.
+func (s *LandedCostService) DeleteItem(itemID string) error {
+	var item models.LandedCostItemModel
+	if err := s.db.First(&item, "id = ?", itemID).Error; err != nil {
+		return err
+	}
+	if _, err := s.getDraft(item.LandedCostID); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", itemID).Delete(&models.LandedCostItemModel{}).Error; err != nil {
+			return err
+		}
+		return updateTotal(tx, item.LandedCostID)
+	})
+}
+
+// PreviewAllocations returns how the cost lines of a landed cost would be
+// allocated over the receipts of its purchases, without posting anything. The
+// split between stock on hand and goods already issued is only known when the
+// landed cost is posted.
+func (s *LandedCostService) PreviewAllocations(id string) ([]models.LandedCostAllocationModel, error) {
+	landedCost, err := s.GetLandedCostByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if landedCost.Status == models.LANDED_COST_POSTED {
+		return landedCost.Allocations, nil
+	}
+	return s.allocate(s.db, landedCost)
+}
+
+// PostLandedCost allocates the costs of a draft landed cost over the receipts of
+// its purchases and posts it.
+//
+// Every cost line is split over the incoming stock movements of the purchases in
+// proportion to their base quantity, value, weight or volume, the weight and
+// volume being those of the variant or product per base unit. The part of each
+// allocation still on hand is added to the value of the stock received (see
+// StockMovementService.RevalueReceipt), raising the cost the goods are issued at;
+// the part of the goods already issued is charged to cost of goods sold.
+//
+// The costs are debited to the inventory account as purchase costs and credited
+// to the account of the line, or of the landed cost; the part charged to cost of
+// goods sold is then moved from the inventory account to the cost of goods sold
+// account. The landed cost of every purchase item is added up on the item.
+func (s *LandedCostService) PostLandedCost(id string, date time.Time, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// The landed cost is locked so that concurrent posts can not both
+		// revalue the receipts.
+		var landedCost models.LandedCostModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&landedCost, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if landedCost.Status != models.LANDED_COST_DRAFT {
+			return errors.New("landed cost is not a draft")
+		}
+		if err := tx.Where("landed_cost_id = ?", id).Order("created_at").Find(&landedCost.Items).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&landedCost).Association("Purchases").Find(&landedCost.Purchases); err != nil {
+			return err
+		}
+		if len(landedCost.Items) == 0 {
+			return errors.New("landed cost has no items")
+		}
+		if len(landedCost.Purchases) == 0 {
+			return errors.New("landed cost has no purchases")
+		}
+		if err := period.Check(tx, landedCost.CompanyID, "purchase", date); err != nil {
+			return err
+		}
+		for _, item := range landedCost.Items {
+			if item.CreditAccountID == nil && landedCost.CreditAccountID == nil {
+				return fmt.Errorf("credit account is required for %s", item.Description)
+			}
+		}
+		var inventoryAccount models.AccountModel
+		if err := tx.Where("is_inventory_account = ? and company_id = ?", true, landedCost.CompanyID).First(&inventoryAccount).Error; err != nil {
+			return errors.New("inventory account not found")
+		}
+
+		allocations, err := s.allocate(tx, &landedCost)
+		if err != nil {
+			return err
+		}
+		s.stockMovementService.SetDB(tx)
+		defer s.stockMovementService.SetDB(s.db)
+
+		ref, secRef := refType, secRefType
+		var cogs money.Amount
+		for i := range allocations {
+			allocation := &allocations[i]
+			itemID := allocation.ItemID
+			adjustment := models.StockMovementModel{
+				Date:             date,
+				Type:             models.MovementTypeLandedCost,
+				ReferenceID:      landedCost.ID,
+				ReferenceType:    &ref,
+				SecondaryRefID:   &itemID,
+				SecondaryRefType: &secRef,
+				Description:      fmt.Sprintf("Landed cost %s (%s)", landedCost.LandedCostNumber, allocation.Item.Description),
+			}
+			onHand, err := s.stockMovementService.RevalueReceipt(allocation.MovementID, allocation.Amount, &adjustment)
+			if err != nil {
+				return err
+			}
+			if adjustment.ID != "" {
+				allocation.AdjustmentMovementID = &adjustment.ID
+			}
+			allocation.InventoryAmount = onHand
+			allocation.CogsAmount = money.FromFloat(allocation.Amount).Sub(money.FromFloat(onHand)).Float64()
+			cogs = cogs.Add(money.FromFloat(allocation.CogsAmount))
+			allocation.Item = nil
+			if allocation.PurchaseItemID != nil {
+				err := tx.Model(&models.PurchaseOrderItemModel{}).Where("id = ?", *allocation.PurchaseItemID).
+					Update("landed_cost", gorm.Expr("landed_cost + ?", allocation.Amount)).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if len(allocations) > 0 {
+			if err := tx.Create(&allocations).Error; err != nil {
+				return err
+			}
+		}
+
+		var total money.Amount
+		for _, item := range landedCost.Items {
+			creditAccountID := landedCost.CreditAccountID
+			if item.CreditAccountID != nil {
+				creditAccountID = item.CreditAccountID
+			}
+			err := s.postJournal(tx, &landedCost, date, userID, inventoryAccount.ID, *creditAccountID, item.Amount, true,
+				fmt.Sprintf("Biaya %s %s", item.Description, landedCost.LandedCostNumber))
+			if err != nil {
+				return err
+			}
+			total = total.Add(money.FromFloat(item.Amount))
+		}
+		if !cogs.IsZero() {
+			var cogsAccount models.AccountModel
+			if err := tx.Where("is_cogs_account = ? and company_id = ?", true, landedCost.CompanyID).First(&cogsAccount).Error; err != nil {
+				return errors.New("cost of goods sold account not found")
+			}
+			err := s.postJournal(tx, &landedCost, date, userID, cogsAccount.ID, inventoryAccount.ID, cogs.Float64(), false,
+				"HPP Landed Cost "+landedCost.LandedCostNumber)
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Model(&models.LandedCostModel{}).Where("id = ?", landedCost.ID).Updates(map[string]interface{}{
+			"status":       models.LANDED_COST_POSTED,
+			"date":         date,
+			"total":        total.Float64(),
+			"posted_at":    now,
+			"posted_by_id": userID,
+		}).Error
+	})
+}
+
+// allocate splits every cost line of a landed cost over the incoming stock
+// movements of its purchases.
+func (s *LandedCostService) allocate(db *gorm.DB, landedCost *models.LandedCostModel) ([]models.LandedCostAllocationModel, error) {
+	purchaseIDs := []string{}
+	for _, v := range landedCost.Purchases {
+		purchaseIDs = append(purchaseIDs, v.ID)
+	}
+	var receipts []models.StockMovementModel
+	err := db.Where("reference_id IN ? AND reference_type = ? AND quantity * value > 0", purchaseIDs, "purchase").
+		Order("date, created_at").
+		Find(&receipts).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(receipts) == 0 {
+		return nil, errors.New("the purchases have no receipts")
+	}
+
+	products := map[string]models.ProductModel{}
+	variants := map[string]models.VariantModel{}
+	for _, v := range receipts {
+		if _, ok := products[v.ProductID]; !ok {
+			var product models.ProductModel
+			if err := db.Select("id", "name", "weight", "height", "length", "width").First(&product, "id = ?", v.ProductID).Error; err != nil {
+				return nil, err
+			}
+			products[v.ProductID] = product
+		}
+		if v.VariantID != nil {
+			if _, ok := variants[*v.VariantID]; !ok {
+				var variant models.VariantModel
+				if err := db.Select("id", "weight", "height", "length", "width").First(&variant, "id = ?", *v.VariantID).Error; err != nil {
+					return nil, err
+				}
+				variants[*v.VariantID] = variant
+			}
+		}
+	}
+
+	rounding := models.GetCompanyRounding(db, landedCost.CompanyID)
+	allocations := []models.LandedCostAllocationModel{}
+	for i := range landedCost.Items {
+		item := &landedCost.Items[i]
+		bases := make([]float64, len(receipts))
+		weights := make([]money.Amount, len(receipts))
+		var totalWeight money.Amount
+		for j, v := range receipts {
+			quantity := v.Quantity * v.Value
+			product := products[v.ProductID]
+			weight, volume := product.Weight, product.Height*product.Length*product.Width
+			if v.VariantID != nil {
+				variant := variants[*v.VariantID]
+				if variant.Weight > 0 {
+					weight = variant.Weight
+				}
+				if variant.Height*variant.Length*variant.Width > 0 {
+					volume = variant.Height * variant.Length * variant.Width
+				}
+			}
+			switch item.AllocationMethod {
+			case models.LANDED_COST_BY_QUANTITY:
+				bases[j] = quantity
+			case models.LANDED_COST_BY_VALUE:
+				bases[j] = v.TotalCost
+			case models.LANDED_COST_BY_WEIGHT:
+				bases[j] = weight * quantity
+			case models.LANDED_COST_BY_VOLUME:
+				bases[j] = volume * quantity
+			}
+			weights[j] = money.FromFloat(max(bases[j], 0))
+			totalWeight = totalWeight.Add(weights[j])
+		}
+		if totalWeight.IsZero() {
+			return nil, fmt.Errorf("%s cannot be allocated by %s: the receipts have none", item.Description, strings.ToLower(item.AllocationMethod))
+		}
+		parts := money.FromFloat(item.Amount).Allocate(weights, rounding.Precision)
+		for j, v := range receipts {
+			if parts[j].IsZero() {
+				continue
+			}
+			quantity := v.Quantity * v.Value
+			allocations = append(allocations, models.LandedCostAllocationModel{
+				LandedCostID:   landedCost.ID,
+				ItemID:         item.ID,
+				Item:           item,
+				PurchaseID:     v.ReferenceID,
+				PurchaseItemID: v.SecondaryRefID,
+				MovementID:     v.ID,
+				ProductID:      v.ProductID,
+				VariantID:      v.VariantID,
+				WarehouseID:    v.WarehouseID,
+				Quantity:       quantity,
+				Basis:          bases[j],
+				Amount:         parts[j].Float64(),
+				UnitCost:       parts[j].Div(quantity).Float64(),
+			})
+		}
+	}
+	return allocations, nil
+}
+
+// postJournal posts a balanced journal entry of a landed cost, debiting one
+// account and crediting the other with the amount. Purchase costs are flagged so
+// they are reported as freight in and other costs.
+func (s *LandedCostService) postJournal(tx *gorm.DB, landedCost *models.LandedCostModel, date time.Time, userID string, debitAccountID, creditAccountID string, amount float64, purchaseCost bool, description string) error {
+	code := utils.RandString(8, false)
+	debitID := utils.Uuid()
+	creditID := utils.Uuid()
+	debitTrans := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: debitID},
+		Code:                        code,
+		Date:                        date,
+		AccountID:                   &debitAccountID,
+		Description:                 description,
+		Notes:                       landedCost.Notes,
+		TransactionRefID:            &creditID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &landedCost.ID,
+		TransactionSecondaryRefType: refType,
+		CompanyID:                   landedCost.CompanyID,
+		Debit:                       amount,
+		Amount:                      amount,
+		UserID:                      &userID,
+		IsPurchaseCost:              purchaseCost,
+		IsPurchase:                  purchaseCost,
+	}
+	if err := tx.Create(&debitTrans).Error; err != nil {
+		return err
+	}
+	creditTrans := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: creditID},
+		Code:                        code,
+		Date:                        date,
+		AccountID:                   &creditAccountID,
+		Description:                 description,
+		Notes:                       landedCost.Notes,
+		TransactionRefID:            &debitID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &landedCost.ID,
+		TransactionSecondaryRefType: refType,
+		CompanyID:                   landedCost.CompanyID,
+		Credit:                      amount,
+		Amount:                      amount,
+		UserID:                      &userID,
+	}
+	return tx.Create(&creditTrans).Error
+}
+
+// checkPurchases checks that the purchases of a landed cost belong to its
+// company.
+func (s *LandedCostService) checkPurchases(companyID *string, purchases []models.PurchaseOrderModel) error {
+	for _, v := range purchases {
+		var purchase models.PurchaseOrderModel
+		if err := s.db.Select("id", "company_id", "purchase_number").First(&purchase, "id = ?", v.ID).Error; err != nil {
+			return fmt.Errorf("purchase %s: %w", v.ID, err)
+		}
+		if companyID != nil && (purchase.CompanyID == nil || *purchase.CompanyID != *companyID) {
+			return fmt.Errorf("purchase %s belongs to another company", purchase.PurchaseNumber)
+		}
+	}
+	return nil
+}
+
+// getDraft returns a landed cost that is still a draft.
+func (s *LandedCostService) getDraft(id string) (*models.LandedCostModel, error) {
+	var landedCost models.LandedCostModel
+	if err := s.db.First(&landedCost, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if landedCost.Status != models.LANDED_COST_DRAFT {
+		return nil, errors.New("landed cost is not a draft")
+	}
+	return &landedCost, nil
+}
+
+// checkItem checks the amount and allocation method of a cost line.
+func checkItem(item *models.LandedCostItemModel) error {
+	if item.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if item.AllocationMethod == "" {
+		item.AllocationMethod = models.LANDED_COST_BY_VALUE
+	}
+	switch item.AllocationMethod {
+	case models.LANDED_COST_BY_QUANTITY, models.LANDED_COST_BY_VALUE, models.LANDED_COST_BY_WEIGHT, models.LANDED_COST_BY_VOLUME:
+		return nil
+	}
+	return fmt.Errorf("invalid allocation method %s", item.AllocationMethod)
+}
+
+// updateTotal sets the total of a landed cost to the sum of its cost lines.
+func updateTotal(tx *gorm.DB, landedCostID string) error {
+	var total float64
+	err := tx.Model(&models.LandedCostItemModel{}).
+		Where("landed_cost_id = ?", landedCostID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.LandedCostModel{}).Where("id = ?", landedCostID).Update("total", total).Error
+}
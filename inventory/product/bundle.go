@@ -0,0 +1,183 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"gorm.io/gorm"
+)
+
+// SetBundleComponents replaces the components of a bundle product, or of one of
+// its variants when bundleVariantID is not nil, and marks the product as a bundle
+// while it has components. An empty list removes the components.
+//
+// The quantity of a component is in its base unit per base unit of the bundle
+// and must be greater than zero. A component cannot be the bundle itself or
+// another bundle, and a product that is a component of a bundle cannot become
+// one. Bundles cannot be lot or serial tracked.
+func (s *ProductService) SetBundleComponents(bundleID string, bundleVariantID *string, components []models.BundleComponentModel) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var bundle models.ProductModel
+		if err := tx.Select("id", "name", "tracking_type").Where("id = ?", bundleID).First(&bundle).Error; err != nil {
+			return err
+		}
+		if bundle.TrackingType == models.TRACKING_LOT || bundle.TrackingType == models.TRACKING_SERIAL {
+			return fmt.Errorf("%s is lot or serial tracked and cannot be a bundle", bundle.Name)
+		}
+		if bundleVariantID != nil {
+			if err := checkVariant(tx, bundleID, *bundleVariantID); err != nil {
+				return err
+			}
+		}
+		if len(components) > 0 {
+			var used int64
+			if err := tx.Model(&models.BundleComponentModel{}).Where("component_id = ?", bundleID).Count(&used).Error; err != nil {
+				return err
+			}
+			if used > 0 {
+				return fmt.Errorf("%s is a component of another bundle", bundle.Name)
+			}
+		}
+
+		seen := map[string]bool{}
+		for i := range components {
+			component := &components[i]
+			if component.Quantity <= 0 {
+				return errors.New("component quantity must be greater than zero")
+			}
+			if component.ComponentID == bundleID {
+				return errors.New("a bundle cannot be its own component")
+			}
+			var product models.ProductModel
+			if err := tx.Select("id", "name", "is_bundle").Where("id = ?", component.ComponentID).First(&product).Error; err != nil {
+				return fmt.Errorf("component %s: %w", component.ComponentID, err)
+			}
+			if product.IsBundle {
+				return fmt.Errorf("%s is a bundle and cannot be a component", product.Name)
+			}
+			key := component.ComponentID
+			if component.ComponentVariantID != nil {
+				if err := checkVariant(tx, component.ComponentID, *component.ComponentVariantID); err != nil {
+					return err
+				}
+				key += "/" + *component.ComponentVariantID
+			}
+			if seen[key] {
+				return fmt.Errorf("%s is listed more than once", product.Name)
+			}
+			seen[key] = true
+			component.ID = ""
+			component.BundleID = bundleID
+			component.BundleVariantID = bundleVariantID
+		}
+
+		stmt := tx.Where("bundle_id = ?", bundleID)
+		if bundleVariantID != nil {
+			stmt = stmt.Where("bundle_variant_id = ?", *bundleVariantID)
+		} else {
+			stmt = stmt.Where("bundle_variant_id IS NULL")
+		}
+		if err := stmt.Delete(&models.BundleComponentModel{}).Error; err != nil {
+			return err
+		}
+		if len(components) > 0 {
+			if err := tx.Omit("Bundle", "BundleVariant", "Component", "ComponentVariant").Create(&components).Error; err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&models.BundleComponentModel{}).Where("bundle_id = ?", bundleID).Count(&count).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ProductModel{}).Where("id = ?", bundleID).Update("is_bundle", count > 0).Error
+	})
+}
+
+// GetBundleComponents returns the components of a bundle product, or of one of
+// its variants when variantID is not nil, with their products and variants.
+func (s *ProductService) GetBundleComponents(bundleID string, variantID *string) ([]models.BundleComponentModel, error) {
+	return models.GetBundleComponents(s.db.Preload("Component").Preload("ComponentVariant"), bundleID, variantID)
+}
+
+// GetBundleAvailability returns how many base units of a bundle product, or of
+// one of its variants when variantID is not nil, can be sold from the stock of
+// its components, in one warehouse or in all of them when warehouseID is nil,
+// together with the stock of every component.
+func (s *ProductService) GetBundleAvailability(bundleID string, variantID *string, warehouseID *string) (*models.BundleAvailability, error) {
+	availability, err := s.bundleAvailability(bundleID, variantID, nil, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	if availability == nil {
+		return nil, errors.New("product is not a bundle")
+	}
+	return availability, nil
+}
+
+// bundleAvailability returns the availability of a bundle, or nil when the
+// product is not a bundle. The stock of the components is filtered by the
+// request headers like GetStock.
+func (s *ProductService) bundleAvailability(bundleID string, variantID *string, request *http.Request, warehouseID *string) (*models.BundleAvailability, error) {
+	var bundle models.ProductModel
+	if err := s.db.Select("id", "is_bundle").Where("id = ?", bundleID).Find(&bundle).Error; err != nil {
+		return nil, err
+	}
+	if !bundle.IsBundle {
+		return nil, nil
+	}
+	components, err := s.GetBundleComponents(bundleID, variantID)
+	if err != nil {
+		return nil, err
+	}
+	availability := models.BundleAvailability{
+		ProductID:   bundleID,
+		VariantID:   variantID,
+		WarehouseID: warehouseID,
+		Components:  []models.BundleComponentStock{},
+	}
+	available := math.MaxFloat64
+	for _, component := range components {
+		item := models.BundleComponentStock{
+			ComponentID:        component.ComponentID,
+			ComponentVariantID: component.ComponentVariantID,
+			Quantity:           component.Quantity,
+		}
+		if component.Component != nil {
+			item.Name = component.Component.Name
+		}
+		if component.ComponentVariantID != nil {
+			if component.ComponentVariant != nil && component.ComponentVariant.DisplayName != "" {
+				item.Name = component.ComponentVariant.DisplayName
+			}
+			item.Stock, err = s.GetVariantStock(component.ComponentID, *component.ComponentVariantID, request, warehouseID)
+		} else {
+			item.Stock, err = s.GetStock(component.ComponentID, request, warehouseID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		item.Available = models.BundlesFor(item.Stock, component.Quantity)
+		available = min(available, item.Available)
+		availability.Components = append(availability.Components, item)
+	}
+	if len(components) > 0 {
+		availability.Available = available
+	}
+	return &availability, nil
+}
+
+// checkVariant checks that a variant belongs to a product.
+func checkVariant(tx *gorm.DB, productID, variantID string) error {
+	var count int64
+	if err := tx.Model(&models.VariantModel{}).Where("id = ? AND product_id = ?", variantID, productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("variant %s does not belong to product %s", variantID, productID)
+	}
+	return nil
+}
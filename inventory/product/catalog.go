@@ -0,0 +1,805 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils/barcode"
+	"github.com/AMETORY/ametory-erp-modules/utils/spreadsheet"
+	"gorm.io/gorm"
+)
+
+// catalogColumns are the fixed columns of a product catalog file, in export
+// order. The prices of the price categories follow in columns named
+// "price:<price category name>".
+var catalogColumns = []string{
+	"sku", "variant_sku", "name", "display_name", "description", "barcode", "price", "currency",
+	"category", "brand", "tags", "status", "unit", "units", "images",
+	"height", "length", "weight", "width", "minimum_stock",
+	"is_sell", "is_buy", "is_raw", "enable_stock", "tracking_type",
+}
+
+const catalogPricePrefix = "price:"
+
+var (
+	catalogNumberColumns = []string{"price", "height", "length", "weight", "width", "minimum_stock"}
+	catalogBoolColumns   = []string{"is_sell", "is_buy", "is_raw", "enable_stock"}
+	// Kolom yang hanya berlaku untuk baris produk, diabaikan pada baris varian
+	catalogProductColumns = []string{"display_name", "description", "category", "brand", "status", "unit", "units", "images", "minimum_stock", "is_sell", "is_buy", "is_raw", "enable_stock", "tracking_type"}
+)
+
+// catalogRow is a validated row of a product catalog file.
+type catalogRow struct {
+	line       int
+	sku        string
+	variantSKU string
+	productID  string // Kosong untuk produk baru
+	variantID  string // Kosong untuk varian baru
+	cells      map[string]string
+	numbers    map[string]float64
+	bools      map[string]bool
+	units      map[string]float64 // Kode satuan ke nilai konversi
+	tags       []string
+	images     []string
+	prices     map[string]float64 // Nama kategori harga ke harga
+}
+
+// ImportProducts imports a product catalog from a CSV or XLSX file into a
+// company.
+//
+// The file has a header row with the columns of ExportProducts. A row without
+// variant_sku is a product, upserted by its sku; a row with variant_sku is a
+// variant of the product with that sku, upserted by its variant SKU. A variant
+// of a new product must come after the product's row. On variant rows, name,
+// barcode, price, the dimensions, tags and the price category prices belong to
+// the variant and the other product columns are ignored.
+//
+// Categories, brands, tags, units and price categories are matched by name and
+// created when missing. Lists are separated by semicolons: tags, image URLs and
+// units as CODE=value, the number of base units in one of the unit; unit is the
+// code of the base unit. A price column holds the price of the product in a price
+// category; a changed price is added as a new price effective now, keeping the
+// price history. Empty cells leave the existing value unchanged.
+//
+// Every row is validated first. With dryRun, or when a row is invalid, nothing
+// is written and the result reports the row errors and what would have been
+// created and updated. Otherwise all rows are written in a single transaction.
+func (s *ProductService) ImportProducts(companyID string, data []byte, dryRun bool) (*models.ProductImportResult, error) {
+	if companyID == "" {
+		return nil, errors.New("company ID is required")
+	}
+	table, err := spreadsheet.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	rows, result, err := s.validateCatalog(companyID, table)
+	if err != nil {
+		return nil, err
+	}
+	result.DryRun = dryRun
+	if dryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		imp := &catalogImport{tx: tx, companyID: companyID, ids: map[string]string{}, products: map[string]string{}}
+		for _, row := range rows {
+			var err error
+			if row.variantSKU == "" {
+				err = imp.saveProduct(row)
+			} else {
+				err = imp.saveVariant(row)
+			}
+			if err != nil {
+				return fmt.Errorf("row %d: %w", row.line, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExportProducts exports the product catalog of a company as "csv" or "xlsx",
+// in the format read by ImportProducts. Each product is followed by its
+// variants, with the current price of every price category of the company.
+// Quantity tier prices are not exported.
+func (s *ProductService) ExportProducts(companyID string, format string) ([]byte, error) {
+	var products []models.ProductModel
+	err := s.db.Preload("Category").Preload("Brand").Preload("Tags").
+		Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("sku")
+		}).Preload("Variants.Tags").
+		Where("company_id = ?", companyID).Order("sku").Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []models.PriceCategoryModel
+	if err := s.db.Where("company_id = ?", companyID).Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	header := append([]string{}, catalogColumns...)
+	for _, category := range categories {
+		header = append(header, catalogPricePrefix+category.Name)
+	}
+
+	// Harga terbaru per produk, varian dan kategori harga
+	var prices []models.PriceModel
+	err = s.db.Joins("JOIN products ON products.id = product_prices.product_id").
+		Where("products.company_id = ? AND product_prices.min_quantity = 0 AND product_prices.effective_date <= ?", companyID, time.Now()).
+		Order("product_prices.effective_date").Find(&prices).Error
+	if err != nil {
+		return nil, err
+	}
+	currentPrices := map[string]models.PriceModel{}
+	for _, price := range prices {
+		key := price.ProductID + ":" + price.PriceCategoryID
+		if price.VariantID != nil {
+			key += ":" + *price.VariantID
+		}
+		currentPrices[key] = price
+	}
+
+	var images []models.FileModel
+	err = s.db.Joins("JOIN products ON products.id = files.ref_id").
+		Where("products.company_id = ? AND files.ref_type = ?", companyID, "product").
+		Order("files.created_at").Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	productImages := map[string][]string{}
+	for _, image := range images {
+		if image.URL != "" {
+			productImages[image.RefID] = append(productImages[image.RefID], image.URL)
+		}
+	}
+
+	table := [][]string{header}
+	for _, product := range products {
+		row := map[string]string{
+			"sku":           stringValue(product.SKU),
+			"name":          product.Name,
+			"display_name":  product.DisplayName,
+			"description":   stringValue(product.Description),
+			"barcode":       stringValue(product.Barcode),
+			"price":         formatCatalogNumber(product.Price),
+			"status":        product.Status,
+			"height":        formatCatalogNumber(product.Height),
+			"length":        formatCatalogNumber(product.Length),
+			"weight":        formatCatalogNumber(product.Weight),
+			"width":         formatCatalogNumber(product.Width),
+			"minimum_stock": formatCatalogNumber(product.MinimumStock),
+			"is_sell":       strconv.FormatBool(product.IsSell),
+			"is_buy":        strconv.FormatBool(product.IsBuy),
+			"is_raw":        strconv.FormatBool(product.IsRaw),
+			"enable_stock":  strconv.FormatBool(product.EnableStock),
+			"tracking_type": product.TrackingType,
+			"tags":          tagNames(product.Tags),
+			"images":        strings.Join(productImages[product.ID], ";"),
+		}
+		if product.Category != nil {
+			row["category"] = product.Category.Name
+		}
+		if product.Brand != nil {
+			row["brand"] = product.Brand.Name
+		}
+		var units []string
+		for _, unit := range product.Units {
+			if unit.IsDefault {
+				row["unit"] = unit.Code
+				continue
+			}
+			units = append(units, unit.Code+"="+formatCatalogNumber(unit.Value))
+		}
+		row["units"] = strings.Join(units, ";")
+		for _, category := range categories {
+			if price, ok := currentPrices[product.ID+":"+category.ID]; ok {
+				row[catalogPricePrefix+category.Name] = formatCatalogNumber(price.Amount)
+				row["currency"] = price.Currency
+			}
+		}
+		table = append(table, catalogCells(header, row))
+
+		for _, variant := range product.Variants {
+			row := map[string]string{
+				"sku":         stringValue(product.SKU),
+				"variant_sku": variant.SKU,
+				"name":        variant.DisplayName,
+				"barcode":     stringValue(variant.Barcode),
+				"price":       formatCatalogNumber(variant.Price),
+				"height":      formatCatalogNumber(variant.Height),
+				"length":      formatCatalogNumber(variant.Length),
+				"weight":      formatCatalogNumber(variant.Weight),
+				"width":       formatCatalogNumber(variant.Width),
+				"tags":        tagNames(variant.Tags),
+			}
+			for _, category := range categories {
+				if price, ok := currentPrices[product.ID+":"+category.ID+":"+variant.ID]; ok {
+					row[catalogPricePrefix+category.Name] = formatCatalogNumber(price.Amount)
+					row["currency"] = price.Currency
+				}
+			}
+			table = append(table, catalogCells(header, row))
+		}
+	}
+	return spreadsheet.Write(format, "Products", table)
+}
+
+// validateCatalog checks the rows of a catalog file without writing anything and
+// counts the products and variants that would be created or updated.
+func (s *ProductService) validateCatalog(companyID string, table [][]string) ([]*catalogRow, *models.ProductImportResult, error) {
+	if len(table) == 0 {
+		return nil, nil, errors.New("file is empty")
+	}
+	result := &models.ProductImportResult{}
+	addError := func(line int, column, message string) {
+		result.Errors = append(result.Errors, models.ProductImportError{Row: line, Column: column, Message: message})
+	}
+
+	known := map[string]bool{}
+	for _, column := range catalogColumns {
+		known[column] = true
+	}
+	header := make([]string, len(table[0]))
+	for i, name := range table[0] {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(strings.ToLower(name), catalogPricePrefix) {
+			category := strings.TrimSpace(name[len(catalogPricePrefix):])
+			if category == "" {
+				addError(1, name, "price column without price category")
+			}
+			header[i] = catalogPricePrefix + category
+			continue
+		}
+		name = strings.ReplaceAll(strings.ToLower(name), " ", "_")
+		if name != "" && !known[name] {
+			addError(1, name, "unknown column")
+		}
+		header[i] = name
+	}
+	if !contains(header, "sku") {
+		return nil, nil, errors.New("sku column is required")
+	}
+
+	var rows []*catalogRow
+	productSKUs := map[string]string{} // SKU produk di file ke ID produk yang sudah ada
+	variantSKUs := map[string]bool{}
+	for i, cells := range table[1:] {
+		row := &catalogRow{
+			line:    i + 2,
+			cells:   map[string]string{},
+			numbers: map[string]float64{},
+			bools:   map[string]bool{},
+			prices:  map[string]float64{},
+		}
+		for j, value := range cells {
+			if j < len(header) && header[j] != "" && strings.TrimSpace(value) != "" {
+				row.cells[header[j]] = strings.TrimSpace(value)
+			}
+		}
+		if len(row.cells) == 0 {
+			continue
+		}
+		result.Rows++
+		errorCount := len(result.Errors)
+		row.sku = row.cells["sku"]
+		row.variantSKU = row.cells["variant_sku"]
+		if row.sku == "" {
+			addError(row.line, "sku", "sku is required")
+			continue
+		}
+
+		if row.variantSKU == "" {
+			if _, ok := productSKUs[row.sku]; ok {
+				addError(row.line, "sku", "duplicate product "+row.sku)
+				continue
+			}
+			var product models.ProductModel
+			err := s.db.Select("id").Where("sku = ? AND company_id = ?", row.sku, companyID).Limit(1).Find(&product).Error
+			if err != nil {
+				return nil, nil, err
+			}
+			row.productID = product.ID
+			productSKUs[row.sku] = product.ID
+			if row.productID == "" && row.cells["name"] == "" {
+				addError(row.line, "name", "name is required for a new product")
+			}
+		} else {
+			if variantSKUs[row.variantSKU] {
+				addError(row.line, "variant_sku", "duplicate variant "+row.variantSKU)
+				continue
+			}
+			variantSKUs[row.variantSKU] = true
+			productID, ok := productSKUs[row.sku]
+			if !ok {
+				var product models.ProductModel
+				err := s.db.Select("id").Where("sku = ? AND company_id = ?", row.sku, companyID).Limit(1).Find(&product).Error
+				if err != nil {
+					return nil, nil, err
+				}
+				if product.ID == "" {
+					addError(row.line, "sku", "product "+row.sku+" not found, its row must come before its variants")
+					continue
+				}
+				productID = product.ID
+			}
+			row.productID = productID
+			var variant models.VariantModel
+			err := s.db.Select("product_variants.id", "product_variants.product_id").
+				Joins("JOIN products ON products.id = product_variants.product_id").
+				Where("product_variants.sku = ? AND products.company_id = ?", row.variantSKU, companyID).
+				Limit(1).Find(&variant).Error
+			if err != nil {
+				return nil, nil, err
+			}
+			if variant.ID != "" && variant.ProductID != productID {
+				addError(row.line, "variant_sku", "variant "+row.variantSKU+" belongs to another product")
+			}
+			row.variantID = variant.ID
+			for _, column := range catalogProductColumns {
+				delete(row.cells, column)
+			}
+		}
+
+		for _, column := range catalogNumberColumns {
+			if value, ok := row.cells[column]; ok {
+				if n, err := parseCatalogNumber(value); err != nil {
+					addError(row.line, column, err.Error())
+				} else {
+					row.numbers[column] = n
+				}
+			}
+		}
+		for _, column := range catalogBoolColumns {
+			if value, ok := row.cells[column]; ok {
+				if b, err := parseCatalogBool(value); err != nil {
+					addError(row.line, column, err.Error())
+				} else {
+					row.bools[column] = b
+				}
+			}
+		}
+		for column, value := range row.cells {
+			if !strings.HasPrefix(column, catalogPricePrefix) {
+				continue
+			}
+			if n, err := parseCatalogNumber(value); err != nil {
+				addError(row.line, column, err.Error())
+			} else {
+				row.prices[column[len(catalogPricePrefix):]] = n
+			}
+		}
+		if value, ok := row.cells["tracking_type"]; ok {
+			value = strings.ToUpper(value)
+			if value != models.TRACKING_NONE && value != models.TRACKING_LOT && value != models.TRACKING_SERIAL {
+				addError(row.line, "tracking_type", "tracking type must be NONE, LOT or SERIAL")
+			}
+			row.cells["tracking_type"] = value
+		}
+		if value, ok := row.cells["barcode"]; ok && isDigits(value) {
+			var err error
+			switch len(value) {
+			case 12:
+				err = barcode.ValidateUPCA(value)
+			case 13:
+				err = barcode.ValidateEAN13(value)
+			}
+			if err != nil {
+				addError(row.line, "barcode", err.Error())
+			}
+		}
+		row.tags = splitCatalogList(row.cells["tags"])
+		row.images = splitCatalogList(row.cells["images"])
+		for _, url := range row.images {
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				addError(row.line, "images", "invalid image URL "+url)
+			}
+		}
+		if value, ok := row.cells["units"]; ok {
+			row.units = map[string]float64{}
+			for _, unit := range splitCatalogList(value) {
+				code, value, found := strings.Cut(unit, "=")
+				code = strings.TrimSpace(code)
+				n, err := parseCatalogNumber(strings.TrimSpace(value))
+				if !found || code == "" || err != nil || n <= 0 {
+					addError(row.line, "units", "invalid unit "+unit+", expected CODE=value with a positive value")
+					continue
+				}
+				row.units[code] = n
+			}
+		}
+		if base, ok := row.cells["unit"]; ok {
+			if value, ok := row.units[base]; ok && value != 1 {
+				addError(row.line, "unit", "the base unit must have a value of 1")
+			}
+		}
+
+		if len(result.Errors) > errorCount {
+			continue
+		}
+		switch {
+		case row.variantSKU == "" && row.productID == "":
+			result.ProductsCreated++
+		case row.variantSKU == "":
+			result.ProductsUpdated++
+		case row.variantID == "":
+			result.VariantsCreated++
+		default:
+			result.VariantsUpdated++
+		}
+		rows = append(rows, row)
+	}
+	return rows, result, nil
+}
+
+// catalogImport writes validated catalog rows within a transaction.
+type catalogImport struct {
+	tx        *gorm.DB
+	companyID string
+	ids       map[string]string // Cache ID kategori, merek, tag, satuan dan kategori harga
+	products  map[string]string // SKU produk ke ID produk
+}
+
+func (imp *catalogImport) saveProduct(row *catalogRow) error {
+	product := models.ProductModel{}
+	if row.productID != "" {
+		product.ID = row.productID
+	} else {
+		sku := row.sku
+		product = models.ProductModel{Name: row.cells["name"], SKU: &sku, CompanyID: &imp.companyID}
+		if err := imp.tx.Omit("Tags", "Variants", "Units", "Merchants", "Suppliers", "Discounts", "Feedbacks").Create(&product).Error; err != nil {
+			return err
+		}
+	}
+	imp.products[row.sku] = product.ID
+
+	updates := map[string]interface{}{}
+	for _, column := range []string{"name", "display_name", "description", "barcode", "status", "tracking_type"} {
+		if value, ok := row.cells[column]; ok {
+			updates[column] = value
+		}
+	}
+	for column, value := range row.numbers {
+		updates[column] = value
+	}
+	for column, value := range row.bools {
+		updates[column] = value
+	}
+	if name, ok := row.cells["category"]; ok {
+		id, err := imp.reference("product_categories", name, func() (string, error) {
+			category := models.ProductCategoryModel{Name: name, CompanyID: &imp.companyID}
+			err := imp.tx.Create(&category).Error
+			return category.ID, err
+		})
+		if err != nil {
+			return err
+		}
+		updates["category_id"] = id
+	}
+	if name, ok := row.cells["brand"]; ok {
+		id, err := imp.reference("brands", name, func() (string, error) {
+			brand := models.BrandModel{Name: name, CompanyID: &imp.companyID}
+			err := imp.tx.Create(&brand).Error
+			return brand.ID, err
+		})
+		if err != nil {
+			return err
+		}
+		updates["brand_id"] = id
+	}
+	if len(updates) > 0 {
+		if err := imp.tx.Model(&models.ProductModel{}).Where("id = ?", product.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := imp.saveUnits(product.ID, row); err != nil {
+		return err
+	}
+	if err := imp.saveTags("product_tags", "product_model_id", product.ID, row.tags); err != nil {
+		return err
+	}
+	if err := imp.savePrices(product.ID, nil, row); err != nil {
+		return err
+	}
+	for _, url := range row.images {
+		var count int64
+		imp.tx.Model(&models.FileModel{}).Where("ref_id = ? AND ref_type = ? AND url = ?", product.ID, "product", url).Count(&count)
+		if count > 0 {
+			continue
+		}
+		image := models.FileModel{FileName: path.Base(url), Path: url, URL: url, Provider: "url", RefID: product.ID, RefType: "product"}
+		if err := imp.tx.Create(&image).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imp *catalogImport) saveVariant(row *catalogRow) error {
+	productID := row.productID
+	if id, ok := imp.products[row.sku]; ok {
+		productID = id
+	}
+	variant := models.VariantModel{}
+	if row.variantID != "" {
+		variant.ID = row.variantID
+	} else {
+		variant = models.VariantModel{ProductID: productID, SKU: row.variantSKU}
+		if err := imp.tx.Omit("Tags", "Attributes").Create(&variant).Error; err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if value, ok := row.cells["name"]; ok {
+		updates["display_name"] = value
+	}
+	if value, ok := row.cells["barcode"]; ok {
+		updates["barcode"] = value
+	}
+	for column, value := range row.numbers {
+		updates[column] = value
+	}
+	if len(updates) > 0 {
+		if err := imp.tx.Model(&models.VariantModel{}).Where("id = ?", variant.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	if err := imp.saveTags("variant_tags", "variant_model_id", variant.ID, row.tags); err != nil {
+		return err
+	}
+	return imp.savePrices(productID, &variant.ID, row)
+}
+
+// saveUnits sets the base unit of a product and upserts its unit conversions.
+func (imp *catalogImport) saveUnits(productID string, row *catalogRow) error {
+	units := map[string]float64{}
+	for code, value := range row.units {
+		units[code] = value
+	}
+	base, hasBase := row.cells["unit"]
+	if hasBase {
+		units[base] = 1
+		if err := imp.tx.Model(&models.ProductUnitData{}).Where("product_model_id = ?", productID).Update("is_default", false).Error; err != nil {
+			return err
+		}
+	}
+	codes := make([]string, 0, len(units))
+	for code := range units {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		unitID, err := imp.unit(code)
+		if err != nil {
+			return err
+		}
+		data := models.ProductUnitData{ProductModelID: &productID, UnitModelID: &unitID, Value: units[code], IsDefault: hasBase && code == base}
+		result := imp.tx.Model(&models.ProductUnitData{}).
+			Where("product_model_id = ? AND unit_model_id = ?", productID, unitID).
+			Updates(map[string]interface{}{"value": data.Value, "is_default": data.IsDefault})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := imp.tx.Create(&data).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveTags replaces the tags of a product or variant when the row has tags.
+func (imp *catalogImport) saveTags(table, column, id string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if err := imp.tx.Exec("DELETE FROM "+table+" WHERE "+column+" = ?", id).Error; err != nil {
+		return err
+	}
+	for _, name := range names {
+		tagID, err := imp.reference("tags", name, func() (string, error) {
+			tag := models.TagModel{Name: name, Color: "#F5F5F5", CompanyID: &imp.companyID}
+			err := imp.tx.Create(&tag).Error
+			return tag.ID, err
+		})
+		if err != nil {
+			return err
+		}
+		if err := imp.tx.Exec("INSERT INTO "+table+" ("+column+", tag_model_id) VALUES (?, ?) ON CONFLICT DO NOTHING", id, tagID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// savePrices adds the prices of the row that differ from the current price of
+// their price category.
+func (imp *catalogImport) savePrices(productID string, variantID *string, row *catalogRow) error {
+	currency := strings.ToUpper(row.cells["currency"])
+	if currency == "" {
+		currency = "IDR"
+	}
+	names := make([]string, 0, len(row.prices))
+	for name := range row.prices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := time.Now()
+	for _, name := range names {
+		categoryID, err := imp.reference("price_categories", name, func() (string, error) {
+			category := models.PriceCategoryModel{Name: name, CompanyID: &imp.companyID}
+			err := imp.tx.Create(&category).Error
+			return category.ID, err
+		})
+		if err != nil {
+			return err
+		}
+		var current models.PriceModel
+		stmt := imp.tx.Where("product_id = ? AND price_category_id = ? AND min_quantity = 0 AND effective_date <= ?", productID, categoryID, now)
+		if variantID != nil {
+			stmt = stmt.Where("variant_id = ?", *variantID)
+		} else {
+			stmt = stmt.Where("variant_id IS NULL")
+		}
+		if err := stmt.Order("effective_date DESC").Limit(1).Find(&current).Error; err != nil {
+			return err
+		}
+		if current.ID != "" && current.Amount == row.prices[name] && current.Currency == currency {
+			continue
+		}
+		price := models.PriceModel{
+			Amount:          row.prices[name],
+			Currency:        currency,
+			ProductID:       productID,
+			VariantID:       variantID,
+			PriceCategoryID: categoryID,
+			EffectiveDate:   now,
+		}
+		if err := imp.tx.Omit("Product", "Variant", "PriceCategory").Create(&price).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reference returns the ID of the record with the given name in a table of the
+// company, creating it when missing.
+func (imp *catalogImport) reference(table, name string, create func() (string, error)) (string, error) {
+	key := table + ":" + strings.ToLower(name)
+	if id, ok := imp.ids[key]; ok {
+		return id, nil
+	}
+	var id string
+	err := imp.tx.Table(table).Select("id").
+		Where("LOWER(name) = LOWER(?) AND (company_id = ? OR company_id IS NULL) AND deleted_at IS NULL", name, imp.companyID).
+		Order("company_id IS NULL").Limit(1).Scan(&id).Error
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		if id, err = create(); err != nil {
+			return "", err
+		}
+	}
+	imp.ids[key] = id
+	return id, nil
+}
+
+// unit returns the ID of the unit with the given code or name, creating it when
+// missing.
+func (imp *catalogImport) unit(code string) (string, error) {
+	key := "units:" + strings.ToLower(code)
+	if id, ok := imp.ids[key]; ok {
+		return id, nil
+	}
+	var id string
+	err := imp.tx.Table("units").Select("id").
+		Where("(LOWER(code) = LOWER(?) OR LOWER(name) = LOWER(?)) AND (company_id = ? OR company_id IS NULL) AND deleted_at IS NULL", code, code, imp.companyID).
+		Order("company_id IS NULL").Limit(1).Scan(&id).Error
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		unit := models.UnitModel{Name: code, Code: code, CompanyID: &imp.companyID}
+		if err := imp.tx.Create(&unit).Error; err != nil {
+			return "", err
+		}
+		id = unit.ID
+	}
+	imp.ids[key] = id
+	return id, nil
+}
+
+// parseCatalogNumber parses a non-negative number. A decimal comma is accepted
+// when the number has no decimal point.
+func parseCatalogNumber(value string) (float64, error) {
+	if !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", value)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("number must not be negative")
+	}
+	return n, nil
+}
+
+func parseCatalogBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "ya", "y", "1":
+		return true, nil
+	case "false", "no", "tidak", "n", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %s", value)
+}
+
+func formatCatalogNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func splitCatalogList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// catalogCells orders the cells of a row by the header.
+func catalogCells(header []string, row map[string]string) []string {
+	cells := make([]string, len(header))
+	for i, column := range header {
+		cells[i] = row[column]
+	}
+	return cells
+}
+
+func tagNames(tags []*models.TagModel) string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return strings.Join(names, ";")
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/barcode"
+)
+
+// GenerateLabels renders a PDF label sheet for a batch of products, variants and
+// lots. Each label shows the product name, the price in the given price
+// category, the SKU and a barcode of the given symbology (CODE128, EAN13 or QR).
+//
+// The barcode encodes the barcode of the variant or product, or its SKU when it
+// has none; lot labels encode the serial or lot number. Codes that are not a
+// valid EAN-13 are drawn as Code128. Without a price category, or when the
+// category has no price for the product, the price of the variant or product is
+// shown.
+func (s *ProductService) GenerateLabels(items []models.ProductLabelItem, priceCategoryID *string, symbology string, layout barcode.LabelLayout) ([]byte, error) {
+	var labels []barcode.Label
+	for _, item := range items {
+		label, err := s.productLabel(item, priceCategoryID, symbology)
+		if err != nil {
+			return nil, err
+		}
+		copies := item.Copies
+		if copies < 1 {
+			copies = 1
+		}
+		for i := 0; i < copies; i++ {
+			labels = append(labels, *label)
+		}
+	}
+	return barcode.LabelSheet(layout, labels)
+}
+
+// GetBarcode renders the barcode of a product or variant as "png" or "svg", with
+// each module scale pixels wide.
+func (s *ProductService) GetBarcode(productID string, variantID *string, symbology, format string, scale int) ([]byte, error) {
+	label, err := s.productLabel(models.ProductLabelItem{ProductID: productID, VariantID: variantID}, nil, symbology)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(format) {
+	case "png":
+		return label.Symbol.PNG(scale, 0)
+	case "svg":
+		return []byte(label.Symbol.SVG(scale, 0)), nil
+	}
+	return nil, fmt.Errorf("unsupported barcode format %s", format)
+}
+
+// AssignBarcode gives a product or variant without a barcode an EAN-13 for
+// in-store use. The code starts with prefix, a GS1 restricted circulation
+// prefix from 20 to 29 (default 20), followed by random digits and the check
+// digit.
+func (s *ProductService) AssignBarcode(productID string, variantID *string, prefix string) (string, error) {
+	if prefix == "" {
+		prefix = "20"
+	}
+	if len(prefix) != 2 || prefix[0] != '2' || prefix[1] < '0' || prefix[1] > '9' {
+		return "", errors.New("prefix must be between 20 and 29")
+	}
+
+	var product models.ProductModel
+	if err := s.db.Select("id", "barcode").First(&product, "id = ?", productID).Error; err != nil {
+		return "", err
+	}
+	var variant models.VariantModel
+	if variantID != nil {
+		if err := s.db.Select("id", "barcode").First(&variant, "id = ? AND product_id = ?", *variantID, productID).Error; err != nil {
+			return "", err
+		}
+		if variant.Barcode != nil && *variant.Barcode != "" {
+			return "", errors.New("variant already has a barcode")
+		}
+	} else if product.Barcode != nil && *product.Barcode != "" {
+		return "", errors.New("product already has a barcode")
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		code, err := barcode.CompleteEAN13(prefix + utils.GenerateRandomNumber(10))
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		s.db.Model(&models.ProductModel{}).Where("barcode = ?", code).Count(&count)
+		if count == 0 {
+			s.db.Model(&models.VariantModel{}).Where("barcode = ?", code).Count(&count)
+		}
+		if count > 0 {
+			continue
+		}
+		if variantID != nil {
+			return code, s.db.Model(&variant).Update("barcode", code).Error
+		}
+		return code, s.db.Model(&product).Update("barcode", code).Error
+	}
+	return "", errors.New("failed to generate a unique barcode")
+}
+
+func (s *ProductService) productLabel(item models.ProductLabelItem, priceCategoryID *string, symbology string) (*barcode.Label, error) {
+	var product models.ProductModel
+	if err := s.db.First(&product, "id = ?", item.ProductID).Error; err != nil {
+		return nil, fmt.Errorf("product %s not found", item.ProductID)
+	}
+	label := barcode.Label{Name: product.DisplayName}
+	if label.Name == "" {
+		label.Name = product.Name
+	}
+	price := product.Price
+	var code, sku string
+	if product.SKU != nil {
+		sku = *product.SKU
+	}
+	if product.Barcode != nil {
+		code = *product.Barcode
+	}
+
+	var details []string
+	if item.VariantID != nil {
+		var variant models.VariantModel
+		if err := s.db.First(&variant, "id = ? AND product_id = ?", *item.VariantID, product.ID).Error; err != nil {
+			return nil, fmt.Errorf("variant %s of product %s not found", *item.VariantID, label.Name)
+		}
+		if variant.DisplayName != "" {
+			details = append(details, variant.DisplayName)
+		}
+		if variant.SKU != "" {
+			sku = variant.SKU
+		}
+		if variant.Barcode != nil && *variant.Barcode != "" {
+			code = *variant.Barcode
+		}
+		if variant.Price > 0 {
+			price = variant.Price
+		}
+	}
+
+	currency := ""
+	if priceCategoryID != nil {
+		var categoryPrice models.PriceModel
+		stmt := s.db.Where("product_id = ? AND price_category_id = ? AND effective_date <= ? AND min_quantity <= 1", product.ID, *priceCategoryID, time.Now())
+		if item.VariantID != nil {
+			// Harga khusus varian didahulukan
+			stmt = stmt.Where("variant_id = ? OR variant_id IS NULL", *item.VariantID).Order("variant_id IS NULL")
+		} else {
+			stmt = stmt.Where("variant_id IS NULL")
+		}
+		if err := stmt.Order("effective_date DESC").First(&categoryPrice).Error; err == nil {
+			price = categoryPrice.Amount
+			currency = categoryPrice.Currency
+		}
+	}
+	label.Price = formatLabelPrice(price, currency)
+
+	if code == "" {
+		code = sku
+	}
+	if item.LotID != nil {
+		var lot models.StockLotModel
+		if err := s.db.First(&lot, "id = ? AND product_id = ?", *item.LotID, product.ID).Error; err != nil {
+			return nil, fmt.Errorf("lot %s of product %s not found", *item.LotID, label.Name)
+		}
+		details = append(details, "Lot "+lot.LotNumber)
+		code = lot.LotNumber
+		if lot.SerialNumber != nil && *lot.SerialNumber != "" {
+			details = append(details, "SN "+*lot.SerialNumber)
+			code = *lot.SerialNumber
+		}
+		if lot.ExpiryDate != nil {
+			details = append(details, "Exp "+lot.ExpiryDate.Format("2006-01-02"))
+		}
+	}
+	if code == "" {
+		return nil, fmt.Errorf("product %s has no barcode or SKU", label.Name)
+	}
+	label.Detail = strings.Join(details, ", ")
+	label.SKU = sku
+
+	if strings.EqualFold(symbology, barcode.EAN13) && barcode.ValidateEAN13(code) != nil {
+		symbology = barcode.CODE128
+	}
+	symbol, err := barcode.Encode(symbology, code)
+	if err != nil {
+		return nil, fmt.Errorf("barcode of product %s: %w", label.Name, err)
+	}
+	label.Symbol = symbol
+	return &label, nil
+}
+
+func formatLabelPrice(amount float64, currency string) string {
+	if currency == "" || currency == "IDR" {
+		return "Rp " + utils.FormatRupiah(amount)
+	}
+	return fmt.Sprintf("%s %.2f", currency, amount)
+}
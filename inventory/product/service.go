@@ -39,6 +39,7 @@ func Migrate(db *gorm.DB) error {
 		&models.PriceModel{},
 		&models.MasterProductPriceModel{},
 		&models.VariantModel{},
+		&models.BundleComponentModel{},
 		&models.VariantProductAttributeModel{},
 		&models.ProductAttributeModel{},
 		&models.ProductMerchant{},
@@ -485,7 +486,17 @@ func (s *ProductService) DeleteImageOfProduct(productID string, imageID string)
 // Returns:
 //
 //	the total stock quantity of the product if found, and an error if any error occurs.
+//
+// The stock of a bundle product is the number of bundles its components are
+// enough for, see GetBundleAvailability.
 func (s *ProductService) GetStock(productID string, request *http.Request, warehouseID *string) (float64, error) {
+	availability, err := s.bundleAvailability(productID, nil, request, warehouseID)
+	if err != nil {
+		return 0, err
+	}
+	if availability != nil {
+		return availability.Available, nil
+	}
 
 	var totalStock float64
 	db := s.db.Model(&models.StockMovementModel{})
@@ -615,7 +626,17 @@ func (s *ProductService) GetSalesVariantCount(productID, variantID string, reque
 // Returns:
 //
 //	the total stock quantity of the product variant if found, and an error if any error occurs.
+//
+// The stock of a bundle variant is the number of bundles its components are
+// enough for, see GetBundleAvailability.
 func (s *ProductService) GetVariantStock(productID string, variantID string, request *http.Request, warehouseID *string) (float64, error) {
+	availability, err := s.bundleAvailability(productID, &variantID, request, warehouseID)
+	if err != nil {
+		return 0, err
+	}
+	if availability != nil {
+		return availability.Available, nil
+	}
 
 	var totalStock float64
 	db := s.db.Model(&models.StockMovementModel{})
@@ -681,8 +702,78 @@ func (s *ProductService) CreateProductVariant(data *models.VariantModel) error {
 // The function takes a pointer to a ProductUnitData, which contains the data
 // for the new product unit. It returns an error if the creation
 // of the product unit fails.
+//
+// Value is the number of base units in one of the new unit; it defaults to 1.
+// The default unit of a product is its base unit, so it must have a value of 1
+// and replaces any other default unit.
 func (s *ProductService) AddProductUnit(data *models.ProductUnitData) error {
-	return s.db.Create(data).Error
+	if err := validateProductUnit(data); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if data.IsDefault {
+			if err := tx.Model(&models.ProductUnitData{}).Where("product_model_id = ?", data.ProductModelID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(data).Error
+	})
+}
+
+// UpdateProductUnit updates the conversion value and default flag of a unit of a
+// product, with the same rules as AddProductUnit.
+func (s *ProductService) UpdateProductUnit(data *models.ProductUnitData) error {
+	if data.ProductModelID == nil || data.UnitModelID == nil {
+		return errors.New("product ID and unit ID are required")
+	}
+	if err := validateProductUnit(data); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if data.IsDefault {
+			if err := tx.Model(&models.ProductUnitData{}).Where("product_model_id = ?", data.ProductModelID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&models.ProductUnitData{}).
+			Where("product_model_id = ? and unit_model_id = ?", data.ProductModelID, data.UnitModelID).
+			Updates(map[string]interface{}{"value": data.Value, "is_default": data.IsDefault})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("product unit not found")
+		}
+		return nil
+	})
+}
+
+// ConvertQuantity converts a quantity of a product from one of its units to
+// another. A nil unit is the base unit.
+func (s *ProductService) ConvertQuantity(productID string, quantity float64, fromUnitID, toUnitID *string) (float64, error) {
+	from, err := models.GetProductUnitValue(s.db, productID, fromUnitID)
+	if err != nil {
+		return 0, err
+	}
+	to, err := models.GetProductUnitValue(s.db, productID, toUnitID)
+	if err != nil {
+		return 0, err
+	}
+	return quantity * from / to, nil
+}
+
+// validateProductUnit checks the conversion value of a product unit.
+func validateProductUnit(data *models.ProductUnitData) error {
+	if data.Value == 0 {
+		data.Value = 1
+	}
+	if data.Value < 0 {
+		return errors.New("unit value must be greater than zero")
+	}
+	if data.IsDefault && data.Value != 1 {
+		return errors.New("the default unit is the base unit and must have a value of 1")
+	}
+	return nil
 }
 
 // DeleteProductUnit deletes a specific unit from a product in the database.
@@ -4,15 +4,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/google/uuid"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
@@ -45,6 +48,12 @@ func Migrate(db *gorm.DB) error {
 	return db.AutoMigrate(&models.PurchaseOrderModel{}, &models.PurchaseOrderItemModel{}, &models.PurchasePaymentModel{})
 }
 
+// SetDB sets the database connection used by the service, such as a transaction
+// the purchase documents are written in.
+func (s *PurchaseService) SetDB(db *gorm.DB) {
+	s.db = db
+}
+
 // UpdatePurchase updates the purchase order with the given id with the given data.
 //
 // It takes the id of the purchase order to be updated and a pointer to a PurchaseOrderModel which contains the updated data of the purchase order.
@@ -64,6 +73,15 @@ func (s *PurchaseService) DeletePurchase(id string) error {
 		if err != nil {
 			return err
 		}
+		var movementIDs []string
+		err = tx.Model(&models.StockMovementModel{}).Where("reference_id = ? or secondary_ref_id = ?", id, id).Pluck("id", &movementIDs).Error
+		if err != nil {
+			return err
+		}
+		err = stockmovement.ReverseCosts(tx, movementIDs)
+		if err != nil {
+			return err
+		}
 		err = tx.Where("reference_id = ? or secondary_ref_id = ?", id, id).Delete(&models.StockMovementModel{}).Error
 		if err != nil {
 			return err
@@ -116,12 +134,16 @@ func (s *PurchaseService) CreatePurchaseOrder(data *models.PurchaseOrderModel) e
 // It accepts the date of receipt, the purchase order ID, the warehouse ID, and a description
 // of the transaction. The function checks if the purchase order is in a "pending" state and,
 // if so, creates stock movements for each item in the purchase order, updating the stock status
-// to "received". It performs these operations within a transaction to ensure data consistency.
+// to "received". Items of lot or serial tracked products are received into the lot or the
+// serial numbers of the item, with its manufacture and expiry dates, and into the bin
+// of the item when it has one, at the cost of the line converted to the functional
+// currency. It performs these
+// operations within a transaction to ensure data consistency.
 // Returns an error if the purchase order is already processed or if any database operations fail.
 func (s *PurchaseService) ReceivePurchaseOrder(date time.Time, poID, warehouseID string, description string) error {
 	// companyID := s.ctx.Request.Header.Get("ID-Company")
 	var po models.PurchaseOrderModel
-	if err := s.db.First(&po, poID).Error; err != nil {
+	if err := s.db.Preload("Items").Where("id = ?", poID).First(&po).Error; err != nil {
 		return err
 	}
 
@@ -130,39 +152,100 @@ func (s *PurchaseService) ReceivePurchaseOrder(date time.Time, poID, warehouseID
 		return errors.New("purchase order already processed")
 	}
 
-	err := s.ctx.DB.Transaction(func(tx *gorm.DB) error {
+	// The goods come in at the cost of their line, converted to the
+	// functional currency like PostPurchase does.
+	rate := po.ExchangeRate
+	if rate <= 0 {
+		rate = 1
+	}
+	if po.CompanyID != nil && s.financeService != nil && s.financeService.CurrencyService != nil {
+		resolved, err := s.financeService.CurrencyService.ResolveRate(*po.CompanyID, po.CurrencyCode, po.ExchangeRate, date)
+		if err != nil {
+			return err
+		}
+		rate = resolved
+	}
+	rounding := models.GetCompanyRounding(s.db, po.CompanyID)
+
+	refType := "purchase"
+	secRefType := "purchase_item"
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// do some database operations in the transaction (use 'tx' from this point, not 'db')
+		s.stockMovementService.SetDB(tx)
 		for _, v := range po.Items {
-			if v.ProductID == nil || v.WarehouseID == nil {
+			if v.ProductID == nil {
 				continue
 			}
-			if _, err := s.stockMovementService.AddMovement(date, *v.ProductID, *v.WarehouseID, v.VariantID, nil, nil, nil, v.Quantity, models.MovementTypeIn, po.ID, description); err != nil {
-				tx.Rollback()
+			itemWarehouseID := warehouseID
+			if v.WarehouseID != nil {
+				itemWarehouseID = *v.WarehouseID
+			}
+			_, err := s.stockMovementService.RecordTrackedMovement(&models.StockMovementModel{
+				Date:             date,
+				ProductID:        *v.ProductID,
+				VariantID:        v.VariantID,
+				WarehouseID:      itemWarehouseID,
+				BinID:            v.BinID,
+				CompanyID:        po.CompanyID,
+				Quantity:         v.Quantity,
+				Value:            v.UnitValue,
+				Type:             models.MovementTypeIn,
+				ReferenceID:      po.ID,
+				ReferenceType:    &refType,
+				SecondaryRefID:   &v.ID,
+				SecondaryRefType: &secRefType,
+				UnitID:           v.UnitID,
+				TotalCost:        rounding.Document(money.FromFloat(v.SubTotal).Mul(rate)).Float64(),
+				Description:      description,
+			}, v.LotTracking)
+			if err != nil {
 				return err
 			}
 		}
 
 		// Update status PO menjadi "received"
 		po.StockStatus = "received"
-		if err := tx.Save(&po).Error; err != nil {
-			tx.Rollback()
-			return err
-		}
-
-		if err := tx.Commit().Error; err != nil {
-			tx.Rollback()
-			return err
-		}
-
-		// return nil will commit the whole transaction
-		return nil
+		return tx.Omit("Items").Save(&po).Error
 	})
+	s.stockMovementService.SetDB(s.db)
 
-	if err != nil {
-		return err
+	return err
+}
+
+// GetPutawaySuggestions suggests the bins to put the items of a purchase order
+// away into when it is received. Items already assigned to a bin are skipped, and
+// items without a warehouse are received into warehouseID.
+//
+// Quantities of the suggestions are in the base unit of the product; the
+// ReferenceID of a suggestion is the ID of its purchase order item.
+func (s *PurchaseService) GetPutawaySuggestions(poID, warehouseID string) ([]models.PutawaySuggestion, error) {
+	var po models.PurchaseOrderModel
+	if err := s.db.Preload("Items").Where("id = ?", poID).First(&po).Error; err != nil {
+		return nil, err
 	}
 
-	return nil
+	suggestions := []models.PutawaySuggestion{}
+	for _, v := range po.Items {
+		if v.ProductID == nil || v.BinID != nil {
+			continue
+		}
+		itemWarehouseID := warehouseID
+		if v.WarehouseID != nil {
+			itemWarehouseID = *v.WarehouseID
+		}
+		if itemWarehouseID == "" {
+			return nil, errors.New("warehouse ID is required")
+		}
+		lines, err := s.stockMovementService.SuggestPutaway(itemWarehouseID, *v.ProductID, v.VariantID, v.Quantity*v.UnitValue)
+		if err != nil {
+			return nil, err
+		}
+		for i := range lines {
+			lines[i].ReferenceID = v.ID
+		}
+		suggestions = append(suggestions, lines...)
+	}
+	return suggestions, nil
 }
 
 // CancelPurchaseOrder cancels a purchase order with the given ID.
@@ -220,9 +303,13 @@ func (s *PurchaseService) CancelPurchaseOrder(poID uint) error {
 //  4. If accountPayableID is not nil, it creates another transaction record with the following details:
 //     - AccountID: the ID of the account payable associated with the purchase order
 //     - Credit: the payment amount
-//  5. Updates the purchase order record in the database with the new paid amount.
-//  6. If the paid amount is equal to the total amount, it updates the status of the purchase order to "paid".
-//  7. Commits the transaction if all operations are successful. Otherwise, it rolls back the transaction.
+//  5. If the items have withholding taxes, the payment withholds its share of the purchase order's
+//     withholding: the asset account is credited with the payment less the withholding, the payable
+//     account of each withholding tax is credited with its part, a withholding slip is issued to the
+//     vendor, and the payment is recorded as a PurchasePaymentModel with the withheld amount.
+//  6. Updates the purchase order record in the database with the new paid amount.
+//  7. If the paid amount is equal to the total amount, it updates the status of the purchase order to "paid".
+//  8. Commits the transaction if all operations are successful. Otherwise, it rolls back the transaction.
 //
 // Returns an error if any of the operations fail.
 func (s *PurchaseService) CreatePayment(poID string, date time.Time, amount float64, accountPayableID *string, accountAssetID string) error {
@@ -232,7 +319,8 @@ func (s *PurchaseService) CreatePayment(poID string, date time.Time, amount floa
 		companyID = &compID
 	}
 
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		s.financeService.TransactionService.SetDB(tx)
 		var data models.PurchaseOrderModel
 		if err := s.db.First(&data, poID).Error; err != nil {
 			return err
@@ -247,6 +335,12 @@ func (s *PurchaseService) CreatePayment(poID string, date time.Time, amount floa
 			return errors.New("amount is greater than total")
 		}
 
+		rounding := models.GetCompanyRounding(tx, data.CompanyID)
+		withholdings, withheld, err := s.paymentWithholdings(tx, &data, money.FromFloat(amount), rounding)
+		if err != nil {
+			return err
+		}
+
 		if err := s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
 			Date:               date,
 			AccountID:          &accountAssetID,
@@ -255,10 +349,61 @@ func (s *PurchaseService) CreatePayment(poID string, date time.Time, amount floa
 			TransactionRefID:   &data.ID,
 			TransactionRefType: "purchase",
 			CompanyID:          companyID,
-		}, -amount); err != nil {
+			AnalyticDimensions: data.AnalyticDimensions,
+		}, -money.FromFloat(amount).Sub(withheld).Float64()); err != nil {
 			return err
 		}
 
+		if len(withholdings) > 0 {
+			paymentID := uuid.New().String()
+			for _, v := range withholdings {
+				// HUTANG PPh
+				if err := s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
+					Date:               date,
+					AccountID:          v.tax.AccountPayableID,
+					Description:        "Potongan " + v.tax.Name + " " + data.PurchaseNumber,
+					Notes:              data.Description,
+					TransactionRefID:   &data.ID,
+					TransactionRefType: "purchase",
+					CompanyID:          companyID,
+					AnalyticDimensions: data.AnalyticDimensions,
+					IsTax:              true,
+				}, v.amount.Float64()); err != nil {
+					return err
+				}
+				err := s.financeService.TaxService.CreateWithholdingSlip(tx, &models.WithholdingSlipModel{
+					CompanyID:     data.CompanyID,
+					Direction:     models.WITHHOLDING_SLIP_ISSUED,
+					Date:          date,
+					ContactID:     data.ContactID,
+					TaxID:         &v.tax.ID,
+					TaxType:       v.tax.TaxType,
+					TaxObjectCode: v.tax.TaxObjectCode,
+					Rate:          v.tax.Amount,
+					TaxBase:       v.base.Float64(),
+					Amount:        v.amount.Float64(),
+					PurchaseID:    &data.ID,
+					PaymentID:     &paymentID,
+					Reference:     data.PurchaseNumber,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			err := tx.Create(&models.PurchasePaymentModel{
+				BaseModel:      shared.BaseModel{ID: paymentID},
+				PaymentDate:    date,
+				PurchaseID:     &data.ID,
+				Amount:         amount,
+				CompanyID:      data.CompanyID,
+				AssetAccountID: &accountAssetID,
+				Withholding:    withheld.Float64(),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
 		if accountPayableID != nil {
 			if err := s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
 				Date:               date,
@@ -268,11 +413,16 @@ func (s *PurchaseService) CreatePayment(poID string, date time.Time, amount floa
 				TransactionRefID:   &data.ID,
 				TransactionRefType: "purchase",
 				CompanyID:          companyID,
+				AnalyticDimensions: data.AnalyticDimensions,
 			}, amount); err != nil {
 				return err
 			}
 		}
 
+		if err := s.financeService.ConsolidationService.TagDocument(tx, companyID, data.ContactID, data.ID); err != nil {
+			return err
+		}
+
 		data.Paid += amount
 		if err := tx.Save(data).Error; err != nil {
 			return err
@@ -292,6 +442,8 @@ func (s *PurchaseService) CreatePayment(poID string, date time.Time, amount floa
 
 		return nil
 	})
+	s.financeService.TransactionService.SetDB(s.db)
+	return err
 }
 
 // GetPurchases retrieves a paginated list of purchase orders from the database.
@@ -376,34 +528,57 @@ func (s *PurchaseService) GetPurchaseByID(id string) (*models.PurchaseOrderModel
 // and a pointer to a PurchaseOrderItemModel which contains the item details.
 // The function creates a new record in the purchase order items table with the given data.
 // It also updates the Total and Paid fields of the purchase order.
+// The unit of the item is converted to the base unit of the product; an item in
+// a unit that is not set up for the product is rejected.
 // The function returns an error if the operation fails.
 func (s *PurchaseService) AddItem(purchase *models.PurchaseOrderModel, data *models.PurchaseOrderItemModel) error {
+	if err := s.setBaseUnit(data); err != nil {
+		return err
+	}
 	if err := s.db.Create(data).Error; err != nil {
 		return err
 	}
 	return s.UpdateTotal(purchase)
 }
 
+// UpdateTotal recalculates the totals of a purchase order from its items.
+//
+// Amounts are added with exact decimal arithmetic and rounded with the rounding
+// configuration of the company. With PER_DOCUMENT rounding, the item taxes of
+// each tax rate are rounded once on their total and allocated back to the items.
+//
+// Withholding taxes of the items do not change the total; they are summed in
+// TotalWithholding, the part of the total withheld from the vendor on payment.
 func (s *PurchaseService) UpdateTotal(purchase *models.PurchaseOrderModel) error {
-	s.db.Preload("Items").Model(purchase).Find(purchase)
-	var totalBeforeTax, totalBeforeDisc, subTotal, itemsTax, totalDisc float64
+	s.db.Preload("Items.Tax").Preload("Items.WithholdingTax").Model(purchase).Find(purchase)
+	rounding := models.GetCompanyRounding(s.db, purchase.CompanyID)
+	if rounding.Mode == money.PER_DOCUMENT {
+		if err := s.allocateItemTaxes(purchase.Items, rounding); err != nil {
+			return err
+		}
+	}
+	if err := s.updateItemWithholdings(purchase.Items, rounding); err != nil {
+		return err
+	}
+	var totalBeforeTax, totalBeforeDisc, subTotal, itemsTax, totalDisc, totalWithholding money.Amount
 	for _, v := range purchase.Items {
-		totalBeforeDisc += v.SubtotalBeforeDisc
-		totalBeforeTax += v.SubTotal
-		subTotal += v.SubTotal
-		itemsTax += v.TotalTax
-		totalDisc += v.DiscountAmount
-	}
-	purchase.TotalBeforeTax = totalBeforeTax
-	purchase.TotalBeforeDisc = totalBeforeDisc
-	purchase.Subtotal = subTotal
-
-	afterTax, purchaseTaxAmount, taxBreakdown := s.CalculateTaxes(subTotal, purchase.IsCompound, purchase.Taxes)
-	// fmt.Printf("TAX_AMOUNT %f", purchaseTaxAmount)
+		totalBeforeDisc = totalBeforeDisc.Add(money.FromFloat(v.SubtotalBeforeDisc))
+		totalBeforeTax = totalBeforeTax.Add(money.FromFloat(v.SubTotal))
+		subTotal = subTotal.Add(money.FromFloat(v.SubTotal))
+		itemsTax = itemsTax.Add(rounding.Line(money.FromFloat(v.TotalTax)))
+		totalDisc = totalDisc.Add(money.FromFloat(v.DiscountAmount))
+		totalWithholding = totalWithholding.Add(money.FromFloat(v.TotalWithholding))
+	}
+	purchase.TotalBeforeTax = rounding.Document(totalBeforeTax).Float64()
+	purchase.TotalBeforeDisc = rounding.Document(totalBeforeDisc).Float64()
+	purchase.Subtotal = rounding.Document(subTotal).Float64()
+
+	afterTax, purchaseTaxAmount, taxBreakdown := s.CalculateTaxesWithRounding(purchase.Subtotal, purchase.IsCompound, purchase.Taxes, rounding)
 	purchase.Subtotal = afterTax
-	purchase.TotalTax = itemsTax + purchaseTaxAmount
-	purchase.Total = purchase.Subtotal + purchase.TotalTax
-	purchase.TotalDiscount = totalDisc
+	purchase.TotalTax = rounding.Document(itemsTax.Add(money.FromFloat(purchaseTaxAmount))).Float64()
+	purchase.Total = money.FromFloat(purchase.Subtotal).Add(money.FromFloat(purchase.TotalTax)).Float64()
+	purchase.TotalDiscount = rounding.Document(totalDisc).Float64()
+	purchase.TotalWithholding = rounding.Document(totalWithholding).Float64()
 	b, _ := json.Marshal(taxBreakdown)
 	purchase.TaxBreakdown = string(b)
 
@@ -414,29 +589,116 @@ func (s *PurchaseService) UpdateTotal(purchase *models.PurchaseOrderModel) error
 //
 // If the isCompound flag is true, the total tax is calculated by adding the tax amount of each tax model to the total amount.
 // If the isCompound flag is false, the total tax is calculated by adding the total tax amount of all tax models to the total amount.
+// Withholding taxes are skipped, as they are withheld on payment instead of added to the total.
 // The function returns the total amount after tax, the total tax amount, and a map of tax name to tax amount.
+// The amounts are rounded with money.DefaultRounding; see CalculateTaxesWithRounding.
 func (s *PurchaseService) CalculateTaxes(baseAmount float64, isCompound bool, taxes []*models.TaxModel) (float64, float64, map[string]float64) {
-	totalAmount := baseAmount
+	return s.CalculateTaxesWithRounding(baseAmount, isCompound, taxes, money.DefaultRounding)
+}
+
+// CalculateTaxesWithRounding is CalculateTaxes with exact decimal arithmetic and
+// the given rounding configuration.
+//
+// With PER_LINE rounding every tax is rounded half-up before it is added, and a
+// compound tax is computed on the rounded amount. With PER_DOCUMENT rounding the
+// taxes are computed exactly, the total tax is rounded once, and the breakdown is
+// allocated from the rounded total so that it always adds up.
+func (s *PurchaseService) CalculateTaxesWithRounding(baseAmount float64, isCompound bool, taxes []*models.TaxModel, rounding money.Rounding) (float64, float64, map[string]float64) {
+	base := money.FromFloat(baseAmount)
+	totalAmount := base
 	taxBreakdown := make(map[string]float64)
-	totalTax := 0.0
+	names := []string{}
+	amounts := []money.Amount{}
+	var totalTax money.Amount
 	for _, tax := range taxes {
-		if tax == nil {
+		if tax == nil || tax.IsWithholding() {
 			continue
 		}
-		taxAmount := (totalAmount * tax.Amount) / 100
-		// fmt.Printf("TAX_AMOUNT CalculateTaxes %f\n", taxAmount)
-		totalTax += taxAmount
-		taxBreakdown[tax.Name] = taxAmount
+		taxAmount := rounding.Line(totalAmount.Percent(tax.Amount))
+		totalTax = totalTax.Add(taxAmount)
+		names = append(names, tax.Name)
+		amounts = append(amounts, taxAmount)
 
 		if isCompound {
-			totalAmount += taxAmount
+			totalAmount = totalAmount.Add(taxAmount)
 		}
 	}
+	totalTax = rounding.Document(totalTax)
+	if rounding.Mode == money.PER_DOCUMENT {
+		amounts = totalTax.Allocate(amounts, rounding.Precision)
+	}
+	for i, name := range names {
+		taxBreakdown[name] = money.FromFloat(taxBreakdown[name]).Add(amounts[i]).Float64()
+	}
 
-	if !isCompound {
-		totalAmount += totalTax
+	return base.Add(totalTax).Float64(), totalTax.Float64(), taxBreakdown
+}
+
+// updateItemWithholdings computes the withholding of the items with a
+// withholding tax on their subtotal. Changed items are saved.
+func (s *PurchaseService) updateItemWithholdings(items []models.PurchaseOrderItemModel, rounding money.Rounding) error {
+	for i := range items {
+		item := &items[i]
+		var withholding money.Amount
+		if item.WithholdingTax != nil {
+			if !item.WithholdingTax.IsWithholding() {
+				return errors.New("tax " + item.WithholdingTax.Name + " is not a withholding tax")
+			}
+			withholding = rounding.Line(money.FromFloat(item.SubTotal).Percent(item.WithholdingTax.Amount))
+		}
+		if money.FromFloat(item.TotalWithholding) == withholding {
+			continue
+		}
+		item.TotalWithholding = withholding.Float64()
+		err := s.db.Model(&models.PurchaseOrderItemModel{}).Where("id = ?", item.ID).Update("total_withholding", item.TotalWithholding).Error
+		if err != nil {
+			return err
+		}
 	}
-	return totalAmount, totalTax, taxBreakdown
+	return nil
+}
+
+// allocateItemTaxes rounds the item taxes of every tax rate once on their
+// total and allocates the rounded total back to the items in proportion to
+// their subtotals. Changed items are saved.
+func (s *PurchaseService) allocateItemTaxes(items []models.PurchaseOrderItemModel, rounding money.Rounding) error {
+	groups := map[string][]int{}
+	keys := []string{}
+	for i, v := range items {
+		if v.TaxID == nil || v.Tax == nil {
+			continue
+		}
+		if _, ok := groups[*v.TaxID]; !ok {
+			keys = append(keys, *v.TaxID)
+		}
+		groups[*v.TaxID] = append(groups[*v.TaxID], i)
+	}
+	for _, key := range keys {
+		indexes := groups[key]
+		weights := make([]money.Amount, len(indexes))
+		var base money.Amount
+		for j, i := range indexes {
+			weights[j] = money.FromFloat(items[i].SubTotal)
+			base = base.Add(weights[j])
+		}
+		total := rounding.Document(base.Percent(items[indexes[0]].Tax.Amount))
+		for j, tax := range total.Allocate(weights, rounding.Precision) {
+			item := &items[indexes[j]]
+			if money.FromFloat(item.TotalTax) == tax {
+				continue
+			}
+			item.TotalTax = tax.Float64()
+			item.Total = money.FromFloat(item.SubTotal).Add(tax).Float64()
+			err := s.db.Model(&models.PurchaseOrderItemModel{}).Where("id = ?", item.ID).Updates(map[string]any{
+				"total_tax": item.TotalTax,
+				"total":     item.Total,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // GetItems retrieves all items associated with a specific purchase order ID.
@@ -462,6 +724,7 @@ func (s *PurchaseService) GetItems(id string) ([]models.PurchaseOrderItemModel,
 		Preload("Unit").
 		Preload("Variant").
 		Preload("Warehouse").
+		Preload("Bin").
 		Preload("Tax").
 		Where("purchase_id = ?", id).Order("created_at ASC").Find(&items).Error
 	if err != nil {
@@ -491,33 +754,36 @@ func (s *PurchaseService) DeleteItem(purchase *models.PurchaseOrderModel, itemID
 	return s.UpdateTotal(purchase)
 }
 
+// UpdateItem updates a purchase order item and the totals of its purchase order.
+//
+// UnitPrice is the price of one transaction unit, so the subtotal is UnitPrice
+// times Quantity; the base quantity and base unit price are derived from the
+// conversion value of the unit.
 func (s *PurchaseService) UpdateItem(purchase *models.PurchaseOrderModel, itemID string, item *models.PurchaseOrderItemModel) error {
 	taxPercent := 0.0
-	taxAmount := 0.0
 
-	if item.UnitID != nil {
-		productUnit := models.ProductUnitData{}
-		s.db.Model(&productUnit).Where("product_model_id = ? and unit_model_id = ?", item.ProductID, item.UnitID).Find(&productUnit)
-		item.UnitValue = productUnit.Value
-	} else {
-		item.UnitValue = 1
+	if err := s.setBaseUnit(item); err != nil {
+		return err
 	}
 
 	if item.TaxID != nil {
 		taxPercent = item.Tax.Amount
 	}
-	item.SubtotalBeforeDisc = (item.Quantity * item.UnitValue) * item.UnitPrice
+	rounding := models.GetCompanyRounding(s.db, purchase.CompanyID)
+	subtotalBeforeDisc := money.FromFloat(item.UnitPrice).Mul(item.Quantity).Round(rounding.Precision)
+	discountAmount := money.FromFloat(item.DiscountAmount)
 	if item.DiscountPercent > 0 {
-		taxAmount = (item.SubtotalBeforeDisc - (item.SubtotalBeforeDisc * item.DiscountPercent / 100)) * (taxPercent / 100)
-		item.SubTotal = (item.SubtotalBeforeDisc - (item.SubtotalBeforeDisc * item.DiscountPercent / 100))
-		item.DiscountAmount = item.SubtotalBeforeDisc * item.DiscountPercent / 100
+		discountAmount = subtotalBeforeDisc.Percent(item.DiscountPercent).Round(rounding.Precision)
 	} else {
-		taxAmount = (item.SubtotalBeforeDisc - item.DiscountAmount) * (taxPercent / 100)
-		item.SubTotal = (item.SubtotalBeforeDisc - item.DiscountAmount)
 		item.DiscountPercent = 0
 	}
-	item.TotalTax = taxAmount
-	item.Total = item.SubTotal + taxAmount
+	subTotal := subtotalBeforeDisc.Sub(discountAmount)
+	taxAmount := rounding.Line(subTotal.Percent(taxPercent))
+	item.SubtotalBeforeDisc = subtotalBeforeDisc.Float64()
+	item.DiscountAmount = discountAmount.Float64()
+	item.SubTotal = subTotal.Float64()
+	item.TotalTax = taxAmount.Float64()
+	item.Total = subTotal.Add(taxAmount).Float64()
 	err := s.db.Where("purchase_id = ? AND id = ?", purchase.ID, itemID).Omit("purchase_id").Save(item).Error
 	if err != nil {
 		return err
@@ -530,6 +796,8 @@ func (s *PurchaseService) UpdateItem(purchase *models.PurchaseOrderModel, itemID
 // The function takes a pointer to a PurchaseOrderModel and a string representing the user ID.
 // It updates the status of the purchase order to "POSTED", and sets the published at and published by fields.
 // It then creates a new transaction for each item in the purchase order, and updates the total cost of the purchase order.
+// Bills in a foreign currency are converted to the functional currency with the document exchange rate,
+// or the rate on the posting date when none is given.
 // The function returns an error if any of the operations fail.
 func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderModel, userID string, date time.Time) error {
 
@@ -540,6 +808,9 @@ func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderMode
 	if len(data.Items) == 0 {
 		return errors.New("items is required")
 	}
+	if err := s.financeService.PeriodLockService.CheckLock(data.CompanyID, "purchase", date); err != nil {
+		return err
+	}
 	now := time.Now()
 
 	if data.PaymentTermsCode != "" {
@@ -573,16 +844,29 @@ func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderMode
 	if data.PaymentAccountID == nil {
 		return errors.New("payment account is required")
 	}
+	rate, err := s.financeService.CurrencyService.ResolveRate(*data.CompanyID, data.CurrencyCode, data.ExchangeRate, date)
+	if err != nil {
+		return err
+	}
+	data.ExchangeRate = rate
+	rounding := models.GetCompanyRounding(s.db, data.CompanyID)
+	data.FunctionalTotal = rounding.Document(money.FromFloat(data.Total).Mul(rate)).Float64()
 	assetID := utils.Uuid()
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		s.financeService.TransactionService.SetDB(tx)
 		s.stockMovementService.SetDB(tx)
-		totalPayment := 0.0
+		// The payment line is the exact sum of the converted and rounded
+		// purchase and tax lines, so the journal always balances.
+		var totalPayment, functionalPayment money.Amount
 		for _, v := range data.Items {
 			var label = "Pembelian "
 			if v.IsCost {
 				label = "Biaya "
 			}
+			foreignCost := money.FromFloat(v.SubTotal)
+			cost := rounding.Document(foreignCost.Mul(rate))
+			foreignTax := rounding.Line(money.FromFloat(v.TotalTax))
+			tax := rounding.Document(foreignTax.Mul(rate))
 			err := s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
 				Date:                        date,
 				AccountID:                   &inventoryAccount.ID,
@@ -593,16 +877,21 @@ func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderMode
 				TransactionSecondaryRefID:   &data.ID,
 				TransactionSecondaryRefType: refType,
 				CompanyID:                   data.CompanyID,
-				Debit:                       v.SubTotal,
+				AnalyticDimensions:          data.AnalyticDimensions,
+				Debit:                       cost.Float64(),
 				UserID:                      &userID,
 				IsPurchaseCost:              v.IsCost,
 				IsPurchase:                  true,
-			}, v.SubTotal)
+				CurrencyCode:                data.CurrencyCode,
+				ExchangeRate:                rate,
+				ForeignAmount:               foreignCost.Float64(),
+			}, cost.Float64())
 			if err != nil {
 				return err
 			}
 
-			totalPayment += v.SubTotal + v.TotalTax
+			totalPayment = totalPayment.Add(foreignCost).Add(foreignTax)
+			functionalPayment = functionalPayment.Add(cost).Add(tax)
 
 			if v.TaxID != nil {
 				if v.Tax == nil {
@@ -622,11 +911,15 @@ func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderMode
 					TransactionSecondaryRefID:   &v.ID,
 					TransactionSecondaryRefType: secRefType,
 					CompanyID:                   data.CompanyID,
-					Debit:                       v.TotalTax,
+					AnalyticDimensions:          data.AnalyticDimensions,
+					Debit:                       tax.Float64(),
 					UserID:                      &userID,
 					IsAccountReceivable:         true,
 					IsTax:                       true,
-				}, v.TotalTax)
+					CurrencyCode:                data.CurrencyCode,
+					ExchangeRate:                rate,
+					ForeignAmount:               foreignTax.Float64(),
+				}, tax.Float64())
 				if err != nil {
 					return err
 				}
@@ -638,29 +931,26 @@ func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderMode
 					return errors.New("warehouse ID is required")
 				}
 				// ADD MOVEMENT
-				movement, err := s.stockMovementService.AddMovement(
-					time.Now(),
-					*v.ProductID,
-					*v.WarehouseID,
-					v.VariantID,
-					nil,
-					nil,
-					data.CompanyID,
-					v.Quantity,
-					models.MovementTypePurchase,
-					data.ID,
-					fmt.Sprintf("Purchase %s (%s)", data.PurchaseNumber, v.Description))
-				if err != nil {
-					return err
-				}
-				movement.ReferenceID = data.ID
-				movement.ReferenceType = &refType
-				movement.SecondaryRefID = &v.ID
-				movement.SecondaryRefType = &secRefType
-				movement.Value = v.UnitValue
-				movement.UnitID = v.UnitID
-
-				err = tx.Save(movement).Error
+				// The stock comes in at the converted cost of the line, into
+				// the lot or serial numbers of the line for tracked products.
+				_, err := s.stockMovementService.RecordTrackedMovement(&models.StockMovementModel{
+					Date:             date,
+					ProductID:        *v.ProductID,
+					VariantID:        v.VariantID,
+					WarehouseID:      *v.WarehouseID,
+					BinID:            v.BinID,
+					CompanyID:        data.CompanyID,
+					Quantity:         v.Quantity,
+					Value:            v.UnitValue,
+					Type:             models.MovementTypePurchase,
+					ReferenceID:      data.ID,
+					ReferenceType:    &refType,
+					SecondaryRefID:   &v.ID,
+					SecondaryRefType: &secRefType,
+					UnitID:           v.UnitID,
+					TotalCost:        cost.Float64(),
+					Description:      fmt.Sprintf("Purchase %s (%s)", data.PurchaseNumber, v.Description),
+				}, v.LotTracking)
 				if err != nil {
 					return err
 				}
@@ -684,9 +974,19 @@ func (s *PurchaseService) PostPurchase(id string, data *models.PurchaseOrderMode
 			TransactionRefID:   &data.ID,
 			TransactionRefType: refType,
 			CompanyID:          data.CompanyID,
-			Credit:             totalPayment,
+			AnalyticDimensions: data.AnalyticDimensions,
+			Credit:             functionalPayment.Float64(),
 			UserID:             &userID,
-		}, totalPayment)
+			CurrencyCode:       data.CurrencyCode,
+			ExchangeRate:       rate,
+			ForeignAmount:      totalPayment.Float64(),
+		}, functionalPayment.Float64())
+		if err != nil {
+			return err
+		}
+		if err := s.financeService.ConsolidationService.TagDocument(tx, data.CompanyID, data.ContactID, data.ID); err != nil {
+			return err
+		}
 
 		return tx.Save(data).Error
 	})
@@ -739,8 +1039,13 @@ func (s *PurchaseService) GetBalance(purchase *models.PurchaseOrderModel) (float
 //  5. If the payment discount is greater than 0, it creates another transaction record with the following details:
 //     - AccountID: the ID of the inventory account associated with the company
 //     - Credit: the discount amount
-//  6. Saves the purchase payment data in the database.
-//  7. Commits the transaction if all operations are successful. Otherwise, it rolls back the transaction.
+//  6. If the items have withholding taxes, the payment withholds its share of the bill's withholding:
+//     the asset account is credited with the payment less the withholding, the payable account of
+//     each withholding tax is credited with its part, and a withholding slip is issued to the vendor.
+//  7. If the purchase order is in a foreign currency and the payment rate differs from the bill rate,
+//     it posts the realized exchange difference to the realized FX account of the company.
+//  8. Saves the purchase payment data in the database.
+//  9. Commits the transaction if all operations are successful. Otherwise, it rolls back the transaction.
 //
 // Returns an error if any of the operations fail.
 func (s *PurchaseService) CreatePurchasePayment(purchase *models.PurchaseOrderModel, purchasePayment *models.PurchasePaymentModel) error {
@@ -767,12 +1072,42 @@ func (s *PurchaseService) CreatePurchasePayment(purchase *models.PurchaseOrderMo
 		if purchase.PaymentAccount.Type != "LIABILITY" {
 			return errors.New("purchase payment account type must be LIABILITY")
 		}
-		paymentAmount := purchasePayment.Amount
-		discountAmount := 0.0
+		if err := period.Check(tx, purchase.CompanyID, "purchase", purchasePayment.PaymentDate); err != nil {
+			return err
+		}
+		rounding := models.GetCompanyRounding(tx, purchase.CompanyID)
+		amount := money.FromFloat(purchasePayment.Amount)
+		var discount money.Amount
 		if purchasePayment.PaymentDiscount > 0 {
-			paymentAmount = purchasePayment.Amount - (purchasePayment.Amount * (purchasePayment.PaymentDiscount / 100))
-			discountAmount = purchasePayment.Amount * (purchasePayment.PaymentDiscount / 100)
+			discount = rounding.Document(amount.Percent(purchasePayment.PaymentDiscount))
 		}
+		withholdings, withheld, err := s.paymentWithholdings(tx, purchase, amount, rounding)
+		if err != nil {
+			return err
+		}
+		paymentAmount := amount.Sub(discount).Sub(withheld).Float64()
+		discountAmount := discount.Float64()
+		purchasePayment.Withholding = withheld.Float64()
+
+		billRate := purchase.ExchangeRate
+		if billRate <= 0 {
+			billRate = 1
+		}
+		paymentRate, err := s.financeService.CurrencyService.ResolveRate(*purchase.CompanyID, purchase.CurrencyCode, purchasePayment.ExchangeRate, purchasePayment.PaymentDate)
+		if err != nil {
+			return err
+		}
+		purchasePayment.ExchangeRate = paymentRate
+		// The difference is taken from the rounded lines so that the journal balances.
+		payable := rounding.Document(amount.Mul(billRate))
+		paid := rounding.Document(amount.Sub(discount).Sub(withheld).Mul(paymentRate))
+		discountValue := rounding.Document(discount.Mul(billRate))
+		var withheldValue money.Amount
+		for i := range withholdings {
+			withholdings[i].value = rounding.Document(withholdings[i].amount.Mul(paymentRate))
+			withheldValue = withheldValue.Add(withholdings[i].value)
+		}
+		purchasePayment.FxDifference = payable.Sub(paid).Sub(discountValue).Sub(withheldValue).Float64()
 
 		paymentID := uuid.New().String()
 		receivableID := uuid.New().String()
@@ -788,11 +1123,15 @@ func (s *PurchaseService) CreatePurchasePayment(purchase *models.PurchaseOrderMo
 			TransactionRefID:            &assetTransID,
 			TransactionRefType:          "transaction",
 			CompanyID:                   purchase.CompanyID,
-			Debit:                       purchasePayment.Amount,
-			Amount:                      purchasePayment.Amount,
+			AnalyticDimensions:          purchase.AnalyticDimensions,
+			Debit:                       payable.Float64(),
+			Amount:                      payable.Float64(),
 			UserID:                      purchasePayment.UserID,
 			TransactionSecondaryRefID:   &purchase.ID,
 			TransactionSecondaryRefType: "purchase",
+			CurrencyCode:                purchase.CurrencyCode,
+			ExchangeRate:                billRate,
+			ForeignAmount:               purchasePayment.Amount,
 		}
 		receivableData.ID = receivableID
 		err = s.db.Create(&receivableData).Error
@@ -810,11 +1149,15 @@ func (s *PurchaseService) CreatePurchasePayment(purchase *models.PurchaseOrderMo
 			TransactionRefID:            &receivableData.ID,
 			TransactionRefType:          "transaction",
 			CompanyID:                   purchase.CompanyID,
-			Credit:                      paymentAmount,
-			Amount:                      paymentAmount,
+			AnalyticDimensions:          purchase.AnalyticDimensions,
+			Credit:                      paid.Float64(),
+			Amount:                      paid.Float64(),
 			UserID:                      purchasePayment.UserID,
 			TransactionSecondaryRefID:   &purchase.ID,
 			TransactionSecondaryRefType: "purchase",
+			CurrencyCode:                purchase.CurrencyCode,
+			ExchangeRate:                paymentRate,
+			ForeignAmount:               paymentAmount,
 		}
 
 		assetData.ID = assetTransID
@@ -837,19 +1180,109 @@ func (s *PurchaseService) CreatePurchasePayment(purchase *models.PurchaseOrderMo
 				TransactionRefID:            &receivableData.ID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   purchase.CompanyID,
-				Credit:                      discountAmount,
-				Amount:                      discountAmount,
+				AnalyticDimensions:          purchase.AnalyticDimensions,
+				Credit:                      discountValue.Float64(),
+				Amount:                      discountValue.Float64(),
 				UserID:                      purchasePayment.UserID,
 				TransactionSecondaryRefID:   &purchase.ID,
 				TransactionSecondaryRefType: "purchase",
 				IsDiscount:                  true,
 				Notes:                       purchasePayment.Notes,
+				CurrencyCode:                purchase.CurrencyCode,
+				ExchangeRate:                billRate,
+				ForeignAmount:               discountAmount,
 			}).Error
 			if err != nil {
 				return err
 			}
 		}
 
+		for _, v := range withholdings {
+			// HUTANG PPh
+			err := tx.Create(&models.TransactionModel{
+				Code:                        utils.RandString(10, false),
+				Date:                        purchasePayment.PaymentDate,
+				AccountID:                   v.tax.AccountPayableID,
+				Description:                 "Potongan " + v.tax.Name + " " + purchase.PurchaseNumber,
+				Notes:                       purchasePayment.Notes,
+				TransactionRefID:            &receivableData.ID,
+				TransactionRefType:          "transaction",
+				CompanyID:                   purchase.CompanyID,
+				AnalyticDimensions:          purchase.AnalyticDimensions,
+				Credit:                      v.value.Float64(),
+				Amount:                      v.value.Float64(),
+				UserID:                      purchasePayment.UserID,
+				TransactionSecondaryRefID:   &purchase.ID,
+				TransactionSecondaryRefType: "purchase",
+				IsAccountPayable:            true,
+				IsTax:                       true,
+				CurrencyCode:                purchase.CurrencyCode,
+				ExchangeRate:                paymentRate,
+				ForeignAmount:               v.amount.Float64(),
+			}).Error
+			if err != nil {
+				return err
+			}
+			err = s.financeService.TaxService.CreateWithholdingSlip(tx, &models.WithholdingSlipModel{
+				CompanyID:     purchase.CompanyID,
+				Direction:     models.WITHHOLDING_SLIP_ISSUED,
+				Date:          purchasePayment.PaymentDate,
+				ContactID:     purchase.ContactID,
+				TaxID:         &v.tax.ID,
+				TaxType:       v.tax.TaxType,
+				TaxObjectCode: v.tax.TaxObjectCode,
+				Rate:          v.tax.Amount,
+				TaxBase:       rounding.Document(v.base.Mul(paymentRate)).Float64(),
+				Amount:        v.value.Float64(),
+				PurchaseID:    &purchase.ID,
+				PaymentID:     &paymentID,
+				Reference:     purchase.PurchaseNumber,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if purchasePayment.FxDifference != 0 {
+			// A higher rate on payment means more cash paid out for the same payable.
+			var fxAccount models.AccountModel
+			err := s.db.Where("is_realized_fx_account = ? and company_id = ?", true, *purchase.CompanyID).First(&fxAccount).Error
+			if err != nil {
+				return errors.New("realized fx account not found")
+			}
+			fxData := models.TransactionModel{
+				Date:                        purchasePayment.PaymentDate,
+				AccountID:                   &fxAccount.ID,
+				Description:                 "Selisih Kurs " + purchase.PurchaseNumber,
+				Notes:                       purchasePayment.Notes,
+				TransactionRefID:            &receivableData.ID,
+				TransactionRefType:          "transaction",
+				CompanyID:                   purchase.CompanyID,
+				AnalyticDimensions:          purchase.AnalyticDimensions,
+				Amount:                      math.Abs(purchasePayment.FxDifference),
+				UserID:                      purchasePayment.UserID,
+				TransactionSecondaryRefID:   &purchase.ID,
+				TransactionSecondaryRefType: "purchase",
+				CurrencyCode:                purchase.CurrencyCode,
+				ExchangeRate:                paymentRate,
+				IsFxDifference:              true,
+			}
+			if purchasePayment.FxDifference > 0 {
+				fxData.Credit = purchasePayment.FxDifference
+				fxData.IsIncome = true
+			} else {
+				fxData.Debit = -purchasePayment.FxDifference
+				fxData.IsExpense = true
+			}
+			if err := s.financeService.TransactionService.CreateTransaction(&fxData, fxData.Amount); err != nil {
+				return err
+			}
+		}
+
+		if err := s.financeService.ConsolidationService.TagDocument(tx, purchase.CompanyID, purchase.ContactID, purchase.ID); err != nil {
+			return err
+		}
+
 		purchasePayment.ID = paymentID
 
 		return tx.Create(purchasePayment).Error
@@ -857,3 +1290,98 @@ func (s *PurchaseService) CreatePurchasePayment(purchase *models.PurchaseOrderMo
 	s.financeService.TransactionService.SetDB(s.db)
 	return err
 }
+
+// paymentWithholding is the tax withheld on a payment for one withholding tax,
+// in the bill currency. The value is the withheld amount in the functional
+// currency at the payment rate.
+type paymentWithholding struct {
+	tax    *models.TaxModel
+	base   money.Amount
+	amount money.Amount
+	value  money.Amount
+}
+
+// paymentWithholdings returns the tax withheld on a payment of amount of a bill,
+// split over the withholding taxes of its items, and the total withheld.
+//
+// A payment withholds its share of the bill's TotalWithholding; the payment that
+// settles the bill withholds what is left, so the payments always withhold the
+// total exactly.
+func (s *PurchaseService) paymentWithholdings(tx *gorm.DB, purchase *models.PurchaseOrderModel, amount money.Amount, rounding money.Rounding) ([]paymentWithholding, money.Amount, error) {
+	if purchase.TotalWithholding == 0 || purchase.Total == 0 {
+		return nil, 0, nil
+	}
+	var items []models.PurchaseOrderItemModel
+	err := tx.Preload("WithholdingTax").Where("purchase_id = ? AND withholding_tax_id IS NOT NULL", purchase.ID).Find(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var previous struct {
+		Amount      float64
+		Withholding float64
+	}
+	err = tx.Model(&models.PurchasePaymentModel{}).
+		Select("coalesce(sum(amount), 0) as amount, coalesce(sum(withholding), 0) as withholding").
+		Where("purchase_id = ?", purchase.ID).
+		Scan(&previous).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	total := money.FromFloat(purchase.TotalWithholding)
+	withheld := total.Sub(money.FromFloat(previous.Withholding))
+	if money.FromFloat(previous.Amount).Add(amount) < money.FromFloat(purchase.Total) {
+		share := rounding.Document(total.Mul(amount.Float64() / purchase.Total))
+		if share < withheld {
+			withheld = share
+		}
+	}
+	if withheld.Sign() <= 0 {
+		return nil, 0, nil
+	}
+
+	withholdings := []paymentWithholding{}
+	weights := []money.Amount{}
+	index := map[string]int{}
+	for _, v := range items {
+		if v.WithholdingTax == nil || v.TotalWithholding == 0 {
+			continue
+		}
+		if v.WithholdingTax.AccountPayableID == nil {
+			return nil, 0, errors.New("account payable of tax " + v.WithholdingTax.Name + " is required")
+		}
+		i, ok := index[v.WithholdingTax.ID]
+		if !ok {
+			i = len(withholdings)
+			index[v.WithholdingTax.ID] = i
+			withholdings = append(withholdings, paymentWithholding{tax: v.WithholdingTax})
+			weights = append(weights, 0)
+		}
+		withholdings[i].base = withholdings[i].base.Add(money.FromFloat(v.SubTotal))
+		weights[i] = weights[i].Add(money.FromFloat(v.TotalWithholding))
+	}
+	if len(withholdings) == 0 {
+		return nil, 0, nil
+	}
+	ratio := withheld.Float64() / total.Float64()
+	for i, v := range withheld.Allocate(weights, rounding.Precision) {
+		withholdings[i].amount = v
+		withholdings[i].base = rounding.Document(withholdings[i].base.Mul(ratio))
+	}
+	return withholdings, withheld, nil
+}
+
+// setBaseUnit sets the conversion value of the unit of an item and its quantity
+// and unit price in the base unit of the product.
+func (s *PurchaseService) setBaseUnit(item *models.PurchaseOrderItemModel) error {
+	item.UnitValue = 1
+	if item.ProductID != nil {
+		unitValue, err := models.GetProductUnitValue(s.db, *item.ProductID, item.UnitID)
+		if err != nil {
+			return err
+		}
+		item.UnitValue = unitValue
+	}
+	item.BaseQuantity = item.Quantity * item.UnitValue
+	item.BaseUnitPrice = money.FromFloat(item.UnitPrice).Div(item.UnitValue).Float64()
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -189,6 +190,8 @@ func (s *PurchaseReturnService) CreateReturn(returnPurchase *models.ReturnModel)
 			UnitPrice:          v.UnitPrice,
 			UnitID:             v.UnitID,
 			Value:              v.UnitValue,
+			BaseQuantity:       v.Quantity * v.UnitValue,
+			BaseUnitPrice:      v.BaseUnitPrice,
 			Total:              v.Total,
 			SubTotal:           v.SubTotal,
 			SubtotalBeforeDisc: v.SubtotalBeforeDisc,
@@ -209,7 +212,9 @@ func (s *PurchaseReturnService) CreateReturn(returnPurchase *models.ReturnModel)
 // of return items, and verifies the necessary accounts. It then performs a series
 // of transactions to update financial and stock records, including creating transactions
 // for inventory, cash/credit, and tax accounts. Stock movements are recorded for
-// each return item, and the associated purchase order is updated. If an account ID
+// each return item and the inventory is credited with their cost; when the company
+// has a COGS account the difference with the returned amount is posted to it. The
+// associated purchase order is updated. If an account ID
 // is provided, additional transactions are performed for asset and source accounts,
 // and a purchase payment return is created if applicable.
 //
@@ -243,6 +248,15 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 		return errors.New("inventory account not found")
 	}
 
+	// The cost of goods sold account takes the difference between the
+	// returned amount and the cost of the returned stock. Without it the
+	// inventory is credited with the returned amount.
+	var cogsAccount *models.AccountModel
+	var account models.AccountModel
+	if err := s.db.Where("is_cogs_account = ? and company_id = ?", true, *purchase.CompanyID).First(&account).Error; err == nil {
+		cogsAccount = &account
+	}
+
 	returnRefType := "return_purchase"
 	returnSecRefType := "purchase"
 
@@ -257,6 +271,64 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 			inventoryID := utils.Uuid()
 			// fmt.Println(v)
 
+			// STOCK MOVEMENT
+			movement := models.StockMovementModel{
+				Date:             time.Now(),
+				ProductID:        *v.ProductID,
+				VariantID:        v.VariantID,
+				WarehouseID:      *v.WarehouseID,
+				CompanyID:        returnPurchase.CompanyID,
+				Quantity:         -v.Quantity,
+				Value:            v.Value,
+				Type:             models.MovementTypeReturn,
+				ReferenceID:      returnID,
+				ReferenceType:    &returnRefType,
+				SecondaryRefID:   &purchase.ID,
+				SecondaryRefType: &returnSecRefType,
+				UnitID:           v.UnitID,
+				Description:      fmt.Sprintf("Return %s (%s)", returnPurchase.ReturnNumber, v.Description),
+			}
+			err = s.stockMovementService.RecordMovement(&movement)
+			if err != nil {
+				return err
+			}
+
+			// The inventory is credited with the cost the goods leave the
+			// warehouse at; the difference with the returned amount goes to
+			// the cost of goods sold.
+			inventoryCost := money.FromFloat(v.SubTotal)
+			if cogsAccount != nil {
+				inventoryCost = money.FromFloat(-movement.TotalCost)
+				difference := money.FromFloat(v.SubTotal).Sub(inventoryCost)
+				if !difference.IsZero() {
+					trans := models.TransactionModel{
+						Code:                        utils.RandString(10, false),
+						Date:                        date,
+						AccountID:                   &cogsAccount.ID,
+						Description:                 fmt.Sprintf("[Retur %s] Selisih Harga %s", returnPurchase.ReturnNumber, v.Description),
+						TransactionRefID:            &assetID,
+						TransactionRefType:          "transaction",
+						CompanyID:                   purchase.CompanyID,
+						AnalyticDimensions:          purchase.AnalyticDimensions,
+						UserID:                      &userID,
+						TransactionSecondaryRefID:   &returnID,
+						TransactionSecondaryRefType: "return_purchase",
+						IsReturn:                    true,
+						Notes:                       returnPurchase.Notes,
+					}
+					if difference.Sign() > 0 {
+						trans.Credit = difference.Float64()
+					} else {
+						trans.Debit = difference.Neg().Float64()
+					}
+					trans.Amount = difference.Abs().Float64()
+					err = tx.Create(&trans).Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+
 			// PERSEDIAAN
 			err = tx.Create(&models.TransactionModel{
 				BaseModel:                   shared.BaseModel{ID: inventoryID},
@@ -267,8 +339,9 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 				TransactionRefID:            &assetID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   purchase.CompanyID,
-				Credit:                      v.SubTotal,
-				Amount:                      v.SubTotal,
+				AnalyticDimensions:          purchase.AnalyticDimensions,
+				Credit:                      inventoryCost.Float64(),
+				Amount:                      inventoryCost.Float64(),
 				UserID:                      &userID,
 				TransactionSecondaryRefID:   &returnID,
 				TransactionSecondaryRefType: "return_purchase",
@@ -289,6 +362,7 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 				TransactionRefID:            &inventoryID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   purchase.CompanyID,
+				AnalyticDimensions:          purchase.AnalyticDimensions,
 				Debit:                       v.Total,
 				Amount:                      v.Total,
 				UserID:                      &userID,
@@ -301,35 +375,6 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 				return err
 			}
 
-			// STOCK MOVEMENT
-
-			movement, err := s.stockMovementService.AddMovement(
-				time.Now(),
-				*v.ProductID,
-				*v.WarehouseID,
-				v.VariantID,
-				nil,
-				nil,
-				returnPurchase.CompanyID,
-				-v.Quantity,
-				models.MovementTypeReturn,
-				returnID,
-				fmt.Sprintf("Return %s (%s)", returnPurchase.ReturnNumber, v.Description))
-			if err != nil {
-				return err
-			}
-			movement.ReferenceID = returnID
-			movement.ReferenceType = &returnRefType
-			movement.SecondaryRefID = &purchase.ID
-			movement.SecondaryRefType = &returnSecRefType
-			movement.Value = v.Value
-			movement.UnitID = v.UnitID
-
-			err = tx.Save(movement).Error
-			if err != nil {
-				return err
-			}
-
 			if accountID != nil {
 				returnAssetID := utils.Uuid()
 				returnCreditID := utils.Uuid()
@@ -344,6 +389,7 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 					TransactionRefID:            &returnCreditID,
 					TransactionRefType:          "transaction",
 					CompanyID:                   purchase.CompanyID,
+					AnalyticDimensions:          purchase.AnalyticDimensions,
 					Debit:                       v.Total,
 					Amount:                      v.Total,
 					UserID:                      &userID,
@@ -366,6 +412,7 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 					TransactionRefID:            &returnAssetID,
 					TransactionRefType:          "transaction",
 					CompanyID:                   purchase.CompanyID,
+					AnalyticDimensions:          purchase.AnalyticDimensions,
 					Credit:                      v.Total,
 					Amount:                      v.Total,
 					UserID:                      &userID,
@@ -428,6 +475,7 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 					TransactionSecondaryRefID:   &purchase.ID,
 					TransactionSecondaryRefType: returnSecRefType,
 					CompanyID:                   returnPurchase.CompanyID,
+					AnalyticDimensions:          purchase.AnalyticDimensions,
 					Credit:                      v.TotalTax,
 					UserID:                      &userID,
 					IsAccountReceivable:         true,
@@ -439,6 +487,9 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 
 			}
 		}
+		if err := s.financeService.ConsolidationService.TagDocument(tx, purchase.CompanyID, purchase.ContactID, returnID); err != nil {
+			return err
+		}
 		// Commit the transaction
 		returnPurchase.Status = "RELEASED"
 		returnPurchase.ReleasedAt = &now
@@ -484,7 +535,9 @@ func (s *PurchaseReturnService) ReleaseReturn(returnID string, userID string, da
 // discount amount, subtotal, total tax, and total for the given return item
 // based on its quantity, unit price, discount percent, and tax information.
 // It fetches the unit value if a UnitID is provided and updates the item value
-// accordingly. The function also saves the updated item in the database.
+// and base quantity accordingly; a unit that is not set up for the product is
+// rejected. UnitPrice is the price of one unit of the item. The function also
+// saves the updated item in the database.
 //
 // Parameters:
 //   - item: A pointer to a ReturnItemModel containing the details of the return
@@ -496,18 +549,21 @@ func (s *PurchaseReturnService) UpdateItem(item *models.ReturnItemModel) error {
 	taxPercent := 0.0
 	taxAmount := 0.0
 
-	if item.UnitID != nil {
-		productUnit := models.ProductUnitData{}
-		s.db.Model(&productUnit).Where("product_model_id = ? and unit_model_id = ?", item.ProductID, item.UnitID).Find(&productUnit)
-		item.Value = productUnit.Value
-	} else {
-		item.Value = 1
+	item.Value = 1
+	if item.ProductID != nil {
+		unitValue, err := models.GetProductUnitValue(s.db, *item.ProductID, item.UnitID)
+		if err != nil {
+			return err
+		}
+		item.Value = unitValue
 	}
+	item.BaseQuantity = item.Quantity * item.Value
+	item.BaseUnitPrice = item.UnitPrice / item.Value
 
 	if item.TaxID != nil {
 		taxPercent = item.Tax.Amount
 	}
-	subtotalBeforeDisc := (item.Quantity * item.Value) * item.UnitPrice
+	subtotalBeforeDisc := item.Quantity * item.UnitPrice
 	if item.DiscountPercent > 0 {
 		taxAmount = (subtotalBeforeDisc - (subtotalBeforeDisc * item.DiscountPercent / 100)) * (taxPercent / 100)
 		item.SubTotal = (subtotalBeforeDisc - (subtotalBeforeDisc * item.DiscountPercent / 100))
@@ -0,0 +1,366 @@
+package replenishment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/inventory/purchase"
+	"github.com/AMETORY/ametory-erp-modules/inventory/reservation"
+	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// quantityEpsilon absorbs the float error of base quantities.
+const quantityEpsilon = 1e-9
+
+type ReplenishmentService struct {
+	db                   *gorm.DB
+	ctx                  *context.ERPContext
+	purchaseService      *purchase.PurchaseService
+	stockMovementService *stockmovement.StockMovementService
+	reservationService   *reservation.ReservationService
+}
+
+// NewReplenishmentService creates a new instance of ReplenishmentService with the given database connection,
+// context, purchase service, stock movement service and reservation service.
+func NewReplenishmentService(db *gorm.DB, ctx *context.ERPContext, purchaseService *purchase.PurchaseService, stockMovementService *stockmovement.StockMovementService, reservationService *reservation.ReservationService) *ReplenishmentService {
+	return &ReplenishmentService{
+		db:                   db,
+		ctx:                  ctx,
+		purchaseService:      purchaseService,
+		stockMovementService: stockMovementService,
+		reservationService:   reservationService,
+	}
+}
+
+// Migrate migrates the database schema for the ReorderRuleModel.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.ReorderRuleModel{})
+}
+
+// CreateReorderRule creates a new reorder rule. A product can have one rule per
+// variant and warehouse.
+func (s *ReplenishmentService) CreateReorderRule(data *models.ReorderRuleModel) error {
+	if err := validateRule(data); err != nil {
+		return err
+	}
+	stmt := s.db.Model(&models.ReorderRuleModel{}).Where("product_id = ? AND warehouse_id = ?", data.ProductID, data.WarehouseID)
+	if data.VariantID != nil {
+		stmt = stmt.Where("variant_id = ?", *data.VariantID)
+	} else {
+		stmt = stmt.Where("variant_id IS NULL")
+	}
+	var count int64
+	if err := stmt.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("reorder rule already exists for this product and warehouse")
+	}
+	return s.db.Create(data).Error
+}
+
+// UpdateReorderRule updates the reorder rule with the given ID.
+func (s *ReplenishmentService) UpdateReorderRule(id string, data *models.ReorderRuleModel) error {
+	if err := validateRule(data); err != nil {
+		return err
+	}
+	return s.db.Where("id = ?", id).Updates(data).Error
+}
+
+// DeleteReorderRule deletes the reorder rule with the given ID.
+func (s *ReplenishmentService) DeleteReorderRule(id string) error {
+	return s.db.Where("id = ?", id).Delete(&models.ReorderRuleModel{}).Error
+}
+
+// GetReorderRuleByID retrieves a reorder rule with its product, warehouse and vendor.
+func (s *ReplenishmentService) GetReorderRuleByID(id string) (*models.ReorderRuleModel, error) {
+	var rule models.ReorderRuleModel
+	err := s.db.Preload("Product").Preload("Warehouse").Preload("Vendor").Where("id = ?", id).First(&rule).Error
+	return &rule, err
+}
+
+// GetReorderRules retrieves a paginated list of reorder rules.
+//
+// The search query is applied to the product name. If the request contains a
+// company ID header, the result is filtered by the company ID; the warehouse_id,
+// product_id and vendor_id query parameters filter it further.
+func (s *ReplenishmentService) GetReorderRules(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Product").Preload("Warehouse").Preload("Vendor").
+		Joins("LEFT JOIN products ON products.id = reorder_rules.product_id")
+	if search != "" {
+		stmt = stmt.Where("products.name ILIKE ?", "%"+search+"%")
+	}
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("reorder_rules.company_id = ?", request.Header.Get("ID-Company"))
+	}
+	if request.URL.Query().Get("warehouse_id") != "" {
+		stmt = stmt.Where("reorder_rules.warehouse_id = ?", request.URL.Query().Get("warehouse_id"))
+	}
+	if request.URL.Query().Get("product_id") != "" {
+		stmt = stmt.Where("reorder_rules.product_id = ?", request.URL.Query().Get("product_id"))
+	}
+	if request.URL.Query().Get("vendor_id") != "" {
+		stmt = stmt.Where("reorder_rules.vendor_id = ?", request.URL.Query().Get("vendor_id"))
+	}
+	stmt = stmt.Model(&models.ReorderRuleModel{})
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.ReorderRuleModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// RunReplenishment compares the projected stock of every active reorder rule of a
+// company, optionally of one warehouse, with its levels and returns a report with
+// a suggestion for every rule that needs an order.
+//
+// The projected stock is the stock on hand (StockMovementService.GetBaseStock)
+// plus the quantities still to be received on purchase orders, minus the hard
+// reservations of confirmed orders (ReservationService.GetReserved); soft cart
+// reservations are left out. A rule without a
+// vendor takes the first supplier of the product.
+//
+// When createOrders is true the suggestions are put on draft purchase orders,
+// one per vendor and warehouse, priced at the last purchase price of each
+// product. Suggestions without a vendor are reported but not ordered.
+func (s *ReplenishmentService) RunReplenishment(companyID string, warehouseID *string, userID *string, createOrders bool) (*models.ReplenishmentReport, error) {
+	now := time.Now()
+	report := models.ReplenishmentReport{
+		Date:           now,
+		Suggestions:    []models.ReplenishmentSuggestion{},
+		PurchaseOrders: []models.PurchaseOrderModel{},
+	}
+
+	rules := []models.ReorderRuleModel{}
+	stmt := s.db.Preload("Product.Suppliers").Preload("Warehouse").Preload("Vendor").
+		Where("company_id = ? AND is_active = ?", companyID, true)
+	if warehouseID != nil {
+		stmt = stmt.Where("warehouse_id = ?", *warehouseID)
+	}
+	if err := stmt.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		suggestion, err := s.suggest(rule, now)
+		if err != nil {
+			return nil, err
+		}
+		if suggestion != nil {
+			report.Suggestions = append(report.Suggestions, *suggestion)
+		}
+	}
+	sort.SliceStable(report.Suggestions, func(i, j int) bool {
+		a, b := report.Suggestions[i], report.Suggestions[j]
+		if a.VendorName != b.VendorName {
+			return a.VendorName < b.VendorName
+		}
+		return a.ProductName < b.ProductName
+	})
+	if !createOrders {
+		return &report, nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		s.purchaseService.SetDB(tx)
+		defer s.purchaseService.SetDB(s.db)
+		orders := map[string]*models.PurchaseOrderModel{}
+		keys := []string{}
+		for i, v := range report.Suggestions {
+			if v.VendorID == nil {
+				continue
+			}
+			key := *v.VendorID + "|" + v.WarehouseID
+			po, ok := orders[key]
+			if !ok {
+				var vendor models.ContactModel
+				if err := tx.Where("id = ?", *v.VendorID).First(&vendor).Error; err != nil {
+					return err
+				}
+				contactData, err := json.Marshal(vendor)
+				if err != nil {
+					return err
+				}
+				po = &models.PurchaseOrderModel{
+					PurchaseNumber: fmt.Sprintf("RPL/%s/%s", now.Format("20060102"), utils.RandString(6, true)),
+					Code:           utils.RandString(10, true),
+					Description:    "Replenishment " + v.WarehouseName,
+					Notes:          fmt.Sprintf("Dibuat otomatis oleh replenishment %s", now.Format("2006-01-02 15:04")),
+					Status:         "DRAFT",
+					PurchaseDate:   now,
+					CompanyID:      &companyID,
+					UserID:         userID,
+					ContactID:      v.VendorID,
+					ContactData:    string(contactData),
+					TaxBreakdown:   "{}",
+					Type:           models.PROCUREMENT,
+					DocumentType:   models.PURCHASE_ORDER,
+				}
+				po.ID = utils.Uuid()
+				if err := tx.Create(po).Error; err != nil {
+					return err
+				}
+				orders[key] = po
+				keys = append(keys, key)
+			}
+			total := money.FromFloat(v.UnitPrice).Mul(v.Quantity).Float64()
+			item := models.PurchaseOrderItemModel{
+				PurchaseID:         &po.ID,
+				Description:        v.ProductName,
+				Notes:              v.Reason,
+				Quantity:           v.Quantity,
+				UnitPrice:          v.UnitPrice,
+				Total:              total,
+				SubTotal:           total,
+				SubtotalBeforeDisc: total,
+				ProductID:          &report.Suggestions[i].ProductID,
+				VariantID:          v.VariantID,
+				WarehouseID:        &report.Suggestions[i].WarehouseID,
+				UnitValue:          1,
+			}
+			if err := s.purchaseService.AddItem(po, &item); err != nil {
+				return err
+			}
+			report.Suggestions[i].PurchaseOrderID = &po.ID
+		}
+		for _, key := range keys {
+			report.PurchaseOrders = append(report.PurchaseOrders, *orders[key])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// suggest returns the suggestion of a rule, or nil when the projected stock is
+// above its levels.
+func (s *ReplenishmentService) suggest(rule models.ReorderRuleModel, now time.Time) (*models.ReplenishmentSuggestion, error) {
+	onHand, err := s.stockMovementService.GetBaseStock(rule.ProductID, rule.VariantID, rule.WarehouseID)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err := s.reservationService.GetIncoming(rule.ProductID, rule.VariantID, rule.WarehouseID)
+	if err != nil {
+		return nil, err
+	}
+	reserved, _, err := s.reservationService.GetReserved(rule.ProductID, rule.VariantID, rule.WarehouseID)
+	if err != nil {
+		return nil, err
+	}
+	projected := onHand + incoming - reserved
+
+	var trigger string
+	switch {
+	case rule.ReorderPoint > 0 && projected <= rule.ReorderPoint+quantityEpsilon:
+		trigger = fmt.Sprintf("at or below the reorder point of %v", rule.ReorderPoint)
+	case rule.MinQuantity > 0 && projected < rule.MinQuantity-quantityEpsilon:
+		trigger = fmt.Sprintf("below the minimum of %v", rule.MinQuantity)
+	default:
+		return nil, nil
+	}
+	target := rule.MaxQuantity
+	targetLabel := "maximum"
+	if target <= 0 {
+		target = math.Max(rule.MinQuantity, rule.ReorderPoint)
+		targetLabel = "minimum"
+	}
+	quantity := target - projected
+	if rule.ReorderMultiple > 0 {
+		quantity = math.Ceil(quantity/rule.ReorderMultiple-quantityEpsilon) * rule.ReorderMultiple
+	}
+	quantity = utils.AmountRound(quantity, 6)
+	if quantity <= quantityEpsilon {
+		return nil, nil
+	}
+
+	suggestion := models.ReplenishmentSuggestion{
+		RuleID:       rule.ID,
+		ProductID:    rule.ProductID,
+		VariantID:    rule.VariantID,
+		WarehouseID:  rule.WarehouseID,
+		VendorID:     rule.VendorID,
+		OnHand:       onHand,
+		Incoming:     incoming,
+		Reserved:     reserved,
+		Projected:    projected,
+		ReorderPoint: rule.ReorderPoint,
+		MinQuantity:  rule.MinQuantity,
+		MaxQuantity:  rule.MaxQuantity,
+		Quantity:     quantity,
+		LeadTimeDays: rule.LeadTimeDays,
+		ExpectedDate: now.AddDate(0, 0, rule.LeadTimeDays),
+	}
+	if rule.Product != nil {
+		suggestion.ProductName = rule.Product.Name
+		if suggestion.VendorID == nil && len(rule.Product.Suppliers) > 0 {
+			suggestion.VendorID = &rule.Product.Suppliers[0].ID
+			suggestion.VendorName = rule.Product.Suppliers[0].Name
+		}
+	}
+	if rule.Warehouse != nil {
+		suggestion.WarehouseName = rule.Warehouse.Name
+	}
+	if rule.Vendor != nil {
+		suggestion.VendorName = rule.Vendor.Name
+	}
+	suggestion.Reason = fmt.Sprintf("Projected stock %v (on hand %v + incoming %v - reserved %v) is %s; ordering %v to reach the %s of %v",
+		projected, onHand, incoming, reserved, trigger, quantity, targetLabel, target)
+	if suggestion.VendorID == nil {
+		suggestion.Reason += "; no vendor set, not ordered"
+	}
+	suggestion.UnitPrice, err = s.lastPurchasePrice(rule)
+	if err != nil {
+		return nil, err
+	}
+	return &suggestion, nil
+}
+
+// lastPurchasePrice returns the price per base unit the product of a rule was
+// last bought at, or zero when it was never bought.
+func (s *ReplenishmentService) lastPurchasePrice(rule models.ReorderRuleModel) (float64, error) {
+	var item models.PurchaseOrderItemModel
+	stmt := s.db.Where("product_id = ? AND unit_price > 0", rule.ProductID)
+	stmt = variantScope(stmt, "purchase_order_items", rule.VariantID)
+	if err := stmt.Order("created_at DESC").Limit(1).Find(&item).Error; err != nil {
+		return 0, err
+	}
+	if item.UnitValue == 0 {
+		return item.UnitPrice, nil
+	}
+	return money.FromFloat(item.UnitPrice).Div(item.UnitValue).Float64(), nil
+}
+
+// variantScope filters a query on a table with a variant_id column to a variant,
+// or to the rows without one.
+func variantScope(db *gorm.DB, table string, variantID *string) *gorm.DB {
+	if variantID != nil {
+		return db.Where(table+".variant_id = ?", *variantID)
+	}
+	return db.Where(table + ".variant_id IS NULL")
+}
+
+func validateRule(data *models.ReorderRuleModel) error {
+	if data.ReorderPoint < 0 || data.MinQuantity < 0 || data.MaxQuantity < 0 || data.ReorderMultiple < 0 {
+		return errors.New("reorder levels cannot be negative")
+	}
+	if data.MaxQuantity > 0 && data.MaxQuantity < data.MinQuantity {
+		return errors.New("max quantity must not be less than min quantity")
+	}
+	if data.MaxQuantity > 0 && data.MaxQuantity < data.ReorderPoint {
+		return errors.New("max quantity must not be less than the reorder point")
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package reservation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quantityEpsilon absorbs the float error of base quantities.
+const quantityEpsilon = 1e-9
+
+// CartReservationTTL is how long the soft reservation of a cart item holds after
+// the item was last changed.
+const CartReservationTTL = 30 * time.Minute
+
+// OrderReservationTTL is how long the hard reservation of an online order that
+// has not been paid or picked holds.
+const OrderReservationTTL = 24 * time.Hour
+
+type ReservationService struct {
+	db                   *gorm.DB
+	ctx                  *context.ERPContext
+	stockMovementService *stockmovement.StockMovementService
+}
+
+// NewReservationService creates a new instance of ReservationService with the given database connection,
+// context and stock movement service.
+func NewReservationService(db *gorm.DB, ctx *context.ERPContext, stockMovementService *stockmovement.StockMovementService) *ReservationService {
+	return &ReservationService{db: db, ctx: ctx, stockMovementService: stockMovementService}
+}
+
+// Migrate migrates the database schema for the StockReservationModel.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&models.StockReservationModel{})
+}
+
+func (s *ReservationService) SetDB(db *gorm.DB) {
+	s.db = db
+}
+
+// Reserve creates an active reservation.
+//
+// The product row is locked while the stock is checked so two documents cannot
+// claim the same last unit. A hard reservation fails when the quantity is more
+// than the stock on hand minus the other hard reservations, a soft one when it is
+// more than the stock on hand minus all reservations.
+//
+// A reservation of a bundle reserves its components instead, the base quantity
+// of the bundle times the quantity of each component, so bundles and loose
+// components claim the same stock.
+func (s *ReservationService) Reserve(data *models.StockReservationModel) error {
+	if data.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+	if data.WarehouseID == "" {
+		return errors.New("warehouse ID is required")
+	}
+	if data.Type == "" {
+		data.Type = models.RESERVATION_HARD
+	}
+	if data.Type != models.RESERVATION_HARD && data.Type != models.RESERVATION_SOFT {
+		return fmt.Errorf("invalid reservation type %s", data.Type)
+	}
+	data.Status = models.RESERVATION_ACTIVE
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.ProductModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "name", "is_bundle").Where("id = ?", data.ProductID).First(&product).Error; err != nil {
+			return err
+		}
+		if !product.IsBundle {
+			return s.reserve(tx, data, product.Name)
+		}
+		components, err := models.GetBundleComponents(tx, data.ProductID, data.VariantID)
+		if err != nil {
+			return err
+		}
+		if len(components) == 0 {
+			return fmt.Errorf("bundle %s has no components", product.Name)
+		}
+		bundleID := data.ProductID
+		for _, component := range components {
+			var componentProduct models.ProductModel
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "name").Where("id = ?", component.ComponentID).First(&componentProduct).Error; err != nil {
+				return err
+			}
+			line := *data
+			line.ID = ""
+			line.ProductID = component.ComponentID
+			line.Product = nil
+			line.VariantID = component.ComponentVariantID
+			line.Variant = nil
+			line.Quantity = data.Quantity * component.Quantity
+			line.BundleID = &bundleID
+			if err := s.reserve(tx, &line, componentProduct.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reserve creates a reservation of a product that holds stock if it fits in the
+// free stock. The product row must be locked by the caller.
+func (s *ReservationService) reserve(tx *gorm.DB, data *models.StockReservationModel, name string) error {
+	onHand, err := s.stockMovementService.GetBaseStock(data.ProductID, data.VariantID, data.WarehouseID)
+	if err != nil {
+		return err
+	}
+	hard, soft, err := s.reserved(tx, data.ProductID, data.VariantID, data.WarehouseID)
+	if err != nil {
+		return err
+	}
+	free := onHand - hard
+	if data.Type == models.RESERVATION_SOFT {
+		free -= soft
+	}
+	if data.Quantity > free+quantityEpsilon {
+		return fmt.Errorf("insufficient stock to reserve %s: %v available", name, utils.AmountRound(free, 6))
+	}
+	return tx.Create(data).Error
+}
+
+// SetReservation replaces the active reservation of a document line with a new
+// quantity, or releases it when the quantity is zero. It is used for carts, whose
+// lines change until checkout.
+func (s *ReservationService) SetReservation(data *models.StockReservationModel) error {
+	if data.SecondaryRefID == nil {
+		return errors.New("secondary reference ID is required")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		txService := &ReservationService{db: tx, ctx: s.ctx, stockMovementService: s.stockMovementService}
+		if err := txService.ReleaseItem(data.ReferenceType, data.ReferenceID, *data.SecondaryRefID); err != nil {
+			return err
+		}
+		if data.Quantity <= 0 {
+			return nil
+		}
+		return txService.Reserve(data)
+	})
+}
+
+// Release releases the active reservations of a document, e.g. when it is
+// cancelled.
+func (s *ReservationService) Release(referenceType, referenceID string) error {
+	return s.close(models.RESERVATION_RELEASED, s.db.Where("reference_type = ? AND reference_id = ?", referenceType, referenceID))
+}
+
+// ReleaseItem releases the active reservation of a document line.
+func (s *ReservationService) ReleaseItem(referenceType, referenceID, secondaryRefID string) error {
+	return s.close(models.RESERVATION_RELEASED, s.db.Where("reference_type = ? AND reference_id = ? AND secondary_ref_id = ?", referenceType, referenceID, secondaryRefID))
+}
+
+// Fulfill closes the active reservations of a document whose stock has left the
+// warehouse.
+func (s *ReservationService) Fulfill(referenceType, referenceID string) error {
+	return s.close(models.RESERVATION_FULFILLED, s.db.Where("reference_type = ? AND reference_id = ?", referenceType, referenceID))
+}
+
+// Transfer moves the active reservations of a document to the document made from
+// it, e.g. from a taken offer to its POS order, with a new expiry.
+func (s *ReservationService) Transfer(fromType, fromID, toType, toID string, expiresAt *time.Time) error {
+	return s.db.Model(&models.StockReservationModel{}).
+		Where("reference_type = ? AND reference_id = ? AND status = ?", fromType, fromID, models.RESERVATION_ACTIVE).
+		Updates(map[string]interface{}{
+			"reference_type": toType,
+			"reference_id":   toID,
+			"expires_at":     expiresAt,
+		}).Error
+}
+
+// ExpireReservations marks the active reservations that expired before now as
+// expired and returns how many there were. Expired reservations no longer count
+// even before this runs; it is meant for a scheduler to keep the table tidy.
+func (s *ReservationService) ExpireReservations(now time.Time) (int64, error) {
+	result := s.db.Model(&models.StockReservationModel{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", models.RESERVATION_ACTIVE, now).
+		Updates(map[string]interface{}{
+			"status":    models.RESERVATION_EXPIRED,
+			"closed_at": now,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// GetReservations retrieves a paginated list of reservations.
+//
+// The search query is applied to the product name. If the request contains a
+// company ID header, the result is filtered by the company ID; the product_id,
+// warehouse_id, status, type, reference_type and reference_id query parameters
+// filter it further.
+func (s *ReservationService) GetReservations(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Product").Preload("Variant").Preload("Warehouse").
+		Joins("LEFT JOIN products ON products.id = stock_reservations.product_id")
+	if search != "" {
+		stmt = stmt.Where("products.name ILIKE ?", "%"+search+"%")
+	}
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("stock_reservations.company_id = ?", request.Header.Get("ID-Company"))
+	}
+	for _, param := range []string{"product_id", "warehouse_id", "status", "type", "reference_type", "reference_id"} {
+		if request.URL.Query().Get(param) != "" {
+			stmt = stmt.Where("stock_reservations."+param+" = ?", request.URL.Query().Get(param))
+		}
+	}
+	stmt = stmt.Model(&models.StockReservationModel{})
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.StockReservationModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// GetReserved returns the base quantity of a product or variant in a warehouse
+// held by active, unexpired hard and soft reservations.
+func (s *ReservationService) GetReserved(productID string, variantID *string, warehouseID string) (float64, float64, error) {
+	return s.reserved(s.db, productID, variantID, warehouseID)
+}
+
+// GetIncoming returns the base quantity of a product or variant still to be
+// received into a warehouse on purchase orders that are neither cancelled nor
+// billed.
+func (s *ReservationService) GetIncoming(productID string, variantID *string, warehouseID string) (float64, error) {
+	var quantity float64
+	stmt := s.db.Table("purchase_order_items").
+		Select("COALESCE(SUM(purchase_order_items.quantity * purchase_order_items.unit_value), 0)").
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_items.purchase_id").
+		Where("purchase_order_items.deleted_at IS NULL AND purchase_orders.deleted_at IS NULL").
+		Where("purchase_orders.document_type = ? AND purchase_orders.stock_status = ?", models.PURCHASE_ORDER, "pending").
+		Where("COALESCE(purchase_orders.status, '') <> ?", "CANCELLED").
+		Where("NOT EXISTS (SELECT 1 FROM purchase_orders bills WHERE bills.ref_id = purchase_orders.id AND bills.document_type = ? AND bills.deleted_at IS NULL)", models.BILL).
+		Where("purchase_order_items.product_id = ? AND purchase_order_items.warehouse_id = ?", productID, warehouseID)
+	stmt = variantScope(stmt, "purchase_order_items", variantID)
+	err := stmt.Scan(&quantity).Error
+	return quantity, err
+}
+
+// GetAvailableToPromise returns the stock of a product or variant in a warehouse
+// that can still be promised: on hand minus reserved plus incoming.
+//
+// For a bundle the quantities are numbers of bundles: the bundles its components
+// make, the bundles their reservations take and the bundles their incoming
+// stock adds.
+func (s *ReservationService) GetAvailableToPromise(productID string, variantID *string, warehouseID string) (*models.AvailableToPromise, error) {
+	var product models.ProductModel
+	if err := s.db.Select("id", "is_bundle").Where("id = ?", productID).First(&product).Error; err != nil {
+		return nil, err
+	}
+	if product.IsBundle {
+		return s.bundleAvailableToPromise(productID, variantID, warehouseID)
+	}
+	onHand, err := s.stockMovementService.GetBaseStock(productID, variantID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	hard, soft, err := s.GetReserved(productID, variantID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err := s.GetIncoming(productID, variantID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AvailableToPromise{
+		ProductID:    productID,
+		VariantID:    variantID,
+		WarehouseID:  warehouseID,
+		OnHand:       onHand,
+		HardReserved: hard,
+		SoftReserved: soft,
+		Reserved:     hard + soft,
+		Incoming:     incoming,
+		Available:    onHand - hard - soft + incoming,
+	}, nil
+}
+
+// bundleAvailableToPromise returns the available to promise of a bundle from
+// that of its components, each step being the fewest bundles any component
+// allows.
+func (s *ReservationService) bundleAvailableToPromise(productID string, variantID *string, warehouseID string) (*models.AvailableToPromise, error) {
+	components, err := models.GetBundleComponents(s.db, productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+	var onHand, afterHard, afterSoft, available float64
+	for i, component := range components {
+		atp, err := s.GetAvailableToPromise(component.ComponentID, component.ComponentVariantID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		bundles := []float64{
+			models.BundlesFor(atp.OnHand, component.Quantity),
+			models.BundlesFor(atp.OnHand-atp.HardReserved, component.Quantity),
+			models.BundlesFor(atp.OnHand-atp.Reserved, component.Quantity),
+			models.BundlesFor(atp.Available, component.Quantity),
+		}
+		if i == 0 {
+			onHand, afterHard, afterSoft, available = bundles[0], bundles[1], bundles[2], bundles[3]
+			continue
+		}
+		onHand = min(onHand, bundles[0])
+		afterHard = min(afterHard, bundles[1])
+		afterSoft = min(afterSoft, bundles[2])
+		available = min(available, bundles[3])
+	}
+	return &models.AvailableToPromise{
+		ProductID:    productID,
+		VariantID:    variantID,
+		WarehouseID:  warehouseID,
+		OnHand:       onHand,
+		HardReserved: onHand - afterHard,
+		SoftReserved: afterHard - afterSoft,
+		Reserved:     onHand - afterSoft,
+		Incoming:     available - afterSoft,
+		Available:    available,
+	}, nil
+}
+
+// reserved sums the active, unexpired reservations of a product or variant in a
+// warehouse per type.
+func (s *ReservationService) reserved(db *gorm.DB, productID string, variantID *string, warehouseID string) (float64, float64, error) {
+	var rows []struct {
+		Type     string
+		Quantity float64
+	}
+	stmt := db.Model(&models.StockReservationModel{}).
+		Select("type, COALESCE(SUM(quantity), 0) AS quantity").
+		Where("product_id = ? AND warehouse_id = ? AND status = ?", productID, warehouseID, models.RESERVATION_ACTIVE).
+		Where("(expires_at IS NULL OR expires_at > ?)", time.Now())
+	stmt = variantScope(stmt, "stock_reservations", variantID)
+	if err := stmt.Group("type").Scan(&rows).Error; err != nil {
+		return 0, 0, err
+	}
+	var hard, soft float64
+	for _, v := range rows {
+		if v.Type == models.RESERVATION_SOFT {
+			soft += v.Quantity
+		} else {
+			hard += v.Quantity
+		}
+	}
+	return hard, soft, nil
+}
+
+// close sets the status of the active reservations selected by stmt.
+func (s *ReservationService) close(status string, stmt *gorm.DB) error {
+	return stmt.Model(&models.StockReservationModel{}).
+		Where("status = ?", models.RESERVATION_ACTIVE).
+		Updates(map[string]interface{}{
+			"status":    status,
+			"closed_at": time.Now(),
+		}).Error
+}
+
+// variantScope filters a query on a table with a variant_id column to a variant,
+// or to the rows without one.
+func variantScope(db *gorm.DB, table string, variantID *string) *gorm.DB {
+	if variantID != nil {
+		return db.Where(table+".variant_id = ?", *variantID)
+	}
+	return db.Where(table + ".variant_id IS NULL")
+}
@@ -0,0 +1,418 @@
+package stockmovement
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"gorm.io/gorm"
+)
+
+// GetBinStock returns the stock per bin, product and lot of a warehouse in
+// picking route order, optionally for one product.
+func (s *StockMovementService) GetBinStock(warehouseID string, productID *string) ([]models.BinStock, error) {
+	stock := []models.BinStock{}
+	stmt := s.binStockQuery().Where("stock_movements.warehouse_id = ?", warehouseID)
+	if productID != nil {
+		stmt = stmt.Where("stock_movements.product_id = ?", *productID)
+	}
+	err := s.groupBinStock(stmt).
+		Order("warehouse_bins.route_sequence, warehouse_bins.code, products.name").
+		Scan(&stock).Error
+	return stock, err
+}
+
+// GetBinQuantity returns the base quantity of a product or variant in a bin, or
+// of a lot in the bin when lotID is not nil.
+func (s *StockMovementService) GetBinQuantity(binID, productID string, variantID, lotID *string) (float64, error) {
+	var quantity float64
+	stmt := s.db.Model(&models.StockMovementModel{}).
+		Select("COALESCE(SUM(quantity * value), 0)").
+		Where("bin_id = ? AND product_id = ?", binID, productID)
+	if variantID != nil {
+		stmt = stmt.Where("variant_id = ?", *variantID)
+	} else {
+		stmt = stmt.Where("variant_id IS NULL")
+	}
+	if lotID != nil {
+		stmt = stmt.Where("lot_id = ?", *lotID)
+	}
+	err := stmt.Scan(&quantity).Error
+	return quantity, err
+}
+
+// SuggestPutaway suggests the bins of a warehouse to put a received base quantity
+// of a product into. Bins that already hold the product come first so stock is
+// kept together, then empty bins, each in picking route order and filled up to
+// its capacity; bins without a capacity take the whole rest. The quantity no bin
+// has room for is returned as a suggestion without a bin.
+func (s *StockMovementService) SuggestPutaway(warehouseID, productID string, variantID *string, quantity float64) ([]models.PutawaySuggestion, error) {
+	bins := []models.WarehouseBinModel{}
+	if err := s.db.Where("warehouse_id = ? AND is_active = ?", warehouseID, true).Order("route_sequence, code").Find(&bins).Error; err != nil {
+		return nil, err
+	}
+	var occupancy []struct {
+		BinID    string
+		Quantity float64
+		Holds    bool
+	}
+	holds := "product_id = ?"
+	args := []interface{}{productID}
+	if variantID != nil {
+		holds += " AND variant_id = ?"
+		args = append(args, *variantID)
+	} else {
+		holds += " AND variant_id IS NULL"
+	}
+	err := s.db.Model(&models.StockMovementModel{}).
+		Select("bin_id, SUM(quantity * value) AS quantity, SUM(CASE WHEN "+holds+" THEN quantity * value ELSE 0 END) > 0 AS holds", args...).
+		Where("warehouse_id = ? AND bin_id IS NOT NULL", warehouseID).
+		Group("bin_id").
+		Scan(&occupancy).Error
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]float64{}
+	holding := map[string]bool{}
+	for _, v := range occupancy {
+		used[v.BinID] = v.Quantity
+		holding[v.BinID] = v.Holds
+	}
+
+	suggestions := []models.PutawaySuggestion{}
+	left := quantity
+	for _, pass := range []string{"holds", "empty"} {
+		for _, bin := range bins {
+			if left <= quantityEpsilon {
+				break
+			}
+			if pass == "holds" && !holding[bin.ID] {
+				continue
+			}
+			if pass == "empty" && (holding[bin.ID] || used[bin.ID] > quantityEpsilon) {
+				continue
+			}
+			take := left
+			if bin.Capacity > 0 {
+				take = math.Min(left, bin.Capacity-used[bin.ID])
+			}
+			if take <= quantityEpsilon {
+				continue
+			}
+			reason := "bin already holds the product"
+			if pass == "empty" {
+				reason = "empty bin"
+			}
+			if bin.Capacity > 0 {
+				reason += fmt.Sprintf(", %v of %v free", bin.Capacity-used[bin.ID], bin.Capacity)
+			}
+			binID := bin.ID
+			suggestions = append(suggestions, models.PutawaySuggestion{
+				ProductID: productID,
+				VariantID: variantID,
+				BinID:     &binID,
+				BinCode:   bin.Code,
+				BinName:   bin.Name,
+				Quantity:  take,
+				Reason:    reason,
+			})
+			used[bin.ID] += take
+			left -= take
+		}
+	}
+	if left > quantityEpsilon {
+		suggestions = append(suggestions, models.PutawaySuggestion{
+			ProductID: productID,
+			VariantID: variantID,
+			Quantity:  left,
+			Reason:    "no bin has room left",
+		})
+	}
+	return suggestions, nil
+}
+
+// BuildPickingList allocates the lines to pick from a warehouse to the bins that
+// hold them and returns the picking list sorted by picking route. Within a product
+// the lots expiring first are taken first, then the bins first on the route. The
+// quantity the bins cannot cover is picked from stock that has not been put away
+// and listed last.
+func (s *StockMovementService) BuildPickingList(warehouseID string, requests []models.PickingRequest) ([]models.PickingLine, error) {
+	lines := []models.PickingLine{}
+	for _, request := range requests {
+		stock := []models.BinStock{}
+		stmt := s.binStockQuery().
+			Where("stock_movements.warehouse_id = ? AND stock_movements.product_id = ?", warehouseID, request.ProductID)
+		if request.VariantID != nil {
+			stmt = stmt.Where("stock_movements.variant_id = ?", *request.VariantID)
+		} else {
+			stmt = stmt.Where("stock_movements.variant_id IS NULL")
+		}
+		err := s.groupBinStock(stmt).
+			Order("stock_lots.expiry_date ASC NULLS LAST, warehouse_bins.route_sequence, warehouse_bins.code").
+			Scan(&stock).Error
+		if err != nil {
+			return nil, err
+		}
+		left := request.Quantity
+		for _, v := range stock {
+			if left <= quantityEpsilon {
+				break
+			}
+			take := math.Min(left, v.Quantity)
+			binID := v.BinID
+			lines = append(lines, models.PickingLine{
+				ReferenceID:   request.ReferenceID,
+				RouteSequence: v.RouteSequence,
+				BinID:         &binID,
+				BinCode:       v.BinCode,
+				ProductID:     v.ProductID,
+				ProductName:   v.ProductName,
+				VariantID:     v.VariantID,
+				LotID:         v.LotID,
+				LotNumber:     v.LotNumber,
+				ExpiryDate:    v.ExpiryDate,
+				Quantity:      take,
+			})
+			left -= take
+		}
+		if left > quantityEpsilon {
+			var product models.ProductModel
+			if err := s.db.Select("id", "name").Where("id = ?", request.ProductID).First(&product).Error; err != nil {
+				return nil, err
+			}
+			lines = append(lines, models.PickingLine{
+				ReferenceID:   request.ReferenceID,
+				RouteSequence: math.MaxInt32,
+				ProductID:     request.ProductID,
+				ProductName:   product.Name,
+				VariantID:     request.VariantID,
+				Quantity:      left,
+			})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].RouteSequence != lines[j].RouteSequence {
+			return lines[i].RouteSequence < lines[j].RouteSequence
+		}
+		return lines[i].BinCode < lines[j].BinCode
+	})
+	return lines, nil
+}
+
+// TransferStockWithBins moves a quantity of a product from a bin of a warehouse to
+// a bin of another or the same warehouse; a nil bin is the stock of the warehouse
+// that has not been put away. The stock comes in at the cost it leaves at.
+//
+// A move between bins of the same warehouse does not change the value or the cost
+// layers of the warehouse, so both movements are recorded without a cost. Lot
+// tracked products move the lots picked first expired, first out across the
+// source warehouse, each into the same lot at the destination.
+//
+// It returns the first movement into the destination.
+func (s *StockMovementService) TransferStockWithBins(date time.Time, sourceWarehouseID string, sourceBinID *string, destinationWarehouseID string, destinationBinID *string, productID string, variantID *string, quantity float64, description string) (*models.StockMovementModel, error) {
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be greater than zero")
+	}
+	if sourceWarehouseID == destinationWarehouseID && equalBin(sourceBinID, destinationBinID) {
+		return nil, errors.New("source and destination are the same")
+	}
+	if err := s.checkBin(sourceBinID, sourceWarehouseID); err != nil {
+		return nil, err
+	}
+	if err := s.checkBin(destinationBinID, destinationWarehouseID); err != nil {
+		return nil, err
+	}
+	if sourceBinID != nil {
+		inBin, err := s.GetBinQuantity(*sourceBinID, productID, variantID, nil)
+		if err != nil {
+			return nil, err
+		}
+		if inBin < quantity-quantityEpsilon {
+			return nil, fmt.Errorf("insufficient stock in bin: %v available", inBin)
+		}
+	}
+
+	var first *models.StockMovementModel
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		txService := &StockMovementService{db: tx, ctx: s.ctx, isMerchantMode: s.isMerchantMode}
+		// membuat pergerakan stok di gudang / bin sumber
+		out := models.StockMovementModel{
+			Date:        date,
+			ProductID:   productID,
+			VariantID:   variantID,
+			WarehouseID: sourceWarehouseID,
+			BinID:       sourceBinID,
+			Quantity:    -quantity,
+			Value:       1,
+			Type:        models.MovementTypeTransfer,
+			Description: description,
+		}
+		var outs []models.StockMovementModel
+		if sourceWarehouseID == destinationWarehouseID {
+			var err error
+			outs, err = txService.binMove(&out)
+			if err != nil {
+				return err
+			}
+		} else {
+			var err error
+			outs, err = txService.RecordTrackedMovement(&out, models.LotTracking{})
+			if err != nil {
+				return err
+			}
+		}
+
+		// membuat pergerakan stok di gudang / bin tujuan
+		for _, v := range outs {
+			in := models.StockMovementModel{
+				Date:        date,
+				ProductID:   productID,
+				VariantID:   variantID,
+				LotID:       v.LotID,
+				WarehouseID: destinationWarehouseID,
+				BinID:       destinationBinID,
+				Quantity:    -v.Quantity,
+				Value:       v.Value,
+				UnitID:      v.UnitID,
+				Type:        models.MovementTypeTransfer,
+				ReferenceID: v.ID,
+				Description: description,
+			}
+			if sourceWarehouseID == destinationWarehouseID {
+				if err := tx.Create(&in).Error; err != nil {
+					return err
+				}
+			} else {
+				in.TotalCost = -v.TotalCost
+				if err := txService.RecordMovement(&in); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&models.StockMovementModel{}).Where("id = ?", v.ID).Update("reference_id", in.ID).Error; err != nil {
+				return err
+			}
+			if first == nil {
+				first = &in
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return first, nil
+}
+
+// binMove records an outgoing movement between bins of one warehouse without a
+// cost, split per lot first expired, first out for lot tracked products.
+func (s *StockMovementService) binMove(movement *models.StockMovementModel) ([]models.StockMovementModel, error) {
+	var product models.ProductModel
+	if err := s.db.Select("id", "tracking_type").Where("id = ?", movement.ProductID).First(&product).Error; err != nil {
+		return nil, err
+	}
+	issue := -movement.Quantity * movement.Value
+	movements := []models.StockMovementModel{}
+	if product.TrackingType == models.TRACKING_LOT || product.TrackingType == models.TRACKING_SERIAL {
+		lots, err := s.AvailableLots(movement.ProductID, movement.VariantID, movement.WarehouseID)
+		if movement.BinID != nil {
+			lots, err = s.binLots(movement)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range lots {
+			if issue <= quantityEpsilon {
+				break
+			}
+			take := math.Min(issue, v.Quantity)
+			line := s.splitMovement(movement, v.LotID, -take)
+			if err := s.db.Create(&line).Error; err != nil {
+				return nil, err
+			}
+			movements = append(movements, line)
+			issue -= take
+		}
+	}
+	if issue > quantityEpsilon {
+		line := s.splitMovement(movement, "", -issue)
+		if err := s.db.Create(&line).Error; err != nil {
+			return nil, err
+		}
+		movements = append(movements, line)
+	}
+	return movements, nil
+}
+
+// binLots returns the lots of the product of a movement with stock in the bin of
+// the movement, first expired, first out.
+func (s *StockMovementService) binLots(movement *models.StockMovementModel) ([]models.LotStock, error) {
+	stock := []models.BinStock{}
+	stmt := s.binStockQuery().
+		Where("stock_movements.bin_id = ? AND stock_movements.product_id = ? AND stock_movements.lot_id IS NOT NULL", *movement.BinID, movement.ProductID)
+	if movement.VariantID != nil {
+		stmt = stmt.Where("stock_movements.variant_id = ?", *movement.VariantID)
+	} else {
+		stmt = stmt.Where("stock_movements.variant_id IS NULL")
+	}
+	err := s.groupBinStock(stmt).Order("stock_lots.expiry_date ASC NULLS LAST").Scan(&stock).Error
+	if err != nil {
+		return nil, err
+	}
+	lots := []models.LotStock{}
+	for _, v := range stock {
+		lots = append(lots, models.LotStock{
+			LotID:       *v.LotID,
+			LotNumber:   v.LotNumber,
+			ProductID:   v.ProductID,
+			ProductName: v.ProductName,
+			VariantID:   v.VariantID,
+			WarehouseID: movement.WarehouseID,
+			ExpiryDate:  v.ExpiryDate,
+			Quantity:    v.Quantity,
+		})
+	}
+	return lots, nil
+}
+
+// checkBin checks that a bin, when given, belongs to a warehouse.
+func (s *StockMovementService) checkBin(binID *string, warehouseID string) error {
+	if binID == nil {
+		return nil
+	}
+	var bin models.WarehouseBinModel
+	if err := s.db.Select("id", "warehouse_id").Where("id = ?", *binID).First(&bin).Error; err != nil {
+		return err
+	}
+	if bin.WarehouseID != warehouseID {
+		return errors.New("bin does not belong to the warehouse")
+	}
+	return nil
+}
+
+// binStockQuery joins the stock movements put away in bins with their bin,
+// product and lot.
+func (s *StockMovementService) binStockQuery() *gorm.DB {
+	return s.db.Model(&models.StockMovementModel{}).
+		Select("stock_movements.bin_id, warehouse_bins.code AS bin_code, warehouse_bins.name AS bin_name, warehouse_bins.route_sequence, stock_movements.product_id, products.name AS product_name, stock_movements.variant_id, stock_movements.lot_id, stock_lots.lot_number, stock_lots.expiry_date, SUM(stock_movements.quantity * stock_movements.value) AS quantity").
+		Joins("JOIN warehouse_bins ON warehouse_bins.id = stock_movements.bin_id").
+		Joins("JOIN products ON products.id = stock_movements.product_id").
+		Joins("LEFT JOIN stock_lots ON stock_lots.id = stock_movements.lot_id")
+}
+
+// groupBinStock groups a binStockQuery per bin, product and lot and keeps the rows
+// with stock.
+func (s *StockMovementService) groupBinStock(stmt *gorm.DB) *gorm.DB {
+	return stmt.
+		Group("stock_movements.bin_id, warehouse_bins.code, warehouse_bins.name, warehouse_bins.route_sequence, stock_movements.product_id, products.name, stock_movements.variant_id, stock_movements.lot_id, stock_lots.lot_number, stock_lots.expiry_date").
+		Having("SUM(stock_movements.quantity * stock_movements.value) > ?", quantityEpsilon)
+}
+
+func equalBin(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,176 @@
+package stockmovement
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+)
+
+// AddMovements records a stock movement like AddMovement and returns the
+// movements it was recorded as.
+//
+// A movement of a bundle product is recorded as one movement per component, see
+// RecordMovements; the movement of any other product is recorded as it is.
+func (s *StockMovementService) AddMovements(date time.Time, productID, warehouseID string, variantID, merchantID *string, distributorID, companyID *string, quantity float64, movementType models.MovementType, referenceID, description string) ([]models.StockMovementModel, error) {
+	movement := models.StockMovementModel{
+		Date:          date,
+		ProductID:     productID,
+		VariantID:     variantID,
+		WarehouseID:   warehouseID,
+		Quantity:      quantity,
+		Type:          movementType,
+		MerchantID:    merchantID,
+		DistributorID: distributorID,
+		CompanyID:     companyID,
+		ReferenceID:   referenceID,
+		Description:   description,
+	}
+	return s.RecordMovements(&movement)
+}
+
+// RecordMovements records a stock movement like RecordMovement and returns the
+// movements it was recorded as. A movement of a bundle product is recorded as one
+// movement per component, see recordBundle, so returned bundles come back into
+// the stock of their components.
+func (s *StockMovementService) RecordMovements(movement *models.StockMovementModel) ([]models.StockMovementModel, error) {
+	isBundle, components, err := s.bundleComponents(movement.ProductID, movement.VariantID)
+	if err != nil {
+		return nil, err
+	}
+	if isBundle {
+		return s.recordBundle(movement, components)
+	}
+	if err := s.RecordMovement(movement); err != nil {
+		return nil, err
+	}
+	return []models.StockMovementModel{*movement}, nil
+}
+
+// GetBundleStock returns how many base units of a bundle product, or of one of its
+// variants when variantID is not nil, can be made from the stock of its
+// components in a warehouse.
+func (s *StockMovementService) GetBundleStock(productID string, variantID *string, warehouseID string) (float64, error) {
+	_, components, err := s.bundleComponents(productID, variantID)
+	if err != nil {
+		return 0, err
+	}
+	return s.bundleStock(components, warehouseID)
+}
+
+// bundleStock returns the smallest number of bundles the stock of any component
+// in a warehouse is enough for.
+func (s *StockMovementService) bundleStock(components []models.BundleComponentModel, warehouseID string) (float64, error) {
+	if len(components) == 0 {
+		return 0, nil
+	}
+	available := math.MaxFloat64
+	for _, component := range components {
+		stock, _, err := s.onHand(&models.StockMovementModel{ProductID: component.ComponentID, VariantID: component.ComponentVariantID, WarehouseID: warehouseID})
+		if err != nil {
+			return 0, err
+		}
+		available = min(available, models.BundlesFor(stock, component.Quantity))
+	}
+	return available, nil
+}
+
+// bundleComponents reports whether a product is a bundle and returns the
+// components of the bundle or its variant.
+func (s *StockMovementService) bundleComponents(productID string, variantID *string) (bool, []models.BundleComponentModel, error) {
+	var product models.ProductModel
+	if err := s.db.Select("id", "is_bundle").Where("id = ?", productID).Find(&product).Error; err != nil {
+		return false, nil, err
+	}
+	if !product.IsBundle {
+		return false, nil, nil
+	}
+	components, err := models.GetBundleComponents(s.db, productID, variantID)
+	return true, components, err
+}
+
+// recordBundle records a movement of a bundle product as one movement per
+// component, with the base quantity of the bundle times the quantity of the
+// component. The movements are recorded in the base unit of the components and
+// refer back to the bundle; their cost is that of the components, so the cost of
+// the bundle is the sum of the costs of the movements returned.
+//
+// Outgoing components that are lot or serial tracked are picked first expired,
+// first out. Incoming components, e.g. of a returned bundle, come in at their
+// current cost; when the movement has a cost of its own, that cost is split over
+// the components in proportion to their current cost, or to their quantity when
+// none of them has a cost yet.
+func (s *StockMovementService) recordBundle(movement *models.StockMovementModel, components []models.BundleComponentModel) ([]models.StockMovementModel, error) {
+	if len(components) == 0 {
+		return nil, fmt.Errorf("bundle %s has no components", movement.ProductID)
+	}
+	if movement.Value == 0 {
+		movement.Value = 1
+	}
+	quantity := movement.Quantity * movement.Value
+	costs, err := s.bundleCosts(movement, components, quantity)
+	if err != nil {
+		return nil, err
+	}
+	bundleID := movement.ProductID
+	movements := []models.StockMovementModel{}
+	for i, component := range components {
+		line := *movement
+		line.ID = ""
+		line.ProductID = component.ComponentID
+		line.Product = models.ProductModel{}
+		line.VariantID = component.ComponentVariantID
+		line.Variant = nil
+		line.LotID = nil
+		line.Lot = nil
+		line.UnitID = nil
+		line.Unit = nil
+		line.Value = 1
+		line.Quantity = quantity * component.Quantity
+		line.UnitCost = 0
+		line.TotalCost = costs[i].Float64()
+		line.BundleID = &bundleID
+		recorded, err := s.RecordTrackedMovement(&line, models.LotTracking{})
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, recorded...)
+	}
+	return movements, nil
+}
+
+// bundleCosts splits the cost of an incoming bundle movement over its components.
+// It returns zero costs for outgoing movements and movements without a cost,
+// whose components are valued by RecordMovement.
+func (s *StockMovementService) bundleCosts(movement *models.StockMovementModel, components []models.BundleComponentModel, quantity float64) ([]money.Amount, error) {
+	costs := make([]money.Amount, len(components))
+	if quantity <= quantityEpsilon {
+		return costs, nil
+	}
+	total := money.FromFloat(movement.TotalCost)
+	if total.IsZero() {
+		total = money.FromFloat(movement.UnitCost).Mul(quantity)
+	}
+	if total.IsZero() {
+		return costs, nil
+	}
+	weights := make([]money.Amount, len(components))
+	byQuantity := make([]money.Amount, len(components))
+	var totalWeight money.Amount
+	for i, component := range components {
+		unitCost, err := s.currentUnitCost(&models.StockMovementModel{ProductID: component.ComponentID, VariantID: component.ComponentVariantID, WarehouseID: movement.WarehouseID})
+		if err != nil {
+			return nil, err
+		}
+		weights[i] = money.FromFloat(unitCost).Mul(component.Quantity)
+		byQuantity[i] = money.FromFloat(component.Quantity)
+		totalWeight = totalWeight.Add(weights[i])
+	}
+	if totalWeight.IsZero() {
+		weights = byQuantity
+	}
+	rounding := models.GetCompanyRounding(s.db, s.costCompanyID(movement))
+	return total.Allocate(weights, rounding.Precision), nil
+}
@@ -0,0 +1,536 @@
+package stockmovement
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quantityEpsilon absorbs the float error of base quantities when layers are
+// compared and consumed.
+const quantityEpsilon = 1e-9
+
+// RecordMovement creates a stock movement and values it with the costing method
+// of its company (models.GetCompanyCostingMethod).
+//
+// Quantities are valued in the base unit of the product, Quantity * Value. An
+// incoming movement is valued at its TotalCost, or at UnitCost per base unit when
+// no total is given; without either it comes in at the current cost of the product
+// in the warehouse, or at the last known cost of the product. Under FIFO it opens a
+// cost layer. An outgoing movement is valued at the average cost of the warehouse,
+// or at the cost of the oldest layers under FIFO; any quantity issued beyond the
+// stock on hand is valued at the current cost. UnitCost and TotalCost of the movement
+// are set to the result, TotalCost being negative for outgoing movements.
+//
+// Bundle products hold no stock of their own and are refused; their movements are
+// recorded per component by RecordTrackedMovement and AddMovements.
+//
+// The movement, its cost layer and the layers it consumes are written in one
+// transaction, a savepoint when the service already runs in one, which also
+// holds the lock on the consumed layers.
+func (s *StockMovementService) RecordMovement(movement *models.StockMovementModel) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		txService := &StockMovementService{db: tx, ctx: s.ctx, isMerchantMode: s.isMerchantMode}
+		return txService.recordMovement(movement)
+	})
+}
+
+func (s *StockMovementService) recordMovement(movement *models.StockMovementModel) error {
+	isBundle, _, err := s.bundleComponents(movement.ProductID, movement.VariantID)
+	if err != nil {
+		return err
+	}
+	if isBundle {
+		return fmt.Errorf("product %s is a bundle, record its components with RecordTrackedMovement or AddMovements", movement.ProductID)
+	}
+	if movement.ID == "" {
+		movement.ID = utils.Uuid()
+	}
+	if movement.Value == 0 {
+		movement.Value = 1
+	}
+	companyID := s.costCompanyID(movement)
+	method := models.GetCompanyCostingMethod(s.db, companyID)
+	rounding := models.GetCompanyRounding(s.db, companyID)
+	quantity := movement.Quantity * movement.Value
+
+	var layer *models.StockCostLayerModel
+	var consumed []models.StockCostLayerModel
+	var consumptions []models.StockCostConsumptionModel
+	switch {
+	case quantity > quantityEpsilon:
+		total := money.FromFloat(movement.TotalCost)
+		if total.IsZero() {
+			unitCost := movement.UnitCost
+			if unitCost == 0 {
+				current, err := s.currentUnitCost(movement)
+				if err != nil {
+					return err
+				}
+				unitCost = current
+			}
+			total = rounding.Document(money.FromFloat(unitCost).Mul(quantity))
+		}
+		movement.TotalCost = total.Float64()
+		movement.UnitCost = total.Div(quantity).Float64()
+		if method == models.COSTING_FIFO {
+			layer = &models.StockCostLayerModel{
+				CompanyID:         companyID,
+				ProductID:         movement.ProductID,
+				VariantID:         movement.VariantID,
+				WarehouseID:       movement.WarehouseID,
+				MovementID:        movement.ID,
+				Date:              movement.Date,
+				Quantity:          quantity,
+				UnitCost:          movement.UnitCost,
+				RemainingQuantity: quantity,
+				RemainingCost:     movement.TotalCost,
+			}
+		}
+	case quantity < -quantityEpsilon:
+		issue := -quantity
+		var cost money.Amount
+		if method == models.COSTING_FIFO {
+			layers := []models.StockCostLayerModel{}
+			err := s.productScope(s.db.Clauses(clause.Locking{Strength: "UPDATE"}), movement).
+				Where("remaining_quantity > ?", quantityEpsilon).
+				Order("date, created_at").
+				Find(&layers).Error
+			if err != nil {
+				return err
+			}
+			for _, v := range layers {
+				if issue <= quantityEpsilon {
+					break
+				}
+				take := math.Min(issue, v.RemainingQuantity)
+				part := money.FromFloat(v.RemainingCost)
+				if v.RemainingQuantity-take > quantityEpsilon {
+					part = rounding.Document(part.Mul(take).Div(v.RemainingQuantity))
+				}
+				v.RemainingQuantity = utils.AmountRound(v.RemainingQuantity-take, 6)
+				v.RemainingCost = money.FromFloat(v.RemainingCost).Sub(part).Float64()
+				consumed = append(consumed, v)
+				consumptions = append(consumptions, models.StockCostConsumptionModel{
+					LayerID:    v.ID,
+					MovementID: movement.ID,
+					Quantity:   take,
+					Cost:       part.Float64(),
+				})
+				cost = cost.Add(part)
+				issue -= take
+			}
+		} else {
+			onHand, value, err := s.onHand(movement)
+			if err != nil {
+				return err
+			}
+			if onHand > quantityEpsilon {
+				take := math.Min(issue, onHand)
+				part := money.FromFloat(value)
+				if onHand-take > quantityEpsilon {
+					part = rounding.Document(part.Mul(take).Div(onHand))
+				}
+				cost = cost.Add(part)
+				issue -= take
+			}
+		}
+		if issue > quantityEpsilon {
+			unitCost, err := s.currentUnitCost(movement)
+			if err != nil {
+				return err
+			}
+			cost = cost.Add(rounding.Document(money.FromFloat(unitCost).Mul(issue)))
+		}
+		movement.TotalCost = cost.Neg().Float64()
+		movement.UnitCost = cost.Div(-quantity).Float64()
+	}
+
+	if err := s.db.Create(movement).Error; err != nil {
+		return err
+	}
+	if layer != nil {
+		if err := s.db.Create(layer).Error; err != nil {
+			return err
+		}
+	}
+	for _, v := range consumed {
+		err := s.db.Model(&models.StockCostLayerModel{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+			"remaining_quantity": v.RemainingQuantity,
+			"remaining_cost":     v.RemainingCost,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(consumptions) > 0 {
+		if err := s.db.Create(&consumptions).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IssueFromMovements records an outgoing movement valued at the cost of given
+// incoming movements of its warehouse rather than at the cost of the warehouse as
+// a whole. It is meant for stock kept apart within a warehouse, such as the goods
+// of one transfer in the in-transit warehouse.
+//
+// Under FIFO the layers opened by the source movements are consumed, oldest
+// first; any quantity beyond them, and any quantity under the moving average
+// method, is valued at the UnitCost of the movement, which the caller sets to the
+// cost per base unit of the source movements. Like RecordMovement, it writes in
+// one transaction.
+func (s *StockMovementService) IssueFromMovements(movement *models.StockMovementModel, sourceIDs []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		txService := &StockMovementService{db: tx, ctx: s.ctx, isMerchantMode: s.isMerchantMode}
+		return txService.issueFromMovements(movement, sourceIDs)
+	})
+}
+
+func (s *StockMovementService) issueFromMovements(movement *models.StockMovementModel, sourceIDs []string) error {
+	if movement.ID == "" {
+		movement.ID = utils.Uuid()
+	}
+	if movement.Value == 0 {
+		movement.Value = 1
+	}
+	quantity := movement.Quantity * movement.Value
+	if quantity >= 0 {
+		return errors.New("movement must be outgoing")
+	}
+	companyID := s.costCompanyID(movement)
+	method := models.GetCompanyCostingMethod(s.db, companyID)
+	rounding := models.GetCompanyRounding(s.db, companyID)
+
+	issue := -quantity
+	var cost money.Amount
+	var consumed []models.StockCostLayerModel
+	var consumptions []models.StockCostConsumptionModel
+	if method == models.COSTING_FIFO && len(sourceIDs) > 0 {
+		layers := []models.StockCostLayerModel{}
+		err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("movement_id IN ? AND remaining_quantity > ?", sourceIDs, quantityEpsilon).
+			Order("date, created_at").
+			Find(&layers).Error
+		if err != nil {
+			return err
+		}
+		for _, v := range layers {
+			if issue <= quantityEpsilon {
+				break
+			}
+			take := math.Min(issue, v.RemainingQuantity)
+			part := money.FromFloat(v.RemainingCost)
+			if v.RemainingQuantity-take > quantityEpsilon {
+				part = rounding.Document(part.Mul(take).Div(v.RemainingQuantity))
+			}
+			v.RemainingQuantity = utils.AmountRound(v.RemainingQuantity-take, 6)
+			v.RemainingCost = money.FromFloat(v.RemainingCost).Sub(part).Float64()
+			consumed = append(consumed, v)
+			consumptions = append(consumptions, models.StockCostConsumptionModel{
+				LayerID:    v.ID,
+				MovementID: movement.ID,
+				Quantity:   take,
+				Cost:       part.Float64(),
+			})
+			cost = cost.Add(part)
+			issue -= take
+		}
+	}
+	if issue > quantityEpsilon {
+		cost = cost.Add(rounding.Document(money.FromFloat(movement.UnitCost).Mul(issue)))
+	}
+	movement.TotalCost = cost.Neg().Float64()
+	movement.UnitCost = cost.Div(-quantity).Float64()
+
+	if err := s.db.Create(movement).Error; err != nil {
+		return err
+	}
+	for _, v := range consumed {
+		err := s.db.Model(&models.StockCostLayerModel{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+			"remaining_quantity": v.RemainingQuantity,
+			"remaining_cost":     v.RemainingCost,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(consumptions) > 0 {
+		if err := s.db.Create(&consumptions).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevalueReceipt adds a cost allocated to the stock that came in with an incoming
+// movement, such as its share of freight or import duty, and returns the part of
+// the cost added to the stock still on hand. The rest belongs to the goods of the
+// receipt already issued.
+//
+// Under FIFO the part is that of the quantity left in the layer the receipt
+// opened, and the layer is revalued so the goods are issued at the new cost; a
+// receipt without a layer, e.g. one recorded before the company switched to
+// FIFO, cannot be revalued.
+// Under the moving average method it is that of the received quantity still on
+// hand in the warehouse. The part is recorded as the adjustment movement, for the
+// product, warehouse and lot of the receipt, with no quantity and the part as its
+// TotalCost.
+func (s *StockMovementService) RevalueReceipt(sourceID string, amount float64, adjustment *models.StockMovementModel) (float64, error) {
+	var source models.StockMovementModel
+	if err := s.db.Where("id = ?", sourceID).First(&source).Error; err != nil {
+		return 0, err
+	}
+	if source.Value == 0 {
+		source.Value = 1
+	}
+	received := source.Quantity * source.Value
+	if received <= quantityEpsilon {
+		return 0, errors.New("movement is not a receipt")
+	}
+	companyID := s.costCompanyID(&source)
+	method := models.GetCompanyCostingMethod(s.db, companyID)
+	rounding := models.GetCompanyRounding(s.db, companyID)
+	total := money.FromFloat(amount)
+
+	var part money.Amount
+	if method == models.COSTING_FIFO {
+		var layer models.StockCostLayerModel
+		err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("movement_id = ?", sourceID).Find(&layer).Error
+		if err != nil {
+			return 0, err
+		}
+		if layer.ID == "" || layer.Quantity <= quantityEpsilon {
+			return 0, errors.New("receipt has no cost layer to revalue")
+		}
+		part = total
+		if layer.RemainingQuantity < layer.Quantity-quantityEpsilon {
+			part = rounding.Document(total.Mul(layer.RemainingQuantity).Div(layer.Quantity))
+		}
+		err = s.db.Model(&models.StockCostLayerModel{}).Where("id = ?", layer.ID).Updates(map[string]interface{}{
+			"unit_cost":      money.FromFloat(layer.UnitCost).Add(total.Div(layer.Quantity)).Float64(),
+			"remaining_cost": money.FromFloat(layer.RemainingCost).Add(part).Float64(),
+		}).Error
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		onHand, _, err := s.onHand(&source)
+		if err != nil {
+			return 0, err
+		}
+		remaining := math.Min(received, math.Max(onHand, 0))
+		part = total
+		if remaining < received-quantityEpsilon {
+			part = rounding.Document(total.Mul(remaining).Div(received))
+		}
+	}
+	if part.IsZero() {
+		return 0, nil
+	}
+
+	adjustment.ID = utils.Uuid()
+	adjustment.ProductID = source.ProductID
+	adjustment.VariantID = source.VariantID
+	adjustment.WarehouseID = source.WarehouseID
+	adjustment.LotID = source.LotID
+	adjustment.CompanyID = source.CompanyID
+	adjustment.Quantity = 0
+	adjustment.Value = 1
+	adjustment.UnitCost = 0
+	adjustment.TotalCost = part.Float64()
+	if err := s.db.Create(adjustment).Error; err != nil {
+		return 0, err
+	}
+	return part.Float64(), nil
+}
+
+// ReverseCosts undoes the cost layers of stock movements that are being deleted:
+// the layers opened by the movements are removed and the layer quantities issued by
+// them are put back. Call it with the IDs of the movements before deleting them.
+//
+// A receipt whose layer was partly issued by movements that are not deleted with
+// it can not be reversed, as the cost of those issues would be left without a
+// layer; the dependent issues must be reversed first.
+func ReverseCosts(db *gorm.DB, movementIDs []string) error {
+	if len(movementIDs) == 0 {
+		return nil
+	}
+	consumptions := []models.StockCostConsumptionModel{}
+	if err := db.Where("movement_id IN ?", movementIDs).Find(&consumptions).Error; err != nil {
+		return err
+	}
+	for _, v := range consumptions {
+		err := db.Model(&models.StockCostLayerModel{}).Where("id = ?", v.LayerID).Updates(map[string]interface{}{
+			"remaining_quantity": gorm.Expr("remaining_quantity + ?", v.Quantity),
+			"remaining_cost":     gorm.Expr("remaining_cost + ?", v.Cost),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.Where("movement_id IN ?", movementIDs).Delete(&models.StockCostConsumptionModel{}).Error; err != nil {
+		return err
+	}
+	layers := []models.StockCostLayerModel{}
+	if err := db.Where("movement_id IN ?", movementIDs).Find(&layers).Error; err != nil {
+		return err
+	}
+	for _, v := range layers {
+		if v.RemainingQuantity < v.Quantity-quantityEpsilon {
+			return errors.New("stock received by the movement has already been issued, reverse the later issues first")
+		}
+	}
+	return db.Where("movement_id IN ?", movementIDs).Delete(&models.StockCostLayerModel{}).Error
+}
+
+// GetStockValuation returns the quantity and value of every product in the
+// warehouses of a company as of a date, optionally for one warehouse. The value is
+// the sum of the cost of the stock movements up to the date, so it is the value of
+// the remaining FIFO layers or the moving average value at that time.
+func (s *StockMovementService) GetStockValuation(companyID string, date time.Time, warehouseID *string) ([]models.StockValuation, error) {
+	valuations := []models.StockValuation{}
+	stmt := s.db.Model(&models.StockMovementModel{}).
+		Select("stock_movements.warehouse_id, warehouses.name AS warehouse_name, stock_movements.product_id, products.name AS product_name, stock_movements.variant_id, SUM(stock_movements.quantity * stock_movements.value) AS quantity, SUM(stock_movements.total_cost) AS value").
+		Joins("JOIN warehouses ON warehouses.id = stock_movements.warehouse_id").
+		Joins("JOIN products ON products.id = stock_movements.product_id").
+		Where("warehouses.company_id = ? AND stock_movements.date <= ?", companyID, date)
+	if warehouseID != nil {
+		stmt = stmt.Where("stock_movements.warehouse_id = ?", *warehouseID)
+	}
+	err := stmt.Group("stock_movements.warehouse_id, warehouses.name, stock_movements.product_id, products.name, stock_movements.variant_id").
+		Having("SUM(stock_movements.quantity * stock_movements.value) <> 0 OR SUM(stock_movements.total_cost) <> 0").
+		Order("warehouses.name, products.name").
+		Scan(&valuations).Error
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range valuations {
+		valuations[i].Value = utils.AmountRound(v.Value, 2)
+		if v.Quantity != 0 {
+			valuations[i].UnitCost = money.FromFloat(v.Value).Div(v.Quantity).Float64()
+		}
+	}
+	return valuations, nil
+}
+
+// ReferenceUnitCost returns the average cost per base unit a product moved at in
+// the movements of a document, such as the cost it was sold at by a sales invoice.
+// It returns zero when the document did not move the product.
+//
+// A bundle moves as its components, so the cost of a bundle is the sum of the
+// costs its components moved at for the bundle in the document, times their
+// quantity per bundle.
+func (s *StockMovementService) ReferenceUnitCost(referenceID, productID string, variantID *string) (float64, error) {
+	isBundle, components, err := s.bundleComponents(productID, variantID)
+	if err != nil {
+		return 0, err
+	}
+	if !isBundle {
+		return s.referenceUnitCost(referenceID, productID, variantID, nil)
+	}
+	var total money.Amount
+	for _, component := range components {
+		unitCost, err := s.referenceUnitCost(referenceID, component.ComponentID, component.ComponentVariantID, &productID)
+		if err != nil {
+			return 0, err
+		}
+		total = total.Add(money.FromFloat(unitCost).Mul(component.Quantity))
+	}
+	return total.Float64(), nil
+}
+
+// referenceUnitCost returns the average cost per base unit of the movements of a
+// product in a document, either those of the bundle bundleID or, when it is nil,
+// those the product moved on its own.
+func (s *StockMovementService) referenceUnitCost(referenceID, productID string, variantID, bundleID *string) (float64, error) {
+	var result struct {
+		Quantity float64
+		Value    float64
+	}
+	stmt := s.db.Model(&models.StockMovementModel{}).
+		Select("COALESCE(SUM(quantity * value), 0) AS quantity, COALESCE(SUM(total_cost), 0) AS value").
+		Where("reference_id = ? AND product_id = ?", referenceID, productID)
+	if variantID != nil {
+		stmt = stmt.Where("variant_id = ?", *variantID)
+	} else {
+		stmt = stmt.Where("variant_id IS NULL")
+	}
+	if bundleID != nil {
+		stmt = stmt.Where("bundle_id = ?", *bundleID)
+	} else {
+		stmt = stmt.Where("bundle_id IS NULL")
+	}
+	if err := stmt.Scan(&result).Error; err != nil {
+		return 0, err
+	}
+	if result.Quantity == 0 {
+		return 0, nil
+	}
+	return money.FromFloat(result.Value).Div(result.Quantity).Float64(), nil
+}
+
+// onHand returns the base quantity and the value of the product in the warehouse
+// of the movement.
+func (s *StockMovementService) onHand(movement *models.StockMovementModel) (float64, float64, error) {
+	var result struct {
+		Quantity float64
+		Value    float64
+	}
+	err := s.productScope(s.db.Model(&models.StockMovementModel{}), movement).
+		Select("COALESCE(SUM(quantity * value), 0) AS quantity, COALESCE(SUM(total_cost), 0) AS value").
+		Scan(&result).Error
+	return result.Quantity, result.Value, err
+}
+
+// currentUnitCost returns the average cost of the product in the warehouse of the
+// movement, or the last cost it moved at anywhere when the warehouse has none.
+func (s *StockMovementService) currentUnitCost(movement *models.StockMovementModel) (float64, error) {
+	onHand, value, err := s.onHand(movement)
+	if err != nil {
+		return 0, err
+	}
+	if onHand > quantityEpsilon && value > 0 {
+		return money.FromFloat(value).Div(onHand).Float64(), nil
+	}
+	var last models.StockMovementModel
+	stmt := s.db.Where("product_id = ? AND unit_cost > 0", movement.ProductID)
+	if movement.VariantID != nil {
+		stmt = stmt.Where("variant_id = ?", *movement.VariantID)
+	} else {
+		stmt = stmt.Where("variant_id IS NULL")
+	}
+	err = stmt.Order("date DESC, created_at DESC").Limit(1).Find(&last).Error
+	return last.UnitCost, err
+}
+
+// productScope filters a query on stock movements or cost layers to the product,
+// variant and warehouse of the movement.
+func (s *StockMovementService) productScope(db *gorm.DB, movement *models.StockMovementModel) *gorm.DB {
+	db = db.Where("product_id = ? AND warehouse_id = ?", movement.ProductID, movement.WarehouseID)
+	if movement.VariantID != nil {
+		return db.Where("variant_id = ?", *movement.VariantID)
+	}
+	return db.Where("variant_id IS NULL")
+}
+
+// costCompanyID returns the company of the movement, or the company of its
+// warehouse for movements recorded without one.
+func (s *StockMovementService) costCompanyID(movement *models.StockMovementModel) *string {
+	if movement.CompanyID != nil {
+		return movement.CompanyID
+	}
+	var warehouse models.WarehouseModel
+	if err := s.db.Select("id, company_id").Where("id = ?", movement.WarehouseID).First(&warehouse).Error; err != nil {
+		return nil
+	}
+	return warehouse.CompanyID
+}
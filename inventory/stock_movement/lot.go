@@ -0,0 +1,462 @@
+package stockmovement
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"gorm.io/gorm"
+)
+
+// RecordTrackedMovement records a stock movement of a product that may be lot or
+// serial tracked and returns the movements it was recorded as.
+//
+// Products that are not tracked are recorded as they are, with RecordMovement.
+// An incoming movement of a lot tracked product needs a lot number; the lot is
+// created on its first receipt with the manufacture and expiry dates of the line.
+// An incoming movement of a serial tracked product needs one serial number per
+// base unit and is recorded as one movement per serial number, the total cost
+// being spread evenly over them.
+//
+// An outgoing movement takes the lot or the serial numbers of the line, which
+// must be in stock in the warehouse. Without them the stock is picked first
+// expired, first out (see AvailableLots), from the bin of the movement when it has
+// one, and the movement is split per lot; lots that expired before the day of the
+// movement are not picked, they only leave when the line names them. Any
+// quantity beyond the stock of the lots is recorded without a lot.
+//
+// A movement of a bundle product is recorded as one movement per component, see
+// recordBundle; the lot and serial numbers of the line are not used.
+func (s *StockMovementService) RecordTrackedMovement(movement *models.StockMovementModel, tracking models.LotTracking) ([]models.StockMovementModel, error) {
+	var product models.ProductModel
+	if err := s.db.Select("id", "name", "tracking_type", "is_bundle").Where("id = ?", movement.ProductID).First(&product).Error; err != nil {
+		return nil, err
+	}
+	if product.IsBundle {
+		components, err := models.GetBundleComponents(s.db, product.ID, movement.VariantID)
+		if err != nil {
+			return nil, err
+		}
+		return s.recordBundle(movement, components)
+	}
+	if product.TrackingType != models.TRACKING_LOT && product.TrackingType != models.TRACKING_SERIAL {
+		if err := s.RecordMovement(movement); err != nil {
+			return nil, err
+		}
+		return []models.StockMovementModel{*movement}, nil
+	}
+	if movement.Value == 0 {
+		movement.Value = 1
+	}
+	quantity := movement.Quantity * movement.Value
+	companyID := s.costCompanyID(movement)
+
+	if quantity > quantityEpsilon {
+		if product.TrackingType == models.TRACKING_LOT {
+			if tracking.LotNumber == "" {
+				return nil, fmt.Errorf("lot number is required for %s", product.Name)
+			}
+			lot, err := s.resolveLot(companyID, movement, tracking, nil)
+			if err != nil {
+				return nil, err
+			}
+			movement.LotID = &lot.ID
+			if err := s.RecordMovement(movement); err != nil {
+				return nil, err
+			}
+			return []models.StockMovementModel{*movement}, nil
+		}
+		if err := checkSerialCount(product, quantity, tracking.SerialNumbers); err != nil {
+			return nil, err
+		}
+		weights := make([]money.Amount, len(tracking.SerialNumbers))
+		for i := range weights {
+			weights[i] = money.FromFloat(1)
+		}
+		rounding := models.GetCompanyRounding(s.db, companyID)
+		costs := money.FromFloat(movement.TotalCost).Allocate(weights, rounding.Precision)
+		movements := []models.StockMovementModel{}
+		for i, serial := range tracking.SerialNumbers {
+			lot, err := s.resolveLot(companyID, movement, tracking, &serial)
+			if err != nil {
+				return nil, err
+			}
+			inStock, err := s.lotQuantity(lot.ID, nil)
+			if err != nil {
+				return nil, err
+			}
+			if inStock > quantityEpsilon {
+				return nil, fmt.Errorf("serial number %s is already in stock", serial)
+			}
+			line := s.splitMovement(movement, lot.ID, 1)
+			line.TotalCost = costs[i].Float64()
+			if err := s.RecordMovement(&line); err != nil {
+				return nil, err
+			}
+			movements = append(movements, line)
+		}
+		return movements, nil
+	}
+
+	if quantity >= -quantityEpsilon {
+		if err := s.RecordMovement(movement); err != nil {
+			return nil, err
+		}
+		return []models.StockMovementModel{*movement}, nil
+	}
+
+	issue := -quantity
+	switch {
+	case len(tracking.SerialNumbers) > 0:
+		if err := checkSerialCount(product, issue, tracking.SerialNumbers); err != nil {
+			return nil, err
+		}
+		movements := []models.StockMovementModel{}
+		for _, serial := range tracking.SerialNumbers {
+			lot, err := s.findLot(movement, "", &serial)
+			if err != nil {
+				return nil, err
+			}
+			inStock, err := s.lotQuantity(lot.ID, &movement.WarehouseID)
+			if err != nil {
+				return nil, err
+			}
+			if inStock < 1-quantityEpsilon {
+				return nil, fmt.Errorf("serial number %s is not in stock", serial)
+			}
+			line := s.splitMovement(movement, lot.ID, -1)
+			if err := s.RecordMovement(&line); err != nil {
+				return nil, err
+			}
+			movements = append(movements, line)
+		}
+		return movements, nil
+	case tracking.LotNumber != "":
+		lot, err := s.findLot(movement, tracking.LotNumber, nil)
+		if err != nil {
+			return nil, err
+		}
+		inStock, err := s.lotQuantity(lot.ID, &movement.WarehouseID)
+		if err != nil {
+			return nil, err
+		}
+		if inStock < issue-quantityEpsilon {
+			return nil, fmt.Errorf("insufficient stock of lot %s: %v available", lot.LotNumber, inStock)
+		}
+		movement.LotID = &lot.ID
+		if err := s.RecordMovement(movement); err != nil {
+			return nil, err
+		}
+		return []models.StockMovementModel{*movement}, nil
+	}
+
+	var lots []models.LotStock
+	var err error
+	if movement.BinID != nil {
+		lots, err = s.binLots(movement)
+	} else {
+		lots, err = s.AvailableLots(movement.ProductID, movement.VariantID, movement.WarehouseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	movements := []models.StockMovementModel{}
+	for _, v := range unexpiredLots(lots, movement.Date) {
+		if issue <= quantityEpsilon {
+			break
+		}
+		take := math.Min(issue, v.Quantity)
+		line := s.splitMovement(movement, v.LotID, -take)
+		if err := s.RecordMovement(&line); err != nil {
+			return nil, err
+		}
+		movements = append(movements, line)
+		issue -= take
+	}
+	if issue > quantityEpsilon {
+		line := s.splitMovement(movement, "", -issue)
+		if err := s.RecordMovement(&line); err != nil {
+			return nil, err
+		}
+		movements = append(movements, line)
+	}
+	return movements, nil
+}
+
+// AvailableLots returns the lots of a product with stock in a warehouse in first
+// expired, first out order: by expiry date, lots without one last, then by
+// manufacture date and receipt.
+func (s *StockMovementService) AvailableLots(productID string, variantID *string, warehouseID string) ([]models.LotStock, error) {
+	stock := []models.LotStock{}
+	stmt := s.lotStockQuery().
+		Where("stock_movements.product_id = ? AND stock_movements.warehouse_id = ?", productID, warehouseID)
+	if variantID != nil {
+		stmt = stmt.Where("stock_movements.variant_id = ?", *variantID)
+	} else {
+		stmt = stmt.Where("stock_movements.variant_id IS NULL")
+	}
+	err := s.groupLotStock(stmt).
+		Order("stock_lots.expiry_date ASC NULLS LAST, stock_lots.manufacture_date ASC NULLS LAST, stock_lots.created_at").
+		Scan(&stock).Error
+	return stock, err
+}
+
+// unexpiredLots returns the lots that have not expired before the day of date. All
+// lots are returned when date is zero.
+func unexpiredLots(lots []models.LotStock, date time.Time) []models.LotStock {
+	if date.IsZero() {
+		return lots
+	}
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	result := []models.LotStock{}
+	for _, v := range lots {
+		if v.ExpiryDate != nil && v.ExpiryDate.Before(day) {
+			continue
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// GetLotStock returns the stock per lot and warehouse of the lots of a company,
+// optionally for one product or one warehouse.
+func (s *StockMovementService) GetLotStock(companyID string, productID, warehouseID *string) ([]models.LotStock, error) {
+	stock := []models.LotStock{}
+	stmt := s.lotStockQuery().Where("stock_lots.company_id = ?", companyID)
+	if productID != nil {
+		stmt = stmt.Where("stock_movements.product_id = ?", *productID)
+	}
+	if warehouseID != nil {
+		stmt = stmt.Where("stock_movements.warehouse_id = ?", *warehouseID)
+	}
+	err := s.groupLotStock(stmt).
+		Order("products.name, stock_lots.expiry_date ASC NULLS LAST, stock_lots.lot_number").
+		Scan(&stock).Error
+	return stock, err
+}
+
+// GetExpiringStock returns the lots of a company still in stock that expire on or
+// before a date, expired lots included, the first to expire first. It can be
+// limited to one warehouse.
+func (s *StockMovementService) GetExpiringStock(companyID string, before time.Time, warehouseID *string) ([]models.LotStock, error) {
+	stock := []models.LotStock{}
+	stmt := s.lotStockQuery().
+		Where("stock_lots.company_id = ? AND stock_lots.expiry_date <= ?", companyID, before)
+	if warehouseID != nil {
+		stmt = stmt.Where("stock_movements.warehouse_id = ?", *warehouseID)
+	}
+	err := s.groupLotStock(stmt).
+		Order("stock_lots.expiry_date, products.name, warehouses.name").
+		Scan(&stock).Error
+	return stock, err
+}
+
+// TraceLot follows a lot for a recall: its stock per warehouse, the movements
+// that brought it in with the supplier of the purchase, and the movements that
+// took it out with the customer of the sales invoice or POS sale.
+func (s *StockMovementService) TraceLot(lotID string) (*models.LotTrace, error) {
+	trace := models.LotTrace{
+		Stock:      []models.LotStock{},
+		Receipts:   []models.LotTraceMovement{},
+		Deliveries: []models.LotTraceMovement{},
+	}
+	if err := s.db.Preload("Product").Where("id = ?", lotID).First(&trace.Lot).Error; err != nil {
+		return nil, err
+	}
+	err := s.groupLotStock(s.lotStockQuery().Where("stock_movements.lot_id = ?", lotID)).
+		Order("warehouses.name").
+		Scan(&trace.Stock).Error
+	if err != nil {
+		return nil, err
+	}
+
+	movements := []models.StockMovementModel{}
+	if err := s.db.Where("lot_id = ?", lotID).Order("date, created_at").Find(&movements).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range movements {
+		item := models.LotTraceMovement{
+			MovementID:    v.ID,
+			Date:          v.Date,
+			Type:          v.Type,
+			WarehouseID:   v.WarehouseID,
+			Quantity:      v.Quantity * v.Value,
+			ReferenceID:   v.ReferenceID,
+			ReferenceType: v.ReferenceType,
+		}
+		if item.Quantity > 0 {
+			var purchase models.PurchaseOrderModel
+			if v.ReferenceID != "" && s.db.Preload("Contact").Where("id = ?", v.ReferenceID).Limit(1).Find(&purchase).Error == nil && purchase.ID != "" {
+				item.DocumentNumber = purchase.PurchaseNumber
+				item.ContactID = purchase.ContactID
+				if purchase.Contact != nil {
+					item.ContactName = purchase.Contact.Name
+				}
+			}
+			trace.Receipts = append(trace.Receipts, item)
+			continue
+		}
+		var sales models.SalesModel
+		var pos models.POSModel
+		switch {
+		case v.ReferenceID == "":
+		case s.db.Preload("Contact").Where("id = ?", v.ReferenceID).Limit(1).Find(&sales).Error == nil && sales.ID != "":
+			item.DocumentNumber = sales.SalesNumber
+			item.ContactID = sales.ContactID
+			if sales.Contact != nil {
+				item.ContactName = sales.Contact.Name
+			}
+		case s.db.Preload("Contact").Where("id = ?", v.ReferenceID).Limit(1).Find(&pos).Error == nil && pos.ID != "":
+			item.DocumentNumber = pos.SalesNumber
+			item.ContactID = pos.ContactID
+			if pos.Contact != nil {
+				item.ContactName = pos.Contact.Name
+			}
+		}
+		trace.Deliveries = append(trace.Deliveries, item)
+	}
+	return &trace, nil
+}
+
+// GetLotQuantity returns the base quantity of a lot, in one warehouse or in all
+// of them when warehouseID is nil.
+func (s *StockMovementService) GetLotQuantity(lotID string, warehouseID *string) (float64, error) {
+	return s.lotQuantity(lotID, warehouseID)
+}
+
+// FindLot returns the lot of a product with a lot number.
+func (s *StockMovementService) FindLot(productID string, variantID *string, lotNumber string) (*models.StockLotModel, error) {
+	return s.findLot(&models.StockMovementModel{ProductID: productID, VariantID: variantID}, lotNumber, nil)
+}
+
+// lotStockQuery joins the stock movements of lots with their lot, product and
+// warehouse.
+func (s *StockMovementService) lotStockQuery() *gorm.DB {
+	return s.db.Model(&models.StockMovementModel{}).
+		Select("stock_movements.lot_id, stock_lots.lot_number, stock_lots.serial_number, stock_movements.product_id, products.name AS product_name, stock_movements.variant_id, stock_movements.warehouse_id, warehouses.name AS warehouse_name, stock_lots.manufacture_date, stock_lots.expiry_date, SUM(stock_movements.quantity * stock_movements.value) AS quantity").
+		Joins("JOIN stock_lots ON stock_lots.id = stock_movements.lot_id").
+		Joins("JOIN products ON products.id = stock_movements.product_id").
+		Joins("JOIN warehouses ON warehouses.id = stock_movements.warehouse_id")
+}
+
+// groupLotStock groups a lotStockQuery per lot and warehouse and keeps the lots
+// with stock.
+func (s *StockMovementService) groupLotStock(stmt *gorm.DB) *gorm.DB {
+	return stmt.
+		Group("stock_movements.lot_id, stock_lots.lot_number, stock_lots.serial_number, stock_movements.product_id, products.name, stock_movements.variant_id, stock_movements.warehouse_id, warehouses.name, stock_lots.manufacture_date, stock_lots.expiry_date, stock_lots.created_at").
+		Having("SUM(stock_movements.quantity * stock_movements.value) > ?", quantityEpsilon)
+}
+
+// resolveLot returns the lot of the product of the movement with the lot number of
+// the line, or the serial number when given, creating it on its first receipt.
+// Dates missing on an existing lot are filled in from the line.
+func (s *StockMovementService) resolveLot(companyID *string, movement *models.StockMovementModel, tracking models.LotTracking, serial *string) (*models.StockLotModel, error) {
+	lot, err := s.findLot(movement, tracking.LotNumber, serial)
+	if err == nil {
+		updates := map[string]interface{}{}
+		if lot.ManufactureDate == nil && tracking.ManufactureDate != nil {
+			updates["manufacture_date"] = tracking.ManufactureDate
+		}
+		if lot.ExpiryDate == nil && tracking.ExpiryDate != nil {
+			updates["expiry_date"] = tracking.ExpiryDate
+		}
+		if len(updates) > 0 {
+			if err := s.db.Model(lot).Updates(updates).Error; err != nil {
+				return nil, err
+			}
+		}
+		return lot, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	lot = &models.StockLotModel{
+		CompanyID:       companyID,
+		ProductID:       movement.ProductID,
+		VariantID:       movement.VariantID,
+		LotNumber:       tracking.LotNumber,
+		SerialNumber:    serial,
+		ManufactureDate: tracking.ManufactureDate,
+		ExpiryDate:      tracking.ExpiryDate,
+	}
+	lot.ID = utils.Uuid()
+	if err := s.db.Create(lot).Error; err != nil {
+		return nil, err
+	}
+	return lot, nil
+}
+
+// findLot returns the lot of the product of the movement with a serial number, or
+// with a lot number when serial is nil.
+func (s *StockMovementService) findLot(movement *models.StockMovementModel, lotNumber string, serial *string) (*models.StockLotModel, error) {
+	var lot models.StockLotModel
+	stmt := s.db.Where("product_id = ?", movement.ProductID)
+	if movement.VariantID != nil {
+		stmt = stmt.Where("variant_id = ?", *movement.VariantID)
+	} else {
+		stmt = stmt.Where("variant_id IS NULL")
+	}
+	if serial != nil {
+		stmt = stmt.Where("serial_number = ?", *serial)
+	} else {
+		stmt = stmt.Where("lot_number = ? AND serial_number IS NULL", lotNumber)
+	}
+	if err := stmt.First(&lot).Error; err != nil {
+		return nil, err
+	}
+	return &lot, nil
+}
+
+// lotQuantity returns the base quantity of a lot, in one warehouse or in all of
+// them.
+func (s *StockMovementService) lotQuantity(lotID string, warehouseID *string) (float64, error) {
+	var quantity float64
+	stmt := s.db.Model(&models.StockMovementModel{}).
+		Select("COALESCE(SUM(quantity * value), 0)").
+		Where("lot_id = ?", lotID)
+	if warehouseID != nil {
+		stmt = stmt.Where("warehouse_id = ?", *warehouseID)
+	}
+	err := stmt.Scan(&quantity).Error
+	return quantity, err
+}
+
+// splitMovement copies a movement into a new one for a lot, or for no lot when
+// lotID is empty, with a base quantity. The copy keeps the unit of the movement
+// when the quantity converts back into it exactly, and is recorded in the base
+// unit otherwise.
+func (s *StockMovementService) splitMovement(movement *models.StockMovementModel, lotID string, quantity float64) models.StockMovementModel {
+	line := *movement
+	line.ID = ""
+	line.LotID = nil
+	line.UnitCost = 0
+	line.TotalCost = 0
+	if lotID != "" {
+		line.LotID = &lotID
+	}
+	inUnit := quantity / movement.Value
+	switch {
+	case math.Abs(quantity-movement.Quantity*movement.Value) < quantityEpsilon:
+		line.Quantity = movement.Quantity
+	case math.Abs(inUnit-math.Round(inUnit)) < quantityEpsilon:
+		line.Quantity = math.Round(inUnit)
+	default:
+		line.Quantity = quantity
+		line.Value = 1
+		line.UnitID = nil
+	}
+	return line
+}
+
+// checkSerialCount checks that a serial tracked line names one serial number per
+// base unit.
+func checkSerialCount(product models.ProductModel, quantity float64, serials []string) error {
+	if math.Abs(quantity-float64(len(serials))) > quantityEpsilon {
+		return fmt.Errorf("%s needs %v serial numbers, got %d", product.Name, quantity, len(serials))
+	}
+	return nil
+}
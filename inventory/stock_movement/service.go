@@ -25,12 +25,13 @@ func NewStockMovementService(db *gorm.DB, ctx *context.ERPContext) *StockMovemen
 
 // Migrate migrates the database schema needed for the StockMovementService.
 //
-// It uses GORM's AutoMigrate function to create the tables for StockMovementModel
-// if they do not already exist.
+// It uses GORM's AutoMigrate function to create the tables for StockMovementModel,
+// StockCostLayerModel, StockCostConsumptionModel and StockLotModel if they do not
+// already exist.
 //
 // If the migration fails, the error is returned to the caller.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.StockMovementModel{})
+	return db.AutoMigrate(&models.StockMovementModel{}, &models.StockCostLayerModel{}, &models.StockCostConsumptionModel{}, &models.StockLotModel{})
 }
 func (s *StockMovementService) SetDB(db *gorm.DB) {
 	s.db = db
@@ -66,7 +67,7 @@ func (s *StockMovementService) SetMerchantMode(isMerchantMode bool) {
 // the stock movement description and product name fields. If the request contains
 // a company ID header and merchant mode is not enabled, the method filters the
 // results by the company ID. Additional filters can be applied based on distributor,
-// product, warehouse, and merchant IDs from the request parameters. When in merchant
+// product, warehouse, merchant and lot IDs from the request parameters. When in merchant
 // mode, it filters results by merchant ID from the request header.
 //
 // The function utilizes pagination to manage the result set and applies any
@@ -83,7 +84,7 @@ func (s *StockMovementService) GetStockMovements(request http.Request, search st
 		return db.Select("id", "name", "display_name")
 	}).Preload("Warehouse", func(db *gorm.DB) *gorm.DB {
 		return db.Select("id", "name")
-	}).Joins("LEFT JOIN products ON stock_movements.product_id = products.id")
+	}).Preload("Lot").Joins("LEFT JOIN products ON stock_movements.product_id = products.id")
 
 	if search != "" {
 		stmt = stmt.Where("stock_movements.description ILIKE ? OR products.name ILIKE ?",
@@ -111,6 +112,9 @@ func (s *StockMovementService) GetStockMovements(request http.Request, search st
 	if request.URL.Query().Get("merchant_id") != "" {
 		stmt = stmt.Where("stock_movements.merchant_id = ?", request.URL.Query().Get("merchant_id"))
 	}
+	if request.URL.Query().Get("lot_id") != "" {
+		stmt = stmt.Where("stock_movements.lot_id = ?", request.URL.Query().Get("lot_id"))
+	}
 	if s.isMerchantMode {
 		stmt = stmt.Where("stock_movements.merchant_id = ?", request.Header.Get("ID-Merchant"))
 	}
@@ -217,7 +221,7 @@ func (s *StockMovementService) UpdateVariantLastStock(varianID, merchantID strin
 // the date, product ID, warehouse ID, optional variant and merchant IDs, optional
 // distributor and company IDs, quantity, movement type, reference ID, and
 // description. It constructs a StockMovementModel with these details and saves
-// it to the database using GORM's Create method.
+// it with RecordMovement, which values the movement and maintains the cost layers.
 //
 // Parameters:
 //   - date: the date of the stock movement.
@@ -234,6 +238,9 @@ func (s *StockMovementService) UpdateVariantLastStock(varianID, merchantID strin
 //
 // Returns:
 //   - A pointer to the newly created StockMovementModel, or an error if the creation fails.
+//
+// Bundle products hold no stock of their own; their movements are recorded with
+// AddMovements.
 func (s *StockMovementService) AddMovement(date time.Time, productID, warehouseID string, variantID, merchantID *string, distributorID, companyID *string, quantity float64, movementType models.MovementType, referenceID, description string) (*models.StockMovementModel, error) {
 	movement := models.StockMovementModel{
 		Date:          date,
@@ -248,8 +255,7 @@ func (s *StockMovementService) AddMovement(date time.Time, productID, warehouseI
 		ReferenceID:   referenceID,
 		Description:   description,
 	}
-
-	if err := s.db.Create(&movement).Error; err != nil {
+	if err := s.RecordMovement(&movement); err != nil {
 		return nil, err
 	}
 
@@ -265,12 +271,22 @@ func (s *StockMovementService) AddMovement(date time.Time, productID, warehouseI
 //
 // Returns:
 //
-//	the total stock quantity of the product if found, and an error if any error occurs.
+//	the total stock quantity of the product in its base unit if found, and an error if any error occurs.
+//
+// The stock of a bundle product is the number of bundles its components in the
+// warehouse are enough for.
 func (s *StockMovementService) GetCurrentStock(productID, warehouseID string) (float64, error) {
+	isBundle, components, err := s.bundleComponents(productID, nil)
+	if err != nil {
+		return 0, err
+	}
+	if isBundle {
+		return s.bundleStock(components, warehouseID)
+	}
 	var totalStock float64
 	if err := s.db.Model(&models.StockMovementModel{}).
 		Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).
-		Select("COALESCE(SUM(quantity), 0)").
+		Select("COALESCE(SUM(quantity * value), 0)").
 		Scan(&totalStock).Error; err != nil {
 		return 0, err
 	}
@@ -287,12 +303,12 @@ func (s *StockMovementService) GetCurrentStock(productID, warehouseID string) (f
 //
 // Returns:
 //
-//	the total stock quantity of the product if found, and an error if any error occurs.
+//	the total stock quantity of the product in its base unit if found, and an error if any error occurs.
 func (s *StockMovementService) GetCurrentStockByMerchantID(productID, merchantID string) (float64, error) {
 	var totalStock float64
 	if err := s.db.Model(&models.StockMovementModel{}).
 		Where("product_id = ? AND merchant_id = ?", productID, merchantID).
-		Select("COALESCE(SUM(quantity), 0)").
+		Select("COALESCE(SUM(quantity * value), 0)").
 		Scan(&totalStock).Error; err != nil {
 		return 0, err
 	}
@@ -310,12 +326,22 @@ func (s *StockMovementService) GetCurrentStockByMerchantID(productID, merchantID
 //
 // Returns:
 //
-//	the total stock quantity of the product variant if found, and an error if any error occurs.
+//	the total stock quantity of the product variant in its base unit if found, and an error if any error occurs.
+//
+// The stock of a bundle variant is the number of bundles its components in the
+// warehouse are enough for.
 func (s *StockMovementService) GetVarianCurrentStock(productID, varianID, warehouseID string) (float64, error) {
+	isBundle, components, err := s.bundleComponents(productID, &varianID)
+	if err != nil {
+		return 0, err
+	}
+	if isBundle {
+		return s.bundleStock(components, warehouseID)
+	}
 	var totalStock float64
 	if err := s.db.Model(&models.StockMovementModel{}).
 		Where("product_id = ? AND variant_id = ? AND warehouse_id = ?", productID, varianID, warehouseID).
-		Select("COALESCE(SUM(quantity), 0)").
+		Select("COALESCE(SUM(quantity * value), 0)").
 		Scan(&totalStock).Error; err != nil {
 		return 0, err
 	}
@@ -333,12 +359,12 @@ func (s *StockMovementService) GetVarianCurrentStock(productID, varianID, wareho
 //
 // Returns:
 //
-//	the total stock quantity of the product variant if found, and an error if any error occurs.
+//	the total stock quantity of the product variant in its base unit if found, and an error if any error occurs.
 func (s *StockMovementService) GetVarianCurrentStockByMerchantID(productID, varianID, merchant_id string) (float64, error) {
 	var totalStock float64
 	if err := s.db.Model(&models.StockMovementModel{}).
 		Where("product_id = ? AND variant_id = ? AND merchant_id = ?", productID, varianID, merchant_id).
-		Select("COALESCE(SUM(quantity), 0)").
+		Select("COALESCE(SUM(quantity * value), 0)").
 		Scan(&totalStock).Error; err != nil {
 		return 0, err
 	}
@@ -346,6 +372,29 @@ func (s *StockMovementService) GetVarianCurrentStockByMerchantID(productID, vari
 	return totalStock, nil
 }
 
+// GetBaseStock retrieves the stock of a product, or of a variant when variantID is
+// not nil, in a warehouse in the base unit of the product. The stock of a bundle
+// is the number of bundles its components are enough for.
+//
+// Args:
+//   - productID: the ID of the product.
+//   - variantID: an optional ID of the variant.
+//   - warehouseID: the ID of the warehouse.
+//
+// Returns:
+//   - the base quantity in stock, and an error if any error occurs.
+func (s *StockMovementService) GetBaseStock(productID string, variantID *string, warehouseID string) (float64, error) {
+	isBundle, components, err := s.bundleComponents(productID, variantID)
+	if err != nil {
+		return 0, err
+	}
+	if isBundle {
+		return s.bundleStock(components, warehouseID)
+	}
+	quantity, _, err := s.onHand(&models.StockMovementModel{ProductID: productID, VariantID: variantID, WarehouseID: warehouseID})
+	return quantity, err
+}
+
 // GetMovementHistory retrieves the stock movement history of a product in a warehouse.
 //
 // Args:
@@ -422,6 +471,9 @@ func (s *StockMovementService) CreateAdjustment(date time.Time, productID, wareh
 }
 
 // TransferStock creates two new stock movements with type TRANSFER for a product between two warehouses.
+// The stock comes into the destination warehouse at the cost it leaves the source warehouse.
+// The move is instant; transfers that take time to arrive are made with a stock transfer
+// document (see the stock_transfer package), which keeps the stock in transit until received.
 //
 // Args:
 //   - date: the date of the stock movement.
@@ -433,33 +485,9 @@ func (s *StockMovementService) CreateAdjustment(date time.Time, productID, wareh
 //   - description: a brief description of the stock movement.
 //
 // Returns:
-//   - A pointer to the newly created StockMovementModel, or an error if the creation fails.
+//   - A pointer to the movement into the destination warehouse, or an error if the creation fails.
 func (s *StockMovementService) TransferStock(date time.Time, sourceWarehouseID, destinationWarehouseID string, productID string, variantID *string, quantity float64, description string) (*models.StockMovementModel, error) {
-	if err := s.db.Transaction(func(tx *gorm.DB) error {
-		var movement *models.StockMovementModel
-		// membuat pergerakan stok di gudang sumber
-		movement, err := s.AddMovement(date, productID, sourceWarehouseID, variantID, nil, nil, nil, -quantity, models.MovementTypeTransfer, "", description)
-		if err != nil {
-			return err
-		}
-
-		// membuat pergerakan stok di gudang tujuan
-		movement2, err := s.AddMovement(date, productID, destinationWarehouseID, variantID, nil, nil, nil, quantity, models.MovementTypeTransfer, movement.ID, description)
-		if err != nil {
-			return err
-		}
-
-		movement.ReferenceID = movement2.ID
-		if err := tx.Save(movement).Error; err != nil {
-			return err
-		}
-
-		return nil
-	}); err != nil {
-		return nil, err
-	}
-
-	return nil, nil
+	return s.TransferStockWithBins(date, sourceWarehouseID, nil, destinationWarehouseID, nil, productID, variantID, quantity, description)
 }
 
 // UpdateStockMovement updates a stock movement in the database.
@@ -478,7 +506,8 @@ func (s *StockMovementService) UpdateStockMovement(id string, data *models.Stock
 	return s.db.Where("id = ?", id).Updates(data).Error
 }
 
-// DeleteStockMovement removes a stock movement from the database by its ID.
+// DeleteStockMovement removes a stock movement from the database by its ID and
+// reverses its cost layers.
 //
 // Args:
 //   - id: the ID of the stock movement to be deleted.
@@ -486,7 +515,12 @@ func (s *StockMovementService) UpdateStockMovement(id string, data *models.Stock
 // Returns:
 //   - an error if the deletion fails.
 func (s *StockMovementService) DeleteStockMovement(id string) error {
-	return s.db.Where("id = ?", id).Delete(&models.StockMovementModel{}).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ReverseCosts(tx, []string{id}); err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.StockMovementModel{}).Error
+	})
 }
 
 // GetStockMovementByID retrieves a stock movement from the database by its ID.
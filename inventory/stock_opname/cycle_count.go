@@ -0,0 +1,500 @@
+package stock_opname
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// quantityEpsilon absorbs the float error of base quantities.
+const quantityEpsilon = 1e-9
+
+// CreateCycleCountPolicy creates the cycle count policy of a warehouse. A
+// warehouse has at most one policy.
+func (s *StockOpnameService) CreateCycleCountPolicy(data *models.CycleCountPolicyModel) error {
+	if err := validatePolicy(data); err != nil {
+		return err
+	}
+	return s.db.Create(data).Error
+}
+
+// UpdateCycleCountPolicy updates a cycle count policy.
+func (s *StockOpnameService) UpdateCycleCountPolicy(id string, data *models.CycleCountPolicyModel) error {
+	if err := validatePolicy(data); err != nil {
+		return err
+	}
+	return s.db.Model(&models.CycleCountPolicyModel{}).
+		Where("id = ?", id).
+		Select("class_a_limit", "class_b_limit", "frequency_a", "frequency_b", "frequency_c", "lookback_days", "schedule", "weekday", "max_items", "is_active").
+		Updates(data).Error
+}
+
+// DeleteCycleCountPolicy deletes a cycle count policy. The classifications of the
+// warehouse are kept.
+func (s *StockOpnameService) DeleteCycleCountPolicy(id string) error {
+	return s.db.Where("id = ?", id).Delete(&models.CycleCountPolicyModel{}).Error
+}
+
+// GetCycleCountPolicyByID retrieves a cycle count policy with its warehouse.
+func (s *StockOpnameService) GetCycleCountPolicyByID(id string) (*models.CycleCountPolicyModel, error) {
+	var policy models.CycleCountPolicyModel
+	if err := s.db.Preload("Warehouse").First(&policy, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetCycleCountPolicies retrieves a paginated list of cycle count policies. If the
+// request contains a company ID header, the result is filtered by the company ID.
+func (s *StockOpnameService) GetCycleCountPolicies(request http.Request) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Warehouse")
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
+	}
+	stmt = stmt.Model(&models.CycleCountPolicyModel{})
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.CycleCountPolicyModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// GetClassifications retrieves a paginated list of product classifications.
+//
+// The search query is applied to the product name. If the request contains a
+// company ID header, the result is filtered by the company ID; the warehouse_id
+// and class query parameters filter it further, and due=true keeps the products
+// due for counting today.
+func (s *StockOpnameService) GetClassifications(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("Product").Preload("Variant").Preload("Warehouse").
+		Joins("JOIN products ON products.id = product_classifications.product_id")
+	if search != "" {
+		stmt = stmt.Where("products.name ILIKE ?", "%"+search+"%")
+	}
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("product_classifications.company_id = ?", request.Header.Get("ID-Company"))
+	}
+	for _, param := range []string{"warehouse_id", "class"} {
+		if request.URL.Query().Get(param) != "" {
+			stmt = stmt.Where("product_classifications."+param+" = ?", request.URL.Query().Get(param))
+		}
+	}
+	if request.URL.Query().Get("due") == "true" {
+		stmt = stmt.Where("product_classifications.next_count_date <= ?", endOfDay(time.Now()))
+	}
+	stmt = stmt.Model(&models.ProductClassificationModel{})
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.ProductClassificationModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// ClassifyProducts classifies the products and variants of the warehouse of a
+// policy A, B or C by the value of their outgoing stock movements over the
+// lookback period of the policy, adjustments left out. Products with stock but
+// without movements are class C.
+//
+// The next count date of a product is the date it was last counted plus the
+// frequency of its class; a product never counted is due on the date of the
+// classification.
+func (s *StockOpnameService) ClassifyProducts(policy *models.CycleCountPolicyModel, date time.Time) ([]models.ProductClassificationModel, error) {
+	var rows []struct {
+		ProductID     string
+		VariantID     *string
+		MovementValue float64
+		OnHand        float64
+	}
+	since := date.AddDate(0, 0, -policy.LookbackDays)
+	err := s.db.Model(&models.StockMovementModel{}).
+		Select("product_id, variant_id, "+
+			"COALESCE(SUM(CASE WHEN quantity * value < 0 AND type <> ? AND date >= ? AND date <= ? THEN -total_cost ELSE 0 END), 0) AS movement_value, "+
+			"COALESCE(SUM(quantity * value), 0) AS on_hand", models.MovementTypeAdjust, since, date).
+		Where("warehouse_id = ?", policy.WarehouseID).
+		Group("product_id, variant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var total float64
+	candidates := rows[:0]
+	for _, v := range rows {
+		if v.MovementValue < 0 {
+			v.MovementValue = 0
+		}
+		if v.MovementValue == 0 && v.OnHand <= quantityEpsilon {
+			continue
+		}
+		total += v.MovementValue
+		candidates = append(candidates, v)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].MovementValue != candidates[j].MovementValue {
+			return candidates[i].MovementValue > candidates[j].MovementValue
+		}
+		return candidates[i].ProductID < candidates[j].ProductID
+	})
+
+	existing := []models.ProductClassificationModel{}
+	if err := s.db.Where("warehouse_id = ?", policy.WarehouseID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byKey := map[string]models.ProductClassificationModel{}
+	for _, v := range existing {
+		byKey[classificationKey(v.ProductID, v.VariantID)] = v
+	}
+
+	classifications := []models.ProductClassificationModel{}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var cumulative float64
+		for _, v := range candidates {
+			before := cumulative
+			if total > 0 {
+				cumulative += v.MovementValue / total * 100
+			}
+			class := models.ABC_CLASS_C
+			switch {
+			case total > 0 && v.MovementValue > 0 && before < policy.ClassALimit:
+				class = models.ABC_CLASS_A
+			case total > 0 && v.MovementValue > 0 && before < policy.ClassBLimit:
+				class = models.ABC_CLASS_B
+			}
+
+			key := classificationKey(v.ProductID, v.VariantID)
+			classification, ok := byKey[key]
+			delete(byKey, key)
+			if !ok {
+				classification = models.ProductClassificationModel{
+					CompanyID:   policy.CompanyID,
+					WarehouseID: policy.WarehouseID,
+					ProductID:   v.ProductID,
+					VariantID:   v.VariantID,
+				}
+			}
+			classification.Class = class
+			classification.MovementValue = utils.AmountRound(v.MovementValue, 2)
+			classification.CumulativePercent = utils.AmountRound(cumulative, 4)
+			classification.ClassifiedAt = date
+			if classification.LastCountedAt != nil {
+				classification.NextCountDate = classification.LastCountedAt.AddDate(0, 0, policy.Frequency(class))
+			} else if classification.NextCountDate.IsZero() {
+				classification.NextCountDate = date
+			}
+			if err := tx.Save(&classification).Error; err != nil {
+				return err
+			}
+			classifications = append(classifications, classification)
+		}
+		// Produk yang tidak lagi ada di gudang tidak perlu dihitung
+		for _, v := range byKey {
+			if err := tx.Delete(&v).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return classifications, nil
+}
+
+// RunCycleCounts generates the cycle count batches due on a date for the active
+// policies of a company, or of all companies when companyID is empty. It is
+// meant to run once a day from a scheduler: daily policies get a batch every day,
+// weekly policies on their weekday, and a policy that already ran on the date is
+// skipped. It returns the batches generated.
+func (s *StockOpnameService) RunCycleCounts(companyID string, date time.Time) ([]models.StockOpnameHeader, error) {
+	policies := []models.CycleCountPolicyModel{}
+	stmt := s.db.Where("is_active = ?", true)
+	if companyID != "" {
+		stmt = stmt.Where("company_id = ?", companyID)
+	}
+	if err := stmt.Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	batches := []models.StockOpnameHeader{}
+	for _, policy := range policies {
+		if policy.Schedule == models.CYCLE_COUNT_WEEKLY && int(date.Weekday()) != policy.Weekday {
+			continue
+		}
+		if policy.LastRunAt != nil && sameDay(*policy.LastRunAt, date) {
+			continue
+		}
+		batch, err := s.GenerateCycleCount(policy.ID, date)
+		if err != nil {
+			return batches, err
+		}
+		if batch != nil {
+			batches = append(batches, *batch)
+		}
+	}
+	return batches, nil
+}
+
+// GenerateCycleCount classifies the products of the warehouse of a policy and
+// creates a draft stock opname with the products due for counting on the date,
+// or in the coming week for a weekly policy: class A first, then by due date, at
+// most MaxItems of them. Products already on an open stock opname of the
+// warehouse are left out. It returns nil when nothing is due.
+//
+// The lines of the batch hold the system quantity at generation and are pending
+// until counted with UpdateItem, which takes the system quantity again at the
+// time of the count; lines still pending when the stock opname is completed are
+// not posted.
+func (s *StockOpnameService) GenerateCycleCount(policyID string, date time.Time) (*models.StockOpnameHeader, error) {
+	policy, err := s.GetCycleCountPolicyByID(policyID)
+	if err != nil {
+		return nil, err
+	}
+	if s.stockMovementService == nil {
+		return nil, errors.New("stock movement service is not initialized")
+	}
+	if _, err := s.ClassifyProducts(policy, date); err != nil {
+		return nil, err
+	}
+
+	horizon := endOfDay(date)
+	if policy.Schedule == models.CYCLE_COUNT_WEEKLY {
+		horizon = horizon.AddDate(0, 0, 6)
+	}
+	due := []models.ProductClassificationModel{}
+	err = s.db.
+		Where("product_classifications.warehouse_id = ? AND product_classifications.next_count_date <= ?", policy.WarehouseID, horizon).
+		Where(`NOT EXISTS (SELECT 1 FROM stock_opname_details d JOIN stock_opname_headers h ON h.id = d.stock_opname_id
+			WHERE h.warehouse_id = product_classifications.warehouse_id AND h.status IN ? AND h.deleted_at IS NULL AND d.deleted_at IS NULL
+			AND d.product_id = product_classifications.product_id
+			AND (d.variant_id = product_classifications.variant_id OR (d.variant_id IS NULL AND product_classifications.variant_id IS NULL)))`,
+			[]models.StockOpnameStatus{models.StatusDraft, models.StatusInProgress}).
+		Order("product_classifications.class, product_classifications.next_count_date").
+		Limit(policy.MaxItems).
+		Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var header *models.StockOpnameHeader
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.CycleCountPolicyModel{}).Where("id = ?", policy.ID).Update("last_run_at", date).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		header = &models.StockOpnameHeader{
+			StockOpnameNumber:  fmt.Sprintf("CC-%s-%s", date.Format("20060102"), utils.RandString(4, true)),
+			CompanyID:          policy.CompanyID,
+			WarehouseID:        policy.WarehouseID,
+			Status:             models.StatusDraft,
+			OpnameDate:         date,
+			Notes:              "Cycle count " + policy.Warehouse.Name,
+			CycleCountPolicyID: &policy.ID,
+		}
+		if err := tx.Create(header).Error; err != nil {
+			return err
+		}
+		s.stockMovementService.SetDB(tx)
+		defer s.stockMovementService.SetDB(s.db)
+		for _, v := range due {
+			systemQty, err := s.stockMovementService.GetBaseStock(v.ProductID, v.VariantID, policy.WarehouseID)
+			if err != nil {
+				return err
+			}
+			detail := models.StockOpnameDetail{
+				StockOpnameID: header.ID,
+				ProductID:     v.ProductID,
+				VariantID:     v.VariantID,
+				SystemQty:     systemQty,
+				UnitValue:     1,
+				IsPending:     true,
+				Notes:         "Kelas " + v.Class,
+			}
+			if err := tx.Create(&detail).Error; err != nil {
+				return err
+			}
+			header.Details = append(header.Details, detail)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// GetCountAccuracy summarises the discrepancy reports (see
+// GenerateDiscrepancyReport) of the stock opnames of a company completed between
+// two dates, per warehouse, product or month as groupBy is "warehouse",
+// "product" or "period". Warehouses and products are sorted by drift, the ones
+// that drift most first; periods by date.
+func (s *StockOpnameService) GetCountAccuracy(companyID string, from, to time.Time, groupBy string) ([]models.CountAccuracy, error) {
+	if groupBy == "" {
+		groupBy = "warehouse"
+	}
+	if groupBy != "warehouse" && groupBy != "product" && groupBy != "period" {
+		return nil, fmt.Errorf("invalid group %s", groupBy)
+	}
+	headers := []models.StockOpnameHeader{}
+	err := s.db.Preload("Warehouse").
+		Where("company_id = ? AND status = ? AND opname_date BETWEEN ? AND ?", companyID, models.StatusCompleted, from, to).
+		Order("opname_date").
+		Find(&headers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*models.CountAccuracy{}
+	byKey := map[string]*models.CountAccuracy{}
+	for _, header := range headers {
+		report, err := s.GenerateDiscrepancyReport(header.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range report {
+			key, name := header.WarehouseID, header.Warehouse.Name
+			switch groupBy {
+			case "product":
+				key, name = line.ProductID, line.ProductName
+			case "period":
+				key = header.OpnameDate.Format("2006-01")
+				name = key
+			}
+			accuracy, ok := byKey[key]
+			if !ok {
+				accuracy = &models.CountAccuracy{Key: key, Name: name}
+				byKey[key] = accuracy
+				results = append(results, accuracy)
+			}
+			accuracy.Lines++
+			if math.Abs(line.Difference) <= quantityEpsilon {
+				accuracy.AccurateLines++
+			}
+			accuracy.SystemQty += line.SystemQty
+			accuracy.AbsoluteDifference += math.Abs(line.Difference)
+			accuracy.NetDifference += line.Difference
+		}
+	}
+
+	accuracies := make([]models.CountAccuracy, 0, len(results))
+	for _, v := range results {
+		v.AccuracyPercent = utils.AmountRound(float64(v.AccurateLines)/float64(v.Lines)*100, 2)
+		switch {
+		case v.SystemQty > quantityEpsilon:
+			v.Drift = utils.AmountRound(v.AbsoluteDifference/v.SystemQty*100, 2)
+		case v.AbsoluteDifference > quantityEpsilon:
+			v.Drift = 100
+		}
+		v.SystemQty = utils.AmountRound(v.SystemQty, 6)
+		v.AbsoluteDifference = utils.AmountRound(v.AbsoluteDifference, 6)
+		v.NetDifference = utils.AmountRound(v.NetDifference, 6)
+		accuracies = append(accuracies, *v)
+	}
+	if groupBy != "period" {
+		sort.SliceStable(accuracies, func(i, j int) bool {
+			return accuracies[i].Drift > accuracies[j].Drift
+		})
+	}
+	return accuracies, nil
+}
+
+// markCounted sets the last count date of the products counted on a stock opname
+// and moves their next count date by the frequency of their class.
+func (s *StockOpnameService) markCounted(tx *gorm.DB, header *models.StockOpnameHeader, date time.Time) error {
+	var policy models.CycleCountPolicyModel
+	err := tx.Where("warehouse_id = ?", header.WarehouseID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, detail := range header.Details {
+		if detail.IsPending {
+			continue
+		}
+		classifications := []models.ProductClassificationModel{}
+		stmt := tx.Where("warehouse_id = ? AND product_id = ?", header.WarehouseID, detail.ProductID)
+		if detail.VariantID != nil {
+			stmt = stmt.Where("variant_id = ?", *detail.VariantID)
+		} else {
+			stmt = stmt.Where("variant_id IS NULL")
+		}
+		if err := stmt.Find(&classifications).Error; err != nil {
+			return err
+		}
+		for _, v := range classifications {
+			err := tx.Model(&models.ProductClassificationModel{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+				"last_counted_at": date,
+				"next_count_date": date.AddDate(0, 0, policy.Frequency(v.Class)),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validatePolicy checks the limits, frequencies and schedule of a cycle count
+// policy and fills in the defaults.
+func validatePolicy(data *models.CycleCountPolicyModel) error {
+	if data.ClassALimit == 0 {
+		data.ClassALimit = 80
+	}
+	if data.ClassBLimit == 0 {
+		data.ClassBLimit = 95
+	}
+	if data.ClassALimit <= 0 || data.ClassALimit >= data.ClassBLimit || data.ClassBLimit > 100 {
+		return errors.New("class limits must satisfy 0 < A < B <= 100")
+	}
+	for _, v := range []struct {
+		frequency *int
+		days      int
+	}{{&data.FrequencyA, 30}, {&data.FrequencyB, 90}, {&data.FrequencyC, 180}} {
+		if *v.frequency == 0 {
+			*v.frequency = v.days
+		}
+	}
+	if data.FrequencyA < 0 || data.FrequencyB < 0 || data.FrequencyC < 0 {
+		return errors.New("count frequencies must be greater than zero")
+	}
+	if data.LookbackDays <= 0 {
+		data.LookbackDays = 365
+	}
+	if data.MaxItems <= 0 {
+		data.MaxItems = 50
+	}
+	if data.Schedule == "" {
+		data.Schedule = models.CYCLE_COUNT_WEEKLY
+	}
+	if data.Schedule != models.CYCLE_COUNT_DAILY && data.Schedule != models.CYCLE_COUNT_WEEKLY {
+		return fmt.Errorf("invalid schedule %s", data.Schedule)
+	}
+	if data.Weekday < 0 || data.Weekday > 6 {
+		return errors.New("weekday must be between 0 (Sunday) and 6")
+	}
+	return nil
+}
+
+func classificationKey(productID string, variantID *string) string {
+	if variantID == nil {
+		return productID
+	}
+	return productID + "|" + *variantID
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+func endOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
+}
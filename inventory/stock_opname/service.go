@@ -2,7 +2,6 @@ package stock_opname
 
 import (
 	"errors"
-	"math"
 	"net/http"
 	"time"
 
@@ -12,6 +11,7 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
 )
@@ -29,9 +29,9 @@ func NewStockOpnameService(db *gorm.DB, ctx *context.ERPContext, productService
 	return &StockOpnameService{db: db, ctx: ctx, productService: productService, stockMovementService: stockMovementService}
 }
 
-// Migrate performs the database schema migration for StockOpnameHeader and StockOpnameDetail models.
+// Migrate performs the database schema migration for the StockOpnameHeader, StockOpnameDetail and cycle count models.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.StockOpnameHeader{}, &models.StockOpnameDetail{})
+	return db.AutoMigrate(&models.StockOpnameHeader{}, &models.StockOpnameDetail{}, &models.CycleCountPolicyModel{}, &models.ProductClassificationModel{})
 }
 
 // CreateStockOpnameFromHeader creates a new stock opname header with the given data and returns an error if the
@@ -58,6 +58,7 @@ func (s *StockOpnameService) GetStockOpnameByID(stockOpnameID string) (*models.S
 		Preload("Warehouse").
 		Preload("CreatedBy").
 		Preload("Details.Product").
+		Preload("Details.Bin").
 		First(&stockOpnameHeader, "id = ?", stockOpnameID).Error; err != nil {
 		return nil, err
 	}
@@ -101,7 +102,9 @@ func (s *StockOpnameService) GetStockOpnames(request http.Request, search string
 // If the retrieval is unsuccessful, the function returns an error.
 // The function then populates the stock opname detail with the given data and the retrieved
 // stock opname header's ID. It also retrieves the product's current stock quantity from the
-// product service and populates the stock opname detail with it.
+// product service, or the stock of the lot or the bin when the detail names one, and populates
+// the stock opname detail with it. The counted quantity is converted to the base unit of the
+// product and the difference with the system stock is computed in that unit.
 // Finally, the function creates a new stock opname detail in the database and returns an error
 // if the creation is unsuccessful.
 func (s *StockOpnameService) AddItem(stockOpnameID string, data *models.StockOpnameDetail) error {
@@ -114,8 +117,34 @@ func (s *StockOpnameService) AddItem(stockOpnameID string, data *models.StockOpn
 	if err != nil {
 		return err
 	}
+	// A count of a single lot is compared with the stock of that lot, and a
+	// count of a bin with the stock in that bin.
+	var lotID *string
+	if data.LotNumber != "" && s.stockMovementService != nil {
+		lot, err := s.stockMovementService.FindLot(data.ProductID, data.VariantID, data.LotNumber)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		systemQty = 0
+		if lot != nil {
+			lotID = &lot.ID
+			systemQty, err = s.stockMovementService.GetLotQuantity(lot.ID, &stockOpnameHeader.WarehouseID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if data.BinID != nil && s.stockMovementService != nil && (data.LotNumber == "" || lotID != nil) {
+		systemQty, err = s.stockMovementService.GetBinQuantity(*data.BinID, data.ProductID, data.VariantID, lotID)
+		if err != nil {
+			return err
+		}
+	}
 
 	data.SystemQty = systemQty
+	if err := s.setDifference(data); err != nil {
+		return err
+	}
 
 	return s.db.Debug().Create(&data).Error
 }
@@ -124,19 +153,74 @@ func (s *StockOpnameService) AddItem(stockOpnameID string, data *models.StockOpn
 //
 // The function first retrieves the stock opname detail with the given ID from the database.
 // If the retrieval is unsuccessful, it returns an error.
-// It then updates the stock opname detail with the new data provided.
+// It then updates the stock opname detail with the new data provided, and recomputes the base
+// quantity and the difference with the system stock from the updated count and unit. A pending
+// cycle count line counts as counted once it is updated; its system quantity is taken again
+// from the stock at that moment, as the stock may have moved since the batch was generated.
 // An error is returned if the update operation in the database fails.
 func (s *StockOpnameService) UpdateItem(stockOpnameDetailID string, data *models.StockOpnameDetail) error {
 	var stockOpnameDetail models.StockOpnameDetail
 	if err := s.db.First(&stockOpnameDetail, "id = ?", stockOpnameDetailID).Error; err != nil {
 		return err
 	}
-	if err := s.db.Model(&models.StockOpnameDetail{}).
-		Where("id = ?", stockOpnameDetailID).
-		Updates(data).
-		Error; err != nil {
+	wasPending := stockOpnameDetail.IsPending
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.StockOpnameDetail{}).
+			Where("id = ?", stockOpnameDetailID).
+			Updates(data).
+			Error; err != nil {
+			return err
+		}
+		if err := tx.First(&stockOpnameDetail, "id = ?", stockOpnameDetailID).Error; err != nil {
+			return err
+		}
+		if wasPending && s.stockMovementService != nil {
+			systemQty, err := s.countedSystemQty(tx, &stockOpnameDetail)
+			if err != nil {
+				return err
+			}
+			stockOpnameDetail.SystemQty = systemQty
+		}
+		if err := s.setDifference(&stockOpnameDetail); err != nil {
+			return err
+		}
+		return tx.Model(&models.StockOpnameDetail{}).
+			Where("id = ?", stockOpnameDetailID).
+			Updates(map[string]interface{}{
+				"system_qty":    stockOpnameDetail.SystemQty,
+				"unit_value":    stockOpnameDetail.UnitValue,
+				"base_quantity": stockOpnameDetail.BaseQuantity,
+				"difference":    stockOpnameDetail.Difference,
+				"is_pending":    false,
+			}).Error
+	})
+}
+
+// countedSystemQty returns the stock a pending cycle count line is counted
+// against: the stock of the product in the warehouse of the stock opname, or in
+// the bin of the line when it has one.
+func (s *StockOpnameService) countedSystemQty(tx *gorm.DB, detail *models.StockOpnameDetail) (float64, error) {
+	var header models.StockOpnameHeader
+	if err := tx.Select("id", "warehouse_id").First(&header, "id = ?", detail.StockOpnameID).Error; err != nil {
+		return 0, err
+	}
+	if detail.BinID != nil {
+		return s.stockMovementService.GetBinQuantity(*detail.BinID, detail.ProductID, detail.VariantID, nil)
+	}
+	return s.stockMovementService.GetBaseStock(detail.ProductID, detail.VariantID, header.WarehouseID)
+}
+
+// setDifference converts the counted quantity of a detail to the base unit of
+// the product and sets the difference with the system stock, which is already in
+// the base unit.
+func (s *StockOpnameService) setDifference(detail *models.StockOpnameDetail) error {
+	unitValue, err := models.GetProductUnitValue(s.db, detail.ProductID, detail.UnitID)
+	if err != nil {
 		return err
 	}
+	detail.UnitValue = unitValue
+	detail.BaseQuantity = detail.Quantity * unitValue
+	detail.Difference = detail.BaseQuantity - detail.SystemQty
 	return nil
 }
 
@@ -177,6 +261,13 @@ func (s *StockOpnameService) DeleteStockOpname(stockOpnameID string, skipTransac
 		}
 
 		// Delete related inventory transactions
+		var movementIDs []string
+		if err := tx.Model(&models.StockMovementModel{}).Where("reference_id = ?", stockOpnameID).Pluck("id", &movementIDs).Error; err != nil {
+			return err
+		}
+		if err := stockmovement.ReverseCosts(tx, movementIDs); err != nil {
+			return err
+		}
 		if err := tx.Where("reference_id = ?", stockOpnameID).Delete(&models.StockMovementModel{}).Error; err != nil {
 			return err
 		}
@@ -240,6 +331,8 @@ func (s *StockOpnameService) CreateStockOpname(warehouseID string, products []mo
 			StockOpnameID: stockOpnameHeader.ID,
 			ProductID:     product.ID,
 			Quantity:      product.TotalStock,
+			UnitValue:     1,
+			BaseQuantity:  product.TotalStock,
 			SystemQty:     systemQty,
 			Difference:    difference,
 		}
@@ -254,8 +347,14 @@ func (s *StockOpnameService) CreateStockOpname(warehouseID string, products []mo
 // CompleteStockOpname completes a stock opname with the given ID. The function
 // updates the product stock quantities and creates stock movement records for
 // each product with a difference between the counted quantity and the system
-// quantity. The function also creates journal entries for the stock opname if
-// the inventoryID parameter is not nil. The function returns an error if any
+// quantity. The movements are dated on the date of the stock opname, like its
+// journal entries. A surplus is valued at the unit price of the detail and a
+// shortage at the cost of the stock. Details of tracked products adjust the lot or serial
+// numbers they name; a shortage without them is taken first expired, first out.
+// Cycle count lines that were not counted are skipped and stay due; the products
+// counted get their next cycle count date. The function also creates journal entries for the
+// stock opname with these values if the inventoryID parameter is not nil. The
+// function returns an error if any
 // error occurs during the process.
 //
 // Args:
@@ -276,33 +375,39 @@ func (s *StockOpnameService) CompleteStockOpname(stockOpnameID string, date time
 
 		// Update stok di sistem untuk setiap produk
 		for _, detail := range stockOpnameHeader.Details {
+			if detail.IsPending {
+				continue
+			}
 			if detail.Difference != 0 {
-				movement, err := s.stockMovementService.CreateAdjustment(
-					time.Now(),
-					detail.ProductID,
-					stockOpnameHeader.WarehouseID,
-					detail.VariantID,
-					nil,
-					nil,
-					nil,
-					detail.Difference,
-					stockOpnameHeader.ID,
-					stockOpnameHeader.Notes,
-				)
-				if err != nil {
-					return err
-				}
-
 				refType := "stock_opname"
 				secRefType := "stock_opname_detail"
-				movement.ReferenceType = &refType
-				movement.SecondaryRefID = &detail.ID
-				movement.SecondaryRefType = &secRefType
-				movement.Value = detail.UnitValue
-				movement.UnitID = detail.UnitID
-				movement.CompanyID = stockOpnameHeader.CompanyID
-
-				err = tx.Save(movement).Error
+				// A surplus comes in at the counted unit price; a shortage
+				// leaves at the cost of the stock. The difference is in the
+				// base unit, so the unit price is converted to it.
+				unitValue := detail.UnitValue
+				if unitValue == 0 {
+					unitValue = 1
+				}
+				movement := models.StockMovementModel{
+					Date:             date,
+					ProductID:        detail.ProductID,
+					VariantID:        detail.VariantID,
+					WarehouseID:      stockOpnameHeader.WarehouseID,
+					BinID:            detail.BinID,
+					CompanyID:        stockOpnameHeader.CompanyID,
+					Quantity:         detail.Difference,
+					Value:            1,
+					Type:             models.MovementTypeAdjust,
+					ReferenceID:      stockOpnameHeader.ID,
+					ReferenceType:    &refType,
+					SecondaryRefID:   &detail.ID,
+					SecondaryRefType: &secRefType,
+					UnitCost:         detail.UnitPrice / unitValue,
+					Description:      stockOpnameHeader.Notes,
+				}
+				s.stockMovementService.SetDB(tx)
+				movements, err := s.stockMovementService.RecordTrackedMovement(&movement, detail.LotTracking)
+				s.stockMovementService.SetDB(s.db)
 				if err != nil {
 					return err
 				}
@@ -310,7 +415,11 @@ func (s *StockOpnameService) CompleteStockOpname(stockOpnameID string, date time
 				if inventoryID != nil {
 
 					inventoryTransID := utils.Uuid()
-					totalPrice := math.Abs(detail.Difference * detail.UnitValue * detail.UnitPrice)
+					var totalCost money.Amount
+					for _, m := range movements {
+						totalCost = totalCost.Add(money.FromFloat(m.TotalCost))
+					}
+					totalPrice := totalCost.Abs().Float64()
 					code := utils.RandString(8, false)
 					if detail.Difference > 0 {
 						var stockOpnameAccount models.AccountModel
@@ -425,6 +534,9 @@ func (s *StockOpnameService) CompleteStockOpname(stockOpnameID string, date time
 
 			}
 		}
+		if err := s.markCounted(tx, &stockOpnameHeader, date); err != nil {
+			return err
+		}
 		// Update status stock opname menjadi "COMPLETED"
 		return tx.Model(&stockOpnameHeader).Update("status", models.StatusCompleted).Error
 
@@ -432,25 +544,26 @@ func (s *StockOpnameService) CompleteStockOpname(stockOpnameID string, date time
 }
 
 type StockDiscrepancyReport struct {
-	ProductID   string `json:"product_id"`
-	ProductName string `json:"product_name"`
-	PhysicalQty int    `json:"physical_qty"`
-	SystemQty   int    `json:"system_qty"`
-	Difference  int    `json:"difference"`
-	Notes       string `json:"notes"`
+	ProductID   string  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	PhysicalQty float64 `json:"physical_qty"`
+	SystemQty   float64 `json:"system_qty"`
+	Difference  float64 `json:"difference"`
+	Notes       string  `json:"notes"`
 }
 
 // GenerateDiscrepancyReport generates a discrepancy report for a given stock opname ID.
 //
-// The discrepancy report is a list of products with their physical quantity, system quantity, difference, and notes.
+// The discrepancy report is a list of products with their physical quantity, system quantity, difference, and notes,
+// all in the base unit of the product. Cycle count lines that were not counted are left out.
 // The function first joins the stock_opname_details table with the products table and then selects the required columns.
 // The function then scans the results into a slice of StockDiscrepancyReport and returns it along with an error if any.
 func (s *StockOpnameService) GenerateDiscrepancyReport(stockOpnameID string) ([]StockDiscrepancyReport, error) {
 	var report []StockDiscrepancyReport
 	err := s.db.Table("stock_opname_details").
 		Joins("JOIN products ON stock_opname_details.product_id = products.id").
-		Where("stock_opname_details.stock_opname_id = ?", stockOpnameID).
-		Select("stock_opname_details.product_id, products.name as product_name, stock_opname_details.quantity as physical_qty, stock_opname_details.system_qty, stock_opname_details.difference, stock_opname_details.notes").
+		Where("stock_opname_details.stock_opname_id = ? AND stock_opname_details.is_pending = ?", stockOpnameID, false).
+		Select("stock_opname_details.product_id, products.name as product_name, COALESCE(NULLIF(stock_opname_details.base_quantity, 0), stock_opname_details.quantity) as physical_qty, stock_opname_details.system_qty, stock_opname_details.difference, stock_opname_details.notes").
 		Scan(&report).Error
 	return report, err
 }
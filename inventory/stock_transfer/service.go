@@ -0,0 +1,905 @@
+package stock_transfer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/context"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
+	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/AMETORY/ametory-erp-modules/shared/models"
+	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quantityEpsilon absorbs the float error of base quantities.
+const quantityEpsilon = 1e-9
+
+const (
+	refType    = "stock_transfer"
+	secRefType = "stock_transfer_item"
+)
+
+type StockTransferService struct {
+	db                   *gorm.DB
+	ctx                  *context.ERPContext
+	stockMovementService *stockmovement.StockMovementService
+}
+
+// NewStockTransferService creates a new instance of StockTransferService with the given database connection,
+// context and stock movement service.
+func NewStockTransferService(db *gorm.DB, ctx *context.ERPContext, stockMovementService *stockmovement.StockMovementService) *StockTransferService {
+	return &StockTransferService{db: db, ctx: ctx, stockMovementService: stockMovementService}
+}
+
+// Migrate migrates the database schema for the stock transfer models.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.StockTransferModel{},
+		&models.StockTransferItemModel{},
+		&models.StockTransferReceiptModel{},
+		&models.StockTransferReceiptItemModel{},
+	)
+}
+
+// CreateTransfer creates a draft transfer between two warehouses of the company
+// of the transfer, with its items if it has any.
+func (s *StockTransferService) CreateTransfer(data *models.StockTransferModel) error {
+	if err := s.checkWarehouses(data); err != nil {
+		return err
+	}
+	if err := s.checkShipment(data.ShipmentID); err != nil {
+		return err
+	}
+	data.Status = models.TRANSFER_DRAFT
+	if data.Date.IsZero() {
+		data.Date = time.Now()
+	}
+	for i := range data.Items {
+		if err := s.setBaseUnit(&data.Items[i]); err != nil {
+			return err
+		}
+		if err := s.checkBins(data, &data.Items[i]); err != nil {
+			return err
+		}
+	}
+	return s.db.Create(data).Error
+}
+
+// UpdateTransfer updates the header of a draft transfer.
+func (s *StockTransferService) UpdateTransfer(id string, data *models.StockTransferModel) error {
+	transfer, err := s.getDraft(id)
+	if err != nil {
+		return err
+	}
+	if data.SourceWarehouseID == "" {
+		data.SourceWarehouseID = transfer.SourceWarehouseID
+	}
+	if data.DestinationWarehouseID == "" {
+		data.DestinationWarehouseID = transfer.DestinationWarehouseID
+	}
+	if data.CompanyID == nil {
+		data.CompanyID = transfer.CompanyID
+	}
+	if err := s.checkWarehouses(data); err != nil {
+		return err
+	}
+	if err := s.checkShipment(data.ShipmentID); err != nil {
+		return err
+	}
+	return s.db.Model(&models.StockTransferModel{}).
+		Where("id = ?", id).
+		Omit("Items", "Receipts", "status", "transit_warehouse_id").
+		Updates(data).Error
+}
+
+// DeleteTransfer deletes a draft or cancelled transfer.
+func (s *StockTransferService) DeleteTransfer(id string) error {
+	var transfer models.StockTransferModel
+	if err := s.db.Select("id", "status").First(&transfer, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if transfer.Status != models.TRANSFER_DRAFT && transfer.Status != models.TRANSFER_CANCELLED {
+		return errors.New("only draft or cancelled transfers can be deleted")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("transfer_id = ?", id).Delete(&models.StockTransferItemModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.StockTransferModel{}).Error
+	})
+}
+
+// CancelTransfer cancels a draft transfer. A transfer that was shipped cannot be
+// cancelled; goods that will not arrive are recorded as a discrepancy when it is
+// received.
+func (s *StockTransferService) CancelTransfer(id string) error {
+	if _, err := s.getDraft(id); err != nil {
+		return err
+	}
+	return s.db.Model(&models.StockTransferModel{}).Where("id = ?", id).Update("status", models.TRANSFER_CANCELLED).Error
+}
+
+// GetTransferByID retrieves a transfer with its warehouses, shipment, items and
+// receipts.
+func (s *StockTransferService) GetTransferByID(id string) (*models.StockTransferModel, error) {
+	var transfer models.StockTransferModel
+	err := s.db.
+		Preload("SourceWarehouse").
+		Preload("DestinationWarehouse").
+		Preload("TransitWarehouse").
+		Preload("Shipment").
+		Preload("CreatedBy").
+		Preload("ShippedBy").
+		Preload("Items.Product").
+		Preload("Items.Variant").
+		Preload("Items.Unit").
+		Preload("Items.SourceBin").
+		Preload("Items.DestinationBin").
+		Preload("Receipts.ReceivedBy").
+		Preload("Receipts.Items").
+		First(&transfer, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// GetTransfers retrieves a paginated list of transfers.
+//
+// The search query is applied to the transfer number and notes. If the request
+// contains a company ID header, the result is filtered by the company ID; the
+// status, source_warehouse_id, destination_warehouse_id and shipment_id query
+// parameters filter it further.
+func (s *StockTransferService) GetTransfers(request http.Request, search string) (paginate.Page, error) {
+	pg := paginate.New()
+	stmt := s.db.Preload("SourceWarehouse").Preload("DestinationWarehouse")
+	if search != "" {
+		stmt = stmt.Where("(stock_transfers.transfer_number ILIKE ? OR stock_transfers.notes ILIKE ?)",
+			"%"+search+"%",
+			"%"+search+"%",
+		)
+	}
+	if request.Header.Get("ID-Company") != "" {
+		stmt = stmt.Where("stock_transfers.company_id = ?", request.Header.Get("ID-Company"))
+	}
+	for _, param := range []string{"status", "source_warehouse_id", "destination_warehouse_id", "shipment_id"} {
+		if request.URL.Query().Get(param) != "" {
+			stmt = stmt.Where("stock_transfers."+param+" = ?", request.URL.Query().Get(param))
+		}
+	}
+	stmt = stmt.Model(&models.StockTransferModel{})
+	utils.FixRequest(&request)
+	page := pg.With(stmt).Request(request).Response(&[]models.StockTransferModel{})
+	page.Page = page.Page + 1
+	return page, nil
+}
+
+// GetInTransitItems returns the items of the shipped transfers of a company that
+// still have goods in transit.
+func (s *StockTransferService) GetInTransitItems(companyID string) ([]models.StockTransferItemModel, error) {
+	var items []models.StockTransferItemModel
+	err := s.db.
+		Preload("Transfer.SourceWarehouse").
+		Preload("Transfer.DestinationWarehouse").
+		Preload("Product").
+		Preload("Variant").
+		Joins("JOIN stock_transfers ON stock_transfers.id = stock_transfer_items.transfer_id").
+		Where("stock_transfers.deleted_at IS NULL AND stock_transfers.company_id = ?", companyID).
+		Where("stock_transfers.status IN ?", []string{models.TRANSFER_SHIPPED, models.TRANSFER_PARTIALLY_RECEIVED}).
+		Where("stock_transfer_items.shipped_quantity - stock_transfer_items.received_quantity - stock_transfer_items.discrepancy_quantity > ?", quantityEpsilon).
+		Order("stock_transfers.shipped_at").
+		Find(&items).Error
+	return items, err
+}
+
+// AddItem adds an item to a draft transfer. The quantity of the item is
+// converted to the base unit of the product.
+func (s *StockTransferService) AddItem(transferID string, data *models.StockTransferItemModel) error {
+	transfer, err := s.getDraft(transferID)
+	if err != nil {
+		return err
+	}
+	data.TransferID = transferID
+	if err := s.setBaseUnit(data); err != nil {
+		return err
+	}
+	if err := s.checkBins(transfer, data); err != nil {
+		return err
+	}
+	return s.db.Create(data).Error
+}
+
+// UpdateItem updates an item of a draft transfer.
+func (s *StockTransferService) UpdateItem(itemID string, data *models.StockTransferItemModel) error {
+	var item models.StockTransferItemModel
+	if err := s.db.First(&item, "id = ?", itemID).Error; err != nil {
+		return err
+	}
+	transfer, err := s.getDraft(item.TransferID)
+	if err != nil {
+		return err
+	}
+	data.TransferID = item.TransferID
+	if data.ProductID == "" {
+		data.ProductID = item.ProductID
+	}
+	if err := s.setBaseUnit(data); err != nil {
+		return err
+	}
+	if err := s.checkBins(transfer, data); err != nil {
+		return err
+	}
+	return s.db.Model(&models.StockTransferItemModel{}).
+		Where("id = ?", itemID).
+		Select("product_id", "variant_id", "description", "quantity", "unit_id", "unit_value", "base_quantity", "source_bin_id", "destination_bin_id", "notes").
+		Updates(data).Error
+}
+
+// DeleteItem deletes an item of a draft transfer.
+func (s *StockTransferService) DeleteItem(itemID string) error {
+	var item models.StockTransferItemModel
+	if err := s.db.First(&item, "id = ?", itemID).Error; err != nil {
+		return err
+	}
+	if _, err := s.getDraft(item.TransferID); err != nil {
+		return err
+	}
+	return s.db.Where("id = ?", itemID).Delete(&models.StockTransferItemModel{}).Error
+}
+
+// LinkShipment links a transfer to a shipment of the logistic module, or unlinks
+// it when shipmentID is nil.
+func (s *StockTransferService) LinkShipment(id string, shipmentID *string) error {
+	var transfer models.StockTransferModel
+	if err := s.db.Select("id", "status").First(&transfer, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if transfer.Status == models.TRANSFER_CANCELLED {
+		return errors.New("transfer is cancelled")
+	}
+	if err := s.checkShipment(shipmentID); err != nil {
+		return err
+	}
+	return s.db.Model(&models.StockTransferModel{}).Where("id = ?", id).Update("shipment_id", shipmentID).Error
+}
+
+// ShipTransfer ships a draft transfer: the stock of every item leaves the source
+// warehouse, from the source bin of the item when it has one, and comes into the
+// in-transit warehouse of the company at the same cost. Lot tracked products
+// leave first expired, first out and keep their lots in transit.
+//
+// When the source and destination warehouses belong to different branches, the
+// value shipped is moved from the inventory account to the inventory in transit
+// account. The ship date must not be in a locked inventory period.
+//
+// The transfer is locked while it is shipped, so it is shipped only once.
+func (s *StockTransferService) ShipTransfer(id string, date time.Time, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		transfer, err := lockTransfer(tx, id)
+		if err != nil {
+			return err
+		}
+		if transfer.Status != models.TRANSFER_DRAFT {
+			return errors.New("transfer is not a draft")
+		}
+		if len(transfer.Items) == 0 {
+			return errors.New("transfer has no items")
+		}
+		source, destination, err := s.warehouses(transfer)
+		if err != nil {
+			return err
+		}
+		if err := period.Check(tx, transfer.CompanyID, "inventory", date); err != nil {
+			return err
+		}
+		transit, err := s.transitWarehouse(tx, transfer.CompanyID)
+		if err != nil {
+			return err
+		}
+		s.stockMovementService.SetDB(tx)
+		defer s.stockMovementService.SetDB(s.db)
+
+		ref, secRef := refType, secRefType
+		var shippedValue money.Amount
+		for _, item := range transfer.Items {
+			itemID := item.ID
+			onHand, err := s.stockMovementService.GetBaseStock(item.ProductID, item.VariantID, transfer.SourceWarehouseID)
+			if err != nil {
+				return err
+			}
+			if item.SourceBinID != nil {
+				onHand, err = s.stockMovementService.GetBinQuantity(*item.SourceBinID, item.ProductID, item.VariantID, nil)
+				if err != nil {
+					return err
+				}
+			}
+			if onHand < item.BaseQuantity-quantityEpsilon {
+				return fmt.Errorf("insufficient stock to ship %s: %v available", item.Description, utils.AmountRound(onHand, 6))
+			}
+
+			// membuat pergerakan stok keluar dari gudang asal
+			outs, err := s.stockMovementService.RecordTrackedMovement(&models.StockMovementModel{
+				Date:             date,
+				ProductID:        item.ProductID,
+				VariantID:        item.VariantID,
+				WarehouseID:      transfer.SourceWarehouseID,
+				BinID:            item.SourceBinID,
+				CompanyID:        transfer.CompanyID,
+				Quantity:         -item.BaseQuantity,
+				Value:            1,
+				Type:             models.MovementTypeTransfer,
+				ReferenceID:      transfer.ID,
+				ReferenceType:    &ref,
+				SecondaryRefID:   &itemID,
+				SecondaryRefType: &secRef,
+				Description:      fmt.Sprintf("Transfer %s to %s", transfer.TransferNumber, destination.Name),
+			}, models.LotTracking{})
+			if err != nil {
+				return err
+			}
+
+			// membuat pergerakan stok masuk ke gudang transit dengan biaya yang sama
+			var itemValue money.Amount
+			for _, v := range outs {
+				in := models.StockMovementModel{
+					Date:             date,
+					ProductID:        item.ProductID,
+					VariantID:        item.VariantID,
+					LotID:            v.LotID,
+					WarehouseID:      transit.ID,
+					CompanyID:        transfer.CompanyID,
+					Quantity:         -v.Quantity * v.Value,
+					Value:            1,
+					TotalCost:        -v.TotalCost,
+					Type:             models.MovementTypeTransfer,
+					ReferenceID:      transfer.ID,
+					ReferenceType:    &ref,
+					SecondaryRefID:   &itemID,
+					SecondaryRefType: &secRef,
+					Description:      fmt.Sprintf("Transfer %s from %s to %s", transfer.TransferNumber, source.Name, destination.Name),
+				}
+				if err := s.stockMovementService.RecordMovement(&in); err != nil {
+					return err
+				}
+				itemValue = itemValue.Add(money.FromFloat(in.TotalCost))
+			}
+			shippedValue = shippedValue.Add(itemValue)
+
+			err = tx.Model(&models.StockTransferItemModel{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+				"shipped_quantity": item.BaseQuantity,
+				"unit_cost":        itemValue.Div(item.BaseQuantity).Float64(),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if !sameBranch(source, destination) && !shippedValue.IsZero() {
+			inventoryAccount, transitAccount, err := s.transitAccounts(transfer.CompanyID)
+			if err != nil {
+				return err
+			}
+			err = s.postJournal(tx, transfer, date, userID,
+				journalSide{AccountID: transitAccount, BranchID: source.BranchID},
+				journalSide{AccountID: inventoryAccount, BranchID: source.BranchID},
+				shippedValue.Float64(),
+				"Persediaan Dalam Perjalanan "+transfer.TransferNumber,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.StockTransferModel{}).Where("id = ?", transfer.ID).Updates(map[string]interface{}{
+			"status":               models.TRANSFER_SHIPPED,
+			"transit_warehouse_id": transit.ID,
+			"shipped_at":           date,
+			"shipped_by_id":        userID,
+		}).Error
+	})
+}
+
+// ReceiveTransfer records goods of a shipped transfer arriving at the
+// destination warehouse. Each item of the receipt names a transfer item, the
+// quantity that arrived and the quantity known not to arrive, both in the unit of
+// the transfer item, and together at most what is still in transit.
+//
+// Goods that arrived leave the in-transit warehouse at the cost they were shipped
+// at and come into the destination warehouse, into the destination bin of the
+// item when it has one; goods that did not arrive leave it as an adjustment. The
+// transfer is received when nothing is left in transit, and partially received
+// otherwise.
+//
+// When the warehouses belong to different branches, the value received is moved
+// from the inventory in transit account to the inventory account of the
+// destination branch. The value of the discrepancy is charged to the stock opname
+// expense account, from the inventory in transit account or, within one branch,
+// from the inventory account. The receipt date must not be in a locked inventory
+// period.
+//
+// The transfer is locked while the receipt is recorded and the quantities in
+// transit are read under the lock, so concurrent receipts can not receive the
+// same goods twice.
+func (s *StockTransferService) ReceiveTransfer(id string, receipt *models.StockTransferReceiptModel, userID string) error {
+	if len(receipt.Items) == 0 {
+		return errors.New("receipt has no items")
+	}
+	if receipt.Date.IsZero() {
+		receipt.Date = time.Now()
+	}
+	receipt.ReceivedByID = &userID
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		transfer, err := lockTransfer(tx, id)
+		if err != nil {
+			return err
+		}
+		if transfer.Status != models.TRANSFER_SHIPPED && transfer.Status != models.TRANSFER_PARTIALLY_RECEIVED {
+			return errors.New("transfer is not in transit")
+		}
+		if transfer.TransitWarehouseID == nil {
+			return errors.New("transfer has no transit warehouse")
+		}
+		items := map[string]*models.StockTransferItemModel{}
+		for i := range transfer.Items {
+			items[transfer.Items[i].ID] = &transfer.Items[i]
+		}
+		for i, v := range receipt.Items {
+			item, ok := items[v.TransferItemID]
+			if !ok {
+				return fmt.Errorf("item %s is not on the transfer", v.TransferItemID)
+			}
+			if v.Quantity < 0 || v.DiscrepancyQuantity < 0 {
+				return errors.New("quantities must not be negative")
+			}
+			receipt.Items[i].BaseQuantity = v.Quantity * item.UnitValue
+			receipt.Items[i].BaseDiscrepancy = v.DiscrepancyQuantity * item.UnitValue
+			item.ReceivedQuantity += receipt.Items[i].BaseQuantity
+			item.DiscrepancyQuantity += receipt.Items[i].BaseDiscrepancy
+			if item.InTransitQuantity() < -quantityEpsilon {
+				return fmt.Errorf("more than in transit received for %s", item.Description)
+			}
+		}
+		source, destination, err := s.warehouses(transfer)
+		if err != nil {
+			return err
+		}
+		receipt.TransferID = transfer.ID
+
+		if err := period.Check(tx, transfer.CompanyID, "inventory", receipt.Date); err != nil {
+			return err
+		}
+		s.stockMovementService.SetDB(tx)
+		defer s.stockMovementService.SetDB(s.db)
+
+		var receivedValue, lostValue money.Amount
+		for _, v := range receipt.Items {
+			item := items[v.TransferItemID]
+			if v.BaseQuantity > quantityEpsilon {
+				value, err := s.issueTransit(tx, transfer, item, receipt.Date, v.BaseQuantity, destination, "")
+				if err != nil {
+					return err
+				}
+				receivedValue = receivedValue.Add(value)
+			}
+			if v.BaseDiscrepancy > quantityEpsilon {
+				value, err := s.issueTransit(tx, transfer, item, receipt.Date, v.BaseDiscrepancy, nil, v.DiscrepancyReason)
+				if err != nil {
+					return err
+				}
+				lostValue = lostValue.Add(value)
+			}
+		}
+
+		if err := tx.Create(receipt).Error; err != nil {
+			return err
+		}
+		inTransit := false
+		for _, item := range transfer.Items {
+			err := tx.Model(&models.StockTransferItemModel{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+				"received_quantity":    utils.AmountRound(item.ReceivedQuantity, 6),
+				"discrepancy_quantity": utils.AmountRound(item.DiscrepancyQuantity, 6),
+			}).Error
+			if err != nil {
+				return err
+			}
+			if item.InTransitQuantity() > quantityEpsilon {
+				inTransit = true
+			}
+		}
+
+		// Within one branch the goods in transit stay in the inventory account;
+		// between branches they are in the inventory in transit account.
+		crossBranch := !sameBranch(source, destination)
+		if crossBranch && !receivedValue.IsZero() {
+			inventoryAccount, transitAccount, err := s.transitAccounts(transfer.CompanyID)
+			if err != nil {
+				return err
+			}
+			err = s.postJournal(tx, transfer, receipt.Date, userID,
+				journalSide{AccountID: inventoryAccount, BranchID: destination.BranchID},
+				journalSide{AccountID: transitAccount, BranchID: source.BranchID},
+				receivedValue.Float64(),
+				"Penerimaan Transfer Persediaan "+transfer.TransferNumber,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if !lostValue.IsZero() {
+			creditAccount, err := s.inventoryAccount(transfer.CompanyID)
+			if err != nil {
+				return err
+			}
+			if crossBranch {
+				_, creditAccount, err = s.transitAccounts(transfer.CompanyID)
+				if err != nil {
+					return err
+				}
+			}
+			var lossAccount models.AccountModel
+			err = s.db.Where("is_stock_opname_account = ? and company_id = ? and type = ?", true, transfer.CompanyID, models.EXPENSE).First(&lossAccount).Error
+			if err != nil {
+				return errors.New("stock opname expense account not found")
+			}
+			err = s.postJournal(tx, transfer, receipt.Date, userID,
+				journalSide{AccountID: lossAccount.ID, BranchID: source.BranchID},
+				journalSide{AccountID: creditAccount, BranchID: source.BranchID},
+				lostValue.Float64(),
+				"Selisih Transfer Persediaan "+transfer.TransferNumber,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{"status": models.TRANSFER_PARTIALLY_RECEIVED}
+		if !inTransit {
+			updates["status"] = models.TRANSFER_RECEIVED
+			updates["received_at"] = receipt.Date
+		}
+		return tx.Model(&models.StockTransferModel{}).Where("id = ?", transfer.ID).Updates(updates).Error
+	})
+}
+
+// issueTransit takes a base quantity of a transfer item out of the in-transit
+// warehouse, lot by lot in the order the lots were shipped, at the cost they
+// were shipped at. The goods come into the destination warehouse, or leave as an
+// adjustment when destination is nil. It returns the value taken out.
+func (s *StockTransferService) issueTransit(tx *gorm.DB, transfer *models.StockTransferModel, item *models.StockTransferItemModel, date time.Time, quantity float64, destination *models.WarehouseModel, reason string) (money.Amount, error) {
+	var lots []struct {
+		LotID    *string
+		Quantity float64
+		Value    float64
+	}
+	err := tx.Model(&models.StockMovementModel{}).
+		Select("lot_id, SUM(quantity * value) AS quantity, SUM(total_cost) AS value").
+		Where("warehouse_id = ? AND reference_id = ? AND secondary_ref_id = ?", *transfer.TransitWarehouseID, transfer.ID, item.ID).
+		Group("lot_id").
+		Having("SUM(quantity * value) > ?", quantityEpsilon).
+		Order("MIN(created_at)").
+		Scan(&lots).Error
+	if err != nil {
+		return 0, err
+	}
+
+	ref, secRef, itemID := refType, secRefType, item.ID
+	var value money.Amount
+	issue := quantity
+	for _, lot := range lots {
+		if issue <= quantityEpsilon {
+			break
+		}
+		take := math.Min(issue, lot.Quantity)
+		var sourceIDs []string
+		stmt := tx.Model(&models.StockMovementModel{}).
+			Where("warehouse_id = ? AND reference_id = ? AND secondary_ref_id = ? AND quantity > 0", *transfer.TransitWarehouseID, transfer.ID, item.ID)
+		if lot.LotID != nil {
+			stmt = stmt.Where("lot_id = ?", *lot.LotID)
+		} else {
+			stmt = stmt.Where("lot_id IS NULL")
+		}
+		if err := stmt.Pluck("id", &sourceIDs).Error; err != nil {
+			return 0, err
+		}
+
+		out := models.StockMovementModel{
+			Date:             date,
+			ProductID:        item.ProductID,
+			VariantID:        item.VariantID,
+			LotID:            lot.LotID,
+			WarehouseID:      *transfer.TransitWarehouseID,
+			CompanyID:        transfer.CompanyID,
+			Quantity:         -take,
+			Value:            1,
+			UnitCost:         money.FromFloat(lot.Value).Div(lot.Quantity).Float64(),
+			Type:             models.MovementTypeTransfer,
+			ReferenceID:      transfer.ID,
+			ReferenceType:    &ref,
+			SecondaryRefID:   &itemID,
+			SecondaryRefType: &secRef,
+			Description:      fmt.Sprintf("Transfer %s received", transfer.TransferNumber),
+		}
+		if destination == nil {
+			out.Type = models.MovementTypeAdjust
+			out.Description = fmt.Sprintf("Transfer %s discrepancy %s", transfer.TransferNumber, reason)
+		}
+		if err := s.stockMovementService.IssueFromMovements(&out, sourceIDs); err != nil {
+			return 0, err
+		}
+		value = value.Add(money.FromFloat(-out.TotalCost))
+
+		if destination != nil {
+			in := models.StockMovementModel{
+				Date:             date,
+				ProductID:        item.ProductID,
+				VariantID:        item.VariantID,
+				LotID:            lot.LotID,
+				WarehouseID:      destination.ID,
+				BinID:            item.DestinationBinID,
+				CompanyID:        transfer.CompanyID,
+				Quantity:         take,
+				Value:            1,
+				TotalCost:        -out.TotalCost,
+				Type:             models.MovementTypeTransfer,
+				ReferenceID:      transfer.ID,
+				ReferenceType:    &ref,
+				SecondaryRefID:   &itemID,
+				SecondaryRefType: &secRef,
+				Description:      fmt.Sprintf("Transfer %s received", transfer.TransferNumber),
+			}
+			if err := s.stockMovementService.RecordMovement(&in); err != nil {
+				return 0, err
+			}
+		}
+		issue -= take
+	}
+	if issue > quantityEpsilon {
+		return 0, fmt.Errorf("only %v of %s left in transit", utils.AmountRound(quantity-issue, 6), item.Description)
+	}
+	return value, nil
+}
+
+// journalSide is the account and branch of one side of a journal entry.
+type journalSide struct {
+	AccountID string
+	BranchID  *string
+}
+
+// postJournal posts a balanced journal entry of a transfer, debiting one side and
+// crediting the other with the amount.
+func (s *StockTransferService) postJournal(tx *gorm.DB, transfer *models.StockTransferModel, date time.Time, userID string, debit, credit journalSide, amount float64, description string) error {
+	code := utils.RandString(8, false)
+	debitID := utils.Uuid()
+	creditID := utils.Uuid()
+	debitTrans := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: debitID},
+		Code:                        code,
+		Date:                        date,
+		AccountID:                   &debit.AccountID,
+		Description:                 description,
+		Notes:                       transfer.Notes,
+		TransactionRefID:            &creditID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &transfer.ID,
+		TransactionSecondaryRefType: refType,
+		CompanyID:                   transfer.CompanyID,
+		Debit:                       amount,
+		Amount:                      amount,
+		UserID:                      &userID,
+	}
+	debitTrans.BranchID = debit.BranchID
+	if err := tx.Create(&debitTrans).Error; err != nil {
+		return err
+	}
+	creditTrans := models.TransactionModel{
+		BaseModel:                   shared.BaseModel{ID: creditID},
+		Code:                        code,
+		Date:                        date,
+		AccountID:                   &credit.AccountID,
+		Description:                 description,
+		Notes:                       transfer.Notes,
+		TransactionRefID:            &debitID,
+		TransactionRefType:          "transaction",
+		TransactionSecondaryRefID:   &transfer.ID,
+		TransactionSecondaryRefType: refType,
+		CompanyID:                   transfer.CompanyID,
+		Credit:                      amount,
+		Amount:                      amount,
+		UserID:                      &userID,
+	}
+	creditTrans.BranchID = credit.BranchID
+	return tx.Create(&creditTrans).Error
+}
+
+// transitAccounts returns the inventory account and the inventory in transit
+// account of a company.
+func (s *StockTransferService) transitAccounts(companyID *string) (string, string, error) {
+	var inventoryAccount, transitAccount models.AccountModel
+	if err := s.db.Where("is_inventory_account = ? and company_id = ?", true, companyID).First(&inventoryAccount).Error; err != nil {
+		return "", "", errors.New("inventory account not found")
+	}
+	if err := s.db.Where("is_inventory_transit_account = ? and company_id = ?", true, companyID).First(&transitAccount).Error; err != nil {
+		return "", "", errors.New("inventory in transit account not found")
+	}
+	return inventoryAccount.ID, transitAccount.ID, nil
+}
+
+// inventoryAccount returns the inventory account of a company.
+func (s *StockTransferService) inventoryAccount(companyID *string) (string, error) {
+	var inventoryAccount models.AccountModel
+	if err := s.db.Where("is_inventory_account = ? and company_id = ?", true, companyID).First(&inventoryAccount).Error; err != nil {
+		return "", errors.New("inventory account not found")
+	}
+	return inventoryAccount.ID, nil
+}
+
+// transitWarehouse returns the in-transit warehouse of a company, creating it on
+// first use.
+func (s *StockTransferService) transitWarehouse(tx *gorm.DB, companyID *string) (*models.WarehouseModel, error) {
+	var warehouse models.WarehouseModel
+	stmt := tx.Where("is_transit = ?", true)
+	if companyID != nil {
+		stmt = stmt.Where("company_id = ?", *companyID)
+	} else {
+		stmt = stmt.Where("company_id IS NULL")
+	}
+	err := stmt.First(&warehouse).Error
+	if err == nil {
+		return &warehouse, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	warehouse = models.WarehouseModel{
+		BaseModel:   shared.BaseModel{ID: utils.Uuid()},
+		Name:        "In Transit",
+		Code:        "TRANSIT",
+		Description: "Stok dalam perjalanan antar gudang",
+		CompanyID:   companyID,
+		IsTransit:   true,
+	}
+	if err := tx.Create(&warehouse).Error; err != nil {
+		return nil, err
+	}
+	return &warehouse, nil
+}
+
+// warehouses returns the source and destination warehouses of a transfer.
+func (s *StockTransferService) warehouses(transfer *models.StockTransferModel) (*models.WarehouseModel, *models.WarehouseModel, error) {
+	var source, destination models.WarehouseModel
+	if err := s.db.First(&source, "id = ?", transfer.SourceWarehouseID).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := s.db.First(&destination, "id = ?", transfer.DestinationWarehouseID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &source, &destination, nil
+}
+
+// checkWarehouses checks that a transfer is between two different warehouses of
+// its company, neither of them an in-transit warehouse.
+func (s *StockTransferService) checkWarehouses(transfer *models.StockTransferModel) error {
+	if transfer.SourceWarehouseID == "" || transfer.DestinationWarehouseID == "" {
+		return errors.New("source and destination warehouses are required")
+	}
+	if transfer.SourceWarehouseID == transfer.DestinationWarehouseID {
+		return errors.New("source and destination warehouses are the same")
+	}
+	source, destination, err := s.warehouses(transfer)
+	if err != nil {
+		return err
+	}
+	for _, v := range []*models.WarehouseModel{source, destination} {
+		if v.IsTransit {
+			return fmt.Errorf("%s is an in-transit warehouse", v.Name)
+		}
+		if transfer.CompanyID != nil && v.CompanyID != nil && *v.CompanyID != *transfer.CompanyID {
+			return fmt.Errorf("%s belongs to another company", v.Name)
+		}
+	}
+	return nil
+}
+
+// checkBins checks that the bins of an item belong to the warehouses of the
+// transfer.
+func (s *StockTransferService) checkBins(transfer *models.StockTransferModel, item *models.StockTransferItemModel) error {
+	for _, v := range []struct {
+		binID       *string
+		warehouseID string
+	}{
+		{item.SourceBinID, transfer.SourceWarehouseID},
+		{item.DestinationBinID, transfer.DestinationWarehouseID},
+	} {
+		if v.binID == nil {
+			continue
+		}
+		var bin models.WarehouseBinModel
+		if err := s.db.Select("id", "warehouse_id").First(&bin, "id = ?", *v.binID).Error; err != nil {
+			return err
+		}
+		if bin.WarehouseID != v.warehouseID {
+			return errors.New("bin does not belong to the warehouse")
+		}
+	}
+	return nil
+}
+
+// checkShipment checks that the shipment a transfer is linked to exists.
+func (s *StockTransferService) checkShipment(shipmentID *string) error {
+	if shipmentID == nil {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&models.ShipmentModel{}).Where("id = ?", *shipmentID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("shipment not found")
+	}
+	return nil
+}
+
+// lockTransfer reads a transfer and its items within a transaction, locking the
+// transfer row until the transaction ends.
+func lockTransfer(tx *gorm.DB, id string) (*models.StockTransferModel, error) {
+	var transfer models.StockTransferModel
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&transfer, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("transfer_id = ?", id).Find(&transfer.Items).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// getDraft returns a transfer that is still a draft.
+func (s *StockTransferService) getDraft(id string) (*models.StockTransferModel, error) {
+	var transfer models.StockTransferModel
+	if err := s.db.First(&transfer, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if transfer.Status != models.TRANSFER_DRAFT {
+		return nil, errors.New("transfer is not a draft")
+	}
+	return &transfer, nil
+}
+
+// setBaseUnit sets the conversion value of the unit of an item and its quantity
+// in the base unit of the product.
+func (s *StockTransferService) setBaseUnit(item *models.StockTransferItemModel) error {
+	if item.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+	unitValue, err := models.GetProductUnitValue(s.db, item.ProductID, item.UnitID)
+	if err != nil {
+		return err
+	}
+	item.UnitValue = unitValue
+	item.BaseQuantity = item.Quantity * unitValue
+	if item.Description == "" {
+		var product models.ProductModel
+		if err := s.db.Select("id", "name").First(&product, "id = ?", item.ProductID).Error; err != nil {
+			return err
+		}
+		item.Description = product.Name
+	}
+	return nil
+}
+
+// sameBranch reports whether two warehouses belong to the same branch, warehouses
+// without a branch belonging to the same one.
+func sameBranch(a, b *models.WarehouseModel) bool {
+	if a.BranchID == nil || b.BranchID == nil {
+		return a.BranchID == nil && b.BranchID == nil
+	}
+	return *a.BranchID == *b.BranchID
+}
@@ -1,6 +1,7 @@
 package warehouse
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
@@ -45,7 +46,7 @@ func NewWarehouseService(db *gorm.DB, ctx *context.ERPContext) *WarehouseService
 //
 //	an error if the migration failed
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.WarehouseModel{})
+	return db.AutoMigrate(&models.WarehouseModel{}, &models.WarehouseBinModel{})
 }
 
 // CreateWarehouse adds a new warehouse record to the database.
@@ -119,8 +120,10 @@ func (s *WarehouseService) GetWarehouseByCode(code string) (*models.WarehouseMod
 // It takes an HTTP request and a search query string as input. The search query
 // is applied to the warehouse name, code and description fields. If the request
 // contains a company ID header, the method also filters the result by the
-// company ID. The function utilizes pagination to manage the result set and
-// applies any necessary request modifications using the utils.FixRequest utility.
+// company ID. The in-transit warehouses used by stock transfers are left out
+// unless the is_transit query parameter is "true", which lists only them. The
+// function utilizes pagination to manage the result set and applies any
+// necessary request modifications using the utils.FixRequest utility.
 //
 // The function returns a paginated page of WarehouseModel and an error if the
 // operation fails.
@@ -138,9 +141,55 @@ func (s *WarehouseService) GetWarehouses(request http.Request, search string) (p
 	if request.Header.Get("ID-Company") != "" {
 		stmt = stmt.Where("company_id = ?", request.Header.Get("ID-Company"))
 	}
+	// Gudang transit hanya ditampilkan jika diminta
+	stmt = stmt.Where("is_transit = ?", request.URL.Query().Get("is_transit") == "true")
 	stmt = stmt.Model(&models.WarehouseModel{})
 	utils.FixRequest(&request)
 	page := pg.With(stmt).Request(request).Response(&[]models.WarehouseModel{})
 	page.Page = page.Page + 1
 	return page, nil
 }
+
+// CreateBin adds a bin to a warehouse. Bin codes are unique within a warehouse.
+func (s *WarehouseService) CreateBin(data *models.WarehouseBinModel) error {
+	var count int64
+	if err := s.db.Model(&models.WarehouseBinModel{}).Where("warehouse_id = ? AND code = ?", data.WarehouseID, data.Code).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("bin code already exists in this warehouse")
+	}
+	return s.db.Create(data).Error
+}
+
+// UpdateBin updates the bin with the given ID.
+func (s *WarehouseService) UpdateBin(id string, data *models.WarehouseBinModel) error {
+	return s.db.Where("id = ?", id).Updates(data).Error
+}
+
+// DeleteBin deletes the bin with the given ID. A bin that still holds stock
+// cannot be deleted.
+func (s *WarehouseService) DeleteBin(id string) error {
+	var quantity float64
+	if err := s.db.Model(&models.StockMovementModel{}).Where("bin_id = ?", id).Select("COALESCE(SUM(quantity * value), 0)").Scan(&quantity).Error; err != nil {
+		return err
+	}
+	if quantity != 0 {
+		return errors.New("bin still holds stock")
+	}
+	return s.db.Where("id = ?", id).Delete(&models.WarehouseBinModel{}).Error
+}
+
+// GetBinByID retrieves a bin by its ID.
+func (s *WarehouseService) GetBinByID(id string) (*models.WarehouseBinModel, error) {
+	var bin models.WarehouseBinModel
+	err := s.db.Where("id = ?", id).First(&bin).Error
+	return &bin, err
+}
+
+// GetBins retrieves the bins of a warehouse in picking route order.
+func (s *WarehouseService) GetBins(warehouseID string) ([]models.WarehouseBinModel, error) {
+	var bins []models.WarehouseBinModel
+	err := s.db.Where("warehouse_id = ?", warehouseID).Order("route_sequence, code").Find(&bins).Error
+	return bins, err
+}
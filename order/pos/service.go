@@ -15,6 +15,7 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance"
 	"github.com/AMETORY/ametory-erp-modules/inventory"
+	"github.com/AMETORY/ametory-erp-modules/inventory/reservation"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/shared/objects"
 	"github.com/AMETORY/ametory-erp-modules/utils"
@@ -183,7 +184,14 @@ func (s *POSService) CreatePosFromCart(cart models.CartModel, paymentID *string,
 		TotalDiscount:          totalDiscount,
 	}
 
-	if err := s.db.Create(&pos).Error; err != nil {
+	// The soft reservations of the cart become hard reservations of the order.
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&pos).Error; err != nil {
+			return err
+		}
+		return s.reservePos(tx, &pos, merchant, "cart", cart.ID)
+	})
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -201,6 +209,46 @@ func (s *POSService) CreatePosFromCart(cart models.CartModel, paymentID *string,
 	return &pos, notifUserData, nil
 }
 
+// reservePos releases the reservations of the document a POS order was made from
+// and hard reserves the items of the order in the default warehouse of the
+// merchant until its due date. Nothing is reserved when there is no inventory
+// service or the merchant has no default warehouse.
+func (s *POSService) reservePos(tx *gorm.DB, pos *models.POSModel, merchant models.MerchantModel, fromType, fromID string) error {
+	if s.inventoryService == nil {
+		return nil
+	}
+	reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+	if err := reservationService.Release(fromType, fromID); err != nil {
+		return err
+	}
+	if merchant.DefaultWarehouseID == nil {
+		return nil
+	}
+	for _, v := range pos.Items {
+		if v.ProductID == nil || v.Quantity <= 0 {
+			continue
+		}
+		itemID := v.ID
+		err := reservationService.Reserve(&models.StockReservationModel{
+			CompanyID:      merchant.CompanyID,
+			MerchantID:     &merchant.ID,
+			ProductID:      *v.ProductID,
+			VariantID:      v.VariantID,
+			WarehouseID:    *merchant.DefaultWarehouseID,
+			Quantity:       v.Quantity,
+			Type:           models.RESERVATION_HARD,
+			ReferenceID:    pos.ID,
+			ReferenceType:  "pos",
+			SecondaryRefID: &itemID,
+			ExpiresAt:      &pos.DueDate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // UpdateTransaction updates transaction data in the database based on the given POS data and merchant company.
 //
 // This function will create a new transaction if the transaction does not exist, or update the existing transaction if it does.
@@ -411,7 +459,18 @@ func (s *POSService) CreatePosFromOffer(offer models.OfferModel, paymentID, sale
 		OrderType:              orderType,
 		TotalBeforeDisc:        totalDiscount,
 	}
-	if err := s.db.Create(&pos).Error; err != nil {
+	// The reservations made when the offer was taken move to the order.
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&pos).Error; err != nil {
+			return err
+		}
+		if s.inventoryService == nil {
+			return nil
+		}
+		reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+		return reservationService.Transfer("offer", offer.ID, "pos", pos.ID, &pos.DueDate)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -434,6 +493,7 @@ func (s *POSService) CreatePosFromOffer(offer models.OfferModel, paymentID, sale
 // The function will also create a new stock movement for each item in the transaction. The stock movement will be created with type "out" and quantity equal to the quantity of the item in the transaction.
 //
 // If the transaction has a sale account ID and an asset account ID, the function will create a new transaction in the journal with debit and credit accounts set to the sale account ID and the asset account ID respectively.
+// When the company has COGS and inventory accounts, the cost of goods sold is posted at the cost the stock movements take out of the warehouse.
 //
 // The function will return the created POS model if the transaction is successful, or an error if there is a problem during the transaction.
 func (s *POSService) CreatePOSTransaction(merchantID *string, contactID *string, warehouseID string, items []models.POSSalesItemModel, description string) (*models.POSModel, error) {
@@ -466,6 +526,14 @@ func (s *POSService) CreatePOSTransaction(merchantID *string, contactID *string,
 	now := time.Now()
 
 	err := s.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		// Stok dan jurnal ditulis di dalam transaksi yang sama
+		invSrv.StockMovementService.SetDB(tx)
+		defer invSrv.StockMovementService.SetDB(s.ctx.DB)
+		if s.financeService.TransactionService != nil {
+			s.financeService.TransactionService.SetDB(tx)
+			defer s.financeService.TransactionService.SetDB(s.ctx.DB)
+		}
+
 		// Simpan transaksi POS ke database
 		if err := tx.Create(&pos).Error; err != nil {
 			tx.Rollback()
@@ -473,11 +541,13 @@ func (s *POSService) CreatePOSTransaction(merchantID *string, contactID *string,
 		}
 
 		// Kurangi stok untuk setiap item
+		movements := []models.StockMovementModel{}
 		for _, item := range items {
-			_, err := invSrv.StockMovementService.AddMovement(now, *item.ProductID, warehouseID, item.VariantID, merchantID, nil, nil, -item.Quantity, models.MovementTypeOut, pos.ID, description)
+			recorded, err := invSrv.StockMovementService.AddMovements(now, *item.ProductID, warehouseID, item.VariantID, merchantID, nil, nil, -item.Quantity, models.MovementTypeOut, pos.ID, description)
 			if err != nil {
 				return err
 			}
+			movements = append(movements, recorded...)
 		}
 
 		// Update status transaksi menjadi "completed"
@@ -517,6 +587,14 @@ func (s *POSService) CreatePOSTransaction(merchantID *string, contactID *string,
 					return err
 				}
 			}
+			companyID := pos.CompanyID
+			if companyID == nil {
+				companyID = merchant.CompanyID
+			}
+			if err := s.postCogs(tx, &pos, companyID, movements, now); err != nil {
+				tx.Rollback()
+				return err
+			}
 		}
 
 		if err := tx.Commit().Error; err != nil {
@@ -809,7 +887,8 @@ func (s *POSService) GetPushTokenFromID(id string) ([]string, error) {
 	return tokens, nil
 }
 
-// UpdatePickedByID updates the stock status of a POS transaction to "IN_DELIVERY" and records stock movements.
+// UpdatePickedByID updates the stock status of a POS transaction to "IN_DELIVERY" and records stock movements
+// and their cost of goods sold. The stock reserved for the transaction is fulfilled.
 //
 // It takes a transaction ID and returns an error if the operation fails.
 func (s *POSService) UpdatePickedByID(id string) error {
@@ -826,34 +905,12 @@ func (s *POSService) UpdatePickedByID(id string) error {
 		return err
 	}
 
-	var stockMovement models.StockMovementModel
-	err = s.db.First(&stockMovement, "reference_id = ?", id).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		for _, v := range pos.Items {
-			s.inventoryService.StockMovementService.AddMovement(
-				time.Now(),
-				*v.ProductID,
-				*pos.Merchant.DefaultWarehouseID,
-				v.VariantID,
-				pos.MerchantID,
-				nil,
-				nil,
-				-v.Quantity,
-				models.MovementTypeSale,
-				pos.ID,
-				fmt.Sprintf("Sales #%s", pos.SalesNumber))
-		}
-	}
-
 	pos.StockStatus = "IN_DELIVERY"
-	if err := s.db.Omit(clause.Associations).Save(&pos).Error; err != nil {
-		return err
-	}
-
-	return nil
+	return s.issueStock(&pos)
 }
 
-// UpdateDeliveredByID updates the stock status of a POS transaction to "DELIVERED" and records stock movements.
+// UpdateDeliveredByID updates the stock status of a POS transaction to "DELIVERED" and records stock movements
+// and their cost of goods sold. The stock reserved for the transaction is fulfilled.
 //
 // It takes a transaction ID and returns an error if the operation fails.
 func (s *POSService) UpdateDeliveredByID(id string) error {
@@ -870,30 +927,130 @@ func (s *POSService) UpdateDeliveredByID(id string) error {
 		return err
 	}
 
-	var stockMovement models.StockMovementModel
-	err = s.db.First(&stockMovement, "reference_id = ?", id).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		for _, v := range pos.Items {
-			s.inventoryService.StockMovementService.AddMovement(
-				time.Now(),
-				*v.ProductID,
-				*pos.Merchant.DefaultWarehouseID,
-				v.VariantID,
-				pos.MerchantID,
-				nil,
-				nil,
-				-v.Quantity,
-				models.MovementTypeSale,
-				pos.ID,
-				fmt.Sprintf("Sales #%s", pos.SalesNumber))
+	pos.StockStatus = "DELIVERED"
+	return s.issueStock(&pos)
+}
+
+// issueStock saves the stock status of a POS transaction and, the first time its
+// stock leaves, records the stock movements of its items, posts their cost of goods
+// sold and fulfills its reservations. It all runs in one transaction, so a failure
+// leaves no movements behind and the next call records them again.
+func (s *POSService) issueStock(pos *models.POSModel) error {
+	return s.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		s.inventoryService.StockMovementService.SetDB(tx)
+		defer s.inventoryService.StockMovementService.SetDB(s.ctx.DB)
+		if s.financeService.TransactionService != nil {
+			s.financeService.TransactionService.SetDB(tx)
+			defer s.financeService.TransactionService.SetDB(s.ctx.DB)
 		}
-	}
 
-	pos.StockStatus = "DELIVERED"
-	if err := s.db.Omit(clause.Associations).Save(&pos).Error; err != nil {
-		return err
-	}
+		var stockMovement models.StockMovementModel
+		err := tx.First(&stockMovement, "reference_id = ?", pos.ID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if pos.Merchant == nil || pos.Merchant.DefaultWarehouseID == nil {
+				return errors.New("merchant has no default warehouse")
+			}
+			now := time.Now()
+			movements := []models.StockMovementModel{}
+			for _, v := range pos.Items {
+				recorded, err := s.inventoryService.StockMovementService.AddMovements(
+					now,
+					*v.ProductID,
+					*pos.Merchant.DefaultWarehouseID,
+					v.VariantID,
+					pos.MerchantID,
+					nil,
+					nil,
+					-v.Quantity,
+					models.MovementTypeSale,
+					pos.ID,
+					fmt.Sprintf("Sales #%s", pos.SalesNumber))
+				if err != nil {
+					return err
+				}
+				movements = append(movements, recorded...)
+			}
+			companyID := pos.CompanyID
+			if companyID == nil {
+				companyID = pos.Merchant.CompanyID
+			}
+			if err := s.postCogs(tx, pos, companyID, movements, now); err != nil {
+				return err
+			}
+			reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+			if err := reservationService.Fulfill("pos", pos.ID); err != nil {
+				return err
+			}
+		}
 
+		return tx.Omit(clause.Associations).Save(pos).Error
+	})
+}
+
+// postCogs posts the cost of goods sold of the stock movements of a POS sale at
+// the cost the stock left the warehouse at, against the inventory account. It
+// does nothing when there is no transaction service, and fails when there is a
+// cost to post but the company has no COGS or inventory account.
+func (s *POSService) postCogs(tx *gorm.DB, pos *models.POSModel, companyID *string, movements []models.StockMovementModel, date time.Time) error {
+	if s.financeService == nil || s.financeService.TransactionService == nil || companyID == nil {
+		return nil
+	}
+	hasCost := false
+	for _, v := range movements {
+		if v.TotalCost != 0 {
+			hasCost = true
+			break
+		}
+	}
+	if !hasCost {
+		return nil
+	}
+	var cogsAccount models.AccountModel
+	if err := tx.Where("is_cogs_account = ? and company_id = ?", true, *companyID).First(&cogsAccount).Error; err != nil {
+		return errors.New("cogs account not found")
+	}
+	var inventoryAccount models.AccountModel
+	if err := tx.Where("is_inventory_account = ? and company_id = ?", true, *companyID).First(&inventoryAccount).Error; err != nil {
+		return errors.New("inventory account not found")
+	}
+	for _, v := range movements {
+		cogs := -v.TotalCost
+		if cogs == 0 {
+			continue
+		}
+		movementID := v.ID
+		err := s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
+			Date:                        date,
+			AccountID:                   &inventoryAccount.ID,
+			Description:                 "Persediaan " + pos.SalesNumber,
+			TransactionRefID:            &movementID,
+			TransactionRefType:          "stock_movement",
+			TransactionSecondaryRefID:   &pos.ID,
+			TransactionSecondaryRefType: "pos_sales",
+			CompanyID:                   companyID,
+			Credit:                      cogs,
+		}, cogs)
+		if err != nil {
+			return err
+		}
+		err = s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
+			Date:                        date,
+			AccountID:                   &cogsAccount.ID,
+			Description:                 "HPP " + pos.SalesNumber,
+			TransactionRefID:            &movementID,
+			TransactionRefType:          "stock_movement",
+			TransactionSecondaryRefID:   &pos.ID,
+			TransactionSecondaryRefType: "pos_sales",
+			CompanyID:                   companyID,
+			Debit:                       cogs,
+		}, cogs)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -4,16 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/context"
 	"github.com/AMETORY/ametory-erp-modules/finance"
+	"github.com/AMETORY/ametory-erp-modules/finance/period"
 	"github.com/AMETORY/ametory-erp-modules/inventory"
+	"github.com/AMETORY/ametory-erp-modules/inventory/reservation"
+	stockmovement "github.com/AMETORY/ametory-erp-modules/inventory/stock_movement"
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/google/uuid"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
@@ -69,6 +75,7 @@ func (s *SalesService) CreateSales(data *models.SalesModel) error {
 						TransactionRefID:   &data.ID,
 						TransactionRefType: "sales",
 						CompanyID:          companyID,
+						AnalyticDimensions: data.AnalyticDimensions,
 					}, v.Total)
 				}
 				if v.AssetAccountID != nil {
@@ -80,6 +87,7 @@ func (s *SalesService) CreateSales(data *models.SalesModel) error {
 						TransactionRefID:   &data.ID,
 						TransactionRefType: "sales",
 						CompanyID:          companyID,
+						AnalyticDimensions: data.AnalyticDimensions,
 					}, v.Total)
 					acc, err := s.financeService.AccountService.GetAccountByID(*v.AssetAccountID)
 					if err != nil {
@@ -91,6 +99,9 @@ func (s *SalesService) CreateSales(data *models.SalesModel) error {
 				}
 
 			}
+			if err := s.financeService.ConsolidationService.TagDocument(tx, companyID, data.ContactID, data.ID); err != nil {
+				return err
+			}
 			if paid > 0 {
 				data.Paid = paid
 				if err := tx.Save(data).Error; err != nil {
@@ -167,6 +178,7 @@ func (s *SalesService) CreatePayment(salesID string, date time.Time, amount floa
 			TransactionRefID:   &data.ID,
 			TransactionRefType: "sales",
 			CompanyID:          companyID,
+			AnalyticDimensions: data.AnalyticDimensions,
 		}, amount); err != nil {
 			return err
 		}
@@ -179,11 +191,16 @@ func (s *SalesService) CreatePayment(salesID string, date time.Time, amount floa
 				TransactionRefID:   &data.ID,
 				TransactionRefType: "sales",
 				CompanyID:          companyID,
+				AnalyticDimensions: data.AnalyticDimensions,
 			}, -amount); err != nil {
 				return err
 			}
 		}
 
+		if err := s.financeService.ConsolidationService.TagDocument(tx, companyID, data.ContactID, data.ID); err != nil {
+			return err
+		}
+
 		data.Paid += amount
 		if err := tx.Save(data).Error; err != nil {
 			return err
@@ -223,15 +240,88 @@ func (s *SalesService) DeleteSales(id string) error {
 		if err != nil {
 			return err
 		}
+		var movementIDs []string
+		err = tx.Model(&models.StockMovementModel{}).Where("reference_id = ? or secondary_ref_id = ?", id, id).Pluck("id", &movementIDs).Error
+		if err != nil {
+			return err
+		}
+		err = stockmovement.ReverseCosts(tx, movementIDs)
+		if err != nil {
+			return err
+		}
 		err = tx.Where("reference_id = ? or secondary_ref_id = ?", id, id).Delete(&models.StockMovementModel{}).Error
 		if err != nil {
 			return err
 		}
+		reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+		err = reservationService.Release("sales", id)
+		if err != nil {
+			return err
+		}
 		return tx.Where("id = ?", id).Delete(&models.SalesModel{}).Error
 	})
 
 }
 
+// CancelSales cancels a sales document that has not been posted and releases the
+// stock reserved for it.
+func (s *SalesService) CancelSales(id string) error {
+	var sales models.SalesModel
+	if err := s.db.Where("id = ?", id).First(&sales).Error; err != nil {
+		return err
+	}
+	switch sales.Status {
+	case "POSTED":
+		return errors.New("posted sales cannot be cancelled")
+	case "CANCELLED":
+		return errors.New("sales already cancelled")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&sales).Update("status", "CANCELLED").Error; err != nil {
+			return err
+		}
+		reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+		return reservationService.Release("sales", sales.ID)
+	})
+}
+
+// reserveSalesOrder hard reserves the items of a confirmed sales order in their
+// warehouses until its due date, replacing the reservations of an earlier
+// confirmation.
+func (s *SalesService) reserveSalesOrder(tx *gorm.DB, data *models.SalesModel) error {
+	reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+	if err := reservationService.Release("sales", data.ID); err != nil {
+		return err
+	}
+	for _, v := range data.Items {
+		if v.ProductID == nil || v.WarehouseID == nil {
+			continue
+		}
+		itemID := v.ID
+		unitValue := v.UnitValue
+		if unitValue == 0 {
+			unitValue = 1
+		}
+		err := reservationService.Reserve(&models.StockReservationModel{
+			CompanyID:      data.CompanyID,
+			ProductID:      *v.ProductID,
+			VariantID:      v.VariantID,
+			WarehouseID:    *v.WarehouseID,
+			Quantity:       v.Quantity * unitValue,
+			Type:           models.RESERVATION_HARD,
+			ReferenceID:    data.ID,
+			ReferenceType:  "sales",
+			SecondaryRefID: &itemID,
+			ExpiresAt:      data.DueDate,
+			Notes:          data.SalesNumber,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetSalesByID retrieves a sales order from the database by ID.
 //
 // The function returns an error if the sales order is not found.
@@ -358,11 +448,28 @@ func (s *SalesService) UpdateStock(salesID, warehouseID string, description stri
 		return errors.New("purchase order already processed")
 	}
 	return s.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		invSrv.StockMovementService.SetDB(tx)
+		defer invSrv.StockMovementService.SetDB(s.ctx.DB)
 		for _, v := range sales.Items {
 			if v.ProductID == nil || v.WarehouseID == nil {
 				continue
 			}
-			_, err := invSrv.StockMovementService.AddMovement(sales.SalesDate, *v.ProductID, *v.WarehouseID, v.VariantID, nil, nil, nil, -v.Quantity, models.MovementTypeIn, sales.ID, description)
+			// The quantity is converted to the base unit with the unit value
+			// of the item, like PostInvoice does.
+			_, err := invSrv.StockMovementService.RecordTrackedMovement(&models.StockMovementModel{
+				Date:        sales.SalesDate,
+				ProductID:   *v.ProductID,
+				VariantID:   v.VariantID,
+				WarehouseID: *v.WarehouseID,
+				BinID:       v.BinID,
+				CompanyID:   sales.CompanyID,
+				Quantity:    -v.Quantity,
+				Value:       v.UnitValue,
+				Type:        models.MovementTypeIn,
+				ReferenceID: sales.ID,
+				UnitID:      v.UnitID,
+				Description: description,
+			}, v.LotTracking)
 			if err != nil {
 				tx.Rollback()
 				return err
@@ -454,6 +561,9 @@ func (s *SalesService) CreateSalesFromOrderRequest(orderRequest *models.OrderReq
 // The function first loads the product associated with the item, and sets the item's base price
 // to the product's price. If the product has a tax set, the item is also set to have the same tax.
 //
+// The unit of the item is converted to the base unit of the product; an item in a unit that is
+// not set up for the product is rejected.
+//
 // The function then creates the item in the database, and returns an error if the operation fails.
 //
 // Finally, the function calls the UpdateTotal function to recalculate the total of the sales document.
@@ -470,6 +580,9 @@ func (s *SalesService) AddItem(sales *models.SalesModel, item *models.SalesItemM
 			item.Tax = product.Tax
 		}
 	}
+	if err := s.setBaseUnit(item); err != nil {
+		return err
+	}
 
 	err := s.db.Create(item).Error
 	if err != nil {
@@ -495,6 +608,7 @@ func (s *SalesService) GetItems(id string) ([]models.SalesItemModel, error) {
 		Preload("Unit").
 		Preload("Variant").
 		Preload("Warehouse").
+		Preload("Bin").
 		Preload("SaleAccount").
 		Preload("AssetAccount").
 		Preload("Tax").
@@ -513,6 +627,66 @@ func (s *SalesService) GetItems(id string) ([]models.SalesItemModel, error) {
 	return items, nil
 }
 
+// GetPickingList returns the picking list of the items of a sales document, per
+// warehouse, sorted by the picking route of the warehouse bins.
+//
+// Items with a bin are picked from that bin, the others from the bins that hold
+// the product (see StockMovementService.BuildPickingList). Quantities are in the
+// base unit of the product; the ReferenceID of a line is the ID of its sales item.
+func (s *SalesService) GetPickingList(salesID string) (map[string][]models.PickingLine, error) {
+	items := []models.SalesItemModel{}
+	if err := s.db.Preload("Product").Preload("Bin").Where("sales_id = ?", salesID).Order("created_at ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	lists := map[string][]models.PickingLine{}
+	requests := map[string][]models.PickingRequest{}
+	for _, v := range items {
+		if v.ProductID == nil || v.WarehouseID == nil {
+			continue
+		}
+		quantity := v.Quantity * v.UnitValue
+		if v.BinID != nil && v.Bin != nil {
+			lists[*v.WarehouseID] = append(lists[*v.WarehouseID], models.PickingLine{
+				ReferenceID:   v.ID,
+				RouteSequence: v.Bin.RouteSequence,
+				BinID:         v.BinID,
+				BinCode:       v.Bin.Code,
+				ProductID:     *v.ProductID,
+				ProductName:   v.Product.Name,
+				VariantID:     v.VariantID,
+				LotNumber:     v.LotNumber,
+				ExpiryDate:    v.ExpiryDate,
+				Quantity:      quantity,
+			})
+			continue
+		}
+		requests[*v.WarehouseID] = append(requests[*v.WarehouseID], models.PickingRequest{
+			ReferenceID: v.ID,
+			ProductID:   *v.ProductID,
+			VariantID:   v.VariantID,
+			Quantity:    quantity,
+		})
+	}
+	for warehouseID, v := range requests {
+		lines, err := s.inventoryService.StockMovementService.BuildPickingList(warehouseID, v)
+		if err != nil {
+			return nil, err
+		}
+		lists[warehouseID] = append(lists[warehouseID], lines...)
+	}
+	for warehouseID, lines := range lists {
+		sort.SliceStable(lines, func(i, j int) bool {
+			if lines[i].RouteSequence != lines[j].RouteSequence {
+				return lines[i].RouteSequence < lines[j].RouteSequence
+			}
+			return lines[i].BinCode < lines[j].BinCode
+		})
+		lists[warehouseID] = lines
+	}
+	return lists, nil
+}
+
 // UpdateTotal recalculates the total of a sales document.
 //
 // It takes a sales document as input, and returns an error if the operation fails.
@@ -523,32 +697,85 @@ func (s *SalesService) GetItems(id string) ([]models.SalesItemModel, error) {
 // The function then calculates the total after tax by calling the CalculateTaxes function, and
 // sets the total of the sales document to the calculated total.
 //
+// Amounts are added with exact decimal arithmetic and rounded with the rounding
+// configuration of the company. With PER_DOCUMENT rounding, the item taxes of
+// each tax rate are rounded once on their total and allocated back to the items.
+//
 // Finally, the function updates the sales document in the database, and returns an error if the operation fails.
 func (s *SalesService) UpdateTotal(sales *models.SalesModel) error {
-	s.db.Preload("Items").Model(sales).Find(sales)
-	var totalBeforeTax, totalBeforeDisc, subTotal, itemsTax, totalDisc float64
+	s.db.Preload("Items.Tax").Model(sales).Find(sales)
+	rounding := models.GetCompanyRounding(s.db, sales.CompanyID)
+	if rounding.Mode == money.PER_DOCUMENT {
+		if err := s.allocateItemTaxes(sales.Items, rounding); err != nil {
+			return err
+		}
+	}
+	var totalBeforeTax, totalBeforeDisc, subTotal, itemsTax, totalDisc money.Amount
 	for _, v := range sales.Items {
-		totalBeforeDisc += v.SubtotalBeforeDisc
-		totalBeforeTax += v.SubTotal
-		subTotal += v.SubTotal
-		itemsTax += v.TotalTax
-		totalDisc += v.DiscountAmount
+		totalBeforeDisc = totalBeforeDisc.Add(money.FromFloat(v.SubtotalBeforeDisc))
+		totalBeforeTax = totalBeforeTax.Add(money.FromFloat(v.SubTotal))
+		subTotal = subTotal.Add(money.FromFloat(v.SubTotal))
+		itemsTax = itemsTax.Add(rounding.Line(money.FromFloat(v.TotalTax)))
+		totalDisc = totalDisc.Add(money.FromFloat(v.DiscountAmount))
 	}
-	sales.TotalBeforeTax = totalBeforeTax
-	sales.TotalBeforeDisc = totalBeforeDisc
-	sales.Subtotal = subTotal
+	sales.TotalBeforeTax = rounding.Document(totalBeforeTax).Float64()
+	sales.TotalBeforeDisc = rounding.Document(totalBeforeDisc).Float64()
+	sales.Subtotal = rounding.Document(subTotal).Float64()
 
-	afterTax, salesTaxAmount, taxBreakdown := s.CalculateTaxes(subTotal, sales.IsCompound, sales.Taxes)
+	afterTax, salesTaxAmount, taxBreakdown := s.CalculateTaxesWithRounding(sales.Subtotal, sales.IsCompound, sales.Taxes, rounding)
 	sales.Subtotal = afterTax
-	sales.TotalTax = itemsTax + salesTaxAmount
-	sales.Total = sales.Subtotal + sales.TotalTax
-	sales.TotalDiscount = totalDisc
+	sales.TotalTax = rounding.Document(itemsTax.Add(money.FromFloat(salesTaxAmount))).Float64()
+	sales.Total = money.FromFloat(sales.Subtotal).Add(money.FromFloat(sales.TotalTax)).Float64()
+	sales.TotalDiscount = rounding.Document(totalDisc).Float64()
 	b, _ := json.Marshal(taxBreakdown)
 	sales.TaxBreakdown = string(b)
 
 	return s.db.Omit(clause.Associations).Save(&sales).Error
 }
 
+// allocateItemTaxes rounds the item taxes of every tax rate once on their
+// total and allocates the rounded total back to the items in proportion to
+// their subtotals. Changed items are saved.
+func (s *SalesService) allocateItemTaxes(items []models.SalesItemModel, rounding money.Rounding) error {
+	groups := map[string][]int{}
+	keys := []string{}
+	for i, v := range items {
+		if v.TaxID == nil || v.Tax == nil {
+			continue
+		}
+		if _, ok := groups[*v.TaxID]; !ok {
+			keys = append(keys, *v.TaxID)
+		}
+		groups[*v.TaxID] = append(groups[*v.TaxID], i)
+	}
+	for _, key := range keys {
+		indexes := groups[key]
+		weights := make([]money.Amount, len(indexes))
+		var base money.Amount
+		for j, i := range indexes {
+			weights[j] = money.FromFloat(items[i].SubTotal)
+			base = base.Add(weights[j])
+		}
+		total := rounding.Document(base.Percent(items[indexes[0]].Tax.Amount))
+		for j, tax := range total.Allocate(weights, rounding.Precision) {
+			item := &items[indexes[j]]
+			if money.FromFloat(item.TotalTax) == tax {
+				continue
+			}
+			item.TotalTax = tax.Float64()
+			item.Total = money.FromFloat(item.SubTotal).Add(tax).Float64()
+			err := s.db.Model(&models.SalesItemModel{}).Where("id = ?", item.ID).Updates(map[string]any{
+				"total_tax": item.TotalTax,
+				"total":     item.Total,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // DeleteItem deletes an item from a sales document.
 //
 // It takes a sales document and an item ID as input, and returns an error if the operation fails.
@@ -570,6 +797,9 @@ func (s *SalesService) DeleteItem(sales *models.SalesModel, itemID string) error
 // The function first loads the product associated with the item, and sets the item's base price
 // to the product's price. If the product has a tax set, the item is also set to have the same tax.
 //
+// UnitPrice is the price of one transaction unit, so the subtotal is UnitPrice times Quantity;
+// the base quantity and base unit price are derived from the conversion value of the unit.
+//
 // The function then updates the item in the database, and returns an error if the operation fails.
 //
 // Finally, the function calls the UpdateTotal function to recalculate the total of the sales document.
@@ -582,31 +812,29 @@ func (s *SalesService) UpdateItem(sales *models.SalesModel, itemID string, item
 		item.BasePrice = product.Price
 	}
 	taxPercent := 0.0
-	taxAmount := 0.0
 
-	if item.UnitID != nil {
-		productUnit := models.ProductUnitData{}
-		s.db.Model(&productUnit).Where("product_model_id = ? and unit_model_id = ?", item.ProductID, item.UnitID).Find(&productUnit)
-		item.UnitValue = productUnit.Value
-	} else {
-		item.UnitValue = 1
+	if err := s.setBaseUnit(item); err != nil {
+		return err
 	}
 
 	if item.TaxID != nil {
 		taxPercent = item.Tax.Amount
 	}
-	item.SubtotalBeforeDisc = (item.Quantity * item.UnitValue) * item.UnitPrice
+	rounding := models.GetCompanyRounding(s.db, sales.CompanyID)
+	subtotalBeforeDisc := money.FromFloat(item.UnitPrice).Mul(item.Quantity).Round(rounding.Precision)
+	discountAmount := money.FromFloat(item.DiscountAmount)
 	if item.DiscountPercent > 0 {
-		taxAmount = (item.SubtotalBeforeDisc - (item.SubtotalBeforeDisc * item.DiscountPercent / 100)) * (taxPercent / 100)
-		item.SubTotal = (item.SubtotalBeforeDisc - (item.SubtotalBeforeDisc * item.DiscountPercent / 100))
-		item.DiscountAmount = item.SubtotalBeforeDisc * item.DiscountPercent / 100
+		discountAmount = subtotalBeforeDisc.Percent(item.DiscountPercent).Round(rounding.Precision)
 	} else {
-		taxAmount = (item.SubtotalBeforeDisc - item.DiscountAmount) * (taxPercent / 100)
-		item.SubTotal = (item.SubtotalBeforeDisc - item.DiscountAmount)
 		item.DiscountPercent = 0
 	}
-	item.TotalTax = taxAmount
-	item.Total = item.SubTotal + taxAmount
+	subTotal := subtotalBeforeDisc.Sub(discountAmount)
+	taxAmount := rounding.Line(subTotal.Percent(taxPercent))
+	item.SubtotalBeforeDisc = subtotalBeforeDisc.Float64()
+	item.DiscountAmount = discountAmount.Float64()
+	item.SubTotal = subTotal.Float64()
+	item.TotalTax = taxAmount.Float64()
+	item.Total = subTotal.Add(taxAmount).Float64()
 	err := s.db.Where("sales_id = ? AND id = ?", sales.ID, itemID).Omit("sales_id").Save(item).Error
 	if err != nil {
 		return err
@@ -631,29 +859,49 @@ func (s *SalesService) UpdateItem(sales *models.SalesModel, itemID string, item
 //   - The total amount after all taxes have been applied.
 //   - The aggregated total tax amount.
 //   - A map detailing the tax amount for each tax model by name.
-
+//
+// Withholding taxes are skipped; tax withheld by the customer is recorded on payment.
+// The amounts are rounded with money.DefaultRounding; see CalculateTaxesWithRounding.
 func (s *SalesService) CalculateTaxes(baseAmount float64, isCompound bool, taxes []*models.TaxModel) (float64, float64, map[string]float64) {
-	totalAmount := baseAmount
+	return s.CalculateTaxesWithRounding(baseAmount, isCompound, taxes, money.DefaultRounding)
+}
+
+// CalculateTaxesWithRounding is CalculateTaxes with exact decimal arithmetic and
+// the given rounding configuration.
+//
+// With PER_LINE rounding every tax is rounded half-up before it is added, and a
+// compound tax is computed on the rounded amount. With PER_DOCUMENT rounding the
+// taxes are computed exactly, the total tax is rounded once, and the breakdown is
+// allocated from the rounded total so that it always adds up.
+func (s *SalesService) CalculateTaxesWithRounding(baseAmount float64, isCompound bool, taxes []*models.TaxModel, rounding money.Rounding) (float64, float64, map[string]float64) {
+	base := money.FromFloat(baseAmount)
+	totalAmount := base
 	taxBreakdown := make(map[string]float64)
-	totalTax := 0.0
+	names := []string{}
+	amounts := []money.Amount{}
+	var totalTax money.Amount
 	for _, tax := range taxes {
-		if tax == nil {
+		if tax == nil || tax.IsWithholding() {
 			continue
 		}
-		taxAmount := (totalAmount * tax.Amount) / 100
-		// fmt.Printf("TAX_AMOUNT CalculateTaxes %f\n", taxAmount)
-		totalTax += taxAmount
-		taxBreakdown[tax.Name] = taxAmount
+		taxAmount := rounding.Line(totalAmount.Percent(tax.Amount))
+		totalTax = totalTax.Add(taxAmount)
+		names = append(names, tax.Name)
+		amounts = append(amounts, taxAmount)
 
 		if isCompound {
-			totalAmount += taxAmount
+			totalAmount = totalAmount.Add(taxAmount)
 		}
 	}
-
-	if !isCompound {
-		totalAmount += totalTax
+	totalTax = rounding.Document(totalTax)
+	if rounding.Mode == money.PER_DOCUMENT {
+		amounts = totalTax.Allocate(amounts, rounding.Precision)
+	}
+	for i, name := range names {
+		taxBreakdown[name] = money.FromFloat(taxBreakdown[name]).Add(amounts[i]).Float64()
 	}
-	return totalAmount, totalTax, taxBreakdown
+
+	return base.Add(totalTax).Float64(), totalTax.Float64(), taxBreakdown
 }
 
 // PublishSales creates a new sales document in the database and performs relevant accounting entries.
@@ -662,6 +910,9 @@ func (s *SalesService) CalculateTaxes(baseAmount float64, isCompound bool, taxes
 // for the sale and the asset account. If the sales document has a payment account, the sales document will be
 // marked as paid. If the sales document has a partial payment, the sales document will be marked as partial.
 //
+// Publishing a sales order confirms it: its items are hard reserved in their warehouses until the order is
+// invoiced, cancelled or its due date passes, and it fails when the stock cannot cover them.
+//
 // If successful, it returns nil; otherwise, it returns an error indicating what went wrong.
 func (s *SalesService) PublishSales(data *models.SalesModel) error {
 	if len(data.Items) == 0 {
@@ -672,6 +923,14 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 	if s.financeService.TransactionService == nil {
 		return errors.New("transaction service is not set")
 	}
+	if data.DocumentType == models.SALES_ORDER {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(data).Error; err != nil {
+				return err
+			}
+			return s.reserveSalesOrder(tx, data)
+		})
+	}
 	if err := s.db.Save(data).Error; err != nil {
 		return err
 	}
@@ -689,6 +948,7 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 					TransactionRefID:   &data.ID,
 					TransactionRefType: "sales",
 					CompanyID:          data.CompanyID,
+					AnalyticDimensions: data.AnalyticDimensions,
 					Credit:             v.SubTotal,
 				}, v.Total)
 			}
@@ -701,6 +961,7 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 					TransactionRefID:   &data.ID,
 					TransactionRefType: "sales",
 					CompanyID:          data.CompanyID,
+					AnalyticDimensions: data.AnalyticDimensions,
 					Debit:              v.SubTotal,
 				}, v.Total)
 			}
@@ -715,6 +976,7 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 					TransactionRefID:   &data.ID,
 					TransactionRefType: "sales",
 					CompanyID:          data.CompanyID,
+					AnalyticDimensions: data.AnalyticDimensions,
 					Credit:             v.TotalTax,
 				}, v.Total)
 
@@ -727,6 +989,7 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 					TransactionRefID:   &data.ID,
 					TransactionRefType: "sales",
 					CompanyID:          data.CompanyID,
+					AnalyticDimensions: data.AnalyticDimensions,
 					Debit:              v.TotalTax,
 				}, v.Total)
 			}
@@ -736,25 +999,31 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 					return errors.New("warehouse ID is required")
 				}
 				// ADD MOVEMENT
-				_, err := s.inventoryService.StockMovementService.AddMovement(
-					time.Now(),
-					*v.ProductID,
-					*v.WarehouseID,
-					v.VariantID,
-					nil,
-					nil,
-					nil,
-					-v.Quantity,
-					models.MovementTypeSale,
-					data.ID,
-					fmt.Sprintf("Sales #%s", data.SalesNumber))
+				// Tracked products leave from the lot or serial numbers of
+				// the item, or first expired, first out.
+				refType := "sales"
+				_, err := s.inventoryService.StockMovementService.RecordTrackedMovement(&models.StockMovementModel{
+					Date:          data.SalesDate,
+					ProductID:     *v.ProductID,
+					VariantID:     v.VariantID,
+					WarehouseID:   *v.WarehouseID,
+					BinID:         v.BinID,
+					CompanyID:     data.CompanyID,
+					Quantity:      -v.Quantity,
+					Value:         v.UnitValue,
+					Type:          models.MovementTypeSale,
+					ReferenceID:   data.ID,
+					ReferenceType: &refType,
+					UnitID:        v.UnitID,
+					Description:   fmt.Sprintf("Sales #%s", data.SalesNumber),
+				}, v.LotTracking)
 				if err != nil {
 					return err
 				}
 				// ADD SUPPLY TRANSACTION
 			}
 		}
-		return nil
+		return s.financeService.ConsolidationService.TagDocument(tx, data.CompanyID, data.ContactID, data.ID)
 	})
 }
 
@@ -764,7 +1033,12 @@ func (s *SalesService) PublishSales(data *models.SalesModel) error {
 // It verifies that the document type is "INVOICE" and that there are items present in the sales model.
 // It updates the status of the invoice to "POSTED", sets the published at and published by fields, and manages payment terms if applicable.
 // It retrieves the necessary accounts for cost of goods sold (COGS) and inventory, and creates financial transactions for each item in the sales model.
-// It also manages stock movements for products associated with the invoice.
+// It also manages stock movements for products associated with the invoice; the COGS and inventory
+// lines of a product are posted at the cost its movements take out of stock (FIFO or moving average).
+// Lot and serial tracked products leave from the lot or serial numbers of the item, or first expired,
+// first out when the item names none.
+// Invoices in a foreign currency are converted to the functional currency with the
+// document exchange rate, or the rate on the posting date when none is given.
 // The function executes these operations within a transaction to ensure data consistency.
 // Returns an error if any of the operations fail.
 func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID string, date time.Time) error {
@@ -776,6 +1050,9 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 	if len(data.Items) == 0 {
 		return errors.New("items is required")
 	}
+	if err := s.financeService.PeriodLockService.CheckLock(data.CompanyID, "sales", date); err != nil {
+		return err
+	}
 	now := time.Now()
 
 	if data.PaymentTermsCode != "" {
@@ -811,6 +1088,13 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 	if err != nil {
 		return errors.New("inventory account not found")
 	}
+	rate, err := s.financeService.CurrencyService.ResolveRate(*data.CompanyID, data.CurrencyCode, data.ExchangeRate, date)
+	if err != nil {
+		return err
+	}
+	data.ExchangeRate = rate
+	rounding := models.GetCompanyRounding(s.db, data.CompanyID)
+	data.FunctionalTotal = rounding.Document(money.FromFloat(data.Total).Mul(rate)).Float64()
 	if data.PaymentAccount.Type == "ASSET" {
 		data.Paid = data.Total
 
@@ -819,11 +1103,17 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		s.financeService.TransactionService.SetDB(tx)
 		s.inventoryService.StockMovementService.SetDB(tx)
-		totalPayment := 0.0
+		// The payment line is the exact sum of the converted and rounded
+		// revenue and tax lines, so the journal always balances.
+		var totalPayment, functionalPayment money.Amount
 		for _, v := range data.Items {
 			if v.SaleAccountID == nil {
 				return errors.New("sale account ID is required")
 			}
+			foreignRevenue := money.FromFloat(v.SubTotal)
+			revenue := rounding.Document(foreignRevenue.Mul(rate))
+			foreignTax := rounding.Line(money.FromFloat(v.TotalTax))
+			tax := rounding.Document(foreignTax.Mul(rate))
 			err := s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
 				Date:                        date,
 				AccountID:                   v.SaleAccountID,
@@ -834,10 +1124,14 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 				TransactionSecondaryRefID:   &data.ID,
 				TransactionSecondaryRefType: refType,
 				CompanyID:                   data.CompanyID,
-				Credit:                      v.SubTotal,
+				AnalyticDimensions:          data.AnalyticDimensions,
+				Credit:                      revenue.Float64(),
 				UserID:                      &userID,
 				IsIncome:                    true,
-			}, v.SubTotal)
+				CurrencyCode:                data.CurrencyCode,
+				ExchangeRate:                rate,
+				ForeignAmount:               foreignRevenue.Float64(),
+			}, revenue.Float64())
 			if err != nil {
 				return err
 			}
@@ -859,7 +1153,8 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 			// 		return err
 			// 	}
 			// } else {
-			totalPayment += v.SubTotal + v.TotalTax
+			totalPayment = totalPayment.Add(foreignRevenue).Add(foreignTax)
+			functionalPayment = functionalPayment.Add(revenue).Add(tax)
 			// }
 
 			if v.TaxID != nil {
@@ -877,11 +1172,15 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 					TransactionSecondaryRefID:   &v.ID,
 					TransactionSecondaryRefType: secRefType,
 					CompanyID:                   data.CompanyID,
-					Credit:                      v.TotalTax,
+					AnalyticDimensions:          data.AnalyticDimensions,
+					Credit:                      tax.Float64(),
 					UserID:                      &userID,
 					IsAccountPayable:            true,
 					IsTax:                       true,
-				}, v.TotalTax)
+					CurrencyCode:                data.CurrencyCode,
+					ExchangeRate:                rate,
+					ForeignAmount:               foreignTax.Float64(),
+				}, tax.Float64())
 				if err != nil {
 					return err
 				}
@@ -893,32 +1192,38 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 					return errors.New("warehouse ID is required")
 				}
 				// ADD MOVEMENT
-				movement, err := s.inventoryService.StockMovementService.AddMovement(
-					time.Now(),
-					*v.ProductID,
-					*v.WarehouseID,
-					v.VariantID,
-					nil,
-					nil,
-					data.CompanyID,
-					-v.Quantity,
-					models.MovementTypeSale,
-					data.ID,
-					fmt.Sprintf("Sales %s (%s)", data.SalesNumber, v.Description))
-				if err != nil {
-					return err
+				movement := models.StockMovementModel{
+					Date:             date,
+					ProductID:        *v.ProductID,
+					VariantID:        v.VariantID,
+					WarehouseID:      *v.WarehouseID,
+					BinID:            v.BinID,
+					CompanyID:        data.CompanyID,
+					Quantity:         -v.Quantity,
+					Value:            v.UnitValue,
+					Type:             models.MovementTypeSale,
+					ReferenceID:      data.ID,
+					ReferenceType:    &refType,
+					SecondaryRefID:   &v.ID,
+					SecondaryRefType: &secRefType,
+					UnitID:           v.UnitID,
+					Description:      fmt.Sprintf("Sales %s (%s)", data.SalesNumber, v.Description),
 				}
-				movement.ReferenceID = data.ID
-				movement.ReferenceType = &refType
-				movement.SecondaryRefID = &v.ID
-				movement.SecondaryRefType = &secRefType
-				movement.Value = v.UnitValue
-				movement.UnitID = v.UnitID
-
-				err = tx.Save(movement).Error
+				// Tracked products leave from the lot or serial numbers of
+				// the item, or first expired, first out, possibly split
+				// over several lots.
+				movements, err := s.inventoryService.StockMovementService.RecordTrackedMovement(&movement, v.LotTracking)
 				if err != nil {
 					return err
 				}
+				movement = movements[0]
+				// The cost of goods sold is the cost the stock leaves the
+				// warehouse at, under the costing method of the company.
+				var cogsAmount money.Amount
+				for _, m := range movements {
+					cogsAmount = cogsAmount.Sub(money.FromFloat(m.TotalCost))
+				}
+				cogs := cogsAmount.Float64()
 				// ADD SUPPLY TRANSACTION
 				err = s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
 					Date:                        date,
@@ -930,9 +1235,10 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 					TransactionSecondaryRefID:   &data.ID,
 					TransactionSecondaryRefType: refType,
 					CompanyID:                   data.CompanyID,
-					Credit:                      v.BasePrice * v.Quantity * v.UnitValue,
+					AnalyticDimensions:          data.AnalyticDimensions,
+					Credit:                      cogs,
 					UserID:                      &userID,
-				}, v.BasePrice*v.Quantity*v.UnitValue)
+				}, cogs)
 				if err != nil {
 					return err
 				}
@@ -948,9 +1254,10 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 					TransactionSecondaryRefID:   &data.ID,
 					TransactionSecondaryRefType: refType,
 					CompanyID:                   data.CompanyID,
-					Debit:                       v.BasePrice * v.Quantity * v.UnitValue,
+					AnalyticDimensions:          data.AnalyticDimensions,
+					Debit:                       cogs,
 					UserID:                      &userID,
-				}, v.BasePrice*v.Quantity*v.UnitValue)
+				}, cogs)
 				if err != nil {
 					return err
 				}
@@ -971,9 +1278,26 @@ func (s *SalesService) PostInvoice(id string, data *models.SalesModel, userID st
 			TransactionRefID:   &data.ID,
 			TransactionRefType: refType,
 			CompanyID:          data.CompanyID,
-			Debit:              totalPayment,
+			AnalyticDimensions: data.AnalyticDimensions,
+			Debit:              functionalPayment.Float64(),
 			UserID:             &userID,
-		}, totalPayment)
+			CurrencyCode:       data.CurrencyCode,
+			ExchangeRate:       rate,
+			ForeignAmount:      totalPayment.Float64(),
+		}, functionalPayment.Float64())
+		if err != nil {
+			return err
+		}
+		if err := s.financeService.ConsolidationService.TagDocument(tx, data.CompanyID, data.ContactID, data.ID); err != nil {
+			return err
+		}
+		// The stock reserved for the sales order of the invoice has now left.
+		if data.RefID != nil {
+			reservationService := reservation.NewReservationService(tx, s.ctx, s.inventoryService.StockMovementService)
+			if err := reservationService.Fulfill("sales", *data.RefID); err != nil {
+				return err
+			}
+		}
 		return tx.Save(data).Error
 	})
 	s.financeService.TransactionService.SetDB(s.db)
@@ -1024,8 +1348,13 @@ func (s *SalesService) GetBalance(sales *models.SalesModel) (float64, error) {
 //  5. If the payment discount is greater than 0, it creates another transaction record with the following details:
 //     - AccountID: the ID of the contra revenue account associated with the company
 //     - Debit: the discount amount
-//  6. Saves the sales payment data in the database.
-//  7. Commits the transaction if all operations are successful. Otherwise, it rolls back the transaction.
+//  6. If the customer withheld tax (WithholdingTaxID and Withholding are set), the asset account is
+//     debited with the payment less the withholding, the receivable account of the withholding tax
+//     (prepaid tax) is debited with the withholding, and the customer's withholding slip is recorded.
+//  7. If the sales order is in a foreign currency and the payment rate differs from the invoice rate,
+//     it posts the realized exchange difference to the realized FX account of the company.
+//  8. Saves the sales payment data in the database.
+//  9. Commits the transaction if all operations are successful. Otherwise, it rolls back the transaction.
 //
 // Returns an error if any of the operations fail.
 func (s *SalesService) CreateSalesPayment(sales *models.SalesModel, salesPayment *models.SalesPaymentModel) error {
@@ -1049,12 +1378,57 @@ func (s *SalesService) CreateSalesPayment(sales *models.SalesModel, salesPayment
 		if sales.PaymentAccount.Type != "RECEIVABLE" {
 			return errors.New("sales payment account type must be RECEIVABLE")
 		}
-		paymentAmount := salesPayment.Amount
-		discountAmount := 0.0
+		if err := period.Check(tx, sales.CompanyID, "sales", salesPayment.PaymentDate); err != nil {
+			return err
+		}
+		rounding := models.GetCompanyRounding(tx, sales.CompanyID)
+		amount := money.FromFloat(salesPayment.Amount)
+		var discount money.Amount
 		if salesPayment.PaymentDiscount > 0 {
-			paymentAmount = salesPayment.Amount - (salesPayment.Amount * (salesPayment.PaymentDiscount / 100))
-			discountAmount = salesPayment.Amount * (salesPayment.PaymentDiscount / 100)
+			discount = rounding.Document(amount.Percent(salesPayment.PaymentDiscount))
 		}
+		var withholdingTax *models.TaxModel
+		withheld := money.FromFloat(salesPayment.Withholding)
+		if salesPayment.WithholdingTaxID != nil && !withheld.IsZero() {
+			withholdingTax = &models.TaxModel{}
+			if err := tx.Where("id = ?", *salesPayment.WithholdingTaxID).First(withholdingTax).Error; err != nil {
+				return errors.New("withholding tax not found")
+			}
+			if !withholdingTax.IsWithholding() {
+				return errors.New("tax " + withholdingTax.Name + " is not a withholding tax")
+			}
+			if withholdingTax.AccountReceivableID == nil {
+				return errors.New("account receivable of tax " + withholdingTax.Name + " is required")
+			}
+			if salesPayment.WithholdingSlip == "" {
+				return errors.New("withholding slip number is required")
+			}
+			if withheld.Sign() < 0 || withheld > amount.Sub(discount) {
+				return errors.New("withholding must be between zero and the payment amount")
+			}
+		} else {
+			withheld = 0
+			salesPayment.Withholding = 0
+			salesPayment.WithholdingTaxID = nil
+		}
+		paymentAmount := amount.Sub(discount).Sub(withheld).Float64()
+		discountAmount := discount.Float64()
+
+		invoiceRate := sales.ExchangeRate
+		if invoiceRate <= 0 {
+			invoiceRate = 1
+		}
+		paymentRate, err := s.financeService.CurrencyService.ResolveRate(*sales.CompanyID, sales.CurrencyCode, salesPayment.ExchangeRate, salesPayment.PaymentDate)
+		if err != nil {
+			return err
+		}
+		salesPayment.ExchangeRate = paymentRate
+		// The difference is taken from the rounded lines so that the journal balances.
+		receivable := rounding.Document(amount.Mul(invoiceRate))
+		received := rounding.Document(amount.Sub(discount).Sub(withheld).Mul(paymentRate))
+		discountValue := rounding.Document(discount.Mul(invoiceRate))
+		withheldValue := rounding.Document(withheld.Mul(paymentRate))
+		salesPayment.FxDifference = received.Add(discountValue).Add(withheldValue).Sub(receivable).Float64()
 
 		paymentID := uuid.New().String()
 		receivableID := uuid.New().String()
@@ -1069,13 +1443,17 @@ func (s *SalesService) CreateSalesPayment(sales *models.SalesModel, salesPayment
 			TransactionRefID:            &assetTransID,
 			TransactionRefType:          "transaction",
 			CompanyID:                   sales.CompanyID,
-			Credit:                      salesPayment.Amount,
+			AnalyticDimensions:          sales.AnalyticDimensions,
+			Credit:                      receivable.Float64(),
 			UserID:                      salesPayment.UserID,
 			TransactionSecondaryRefID:   &sales.ID,
 			TransactionSecondaryRefType: "sales",
+			CurrencyCode:                sales.CurrencyCode,
+			ExchangeRate:                invoiceRate,
+			ForeignAmount:               salesPayment.Amount,
 		}
 		receivableData.ID = receivableID
-		err = s.financeService.TransactionService.CreateTransaction(&receivableData, salesPayment.Amount)
+		err = s.financeService.TransactionService.CreateTransaction(&receivableData, receivable.Float64())
 		if err != nil {
 			return err
 		}
@@ -1089,14 +1467,18 @@ func (s *SalesService) CreateSalesPayment(sales *models.SalesModel, salesPayment
 			TransactionRefID:            &receivableData.ID,
 			TransactionRefType:          "transaction",
 			CompanyID:                   sales.CompanyID,
-			Debit:                       paymentAmount,
+			AnalyticDimensions:          sales.AnalyticDimensions,
+			Debit:                       received.Float64(),
 			UserID:                      salesPayment.UserID,
 			TransactionSecondaryRefID:   &sales.ID,
 			TransactionSecondaryRefType: "sales",
+			CurrencyCode:                sales.CurrencyCode,
+			ExchangeRate:                paymentRate,
+			ForeignAmount:               paymentAmount,
 		}
 
 		assetData.ID = assetTransID
-		err = s.financeService.TransactionService.CreateTransaction(&assetData, paymentAmount)
+		err = s.financeService.TransactionService.CreateTransaction(&assetData, received.Float64())
 		if err != nil {
 			return err
 		}
@@ -1114,16 +1496,108 @@ func (s *SalesService) CreateSalesPayment(sales *models.SalesModel, salesPayment
 				TransactionRefID:            &receivableData.ID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   sales.CompanyID,
-				Debit:                       discountAmount,
+				AnalyticDimensions:          sales.AnalyticDimensions,
+				Debit:                       discountValue.Float64(),
+				UserID:                      salesPayment.UserID,
+				TransactionSecondaryRefID:   &sales.ID,
+				TransactionSecondaryRefType: "sales",
+				CurrencyCode:                sales.CurrencyCode,
+				ExchangeRate:                invoiceRate,
+				ForeignAmount:               discountAmount,
+			}, discountValue.Float64())
+			if err != nil {
+				return err
+			}
+		}
+
+		if withholdingTax != nil {
+			// PPh DIBAYAR DIMUKA
+			err = s.financeService.TransactionService.CreateTransaction(&models.TransactionModel{
+				Date:                        salesPayment.PaymentDate,
+				AccountID:                   withholdingTax.AccountReceivableID,
+				Description:                 "Potongan " + withholdingTax.Name + " " + sales.SalesNumber,
+				Notes:                       salesPayment.Notes,
+				TransactionRefID:            &receivableData.ID,
+				TransactionRefType:          "transaction",
+				CompanyID:                   sales.CompanyID,
+				AnalyticDimensions:          sales.AnalyticDimensions,
+				Debit:                       withheldValue.Float64(),
 				UserID:                      salesPayment.UserID,
 				TransactionSecondaryRefID:   &sales.ID,
 				TransactionSecondaryRefType: "sales",
-			}, discountAmount)
+				IsTax:                       true,
+				CurrencyCode:                sales.CurrencyCode,
+				ExchangeRate:                paymentRate,
+				ForeignAmount:               withheld.Float64(),
+			}, withheldValue.Float64())
+			if err != nil {
+				return err
+			}
+			var taxBase money.Amount
+			if withholdingTax.Amount > 0 {
+				taxBase = rounding.Document(withheldValue.Mul(100 / withholdingTax.Amount))
+			}
+			err = s.financeService.TaxService.CreateWithholdingSlip(tx, &models.WithholdingSlipModel{
+				CompanyID:     sales.CompanyID,
+				Direction:     models.WITHHOLDING_SLIP_RECEIVED,
+				Number:        salesPayment.WithholdingSlip,
+				Date:          salesPayment.PaymentDate,
+				ContactID:     sales.ContactID,
+				TaxID:         &withholdingTax.ID,
+				TaxType:       withholdingTax.TaxType,
+				TaxObjectCode: withholdingTax.TaxObjectCode,
+				Rate:          withholdingTax.Amount,
+				TaxBase:       taxBase.Float64(),
+				Amount:        withheldValue.Float64(),
+				SalesID:       &sales.ID,
+				PaymentID:     &paymentID,
+				Reference:     sales.SalesNumber,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if salesPayment.FxDifference != 0 {
+			// A higher rate on payment means more cash received for the same receivable.
+			var fxAccount models.AccountModel
+			err := s.db.Where("is_realized_fx_account = ? and company_id = ?", true, *sales.CompanyID).First(&fxAccount).Error
 			if err != nil {
+				return errors.New("realized fx account not found")
+			}
+			fxData := models.TransactionModel{
+				Date:                        salesPayment.PaymentDate,
+				AccountID:                   &fxAccount.ID,
+				Description:                 "Selisih Kurs " + sales.SalesNumber,
+				Notes:                       salesPayment.Notes,
+				TransactionRefID:            &receivableData.ID,
+				TransactionRefType:          "transaction",
+				CompanyID:                   sales.CompanyID,
+				AnalyticDimensions:          sales.AnalyticDimensions,
+				Amount:                      math.Abs(salesPayment.FxDifference),
+				UserID:                      salesPayment.UserID,
+				TransactionSecondaryRefID:   &sales.ID,
+				TransactionSecondaryRefType: "sales",
+				CurrencyCode:                sales.CurrencyCode,
+				ExchangeRate:                paymentRate,
+				IsFxDifference:              true,
+			}
+			if salesPayment.FxDifference > 0 {
+				fxData.Credit = salesPayment.FxDifference
+				fxData.IsIncome = true
+			} else {
+				fxData.Debit = -salesPayment.FxDifference
+				fxData.IsExpense = true
+			}
+			if err := s.financeService.TransactionService.CreateTransaction(&fxData, fxData.Amount); err != nil {
 				return err
 			}
 		}
 
+		if err := s.financeService.ConsolidationService.TagDocument(tx, sales.CompanyID, sales.ContactID, sales.ID); err != nil {
+			return err
+		}
+
 		salesPayment.ID = paymentID
 
 		return tx.Create(salesPayment).Error
@@ -1161,6 +1635,14 @@ func (s *SalesService) GetPdf(sales *models.SalesModel, templatePath, timeFormat
 		if v.Unit != nil {
 			unitName = v.Unit.Name
 		}
+		// Items sold in another unit than the base unit also show their
+		// quantity in the base unit.
+		baseQuantity := ""
+		baseUnitName := ""
+		if v.UnitValue != 0 && v.UnitValue != 1 && v.Product != nil && v.Product.DefaultUnit != nil {
+			baseQuantity = utils.FormatRupiah(v.Quantity * v.UnitValue)
+			baseUnitName = v.Product.DefaultUnit.Name
+		}
 		taxPercent := 0.0
 		taxName := ""
 		if v.Tax != nil {
@@ -1174,6 +1656,8 @@ func (s *SalesService) GetPdf(sales *models.SalesModel, templatePath, timeFormat
 			Quantity:           utils.FormatRupiah(v.Quantity),
 			UnitPrice:          utils.FormatRupiah(v.UnitPrice),
 			UnitName:           unitName,
+			BaseQuantity:       baseQuantity,
+			BaseUnitName:       baseUnitName,
 			Total:              utils.FormatRupiah(v.Total),
 			SubTotal:           utils.FormatRupiah(v.SubTotal),
 			SubtotalBeforeDisc: utils.FormatRupiah(v.SubtotalBeforeDisc),
@@ -1263,3 +1747,19 @@ func (s *SalesService) GetPdf(sales *models.SalesModel, templatePath, timeFormat
 
 	return utils.GenerateInvoicePDF(data, templatePath, footer)
 }
+
+// setBaseUnit sets the conversion value of the unit of an item and its quantity
+// and unit price in the base unit of the product.
+func (s *SalesService) setBaseUnit(item *models.SalesItemModel) error {
+	item.UnitValue = 1
+	if item.ProductID != nil {
+		unitValue, err := models.GetProductUnitValue(s.db, *item.ProductID, item.UnitID)
+		if err != nil {
+			return err
+		}
+		item.UnitValue = unitValue
+	}
+	item.BaseQuantity = item.Quantity * item.UnitValue
+	item.BaseUnitPrice = money.FromFloat(item.UnitPrice).Div(item.UnitValue).Float64()
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/AMETORY/ametory-erp-modules/shared/models"
 	"github.com/AMETORY/ametory-erp-modules/utils"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/morkid/paginate"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -184,6 +185,8 @@ func (s *SalesReturnService) CreateReturn(returnPurchase *models.ReturnModel) er
 			UnitPrice:          v.UnitPrice,
 			UnitID:             v.UnitID,
 			Value:              v.UnitValue,
+			BaseQuantity:       v.Quantity * v.UnitValue,
+			BaseUnitPrice:      v.BaseUnitPrice,
 			Total:              v.Total,
 			SubTotal:           v.SubTotal,
 			SubtotalBeforeDisc: v.SubtotalBeforeDisc,
@@ -206,8 +209,8 @@ func (s *SalesReturnService) CreateReturn(returnPurchase *models.ReturnModel) er
 // The function first checks if the return items are empty, and if so, returns an error.
 // It then retrieves the sales associated with the return and checks if the account
 // receivable for the tax is found. If not, it returns an error.
-// It then creates a transaction for each item in the return, updating the inventory
-// and HPP accounts, and creates a stock movement for each item.
+// It then creates a stock movement for each item, valued at the cost the goods were
+// sold at, and a transaction updating the inventory and HPP accounts with that cost.
 // It also updates the associated sales by subtracting the return total from the paid amount.
 // Finally, it updates the status of the return to RELEASED and sets the released at date and released by ID.
 func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date time.Time, notes string, accountID *string) error {
@@ -268,6 +271,7 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 				TransactionRefID:            &assetID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   sales.CompanyID,
+				AnalyticDimensions:          sales.AnalyticDimensions,
 				Debit:                       v.SubTotal,
 				Amount:                      v.SubTotal,
 				UserID:                      &userID,
@@ -298,6 +302,7 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 					TransactionSecondaryRefID:   &sales.ID,
 					TransactionSecondaryRefType: returnSecRefType,
 					CompanyID:                   returnPurchase.CompanyID,
+					AnalyticDimensions:          sales.AnalyticDimensions,
 					Debit:                       v.TotalTax,
 					Amount:                      v.TotalTax,
 					UserID:                      &userID,
@@ -320,6 +325,7 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 				TransactionRefID:            &inventoryID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   sales.CompanyID,
+				AnalyticDimensions:          sales.AnalyticDimensions,
 				Credit:                      v.Total,
 				Amount:                      v.Total,
 				UserID:                      &userID,
@@ -331,6 +337,39 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 				return err
 			}
 
+			// STOCK MOVEMENT
+			// The goods come back at the cost they were sold at; a bundle comes
+			// back as its components, at the cost they were sold at.
+			unitCost, err := s.stockMovementService.ReferenceUnitCost(sales.ID, *v.ProductID, v.VariantID)
+			if err != nil {
+				return err
+			}
+			movement := models.StockMovementModel{
+				Date:             time.Now(),
+				ProductID:        *v.ProductID,
+				VariantID:        v.VariantID,
+				WarehouseID:      *v.WarehouseID,
+				CompanyID:        returnPurchase.CompanyID,
+				Quantity:         v.Quantity,
+				Value:            v.Value,
+				Type:             models.MovementTypeReturn,
+				ReferenceID:      returnID,
+				ReferenceType:    &returnRefType,
+				SecondaryRefID:   &sales.ID,
+				SecondaryRefType: &returnSecRefType,
+				UnitID:           v.UnitID,
+				UnitCost:         unitCost,
+				Description:      fmt.Sprintf("Return %s (%s)", returnPurchase.ReturnNumber, v.Description),
+			}
+			movements, err := s.stockMovementService.RecordMovements(&movement)
+			if err != nil {
+				return err
+			}
+			var returnedCost money.Amount
+			for _, m := range movements {
+				returnedCost = returnedCost.Add(money.FromFloat(m.TotalCost))
+			}
+
 			// PERSEDIAAN
 			err = tx.Create(&models.TransactionModel{
 				BaseModel:                   shared.BaseModel{ID: inventoryID},
@@ -341,8 +380,9 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 				TransactionRefID:            &hppID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   sales.CompanyID,
-				Debit:                       v.BasePrice * v.Quantity * v.Value,
-				Amount:                      v.BasePrice * v.Quantity * v.Value,
+				AnalyticDimensions:          sales.AnalyticDimensions,
+				Debit:                       returnedCost.Float64(),
+				Amount:                      returnedCost.Float64(),
 				UserID:                      &userID,
 				TransactionSecondaryRefID:   &returnID,
 				TransactionSecondaryRefType: "return_sales",
@@ -362,8 +402,9 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 				TransactionRefID:            &inventoryID,
 				TransactionRefType:          "transaction",
 				CompanyID:                   sales.CompanyID,
-				Credit:                      v.BasePrice * v.Quantity * v.Value,
-				Amount:                      v.BasePrice * v.Quantity * v.Value,
+				AnalyticDimensions:          sales.AnalyticDimensions,
+				Credit:                      returnedCost.Float64(),
+				Amount:                      returnedCost.Float64(),
 				UserID:                      &userID,
 				TransactionSecondaryRefID:   &returnID,
 				TransactionSecondaryRefType: "return_sales",
@@ -373,35 +414,6 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 				return err
 			}
 
-			// STOCK MOVEMENT
-
-			movement, err := s.stockMovementService.AddMovement(
-				time.Now(),
-				*v.ProductID,
-				*v.WarehouseID,
-				v.VariantID,
-				nil,
-				nil,
-				returnPurchase.CompanyID,
-				v.Quantity,
-				models.MovementTypeReturn,
-				returnID,
-				fmt.Sprintf("Return %s (%s)", returnPurchase.ReturnNumber, v.Description))
-			if err != nil {
-				return err
-			}
-			movement.ReferenceID = returnID
-			movement.ReferenceType = &returnRefType
-			movement.SecondaryRefID = &sales.ID
-			movement.SecondaryRefType = &returnSecRefType
-			movement.Value = v.Value
-			movement.UnitID = v.UnitID
-
-			err = tx.Save(movement).Error
-			if err != nil {
-				return err
-			}
-
 			if accountID != nil {
 				returnAssetID := utils.Uuid()
 				returnCreditID := utils.Uuid()
@@ -416,6 +428,7 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 					TransactionRefID:            &returnCreditID,
 					TransactionRefType:          "transaction",
 					CompanyID:                   sales.CompanyID,
+					AnalyticDimensions:          sales.AnalyticDimensions,
 					Credit:                      v.Total,
 					Amount:                      v.Total,
 					UserID:                      &userID,
@@ -437,6 +450,7 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 					TransactionRefID:            &returnAssetID,
 					TransactionRefType:          "transaction",
 					CompanyID:                   sales.CompanyID,
+					AnalyticDimensions:          sales.AnalyticDimensions,
 					Debit:                       v.Total,
 					Amount:                      v.Total,
 					UserID:                      &userID,
@@ -479,6 +493,9 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 			}
 
 		}
+		if err := s.financeService.ConsolidationService.TagDocument(tx, sales.CompanyID, sales.ContactID, returnID); err != nil {
+			return err
+		}
 		// Commit the transaction
 		returnPurchase.Status = "RELEASED"
 		returnPurchase.ReleasedAt = &now
@@ -524,7 +541,9 @@ func (s *SalesReturnService) ReleaseReturn(returnID string, userID string, date
 // discount amount, subtotal, total tax, and total for the given return item
 // based on its quantity, unit price, discount percent, and tax information.
 // It fetches the unit value if a UnitID is provided and updates the item value
-// accordingly. The function also saves the updated item in the database.
+// and base quantity accordingly; a unit that is not set up for the product is
+// rejected. UnitPrice is the price of one unit of the item. The function also
+// saves the updated item in the database.
 //
 // Parameters:
 //   - item: A pointer to a ReturnItemModel containing the details of the return
@@ -536,18 +555,21 @@ func (s *SalesReturnService) UpdateItem(item *models.ReturnItemModel) error {
 	taxPercent := 0.0
 	taxAmount := 0.0
 
-	if item.UnitID != nil {
-		productUnit := models.ProductUnitData{}
-		s.db.Model(&productUnit).Where("product_model_id = ? and unit_model_id = ?", item.ProductID, item.UnitID).Find(&productUnit)
-		item.Value = productUnit.Value
-	} else {
-		item.Value = 1
+	item.Value = 1
+	if item.ProductID != nil {
+		unitValue, err := models.GetProductUnitValue(s.db, *item.ProductID, item.UnitID)
+		if err != nil {
+			return err
+		}
+		item.Value = unitValue
 	}
+	item.BaseQuantity = item.Quantity * item.Value
+	item.BaseUnitPrice = item.UnitPrice / item.Value
 
 	if item.TaxID != nil {
 		taxPercent = item.Tax.Amount
 	}
-	subtotalBeforeDisc := (item.Quantity * item.Value) * item.UnitPrice
+	subtotalBeforeDisc := item.Quantity * item.UnitPrice
 	if item.DiscountPercent > 0 {
 		taxAmount = (subtotalBeforeDisc - (subtotalBeforeDisc * item.DiscountPercent / 100)) * (taxPercent / 100)
 		item.SubTotal = (subtotalBeforeDisc - (subtotalBeforeDisc * item.DiscountPercent / 100))
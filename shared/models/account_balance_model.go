@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+const (
+	BALANCE_PERIOD_MONTHLY = "MONTHLY"
+	BALANCE_PERIOD_DAILY   = "DAILY"
+)
+
+// AccountBalanceModel is a snapshot of the posted ledger lines of an account in
+// a period: the lines that are not drafts and not deleted. Period is the start
+// of the month or day in UTC. Lines without a company are kept under an empty
+// CompanyID.
+type AccountBalanceModel struct {
+	CompanyID  string    `gorm:"type:char(36);primaryKey" json:"company_id"`
+	AccountID  string    `gorm:"type:char(36);primaryKey" json:"account_id"`
+	PeriodType string    `gorm:"type:varchar(10);primaryKey" json:"period_type"`
+	Period     time.Time `gorm:"primaryKey" json:"period"`
+	Debit      float64   `json:"debit"`
+	Credit     float64   `json:"credit"`
+	Count      int64     `json:"count"`
+}
+
+func (AccountBalanceModel) TableName() string {
+	return "account_balances"
+}
+
+// AccountBalanceStateModel records when the snapshots of a company were last
+// rebuilt. Reports only read the snapshots of a company that has been rebuilt
+// at least once; until then they sum the ledger lines.
+type AccountBalanceStateModel struct {
+	CompanyID  string    `gorm:"type:char(36);primaryKey" json:"company_id"`
+	PeriodType string    `gorm:"type:varchar(10);primaryKey" json:"period_type"`
+	RebuiltAt  time.Time `json:"rebuilt_at"`
+}
+
+func (AccountBalanceStateModel) TableName() string {
+	return "account_balance_states"
+}
@@ -68,6 +68,10 @@ type AccountModel struct {
 	IsAmortization             bool          `json:"is_amortization,omitempty" gorm:"default:false;not null"`
 	IsCogmAccount              bool          `json:"is_cogm_account,omitempty" gorm:"default:false;not null"`
 	IsStockOpnameAccount       bool          `json:"is_stock_opname_account,omitempty" gorm:"default:false;not null"`
+	IsInventoryTransitAccount  bool          `json:"is_inventory_transit_account,omitempty" gorm:"default:false;not null"`
+	IsRealizedFxAccount        bool          `json:"is_realized_fx_account,omitempty" gorm:"default:false;not null"`
+	IsUnrealizedFxAccount      bool          `json:"is_unrealized_fx_account,omitempty" gorm:"default:false;not null"`
+	CurrencyCode               string        `json:"currency_code,omitempty" gorm:"type:varchar(3)"`
 
 	// Transactions          []Transaction `gorm:"constraint:OnDelete:CASCADE;"`
 }
@@ -93,4 +97,6 @@ type AccountReport struct {
 	StartDate      *time.Time         `json:"start_date"`
 	EndDate        *time.Time         `json:"end_date"`
 	Transactions   []TransactionModel `json:"transactions"`
+	Group          *DimensionGroup    `json:"group,omitempty"`
+	Groups         []AccountReport    `json:"groups,omitempty"`
 }
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+const (
+	AGED_RECEIVABLE = "RECEIVABLE"
+	AGED_PAYABLE    = "PAYABLE"
+
+	AGING_BY_DUE_DATE     = "DUE_DATE"
+	AGING_BY_INVOICE_DATE = "INVOICE_DATE"
+
+	AGING_CURRENT = "CURRENT"
+	AGING_1_30    = "1-30"
+	AGING_31_60   = "31-60"
+	AGING_61_90   = "61-90"
+	AGING_OVER_90 = ">90"
+)
+
+// AgingBuckets holds open balances in the functional currency, split by the
+// number of days they are outstanding.
+type AgingBuckets struct {
+	Current    float64 `json:"current"`
+	Days1To30  float64 `json:"days_1_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Over90     float64 `json:"over_90"`
+	Total      float64 `json:"total"`
+}
+
+// AgedDocument is an open invoice or bill of an aged report. Total, Paid,
+// Returned and Balance are in the document currency; FunctionalBalance is the
+// balance at the document exchange rate.
+type AgedDocument struct {
+	ID                string     `json:"id"`
+	Number            string     `json:"number"`
+	Date              time.Time  `json:"date"`
+	DueDate           *time.Time `json:"due_date,omitempty"`
+	CurrencyCode      string     `json:"currency_code,omitempty"`
+	ExchangeRate      float64    `json:"exchange_rate"`
+	Total             float64    `json:"total"`
+	Paid              float64    `json:"paid"`
+	Returned          float64    `json:"returned"`
+	Balance           float64    `json:"balance"`
+	FunctionalBalance float64    `json:"functional_balance"`
+	DaysOutstanding   int        `json:"days_outstanding"`
+	Bucket            string     `json:"bucket"`
+}
+
+// AgedContact is the aging of the open documents of a customer or supplier.
+type AgedContact struct {
+	ContactID   *string        `json:"contact_id"`
+	ContactName string         `json:"contact_name"`
+	Buckets     AgingBuckets   `json:"buckets"`
+	Documents   []AgedDocument `json:"documents"`
+}
+
+// AgedReport is an aged receivables (AGED_RECEIVABLE) or aged payables
+// (AGED_PAYABLE) report at the AsOf date.
+type AgedReport struct {
+	Type     string        `json:"type"`
+	AgingBy  string        `json:"aging_by"`
+	AsOf     time.Time     `json:"as_of"`
+	Contacts []AgedContact `json:"contacts"`
+	Summary  AgingBuckets  `json:"summary"`
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DIMENSION_BRANCH     = "branch"
+	DIMENSION_PROJECT    = "project"
+	DIMENSION_DEPARTMENT = "department"
+)
+
+// AnalyticDimensionType describes an analytic dimension that can be put on
+// ledger lines: the column holding it and the table its values come from.
+type AnalyticDimensionType struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"`
+	Column string `json:"column"`
+	Table  string `json:"table"`
+}
+
+// AnalyticDimensionTypes lists the dimensions a ledger line can hold. Which of
+// them a company uses is set up with AnalyticDimensionTypeModel. A department is
+// an OrganizationModel.
+var AnalyticDimensionTypes = []AnalyticDimensionType{
+	{Name: DIMENSION_BRANCH, Label: "Branch", Column: "branch_id", Table: "branches"},
+	{Name: DIMENSION_PROJECT, Label: "Project", Column: "project_id", Table: "projects"},
+	{Name: DIMENSION_DEPARTMENT, Label: "Department", Column: "department_id", Table: "organizations"},
+}
+
+// GetAnalyticDimensionType returns the dimension type with the given name.
+func GetAnalyticDimensionType(name string) (*AnalyticDimensionType, error) {
+	for _, v := range AnalyticDimensionTypes {
+		if v.Name == name {
+			return &v, nil
+		}
+	}
+	return nil, errors.New("unknown analytic dimension: " + name)
+}
+
+// AnalyticDimensionTypeModel is an analytic dimension used by a company, with
+// the label it is shown under. Ledger lines, documents and report filters of the
+// company can only hold its active dimensions; a company without dimension types
+// of its own uses all of AnalyticDimensionTypes.
+type AnalyticDimensionTypeModel struct {
+	shared.BaseModel
+	CompanyID *string       `json:"company_id,omitempty" gorm:"type:char(36);uniqueIndex:idx_analytic_dimension_type_company_name"`
+	Company   *CompanyModel `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Name      string        `json:"name" gorm:"type:varchar(50);uniqueIndex:idx_analytic_dimension_type_company_name"` // branch, project, department
+	Label     string        `json:"label"`
+	IsActive  bool          `json:"is_active"`
+}
+
+func (AnalyticDimensionTypeModel) TableName() string {
+	return "analytic_dimension_types"
+}
+
+func (a *AnalyticDimensionTypeModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// GetCompanyAnalyticDimensionTypes returns the active analytic dimensions of a
+// company, labelled as the company set them up.
+func GetCompanyAnalyticDimensionTypes(db *gorm.DB, companyID string) ([]AnalyticDimensionType, error) {
+	var rows []AnalyticDimensionTypeModel
+	if err := db.Where("company_id = ?", companyID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return AnalyticDimensionTypes, nil
+	}
+	types := []AnalyticDimensionType{}
+	for _, v := range AnalyticDimensionTypes {
+		for _, row := range rows {
+			if row.Name != v.Name || !row.IsActive {
+				continue
+			}
+			if row.Label != "" {
+				v.Label = row.Label
+			}
+			types = append(types, v)
+		}
+	}
+	return types, nil
+}
+
+// GetCompanyAnalyticDimensionType returns the named dimension type if it is an
+// active dimension of the company.
+func GetCompanyAnalyticDimensionType(db *gorm.DB, companyID, name string) (*AnalyticDimensionType, error) {
+	types, err := GetCompanyAnalyticDimensionTypes(db, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range types {
+		if v.Name == name {
+			return &v, nil
+		}
+	}
+	if _, err := GetAnalyticDimensionType(name); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("analytic dimension " + name + " is not used by the company")
+}
+
+// CheckAnalyticDimensions checks that the dimensions set are active dimensions of
+// the company and that their values belong to the company. An empty value, which
+// filters on lines without the dimension, is not looked up.
+func CheckAnalyticDimensions(db *gorm.DB, companyID *string, d AnalyticDimensions) error {
+	if companyID == nil || d.IsEmpty() {
+		return nil
+	}
+	types, err := GetCompanyAnalyticDimensionTypes(db, *companyID)
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, dimension := range types {
+		used[dimension.Name] = true
+		value := d.Get(dimension.Name)
+		if value == nil || *value == "" {
+			continue
+		}
+		var count int64
+		if err := db.Table(dimension.Table).Where("id = ? AND company_id = ?", *value, *companyID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New(dimension.Label + " not found: " + *value)
+		}
+	}
+	for _, v := range AnalyticDimensionTypes {
+		if d.Get(v.Name) != nil && !used[v.Name] {
+			return errors.New("analytic dimension " + v.Name + " is not used by the company")
+		}
+	}
+	return nil
+}
+
+// ActiveAnalyticDimensions returns the dimensions of d that are active dimensions
+// of the company, with the others cleared, e.g. to default a ledger line to the
+// dimensions of an employee without failing CheckAnalyticDimensions.
+func ActiveAnalyticDimensions(db *gorm.DB, companyID *string, d AnalyticDimensions) (AnalyticDimensions, error) {
+	if companyID == nil || d.IsEmpty() {
+		return d, nil
+	}
+	types, err := GetCompanyAnalyticDimensionTypes(db, *companyID)
+	if err != nil {
+		return d, err
+	}
+	var active AnalyticDimensions
+	for _, v := range types {
+		active.Set(v.Name, d.Get(v.Name))
+	}
+	return active, nil
+}
+
+// AnalyticDimensions holds the analytic dimensions of a ledger line or of the
+// source document its lines inherit them from.
+//
+// Used as a report filter, a nil field is not filtered and a field pointing to
+// an empty string only matches lines without that dimension.
+type AnalyticDimensions struct {
+	BranchID     *string `json:"branch_id,omitempty" gorm:"type:char(36);index"`
+	ProjectID    *string `json:"project_id,omitempty" gorm:"type:char(36);index"`
+	DepartmentID *string `json:"department_id,omitempty" gorm:"type:char(36);index"`
+}
+
+// AnalyticDimensionsFromQuery reads the branch_id, project_id and department_id
+// query parameters.
+func AnalyticDimensionsFromQuery(query url.Values) AnalyticDimensions {
+	var d AnalyticDimensions
+	for _, v := range AnalyticDimensionTypes {
+		if value := query.Get(v.Column); value != "" {
+			d.Set(v.Name, &value)
+		}
+	}
+	return d
+}
+
+// Get returns the value of the named dimension.
+func (d AnalyticDimensions) Get(name string) *string {
+	switch name {
+	case DIMENSION_BRANCH:
+		return d.BranchID
+	case DIMENSION_PROJECT:
+		return d.ProjectID
+	case DIMENSION_DEPARTMENT:
+		return d.DepartmentID
+	}
+	return nil
+}
+
+// Set sets the value of the named dimension.
+func (d *AnalyticDimensions) Set(name string, value *string) {
+	switch name {
+	case DIMENSION_BRANCH:
+		d.BranchID = value
+	case DIMENSION_PROJECT:
+		d.ProjectID = value
+	case DIMENSION_DEPARTMENT:
+		d.DepartmentID = value
+	}
+}
+
+// InheritFrom fills the dimensions that are not set yet from the source document.
+func (d *AnalyticDimensions) InheritFrom(source AnalyticDimensions) {
+	for _, v := range AnalyticDimensionTypes {
+		if d.Get(v.Name) == nil {
+			d.Set(v.Name, source.Get(v.Name))
+		}
+	}
+}
+
+// IsEmpty reports whether none of the dimensions is set.
+func (d AnalyticDimensions) IsEmpty() bool {
+	for _, v := range AnalyticDimensionTypes {
+		if d.Get(v.Name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ScopeTransactions filters a query on the transactions table by the dimensions.
+func (d AnalyticDimensions) ScopeTransactions(db *gorm.DB) *gorm.DB {
+	for _, v := range AnalyticDimensionTypes {
+		value := d.Get(v.Name)
+		switch {
+		case value == nil:
+		case *value == "":
+			db = db.Where("transactions." + v.Column + " IS NULL")
+		default:
+			db = db.Where("transactions."+v.Column+" = ?", *value)
+		}
+	}
+	return db
+}
+
+// DimensionGroup identifies the dimension value a grouped report is made for.
+// ID is nil for the lines without the dimension.
+type DimensionGroup struct {
+	Dimension string  `json:"dimension"`
+	ID        *string `json:"id"`
+	Name      string  `json:"name"`
+}
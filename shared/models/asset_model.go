@@ -8,8 +8,19 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	ASSET_DISPOSAL_SALE  = "SALE"
+	ASSET_DISPOSAL_SCRAP = "SCRAP"
+
+	ASSET_EVENT_REVALUATION = "REVALUATION"
+	ASSET_EVENT_IMPAIRMENT  = "IMPAIRMENT"
+	ASSET_EVENT_TRANSFER    = "TRANSFER"
+	ASSET_EVENT_DISPOSAL    = "DISPOSAL"
+)
+
 type AssetModel struct {
 	shared.BaseModel
+	AnalyticDimensions
 	CompanyID                        *string                 `json:"company_id,omitempty"`
 	Company                          *CompanyModel           `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE;" json:"company,omitempty"`
 	UserID                           *string                 `json:"user_id,omitempty"`
@@ -34,6 +45,17 @@ type AssetModel struct {
 	BookValue                        float64                 `json:"book_value"`
 	Status                           string                  `json:"status" gorm:"default:'DRAFT'"` // PENDING', 'ACTIVE', 'DISPOSED
 	IsMonthly                        bool                    `json:"is_monthly"`
+	ProRata                          bool                    `json:"pro_rata"`         // pro-rate the first and last month of a monthly schedule
+	ProductionUnits                  float64                 `json:"production_units"` // estimated units over the life time, for UOP
+	RevaluationAmount                float64                 `json:"revaluation_amount"`
+	ImpairmentAmount                 float64                 `json:"impairment_amount"`
+	DisposalType                     string                  `json:"disposal_type,omitempty"` // SALE, SCRAP
+	DisposalDate                     *time.Time              `json:"disposal_date,omitempty"`
+	DisposalAmount                   float64                 `json:"disposal_amount"`
+	Branch                           *BranchModel            `gorm:"foreignKey:BranchID;constraint:OnDelete:SET NULL" json:"branch,omitempty"`
+	Project                          *ProjectModel           `gorm:"foreignKey:ProjectID;constraint:OnDelete:SET NULL" json:"project,omitempty"`
+	Department                       *OrganizationModel      `gorm:"foreignKey:DepartmentID;constraint:OnDelete:SET NULL" json:"department,omitempty"`
+	Events                           []AssetEventModel       `json:"events,omitempty" gorm:"-"`
 	Depreciations                    []DepreciationCostModel `json:"depreciations,omitempty" gorm:"-"`
 	DepreciationMethodLabel          string                  `json:"depreciation_method_label,omitempty" gorm:"-"`
 }
@@ -59,11 +81,12 @@ type DepreciationCostModel struct {
 	AssetID       *string       `gorm:"size:36" json:"asset_id,omitempty"`
 	Asset         *AssetModel   `gorm:"foreignKey:AssetID;constraint:OnDelete:CASCADE;" json:"asset,omitempty"`
 	Amount        float64       `json:"amount,omitempty"`
+	Units         float64       `json:"units,omitempty"` // units produced in the period, for UOP
 	Period        int           `json:"period,omitempty"`
 	Month         int           `json:"month,omitempty"`
 	ExecutedAt    *time.Time    `json:"executed_at,omitempty"`
 	TransactionID *string       `json:"transaction_id,omitempty"`
-	Status        string        `json:"status,omitempty" gorm:"default:'PENDING'"` // 'PENDING', 'ACTIVE', 'DONE'
+	Status        string        `json:"status,omitempty" gorm:"default:'PENDING'"` // 'PENDING', 'ACTIVE', 'DONE', 'CANCELLED'
 	IsChecked     bool          `json:"is_checked,omitempty" gorm:"-"`
 }
 
@@ -77,3 +100,68 @@ func (d *DepreciationCostModel) BeforeCreate(tx *gorm.DB) (err error) {
 func (DepreciationCostModel) TableName() string {
 	return "depreciation_costs"
 }
+
+// AssetEventModel records a change to an asset after it is activated:
+// a revaluation, an impairment, a transfer between branches or cost centers,
+// or its disposal. Amount is the change of the book value; a transfer keeps
+// the dimensions before and after it.
+type AssetEventModel struct {
+	shared.BaseModel
+	CompanyID       *string            `json:"company_id,omitempty" gorm:"type:char(36);index"`
+	Company         *CompanyModel      `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE;" json:"company,omitempty"`
+	UserID          *string            `json:"user_id,omitempty"`
+	User            *UserModel         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"user,omitempty"`
+	AssetID         *string            `gorm:"size:36;index" json:"asset_id,omitempty"`
+	Asset           *AssetModel        `gorm:"foreignKey:AssetID;constraint:OnDelete:CASCADE;" json:"asset,omitempty"`
+	Type            string             `json:"type" gorm:"type:varchar(20);index"`
+	Date            time.Time          `json:"date"`
+	Code            string             `json:"code,omitempty"`
+	Amount          float64            `json:"amount"`
+	BookValueBefore float64            `json:"book_value_before"`
+	BookValueAfter  float64            `json:"book_value_after"`
+	Proceeds        float64            `json:"proceeds,omitempty"`
+	GainLoss        float64            `json:"gain_loss,omitempty"`
+	AccountID       *string            `gorm:"size:36" json:"account_id,omitempty"`
+	Account         *AccountModel      `gorm:"foreignKey:AccountID;constraint:OnDelete:SET NULL;" json:"account,omitempty"`
+	From            AnalyticDimensions `json:"from" gorm:"embedded;embeddedPrefix:from_"`
+	To              AnalyticDimensions `json:"to" gorm:"embedded;embeddedPrefix:to_"`
+	Notes           string             `json:"notes,omitempty"`
+}
+
+func (e *AssetEventModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+func (AssetEventModel) TableName() string {
+	return "asset_events"
+}
+
+// AssetRegister is the fixed asset register of a company as of a date.
+type AssetRegister struct {
+	Date                    time.Time           `json:"date"`
+	Dimensions              AnalyticDimensions  `json:"dimensions,omitempty"`
+	Items                   []AssetRegisterItem `json:"items"`
+	Cost                    float64             `json:"cost"`
+	AccumulatedDepreciation float64             `json:"accumulated_depreciation"`
+	Impairment              float64             `json:"impairment"`
+	BookValue               float64             `json:"book_value"`
+}
+
+// AssetRegisterItem is an asset in the register. Cost and accumulated
+// depreciation are read from the asset's ledger lines up to the register date.
+type AssetRegisterItem struct {
+	AnalyticDimensions
+	AssetID                 string    `json:"asset_id"`
+	AssetNumber             string    `json:"asset_number"`
+	Name                    string    `json:"name"`
+	Date                    time.Time `json:"date"`
+	DepreciationMethod      string    `json:"depreciation_method"`
+	LifeTime                float64   `json:"life_time"`
+	Cost                    float64   `json:"cost"`
+	AccumulatedDepreciation float64   `json:"accumulated_depreciation"`
+	Impairment              float64   `json:"impairment"`
+	BookValue               float64   `json:"book_value"`
+}
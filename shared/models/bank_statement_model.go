@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	STATEMENT_LINE_UNMATCHED = "UNMATCHED"
+	STATEMENT_LINE_MATCHED   = "MATCHED"
+	STATEMENT_LINE_CREATED   = "CREATED"
+
+	STATEMENT_MATCH_AUTO   = "AUTO"
+	STATEMENT_MATCH_MANUAL = "MANUAL"
+)
+
+// BankStatementModel is a bank statement imported for a cash/bank account.
+type BankStatementModel struct {
+	shared.BaseModel
+	CompanyID      *string                  `json:"company_id,omitempty" gorm:"index"`
+	Company        *CompanyModel            `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	AccountID      *string                  `json:"account_id,omitempty" gorm:"index"`
+	Account        *AccountModel            `gorm:"foreignKey:AccountID;constraint:OnDelete:CASCADE" json:"account,omitempty"`
+	Format         string                   `json:"format" gorm:"type:varchar(20)"`
+	FileName       string                   `json:"file_name"`
+	Reference      string                   `json:"reference"`
+	AccountNumber  string                   `json:"account_number"`
+	CurrencyCode   string                   `json:"currency_code" gorm:"type:varchar(3)"`
+	StartDate      time.Time                `json:"start_date"`
+	EndDate        time.Time                `json:"end_date"`
+	OpeningBalance float64                  `json:"opening_balance"`
+	ClosingBalance float64                  `json:"closing_balance"`
+	UserID         *string                  `json:"user_id,omitempty"`
+	User           *UserModel               `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL" json:"user,omitempty"`
+	Lines          []BankStatementLineModel `gorm:"foreignKey:StatementID;constraint:OnDelete:CASCADE" json:"lines,omitempty"`
+	TotalLines     int64                    `json:"total_lines" gorm:"-"`
+	MatchedLines   int64                    `json:"matched_lines" gorm:"-"`
+}
+
+func (BankStatementModel) TableName() string {
+	return "bank_statements"
+}
+
+func (b *BankStatementModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// BankStatementLineModel is a single booking of an imported bank statement.
+// Amount is positive for money received and negative for money paid out.
+//
+// A line is UNMATCHED until it is matched to a ledger transaction of the bank
+// account, automatically or manually, or until a new transaction is CREATED
+// from it. TransactionID points to the bank side of the matched transaction.
+type BankStatementLineModel struct {
+	shared.BaseModel
+	StatementID   *string           `json:"statement_id,omitempty" gorm:"index"`
+	CompanyID     *string           `json:"company_id,omitempty" gorm:"index"`
+	AccountID     *string           `json:"account_id,omitempty" gorm:"index"`
+	Date          time.Time         `json:"date"`
+	ValueDate     *time.Time        `json:"value_date,omitempty"`
+	Description   string            `json:"description"`
+	Reference     string            `json:"reference"`
+	Amount        float64           `json:"amount"`
+	Balance       *float64          `json:"balance,omitempty"`
+	Hash          string            `json:"-" gorm:"type:varchar(64);index"`
+	Status        string            `json:"status" gorm:"type:varchar(20);default:'UNMATCHED';index"`
+	MatchType     string            `json:"match_type,omitempty" gorm:"type:varchar(20)"`
+	TransactionID *string           `json:"transaction_id,omitempty" gorm:"index"`
+	Transaction   *TransactionModel `gorm:"foreignKey:TransactionID;constraint:OnDelete:SET NULL" json:"transaction,omitempty"`
+	MatchedAt     *time.Time        `json:"matched_at,omitempty"`
+	MatchedByID   *string           `json:"matched_by_id,omitempty"`
+	MatchedBy     *UserModel        `gorm:"foreignKey:MatchedByID;constraint:OnDelete:SET NULL" json:"matched_by,omitempty"`
+}
+
+func (BankStatementLineModel) TableName() string {
+	return "bank_statement_lines"
+}
+
+func (b *BankStatementLineModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// BankReconciliationReport compares the book balance of a cash/bank account
+// with the bank statement balance at the end of a period.
+//
+// Outstanding transactions are in the books but not yet on a statement, and
+// unmatched lines are on a statement but not yet in the books. Both adjusted
+// balances agree when the account is reconciled.
+type BankReconciliationReport struct {
+	AccountID                string                   `json:"account_id"`
+	Account                  *AccountModel            `json:"account,omitempty"`
+	StartDate                time.Time                `json:"start_date"`
+	EndDate                  time.Time                `json:"end_date"`
+	BookBalance              float64                  `json:"book_balance"`
+	StatementBalance         float64                  `json:"statement_balance"`
+	TotalOutstanding         float64                  `json:"total_outstanding"`
+	TotalUnmatched           float64                  `json:"total_unmatched"`
+	AdjustedBookBalance      float64                  `json:"adjusted_book_balance"`
+	AdjustedStatementBalance float64                  `json:"adjusted_statement_balance"`
+	Difference               float64                  `json:"difference"`
+	MatchedLines             int64                    `json:"matched_lines"`
+	OutstandingTransactions  []TransactionModel       `json:"outstanding_transactions"`
+	UnmatchedLines           []BankStatementLineModel `json:"unmatched_lines"`
+}
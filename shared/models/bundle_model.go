@@ -0,0 +1,87 @@
+package models
+
+import (
+	"math"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BundleComponentModel is one component of a bundle or kit product, e.g. the
+// items of a hamper or a meal combo.
+//
+// A bundle holds no stock of its own: selling one base unit of it takes Quantity
+// base units of every component out of stock. Components of a bundle variant
+// replace those of the bundle product for that variant.
+type BundleComponentModel struct {
+	shared.BaseModel
+	BundleID           string        `gorm:"type:char(36);index;not null" json:"bundle_id"`
+	Bundle             *ProductModel `gorm:"foreignKey:BundleID;constraint:OnDelete:CASCADE" json:"-"`
+	BundleVariantID    *string       `gorm:"type:char(36);index" json:"bundle_variant_id,omitempty"` // Kosong untuk semua varian bundle
+	BundleVariant      *VariantModel `gorm:"foreignKey:BundleVariantID;constraint:OnDelete:CASCADE" json:"-"`
+	ComponentID        string        `gorm:"type:char(36);index;not null" json:"component_id"`
+	Component          *ProductModel `gorm:"foreignKey:ComponentID;constraint:OnDelete:CASCADE" json:"component,omitempty"`
+	ComponentVariantID *string       `gorm:"type:char(36);index" json:"component_variant_id,omitempty"`
+	ComponentVariant   *VariantModel `gorm:"foreignKey:ComponentVariantID;constraint:OnDelete:CASCADE" json:"component_variant,omitempty"`
+	Quantity           float64       `gorm:"not null;default:1" json:"quantity"` // Satuan dasar komponen per satuan dasar bundle
+	Notes              string        `json:"notes,omitempty"`
+}
+
+func (BundleComponentModel) TableName() string {
+	return "product_bundle_components"
+}
+
+func (b *BundleComponentModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// GetBundleComponents returns the components of a bundle product, or of one of
+// its variants when variantID is not nil and the variant has components of its
+// own. It returns no components for a product that is not a bundle.
+func GetBundleComponents(db *gorm.DB, productID string, variantID *string) ([]BundleComponentModel, error) {
+	var components []BundleComponentModel
+	if variantID != nil {
+		if err := db.Where("bundle_id = ? AND bundle_variant_id = ?", productID, *variantID).Order("created_at").Find(&components).Error; err != nil {
+			return nil, err
+		}
+		if len(components) > 0 {
+			return components, nil
+		}
+	}
+	err := db.Where("bundle_id = ? AND bundle_variant_id IS NULL", productID).Order("created_at").Find(&components).Error
+	return components, err
+}
+
+// BundleComponentStock is the stock of one component of a bundle and how many
+// bundles it is enough for.
+type BundleComponentStock struct {
+	ComponentID        string  `json:"component_id"`
+	ComponentVariantID *string `json:"component_variant_id,omitempty"`
+	Name               string  `json:"name"`
+	Quantity           float64 `json:"quantity"` // Per satuan dasar bundle
+	Stock              float64 `json:"stock"`
+	Available          float64 `json:"available"` // Jumlah bundle yang bisa dibuat dari stok komponen ini
+}
+
+// BundleAvailability is the number of bundles that can be sold from the stock of
+// their components: the smallest number any component is enough for.
+type BundleAvailability struct {
+	ProductID   string                 `json:"product_id"`
+	VariantID   *string                `json:"variant_id,omitempty"`
+	WarehouseID *string                `json:"warehouse_id,omitempty"`
+	Available   float64                `json:"available"`
+	Components  []BundleComponentStock `json:"components"`
+}
+
+// BundlesFor returns how many whole bundles a component stock is enough for when
+// each bundle takes quantity of it.
+func BundlesFor(stock, quantity float64) float64 {
+	if quantity <= 0 || stock <= 0 {
+		return 0
+	}
+	return math.Floor(stock/quantity + 1e-9)
+}
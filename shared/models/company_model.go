@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -46,6 +47,59 @@ type CompanyModel struct {
 	VillageID                *string               `json:"village_id,omitempty" gorm:"type:char(10);index;constraint:OnDelete:SET NULL;"`
 	CashflowGroupSetting     *CashflowGroupSetting `gorm:"-" json:"cashflow_group_setting,omitempty"`
 	CashflowGroupSettingData *string               `json:"cashflow_group_setting_data,omitempty" gorm:"type:JSON"`
+	CurrencyCode             string                `json:"currency_code" gorm:"type:varchar(3);default:'IDR'"`
+	RoundingMode             string                `json:"rounding_mode" gorm:"type:varchar(20);default:'PER_LINE'"`
+	RoundingPrecision        *int                  `json:"rounding_precision" gorm:"default:2"`
+	CostingMethod            string                `json:"costing_method" gorm:"type:varchar(20);default:'MOVING_AVERAGE'"`
+}
+
+const (
+	COSTING_FIFO           = "FIFO"
+	COSTING_MOVING_AVERAGE = "MOVING_AVERAGE"
+)
+
+// Rounding returns the rounding configuration used by the sales, purchase and
+// finance documents of the company. Missing settings fall back to
+// money.DefaultRounding.
+func (c CompanyModel) Rounding() money.Rounding {
+	rounding := money.DefaultRounding
+	if c.RoundingMode == string(money.PER_DOCUMENT) {
+		rounding.Mode = money.PER_DOCUMENT
+	}
+	if c.RoundingPrecision != nil && *c.RoundingPrecision >= 0 {
+		rounding.Precision = *c.RoundingPrecision
+	}
+	return rounding
+}
+
+// GetCompanyRounding loads the rounding configuration of a company. A nil or
+// unknown company gets money.DefaultRounding.
+func GetCompanyRounding(db *gorm.DB, companyID *string) money.Rounding {
+	if companyID == nil {
+		return money.DefaultRounding
+	}
+	var company CompanyModel
+	if err := db.Select("id, rounding_mode, rounding_precision").Where("id = ?", *companyID).First(&company).Error; err != nil {
+		return money.DefaultRounding
+	}
+	return company.Rounding()
+}
+
+// GetCompanyCostingMethod returns the inventory costing method of a company,
+// COSTING_FIFO or COSTING_MOVING_AVERAGE. A nil or unknown company and any other
+// setting get COSTING_MOVING_AVERAGE.
+func GetCompanyCostingMethod(db *gorm.DB, companyID *string) string {
+	if companyID == nil {
+		return COSTING_MOVING_AVERAGE
+	}
+	var company CompanyModel
+	if err := db.Select("id, costing_method").Where("id = ?", *companyID).First(&company).Error; err != nil {
+		return COSTING_MOVING_AVERAGE
+	}
+	if company.CostingMethod == COSTING_FIFO {
+		return COSTING_FIFO
+	}
+	return COSTING_MOVING_AVERAGE
 }
 
 func (CompanyModel) TableName() string {
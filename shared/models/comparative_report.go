@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// COMPARE_MONTHLY makes a column for every month of the report range.
+	COMPARE_MONTHLY = "MONTHLY"
+	// COMPARE_PRIOR_PERIOD compares the report range with the range of the same
+	// length just before it.
+	COMPARE_PRIOR_PERIOD = "PRIOR_PERIOD"
+	// COMPARE_PRIOR_YEAR compares the report range with the same range a year
+	// earlier.
+	COMPARE_PRIOR_YEAR = "PRIOR_YEAR"
+	// COMPARE_YEAR_TO_DATE compares the year to date of the report end date with
+	// the year to date of the same day a year earlier.
+	COMPARE_YEAR_TO_DATE = "YEAR_TO_DATE"
+
+	COMPARATIVE_PROFIT_LOSS   = "PROFIT_LOSS"
+	COMPARATIVE_BALANCE_SHEET = "BALANCE_SHEET"
+	COMPARATIVE_CASH_FLOW     = "CASH_FLOW"
+)
+
+// ComparativeColumn is a column of a comparative report. A balance sheet column
+// is the position at the end date. The variance of a report is taken between its
+// first column and the column marked IsComparison.
+type ComparativeColumn struct {
+	Label        string    `json:"label"`
+	StartDate    time.Time `json:"start_date"`
+	EndDate      time.Time `json:"end_date"`
+	IsComparison bool      `json:"is_comparison,omitempty"`
+}
+
+// ComparativeRow is a line of a comparative report with a value for every
+// column. Account lines keep the account of the single period report; subtotal
+// and total lines have IsTotal set. VariancePercent is left out when the
+// compared value is zero.
+type ComparativeRow struct {
+	Section         string    `json:"section"`
+	ID              string    `json:"id,omitempty"`
+	Code            string    `json:"code,omitempty"`
+	Name            string    `json:"name"`
+	Link            string    `json:"link,omitempty"`
+	IsTotal         bool      `json:"is_total,omitempty"`
+	Values          []float64 `json:"values"`
+	Variance        *float64  `json:"variance,omitempty"`
+	VariancePercent *float64  `json:"variance_percent,omitempty"`
+}
+
+// ComparativeReport is a profit and loss, balance sheet or cash flow report with
+// several columns. It is column oriented: Columns describes the columns and every
+// row has one value per column in the same order.
+type ComparativeReport struct {
+	GeneralReport
+	Report  string              `json:"report"`
+	Columns []ComparativeColumn `json:"columns"`
+	Rows    []ComparativeRow    `json:"rows"`
+}
+
+// HasVariance reports whether the report has a comparison column.
+func (r ComparativeReport) HasVariance() bool {
+	for _, v := range r.Columns {
+		if v.IsComparison {
+			return true
+		}
+	}
+	return false
+}
+
+// Table returns the report as a header row and a row per line, for CSV and
+// spreadsheet exports. Amounts are written with two decimals.
+func (r ComparativeReport) Table() [][]string {
+	header := []string{"Kode", "Nama"}
+	for _, v := range r.Columns {
+		header = append(header, v.Label)
+	}
+	if r.HasVariance() {
+		header = append(header, "Selisih", "Selisih (%)")
+	}
+	table := [][]string{header}
+	for _, row := range r.Rows {
+		line := []string{row.Code, row.Name}
+		for _, v := range row.Values {
+			line = append(line, strconv.FormatFloat(v, 'f', 2, 64))
+		}
+		if r.HasVariance() {
+			variance, percent := "", ""
+			if row.Variance != nil {
+				variance = strconv.FormatFloat(*row.Variance, 'f', 2, 64)
+			}
+			if row.VariancePercent != nil {
+				percent = strconv.FormatFloat(*row.VariancePercent, 'f', 2, 64)
+			}
+			line = append(line, variance, percent)
+		}
+		table = append(table, line)
+	}
+	return table
+}
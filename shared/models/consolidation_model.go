@@ -0,0 +1,145 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CompanyGroupModel is a group of companies reported together. The chart of
+// accounts of the parent company is the chart of the consolidated reports.
+type CompanyGroupModel struct {
+	shared.BaseModel
+	Name            string                    `json:"name"`
+	Description     string                    `json:"description"`
+	ParentCompanyID *string                   `json:"parent_company_id" gorm:"type:char(36);index"`
+	ParentCompany   *CompanyModel             `gorm:"foreignKey:ParentCompanyID;constraint:OnDelete:CASCADE" json:"parent_company,omitempty"`
+	Members         []CompanyGroupMemberModel `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"members,omitempty"`
+}
+
+func (CompanyGroupModel) TableName() string {
+	return "company_groups"
+}
+
+func (c *CompanyGroupModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// CompanyGroupMemberModel is a company of a group. OwnershipPercent is the
+// share the parent company holds; the rest is the minority interest.
+type CompanyGroupMemberModel struct {
+	shared.BaseModel
+	GroupID          *string            `json:"group_id" gorm:"type:char(36);index"`
+	Group            *CompanyGroupModel `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"group,omitempty"`
+	CompanyID        *string            `json:"company_id" gorm:"type:char(36);index"`
+	Company          *CompanyModel      `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	OwnershipPercent float64            `json:"ownership_percent" gorm:"default:100"`
+}
+
+func (CompanyGroupMemberModel) TableName() string {
+	return "company_group_members"
+}
+
+func (c *CompanyGroupMemberModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// ConsolidationAccountMapModel maps an account of a group company to an account
+// of the parent company's chart of accounts.
+type ConsolidationAccountMapModel struct {
+	shared.BaseModel
+	GroupID        *string            `json:"group_id" gorm:"type:char(36);index"`
+	Group          *CompanyGroupModel `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"group,omitempty"`
+	CompanyID      *string            `json:"company_id" gorm:"type:char(36);index"`
+	AccountID      *string            `json:"account_id" gorm:"type:char(36);index"`
+	Account        *AccountModel      `gorm:"foreignKey:AccountID;constraint:OnDelete:CASCADE" json:"account,omitempty"`
+	GroupAccountID *string            `json:"group_account_id" gorm:"type:char(36)"`
+	GroupAccount   *AccountModel      `gorm:"foreignKey:GroupAccountID;constraint:OnDelete:CASCADE" json:"group_account,omitempty"`
+}
+
+func (ConsolidationAccountMapModel) TableName() string {
+	return "consolidation_account_maps"
+}
+
+func (c *ConsolidationAccountMapModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// ConsolidationElimination is an elimination of intercompany balances on an
+// account of the consolidated reports.
+type ConsolidationElimination struct {
+	CompanyID   string  `json:"company_id"`
+	AccountID   string  `json:"account_id"`
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Debit       float64 `json:"debit"`
+	Credit      float64 `json:"credit"`
+}
+
+// ConsolidationMinorityInterest is the share of a group company's equity and
+// net profit that belongs to shareholders outside the group.
+type ConsolidationMinorityInterest struct {
+	CompanyID        string  `json:"company_id"`
+	CompanyName      string  `json:"company_name"`
+	OwnershipPercent float64 `json:"ownership_percent"`
+	Equity           float64 `json:"equity"`
+	NetProfit        float64 `json:"net_profit"`
+	MinorityEquity   float64 `json:"minority_equity"`
+	MinorityProfit   float64 `json:"minority_profit"`
+}
+
+// ConsolidatedTrialBalanceRow is an account of the consolidated trial balance
+// with the combined balances of the group companies, the eliminations and the
+// consolidated result.
+type ConsolidatedTrialBalanceRow struct {
+	ID                 string  `json:"id"`
+	Code               string  `json:"code"`
+	Name               string  `json:"name"`
+	Debit              float64 `json:"debit"`
+	Credit             float64 `json:"credit"`
+	EliminationDebit   float64 `json:"elimination_debit"`
+	EliminationCredit  float64 `json:"elimination_credit"`
+	ConsolidatedDebit  float64 `json:"consolidated_debit"`
+	ConsolidatedCredit float64 `json:"consolidated_credit"`
+}
+
+type ConsolidatedTrialBalance struct {
+	GroupID      string                        `json:"group_id"`
+	EndDate      time.Time                     `json:"end_date"`
+	Rows         []ConsolidatedTrialBalanceRow `json:"rows"`
+	Eliminations []ConsolidationElimination    `json:"eliminations"`
+	TotalDebit   float64                       `json:"total_debit"`
+	TotalCredit  float64                       `json:"total_credit"`
+}
+
+type ConsolidatedProfitLoss struct {
+	GroupID                       string                          `json:"group_id"`
+	StartDate                     time.Time                       `json:"start_date"`
+	EndDate                       time.Time                       `json:"end_date"`
+	ProfitLoss                    ProfitLossReport                `json:"profit_loss"`
+	Eliminations                  []ConsolidationElimination      `json:"eliminations"`
+	MinorityInterests             []ConsolidationMinorityInterest `json:"minority_interests"`
+	MinorityInterest              float64                         `json:"minority_interest"`
+	NetProfitAttributableToParent float64                         `json:"net_profit_attributable_to_parent"`
+}
+
+type ConsolidatedBalanceSheet struct {
+	GroupID               string                          `json:"group_id"`
+	BalanceSheet          BalanceSheet                    `json:"balance_sheet"`
+	Eliminations          []ConsolidationElimination      `json:"eliminations"`
+	EliminationDifference float64                         `json:"elimination_difference"`
+	MinorityInterests     []ConsolidationMinorityInterest `json:"minority_interests"`
+	MinorityInterest      float64                         `json:"minority_interest"`
+}
@@ -16,6 +16,7 @@ type ContactModel struct {
 	Code                   string          `json:"code,omitempty"`
 	Phone                  *string         `json:"phone,omitempty"`
 	Address                string          `json:"address,omitempty"`
+	TaxPayerNumber         string          `json:"tax_payer_number,omitempty"` // NPWP
 	ContactPerson          string          `json:"contact_person,omitempty"`
 	ContactPersonPosition  string          `json:"contact_person_position,omitempty"`
 	IsCustomer             bool            `gorm:"default:false" json:"is_customer,omitempty"` // Flag untuk customer
@@ -43,6 +44,8 @@ type ContactModel struct {
 	ConnectionType         *string         `json:"connection_type" gorm:"default:whatsapp"`
 	CustomData             json.RawMessage `json:"custom_data,omitempty" gorm:"type:JSON;default:'{}'"`
 	ProfilePicture         *FileModel      `json:"profile_picture,omitempty" gorm:"-"`
+	IntercompanyID         *string         `json:"intercompany_id,omitempty" gorm:"type:char(36);index"` // Perusahaan grup yang diwakili contact
+	Intercompany           *CompanyModel   `gorm:"foreignKey:IntercompanyID;constraint:OnDelete:SET NULL" json:"intercompany,omitempty"`
 }
 
 func (u *ContactModel) GetProfilePicture(tx *gorm.DB) (*FileModel, error) {
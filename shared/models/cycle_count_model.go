@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ABC_CLASS_A = "A"
+	ABC_CLASS_B = "B"
+	ABC_CLASS_C = "C"
+
+	CYCLE_COUNT_DAILY  = "DAILY"
+	CYCLE_COUNT_WEEKLY = "WEEKLY"
+)
+
+// CycleCountPolicyModel holds how the products of a warehouse are classified and
+// how often each class is counted.
+//
+// Products are ranked by the value of their outgoing stock movements over the
+// last LookbackDays. The products making up the first ClassALimit percent of the
+// total value are class A, those up to ClassBLimit percent class B and the rest
+// class C. A product is due for counting FrequencyA, FrequencyB or FrequencyC days
+// after it was last counted. The scheduler generates a batch of at most MaxItems
+// due products every day, or once a week on Weekday (0 is Sunday) with the
+// products due in the coming week.
+type CycleCountPolicyModel struct {
+	shared.BaseModel
+	CompanyID    *string         `gorm:"type:char(36);index" json:"company_id,omitempty"`
+	WarehouseID  string          `gorm:"type:char(36);uniqueIndex;not null" json:"warehouse_id"`
+	Warehouse    *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	ClassALimit  float64         `gorm:"default:80" json:"class_a_limit"` // Persen kumulatif nilai pergerakan
+	ClassBLimit  float64         `gorm:"default:95" json:"class_b_limit"`
+	FrequencyA   int             `gorm:"default:30" json:"frequency_a"` // Hari
+	FrequencyB   int             `gorm:"default:90" json:"frequency_b"`
+	FrequencyC   int             `gorm:"default:180" json:"frequency_c"`
+	LookbackDays int             `gorm:"default:365" json:"lookback_days"`
+	Schedule     string          `gorm:"type:varchar(10);default:'WEEKLY'" json:"schedule"` // DAILY, WEEKLY
+	Weekday      int             `gorm:"default:1" json:"weekday"`
+	MaxItems     int             `gorm:"default:50" json:"max_items"`
+	IsActive     bool            `gorm:"default:true" json:"is_active"`
+	LastRunAt    *time.Time      `json:"last_run_at,omitempty"`
+}
+
+func (CycleCountPolicyModel) TableName() string {
+	return "cycle_count_policies"
+}
+
+func (p *CycleCountPolicyModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// Frequency returns the number of days between counts of a class.
+func (p CycleCountPolicyModel) Frequency(class string) int {
+	switch class {
+	case ABC_CLASS_A:
+		return p.FrequencyA
+	case ABC_CLASS_B:
+		return p.FrequencyB
+	}
+	return p.FrequencyC
+}
+
+// ProductClassificationModel is the ABC class of a product or variant in a
+// warehouse and when it is next due for a cycle count.
+type ProductClassificationModel struct {
+	shared.BaseModel
+	CompanyID         *string         `gorm:"type:char(36);index" json:"company_id,omitempty"`
+	WarehouseID       string          `gorm:"type:char(36);index;not null" json:"warehouse_id"`
+	Warehouse         *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	ProductID         string          `gorm:"type:char(36);index;not null" json:"product_id"`
+	Product           *ProductModel   `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID         *string         `gorm:"type:char(36);index" json:"variant_id,omitempty"`
+	Variant           *VariantModel   `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"`
+	Class             string          `gorm:"type:varchar(1);index" json:"class"` // A, B, C
+	MovementValue     float64         `json:"movement_value"`                     // Nilai pergerakan keluar selama periode
+	CumulativePercent float64         `json:"cumulative_percent"`
+	ClassifiedAt      time.Time       `json:"classified_at"`
+	LastCountedAt     *time.Time      `json:"last_counted_at,omitempty"`
+	NextCountDate     time.Time       `gorm:"index" json:"next_count_date"`
+}
+
+func (ProductClassificationModel) TableName() string {
+	return "product_classifications"
+}
+
+func (p *ProductClassificationModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// CountAccuracy summarises the completed stock opname lines of a warehouse, a
+// product or a period. A line is accurate when the counted quantity matched the
+// system quantity; Drift is the absolute difference as a percentage of the system
+// quantity.
+type CountAccuracy struct {
+	Key                string  `json:"key"` // ID gudang, ID produk atau periode (YYYY-MM)
+	Name               string  `json:"name"`
+	Lines              int     `json:"lines"`
+	AccurateLines      int     `json:"accurate_lines"`
+	AccuracyPercent    float64 `json:"accuracy_percent"`
+	SystemQty          float64 `json:"system_qty"`
+	AbsoluteDifference float64 `json:"absolute_difference"`
+	NetDifference      float64 `json:"net_difference"`
+	Drift              float64 `json:"drift"`
+}
@@ -80,6 +80,13 @@ func (e EmployeeModel) TableName() string {
 	return "employees"
 }
 
+// Dimensions returns the analytic dimensions the ledger lines of the employee's
+// payroll and reimbursements default to: the branch and the organization as
+// department.
+func (e EmployeeModel) Dimensions() AnalyticDimensions {
+	return AnalyticDimensions{BranchID: e.BranchID, DepartmentID: e.OrganizationID}
+}
+
 func (e *EmployeeModel) BeforeCreate(tx *gorm.DB) (err error) {
 	if e.ID == "" {
 		tx.Statement.SetColumn("id", uuid.New().String())
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DEFAULT_CURRENCY is the functional currency used when a company has not set one.
+const DEFAULT_CURRENCY = "IDR"
+
+// ExchangeRateModel stores the rate of a foreign currency against the company
+// functional currency on a given date. One unit of CurrencyCode equals Rate
+// units of the functional currency.
+type ExchangeRateModel struct {
+	shared.BaseModel
+	CompanyID    *string       `json:"company_id,omitempty" gorm:"index"`
+	Company      *CompanyModel `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	CurrencyCode string        `json:"currency_code" gorm:"type:varchar(3);index"`
+	Rate         float64       `json:"rate"`
+	Date         time.Time     `json:"date" gorm:"index"`
+	Source       string        `json:"source,omitempty"`
+	UserID       *string       `json:"user_id,omitempty"`
+	User         *UserModel    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+func (ExchangeRateModel) TableName() string {
+	return "exchange_rates"
+}
+
+func (e *ExchangeRateModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
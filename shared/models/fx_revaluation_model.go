@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FxRevaluationModel records a period-end revaluation of open foreign
+// currency balances. The unrealized difference is posted on Date and
+// reversed on ReversalDate.
+type FxRevaluationModel struct {
+	shared.BaseModel
+	CompanyID    *string             `json:"company_id,omitempty"`
+	Company      *CompanyModel       `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	UserID       *string             `json:"user_id,omitempty"`
+	User         *UserModel          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	Date         time.Time           `json:"date"`
+	ReversalDate time.Time           `json:"reversal_date"`
+	Notes        string              `json:"notes"`
+	Status       string              `json:"status"`
+	TotalGain    float64             `json:"total_gain"`
+	TotalLoss    float64             `json:"total_loss"`
+	DetailData   *string             `gorm:"type:JSON" json:"detail_data,omitempty"`
+	Details      []FxRevaluationLine `gorm:"-" json:"details"`
+	Transactions []TransactionModel  `gorm:"-" json:"transactions,omitempty"`
+}
+
+// FxRevaluationLine is a single revalued document or bank account.
+type FxRevaluationLine struct {
+	RefID          string  `json:"ref_id"`
+	RefType        string  `json:"ref_type"`
+	RefNumber      string  `json:"ref_number"`
+	AccountID      string  `json:"account_id"`
+	CurrencyCode   string  `json:"currency_code"`
+	ForeignBalance float64 `json:"foreign_balance"`
+	BookedRate     float64 `json:"booked_rate"`
+	BookedAmount   float64 `json:"booked_amount"`
+	Rate           float64 `json:"rate"`
+	RevaluedAmount float64 `json:"revalued_amount"`
+	Difference     float64 `json:"difference"`
+}
+
+func (FxRevaluationModel) TableName() string {
+	return "fx_revaluations"
+}
+
+func (f *FxRevaluationModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if f.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+func (f *FxRevaluationModel) AfterFind(tx *gorm.DB) (err error) {
+	if f.DetailData != nil {
+		if err := json.Unmarshal([]byte(*f.DetailData), &f.Details); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,6 +8,16 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	JOURNAL_DRAFT    = "DRAFT"
+	JOURNAL_POSTED   = "POSTED"
+	JOURNAL_REVERSED = "REVERSED"
+)
+
+// JOURNAL_BALANCE_TOLERANCE is the largest difference between debit and credit
+// that is still treated as balanced, to absorb rounding.
+const JOURNAL_BALANCE_TOLERANCE = 0.01
+
 type JournalModel struct {
 	shared.BaseModel
 	UserID           *string            `gorm:"size:30" json:"-" `
@@ -20,6 +30,13 @@ type JournalModel struct {
 	EmployeeID       *string            `gorm:"size:30" json:"employee_id,omitempty"`
 	IsOpeningBalance bool               `json:"is_opening_balance"`
 	Unbalanced       bool               `json:"unbalanced" gorm:"-"`
+	Status           string             `json:"status" gorm:"type:varchar(20)"`
+	PostedAt         *time.Time         `json:"posted_at,omitempty"`
+	PostedByID       *string            `json:"posted_by_id,omitempty" gorm:"size:36"`
+	PostedBy         *UserModel         `gorm:"foreignKey:PostedByID;constraint:OnDelete:SET NULL" json:"posted_by,omitempty"`
+	ReversalOfID     *string            `json:"reversal_of_id,omitempty" gorm:"size:36"`
+	ReversedByID     *string            `json:"reversed_by_id,omitempty" gorm:"size:36"`
+	ReversedAt       *time.Time         `json:"reversed_at,omitempty"`
 }
 
 func (JournalModel) TableName() string {
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	LANDED_COST_DRAFT     = "DRAFT"
+	LANDED_COST_POSTED    = "POSTED"
+	LANDED_COST_CANCELLED = "CANCELLED"
+
+	LANDED_COST_BY_QUANTITY = "QUANTITY" // Jumlah satuan dasar yang diterima
+	LANDED_COST_BY_VALUE    = "VALUE"    // Nilai persediaan yang diterima
+	LANDED_COST_BY_WEIGHT   = "WEIGHT"   // Berat produk x jumlah
+	LANDED_COST_BY_VOLUME   = "VOLUME"   // Panjang x lebar x tinggi produk x jumlah
+)
+
+// LandedCostModel is a document of costs paid to bring purchased goods into the
+// warehouse, such as freight, import duty, insurance and handling, that become
+// part of the cost of the goods.
+//
+// A landed cost names the purchase documents whose receipts carry the costs.
+// Posting it allocates every cost line over the incoming stock movements of the
+// purchases with the allocation method of the line, adds the allocated amounts to
+// the value of the stock received and journals the costs into the inventory
+// account.
+type LandedCostModel struct {
+	shared.BaseModel
+	LandedCostNumber string                      `json:"landed_cost_number,omitempty"`
+	CompanyID        *string                     `gorm:"type:char(36);index" json:"company_id,omitempty"`
+	Company          *CompanyModel               `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Date             time.Time                   `json:"date"`
+	ContactID        *string                     `gorm:"type:char(36);index" json:"contact_id,omitempty"` // Vendor jasa, misalnya forwarder
+	Contact          *ContactModel               `gorm:"foreignKey:ContactID;constraint:OnDelete:SET NULL" json:"contact,omitempty"`
+	CreditAccountID  *string                     `gorm:"type:char(36)" json:"credit_account_id,omitempty"` // Akun lawan biaya, misalnya hutang atau kas
+	CreditAccount    *AccountModel               `gorm:"foreignKey:CreditAccountID;constraint:OnDelete:SET NULL" json:"credit_account,omitempty"`
+	Status           string                      `gorm:"type:varchar(20);index;default:'DRAFT'" json:"status"`
+	Total            float64                     `json:"total"`
+	Notes            string                      `gorm:"type:text" json:"notes,omitempty"`
+	Purchases        []PurchaseOrderModel        `gorm:"many2many:landed_cost_purchases;constraint:OnDelete:CASCADE" json:"purchases,omitempty"`
+	Items            []LandedCostItemModel       `gorm:"foreignKey:LandedCostID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	Allocations      []LandedCostAllocationModel `gorm:"foreignKey:LandedCostID;constraint:OnDelete:CASCADE" json:"allocations,omitempty"`
+	PostedAt         *time.Time                  `json:"posted_at,omitempty"`
+	PostedByID       *string                     `json:"posted_by_id,omitempty"`
+	PostedBy         *UserModel                  `gorm:"foreignKey:PostedByID;constraint:OnDelete:SET NULL" json:"posted_by,omitempty"`
+	CreatedByID      *string                     `json:"created_by_id,omitempty"`
+	CreatedBy        *UserModel                  `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL" json:"created_by,omitempty"`
+}
+
+func (LandedCostModel) TableName() string {
+	return "landed_costs"
+}
+
+func (p *LandedCostModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// LandedCostItemModel is one cost on a landed cost document, in the functional
+// currency of the company. Without an account of its own it is credited to the
+// credit account of the document.
+type LandedCostItemModel struct {
+	shared.BaseModel
+	LandedCostID     string           `gorm:"type:char(36);index;not null" json:"landed_cost_id"`
+	LandedCost       *LandedCostModel `gorm:"foreignKey:LandedCostID;constraint:OnDelete:CASCADE" json:"landed_cost,omitempty"`
+	Description      string           `json:"description,omitempty"`
+	Amount           float64          `json:"amount"`
+	AllocationMethod string           `gorm:"type:varchar(20);default:'VALUE'" json:"allocation_method"` // QUANTITY, VALUE, WEIGHT, VOLUME
+	CreditAccountID  *string          `gorm:"type:char(36)" json:"credit_account_id,omitempty"`
+	CreditAccount    *AccountModel    `gorm:"foreignKey:CreditAccountID;constraint:OnDelete:SET NULL" json:"credit_account,omitempty"`
+}
+
+func (LandedCostItemModel) TableName() string {
+	return "landed_cost_items"
+}
+
+func (p *LandedCostItemModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// LandedCostAllocationModel is the part of a cost line allocated to one incoming
+// stock movement of a purchase.
+//
+// Basis is the quantity, value, weight or volume of the receipt the cost was
+// allocated by. Of the allocated Amount, InventoryAmount was added to the value of
+// the stock of the receipt still on hand and CogsAmount, the part of the goods
+// already issued, was charged to cost of goods sold.
+type LandedCostAllocationModel struct {
+	shared.BaseModel
+	LandedCostID         string               `gorm:"type:char(36);index;not null" json:"landed_cost_id"`
+	LandedCost           *LandedCostModel     `gorm:"foreignKey:LandedCostID;constraint:OnDelete:CASCADE" json:"landed_cost,omitempty"`
+	ItemID               string               `gorm:"type:char(36);index;not null" json:"item_id"`
+	Item                 *LandedCostItemModel `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE" json:"item,omitempty"`
+	PurchaseID           string               `gorm:"type:char(36);index" json:"purchase_id"`
+	PurchaseItemID       *string              `gorm:"type:char(36);index" json:"purchase_item_id,omitempty"`
+	MovementID           string               `gorm:"type:char(36);index" json:"movement_id"` // Pergerakan stok penerimaan
+	ProductID            string               `gorm:"type:char(36);index" json:"product_id"`
+	Product              *ProductModel        `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID            *string              `gorm:"type:char(36)" json:"variant_id,omitempty"`
+	Variant              *VariantModel        `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"`
+	WarehouseID          string               `gorm:"type:char(36)" json:"warehouse_id"`
+	Quantity             float64              `json:"quantity"` // Dalam satuan dasar
+	Basis                float64              `json:"basis"`
+	Amount               float64              `json:"amount"`
+	InventoryAmount      float64              `json:"inventory_amount"`
+	CogsAmount           float64              `json:"cogs_amount"`
+	UnitCost             float64              `json:"unit_cost"`                                             // Biaya tambahan per satuan dasar
+	AdjustmentMovementID *string              `gorm:"type:char(36)" json:"adjustment_movement_id,omitempty"` // Pergerakan penyesuaian nilai
+}
+
+func (LandedCostAllocationModel) TableName() string {
+	return "landed_cost_allocations"
+}
+
+func (p *LandedCostAllocationModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
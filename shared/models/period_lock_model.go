@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PeriodLockModel holds the lock date of a company. Nothing can be posted on or
+// before LockDate. An empty Module locks every module of the company, otherwise
+// only postings of that module (e.g. "sales", "purchase", "asset") are locked.
+type PeriodLockModel struct {
+	shared.BaseModel
+	CompanyID *string       `json:"company_id,omitempty" gorm:"uniqueIndex:idx_period_lock_company_module"`
+	Company   *CompanyModel `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Module    string        `json:"module" gorm:"uniqueIndex:idx_period_lock_company_module"`
+	LockDate  time.Time     `json:"lock_date"`
+	Notes     string        `json:"notes"`
+	UserID    *string       `json:"user_id,omitempty"`
+	User      *UserModel    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+func (PeriodLockModel) TableName() string {
+	return "period_locks"
+}
+
+func (p *PeriodLockModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// PeriodReopenLogModel records who reopened a locked period, which period and why.
+type PeriodReopenLogModel struct {
+	shared.BaseModel
+	CompanyID        *string       `json:"company_id,omitempty"`
+	Company          *CompanyModel `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Module           string        `json:"module"`
+	PreviousLockDate time.Time     `json:"previous_lock_date"`
+	NewLockDate      *time.Time    `json:"new_lock_date"`
+	Reason           string        `json:"reason"`
+	UserID           *string       `json:"user_id,omitempty"`
+	User             *UserModel    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+func (PeriodReopenLogModel) TableName() string {
+	return "period_reopen_logs"
+}
+
+func (p *PeriodReopenLogModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
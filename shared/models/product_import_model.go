@@ -0,0 +1,20 @@
+package models
+
+// ProductImportError is a problem found in a row of a product catalog file.
+type ProductImportError struct {
+	Row     int    `json:"row"` // Nomor baris di file, header adalah baris 1
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// ProductImportResult reports what a product catalog import did, or would do
+// in a dry run. Nothing is written when Errors is not empty.
+type ProductImportResult struct {
+	DryRun          bool                 `json:"dry_run"`
+	Rows            int                  `json:"rows"`
+	ProductsCreated int                  `json:"products_created"`
+	ProductsUpdated int                  `json:"products_updated"`
+	VariantsCreated int                  `json:"variants_created"`
+	VariantsUpdated int                  `json:"variants_updated"`
+	Errors          []ProductImportError `json:"errors,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// ProductLabelItem selects the product, variant or lot to print labels for.
+// Lot labels carry the lot number and expiry date and encode the lot or serial
+// number in their barcode.
+type ProductLabelItem struct {
+	ProductID string  `json:"product_id"`
+	VariantID *string `json:"variant_id,omitempty"`
+	LotID     *string `json:"lot_id,omitempty"`
+	Copies    int     `json:"copies"` // Default 1
+}
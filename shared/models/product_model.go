@@ -65,6 +65,9 @@ type ProductModel struct {
 	Suppliers         []*ContactModel        `gorm:"many2many:product_contacts;constraint:OnDelete:CASCADE;" json:"suppliers,omitempty"`
 	MerchantStationID *string                `json:"merchant_station_id" gorm:"-"`
 	EnableStock       bool                   `gorm:"default:true" json:"enable_stock,omitempty"`
+	TrackingType      string                 `gorm:"type:varchar(10);default:'NONE'" json:"tracking_type,omitempty"` // NONE, LOT atau SERIAL
+	IsBundle          bool                   `gorm:"default:false" json:"is_bundle,omitempty"`                       // Paket yang stoknya diambil dari komponennya
+	BundleComponents  []BundleComponentModel `gorm:"foreignKey:BundleID" json:"bundle_components,omitempty"`
 }
 
 func (ProductModel) TableName() string {
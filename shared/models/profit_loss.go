@@ -29,6 +29,8 @@ type ProfitLossReport struct {
 	NetProfit         float64             `json:"net_profit"`
 	IncomeTax         float64             `json:"income_tax"`
 	NetProfitAfterTax float64             `json:"net_profit_after_tax"`
+	Group             *DimensionGroup     `json:"group,omitempty"`
+	Groups            []ProfitLossReport  `json:"groups,omitempty"`
 }
 
 type ProfitLossAccount struct {
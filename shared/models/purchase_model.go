@@ -25,6 +25,7 @@ const (
 
 type PurchaseOrderModel struct {
 	shared.BaseModel
+	AnalyticDimensions
 	PurchaseNumber        string                   `json:"purchase_number,omitempty"`
 	Code                  string                   `json:"code,omitempty"`
 	Description           string                   `json:"description,omitempty"`
@@ -36,6 +37,7 @@ type PurchaseOrderModel struct {
 	TotalBeforeDisc       float64                  `json:"total_before_disc,omitempty"`
 	TotalTax              float64                  `json:"total_tax,omitempty"`
 	TotalDiscount         float64                  `json:"total_discount,omitempty"`
+	TotalWithholding      float64                  `json:"total_withholding,omitempty"`
 	Status                string                   `json:"status,omitempty"`
 	StockStatus           string                   `json:"stock_status,omitempty" gorm:"default:'pending'"`
 	PurchaseDate          time.Time                `json:"purchase_date,omitempty"`
@@ -76,6 +78,9 @@ type PurchaseOrderModel struct {
 	MemberID              *string                  `json:"member_id,omitempty" gorm:"size:36"`
 	CooperativeMember     *CooperativeMemberModel  `json:"cooperative_member,omitempty" gorm:"-"`
 	Member                *MemberModel             `json:"member,omitempty" gorm:"-"`
+	CurrencyCode          string                   `json:"currency_code,omitempty" gorm:"type:varchar(3)"`
+	ExchangeRate          float64                  `json:"exchange_rate,omitempty"`
+	FunctionalTotal       float64                  `json:"functional_total,omitempty"`
 }
 
 func (s *PurchaseOrderModel) TableName() string {
@@ -124,13 +129,22 @@ type PurchaseOrderItemModel struct {
 	Variant            *VariantModel       `gorm:"foreignKey:VariantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"variant,omitempty"`
 	WarehouseID        *string             `json:"warehouse_id,omitempty"`
 	Warehouse          *WarehouseModel     `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	BinID              *string             `json:"bin_id,omitempty"`
+	Bin                *WarehouseBinModel  `gorm:"foreignKey:BinID;constraint:OnDelete:SET NULL" json:"bin,omitempty"`
 	TaxID              *string             `json:"tax_id,omitempty"`
 	Tax                *TaxModel           `gorm:"foreignKey:TaxID;constraint:Restrict:SET NULL" json:"tax,omitempty"`
 	TotalTax           float64             `json:"total_tax,omitempty"`
+	WithholdingTaxID   *string             `json:"withholding_tax_id,omitempty"`
+	WithholdingTax     *TaxModel           `gorm:"foreignKey:WithholdingTaxID;constraint:Restrict:SET NULL" json:"withholding_tax,omitempty"`
+	TotalWithholding   float64             `json:"total_withholding,omitempty"`
 	UnitID             *string             `json:"unit_id,omitempty"`
 	Unit               *UnitModel          `gorm:"foreignKey:UnitID;constraint:OnDelete:CASCADE" json:"unit,omitempty"`
 	UnitValue          float64             `json:"unit_value,omitempty" gorm:"default:1"`
+	BaseQuantity       float64             `json:"base_quantity,omitempty"`   // Quantity dalam satuan dasar (Quantity * UnitValue)
+	BaseUnitPrice      float64             `json:"base_unit_price,omitempty"` // Harga per satuan dasar (UnitPrice / UnitValue)
 	IsCost             bool                `json:"is_cost,omitempty" gorm:"default:false"`
+	LandedCost         float64             `json:"landed_cost,omitempty"` // Biaya landed cost yang dialokasikan ke item ini
+	LotTracking
 }
 
 func (s *PurchaseOrderItemModel) TableName() string {
@@ -162,6 +176,9 @@ type PurchasePaymentModel struct {
 	IsRefund           bool                `json:"is_refund"`
 	PaymentMethod      string              `gorm:"default:CASH" json:"payment_method"`
 	PaymentMethodNotes string              `json:"payment_method_notes"`
+	ExchangeRate       float64             `json:"exchange_rate"`
+	FxDifference       float64             `json:"fx_difference"`
+	Withholding        float64             `json:"withholding"`
 }
 
 func (s *PurchasePaymentModel) TableName() string {
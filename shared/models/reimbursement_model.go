@@ -10,6 +10,7 @@ import (
 
 type ReimbursementModel struct {
 	shared.BaseModel
+	AnalyticDimensions
 	AccountPayableID  *string                  `gorm:"size:36" json:"account_payable_id"`
 	AccountPayable    *AccountModel            `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;foreignKey:AccountPayableID" json:"-"`
 	AccountExpenseID  *string                  `gorm:"size:36" json:"account_expense_id"`
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReorderRuleModel holds the replenishment levels of a product in a warehouse.
+// Quantities are in the base unit of the product.
+//
+// A replenishment run suggests an order when the projected stock (on hand plus
+// incoming purchase orders minus reserved demand) is at or below ReorderPoint, or
+// below MinQuantity. It orders up to MaxQuantity, or up to the larger of
+// MinQuantity and ReorderPoint when no maximum is set, in multiples of
+// ReorderMultiple when one is set.
+type ReorderRuleModel struct {
+	shared.BaseModel
+	CompanyID       *string         `gorm:"type:char(36);index" json:"company_id"`
+	ProductID       string          `gorm:"type:char(36);index" json:"product_id"`
+	Product         *ProductModel   `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID       *string         `gorm:"type:char(36);index" json:"variant_id,omitempty"`
+	Variant         *VariantModel   `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"`
+	WarehouseID     string          `gorm:"type:char(36);index" json:"warehouse_id"`
+	Warehouse       *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	ReorderPoint    float64         `gorm:"default:0" json:"reorder_point"`
+	MinQuantity     float64         `gorm:"default:0" json:"min_quantity"`
+	MaxQuantity     float64         `gorm:"default:0" json:"max_quantity"`
+	ReorderMultiple float64         `gorm:"default:0" json:"reorder_multiple"`
+	VendorID        *string         `gorm:"type:char(36)" json:"vendor_id,omitempty"` // Pemasok utama
+	Vendor          *ContactModel   `gorm:"foreignKey:VendorID;constraint:OnDelete:SET NULL" json:"vendor,omitempty"`
+	LeadTimeDays    int             `gorm:"default:0" json:"lead_time_days"`
+	IsActive        bool            `gorm:"default:true" json:"is_active"`
+}
+
+func (ReorderRuleModel) TableName() string {
+	return "reorder_rules"
+}
+
+func (p *ReorderRuleModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// ReplenishmentSuggestion explains a suggested order of a replenishment run: the
+// stock figures it was computed from, the rule levels, the quantity to order and
+// the draft purchase order it was put on, if any.
+type ReplenishmentSuggestion struct {
+	RuleID          string    `json:"rule_id"`
+	ProductID       string    `json:"product_id"`
+	ProductName     string    `json:"product_name"`
+	VariantID       *string   `json:"variant_id,omitempty"`
+	WarehouseID     string    `json:"warehouse_id"`
+	WarehouseName   string    `json:"warehouse_name"`
+	VendorID        *string   `json:"vendor_id,omitempty"`
+	VendorName      string    `json:"vendor_name,omitempty"`
+	OnHand          float64   `json:"on_hand"`
+	Incoming        float64   `json:"incoming"`
+	Reserved        float64   `json:"reserved"`
+	Projected       float64   `json:"projected"`
+	ReorderPoint    float64   `json:"reorder_point"`
+	MinQuantity     float64   `json:"min_quantity"`
+	MaxQuantity     float64   `json:"max_quantity"`
+	Quantity        float64   `json:"quantity"`
+	UnitPrice       float64   `json:"unit_price"`
+	LeadTimeDays    int       `json:"lead_time_days"`
+	ExpectedDate    time.Time `json:"expected_date"`
+	Reason          string    `json:"reason"`
+	PurchaseOrderID *string   `json:"purchase_order_id,omitempty"`
+}
+
+// ReplenishmentReport is the result of a replenishment run.
+type ReplenishmentReport struct {
+	Date           time.Time                 `json:"date"`
+	Suggestions    []ReplenishmentSuggestion `json:"suggestions"`
+	PurchaseOrders []PurchaseOrderModel      `json:"purchase_orders"`
+}
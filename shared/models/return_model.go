@@ -66,6 +66,8 @@ type ReturnItemModel struct {
 	WarehouseID        *string         `json:"warehouse_id,omitempty"`
 	Warehouse          *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
 	Value              float64         `gorm:"not null;default:1" json:"value"`
+	BaseQuantity       float64         `json:"base_quantity,omitempty"`   // Quantity dalam satuan dasar (Quantity * Value)
+	BaseUnitPrice      float64         `json:"base_unit_price,omitempty"` // Harga per satuan dasar (UnitPrice / Value)
 	Total              float64         `json:"total,omitempty"`
 	SubTotal           float64         `json:"sub_total,omitempty"`
 }
@@ -65,7 +65,7 @@ var (
 	cruds    = []string{"create", "read", "update", "delete"}
 	services = map[string][]map[string][]string{
 		"auth":    {{"user": cruds, "admin": cruds, "rbac": cruds}},
-		"finance": {{"account": cruds, "transaction": cruds}},
+		"finance": {{"account": cruds, "transaction": cruds, "period_lock": append(cruds, "reopen")}},
 		"inventory": {
 			{"brand": cruds},
 			{"product_category": cruds},
@@ -27,6 +27,7 @@ const (
 
 type SalesModel struct {
 	shared.BaseModel
+	AnalyticDimensions
 	SalesNumber           string                  `json:"sales_number"`
 	Code                  string                  `json:"code"`
 	Description           string                  `json:"description"`
@@ -89,6 +90,9 @@ type SalesModel struct {
 	SalesUser             *UserModel              `json:"sales_user,omitempty" gorm:"foreignKey:SalesUserID;constraint:OnDelete:CASCADE"`
 	EmployeeID            *string                 `json:"employee_id,omitempty" gorm:"size:36"`
 	Employee              *EmployeeModel          `json:"employee,omitempty" gorm:"foreignKey:EmployeeID;constraint:OnDelete:CASCADE"`
+	CurrencyCode          string                  `json:"currency_code,omitempty" gorm:"type:varchar(3)"`
+	ExchangeRate          float64                 `json:"exchange_rate"`
+	FunctionalTotal       float64                 `json:"functional_total"`
 }
 
 func (s *SalesModel) AfterFind(tx *gorm.DB) (err error) {
@@ -119,35 +123,40 @@ func (s *SalesModel) AfterFind(tx *gorm.DB) (err error) {
 
 type SalesItemModel struct {
 	shared.BaseModel
-	SalesID            *string         `json:"sales_id,omitempty"`
-	Sales              *SalesModel     `gorm:"foreignKey:SalesID;constraint:OnDelete:CASCADE" json:"sales,omitempty"`
-	Description        string          `json:"description,omitempty"`
-	Notes              string          `json:"notes,omitempty"`
-	Quantity           float64         `json:"quantity,omitempty"`
-	BasePrice          float64         `json:"base_price,omitempty"`
-	UnitPrice          float64         `json:"unit_price,omitempty"`
-	Total              float64         `json:"total,omitempty"`
-	SubTotal           float64         `json:"sub_total,omitempty"`
-	DiscountPercent    float64         `json:"discount_percent,omitempty"`
-	DiscountAmount     float64         `json:"discount_amount,omitempty"`
-	SubtotalBeforeDisc float64         `json:"subtotal_before_disc,omitempty"`
-	ProductID          *string         `json:"product_id,omitempty"`
-	Product            *ProductModel   `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
-	VariantID          *string         `json:"variant_id,omitempty"`
-	Variant            *VariantModel   `gorm:"foreignKey:VariantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"variant,omitempty"`
-	WarehouseID        *string         `json:"warehouse_id,omitempty"`
-	Warehouse          *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
-	SaleAccountID      *string         `json:"sale_account_id,omitempty"`
-	SaleAccount        *AccountModel   `gorm:"foreignKey:SaleAccountID;constraint:OnDelete:CASCADE" json:"sale_account,omitempty"`
-	AssetAccountID     *string         `json:"asset_account_id,omitempty"`
-	AssetAccount       *AccountModel   `gorm:"foreignKey:AssetAccountID;constraint:OnDelete:CASCADE" json:"asset_account,omitempty"`
-	TaxID              *string         `json:"tax_id,omitempty"`
-	Tax                *TaxModel       `gorm:"foreignKey:TaxID;constraint:Restrict:SET NULL" json:"tax,omitempty"`
-	TotalTax           float64         `json:"total_tax,omitempty"`
-	UnitID             *string         `json:"unit_id,omitempty"`
-	Unit               *UnitModel      `gorm:"foreignKey:UnitID;constraint:OnDelete:CASCADE" json:"unit,omitempty"`
-	UnitValue          float64         `json:"unit_value,omitempty" gorm:"default:1"`
-	IsCost             bool            `json:"is_cost,omitempty" gorm:"default:false"`
+	SalesID            *string            `json:"sales_id,omitempty"`
+	Sales              *SalesModel        `gorm:"foreignKey:SalesID;constraint:OnDelete:CASCADE" json:"sales,omitempty"`
+	Description        string             `json:"description,omitempty"`
+	Notes              string             `json:"notes,omitempty"`
+	Quantity           float64            `json:"quantity,omitempty"`
+	BasePrice          float64            `json:"base_price,omitempty"`
+	UnitPrice          float64            `json:"unit_price,omitempty"`
+	Total              float64            `json:"total,omitempty"`
+	SubTotal           float64            `json:"sub_total,omitempty"`
+	DiscountPercent    float64            `json:"discount_percent,omitempty"`
+	DiscountAmount     float64            `json:"discount_amount,omitempty"`
+	SubtotalBeforeDisc float64            `json:"subtotal_before_disc,omitempty"`
+	ProductID          *string            `json:"product_id,omitempty"`
+	Product            *ProductModel      `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID          *string            `json:"variant_id,omitempty"`
+	Variant            *VariantModel      `gorm:"foreignKey:VariantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"variant,omitempty"`
+	WarehouseID        *string            `json:"warehouse_id,omitempty"`
+	Warehouse          *WarehouseModel    `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	BinID              *string            `json:"bin_id,omitempty"`
+	Bin                *WarehouseBinModel `gorm:"foreignKey:BinID;constraint:OnDelete:SET NULL" json:"bin,omitempty"`
+	SaleAccountID      *string            `json:"sale_account_id,omitempty"`
+	SaleAccount        *AccountModel      `gorm:"foreignKey:SaleAccountID;constraint:OnDelete:CASCADE" json:"sale_account,omitempty"`
+	AssetAccountID     *string            `json:"asset_account_id,omitempty"`
+	AssetAccount       *AccountModel      `gorm:"foreignKey:AssetAccountID;constraint:OnDelete:CASCADE" json:"asset_account,omitempty"`
+	TaxID              *string            `json:"tax_id,omitempty"`
+	Tax                *TaxModel          `gorm:"foreignKey:TaxID;constraint:Restrict:SET NULL" json:"tax,omitempty"`
+	TotalTax           float64            `json:"total_tax,omitempty"`
+	UnitID             *string            `json:"unit_id,omitempty"`
+	Unit               *UnitModel         `gorm:"foreignKey:UnitID;constraint:OnDelete:CASCADE" json:"unit,omitempty"`
+	UnitValue          float64            `json:"unit_value,omitempty" gorm:"default:1"`
+	BaseQuantity       float64            `json:"base_quantity,omitempty"`   // Quantity dalam satuan dasar (Quantity * UnitValue)
+	BaseUnitPrice      float64            `json:"base_unit_price,omitempty"` // Harga per satuan dasar (UnitPrice / UnitValue)
+	IsCost             bool               `json:"is_cost,omitempty" gorm:"default:false"`
+	LotTracking
 }
 
 func (s *SalesModel) TableName() string {
@@ -189,6 +198,12 @@ type SalesPaymentModel struct {
 	IsRefund           bool          `json:"is_refund"`
 	PaymentMethod      string        `gorm:"default:CASH" json:"payment_method"`
 	PaymentMethodNotes string        `json:"payment_method_notes"`
+	ExchangeRate       float64       `json:"exchange_rate"`
+	FxDifference       float64       `json:"fx_difference"`
+	WithholdingTaxID   *string       `json:"withholding_tax_id,omitempty"`
+	WithholdingTax     *TaxModel     `gorm:"foreignKey:WithholdingTaxID;constraint:OnDelete:SET NULL" json:"withholding_tax,omitempty"`
+	Withholding        float64       `json:"withholding"`
+	WithholdingSlip    string        `json:"withholding_slip,omitempty"` // Nomor bukti potong dari customer
 }
 
 func (s *SalesPaymentModel) TableName() string {
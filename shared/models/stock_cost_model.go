@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StockCostLayerModel is a FIFO cost layer: the stock brought into a warehouse by
+// an incoming movement that has not been issued yet. Quantities are in the base
+// unit of the product (quantity * value of the movement).
+type StockCostLayerModel struct {
+	shared.BaseModel
+	CompanyID         *string   `gorm:"type:char(36);index" json:"company_id"`
+	ProductID         string    `gorm:"type:char(36);index" json:"product_id"`
+	VariantID         *string   `gorm:"type:char(36);index" json:"variant_id,omitempty"`
+	WarehouseID       string    `gorm:"type:char(36);index" json:"warehouse_id"`
+	MovementID        string    `gorm:"type:char(36);index" json:"movement_id"`
+	Date              time.Time `json:"date"`
+	Quantity          float64   `json:"quantity"`
+	UnitCost          float64   `json:"unit_cost"`
+	RemainingQuantity float64   `json:"remaining_quantity"`
+	RemainingCost     float64   `json:"remaining_cost"`
+}
+
+func (StockCostLayerModel) TableName() string {
+	return "stock_cost_layers"
+}
+
+func (p *StockCostLayerModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// StockCostConsumptionModel records the part of a layer issued by an outgoing
+// movement, so the layer can be restored when the movement is deleted.
+type StockCostConsumptionModel struct {
+	shared.BaseModel
+	LayerID    string  `gorm:"type:char(36);index" json:"layer_id"`
+	MovementID string  `gorm:"type:char(36);index" json:"movement_id"`
+	Quantity   float64 `json:"quantity"`
+	Cost       float64 `json:"cost"`
+}
+
+func (StockCostConsumptionModel) TableName() string {
+	return "stock_cost_consumptions"
+}
+
+func (p *StockCostConsumptionModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// StockValuation is the quantity and value of a product in a warehouse as of a
+// date, summed from the cost of the stock movements up to that date.
+type StockValuation struct {
+	WarehouseID   string  `json:"warehouse_id"`
+	WarehouseName string  `json:"warehouse_name"`
+	ProductID     string  `json:"product_id"`
+	ProductName   string  `json:"product_name"`
+	VariantID     *string `json:"variant_id,omitempty"`
+	Quantity      float64 `json:"quantity"`
+	Value         float64 `json:"value"`
+	UnitCost      float64 `json:"unit_cost"`
+}
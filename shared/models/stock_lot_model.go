@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	TRACKING_NONE   = "NONE"
+	TRACKING_LOT    = "LOT"
+	TRACKING_SERIAL = "SERIAL"
+)
+
+// LotTracking is embedded in the lines of documents that move stock of lot or
+// serial tracked products. A line of a lot tracked product carries one lot; a line
+// of a serial tracked product carries one serial number per base unit. Outgoing
+// lines without a lot or serial numbers are picked first expired, first out.
+type LotTracking struct {
+	LotNumber       string         `gorm:"type:varchar(100)" json:"lot_number,omitempty"`
+	SerialNumbers   pq.StringArray `gorm:"type:text[]" json:"serial_numbers,omitempty"`
+	ManufactureDate *time.Time     `json:"manufacture_date,omitempty"`
+	ExpiryDate      *time.Time     `json:"expiry_date,omitempty"`
+}
+
+// IsEmpty reports whether the line names no lot and no serial number.
+func (t LotTracking) IsEmpty() bool {
+	return t.LotNumber == "" && len(t.SerialNumbers) == 0
+}
+
+// StockLotModel is a lot (batch) of a product, or a single serial numbered unit
+// when SerialNumber is set. The stock of a lot is the sum of the stock movements
+// that carry it.
+type StockLotModel struct {
+	shared.BaseModel
+	CompanyID       *string       `gorm:"type:char(36);index" json:"company_id"`
+	ProductID       string        `gorm:"type:char(36);index" json:"product_id"`
+	Product         *ProductModel `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID       *string       `gorm:"type:char(36);index" json:"variant_id,omitempty"`
+	LotNumber       string        `gorm:"type:varchar(100);index" json:"lot_number"`
+	SerialNumber    *string       `gorm:"type:varchar(100);index" json:"serial_number,omitempty"`
+	ManufactureDate *time.Time    `json:"manufacture_date,omitempty"`
+	ExpiryDate      *time.Time    `gorm:"index" json:"expiry_date,omitempty"`
+}
+
+func (StockLotModel) TableName() string {
+	return "stock_lots"
+}
+
+func (p *StockLotModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// LotStock is the stock of a lot in a warehouse.
+type LotStock struct {
+	LotID           string     `json:"lot_id"`
+	LotNumber       string     `json:"lot_number"`
+	SerialNumber    *string    `json:"serial_number,omitempty"`
+	ProductID       string     `json:"product_id"`
+	ProductName     string     `json:"product_name"`
+	VariantID       *string    `json:"variant_id,omitempty"`
+	WarehouseID     string     `json:"warehouse_id"`
+	WarehouseName   string     `json:"warehouse_name"`
+	ManufactureDate *time.Time `json:"manufacture_date,omitempty"`
+	ExpiryDate      *time.Time `json:"expiry_date,omitempty"`
+	Quantity        float64    `json:"quantity"`
+}
+
+// LotTrace follows a lot from its receipts to the customers that received it,
+// for recalls.
+type LotTrace struct {
+	Lot        StockLotModel      `json:"lot"`
+	Stock      []LotStock         `json:"stock"`
+	Receipts   []LotTraceMovement `json:"receipts"`
+	Deliveries []LotTraceMovement `json:"deliveries"`
+}
+
+// LotTraceMovement is a movement of a traced lot with the document and the
+// contact it went to or came from.
+type LotTraceMovement struct {
+	MovementID     string       `json:"movement_id"`
+	Date           time.Time    `json:"date"`
+	Type           MovementType `json:"type"`
+	WarehouseID    string       `json:"warehouse_id"`
+	Quantity       float64      `json:"quantity"`
+	ReferenceID    string       `json:"reference_id"`
+	ReferenceType  *string      `json:"reference_type,omitempty"`
+	DocumentNumber string       `json:"document_number,omitempty"`
+	ContactID      *string      `json:"contact_id,omitempty"`
+	ContactName    string       `json:"contact_name,omitempty"`
+}
@@ -23,6 +23,7 @@ const (
 	MovementTypeDamage      MovementType = "DAMAGE"       // Stok rusak/hilang
 	MovementTypeLost        MovementType = "LOST"         // Stok hilang
 	MovementTypeSpoiled     MovementType = "SPOILED"      // Stok rusak
+	MovementTypeLandedCost  MovementType = "LANDED_COST"  // Tambahan nilai stok dari biaya landed cost
 )
 
 type StockMovementModel struct {
@@ -33,8 +34,13 @@ type StockMovementModel struct {
 	Product           ProductModel        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:ProductID" json:"product"`
 	VariantID         *string             `json:"variant_id,omitempty"`
 	Variant           *VariantModel       `gorm:"foreignKey:VariantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
-	SourceWarehouseID string              `gorm:"-" json:"source_warehouse_id"` // Relasi ke warehouse
-	WarehouseID       string              `gorm:"not null" json:"warehouse_id"` // Relasi ke warehouse
+	LotID             *string             `gorm:"type:char(36);index" json:"lot_id,omitempty"` // Relasi ke lot / nomor seri
+	Lot               *StockLotModel      `gorm:"foreignKey:LotID;constraint:OnDelete:SET NULL" json:"lot,omitempty"`
+	SourceWarehouseID string              `gorm:"-" json:"source_warehouse_id"`                   // Relasi ke warehouse
+	WarehouseID       string              `gorm:"not null" json:"warehouse_id"`                   // Relasi ke warehouse
+	BinID             *string             `gorm:"type:char(36);index" json:"bin_id,omitempty"`    // Relasi ke bin / rak di dalam warehouse
+	BundleID          *string             `gorm:"type:char(36);index" json:"bundle_id,omitempty"` // Produk bundle yang dijual, bila pergerakan ini komponennya
+	Bin               *WarehouseBinModel  `gorm:"foreignKey:BinID;constraint:OnDelete:SET NULL" json:"bin,omitempty"`
 	Warehouse         WarehouseModel      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:WarehouseID" json:"warehouse"`
 	MerchantID        *string             `gorm:"null" json:"merchant_id"` // Relasi ke merchant
 	Merchant          *MerchantModel      `gorm:"foreignKey:MerchantID;constraint:OnDelete:CASCADE" json:"merchant"`
@@ -51,6 +57,8 @@ type StockMovementModel struct {
 	SecondaryRefType  *string             `gorm:"secondary_ref_type" json:"secondary_ref_type,omitempty"`
 	UnitID            *string             `json:"unit_id,omitempty"` // Relasi ke unit
 	Unit              *UnitModel          `gorm:"foreignKey:UnitID;constraint:OnDelete:CASCADE" json:"unit,omitempty"`
+	UnitCost          float64             `gorm:"not null;default:0" json:"unit_cost"`  // Harga pokok per satuan dasar (quantity * value)
+	TotalCost         float64             `gorm:"not null;default:0" json:"total_cost"` // Nilai persediaan (positif untuk masuk, negatif untuk keluar)
 	SalesRef          *SalesModel         `gorm:"-" json:"sales_ref,omitempty"`
 	PurchaseRef       *PurchaseOrderModel `gorm:"-" json:"purchase_ref,omitempty"`
 	ReturnRef         *ReturnModel        `gorm:"-" json:"return_ref,omitempty"`
@@ -19,17 +19,18 @@ const (
 
 type StockOpnameHeader struct {
 	shared.BaseModel
-	StockOpnameNumber string              `json:"stock_opname_number,omitempty"`
-	CompanyID         *string             `json:"company_id,omitempty"`                                                           // ID perusahaan
-	Company           *CompanyModel       `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`      // Relasi ke perusahaan
-	WarehouseID       string              `gorm:"not null" json:"warehouse_id"`                                                   // ID gudang
-	Warehouse         WarehouseModel      `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`  // Relasi ke gudang
-	Status            StockOpnameStatus   `gorm:"not null;default:DRAFT" json:"status"`                                           // Status stock opname
-	OpnameDate        time.Time           `gorm:"not null" json:"opname_date"`                                                    // Tanggal stock opname
-	Notes             string              `json:"notes,omitempty"`                                                                // Catatan tambahan
-	Details           []StockOpnameDetail `gorm:"foreignKey:StockOpnameID;constraint:OnDelete:CASCADE" json:"details,omitempty"`  // Detail produk
-	CreatedByID       *string             `json:"created_by_id,omitempty"`                                                        // ID user yang membuat stock opname
-	CreatedBy         *UserModel          `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE" json:"created_by,omitempty"` // Relasi ke user yang membuat stock opname
+	StockOpnameNumber  string              `json:"stock_opname_number,omitempty"`
+	CompanyID          *string             `json:"company_id,omitempty"`                                                           // ID perusahaan
+	Company            *CompanyModel       `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`      // Relasi ke perusahaan
+	WarehouseID        string              `gorm:"not null" json:"warehouse_id"`                                                   // ID gudang
+	Warehouse          WarehouseModel      `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`  // Relasi ke gudang
+	Status             StockOpnameStatus   `gorm:"not null;default:DRAFT" json:"status"`                                           // Status stock opname
+	OpnameDate         time.Time           `gorm:"not null" json:"opname_date"`                                                    // Tanggal stock opname
+	Notes              string              `json:"notes,omitempty"`                                                                // Catatan tambahan
+	Details            []StockOpnameDetail `gorm:"foreignKey:StockOpnameID;constraint:OnDelete:CASCADE" json:"details,omitempty"`  // Detail produk
+	CreatedByID        *string             `json:"created_by_id,omitempty"`                                                        // ID user yang membuat stock opname
+	CreatedBy          *UserModel          `gorm:"foreignKey:CreatedByID;constraint:OnDelete:CASCADE" json:"created_by,omitempty"` // Relasi ke user yang membuat stock opname
+	CycleCountPolicyID *string             `gorm:"type:char(36);index" json:"cycle_count_policy_id,omitempty"`                     // Kebijakan cycle count yang membuat batch ini
 }
 
 func (s *StockOpnameHeader) BeforeCreate(tx *gorm.DB) (err error) {
@@ -42,19 +43,24 @@ func (s *StockOpnameHeader) BeforeCreate(tx *gorm.DB) (err error) {
 
 type StockOpnameDetail struct {
 	shared.BaseModel
-	StockOpnameID string        `gorm:"not null" json:"stock_opname_id,omitempty"`                                 // ID stock opname header
-	ProductID     string        `json:"product_id,omitempty"`                                                      // ID produk
-	Product       ProductModel  `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"` // Relasi ke produk
-	VariantID     *string       `json:"variant_id,omitempty"`
-	Variant       *VariantModel `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"` // Relasi ke varian
-	Quantity      float64       `gorm:"not null" json:"quantity"`                                                  // Jumlah stok fisik
-	SystemQty     float64       `gorm:"not null" json:"system_qty"`                                                // Jumlah stok di sistem
-	Difference    float64       `gorm:"not null" json:"difference"`                                                // Selisih stok (Quantity - SystemQty)
-	UnitID        *string       `json:"unit_id,omitempty"`                                                         // Relasi ke unit
-	Unit          *UnitModel    `gorm:"foreignKey:UnitID;constraint:OnDelete:CASCADE" json:"unit,omitempty"`
-	UnitValue     float64       `gorm:"not null;default:1" json:"unit_value,omitempty"`
-	UnitPrice     float64       `gorm:"not null" json:"unit_price,omitempty"`
-	Notes         string        `json:"notes,omitempty"` // Catatan tambahan
+	StockOpnameID string             `gorm:"not null" json:"stock_opname_id,omitempty"`                                 // ID stock opname header
+	ProductID     string             `json:"product_id,omitempty"`                                                      // ID produk
+	Product       ProductModel       `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"` // Relasi ke produk
+	VariantID     *string            `json:"variant_id,omitempty"`
+	Variant       *VariantModel      `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"` // Relasi ke varian
+	BinID         *string            `json:"bin_id,omitempty"`                                                          // Bin yang dihitung, kosong untuk seluruh warehouse
+	Bin           *WarehouseBinModel `gorm:"foreignKey:BinID;constraint:OnDelete:SET NULL" json:"bin,omitempty"`
+	Quantity      float64            `gorm:"not null" json:"quantity"`   // Jumlah stok fisik
+	SystemQty     float64            `gorm:"not null" json:"system_qty"` // Jumlah stok di sistem
+	Difference    float64            `gorm:"not null" json:"difference"` // Selisih stok dalam satuan dasar (BaseQuantity - SystemQty)
+	UnitID        *string            `json:"unit_id,omitempty"`          // Relasi ke unit
+	Unit          *UnitModel         `gorm:"foreignKey:UnitID;constraint:OnDelete:CASCADE" json:"unit,omitempty"`
+	UnitValue     float64            `gorm:"not null;default:1" json:"unit_value,omitempty"`
+	BaseQuantity  float64            `json:"base_quantity"` // Jumlah stok fisik dalam satuan dasar (Quantity * UnitValue)
+	UnitPrice     float64            `gorm:"not null" json:"unit_price,omitempty"`
+	Notes         string             `json:"notes,omitempty"`                 // Catatan tambahan
+	IsPending     bool               `gorm:"default:false" json:"is_pending"` // Baris cycle count yang belum dihitung
+	LotTracking
 }
 
 func (d *StockOpnameDetail) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	RESERVATION_SOFT = "SOFT" // Klaim sementara, misalnya keranjang belanja
+	RESERVATION_HARD = "HARD" // Klaim pasti, misalnya sales order yang dikonfirmasi
+
+	RESERVATION_ACTIVE    = "ACTIVE"
+	RESERVATION_RELEASED  = "RELEASED"
+	RESERVATION_FULFILLED = "FULFILLED"
+	RESERVATION_EXPIRED   = "EXPIRED"
+)
+
+// StockReservationModel claims a base quantity of a product in a warehouse for a
+// document that has not taken the stock out yet.
+//
+// A hard reservation is made for a confirmed order and only has to fit in the
+// stock on hand minus the other hard reservations. A soft reservation, made for
+// a cart, has to fit in the stock left by all other reservations and yields to
+// hard ones. An active reservation whose ExpiresAt has passed no longer counts.
+//
+// A bundle holds no stock of its own, so a reservation of a bundle is stored as
+// one reservation per component, which refers back to the bundle.
+type StockReservationModel struct {
+	shared.BaseModel
+	CompanyID      *string         `gorm:"type:char(36);index" json:"company_id,omitempty"`
+	MerchantID     *string         `gorm:"type:char(36);index" json:"merchant_id,omitempty"`
+	ProductID      string          `gorm:"type:char(36);index;not null" json:"product_id"`
+	Product        *ProductModel   `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID      *string         `gorm:"type:char(36);index" json:"variant_id,omitempty"`
+	Variant        *VariantModel   `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"`
+	WarehouseID    string          `gorm:"type:char(36);index;not null" json:"warehouse_id"`
+	Warehouse      *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	Quantity       float64         `gorm:"not null" json:"quantity"`                              // Jumlah dalam satuan dasar
+	Type           string          `gorm:"type:varchar(10);not null;default:'HARD'" json:"type"`  // SOFT, HARD
+	Status         string          `gorm:"type:varchar(20);index;default:'ACTIVE'" json:"status"` // ACTIVE, RELEASED, FULFILLED, EXPIRED
+	ReferenceID    string          `gorm:"type:char(36);index" json:"reference_id"`               // ID dokumen (sales, offer, pos, cart)
+	ReferenceType  string          `gorm:"type:varchar(50);index" json:"reference_type"`          // sales, offer, pos, cart
+	SecondaryRefID *string         `gorm:"type:char(36)" json:"secondary_ref_id,omitempty"`       // ID baris dokumen
+	BundleID       *string         `gorm:"type:char(36);index" json:"bundle_id,omitempty"`        // Produk bundle yang dipesan, bila reservasi ini komponennya
+	ExpiresAt      *time.Time      `json:"expires_at,omitempty"`
+	ClosedAt       *time.Time      `json:"closed_at,omitempty"` // Waktu dilepas, dipenuhi atau kedaluwarsa
+	Notes          string          `json:"notes,omitempty"`
+}
+
+func (StockReservationModel) TableName() string {
+	return "stock_reservations"
+}
+
+func (p *StockReservationModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// AvailableToPromise is the stock of a product in a warehouse that can still be
+// promised: on hand minus reserved plus incoming. Quantities are in the base unit
+// of the product.
+type AvailableToPromise struct {
+	ProductID    string  `json:"product_id"`
+	VariantID    *string `json:"variant_id,omitempty"`
+	WarehouseID  string  `json:"warehouse_id"`
+	OnHand       float64 `json:"on_hand"`
+	HardReserved float64 `json:"hard_reserved"`
+	SoftReserved float64 `json:"soft_reserved"`
+	Reserved     float64 `json:"reserved"`
+	Incoming     float64 `json:"incoming"`
+	Available    float64 `json:"available"`
+}
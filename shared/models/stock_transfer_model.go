@@ -0,0 +1,154 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	TRANSFER_DRAFT              = "DRAFT"
+	TRANSFER_SHIPPED            = "SHIPPED"            // Barang sudah keluar dari gudang asal, dalam perjalanan
+	TRANSFER_PARTIALLY_RECEIVED = "PARTIALLY_RECEIVED" // Sebagian barang sudah diterima
+	TRANSFER_RECEIVED           = "RECEIVED"           // Semua barang sudah diterima atau dicatat selisihnya
+	TRANSFER_CANCELLED          = "CANCELLED"
+)
+
+// StockTransferModel is a transfer of stock between two warehouses of a company.
+//
+// Shipping a transfer takes the stock out of the source warehouse into the
+// virtual in-transit warehouse of the company; receipts take it from there into
+// the destination warehouse. Quantities that do not arrive are recorded as a
+// discrepancy and leave the in-transit warehouse as an adjustment.
+type StockTransferModel struct {
+	shared.BaseModel
+	TransferNumber         string                      `json:"transfer_number,omitempty"`
+	CompanyID              *string                     `gorm:"type:char(36);index" json:"company_id,omitempty"`
+	Company                *CompanyModel               `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Date                   time.Time                   `json:"date"`
+	SourceWarehouseID      string                      `gorm:"type:char(36);index;not null" json:"source_warehouse_id"`
+	SourceWarehouse        *WarehouseModel             `gorm:"foreignKey:SourceWarehouseID;constraint:OnDelete:CASCADE" json:"source_warehouse,omitempty"`
+	DestinationWarehouseID string                      `gorm:"type:char(36);index;not null" json:"destination_warehouse_id"`
+	DestinationWarehouse   *WarehouseModel             `gorm:"foreignKey:DestinationWarehouseID;constraint:OnDelete:CASCADE" json:"destination_warehouse,omitempty"`
+	TransitWarehouseID     *string                     `gorm:"type:char(36)" json:"transit_warehouse_id,omitempty"` // Diisi saat dikirim
+	TransitWarehouse       *WarehouseModel             `gorm:"foreignKey:TransitWarehouseID;constraint:OnDelete:SET NULL" json:"transit_warehouse,omitempty"`
+	ShipmentID             *string                     `gorm:"type:char(36);index" json:"shipment_id,omitempty"` // Pengiriman di modul logistic, opsional
+	Shipment               *ShipmentModel              `gorm:"foreignKey:ShipmentID;constraint:OnDelete:SET NULL" json:"shipment,omitempty"`
+	Status                 string                      `gorm:"type:varchar(20);index;default:'DRAFT'" json:"status"`
+	ShippedAt              *time.Time                  `json:"shipped_at,omitempty"`
+	ShippedByID            *string                     `json:"shipped_by_id,omitempty"`
+	ShippedBy              *UserModel                  `gorm:"foreignKey:ShippedByID;constraint:OnDelete:SET NULL" json:"shipped_by,omitempty"`
+	ReceivedAt             *time.Time                  `json:"received_at,omitempty"`
+	Notes                  string                      `gorm:"type:text" json:"notes,omitempty"`
+	Items                  []StockTransferItemModel    `gorm:"foreignKey:TransferID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	Receipts               []StockTransferReceiptModel `gorm:"foreignKey:TransferID;constraint:OnDelete:CASCADE" json:"receipts,omitempty"`
+	CreatedByID            *string                     `json:"created_by_id,omitempty"`
+	CreatedBy              *UserModel                  `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL" json:"created_by,omitempty"`
+}
+
+func (StockTransferModel) TableName() string {
+	return "stock_transfers"
+}
+
+func (p *StockTransferModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// StockTransferItemModel is a product on a stock transfer. Quantity is in the unit
+// of the item; the shipped, received and discrepancy quantities are in the base
+// unit of the product.
+type StockTransferItemModel struct {
+	shared.BaseModel
+	TransferID          string              `gorm:"type:char(36);index;not null" json:"transfer_id"`
+	Transfer            *StockTransferModel `gorm:"foreignKey:TransferID;constraint:OnDelete:CASCADE" json:"transfer,omitempty"`
+	ProductID           string              `gorm:"type:char(36);index;not null" json:"product_id"`
+	Product             *ProductModel       `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product,omitempty"`
+	VariantID           *string             `gorm:"type:char(36)" json:"variant_id,omitempty"`
+	Variant             *VariantModel       `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"variant,omitempty"`
+	Description         string              `json:"description,omitempty"`
+	Quantity            float64             `json:"quantity"`
+	UnitID              *string             `json:"unit_id,omitempty"`
+	Unit                *UnitModel          `gorm:"foreignKey:UnitID;constraint:OnDelete:SET NULL" json:"unit,omitempty"`
+	UnitValue           float64             `gorm:"default:1" json:"unit_value"`
+	BaseQuantity        float64             `json:"base_quantity"`        // Quantity dalam satuan dasar
+	ShippedQuantity     float64             `json:"shipped_quantity"`     // Dalam satuan dasar
+	ReceivedQuantity    float64             `json:"received_quantity"`    // Dalam satuan dasar
+	DiscrepancyQuantity float64             `json:"discrepancy_quantity"` // Dalam satuan dasar, tidak sampai di tujuan
+	UnitCost            float64             `json:"unit_cost"`            // Biaya per satuan dasar saat dikirim
+	SourceBinID         *string             `gorm:"type:char(36)" json:"source_bin_id,omitempty"`
+	SourceBin           *WarehouseBinModel  `gorm:"foreignKey:SourceBinID;constraint:OnDelete:SET NULL" json:"source_bin,omitempty"`
+	DestinationBinID    *string             `gorm:"type:char(36)" json:"destination_bin_id,omitempty"`
+	DestinationBin      *WarehouseBinModel  `gorm:"foreignKey:DestinationBinID;constraint:OnDelete:SET NULL" json:"destination_bin,omitempty"`
+	Notes               string              `json:"notes,omitempty"`
+}
+
+func (StockTransferItemModel) TableName() string {
+	return "stock_transfer_items"
+}
+
+func (p *StockTransferItemModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// InTransitQuantity returns the base quantity of the item that was shipped but
+// neither received nor recorded as a discrepancy yet.
+func (p StockTransferItemModel) InTransitQuantity() float64 {
+	return p.ShippedQuantity - p.ReceivedQuantity - p.DiscrepancyQuantity
+}
+
+// StockTransferReceiptModel records goods of a shipped transfer arriving at the
+// destination warehouse. A transfer can be received in several receipts.
+type StockTransferReceiptModel struct {
+	shared.BaseModel
+	TransferID   string                          `gorm:"type:char(36);index;not null" json:"transfer_id"`
+	Date         time.Time                       `json:"date"`
+	Notes        string                          `gorm:"type:text" json:"notes,omitempty"`
+	Items        []StockTransferReceiptItemModel `gorm:"foreignKey:ReceiptID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	ReceivedByID *string                         `json:"received_by_id,omitempty"`
+	ReceivedBy   *UserModel                      `gorm:"foreignKey:ReceivedByID;constraint:OnDelete:SET NULL" json:"received_by,omitempty"`
+}
+
+func (StockTransferReceiptModel) TableName() string {
+	return "stock_transfer_receipts"
+}
+
+func (p *StockTransferReceiptModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// StockTransferReceiptItemModel is the receipt of a transfer item. Quantity and
+// DiscrepancyQuantity are in the unit of the transfer item: what arrived, and
+// what is known not to arrive, e.g. lost or damaged on the way.
+type StockTransferReceiptItemModel struct {
+	shared.BaseModel
+	ReceiptID           string                  `gorm:"type:char(36);index;not null" json:"receipt_id"`
+	TransferItemID      string                  `gorm:"type:char(36);index;not null" json:"transfer_item_id"`
+	TransferItem        *StockTransferItemModel `gorm:"foreignKey:TransferItemID;constraint:OnDelete:CASCADE" json:"transfer_item,omitempty"`
+	Quantity            float64                 `json:"quantity"`
+	DiscrepancyQuantity float64                 `json:"discrepancy_quantity"`
+	BaseQuantity        float64                 `json:"base_quantity"`
+	BaseDiscrepancy     float64                 `json:"base_discrepancy"`
+	DiscrepancyReason   string                  `json:"discrepancy_reason,omitempty"`
+}
+
+func (StockTransferReceiptItemModel) TableName() string {
+	return "stock_transfer_receipt_items"
+}
+
+func (p *StockTransferReceiptItemModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
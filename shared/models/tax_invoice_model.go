@@ -0,0 +1,131 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	TAX_INVOICE_OUTPUT = "OUTPUT"
+	TAX_INVOICE_INPUT  = "INPUT"
+
+	TAX_INVOICE_ISSUED    = "ISSUED"
+	TAX_INVOICE_REPLACED  = "REPLACED"
+	TAX_INVOICE_CANCELLED = "CANCELLED"
+)
+
+// TaxInvoiceSerialRangeModel is a range of tax invoice serial numbers (NSFP)
+// given to a company by the tax office. LastSerial is the last number issued
+// from the range.
+type TaxInvoiceSerialRangeModel struct {
+	shared.BaseModel
+	CompanyID   *string       `json:"company_id" gorm:"type:char(36);index"`
+	Company     *CompanyModel `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Year        int           `json:"year"`
+	StartSerial string        `json:"start_serial" gorm:"type:varchar(13)"`
+	EndSerial   string        `json:"end_serial" gorm:"type:varchar(13)"`
+	LastSerial  string        `json:"last_serial" gorm:"type:varchar(13)"`
+	Notes       string        `json:"notes"`
+}
+
+func (TaxInvoiceSerialRangeModel) TableName() string {
+	return "tax_invoice_serial_ranges"
+}
+
+func (t *TaxInvoiceSerialRangeModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// TaxInvoiceModel is a tax invoice (faktur pajak) of a sales invoice (output
+// tax) or of a purchase bill (input tax). The customer or supplier data and the
+// amounts in rupiah are copied when the tax invoice is issued.
+type TaxInvoiceModel struct {
+	shared.BaseModel
+	CompanyID         *string             `json:"company_id" gorm:"type:char(36);index"`
+	Company           *CompanyModel       `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Direction         string              `json:"direction" gorm:"type:varchar(10);index"`
+	SalesID           *string             `json:"sales_id,omitempty" gorm:"type:char(36);index"`
+	Sales             *SalesModel         `gorm:"foreignKey:SalesID;constraint:OnDelete:CASCADE" json:"sales,omitempty"`
+	PurchaseID        *string             `json:"purchase_id,omitempty" gorm:"type:char(36);index"`
+	Purchase          *PurchaseOrderModel `gorm:"foreignKey:PurchaseID;constraint:OnDelete:CASCADE" json:"purchase,omitempty"`
+	ContactID         *string             `json:"contact_id,omitempty" gorm:"type:char(36)"`
+	Contact           *ContactModel       `gorm:"foreignKey:ContactID;constraint:OnDelete:SET NULL" json:"contact,omitempty"`
+	TransactionCode   string              `json:"transaction_code" gorm:"type:varchar(2)"`
+	IsReplacement     bool                `json:"is_replacement"`
+	ReplacedInvoiceID *string             `json:"replaced_invoice_id,omitempty" gorm:"type:char(36)"`
+	SerialNumber      string              `json:"serial_number" gorm:"type:varchar(13);index"`
+	Date              time.Time           `json:"date"`
+	Month             int                 `json:"month"`
+	Year              int                 `json:"year"`
+	TaxPayerNumber    string              `json:"tax_payer_number"`
+	Name              string              `json:"name"`
+	Address           string              `json:"address"`
+	Reference         string              `json:"reference"`
+	TaxBase           float64             `json:"tax_base"`
+	VAT               float64             `json:"vat"`
+	Objects           string              `json:"objects" gorm:"type:json"`
+	Creditable        bool                `json:"creditable"`
+	Status            string              `json:"status" gorm:"type:varchar(20);default:'ISSUED'"`
+	ExportedAt        *time.Time          `json:"exported_at,omitempty"`
+	CancelledAt       *time.Time          `json:"cancelled_at,omitempty"`
+}
+
+func (TaxInvoiceModel) TableName() string {
+	return "tax_invoices"
+}
+
+func (t *TaxInvoiceModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// TaxInvoiceObject is a good or service of a tax invoice, stored as JSON in
+// TaxInvoiceModel.Objects.
+type TaxInvoiceObject struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	UnitPrice float64 `json:"unit_price"`
+	Quantity  float64 `json:"quantity"`
+	Total     float64 `json:"total"`
+	Discount  float64 `json:"discount"`
+	TaxBase   float64 `json:"tax_base"`
+	VAT       float64 `json:"vat"`
+}
+
+// VATRecap is the monthly PPN recap of a company. The tax invoice totals are
+// reconciled against the balances booked on the accounts of the PPN taxes.
+type VATRecap struct {
+	Month               int               `json:"month"`
+	Year                int               `json:"year"`
+	OutputInvoices      int               `json:"output_invoices"`
+	OutputTaxBase       float64           `json:"output_tax_base"`
+	OutputVAT           float64           `json:"output_vat"`
+	InputInvoices       int               `json:"input_invoices"`
+	InputTaxBase        float64           `json:"input_tax_base"`
+	InputVAT            float64           `json:"input_vat"`
+	NetVAT              float64           `json:"net_vat"`
+	LedgerOutputVAT     float64           `json:"ledger_output_vat"`
+	LedgerInputVAT      float64           `json:"ledger_input_vat"`
+	OutputDifference    float64           `json:"output_difference"`
+	InputDifference     float64           `json:"input_difference"`
+	Accounts            []VATRecapAccount `json:"accounts"`
+	UninvoicedSales     []string          `json:"uninvoiced_sales"`
+	UninvoicedPurchases []string          `json:"uninvoiced_purchases"`
+}
+
+// VATRecapAccount is the movement of a PPN tax account in the recap month.
+type VATRecapAccount struct {
+	ID     string  `json:"id"`
+	Code   string  `json:"code"`
+	Name   string  `json:"name"`
+	Debit  float64 `json:"debit"`
+	Credit float64 `json:"credit"`
+}
@@ -6,6 +6,15 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	TAX_TYPE_PPN = "PPN"
+
+	// Withholding taxes are withheld from the amount paid to the vendor
+	// instead of added on top of it.
+	TAX_TYPE_PPH_23  = "PPH_23"
+	TAX_TYPE_PPH_4_2 = "PPH_4_2"
+)
+
 type TaxModel struct {
 	shared.BaseModel
 	UserID              *string       `gorm:"size:36" json:"-"`
@@ -15,12 +24,19 @@ type TaxModel struct {
 	Name                string        `json:"name"`
 	Code                string        `json:"code"`
 	Amount              float64       `json:"amount"`
+	TaxType             string        `json:"tax_type,omitempty" gorm:"type:varchar(20)"`
+	TaxObjectCode       string        `json:"tax_object_code,omitempty" gorm:"type:varchar(20)"` // Kode objek pajak e-Bupot, mis. 24-104-01
 	AccountReceivableID *string       `gorm:"size:36" json:"account_receivable_id"`
 	AccountPayableID    *string       `gorm:"size:36" json:"account_payable_id"`
 	AccountReceivable   *AccountModel `gorm:"foreignKey:AccountReceivableID;constraint:OnDelete:SET NULL" json:"account_receivable,omitempty"`
 	AccountPayable      *AccountModel `gorm:"foreignKey:AccountPayableID;constraint:OnDelete:SET NULL" json:"account_payable,omitempty"`
 }
 
+// IsWithholding reports whether the tax is a withholding tax.
+func (t *TaxModel) IsWithholding() bool {
+	return t.TaxType == TAX_TYPE_PPH_23 || t.TaxType == TAX_TYPE_PPH_4_2
+}
+
 func (t *TaxModel) TableName() string {
 	return "taxes"
 }
@@ -10,6 +10,7 @@ import (
 
 type TransactionModel struct {
 	shared.BaseModel
+	AnalyticDimensions
 	Code                        string                  `json:"code"`
 	Description                 string                  `json:"description"`
 	Notes                       string                  `json:"notes"`
@@ -67,6 +68,15 @@ type TransactionModel struct {
 	IsPurchase                  bool                    `json:"is_purchase"`
 	IsDiscount                  bool                    `json:"is_discount"`
 	IsTax                       bool                    `json:"is_tax"`
+	CurrencyCode                string                  `json:"currency_code,omitempty" gorm:"type:varchar(3)"`
+	ExchangeRate                float64                 `json:"exchange_rate" gorm:"default:1"`
+	ForeignAmount               float64                 `json:"foreign_amount"`
+	IsFxDifference              bool                    `json:"is_fx_difference,omitempty"`
+	IsDraft                     bool                    `json:"is_draft,omitempty" gorm:"default:false;index"`
+	Branch                      *BranchModel            `gorm:"foreignKey:BranchID;constraint:OnDelete:SET NULL" json:"branch,omitempty"`
+	Project                     *ProjectModel           `gorm:"foreignKey:ProjectID;constraint:OnDelete:SET NULL" json:"project,omitempty"`
+	Department                  *OrganizationModel      `gorm:"foreignKey:DepartmentID;constraint:OnDelete:SET NULL" json:"department,omitempty"`
+	IntercompanyID              *string                 `json:"intercompany_id,omitempty" gorm:"type:char(36);index"`
 	// EmployeeID             *string              `json:"employee_id"`
 	// Employee               Employee             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;foreignKey:EmployeeID" json:"-"`
 	// Images                 []Image            `json:"images" gorm:"-"`
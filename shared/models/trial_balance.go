@@ -9,13 +9,15 @@ import (
 // TrialBalanceReport is a report for generate trial balance
 type TrialBalanceReport struct {
 	shared.BaseModel
-	CompanyID    *string           `gorm:"type:char(36);index" json:"company_id"`
-	Company      CompanyModel      `gorm:"foreignkey:CompanyID" json:"company,omitempty"`
-	StartDate    time.Time         `json:"start_date"`
-	EndDate      time.Time         `json:"end_date"`
-	TrialBalance []TrialBalanceRow `json:"trial_balance,omitempty" gorm:"-"`
-	Adjustment   []TrialBalanceRow `json:"adjustment,omitempty" gorm:"-"`
-	BalanceSheet []TrialBalanceRow `json:"balance_sheet,omitempty" gorm:"-"`
+	CompanyID    *string              `gorm:"type:char(36);index" json:"company_id"`
+	Company      CompanyModel         `gorm:"foreignkey:CompanyID" json:"company,omitempty"`
+	StartDate    time.Time            `json:"start_date"`
+	EndDate      time.Time            `json:"end_date"`
+	TrialBalance []TrialBalanceRow    `json:"trial_balance,omitempty" gorm:"-"`
+	Adjustment   []TrialBalanceRow    `json:"adjustment,omitempty" gorm:"-"`
+	BalanceSheet []TrialBalanceRow    `json:"balance_sheet,omitempty" gorm:"-"`
+	Group        *DimensionGroup      `json:"group,omitempty" gorm:"-"`
+	Groups       []TrialBalanceReport `json:"groups,omitempty" gorm:"-"`
 	// TrialBalanceData string            `gorm:"type:JSON"`
 	// AdjustmentData   string            `gorm:"type:JSON"`
 	// BalanceSheetData string            `gorm:"type:JSON"`
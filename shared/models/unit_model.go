@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+
 	"github.com/AMETORY/ametory-erp-modules/shared"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -44,3 +46,25 @@ type ProductUnitData struct {
 func (ProductUnitData) TableName() string {
 	return "product_units"
 }
+
+// GetProductUnitValue returns how many base units of a product one unit is. No
+// unit means the base unit, with a value of 1. A unit that is not set up for the
+// product, or has no positive value, is an error, since converting with it would
+// corrupt the stock.
+func GetProductUnitValue(db *gorm.DB, productID string, unitID *string) (float64, error) {
+	if unitID == nil || *unitID == "" {
+		return 1, nil
+	}
+	var productUnit ProductUnitData
+	err := db.Where("product_model_id = ? AND unit_model_id = ?", productID, *unitID).First(&productUnit).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, fmt.Errorf("unit %s is not set up for product %s", *unitID, productID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if productUnit.Value <= 0 {
+		return 0, fmt.Errorf("unit %s of product %s has no conversion value", *unitID, productID)
+	}
+	return productUnit.Value, nil
+}
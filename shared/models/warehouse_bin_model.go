@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WarehouseBinModel is a bin or shelf inside a warehouse. Stock movements that
+// carry a bin put stock into it or take stock out of it; stock without a bin is
+// in the warehouse but not put away.
+type WarehouseBinModel struct {
+	shared.BaseModel
+	WarehouseID   string          `gorm:"type:char(36);index;not null" json:"warehouse_id"`
+	Warehouse     *WarehouseModel `gorm:"foreignKey:WarehouseID;constraint:OnDelete:CASCADE" json:"warehouse,omitempty"`
+	Code          string          `gorm:"type:varchar(50);not null" json:"code"`
+	Name          string          `gorm:"type:varchar(255)" json:"name,omitempty"`
+	Zone          string          `gorm:"type:varchar(50)" json:"zone,omitempty"`
+	Aisle         string          `gorm:"type:varchar(50)" json:"aisle,omitempty"`
+	Rack          string          `gorm:"type:varchar(50)" json:"rack,omitempty"`
+	Level         string          `gorm:"type:varchar(50)" json:"level,omitempty"`
+	RouteSequence int             `gorm:"default:0" json:"route_sequence"` // Urutan bin pada rute picking
+	Capacity      float64         `gorm:"default:0" json:"capacity"`       // Kapasitas dalam satuan dasar, 0 berarti tidak dibatasi
+	IsActive      bool            `gorm:"default:true" json:"is_active"`
+}
+
+func (WarehouseBinModel) TableName() string {
+	return "warehouse_bins"
+}
+
+func (p *WarehouseBinModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// BinStock is the stock of a product, and of a lot when it is tracked, in a bin.
+type BinStock struct {
+	BinID         string     `json:"bin_id"`
+	BinCode       string     `json:"bin_code"`
+	BinName       string     `json:"bin_name"`
+	RouteSequence int        `json:"route_sequence"`
+	ProductID     string     `json:"product_id"`
+	ProductName   string     `json:"product_name"`
+	VariantID     *string    `json:"variant_id,omitempty"`
+	LotID         *string    `json:"lot_id,omitempty"`
+	LotNumber     string     `json:"lot_number,omitempty"`
+	ExpiryDate    *time.Time `json:"expiry_date,omitempty"`
+	Quantity      float64    `json:"quantity"`
+}
+
+// PutawaySuggestion is a bin suggested for part of a receipt. A suggestion
+// without a bin holds the quantity no bin has room for.
+type PutawaySuggestion struct {
+	ReferenceID string  `json:"reference_id,omitempty"`
+	ProductID   string  `json:"product_id"`
+	VariantID   *string `json:"variant_id,omitempty"`
+	BinID       *string `json:"bin_id,omitempty"`
+	BinCode     string  `json:"bin_code,omitempty"`
+	BinName     string  `json:"bin_name,omitempty"`
+	Quantity    float64 `json:"quantity"`
+	Reason      string  `json:"reason"`
+}
+
+// PickingRequest is a line to pick: a base quantity of a product from a
+// warehouse, for the document line ReferenceID.
+type PickingRequest struct {
+	ReferenceID string  `json:"reference_id,omitempty"`
+	ProductID   string  `json:"product_id"`
+	VariantID   *string `json:"variant_id,omitempty"`
+	Quantity    float64 `json:"quantity"`
+}
+
+// PickingLine is a line of a picking list: the quantity to take from a bin, and
+// from a lot when the product is tracked. Lines without a bin are picked from
+// stock that has not been put away.
+type PickingLine struct {
+	ReferenceID   string     `json:"reference_id,omitempty"`
+	RouteSequence int        `json:"route_sequence"`
+	BinID         *string    `json:"bin_id,omitempty"`
+	BinCode       string     `json:"bin_code,omitempty"`
+	ProductID     string     `json:"product_id"`
+	ProductName   string     `json:"product_name"`
+	VariantID     *string    `json:"variant_id,omitempty"`
+	LotID         *string    `json:"lot_id,omitempty"`
+	LotNumber     string     `json:"lot_number,omitempty"`
+	ExpiryDate    *time.Time `json:"expiry_date,omitempty"`
+	Quantity      float64    `json:"quantity"`
+}
@@ -20,6 +20,9 @@ type WarehouseModel struct {
 	ContactNote     string        `json:"contact_note,omitempty"`
 	CompanyID       *string       `json:"company_id,omitempty"`
 	Company         *CompanyModel `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	BranchID        *string       `gorm:"type:char(36);index" json:"branch_id,omitempty"`
+	Branch          *BranchModel  `gorm:"foreignKey:BranchID;constraint:OnDelete:SET NULL" json:"branch,omitempty"`
+	IsTransit       bool          `gorm:"default:false" json:"is_transit,omitempty"` // Lokasi virtual untuk stok dalam perjalanan antar gudang
 }
 
 func (WarehouseModel) TableName() string {
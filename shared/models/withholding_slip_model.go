@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/shared"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// WITHHOLDING_SLIP_ISSUED is a slip the company issues to a vendor for the
+	// tax it withheld; WITHHOLDING_SLIP_RECEIVED is a slip a customer gave the
+	// company for the tax the customer withheld.
+	WITHHOLDING_SLIP_ISSUED   = "ISSUED"
+	WITHHOLDING_SLIP_RECEIVED = "RECEIVED"
+
+	WITHHOLDING_SLIP_ACTIVE    = "ACTIVE"
+	WITHHOLDING_SLIP_CANCELLED = "CANCELLED"
+)
+
+// WithholdingSlipModel is a withholding slip (bukti potong) of a payment. The
+// vendor or customer data is copied when the slip is created.
+type WithholdingSlipModel struct {
+	shared.BaseModel
+	CompanyID      *string             `json:"company_id" gorm:"type:char(36);index"`
+	Company        *CompanyModel       `gorm:"foreignKey:CompanyID;constraint:OnDelete:CASCADE" json:"company,omitempty"`
+	Direction      string              `json:"direction" gorm:"type:varchar(10);index"`
+	Number         string              `json:"number" gorm:"index"`
+	Date           time.Time           `json:"date"`
+	Month          int                 `json:"month"`
+	Year           int                 `json:"year"`
+	ContactID      *string             `json:"contact_id,omitempty" gorm:"type:char(36);index"`
+	Contact        *ContactModel       `gorm:"foreignKey:ContactID;constraint:OnDelete:SET NULL" json:"contact,omitempty"`
+	TaxPayerNumber string              `json:"tax_payer_number"`
+	Name           string              `json:"name"`
+	Address        string              `json:"address"`
+	TaxID          *string             `json:"tax_id,omitempty" gorm:"type:char(36)"`
+	Tax            *TaxModel           `gorm:"foreignKey:TaxID;constraint:OnDelete:SET NULL" json:"tax,omitempty"`
+	TaxType        string              `json:"tax_type" gorm:"type:varchar(20)"`
+	TaxObjectCode  string              `json:"tax_object_code" gorm:"type:varchar(20)"`
+	Rate           float64             `json:"rate"`
+	TaxBase        float64             `json:"tax_base"`
+	Amount         float64             `json:"amount"`
+	PurchaseID     *string             `json:"purchase_id,omitempty" gorm:"type:char(36);index"`
+	Purchase       *PurchaseOrderModel `gorm:"foreignKey:PurchaseID;constraint:OnDelete:CASCADE" json:"purchase,omitempty"`
+	SalesID        *string             `json:"sales_id,omitempty" gorm:"type:char(36);index"`
+	Sales          *SalesModel         `gorm:"foreignKey:SalesID;constraint:OnDelete:CASCADE" json:"sales,omitempty"`
+	PaymentID      *string             `json:"payment_id,omitempty" gorm:"type:char(36)"`
+	Reference      string              `json:"reference"`
+	Status         string              `json:"status" gorm:"type:varchar(20);default:'ACTIVE'"`
+	ExportedAt     *time.Time          `json:"exported_at,omitempty"`
+}
+
+func (WithholdingSlipModel) TableName() string {
+	return "withholding_slips"
+}
+
+func (w *WithholdingSlipModel) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == "" {
+		tx.Statement.SetColumn("id", uuid.New().String())
+	}
+	return
+}
+
+// WithholdingSlipCounterModel holds the last sequence of the withholding slips a
+// company issued in a tax period. The row is locked while a slip is numbered.
+type WithholdingSlipCounterModel struct {
+	CompanyID    string `gorm:"type:char(36);primaryKey" json:"company_id"`
+	Year         int    `gorm:"primaryKey;autoIncrement:false" json:"year"`
+	Month        int    `gorm:"primaryKey;autoIncrement:false" json:"month"`
+	LastSequence int64  `json:"last_sequence"`
+}
+
+func (WithholdingSlipCounterModel) TableName() string {
+	return "withholding_slip_counters"
+}
@@ -0,0 +1,357 @@
+package barcode
+
+import (
+	"bytes"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckDigit(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want byte
+	}{
+		{"400638133393", '1'},
+		{"03600029145", '2'},
+		{"899999909005", '0'},
+		{"9638507", '4'},
+		{"000000000000", '0'},
+	}
+
+	for _, test := range tests {
+		got, err := CheckDigit(test.in)
+		if err != nil {
+			t.Errorf("CheckDigit(%s) error: %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("CheckDigit(%s) = %c, want %c", test.in, got, test.want)
+		}
+	}
+
+	if _, err := CheckDigit("12A4"); err == nil {
+		t.Error("CheckDigit accepted a non-digit payload")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := ValidateEAN13("4006381333931"); err != nil {
+		t.Errorf("ValidateEAN13 rejected a valid code: %v", err)
+	}
+	if err := ValidateEAN13("4006381333932"); err == nil {
+		t.Error("ValidateEAN13 accepted a wrong check digit")
+	}
+	if err := ValidateEAN13("400638133393"); err == nil {
+		t.Error("ValidateEAN13 accepted a short code")
+	}
+	if err := ValidateUPCA("036000291452"); err != nil {
+		t.Errorf("ValidateUPCA rejected a valid code: %v", err)
+	}
+	if code, err := CompleteUPCA("03600029145"); err != nil || code != "036000291452" {
+		t.Errorf("CompleteUPCA = %s, %v, want 036000291452", code, err)
+	}
+	if code, err := CompleteEAN13("400638133393"); err != nil || code != "4006381333931" {
+		t.Errorf("CompleteEAN13 = %s, %v, want 4006381333931", code, err)
+	}
+}
+
+// decodeEAN13 reads the digits back from the modules of an EAN-13 symbol.
+func decodeEAN13(t *testing.T, s *Symbol) string {
+	t.Helper()
+	if s.Width != 95 {
+		t.Fatalf("EAN-13 width = %d, want 95", s.Width)
+	}
+	chunk := func(from int) string {
+		var b strings.Builder
+		for x := from; x < from+7; x++ {
+			if s.At(x, 0) {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		return b.String()
+	}
+
+	var digits, parity string
+	for i := 0; i < 12; i++ {
+		from := 3 + 7*i
+		if i >= 6 {
+			from += 5
+		}
+		c := chunk(from)
+		found := false
+		for d, l := range eanLeft {
+			switch {
+			case i < 6 && c == l:
+				parity += "L"
+			case i < 6 && c == reverse(complement(l)):
+				parity += "G"
+			case i >= 6 && c == complement(l):
+			default:
+				continue
+			}
+			digits += strconv.Itoa(d)
+			found = true
+			break
+		}
+		if !found {
+			t.Fatalf("undecodable EAN-13 digit %d: %s", i, c)
+		}
+	}
+	for d, p := range eanParity {
+		if p == parity {
+			return strconv.Itoa(d) + digits
+		}
+	}
+	t.Fatalf("unknown EAN-13 parity %s", parity)
+	return ""
+}
+
+func TestEncodeEAN13(t *testing.T) {
+	for _, code := range []string{"4006381333931", "8999999090050", "0123456789012"} {
+		s, err := EncodeEAN13(code)
+		if err != nil {
+			t.Errorf("EncodeEAN13(%s) error: %v", code, err)
+			continue
+		}
+		if got := decodeEAN13(t, s); got != code {
+			t.Errorf("EncodeEAN13(%s) decodes to %s", code, got)
+		}
+	}
+
+	s, err := EncodeEAN13("400638133393")
+	if err != nil || s.Text != "4006381333931" {
+		t.Errorf("EncodeEAN13 without check digit = %v, %v", s, err)
+	}
+	if _, err := EncodeEAN13("4006381333930"); err == nil {
+		t.Error("EncodeEAN13 accepted a wrong check digit")
+	}
+
+	s, err = EncodeUPCA("03600029145")
+	if err != nil {
+		t.Fatalf("EncodeUPCA error: %v", err)
+	}
+	if got := decodeEAN13(t, s); got != "0036000291452" {
+		t.Errorf("EncodeUPCA decodes to %s", got)
+	}
+}
+
+// decodeCode128 reads the text back from the modules of a Code128 symbol and
+// verifies its checksum.
+func decodeCode128(t *testing.T, s *Symbol) (string, []int) {
+	t.Helper()
+	var values []int
+	x := 0
+	for x < s.Width {
+		var widths strings.Builder
+		for i := 0; i < 6; i++ {
+			start := x
+			for x < s.Width && s.At(x, 0) == (i%2 == 0) {
+				x++
+			}
+			widths.WriteString(strconv.Itoa(x - start))
+		}
+		value := -1
+		for v, p := range code128Patterns[:code128Stop] {
+			if p == widths.String() {
+				value = v
+			}
+		}
+		if value < 0 {
+			if widths.String()+"1" == code128Patterns[code128Stop][:6]+"1" {
+				break
+			}
+			t.Fatalf("unknown Code128 pattern %s", widths.String())
+		}
+		values = append(values, value)
+	}
+
+	checksum := values[0]
+	for i, v := range values[1 : len(values)-1] {
+		checksum += v * (i + 1)
+	}
+	if checksum%103 != values[len(values)-1] {
+		t.Fatalf("Code128 checksum %d, want %d", values[len(values)-1], checksum%103)
+	}
+
+	var text strings.Builder
+	setC := values[0] == code128StartC
+	for _, v := range values[1 : len(values)-1] {
+		switch {
+		case setC && v == code128CodeB:
+			setC = false
+		case !setC && v == code128CodeC:
+			setC = true
+		case setC:
+			text.WriteString(strconv.Itoa(v/10) + strconv.Itoa(v%10))
+		default:
+			text.WriteByte(byte(v + 32))
+		}
+	}
+	return text.String(), values
+}
+
+func TestEncodeCode128(t *testing.T) {
+	var tests = []struct {
+		in      string
+		symbols int // Termasuk start, checksum dan stop
+	}{
+		{"SKU-001", 10},
+		{"12345678", 7},
+		{"12", 4},
+		{"AB1234567890", 11},
+		{"1234567ABC", 11},
+		{"LOT 2026/10-A", 16},
+	}
+
+	for _, test := range tests {
+		s, err := EncodeCode128(test.in)
+		if err != nil {
+			t.Errorf("EncodeCode128(%s) error: %v", test.in, err)
+			continue
+		}
+		got, values := decodeCode128(t, s)
+		if got != test.in {
+			t.Errorf("EncodeCode128(%s) decodes to %s", test.in, got)
+		}
+		if len(values)+1 != test.symbols {
+			t.Errorf("EncodeCode128(%s) uses %d symbols, want %d", test.in, len(values)+1, test.symbols)
+		}
+		if s.Width != 11*len(values)+13 {
+			t.Errorf("EncodeCode128(%s) width = %d", test.in, s.Width)
+		}
+	}
+
+	if _, err := EncodeCode128("café"); err == nil {
+		t.Error("EncodeCode128 accepted a non-ASCII character")
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// Contoh "HELLO WORLD" versi 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	got := rsRemainder(data, rsDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	var tests = []struct {
+		level QRLevel
+		mask  int
+		want  string
+	}{
+		{QRLevelL, 0, "111011111000100"},
+		{QRLevelM, 0, "101010000010010"},
+		{QRLevelQ, 0, "011010101011111"},
+		{QRLevelH, 0, "001011010001001"},
+	}
+	for _, test := range tests {
+		if got := strconv.FormatInt(int64(qrFormatBits(test.level, test.mask)), 2); got != strings.TrimLeft(test.want, "0") {
+			t.Errorf("qrFormatBits(%d, %d) = %s, want %s", test.level, test.mask, got, test.want)
+		}
+	}
+
+	if got := qrVersionBits(7); got != 0x07C94 {
+		t.Errorf("qrVersionBits(7) = %#x, want 0x7c94", got)
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	var tests = []struct {
+		in    string
+		level QRLevel
+		size  int
+	}{
+		{"hello", QRLevelM, 21},
+		{"https://example.com/p/SKU-001", QRLevelM, 29},
+		{strings.Repeat("x", 200), QRLevelL, 53},
+	}
+	for _, test := range tests {
+		s, err := EncodeQR(test.in, test.level)
+		if err != nil {
+			t.Errorf("EncodeQR(%s) error: %v", test.in, err)
+			continue
+		}
+		if s.Width != test.size || s.Height != test.size {
+			t.Errorf("EncodeQR(%s) size = %d×%d, want %d", test.in, s.Width, s.Height, test.size)
+		}
+		// Finder pattern di tiga sudut
+		for _, c := range [][2]int{{0, 0}, {s.Width - 7, 0}, {0, s.Height - 7}} {
+			if !s.At(c[0], c[1]) || s.At(c[0]+1, c[1]+1) || !s.At(c[0]+3, c[1]+3) {
+				t.Errorf("EncodeQR(%s) has no finder pattern at %v", test.in, c)
+			}
+		}
+	}
+
+	if _, err := EncodeQR(strings.Repeat("x", 300), QRLevelL); err == nil {
+		t.Error("EncodeQR accepted data beyond the largest version")
+	}
+}
+
+func TestRender(t *testing.T) {
+	s, err := EncodeCode128("SKU-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.PNG(2, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != (s.Width+2*s.QuietZone)*2 || b.Dy() != 40+2*s.QuietZone*2 {
+		t.Errorf("PNG size = %v", b)
+	}
+
+	svg := s.SVG(1, 30)
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, ">SKU-001</text>") {
+		t.Errorf("unexpected SVG %s", svg)
+	}
+	if got, want := strings.Count(svg, "<rect")-1, len(s.bars(0)); got != want {
+		t.Errorf("SVG has %d bars, want %d", got, want)
+	}
+}
+
+func TestLabelSheet(t *testing.T) {
+	ean, _ := EncodeEAN13("4006381333931")
+	qr, _ := EncodeQR("LOT-001", QRLevelM)
+	labels := make([]Label, 30)
+	for i := range labels {
+		labels[i] = Label{Name: "Kopi Bubuk (250 g) Arabika Gayo Premium", Price: "Rp 45.000", SKU: "KOPI-250", Symbol: ean}
+	}
+	labels[29].Symbol = qr
+	labels[29].Detail = "Lot LOT-001, exp 2027-01-31"
+
+	data, err := LabelSheet(LayoutA4x24, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(data)
+	if !strings.HasPrefix(doc, "%PDF-1.4") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Error("LabelSheet did not write a PDF document")
+	}
+	if !strings.Contains(doc, "/Count 2") {
+		t.Error("LabelSheet should use two pages for 30 labels of 24 per page")
+	}
+	if !strings.Contains(doc, `(Kopi Bubuk \(250 g\)`) {
+		t.Error("LabelSheet did not escape the label name")
+	}
+
+	offset := strings.LastIndex(doc, "startxref\n")
+	xref, _ := strconv.Atoi(strings.Fields(doc[offset+len("startxref\n"):])[0])
+	if !strings.HasPrefix(doc[xref:], "xref") {
+		t.Error("startxref does not point at the cross-reference table")
+	}
+
+	if _, err := LabelSheet(LabelLayout{}, labels); err == nil {
+		t.Error("LabelSheet accepted an empty layout")
+	}
+}
@@ -0,0 +1,74 @@
+package barcode
+
+import (
+	"errors"
+	"strconv"
+)
+
+// CheckDigit returns the GS1 check digit of a numeric payload, i.e. a GTIN
+// without its check digit. Counting from the right, the digits are weighted 3
+// and 1 alternately, so the same function serves EAN-8, UPC-A, EAN-13 and
+// GTIN-14.
+func CheckDigit(payload string) (byte, error) {
+	if payload == "" {
+		return 0, errors.New("empty payload")
+	}
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		c := payload[i]
+		if c < '0' || c > '9' {
+			return 0, errors.New("payload must only contain digits: " + payload)
+		}
+		weight := 1
+		if (len(payload)-1-i)%2 == 0 {
+			weight = 3
+		}
+		sum += int(c-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10), nil
+}
+
+// CompleteEAN13 appends the check digit to a 12 digit EAN-13 payload.
+func CompleteEAN13(payload string) (string, error) {
+	return complete(payload, 12, "EAN-13")
+}
+
+// ValidateEAN13 checks the length, the digits and the check digit of an EAN-13.
+func ValidateEAN13(code string) error {
+	return validate(code, 13, "EAN-13")
+}
+
+// CompleteUPCA appends the check digit to an 11 digit UPC-A payload.
+func CompleteUPCA(payload string) (string, error) {
+	return complete(payload, 11, "UPC-A")
+}
+
+// ValidateUPCA checks the length, the digits and the check digit of a UPC-A.
+func ValidateUPCA(code string) error {
+	return validate(code, 12, "UPC-A")
+}
+
+func complete(payload string, length int, name string) (string, error) {
+	if len(payload) != length {
+		return "", errors.New(name + " payload must have " + strconv.Itoa(length) + " digits")
+	}
+	check, err := CheckDigit(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + string(check), nil
+}
+
+func validate(code string, length int, name string) error {
+	if len(code) != length {
+		return errors.New(name + " must have " + strconv.Itoa(length) + " digits")
+	}
+	check, err := CheckDigit(code[:length-1])
+	if err != nil {
+		return err
+	}
+	if code[length-1] != check {
+		return errors.New("invalid " + name + " check digit, expected " + string(check))
+	}
+	return nil
+}
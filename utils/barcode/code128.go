@@ -0,0 +1,108 @@
+package barcode
+
+import (
+	"errors"
+	"strconv"
+)
+
+// code128Patterns holds the bar and space widths of the Code128 symbols 0 to
+// 105; the last entry is the stop pattern.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128CodeB  = 100 // Pindah ke set B dari set C
+	code128CodeC  = 99  // Pindah ke set C dari set B
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// EncodeCode128 encodes printable ASCII text as Code128. Code set B is used for
+// text and code set C for runs of digits, which packs two digits in one symbol.
+func EncodeCode128(data string) (*Symbol, error) {
+	if data == "" {
+		return nil, errors.New("empty Code128 data")
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] < 32 || data[i] > 126 {
+			return nil, errors.New("Code128 data must be printable ASCII, invalid character at position " + strconv.Itoa(i))
+		}
+	}
+
+	digitRun := func(i int) int {
+		n := 0
+		for i+n < len(data) && data[i+n] >= '0' && data[i+n] <= '9' {
+			n++
+		}
+		return n
+	}
+
+	var values []int
+	setC := false
+	if run := digitRun(0); run >= 4 || (run == 2 && len(data) == 2) {
+		setC = true
+		values = append(values, code128StartC)
+	} else {
+		values = append(values, code128StartB)
+	}
+	for i := 0; i < len(data); {
+		run := digitRun(i)
+		if setC {
+			if run >= 2 {
+				values = append(values, int(data[i]-'0')*10+int(data[i+1]-'0'))
+				i += 2
+				continue
+			}
+			values = append(values, code128CodeB)
+			setC = false
+		}
+		// Set C baru menguntungkan untuk deret angka yang panjang
+		if run >= 6 || (run >= 4 && i+run == len(data)) {
+			if run%2 == 1 {
+				values = append(values, int(data[i])-32)
+				i++
+			}
+			values = append(values, code128CodeC)
+			setC = true
+			continue
+		}
+		values = append(values, int(data[i])-32)
+		i++
+	}
+
+	checksum := values[0]
+	for i, v := range values[1:] {
+		checksum += v * (i + 1)
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	width := 0
+	for _, v := range values {
+		for _, w := range code128Patterns[v] {
+			width += int(w - '0')
+		}
+	}
+	symbol := newSymbol(CODE128, data, width, 1, 10)
+	x := 0
+	for _, v := range values {
+		for j, w := range code128Patterns[v] {
+			for k := 0; k < int(w-'0'); k++ {
+				symbol.set(x, 0, j%2 == 0)
+				x++
+			}
+		}
+	}
+	return symbol, nil
+}
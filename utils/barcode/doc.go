@@ -0,0 +1,11 @@
+/*
+Package barcode encodes and renders product barcodes without any external
+service or library, so labels can be printed offline.
+
+EAN-13 and UPC-A check digits are computed and validated with CheckDigit,
+CompleteEAN13, ValidateEAN13, CompleteUPCA and ValidateUPCA. Code128, EAN-13 and
+QR codes are encoded into a Symbol, which renders itself as PNG or SVG. LabelSheet
+lays out product labels with their name, price, SKU and barcode on the pages of a
+PDF document.
+*/
+package barcode
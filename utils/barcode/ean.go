@@ -0,0 +1,92 @@
+package barcode
+
+import "errors"
+
+// eanLeft holds the odd parity (L) patterns of the digits; the even parity (G)
+// patterns are the mirrored right hand (R) patterns, which are the complement of
+// the L patterns.
+var eanLeft = [10]string{
+	"0001101", "0011001", "0010011", "0111101", "0100011",
+	"0110001", "0101111", "0111011", "0110111", "0001011",
+}
+
+// eanParity holds the parity of the six left hand digits for each first digit.
+var eanParity = [10]string{
+	"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG",
+	"LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL",
+}
+
+// EncodeEAN13 encodes an EAN-13. The check digit is added to a 12 digit code and
+// validated on a 13 digit code.
+func EncodeEAN13(code string) (*Symbol, error) {
+	var err error
+	if len(code) == 12 {
+		code, err = CompleteEAN13(code)
+	} else {
+		err = ValidateEAN13(code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := "101"
+	parity := eanParity[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		l := eanLeft[code[i]-'0']
+		if parity[i-1] == 'G' {
+			l = reverse(complement(l))
+		}
+		pattern += l
+	}
+	pattern += "01010"
+	for i := 7; i <= 12; i++ {
+		pattern += complement(eanLeft[code[i]-'0'])
+	}
+	pattern += "101"
+
+	symbol := newSymbol(EAN13, code, len(pattern), 1, 11)
+	for x, c := range pattern {
+		symbol.set(x, 0, c == '1')
+	}
+	return symbol, nil
+}
+
+// EncodeUPCA encodes a UPC-A, which is an EAN-13 with a leading zero. The check
+// digit is added to an 11 digit code and validated on a 12 digit code.
+func EncodeUPCA(code string) (*Symbol, error) {
+	var err error
+	if len(code) == 11 {
+		code, err = CompleteUPCA(code)
+	} else {
+		err = ValidateUPCA(code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := EncodeEAN13("0" + code)
+	if err != nil {
+		return nil, errors.New("invalid UPC-A: " + err.Error())
+	}
+	symbol.Text = code
+	return symbol, nil
+}
+
+func complement(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c == '0' {
+			b[i] = '1'
+		} else {
+			b[i] = '0'
+		}
+	}
+	return string(b)
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
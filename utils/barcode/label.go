@@ -0,0 +1,150 @@
+package barcode
+
+import "errors"
+
+// LabelLayout describes a sheet of labels. All sizes are in points (1/72 inch);
+// use Millimeters to convert.
+type LabelLayout struct {
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	LabelWidth  float64 `json:"label_width"`
+	LabelHeight float64 `json:"label_height"`
+	MarginLeft  float64 `json:"margin_left"`
+	MarginTop   float64 `json:"margin_top"`
+	GapX        float64 `json:"gap_x"` // Jarak antar kolom
+	GapY        float64 `json:"gap_y"` // Jarak antar baris
+}
+
+// Millimeters converts millimeters to points.
+func Millimeters(mm float64) float64 {
+	return mm * 72 / 25.4
+}
+
+var (
+	// LayoutA4x24 is an A4 sheet of 3 × 8 labels of 70 × 37 mm.
+	LayoutA4x24 = LabelLayout{
+		PageWidth: Millimeters(210), PageHeight: Millimeters(297),
+		Columns: 3, Rows: 8,
+		LabelWidth: Millimeters(70), LabelHeight: Millimeters(37),
+		MarginTop: Millimeters(0.5),
+	}
+	// LayoutA4x65 is an A4 sheet of 5 × 13 labels of 38.1 × 21.2 mm.
+	LayoutA4x65 = LabelLayout{
+		PageWidth: Millimeters(210), PageHeight: Millimeters(297),
+		Columns: 5, Rows: 13,
+		LabelWidth: Millimeters(38.1), LabelHeight: Millimeters(21.2),
+		MarginLeft: Millimeters(4.7), MarginTop: Millimeters(10.7),
+		GapX: Millimeters(2.5),
+	}
+	// LayoutRoll50x30 is a roll of 50 × 30 mm labels for thermal printers, one
+	// label per page.
+	LayoutRoll50x30 = LabelLayout{
+		PageWidth: Millimeters(50), PageHeight: Millimeters(30),
+		Columns: 1, Rows: 1,
+		LabelWidth: Millimeters(50), LabelHeight: Millimeters(30),
+	}
+)
+
+// Label is the content of a product label.
+type Label struct {
+	Name   string  `json:"name"`
+	Detail string  `json:"detail,omitempty"` // Varian, nomor lot, tanggal kedaluwarsa
+	Price  string  `json:"price,omitempty"`
+	SKU    string  `json:"sku,omitempty"`
+	Symbol *Symbol `json:"-"`
+}
+
+// LabelSheet lays the labels out in rows on the pages of a PDF document, starting
+// a new page when the sheet is full. Linear barcodes are drawn across the label
+// between the name and the SKU and price; QR codes are drawn on the left with the
+// text beside them.
+func LabelSheet(layout LabelLayout, labels []Label) ([]byte, error) {
+	if layout.Columns < 1 || layout.Rows < 1 || layout.LabelWidth <= 0 || layout.LabelHeight <= 0 {
+		return nil, errors.New("invalid label layout")
+	}
+	if layout.PageWidth <= 0 || layout.PageHeight <= 0 {
+		return nil, errors.New("invalid page size")
+	}
+	if len(labels) == 0 {
+		return nil, errors.New("no labels")
+	}
+
+	perPage := layout.Columns * layout.Rows
+	var pages []*pdfPage
+	for i, label := range labels {
+		if i%perPage == 0 {
+			pages = append(pages, &pdfPage{})
+		}
+		column := i % perPage % layout.Columns
+		row := i % perPage / layout.Columns
+		x := layout.MarginLeft + float64(column)*(layout.LabelWidth+layout.GapX)
+		// Koordinat PDF dimulai dari kiri bawah
+		y := layout.PageHeight - layout.MarginTop - float64(row+1)*layout.LabelHeight - float64(row)*layout.GapY
+		if err := drawLabel(pages[len(pages)-1], label, x, y, layout.LabelWidth, layout.LabelHeight); err != nil {
+			return nil, err
+		}
+	}
+	return writePDF(layout.PageWidth, layout.PageHeight, pages), nil
+}
+
+func drawLabel(p *pdfPage, label Label, x, y, w, h float64) error {
+	pad := min(w, h) * 0.06
+	size := min(9, h/9)
+	if label.Symbol != nil && !label.Symbol.IsLinear() {
+		side := h - 2*pad
+		p.symbol(label.Symbol, x+pad, y+pad, side, side)
+		left := x + side + 2*pad
+		width := w - side - 3*pad
+		if width <= 0 {
+			return errors.New("label too small for a QR code")
+		}
+		top := y + h - pad - size
+		p.text(left, top, size, true, fitText(label.Name, width, size, true))
+		if label.Detail != "" {
+			top -= size * 1.2
+			p.text(left, top, size*0.8, false, fitText(label.Detail, width, size*0.8, false))
+		}
+		if label.SKU != "" {
+			top -= size * 1.2
+			p.text(left, top, size*0.8, false, fitText(label.SKU, width, size*0.8, false))
+		}
+		if label.Price != "" {
+			p.text(left, y+pad+size*0.3, size*1.2, true, fitText(label.Price, width, size*1.2, true))
+		}
+		return nil
+	}
+
+	width := w - 2*pad
+	top := y + h - pad - size
+	p.text(x+pad, top, size, true, fitText(label.Name, width, size, true))
+	if label.Detail != "" {
+		top -= size
+		p.text(x+pad, top, size*0.8, false, fitText(label.Detail, width, size*0.8, false))
+	}
+
+	bottom := y + pad + size*0.3
+	if label.SKU != "" {
+		p.text(x+pad, bottom, size*0.8, false, fitText(label.SKU, width/2, size*0.8, false))
+	}
+	if label.Price != "" {
+		price := fitText(label.Price, width/2, size*1.2, true)
+		p.text(x+w-pad-textWidth(price, size*1.2, true), bottom, size*1.2, true, price)
+	}
+	if label.Symbol == nil {
+		return nil
+	}
+
+	textSize := size * 0.75
+	textBaseline := bottom + size*1.2 + 1
+	barBottom := textBaseline + textSize
+	barTop := top - size*0.4
+	if barTop-barBottom < 4 {
+		return errors.New("label too small for a barcode")
+	}
+	p.symbol(label.Symbol, x+pad, barBottom, width, barTop-barBottom)
+	text := fitText(label.Symbol.Text, width, textSize, false)
+	p.text(x+(w-textWidth(text, textSize, false))/2, textBaseline, textSize, false, text)
+	return nil
+}
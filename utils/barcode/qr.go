@@ -0,0 +1,474 @@
+package barcode
+
+import (
+	"errors"
+	"strconv"
+)
+
+// QRLevel is the error correction level of a QR code. Higher levels recover
+// more damage but hold less data.
+type QRLevel int
+
+const (
+	QRLevelL QRLevel = iota // Sekitar 7% data dapat dipulihkan
+	QRLevelM                // 15%
+	QRLevelQ                // 25%
+	QRLevelH                // 30%
+)
+
+// qrMaxVersion is the largest QR version supported, a 57×57 symbol holding up
+// to 271 bytes at level L.
+const qrMaxVersion = 10
+
+// qrBlocks holds, per version and level, the error correction codewords per
+// block followed by the number of blocks and data codewords of the two block
+// groups.
+var qrBlocks = [qrMaxVersion][4][5]int{
+	{{7, 1, 19, 0, 0}, {10, 1, 16, 0, 0}, {13, 1, 13, 0, 0}, {17, 1, 9, 0, 0}},
+	{{10, 1, 34, 0, 0}, {16, 1, 28, 0, 0}, {22, 1, 22, 0, 0}, {28, 1, 16, 0, 0}},
+	{{15, 1, 55, 0, 0}, {26, 1, 44, 0, 0}, {18, 2, 17, 0, 0}, {22, 2, 13, 0, 0}},
+	{{20, 1, 80, 0, 0}, {18, 2, 32, 0, 0}, {26, 2, 24, 0, 0}, {16, 4, 9, 0, 0}},
+	{{26, 1, 108, 0, 0}, {24, 2, 43, 0, 0}, {18, 2, 15, 2, 16}, {22, 2, 11, 2, 12}},
+	{{18, 2, 68, 0, 0}, {16, 4, 27, 0, 0}, {24, 4, 19, 0, 0}, {28, 4, 15, 0, 0}},
+	{{20, 2, 78, 0, 0}, {18, 4, 31, 0, 0}, {18, 2, 14, 4, 15}, {26, 4, 13, 1, 14}},
+	{{24, 2, 97, 0, 0}, {22, 2, 38, 2, 39}, {22, 4, 18, 2, 19}, {26, 4, 14, 2, 15}},
+	{{30, 2, 116, 0, 0}, {22, 3, 36, 2, 37}, {20, 4, 16, 4, 17}, {24, 4, 12, 4, 13}},
+	{{18, 2, 68, 2, 69}, {26, 4, 43, 1, 44}, {24, 6, 19, 2, 20}, {28, 6, 15, 2, 16}},
+}
+
+// qrAlignment holds the centre coordinates of the alignment patterns per version.
+var qrAlignment = [qrMaxVersion][]int{
+	nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// qrLevelBits holds the error correction level as written in the format
+// information.
+var qrLevelBits = [4]int{1, 0, 3, 2}
+
+// EncodeQR encodes data as a QR code in byte mode, using the smallest version
+// that holds the data at the given level and the mask with the lowest penalty.
+func EncodeQR(data string, level QRLevel) (*Symbol, error) {
+	if level < QRLevelL || level > QRLevelH {
+		return nil, errors.New("invalid QR error correction level")
+	}
+	version := 0
+	for v := 1; v <= qrMaxVersion; v++ {
+		if qrHeaderBits(v)+8*len(data) <= 8*qrDataCodewords(v, level) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.New("data too long for a QR code: " + strconv.Itoa(len(data)) + " bytes")
+	}
+
+	codewords := qrCodewords(qrData(data, version, level), version, level)
+
+	q := newQRMatrix(version)
+	q.drawFunctionPatterns()
+	q.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(level, mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask) // XOR dua kali mengembalikan data semula
+	}
+	q.applyMask(best)
+	q.drawFormat(level, best)
+
+	symbol := newSymbol(QR, data, q.size, q.size, 4)
+	copy(symbol.modules, q.modules)
+	return symbol, nil
+}
+
+func qrHeaderBits(version int) int {
+	if version < 10 {
+		return 4 + 8
+	}
+	return 4 + 16
+}
+
+func qrDataCodewords(version int, level QRLevel) int {
+	b := qrBlocks[version-1][level]
+	return b[1]*b[2] + b[3]*b[4]
+}
+
+// qrData builds the data codewords: the byte mode header, the data, the
+// terminator and the pad codewords.
+func qrData(data string, version int, level QRLevel) []byte {
+	var bits []bool
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (v>>i)&1 == 1)
+		}
+	}
+	appendBits(0x4, 4)
+	appendBits(len(data), qrHeaderBits(version)-4)
+	for i := 0; i < len(data); i++ {
+		appendBits(int(data[i]), 8)
+	}
+
+	capacity := 8 * qrDataCodewords(version, level)
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	result := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+// qrCodewords splits the data into blocks, adds the Reed-Solomon error
+// correction codewords of each block and interleaves the blocks.
+func qrCodewords(data []byte, version int, level QRLevel) []byte {
+	b := qrBlocks[version-1][level]
+	ecLen := b[0]
+	divisor := rsDivisor(ecLen)
+
+	var blocks, ecs [][]byte
+	offset := 0
+	for group := 0; group < 2; group++ {
+		for i := 0; i < b[1+2*group]; i++ {
+			block := data[offset : offset+b[2+2*group]]
+			offset += len(block)
+			blocks = append(blocks, block)
+			ecs = append(ecs, rsRemainder(block, divisor))
+		}
+	}
+
+	var result []byte
+	for i := 0; i < b[2]+1; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < ecLen; i++ {
+		for _, ec := range ecs {
+			result = append(result, ec[i])
+		}
+	}
+	return result
+}
+
+// rsMul multiplies two elements of GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func rsMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the generator polynomial of the given degree without its
+// leading coefficient, highest power first.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = rsMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = rsMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= rsMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// qrFormatBits returns the 15 format information bits of a level and mask.
+func qrFormatBits(level QRLevel, mask int) int {
+	data := qrLevelBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// qrVersionBits returns the 18 version information bits, used from version 7.
+func qrVersionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+type qrMatrix struct {
+	version    int
+	size       int
+	modules    []bool
+	isFunction []bool
+}
+
+func newQRMatrix(version int) *qrMatrix {
+	size := 17 + 4*version
+	return &qrMatrix{
+		version:    version,
+		size:       size,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+func (q *qrMatrix) get(x, y int) bool {
+	return q.modules[y*q.size+x]
+}
+
+func (q *qrMatrix) setFunction(x, y int, dark bool) {
+	q.modules[y*q.size+x] = dark
+	q.isFunction[y*q.size+x] = true
+}
+
+func (q *qrMatrix) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+
+	q.drawFinder(3, 3)
+	q.drawFinder(q.size-4, 3)
+	q.drawFinder(3, q.size-4)
+
+	positions := qrAlignment[q.version-1]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Lewati posisi yang bertumpuk dengan finder pattern
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Format sementara, agar modulnya tercatat sebagai fungsi
+	q.drawFormat(QRLevelL, 0)
+
+	if q.version >= 7 {
+		bits := qrVersionBits(q.version)
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := q.size-11+i%3, i/3
+			q.setFunction(a, b, dark)
+			q.setFunction(b, a, dark)
+		}
+	}
+}
+
+// drawFinder draws a finder pattern and its separator around the centre x, y.
+func (q *qrMatrix) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= q.size || yy >= q.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			q.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *qrMatrix) drawFormat(level QRLevel, mask int) {
+	bits := qrFormatBits(level, mask)
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard, two
+// columns at a time from the bottom right corner, skipping function modules.
+func (q *qrMatrix) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if q.isFunction[y*q.size+x] || i >= len(data)*8 {
+					continue
+				}
+				q.modules[y*q.size+x] = (data[i>>3]>>(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (q *qrMatrix) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.isFunction[y*q.size+x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				q.modules[y*q.size+x] = !q.modules[y*q.size+x]
+			}
+		}
+	}
+}
+
+// penalty scores the readability of the matrix with the four rules of the
+// standard; the mask with the lowest score is used.
+func (q *qrMatrix) penalty() int {
+	result := 0
+	line := make([]bool, q.size)
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < q.size; i++ {
+			for j := 0; j < q.size; j++ {
+				if pass == 0 {
+					line[j] = q.get(j, i)
+				} else {
+					line[j] = q.get(i, j)
+				}
+			}
+			result += qrLinePenalty(line)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			c := q.get(x, y)
+			if c {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size && c == q.get(x+1, y) && c == q.get(x, y+1) && c == q.get(x+1, y+1) {
+				result += 3
+			}
+		}
+	}
+	total := q.size * q.size
+	result += abs(dark*100/total-50) / 5 * 10
+	return result
+}
+
+// qrLinePenalty scores the runs of the same colour and the finder-like
+// patterns of a row or column.
+func qrLinePenalty(line []bool) int {
+	result := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			result += 3 + run - 5
+		}
+		run = 1
+	}
+
+	finder := []bool{true, false, true, true, true, false, true}
+	for i := 0; i+len(finder) <= len(line); i++ {
+		match := true
+		for j, f := range finder {
+			if line[i+j] != f {
+				match = false
+				break
+			}
+		}
+		if match && (qrLight(line, i-4, i) || qrLight(line, i+7, i+11)) {
+			result += 40
+		}
+	}
+	return result
+}
+
+// qrLight reports whether the modules from..to of a line are light. Modules
+// outside the symbol belong to the quiet zone and are light.
+func qrLight(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,174 @@
+package barcode
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+const (
+	CODE128 = "CODE128"
+	EAN13   = "EAN13"
+	QR      = "QR"
+)
+
+// Symbol is an encoded barcode: a grid of dark and light modules. Linear
+// barcodes have a single row that is stretched to the bar height when rendered;
+// QR codes are square.
+type Symbol struct {
+	Type      string // CODE128, EAN13, QR
+	Text      string // Teks yang dapat dibaca manusia
+	Width     int    // Dalam modul, tanpa quiet zone
+	Height    int
+	QuietZone int // Modul kosong di setiap sisi
+	modules   []bool
+}
+
+func newSymbol(symbology, text string, width, height, quietZone int) *Symbol {
+	return &Symbol{
+		Type:      symbology,
+		Text:      text,
+		Width:     width,
+		Height:    height,
+		QuietZone: quietZone,
+		modules:   make([]bool, width*height),
+	}
+}
+
+// Encode encodes data in the given symbology.
+func Encode(symbology, data string) (*Symbol, error) {
+	switch strings.ToUpper(symbology) {
+	case CODE128:
+		return EncodeCode128(data)
+	case EAN13:
+		return EncodeEAN13(data)
+	case QR:
+		return EncodeQR(data, QRLevelM)
+	}
+	return nil, fmt.Errorf("unsupported symbology %s", symbology)
+}
+
+// IsLinear reports whether the symbol is a one-dimensional barcode.
+func (s *Symbol) IsLinear() bool {
+	return s.Height == 1
+}
+
+// At reports whether the module at column x and row y is dark. Modules outside
+// the symbol, e.g. in the quiet zone, are light.
+func (s *Symbol) At(x, y int) bool {
+	if x < 0 || y < 0 || x >= s.Width || y >= s.Height {
+		return false
+	}
+	return s.modules[y*s.Width+x]
+}
+
+func (s *Symbol) set(x, y int, dark bool) {
+	s.modules[y*s.Width+x] = dark
+}
+
+// bars returns the dark runs of a row as pairs of start column and width.
+func (s *Symbol) bars(y int) [][2]int {
+	var bars [][2]int
+	for x := 0; x < s.Width; x++ {
+		if !s.At(x, y) {
+			continue
+		}
+		start := x
+		for x < s.Width && s.At(x, y) {
+			x++
+		}
+		bars = append(bars, [2]int{start, x - start})
+	}
+	return bars
+}
+
+// Image renders the symbol with each module scale pixels wide. Linear barcodes
+// are barHeight pixels high; QR codes ignore barHeight.
+func (s *Symbol) Image(scale, barHeight int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	rows := s.Height * scale
+	if s.IsLinear() {
+		if barHeight < 1 {
+			barHeight = 50 * scale
+		}
+		rows = barHeight
+	}
+	quiet := s.QuietZone * scale
+	img := image.NewGray(image.Rect(0, 0, s.Width*scale+2*quiet, rows+2*quiet))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for py := 0; py < rows; py++ {
+		y := 0
+		if !s.IsLinear() {
+			y = py / scale
+		}
+		for px := 0; px < s.Width*scale; px++ {
+			if s.At(px/scale, y) {
+				img.SetGray(quiet+px, quiet+py, color.Gray{Y: 0})
+			}
+		}
+	}
+	return img
+}
+
+// PNG renders the symbol as a PNG image, see Image.
+func (s *Symbol) PNG(scale, barHeight int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, s.Image(scale, barHeight)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the symbol as an SVG document in which a module is scale user units
+// wide. Linear barcodes are barHeight units high and carry their text below the
+// bars.
+func (s *Symbol) SVG(scale, barHeight int) string {
+	if scale < 1 {
+		scale = 1
+	}
+	rows := s.Height * scale
+	textHeight := 0
+	if s.IsLinear() {
+		if barHeight < 1 {
+			barHeight = 50 * scale
+		}
+		rows = barHeight
+		if s.Text != "" {
+			textHeight = 10 * scale
+		}
+	}
+	quiet := s.QuietZone * scale
+	width := s.Width*scale + 2*quiet
+	height := rows + textHeight + 2*quiet
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, width, height)
+	b.WriteString(`<g fill="#000">`)
+	if s.IsLinear() {
+		for _, bar := range s.bars(0) {
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d"/>`, quiet+bar[0]*scale, quiet, bar[1]*scale, rows)
+		}
+	} else {
+		for y := 0; y < s.Height; y++ {
+			for _, bar := range s.bars(y) {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d"/>`, quiet+bar[0]*scale, quiet+y*scale, bar[1]*scale, scale)
+			}
+		}
+	}
+	b.WriteString(`</g>`)
+	if textHeight > 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="monospace" font-size="%d" text-anchor="middle">%s</text>`,
+			width/2, quiet+rows+textHeight-scale, 9*scale, html.EscapeString(s.Text))
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
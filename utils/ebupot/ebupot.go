@@ -0,0 +1,98 @@
+// Package ebupot writes withholding slips (bukti potong) of PPh 23 and PPh 4(2)
+// in the import layout of the DJP e-Bupot 23/26 application.
+package ebupot
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var header = []string{
+	"No",
+	"Tgl Pemotongan (dd/MM/yyyy)",
+	"Penerima Penghasilan? (NPWP/NIK)",
+	"NPWP (tanpa format/tanda baca)",
+	"NIK (tanpa format/tanda baca)",
+	"Nomor Telp",
+	"Kode Objek Pajak",
+	"Penanda Tangan BP Pengurus?",
+	"Penghasilan Bruto",
+	"Mendapatkan Fasilitas ?",
+	"Nomor SKB",
+	"Nomor Aturan DTP",
+	"NTPN DTP",
+	"Tarif",
+	"PPh Dipotong",
+	"Nomor Bukti Potong",
+	"Dokumen Referensi",
+}
+
+// Slip is a withholding slip. Amounts are in rupiah; the import only accepts
+// whole rupiah, so they are truncated when written.
+type Slip struct {
+	Number         string
+	Date           time.Time
+	TaxPayerNumber string
+	Phone          string
+	TaxObjectCode  string
+	TaxBase        float64
+	Rate           float64
+	Amount         float64
+	Reference      string
+}
+
+// WriteSlips writes the slips with a header row, numbering the rows from 1.
+// Slips are written for a recipient with a tax payer number (NPWP); the
+// recipient's signature column is left at the default "N".
+func WriteSlips(w io.Writer, slips []Slip) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for i, v := range slips {
+		if v.TaxObjectCode == "" {
+			return errors.New("withholding slip " + v.Number + " has no tax object code")
+		}
+		if v.Date.IsZero() {
+			return errors.New("withholding slip " + v.Number + " has no date")
+		}
+		err := writer.Write([]string{
+			strconv.Itoa(i + 1),
+			v.Date.Format("02/01/2006"),
+			"NPWP",
+			digitsOnly(v.TaxPayerNumber),
+			"",
+			v.Phone,
+			v.TaxObjectCode,
+			"N",
+			strconv.FormatInt(int64(v.TaxBase), 10),
+			"N",
+			"",
+			"",
+			"",
+			strconv.FormatFloat(v.Rate, 'f', -1, 64),
+			strconv.FormatInt(int64(v.Amount), 10),
+			v.Number,
+			v.Reference,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
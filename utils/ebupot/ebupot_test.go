@@ -0,0 +1,36 @@
+package ebupot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSlips(t *testing.T) {
+	var b strings.Builder
+	err := WriteSlips(&b, []Slip{
+		{
+			Number:         "BP/2024/03/00001",
+			Date:           time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+			TaxPayerNumber: "01.234.567.8-901.000",
+			TaxObjectCode:  "24-104-01",
+			TaxBase:        1500000.6,
+			Rate:           2,
+			Amount:         30000.01,
+			Reference:      "PO-001",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := "1,15/03/2024,NPWP,012345678901000,,,24-104-01,N,1500000,N,,,,2,30000,BP/2024/03/00001,PO-001"
+	if len(lines) != 2 || lines[1] != want {
+		t.Errorf("lines = %q, want header and %s", lines, want)
+	}
+
+	err = WriteSlips(&b, []Slip{{Number: "BP/2024/03/00002", Date: time.Now()}})
+	if err == nil {
+		t.Error("A slip without tax object code should produce an error")
+	}
+}
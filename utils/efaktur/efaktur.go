@@ -0,0 +1,231 @@
+// Package efaktur writes tax invoices in the CSV import format of the DJP
+// e-Faktur application and handles tax invoice serial numbers (NSFP).
+package efaktur
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Row types of the e-Faktur CSV import.
+const (
+	ROW_OUTPUT       = "FK"
+	ROW_COUNTERPARTY = "LT"
+	ROW_OBJECT       = "OF"
+	ROW_INPUT        = "FM"
+)
+
+// SerialLength is the number of digits of a tax invoice serial number: a
+// 3 digit branch code, the last 2 digits of the year and an 8 digit sequence.
+const SerialLength = 13
+
+var outputHeader = [][]string{
+	{ROW_OUTPUT, "KD_JENIS_TRANSAKSI", "FG_PENGGANTI", "NOMOR_FAKTUR", "MASA_PAJAK", "TAHUN_PAJAK", "TANGGAL_FAKTUR", "NPWP", "NAMA", "ALAMAT_LENGKAP", "JUMLAH_DPP", "JUMLAH_PPN", "JUMLAH_PPNBM", "ID_KETERANGAN_TAMBAHAN", "FG_UANG_MUKA", "UANG_MUKA_DPP", "UANG_MUKA_PPN", "UANG_MUKA_PPNBM", "REFERENSI"},
+	{ROW_COUNTERPARTY, "NPWP", "NAMA", "JALAN", "BLOK", "NOMOR", "RT", "RW", "KECAMATAN", "KELURAHAN", "KABUPATEN", "PROPINSI", "KODE_POS", "NOMOR_TELEPON"},
+	{ROW_OBJECT, "KODE_OBJEK", "NAMA", "HARGA_SATUAN", "JUMLAH_BARANG", "HARGA_TOTAL", "DISKON", "DPP", "PPN", "TARIF_PPNBM", "PPNBM"},
+}
+
+var inputHeader = []string{ROW_INPUT, "KD_JENIS_TRANSAKSI", "FG_PENGGANTI", "NOMOR_FAKTUR", "MASA_PAJAK", "TAHUN_PAJAK", "TANGGAL_FAKTUR", "NPWP", "NAMA", "ALAMAT_LENGKAP", "JUMLAH_DPP", "JUMLAH_PPN", "JUMLAH_PPNBM", "IS_CREDITABLE"}
+
+// Invoice is a tax invoice. Amounts are in rupiah; the import only accepts
+// whole rupiah, so they are truncated when written.
+type Invoice struct {
+	TransactionCode string
+	Replacement     bool
+	SerialNumber    string
+	Date            time.Time
+	TaxPayerNumber  string
+	Name            string
+	Address         string
+	TaxBase         float64
+	VAT             float64
+	LuxuryTax       float64
+	Reference       string
+	Creditable      bool
+	Objects         []Object
+}
+
+// Object is a good or service of an output tax invoice.
+type Object struct {
+	Code      string
+	Name      string
+	UnitPrice float64
+	Quantity  float64
+	Total     float64
+	Discount  float64
+	TaxBase   float64
+	VAT       float64
+}
+
+// WriteOutput writes output tax invoices as FK rows, each followed by an LT row
+// with the customer and an OF row for every object.
+func WriteOutput(w io.Writer, invoices []Invoice) error {
+	writer := csv.NewWriter(w)
+	for _, row := range outputHeader {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	for _, v := range invoices {
+		if err := validate(v); err != nil {
+			return err
+		}
+		rows := [][]string{
+			{
+				ROW_OUTPUT,
+				v.TransactionCode,
+				flag(v.Replacement),
+				v.SerialNumber,
+				strconv.Itoa(int(v.Date.Month())),
+				strconv.Itoa(v.Date.Year()),
+				v.Date.Format("02/01/2006"),
+				TaxPayerNumber(v.TaxPayerNumber),
+				v.Name,
+				v.Address,
+				rupiah(v.TaxBase),
+				rupiah(v.VAT),
+				rupiah(v.LuxuryTax),
+				"",
+				"0",
+				"0",
+				"0",
+				"0",
+				v.Reference,
+			},
+			{ROW_COUNTERPARTY, TaxPayerNumber(v.TaxPayerNumber), v.Name, v.Address, "", "", "", "", "", "", "", "", "", ""},
+		}
+		for _, o := range v.Objects {
+			rows = append(rows, []string{
+				ROW_OBJECT,
+				o.Code,
+				o.Name,
+				decimal(o.UnitPrice),
+				decimal(o.Quantity),
+				decimal(o.Total),
+				decimal(o.Discount),
+				decimal(o.TaxBase),
+				decimal(o.VAT),
+				"0",
+				"0",
+			})
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteInput writes input tax invoices as FM rows.
+func WriteInput(w io.Writer, invoices []Invoice) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(inputHeader); err != nil {
+		return err
+	}
+	for _, v := range invoices {
+		if err := validate(v); err != nil {
+			return err
+		}
+		err := writer.Write([]string{
+			ROW_INPUT,
+			v.TransactionCode,
+			flag(v.Replacement),
+			v.SerialNumber,
+			strconv.Itoa(int(v.Date.Month())),
+			strconv.Itoa(v.Date.Year()),
+			v.Date.Format("02/01/2006"),
+			TaxPayerNumber(v.TaxPayerNumber),
+			v.Name,
+			v.Address,
+			rupiah(v.TaxBase),
+			rupiah(v.VAT),
+			rupiah(v.LuxuryTax),
+			flag(v.Creditable),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ParseSerial returns the digits of a tax invoice serial number written with
+// or without separators, e.g. "010.000-24.00000001" or "0002400000001". The
+// leading transaction code and replacement flag of the full notation are dropped.
+func ParseSerial(serial string) (string, error) {
+	digits := digitsOnly(serial)
+	if len(digits) == SerialLength+3 {
+		digits = digits[3:]
+	}
+	if len(digits) != SerialLength {
+		return "", fmt.Errorf("invalid tax invoice serial number %q", serial)
+	}
+	return digits, nil
+}
+
+// FormatSerial formats a serial number as a 13 digit string.
+func FormatSerial(number int64) string {
+	return fmt.Sprintf("%0*d", SerialLength, number)
+}
+
+// SerialYear returns the 2 digit year of a serial number.
+func SerialYear(serial string) int {
+	year, _ := strconv.Atoi(serial[3:5])
+	return year
+}
+
+// TaxPayerNumber returns the digits of a tax payer number (NPWP). Contacts
+// without a tax payer number are written as 15 zeros.
+func TaxPayerNumber(npwp string) string {
+	digits := digitsOnly(npwp)
+	if digits == "" {
+		return strings.Repeat("0", 15)
+	}
+	return digits
+}
+
+func validate(v Invoice) error {
+	if len(v.TransactionCode) != 2 {
+		return fmt.Errorf("invalid transaction code %q of tax invoice %s", v.TransactionCode, v.SerialNumber)
+	}
+	if len(v.SerialNumber) != SerialLength {
+		return fmt.Errorf("invalid tax invoice serial number %q", v.SerialNumber)
+	}
+	if v.Date.IsZero() {
+		return errors.New("tax invoice " + v.SerialNumber + " has no date")
+	}
+	return nil
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func flag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// rupiah truncates an amount to whole rupiah.
+func rupiah(amount float64) string {
+	return strconv.FormatInt(int64(amount), 10)
+}
+
+func decimal(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
@@ -0,0 +1,97 @@
+package efaktur
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteOutput(t *testing.T) {
+	var b strings.Builder
+	err := WriteOutput(&b, []Invoice{
+		{
+			TransactionCode: "01",
+			SerialNumber:    "0102400000001",
+			Date:            time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+			TaxPayerNumber:  "01.234.567.8-901.000",
+			Name:            "PT Pelanggan",
+			Address:         "Jl. Merdeka 1, Jakarta",
+			TaxBase:         1000000.75,
+			VAT:             110000.08,
+			Reference:       "INV-001",
+			Objects: []Object{
+				{Code: "SKU-1", Name: "Barang", UnitPrice: 500000.375, Quantity: 2, Total: 1000000.75, TaxBase: 1000000.75, VAT: 110000.08},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("len(lines) = %d, want 6", len(lines))
+	}
+	var tests = []string{
+		"FK,01,0,0102400000001,3,2024,05/03/2024,012345678901000,PT Pelanggan,\"Jl. Merdeka 1, Jakarta\",1000000,110000,0,,0,0,0,0,INV-001",
+		"LT,012345678901000,PT Pelanggan,\"Jl. Merdeka 1, Jakarta\",,,,,,,,,,",
+		"OF,SKU-1,Barang,500000.375,2,1000000.75,0,1000000.75,110000.08,0,0",
+	}
+	for i, test := range tests {
+		if lines[i+3] != test {
+			t.Errorf("lines[%d] = %s, want %s", i+3, lines[i+3], test)
+		}
+	}
+}
+
+func TestWriteInput(t *testing.T) {
+	var b strings.Builder
+	err := WriteInput(&b, []Invoice{
+		{
+			TransactionCode: "01",
+			Replacement:     true,
+			SerialNumber:    "0102400000009",
+			Date:            time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+			Name:            "CV Pemasok",
+			TaxBase:         200000,
+			VAT:             22000,
+			Creditable:      true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := "FM,01,1,0102400000009,12,2024,31/12/2024,000000000000000,CV Pemasok,,200000,22000,0,1"
+	if len(lines) != 2 || lines[1] != want {
+		t.Errorf("lines = %q, want header and %s", lines, want)
+	}
+
+	err = WriteInput(&b, []Invoice{{TransactionCode: "01", SerialNumber: "123", Date: time.Now()}})
+	if err == nil {
+		t.Error("An invalid serial number should produce an error")
+	}
+}
+
+func TestParseSerial(t *testing.T) {
+	var tests = []struct {
+		serial string
+		want   string
+		ok     bool
+	}{
+		{"010.000-24.00000001", "0002400000001", true},
+		{"0102400000001", "0102400000001", true},
+		{"010.024-00000001", "", false},
+	}
+	for _, test := range tests {
+		got, err := ParseSerial(test.serial)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("ParseSerial(%q) = %q, %v, want %q", test.serial, got, err, test.want)
+		}
+	}
+	if got := FormatSerial(2400000001); got != "0002400000001" {
+		t.Errorf("FormatSerial = %s", got)
+	}
+	if got := SerialYear("0002400000001"); got != 24 {
+		t.Errorf("SerialYear = %d, want 24", got)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
 	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gabriel-vasile/mimetype"
@@ -124,24 +125,20 @@ func Uuid() string {
 	return uuid.New().String()
 }
 
+// CalculateIncludeTax returns the tax contained in a tax-inclusive subtotal.
+// The tax is computed with exact decimal arithmetic to four decimal places;
+// rounding to the document precision is left to the caller.
 func CalculateIncludeTax(subtotalInclTax float64, taxRate float64) float64 {
-	// Rumus: pajak = (subtotal_incl_tax * tax_rate) / (1 + tax_rate)
-	// jika tax_rate dalam persen maka konversi ke pecahan terlebih dahulu
-	taxRateFraction := taxRate / 100
-	tax := (subtotalInclTax * taxRateFraction) / (1 + taxRateFraction)
-	return tax
+	// Rumus: pajak = (subtotal_incl_tax * tax_rate) / (100 + tax_rate)
+	return money.FromFloat(subtotalInclTax).Mul(taxRate).Div(100 + taxRate).Float64()
 }
 
+// CalculateExcludeTax returns the tax on a tax-exclusive subtotal. The tax is
+// computed with exact decimal arithmetic to four decimal places; rounding to
+// the document precision is left to the caller.
 func CalculateExcludeTax(subtotalExclTax float64, taxRate float64) float64 {
-	// Rumus: pajak = subtotal_excl_tax * tax_rate
-	// jika tax_rate dalam persen maka konversi ke pecahan terlebih dahulu
-	taxRateFraction := taxRate / 100
-	tax := subtotalExclTax * taxRateFraction
-	// fmt.Println("taxRate", taxRate)
-	// fmt.Println("taxRateFraction", taxRateFraction)
-	// fmt.Println("subtotalExclTax", subtotalExclTax)
-	// fmt.Println("tax", tax)
-	return tax
+	// Rumus: pajak = subtotal_excl_tax * tax_rate / 100
+	return money.FromFloat(subtotalExclTax).Percent(taxRate).Float64()
 }
 
 func ContainsString(arr []string, str string) bool {
@@ -51,6 +51,8 @@ type InvoicePDFItem struct {
 	Quantity           string
 	UnitPrice          string
 	UnitName           string
+	BaseQuantity       string // Jumlah dalam satuan dasar, kosong jika satuan transaksi adalah satuan dasar
+	BaseUnitName       string
 	Total              string
 	SubTotal           string
 	SubtotalBeforeDisc string
@@ -0,0 +1,9 @@
+/*
+Package money provides an exact fixed-point Amount type for money arithmetic.
+
+Amounts keep four decimal places in an int64, so sums never drift the way
+float64 sums do. Multiplication by rates and percentages is done with exact
+rational intermediates and rounded half-up. Rounding describes how documents
+round their tax amounts: per line, or once per document.
+*/
+package money
@@ -0,0 +1,266 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places kept by an Amount.
+const Scale = 4
+
+const unit = 10000
+
+// Amount is an exact fixed-point money amount with Scale decimal places.
+// The zero value is zero.
+type Amount int64
+
+// FromFloat converts a float64 into an Amount, rounding half-up to Scale
+// decimal places. The shortest decimal representation of the float is used,
+// so 0.1 becomes exactly 0.1000.
+func FromFloat(f float64) Amount {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return 0
+	}
+	return fromRat(r)
+}
+
+// Parse parses a decimal string such as "1250.50" or "-0.125" into an Amount,
+// rounding half-up to Scale decimal places.
+func Parse(s string) (Amount, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, errors.New("invalid amount: " + s)
+	}
+	return fromRat(r), nil
+}
+
+// Sum adds all amounts.
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
+
+// SumFloat converts every value with FromFloat and adds them exactly.
+func SumFloat(values ...float64) Amount {
+	var total Amount
+	for _, v := range values {
+		total += FromFloat(v)
+	}
+	return total
+}
+
+func (a Amount) Add(b Amount) Amount { return a + b }
+
+func (a Amount) Sub(b Amount) Amount { return a - b }
+
+func (a Amount) Neg() Amount { return -a }
+
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func (a Amount) IsZero() bool { return a == 0 }
+
+// Sign returns -1, 0 or 1.
+func (a Amount) Sign() int {
+	switch {
+	case a < 0:
+		return -1
+	case a > 0:
+		return 1
+	}
+	return 0
+}
+
+// Mul multiplies the amount by a factor such as a quantity or an exchange
+// rate, rounding the result half-up to Scale decimal places.
+func (a Amount) Mul(factor float64) Amount {
+	f, ok := new(big.Rat).SetString(strconv.FormatFloat(factor, 'f', -1, 64))
+	if !ok {
+		return 0
+	}
+	return fromRat(new(big.Rat).Mul(a.rat(), f))
+}
+
+// Percent returns percent % of the amount, e.g. Percent(11) for 11% VAT.
+func (a Amount) Percent(percent float64) Amount {
+	p, ok := new(big.Rat).SetString(strconv.FormatFloat(percent, 'f', -1, 64))
+	if !ok {
+		return 0
+	}
+	p.Quo(p, big.NewRat(100, 1))
+	return fromRat(new(big.Rat).Mul(a.rat(), p))
+}
+
+// Div divides the amount by a divisor, rounding the result half-up to Scale
+// decimal places. Dividing by zero returns zero.
+func (a Amount) Div(divisor float64) Amount {
+	d, ok := new(big.Rat).SetString(strconv.FormatFloat(divisor, 'f', -1, 64))
+	if !ok || d.Sign() == 0 {
+		return 0
+	}
+	return fromRat(new(big.Rat).Quo(a.rat(), d))
+}
+
+// Round rounds the amount half-up (away from zero) to the given number of
+// decimal places.
+func (a Amount) Round(places int) Amount {
+	if places >= Scale {
+		return a
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := pow10(Scale - places)
+	q, r := int64(a)/step, int64(a)%step
+	if r < 0 {
+		r = -r
+	}
+	if r*2 >= step {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Amount(q * step)
+}
+
+// RoundHalfEven rounds the amount to the given number of decimal places,
+// sending exact halves to the nearest even digit (banker's rounding).
+func (a Amount) RoundHalfEven(places int) Amount {
+	if places >= Scale {
+		return a
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := pow10(Scale - places)
+	q, r := int64(a)/step, int64(a)%step
+	if r < 0 {
+		r = -r
+	}
+	if r*2 > step || (r*2 == step && q%2 != 0) {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Amount(q * step)
+}
+
+// Allocate splits the amount across the weights in proportion to them, at the
+// given number of decimal places. The parts always add up to the amount rounded
+// to that precision; the units left over by rounding go to the parts with the
+// largest remainders. Zero or empty weights give zero parts.
+func (a Amount) Allocate(weights []Amount, places int) []Amount {
+	parts := make([]Amount, len(weights))
+	var totalWeight Amount
+	for _, w := range weights {
+		totalWeight += w
+	}
+	if totalWeight == 0 || len(weights) == 0 {
+		return parts
+	}
+	if places > Scale {
+		places = Scale
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := big.NewInt(pow10(Scale - places))
+	total := a.Round(places)
+	totalUnits := new(big.Int).Quo(big.NewInt(int64(total)), step)
+
+	remainders := make([]*big.Int, len(weights))
+	allocated := new(big.Int)
+	for i, w := range weights {
+		num := new(big.Int).Mul(totalUnits, big.NewInt(int64(w)))
+		q, r := new(big.Int).QuoRem(num, big.NewInt(int64(totalWeight)), new(big.Int))
+		parts[i] = Amount(new(big.Int).Mul(q, step).Int64())
+		remainders[i] = r.Abs(r)
+		allocated.Add(allocated, q)
+	}
+
+	left := new(big.Int).Sub(totalUnits, allocated).Int64()
+	one := Amount(step.Int64())
+	if left < 0 {
+		one = -one
+		left = -left
+	}
+	used := make([]bool, len(weights))
+	for ; left > 0; left-- {
+		best := -1
+		for i := range weights {
+			if used[i] {
+				continue
+			}
+			if best == -1 || remainders[i].Cmp(remainders[best]) > 0 {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		parts[best] += one
+		used[best] = true
+	}
+	return parts
+}
+
+// Float64 returns the amount as a float64, the representation used by the
+// model columns.
+func (a Amount) Float64() float64 {
+	f, _ := strconv.ParseFloat(a.String(), 64)
+	return f
+}
+
+// String formats the amount with Scale decimal places, e.g. "-1250.5000".
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, v/unit, Scale, v%unit)
+}
+
+func (a Amount) rat() *big.Rat {
+	return big.NewRat(int64(a), unit)
+}
+
+// fromRat rounds a rational number half-up (away from zero) to Scale places.
+func fromRat(r *big.Rat) Amount {
+	scaled := new(big.Rat).Mul(r, big.NewRat(unit, 1))
+	num, den := scaled.Num(), scaled.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	rem.Abs(rem).Mul(rem, big.NewInt(2))
+	if rem.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Amount(q.Int64())
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
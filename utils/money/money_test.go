@@ -0,0 +1,143 @@
+package money
+
+import "testing"
+
+func TestFromFloat(t *testing.T) {
+	var tests = []struct {
+		in   float64
+		want string
+	}{
+		{0.1, "0.1000"},
+		{1.005, "1.0050"},
+		{1234.56789, "1234.5679"},
+		{-0.00005, "-0.0001"},
+		{0.00004, "0.0000"},
+		{1e9, "1000000000.0000"},
+	}
+
+	for _, test := range tests {
+		if got := FromFloat(test.in).String(); got != test.want {
+			t.Errorf("FromFloat(%v) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want Amount
+	}{
+		{"1250.50", 12505000},
+		{"-0.125", -1250},
+		{" 3 ", 30000},
+		{"0.00005", 1},
+	}
+
+	for _, test := range tests {
+		if got, err := Parse(test.in); err != nil || got != test.want {
+			t.Errorf("Parse(%q) = %d, %v, want %d", test.in, got, err, test.want)
+		}
+	}
+
+	if _, err := Parse("abc"); err == nil {
+		t.Error("An invalid amount should produce an error")
+	}
+}
+
+func TestSumHasNoDrift(t *testing.T) {
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = 0.1
+	}
+	if got := SumFloat(values...); got != FromFloat(100) {
+		t.Errorf("SumFloat(0.1 x 1000) = %s, want 100.0000", got)
+	}
+}
+
+func TestRound(t *testing.T) {
+	var tests = []struct {
+		in       string
+		places   int
+		halfUp   string
+		halfEven string
+	}{
+		{"2.345", 2, "2.3500", "2.3400"},
+		{"2.355", 2, "2.3600", "2.3600"},
+		{"-2.345", 2, "-2.3500", "-2.3400"},
+		{"2.3449", 2, "2.3400", "2.3400"},
+		{"1500.5", 0, "1501.0000", "1500.0000"},
+		{"-1500.5", 0, "-1501.0000", "-1500.0000"},
+		{"1.2345", 4, "1.2345", "1.2345"},
+	}
+
+	for _, test := range tests {
+		a, _ := Parse(test.in)
+		if got := a.Round(test.places).String(); got != test.halfUp {
+			t.Errorf("Round(%s, %d) = %s, want %s", test.in, test.places, got, test.halfUp)
+		}
+		if got := a.RoundHalfEven(test.places).String(); got != test.halfEven {
+			t.Errorf("RoundHalfEven(%s, %d) = %s, want %s", test.in, test.places, got, test.halfEven)
+		}
+	}
+}
+
+func TestMulPercentDiv(t *testing.T) {
+	a, _ := Parse("1234.55")
+	if got := a.Percent(11).String(); got != "135.8005" {
+		t.Errorf("Percent(11) = %s, want 135.8005", got)
+	}
+	if got := a.Mul(3).String(); got != "3703.6500" {
+		t.Errorf("Mul(3) = %s, want 3703.6500", got)
+	}
+	if got := FromFloat(100).Div(3).String(); got != "33.3333" {
+		t.Errorf("Div(3) = %s, want 33.3333", got)
+	}
+	if got := FromFloat(100).Div(0); got != 0 {
+		t.Errorf("Div(0) = %s, want 0", got)
+	}
+	if got := FromFloat(15000).Mul(0.0000667).String(); got != "1.0005" {
+		t.Errorf("Mul(0.0000667) = %s, want 1.0005", got)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	var tests = []struct {
+		total   string
+		weights []string
+		places  int
+		want    []string
+	}{
+		{"100", []string{"1", "1", "1"}, 2, []string{"33.3400", "33.3300", "33.3300"}},
+		{"-100", []string{"1", "1", "1"}, 2, []string{"-33.3400", "-33.3300", "-33.3300"}},
+		{"10", []string{"0", "0"}, 2, []string{"0.0000", "0.0000"}},
+		{"110", []string{"333.33", "666.67"}, 0, []string{"37.0000", "73.0000"}},
+	}
+
+	for _, test := range tests {
+		total, _ := Parse(test.total)
+		weights := make([]Amount, len(test.weights))
+		for i, w := range test.weights {
+			weights[i], _ = Parse(w)
+		}
+		parts := total.Allocate(weights, test.places)
+		for i, p := range parts {
+			if p.String() != test.want[i] {
+				t.Errorf("Allocate(%s, %v)[%d] = %s, want %s", test.total, test.weights, i, p, test.want[i])
+			}
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	a, _ := Parse("10.005")
+	if got := DefaultRounding.Line(a).String(); got != "10.0100" {
+		t.Errorf("PER_LINE Line = %s, want 10.0100", got)
+	}
+	perDocument := Rounding{Mode: PER_DOCUMENT, Precision: 0}
+	if got := perDocument.Line(a); got != a {
+		t.Errorf("PER_DOCUMENT Line = %s, want %s", got, a)
+	}
+	if got := perDocument.Document(a).String(); got != "10.0000" {
+		t.Errorf("PER_DOCUMENT Document = %s, want 10.0000", got)
+	}
+}
@@ -0,0 +1,36 @@
+package money
+
+// RoundingMode tells where tax amounts are rounded.
+type RoundingMode string
+
+const (
+	// PER_LINE rounds the tax of every line half-up; the document total is the
+	// sum of the rounded lines.
+	PER_LINE RoundingMode = "PER_LINE"
+	// PER_DOCUMENT keeps line taxes exact and rounds half-up once on the
+	// document total. The rounded total is allocated back to the lines.
+	PER_DOCUMENT RoundingMode = "PER_DOCUMENT"
+)
+
+// Rounding is the rounding configuration of a company.
+type Rounding struct {
+	Mode      RoundingMode
+	Precision int
+}
+
+// DefaultRounding rounds half-up per line to two decimal places.
+var DefaultRounding = Rounding{Mode: PER_LINE, Precision: 2}
+
+// Line rounds a line amount when the mode is PER_LINE, and returns it
+// unchanged otherwise.
+func (r Rounding) Line(a Amount) Amount {
+	if r.Mode == PER_DOCUMENT {
+		return a
+	}
+	return a.Round(r.Precision)
+}
+
+// Document rounds a document amount. Document amounts are always rounded.
+func (r Rounding) Document(a Amount) Amount {
+	return a.Round(r.Precision)
+}
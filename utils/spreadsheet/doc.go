@@ -0,0 +1,9 @@
+/*
+Package spreadsheet reads and writes simple tables as CSV or XLSX.
+
+A table is a slice of rows of cell text. XLSX workbooks are read and written
+with the standard library only: Read returns the first worksheet, and WriteXLSX
+writes a workbook with a single worksheet. Formulas, styles and dates are not
+interpreted; a cell holds the text or number stored in the file.
+*/
+package spreadsheet
@@ -0,0 +1,53 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+)
+
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// Read parses a CSV or XLSX file. XLSX files are recognised by their zip
+// signature; anything else is read as CSV.
+func Read(data []byte) ([][]string, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return ReadXLSX(data)
+	}
+	return ReadCSV(data)
+}
+
+// ReadCSV parses a CSV file. The separator is a semicolon when the first line
+// has more semicolons than commas, as written by spreadsheets in locales with a
+// decimal comma, and a comma otherwise. A leading byte order mark is dropped.
+func ReadCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// WriteCSV writes rows as a comma separated CSV file.
+func WriteCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes rows in the given format, CSV or XLSX.
+func Write(format, sheetName string, rows [][]string) ([]byte, error) {
+	if strings.EqualFold(format, XLSX) {
+		return WriteXLSX(sheetName, rows)
+	}
+	return WriteCSV(rows)
+}
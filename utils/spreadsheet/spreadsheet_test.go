@@ -0,0 +1,83 @@
+package spreadsheet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestXLSXRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"sku", "name", "price", "barcode", "tags"},
+		{"00123", "Kopi <Gayo> & Teh", "45000", "8999999090050", "minuman;kopi"},
+		{"SKU-2", "", "12.5", "", ""},
+		{"SKU-3", "  spasi  ", "-3", "0.25", "1e5"},
+	}
+	data, err := WriteXLSX("Produk [2026]", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("Read(WriteXLSX()) = %q, want %q", got, rows)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want [][]string
+	}{
+		{"\ufeffsku,name\nA,\"Kopi, bubuk\"\n", [][]string{{"sku", "name"}, {"A", "Kopi, bubuk"}}},
+		{"sku;price\nA;1,5\n", [][]string{{"sku", "price"}, {"A", "1,5"}}},
+		{"sku,name,price\nA,B\n", [][]string{{"sku", "name", "price"}, {"A", "B"}}},
+	}
+	for _, test := range tests {
+		got, err := Read([]byte(test.in))
+		if err != nil {
+			t.Errorf("Read(%q) error: %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Read(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCellIndex(t *testing.T) {
+	for _, test := range []struct {
+		ref         string
+		column, row int
+	}{
+		{"A1", 0, 0},
+		{"Z10", 25, 9},
+		{"AA2", 26, 1},
+		{"AB12", 27, 11},
+	} {
+		column, row, err := cellIndex(test.ref)
+		if err != nil || column != test.column || row != test.row {
+			t.Errorf("cellIndex(%s) = %d, %d, %v", test.ref, column, row, err)
+		}
+		if name := columnName(test.column); name+"" != test.ref[:len(name)] {
+			t.Errorf("columnName(%d) = %s", test.column, name)
+		}
+	}
+	if _, _, err := cellIndex("12"); err == nil {
+		t.Error("cellIndex accepted a reference without column")
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"12.300000000000001": "12.3",
+		"45000":              "45000",
+		"1E-3":               "0.001",
+		"abc":                "abc",
+	} {
+		if got := formatNumber(in); got != want {
+			t.Errorf("formatNumber(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
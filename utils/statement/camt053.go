@@ -0,0 +1,178 @@
+package statement
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID      string `xml:"Id"`
+	Account struct {
+		IBAN     string `xml:"Id>IBAN"`
+		Other    string `xml:"Id>Othr>Id"`
+		Currency string `xml:"Ccy"`
+	} `xml:"Acct"`
+	Period struct {
+		From string `xml:"FrDtTm"`
+		To   string `xml:"ToDtTm"`
+	} `xml:"FrToDt"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code   string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount camtAmount `xml:"Amt"`
+	Sign   string     `xml:"CdtDbtInd"`
+	Date   camtDate   `xml:"Dt"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtEntry struct {
+	Amount         camtAmount `xml:"Amt"`
+	Sign           string     `xml:"CdtDbtInd"`
+	BookingDate    camtDate   `xml:"BookgDt"`
+	ValueDate      camtDate   `xml:"ValDt"`
+	ServicerRef    string     `xml:"AcctSvcrRef"`
+	AdditionalInfo string     `xml:"AddtlNtryInf"`
+	Details        []struct {
+		EndToEndID   string   `xml:"Refs>EndToEndId"`
+		Unstructured []string `xml:"RmtInf>Ustrd"`
+		Structured   string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// ParseCAMT053 parses an ISO 20022 camt.053 bank-to-customer statement.
+//
+// Every Stmt element of the document is read; the lines of all of them are
+// concatenated. The opening balance is the first OPBD (or PRCD) balance and
+// the closing balance the last CLBD balance. XML namespaces are ignored, so
+// every camt.053 version is accepted.
+func ParseCAMT053(r io.Reader) (*Statement, error) {
+	var doc camtDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Statements) == 0 {
+		return nil, errors.New("no camt.053 statement found")
+	}
+
+	st := &Statement{}
+	hasOpening := false
+	for _, s := range doc.Statements {
+		if st.Reference == "" {
+			st.Reference = s.ID
+		}
+		if st.AccountNumber == "" {
+			st.AccountNumber = s.Account.IBAN
+			if st.AccountNumber == "" {
+				st.AccountNumber = s.Account.Other
+			}
+		}
+		if st.CurrencyCode == "" {
+			st.CurrencyCode = s.Account.Currency
+		}
+		if from, err := (camtDate{DateTime: s.Period.From}).parse(); err == nil && (st.StartDate.IsZero() || from.Before(st.StartDate)) {
+			st.StartDate = from
+		}
+		if to, err := (camtDate{DateTime: s.Period.To}).parse(); err == nil && to.After(st.EndDate) {
+			st.EndDate = to
+		}
+		for _, b := range s.Balances {
+			amount, err := camtSigned(b.Amount.Value, b.Sign)
+			if err != nil {
+				return nil, err
+			}
+			switch b.Code {
+			case "OPBD", "PRCD":
+				if !hasOpening {
+					st.OpeningBalance = amount
+					hasOpening = true
+				}
+			case "CLBD":
+				st.ClosingBalance = amount
+			}
+			if st.CurrencyCode == "" {
+				st.CurrencyCode = b.Amount.Currency
+			}
+		}
+		for _, e := range s.Entries {
+			amount, err := camtSigned(e.Amount.Value, e.Sign)
+			if err != nil {
+				return nil, err
+			}
+			date, err := e.BookingDate.parse()
+			if err != nil {
+				return nil, err
+			}
+			line := Line{
+				Date:      date,
+				Amount:    amount,
+				Reference: e.ServicerRef,
+			}
+			if valueDate, err := e.ValueDate.parse(); err == nil && !valueDate.IsZero() {
+				line.ValueDate = &valueDate
+			}
+			descriptions := []string{}
+			for _, d := range e.Details {
+				descriptions = append(descriptions, d.Unstructured...)
+				if d.Structured != "" {
+					line.Reference = d.Structured
+				} else if d.EndToEndID != "" && d.EndToEndID != "NOTPROVIDED" {
+					line.Reference = d.EndToEndID
+				}
+			}
+			if len(descriptions) == 0 && e.AdditionalInfo != "" {
+				descriptions = append(descriptions, e.AdditionalInfo)
+			}
+			line.Description = strings.TrimSpace(strings.Join(descriptions, " "))
+			st.Lines = append(st.Lines, line)
+		}
+	}
+	st.complete()
+	return st, nil
+}
+
+// camtSigned returns the amount positive for credits and negative for debits.
+// CdtDbtInd already gives the direction of reversal entries.
+func camtSigned(value, sign string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if sign == "DBIT" {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if d.Date != "" {
+		return time.Parse("2006-01-02", strings.TrimSpace(d.Date))
+	}
+	if d.DateTime != "" {
+		v := strings.TrimSpace(d.DateTime)
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02T15:04:05", v)
+	}
+	return time.Time{}, errors.New("date is required")
+}
@@ -0,0 +1,159 @@
+package statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AMETORY/ametory-erp-modules/utils/money"
+)
+
+// CSVOptions configures ParseCSV. Zero values use a comma separator and the
+// 2006-01-02 date layout.
+type CSVOptions struct {
+	Comma      rune
+	DateLayout string
+	// DecimalComma parses amounts written as 1.250,50.
+	DecimalComma bool
+}
+
+// ParseCSV parses a CSV statement with a header row.
+//
+// The columns are matched by name, case-insensitively: date, value_date,
+// description, reference, balance and either amount (signed) or debit and
+// credit. A debit is money paid out and a credit is money received.
+func ParseCSV(r io.Reader, opt CSVOptions) (*Statement, error) {
+	if opt.Comma == 0 {
+		opt.Comma = ','
+	}
+	if opt.DateLayout == "" {
+		opt.DateLayout = "2006-01-02"
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = opt.Comma
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.ReplaceAll(name, " ", "_")
+		columns[name] = i
+	}
+	if _, ok := columns["date"]; !ok {
+		return nil, errors.New("date column is required")
+	}
+	_, hasAmount := columns["amount"]
+	_, hasDebit := columns["debit"]
+	_, hasCredit := columns["credit"]
+	if !hasAmount && !hasDebit && !hasCredit {
+		return nil, errors.New("amount or debit/credit columns are required")
+	}
+
+	get := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	st := &Statement{}
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row++
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		date, err := time.Parse(opt.DateLayout, get(record, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid date: %w", row, err)
+		}
+		line := Line{
+			Date:        date,
+			Description: get(record, "description"),
+			Reference:   get(record, "reference"),
+		}
+		if v := get(record, "value_date"); v != "" {
+			valueDate, err := time.Parse(opt.DateLayout, v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid value date: %w", row, err)
+			}
+			line.ValueDate = &valueDate
+		}
+		if hasAmount {
+			line.Amount, err = parseAmount(get(record, "amount"), opt.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid amount: %w", row, err)
+			}
+		} else {
+			debit, err := parseAmount(get(record, "debit"), opt.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid debit: %w", row, err)
+			}
+			credit, err := parseAmount(get(record, "credit"), opt.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid credit: %w", row, err)
+			}
+			line.Amount = credit - debit
+		}
+		if v := get(record, "balance"); v != "" {
+			balance, err := parseAmount(v, opt.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid balance: %w", row, err)
+			}
+			line.Balance = &balance
+		}
+		st.Lines = append(st.Lines, line)
+	}
+
+	st.complete()
+	if len(st.Lines) > 0 {
+		first, last := st.Lines[0], st.Lines[len(st.Lines)-1]
+		if first.Balance != nil {
+			st.OpeningBalance = money.FromFloat(*first.Balance).Sub(money.FromFloat(first.Amount)).Float64()
+		}
+		if last.Balance != nil {
+			st.ClosingBalance = *last.Balance
+		} else {
+			closing := money.FromFloat(st.OpeningBalance)
+			for _, line := range st.Lines {
+				closing = closing.Add(money.FromFloat(line.Amount))
+			}
+			st.ClosingBalance = closing.Float64()
+		}
+	}
+	return st, nil
+}
+
+// parseAmount parses an amount such as "1,250.50", "-300" or, with
+// decimalComma, "1.250,50". An empty value is zero.
+func parseAmount(value string, decimalComma bool) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if decimalComma {
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.ReplaceAll(value, ",", ".")
+	} else {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+	value = strings.ReplaceAll(value, " ", "")
+	return strconv.ParseFloat(value, 64)
+}
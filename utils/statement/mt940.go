@@ -0,0 +1,190 @@
+package statement
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})([0-9]+,?[0-9]*)$`)
+	mt940Line    = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?([0-9]+,[0-9]*)([A-Z][A-Z0-9]{3})([^/]*)(?://(.*))?$`)
+)
+
+// ParseMT940 parses a SWIFT MT940 customer statement.
+//
+// A file may hold several statement messages of the same account; their lines
+// are concatenated, the opening balance is taken from the first :60F:/:60M:
+// field and the closing balance from the last :62F:/:62M: field. The :86:
+// information of a line becomes its description.
+func ParseMT940(r io.Reader) (*Statement, error) {
+	fields, err := mt940Fields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Statement{}
+	hasOpening := false
+	var last *Line
+	for _, f := range fields {
+		switch f.tag {
+		case "20":
+			if st.Reference == "" {
+				st.Reference = f.value
+			}
+		case "25":
+			if st.AccountNumber == "" {
+				st.AccountNumber = f.value
+			}
+		case "60F", "60M":
+			if hasOpening {
+				continue
+			}
+			amount, currency, _, err := mt940ParseBalance(f.value)
+			if err != nil {
+				return nil, err
+			}
+			st.OpeningBalance = amount
+			st.CurrencyCode = currency
+			hasOpening = true
+		case "62F", "62M":
+			amount, currency, date, err := mt940ParseBalance(f.value)
+			if err != nil {
+				return nil, err
+			}
+			st.ClosingBalance = amount
+			if st.CurrencyCode == "" {
+				st.CurrencyCode = currency
+			}
+			if date.After(st.EndDate) {
+				st.EndDate = date
+			}
+		case "61":
+			line, err := mt940ParseLine(f.value)
+			if err != nil {
+				return nil, err
+			}
+			st.Lines = append(st.Lines, *line)
+			last = &st.Lines[len(st.Lines)-1]
+		case "86":
+			if last != nil {
+				last.Description = strings.TrimSpace(strings.Join([]string{last.Description, f.value}, " "))
+				last = nil
+			}
+		}
+	}
+	if len(st.Lines) == 0 && !hasOpening {
+		return nil, errors.New("no MT940 statement found")
+	}
+	end := st.EndDate
+	st.EndDate = time.Time{}
+	st.complete()
+	if end.After(st.EndDate) {
+		st.EndDate = end
+	}
+	return st, nil
+}
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// mt940Fields splits the message into :tag: fields, joining continuation
+// lines and dropping the SWIFT block wrappers.
+func mt940Fields(r io.Reader) ([]mt940Field, error) {
+	var fields []mt940Field
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r ")
+		if i := strings.Index(text, "{4:"); i >= 0 {
+			text = text[i+3:]
+		}
+		if text == "" || text == "-" || strings.HasPrefix(text, "-}") || strings.HasPrefix(text, "{") {
+			continue
+		}
+		if strings.HasPrefix(text, ":") {
+			end := strings.Index(text[1:], ":")
+			if end > 0 {
+				fields = append(fields, mt940Field{tag: text[1 : end+1], value: text[end+2:]})
+				continue
+			}
+		}
+		if len(fields) > 0 {
+			f := &fields[len(fields)-1]
+			if f.tag == "61" {
+				// Supplementary details of a statement line are not needed.
+				continue
+			}
+			f.value = f.value + " " + strings.TrimSpace(text)
+		}
+	}
+	return fields, scanner.Err()
+}
+
+func mt940ParseBalance(value string) (float64, string, time.Time, error) {
+	m := mt940Balance.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, "", time.Time{}, fmt.Errorf("invalid MT940 balance: %s", value)
+	}
+	date, err := time.Parse("060102", m[2])
+	if err != nil {
+		return 0, "", time.Time{}, err
+	}
+	amount, err := parseAmount(m[4], true)
+	if err != nil {
+		return 0, "", time.Time{}, err
+	}
+	if m[1] == "D" {
+		amount = -amount
+	}
+	return amount, m[3], date, nil
+}
+
+func mt940ParseLine(value string) (*Line, error) {
+	m := mt940Line.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return nil, fmt.Errorf("invalid MT940 statement line: %s", value)
+	}
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return nil, err
+	}
+	date := valueDate
+	if m[2] != "" {
+		entry, err := time.Parse("0102", m[2])
+		if err != nil {
+			return nil, err
+		}
+		year := valueDate.Year()
+		switch {
+		case entry.Month() == time.January && valueDate.Month() == time.December:
+			year++
+		case entry.Month() == time.December && valueDate.Month() == time.January:
+			year--
+		}
+		date = time.Date(year, entry.Month(), entry.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	amount, err := parseAmount(m[5], true)
+	if err != nil {
+		return nil, err
+	}
+	// A reversal of a credit is money paid out, a reversal of a debit is money received.
+	if m[3] == "D" || m[3] == "RC" {
+		amount = -amount
+	}
+	reference := strings.TrimSpace(m[7])
+	if reference == "" || reference == "NONREF" {
+		reference = strings.TrimSpace(m[8])
+	}
+	return &Line{
+		Date:      date,
+		ValueDate: &valueDate,
+		Amount:    amount,
+		Reference: reference,
+	}, nil
+}
@@ -0,0 +1,67 @@
+// Package statement parses bank statements in CSV, SWIFT MT940 and ISO 20022
+// camt.053 format into statement lines.
+package statement
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Supported statement formats.
+const (
+	FORMAT_CSV     = "CSV"
+	FORMAT_MT940   = "MT940"
+	FORMAT_CAMT053 = "CAMT053"
+)
+
+// Statement is a bank statement parsed from one of the supported formats.
+type Statement struct {
+	Reference      string
+	AccountNumber  string
+	CurrencyCode   string
+	OpeningBalance float64
+	ClosingBalance float64
+	StartDate      time.Time
+	EndDate        time.Time
+	Lines          []Line
+}
+
+// Line is a single booking of a bank statement. Amount is positive for money
+// received (credit on the bank statement) and negative for money paid out.
+type Line struct {
+	Date        time.Time
+	ValueDate   *time.Time
+	Amount      float64
+	Description string
+	Reference   string
+	Balance     *float64
+}
+
+// Parse parses a statement in the given format. The format is one of
+// FORMAT_CSV, FORMAT_MT940 or FORMAT_CAMT053; CSV uses the default options.
+func Parse(format string, r io.Reader) (*Statement, error) {
+	switch strings.ToUpper(strings.ReplaceAll(format, ".", "")) {
+	case FORMAT_CSV:
+		return ParseCSV(r, CSVOptions{})
+	case FORMAT_MT940:
+		return ParseMT940(r)
+	case FORMAT_CAMT053:
+		return ParseCAMT053(r)
+	}
+	return nil, errors.New("unsupported statement format: " + format)
+}
+
+// complete fills the statement period from its lines when the source format
+// does not carry it.
+func (s *Statement) complete() {
+	for _, line := range s.Lines {
+		if s.StartDate.IsZero() || line.Date.Before(s.StartDate) {
+			s.StartDate = line.Date
+		}
+		if s.EndDate.IsZero() || line.Date.After(s.EndDate) {
+			s.EndDate = line.Date
+		}
+	}
+}
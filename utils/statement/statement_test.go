@@ -0,0 +1,156 @@
+package statement
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	data := "Date,Description,Reference,Debit,Credit,Balance\n" +
+		"2024-03-01,Transfer from customer,INV-001,,1500000.00,11500000.00\n" +
+		"2024-03-02,Bank charge,,6500,,11493500.00\n"
+
+	st, err := ParseCSV(strings.NewReader(data), CSVOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Lines) != 2 {
+		t.Fatalf("len(Lines) = %d, want 2", len(st.Lines))
+	}
+	var tests = []struct {
+		amount    float64
+		reference string
+	}{
+		{1500000, "INV-001"},
+		{-6500, ""},
+	}
+	for i, test := range tests {
+		if st.Lines[i].Amount != test.amount || st.Lines[i].Reference != test.reference {
+			t.Errorf("Lines[%d] = %v %q, want %v %q", i, st.Lines[i].Amount, st.Lines[i].Reference, test.amount, test.reference)
+		}
+	}
+	if st.OpeningBalance != 10000000 || st.ClosingBalance != 11493500 {
+		t.Errorf("balances = %v, %v, want 10000000, 11493500", st.OpeningBalance, st.ClosingBalance)
+	}
+	if st.StartDate.Format("2006-01-02") != "2024-03-01" || st.EndDate.Format("2006-01-02") != "2024-03-02" {
+		t.Errorf("period = %s - %s", st.StartDate, st.EndDate)
+	}
+}
+
+func TestParseCSVDecimalComma(t *testing.T) {
+	data := "tanggal;keterangan;amount\n01/03/2024;Setoran;1.250,50\n02/03/2024;Biaya;-10,25\n"
+
+	st, err := ParseCSV(strings.NewReader(data), CSVOptions{Comma: ';', DateLayout: "02/01/2006", DecimalComma: true})
+	if err == nil {
+		t.Fatal("A missing date column should produce an error")
+	}
+
+	data = strings.Replace(data, "tanggal;keterangan", "date;description", 1)
+	st, err = ParseCSV(strings.NewReader(data), CSVOptions{Comma: ';', DateLayout: "02/01/2006", DecimalComma: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Lines[0].Amount != 1250.5 || st.Lines[1].Amount != -10.25 {
+		t.Errorf("amounts = %v, %v", st.Lines[0].Amount, st.Lines[1].Amount)
+	}
+	if st.ClosingBalance != 1240.25 {
+		t.Errorf("ClosingBalance = %v, want 1240.25", st.ClosingBalance)
+	}
+}
+
+func TestParseMT940(t *testing.T) {
+	data := `{1:F01BANKIDJAXXXX0000000000}{2:I940BANKIDJAXXXXN}{4:
+:20:STMT240301
+:25:1234567890
+:28C:00001/001
+:60F:C240229IDR10000000,00
+:61:2403010301C1500000,00NTRFINV-001//B240301001
+:86:Transfer from customer
+PT Maju Jaya
+:61:240302D6500,00NCHGNONREF//B240302009
+:86:Bank charge
+:62F:C240302IDR11493500,00
+-}`
+
+	st, err := ParseMT940(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Reference != "STMT240301" || st.AccountNumber != "1234567890" || st.CurrencyCode != "IDR" {
+		t.Errorf("header = %q %q %q", st.Reference, st.AccountNumber, st.CurrencyCode)
+	}
+	if st.OpeningBalance != 10000000 || st.ClosingBalance != 11493500 {
+		t.Errorf("balances = %v, %v", st.OpeningBalance, st.ClosingBalance)
+	}
+	if len(st.Lines) != 2 {
+		t.Fatalf("len(Lines) = %d, want 2", len(st.Lines))
+	}
+	var tests = []struct {
+		amount      float64
+		reference   string
+		description string
+	}{
+		{1500000, "INV-001", "Transfer from customer PT Maju Jaya"},
+		{-6500, "B240302009", "Bank charge"},
+	}
+	for i, test := range tests {
+		line := st.Lines[i]
+		if line.Amount != test.amount || line.Reference != test.reference || line.Description != test.description {
+			t.Errorf("Lines[%d] = %v %q %q, want %v %q %q", i, line.Amount, line.Reference, line.Description, test.amount, test.reference, test.description)
+		}
+	}
+
+	if _, err := ParseMT940(strings.NewReader(":61:bad\n")); err == nil {
+		t.Error("An invalid statement line should produce an error")
+	}
+}
+
+func TestParseCAMT053(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Id>STMT-2024-03</Id>
+      <Acct><Id><Othr><Id>1234567890</Id></Othr></Id><Ccy>IDR</Ccy></Acct>
+      <Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="IDR">10000000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-02-29</Dt></Dt></Bal>
+      <Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="IDR">11493500.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-03-02</Dt></Dt></Bal>
+      <Ntry>
+        <Amt Ccy="IDR">1500000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><Dt>2024-03-01</Dt></BookgDt><ValDt><Dt>2024-03-01</Dt></ValDt>
+        <AcctSvcrRef>B240301001</AcctSvcrRef>
+        <NtryDtls><TxDtls><Refs><EndToEndId>INV-001</EndToEndId></Refs><RmtInf><Ustrd>Transfer from customer</Ustrd></RmtInf></TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="IDR">6500.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2024-03-02</Dt></BookgDt>
+        <AcctSvcrRef>B240302009</AcctSvcrRef>
+        <AddtlNtryInf>Bank charge</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+	st, err := Parse("camt.053", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Reference != "STMT-2024-03" || st.AccountNumber != "1234567890" || st.CurrencyCode != "IDR" {
+		t.Errorf("header = %q %q %q", st.Reference, st.AccountNumber, st.CurrencyCode)
+	}
+	if st.OpeningBalance != 10000000 || st.ClosingBalance != 11493500 {
+		t.Errorf("balances = %v, %v", st.OpeningBalance, st.ClosingBalance)
+	}
+	if len(st.Lines) != 2 {
+		t.Fatalf("len(Lines) = %d, want 2", len(st.Lines))
+	}
+	if l := st.Lines[0]; l.Amount != 1500000 || l.Reference != "INV-001" || l.Description != "Transfer from customer" || l.ValueDate == nil {
+		t.Errorf("Lines[0] = %+v", l)
+	}
+	if l := st.Lines[1]; l.Amount != -6500 || l.Reference != "B240302009" || l.Description != "Bank charge" {
+		t.Errorf("Lines[1] = %+v", l)
+	}
+
+	if _, err := Parse("QIF", strings.NewReader("")); err == nil {
+		t.Error("An unsupported format should produce an error")
+	}
+}